@@ -0,0 +1,37 @@
+// Команда openapi-gen генерирует типы и операции Go-клиента по спецификации
+// OpenAPI брокера; запускается через go generate в пакете pkg/client.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"queue-broker/pkg/openapi"
+)
+
+func main() {
+	spec := flag.String("spec", "", "path to the OpenAPI spec")
+	out := flag.String("out", "", "path to the generated file")
+	pkg := flag.String("package", "client", "package name of the generated file")
+	flag.Parse()
+	if *spec == "" || *out == "" {
+		fmt.Println("Usage: openapi-gen --spec <openapi.json> --out <file.go> [--package <name>]")
+		os.Exit(2)
+	}
+
+	data, err := os.ReadFile(*spec)
+	if err != nil {
+		fmt.Println("Error reading spec:", err)
+		os.Exit(1)
+	}
+	src, err := openapi.Generate(data, *pkg)
+	if err != nil {
+		fmt.Println("Error generating client:", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(*out, src, 0o644); err != nil {
+		fmt.Println("Error writing client:", err)
+		os.Exit(1)
+	}
+}
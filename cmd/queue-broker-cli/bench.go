@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"queue-broker/pkg/client"
+)
+
+// benchOptions параметры нагрузочного теста
+type benchOptions struct {
+	producers int
+	consumers int
+	// messages сколько сообщений отправить (0 — до истечения duration)
+	messages int
+	// size размер тела сообщения в байтах
+	size int
+	// duration ограничение длительности теста (0 — без ограничения)
+	duration time.Duration
+}
+
+// latencies накопитель длительностей операций
+type latencies struct {
+	mu     sync.Mutex
+	values []time.Duration
+	errors int
+}
+
+func (l *latencies) add(d time.Duration) {
+	l.mu.Lock()
+	l.values = append(l.values, d)
+	l.mu.Unlock()
+}
+
+func (l *latencies) fail() {
+	l.mu.Lock()
+	l.errors++
+	l.mu.Unlock()
+}
+
+// percentile возвращает p-й процентиль; values должны быть отсортированы
+func percentile(values []time.Duration, p float64) time.Duration {
+	if len(values) == 0 {
+		return 0
+	}
+	i := int(float64(len(values))*p/100+0.5) - 1
+	return values[min(max(i, 0), len(values)-1)]
+}
+
+// benchTimestampLen длина метки времени отправки в начале тела сообщения
+const benchTimestampLen = 19
+
+func parseBenchArgs(args []string) (string, benchOptions, error) {
+	opts := benchOptions{producers: 1, consumers: 1, messages: 1000, size: 128}
+	if len(args) < 1 {
+		return "", opts, errors.New("usage: bench <queue> [--producers <n>] [--consumers <n>] [--messages <n>] [--size <bytes>] [--duration <seconds>]")
+	}
+	for i := 1; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return "", opts, fmt.Errorf("missing value for %s", args[i])
+		}
+		n, err := strconv.Atoi(args[i+1])
+		if err != nil || n < 0 {
+			return "", opts, fmt.Errorf("invalid value for %s: %q", args[i], args[i+1])
+		}
+		switch args[i] {
+		case "--producers":
+			opts.producers = n
+		case "--consumers":
+			opts.consumers = n
+		case "--messages":
+			opts.messages = n
+		case "--size":
+			opts.size = n
+		case "--duration":
+			opts.duration = time.Duration(n) * time.Second
+		default:
+			return "", opts, fmt.Errorf("unknown flag %s", args[i])
+		}
+	}
+	if opts.messages == 0 && opts.duration == 0 {
+		return "", opts, errors.New("either --messages or --duration must be set")
+	}
+	if opts.producers == 0 && opts.consumers == 0 {
+		return "", opts, errors.New("at least one producer or consumer is required")
+	}
+	return args[0], opts, nil
+}
+
+// bench отправляет и получает сообщения параллельно и выводит пропускную
+// способность, задержки и долю ошибок. Потребители получают сообщения, пока
+// не получат все отправленные или не истечет --duration; без производителей
+// они разбирают очередь до --messages сообщений.
+func bench(ctx context.Context, c *client.Client, args []string) error {
+	queue, opts, err := parseBenchArgs(args)
+	if err != nil {
+		return err
+	}
+	if opts.duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.duration)
+		defer cancel()
+	}
+
+	var puts, gets, endToEnd latencies
+	var sent, received atomic.Int64
+	var producing sync.WaitGroup
+	done := make(chan struct{})
+	padding := strings.Repeat("x", max(opts.size-benchTimestampLen, 0))
+
+	start := time.Now()
+	for i := 0; i < opts.producers; i++ {
+		producing.Add(1)
+		go func() {
+			defer producing.Done()
+			for ctx.Err() == nil {
+				if n := sent.Add(1); opts.messages > 0 && n > int64(opts.messages) {
+					sent.Add(-1)
+					return
+				}
+				began := time.Now()
+				body := fmt.Sprintf("%0*d", benchTimestampLen, began.UnixNano()) + padding
+				if err := c.Put(ctx, queue, client.Message{Body: body}); err != nil {
+					sent.Add(-1)
+					if ctx.Err() == nil {
+						puts.fail()
+					}
+					continue
+				}
+				puts.add(time.Since(began))
+			}
+		}()
+	}
+	go func() {
+		producing.Wait()
+		close(done)
+	}()
+
+	var consuming sync.WaitGroup
+	for i := 0; i < opts.consumers; i++ {
+		consuming.Add(1)
+		go func() {
+			defer consuming.Done()
+			for ctx.Err() == nil {
+				select {
+				case <-done:
+					if opts.producers > 0 && received.Load() >= sent.Load() {
+						return
+					}
+				default:
+				}
+				if opts.producers == 0 && opts.messages > 0 && received.Load() >= int64(opts.messages) {
+					return
+				}
+				began := time.Now()
+				msg, err := c.Get(ctx, queue, client.GetOptions{Timeout: time.Second, MaxAttempts: 1})
+				if errors.Is(err, client.ErrEmpty) || ctx.Err() != nil {
+					continue
+				}
+				if err != nil {
+					gets.fail()
+					continue
+				}
+				finished := time.Now()
+				received.Add(1)
+				gets.add(finished.Sub(began))
+				if len(msg.Body) >= benchTimestampLen {
+					if sentAt, err := strconv.ParseInt(msg.Body[:benchTimestampLen], 10, 64); err == nil {
+						endToEnd.add(finished.Sub(time.Unix(0, sentAt)))
+					}
+				}
+			}
+		}()
+	}
+	producing.Wait()
+	consuming.Wait()
+	elapsed := time.Since(start)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "duration: %v, producers: %d, consumers: %d, size: %d bytes\n", elapsed.Round(time.Millisecond), opts.producers, opts.consumers, opts.size)
+	fmt.Fprintln(w, "OP\tOK\tERRORS\tERROR RATE\tMSG/S\tP50\tP99")
+	for _, op := range []struct {
+		name string
+		l    *latencies
+	}{{"put", &puts}, {"get", &gets}, {"end-to-end", &endToEnd}} {
+		values := op.l.values
+		sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+		rate := 0.0
+		if total := len(values) + op.l.errors; total > 0 {
+			rate = float64(op.l.errors) / float64(total) * 100
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.2f%%\t%.1f\t%v\t%v\n", op.name, len(values), op.l.errors, rate,
+			float64(len(values))/elapsed.Seconds(), percentile(values, 50), percentile(values, 99))
+	}
+	return w.Flush()
+}
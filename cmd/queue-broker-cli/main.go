@@ -0,0 +1,488 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"queue-broker/pkg/broker"
+	"queue-broker/pkg/client"
+)
+
+const usage = `Usage: queue-broker-cli [--url <url>] [--namespace <tenant> --token <token>] [--h2c <true|false>] <command> [args]
+
+Commands:
+  put <queue> <message|->   [--header <name=value>]... [--dedup-id <id>] [--content-type <type>] [--delay <seconds>] [--group <id>]
+  get <queue>               [--timeout <seconds|duration>] [--peeklock [--lock-duration <seconds>]]
+  list
+  stats <queue>
+  purge <queue>
+  export <queue> [file]
+  import <queue> [file]
+  pause <queue>
+  resume <queue>
+  snapshot
+  schedules
+  schedule <queue> <cron> <message> [--id <id>] [--timezone <tz>] [--header <name=value>]...
+  unschedule <id>
+  keys                      [--rotate]
+  browse <queue>            [--offset <n>] [--limit <n>]
+  delete <queue> <id>
+  requeue <queue> <id>      [--to <queue>]
+  tail <queue>              [--peek]
+  bench <queue>             [--producers <n>] [--consumers <n>] [--messages <n>] [--size <bytes>] [--duration <seconds>]
+
+URL defaults to $QUEUE_BROKER_URL or http://localhost:8080. "-" as a message reads it from stdin.
+--h2c true sends all requests over one cleartext HTTP/2 connection.
+get, tail and browse print messages as JSON, one per line; browse shows pending
+messages with truncated bodies without consuming them. export writes pending messages as
+NDJSON (to stdout without a file) and import loads such a file into a queue, e.g. for
+backups and moving messages between environments. tail --peek shows copies of new
+messages without consuming them. bench puts and gets messages concurrently and reports
+throughput, p50/p99 latency and error rates. schedule puts a message into the queue on a
+cron schedule (5 fields or @hourly, @daily...); the message is a Go text/template with
+.Time, .Schedule and .Queue.`
+
+func main() {
+	args := os.Args[1:]
+	baseURL := os.Getenv("QUEUE_BROKER_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8080"
+	}
+	namespace := ""
+	token := ""
+	h2c := false
+
+	// Общие флаги задаются до команды
+	for len(args) >= 2 && strings.HasPrefix(args[0], "--") {
+		switch args[0] {
+		case "--url":
+			baseURL = args[1]
+		case "--namespace":
+			namespace = args[1]
+		case "--token":
+			token = args[1]
+		case "--h2c":
+			h2c, _ = strconv.ParseBool(args[1])
+		default:
+			fail(fmt.Errorf("unknown flag %s", args[0]))
+		}
+		args = args[2:]
+	}
+	if len(args) < 1 {
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+
+	c := client.New(baseURL)
+	if h2c {
+		c = client.NewH2C(baseURL)
+	}
+	c.Namespace = namespace
+	c.Token = token
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := run(ctx, c, args[0], args[1:]); err != nil {
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "Error:", err)
+	os.Exit(1)
+}
+
+func run(ctx context.Context, c *client.Client, command string, args []string) error {
+	switch command {
+	case "put":
+		return put(ctx, c, args)
+	case "get":
+		return get(ctx, c, args)
+	case "list":
+		return list(ctx, c)
+	case "stats":
+		if len(args) != 1 {
+			return errors.New("usage: stats <queue>")
+		}
+		return stats(ctx, c, args[0])
+	case "purge":
+		if len(args) != 1 {
+			return errors.New("usage: purge <queue>")
+		}
+		count, err := c.Purge(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Purged %d messages from %s\n", count, args[0])
+		return nil
+	case "export", "import":
+		if len(args) < 1 || len(args) > 2 {
+			return fmt.Errorf("usage: %s <queue> [file]", command)
+		}
+		return transfer(ctx, c, command, args)
+	case "pause", "resume":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: %s <queue>", command)
+		}
+		if command == "pause" {
+			if err := c.Pause(ctx, args[0]); err != nil {
+				return err
+			}
+			fmt.Printf("Paused delivery from %s\n", args[0])
+			return nil
+		}
+		if err := c.Resume(ctx, args[0]); err != nil {
+			return err
+		}
+		fmt.Printf("Resumed delivery from %s\n", args[0])
+		return nil
+	case "snapshot":
+		result, err := c.Snapshot(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Saved %d queues (%d messages) to %s\n", result.Queues, result.Messages, result.Location)
+		return nil
+	case "schedules":
+		schedules, err := c.Schedules(ctx)
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		for _, s := range schedules {
+			if err := encoder.Encode(s); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "schedule":
+		return schedule(ctx, c, args)
+	case "unschedule":
+		if len(args) != 1 {
+			return errors.New("usage: unschedule <id>")
+		}
+		return c.DeleteSchedule(ctx, args[0])
+	case "keys":
+		get := c.KeyStatus
+		if len(args) > 0 && args[0] == "--rotate" {
+			get = c.RotateKeys
+		}
+		status, err := get(ctx)
+		if err != nil {
+			return err
+		}
+		return json.NewEncoder(os.Stdout).Encode(status)
+	case "browse":
+		return browse(ctx, c, args)
+	case "delete", "requeue":
+		return messageAction(ctx, c, command, args)
+	case "bench":
+		return bench(ctx, c, args)
+	case "tail":
+		if len(args) < 1 || len(args) > 2 || (len(args) == 2 && args[1] != "--peek") {
+			return errors.New("usage: tail <queue> [--peek]")
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		output := func(msg *client.Message) error {
+			return encoder.Encode(view(msg))
+		}
+		var err error
+		if len(args) == 2 {
+			err = c.Tail(ctx, args[0], output)
+		} else {
+			err = c.Stream(ctx, args[0], output)
+		}
+		// Ctrl+C — штатное завершение
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+		return err
+	}
+	return fmt.Errorf("unknown command %q", command)
+}
+
+func put(ctx context.Context, c *client.Client, args []string) error {
+	if len(args) < 2 {
+		return errors.New("usage: put <queue> <message|-> [flags]")
+	}
+	queue, body := args[0], args[1]
+	if body == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		body = string(data)
+	}
+
+	msg := client.Message{Body: body}
+	for i := 2; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return fmt.Errorf("missing value for %s", args[i])
+		}
+		switch args[i] {
+		case "--header":
+			name, value, ok := strings.Cut(args[i+1], "=")
+			if !ok {
+				return fmt.Errorf("invalid header %q, expected name=value", args[i+1])
+			}
+			if msg.Headers == nil {
+				msg.Headers = make(map[string]string)
+			}
+			msg.Headers[name] = value
+		case "--dedup-id":
+			msg.DedupID = args[i+1]
+		case "--content-type":
+			msg.ContentType = args[i+1]
+		case "--group":
+			msg.GroupID = args[i+1]
+		case "--delay":
+			seconds, err := strconv.Atoi(args[i+1])
+			if err != nil || seconds < 0 {
+				return fmt.Errorf("invalid value for --delay: %q", args[i+1])
+			}
+			msg.Delay = time.Duration(seconds) * time.Second
+		default:
+			return fmt.Errorf("unknown flag %s", args[i])
+		}
+	}
+	return c.Put(ctx, queue, msg)
+}
+
+func schedule(ctx context.Context, c *client.Client, args []string) error {
+	if len(args) < 3 {
+		return errors.New("usage: schedule <queue> <cron> <message> [flags]")
+	}
+	s := client.Schedule{Queue: args[0], Cron: args[1], Message: args[2]}
+	for i := 3; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return fmt.Errorf("missing value for %s", args[i])
+		}
+		switch args[i] {
+		case "--id":
+			s.ID = args[i+1]
+		case "--timezone":
+			s.Timezone = args[i+1]
+		case "--header":
+			name, value, ok := strings.Cut(args[i+1], "=")
+			if !ok {
+				return fmt.Errorf("invalid header %q, expected name=value", args[i+1])
+			}
+			if s.Headers == nil {
+				s.Headers = make(map[string]string)
+			}
+			s.Headers[name] = value
+		default:
+			return fmt.Errorf("unknown flag %s", args[i])
+		}
+	}
+	saved, err := c.SetSchedule(ctx, s)
+	if err != nil {
+		return err
+	}
+	if saved.Next.IsZero() {
+		fmt.Printf("Schedule %s: no upcoming runs\n", saved.ID)
+		return nil
+	}
+	fmt.Printf("Schedule %s: next run at %s\n", saved.ID, saved.Next.Format(time.RFC3339))
+	return nil
+}
+
+func get(ctx context.Context, c *client.Client, args []string) error {
+	if len(args) < 1 {
+		return errors.New("usage: get <queue> [flags]")
+	}
+	queue := args[0]
+	opts := client.GetOptions{MaxAttempts: 1}
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "--peeklock":
+			opts.PeekLock = true
+			continue
+		case "--timeout", "--lock-duration":
+		default:
+			return fmt.Errorf("unknown flag %s", args[i])
+		}
+		if i+1 >= len(args) {
+			return fmt.Errorf("missing value for %s", args[i])
+		}
+		if args[i] == "--timeout" {
+			timeout, err := broker.ParseTimeout(args[i+1])
+			if err != nil {
+				return fmt.Errorf("invalid value for %s: %q", args[i], args[i+1])
+			}
+			opts.Timeout = timeout
+			i++
+			continue
+		}
+		seconds, err := strconv.Atoi(args[i+1])
+		if err != nil || seconds < 0 {
+			return fmt.Errorf("invalid value for %s: %q", args[i], args[i+1])
+		}
+		opts.LockDuration = time.Duration(seconds) * time.Second
+		i++
+	}
+
+	msg, err := c.Get(ctx, queue, opts)
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(os.Stdout).Encode(view(msg))
+}
+
+// messageView сообщение для вывода: без пустого срока блокировки
+type messageView struct {
+	client.Message
+	LockedUntil *time.Time `json:"locked_until,omitempty"`
+}
+
+func view(msg *client.Message) messageView {
+	v := messageView{Message: *msg}
+	if !msg.LockedUntil.IsZero() {
+		v.LockedUntil = &msg.LockedUntil
+	}
+	return v
+}
+
+func browse(ctx context.Context, c *client.Client, args []string) error {
+	if len(args) < 1 {
+		return errors.New("usage: browse <queue> [--offset <n>] [--limit <n>]")
+	}
+	offset, limit := 0, 50
+	for i := 1; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return fmt.Errorf("missing value for %s", args[i])
+		}
+		n, err := strconv.Atoi(args[i+1])
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid value for %s: %q", args[i], args[i+1])
+		}
+		switch args[i] {
+		case "--offset":
+			offset = n
+		case "--limit":
+			limit = n
+		default:
+			return fmt.Errorf("unknown flag %s", args[i])
+		}
+	}
+
+	messages, total, err := c.Browse(ctx, args[0], offset, limit, 0)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	for _, msg := range messages {
+		// Срок блокировки у ожидающих сообщений не задан
+		if err := encoder.Encode(struct {
+			client.BrowsedMessage
+			LockedUntil *time.Time `json:"locked_until,omitempty"`
+		}{BrowsedMessage: msg}); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%d-%d of %d pending messages\n", min(offset+1, total), offset+len(messages), total)
+	return nil
+}
+
+func messageAction(ctx context.Context, c *client.Client, command string, args []string) error {
+	usage := "usage: delete <queue> <id>"
+	if command == "requeue" {
+		usage = "usage: requeue <queue> <id> [--to <queue>]"
+	}
+	if len(args) < 2 {
+		return errors.New(usage)
+	}
+	id, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid message id %q", args[1])
+	}
+	if command == "delete" {
+		if len(args) != 2 {
+			return errors.New(usage)
+		}
+		return c.DeleteMessage(ctx, args[0], id)
+	}
+	target := ""
+	switch {
+	case len(args) == 4 && args[2] == "--to":
+		target = args[3]
+	case len(args) != 2:
+		return errors.New(usage)
+	}
+	return c.RequeueMessage(ctx, args[0], id, target)
+}
+
+func list(ctx context.Context, c *client.Client) error {
+	queues, err := c.Queues(ctx)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "QUEUE\tDEPTH\tDELAYED\tIN FLIGHT\tBYTES")
+	for _, q := range queues {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\n", q.Name, q.Depth, q.Delayed, q.InFlight, q.Bytes)
+	}
+	return w.Flush()
+}
+
+// transfer выгружает сообщения очереди в файл или stdout (export) или
+// загружает их из файла или stdin (import)
+func transfer(ctx context.Context, c *client.Client, command string, args []string) error {
+	queue := args[0]
+	if command == "export" {
+		out := io.Writer(os.Stdout)
+		if len(args) == 2 {
+			f, err := os.Create(args[1])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			out = f
+		}
+		count, err := c.Export(ctx, queue, out)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Exported %d messages from %s\n", count, queue)
+		return nil
+	}
+
+	in := io.Reader(os.Stdin)
+	if len(args) == 2 {
+		f, err := os.Open(args[1])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	result, err := c.Import(ctx, queue, in)
+	if err != nil {
+		return fmt.Errorf("%w (imported %d messages before the error)", err, result.Imported)
+	}
+	fmt.Printf("Imported %d messages into %s (%d duplicates skipped)\n", result.Imported, queue, result.Duplicates)
+	return nil
+}
+
+func stats(ctx context.Context, c *client.Client, queue string) error {
+	queues, err := c.Queues(ctx)
+	if err != nil {
+		return err
+	}
+	for _, q := range queues {
+		if q.Name == queue {
+			fmt.Printf("queue:     %s\ndepth:     %d\ndelayed:   %d\nin flight: %d\nbytes:     %d\n", q.Name, q.Depth, q.Delayed, q.InFlight, q.Bytes)
+			return nil
+		}
+	}
+	return client.ErrQueueNotFound
+}
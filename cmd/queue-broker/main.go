@@ -0,0 +1,820 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	// База часовых поясов для интервалов паузы на системах без tzdata
+	_ "time/tzdata"
+
+	"queue-broker/pkg/audit"
+	"queue-broker/pkg/bridge"
+	"queue-broker/pkg/broker"
+	"queue-broker/pkg/cluster"
+	"queue-broker/pkg/httpapi"
+	"queue-broker/pkg/mqtt"
+	"queue-broker/pkg/nats"
+	"queue-broker/pkg/objstore"
+	"queue-broker/pkg/peer"
+	"queue-broker/pkg/raft"
+	"queue-broker/pkg/segment"
+	"queue-broker/pkg/sqs"
+	"queue-broker/pkg/stomp"
+)
+
+// fileConfig файл конфигурации, задаваемый флагом --config
+type fileConfig struct {
+	Kafka *bridge.KafkaConfig `json:"kafka"`
+	// Tenants включает многоарендный режим; ключи задаются в base64
+	Tenants []broker.Tenant `json:"tenants"`
+	// Signing включает обязательную подпись запросов к очередям
+	Signing *httpapi.SigningConfig `json:"signing"`
+	// OIDC включает проверку токенов OAuth2/OIDC вместо статических ключей;
+	// несовместим с арендаторами, которые тоже передают токен в Authorization
+	OIDC *httpapi.OIDCConfig `json:"oidc"`
+	// RateLimits ограничения скорости запросов к очередям
+	RateLimits *httpapi.RateLimitConfig `json:"rate_limits"`
+	// Webhooks уведомления о глубине очередей, зависших очередях и недоставленных сообщениях
+	Webhooks *bridge.WebhookConfig `json:"webhooks"`
+	// Server таймауты, лимиты и протоколы HTTP-сервера; флаги командной
+	// строки имеют приоритет
+	Server *httpapi.ServerConfig `json:"server"`
+	// CORS разрешает браузерным клиентам обращаться к брокеру напрямую
+	CORS *httpapi.CORSConfig `json:"cors"`
+	// Access списки доступа по адресам клиентов и доверенные прокси
+	Access *httpapi.AccessConfig `json:"access"`
+	// Timeouts ожидание сообщения получателями; флаги командной строки имеют приоритет
+	Timeouts *timeoutConfig `json:"timeouts"`
+}
+
+// timeoutConfig ожидание сообщения: число секунд или длительность Go ("250ms", "2m")
+type timeoutConfig struct {
+	// Default ожидание запросов без timeout (--default-timeout)
+	Default string `json:"default"`
+	// Max предельное ожидание: больший timeout сокращается до него (--max-timeout)
+	Max string `json:"max"`
+}
+
+func loadConfig(path string) (*fileConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg fileConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse config: %w", err)
+	}
+	return &cfg, nil
+}
+
+// mergeTimeouts дополняет base непустыми значениями override
+func mergeTimeouts(base, override timeoutConfig) timeoutConfig {
+	if override.Default != "" {
+		base.Default = override.Default
+	}
+	if override.Max != "" {
+		base.Max = override.Max
+	}
+	return base
+}
+
+// applyTimeouts задает брокеру ожидание сообщения по умолчанию и предельное
+func applyTimeouts(qb *broker.QueueBroker, cfg timeoutConfig) error {
+	defaultTimeout, err := broker.ParseTimeout(cfg.Default)
+	if err != nil {
+		return fmt.Errorf("default timeout %q: %w", cfg.Default, err)
+	}
+	qb.SetDefaultTimeout(defaultTimeout)
+	if cfg.Max != "" {
+		maxTimeout, err := broker.ParseTimeout(cfg.Max)
+		if err != nil {
+			return fmt.Errorf("max timeout %q: %w", cfg.Max, err)
+		}
+		qb.SetMaxTimeout(maxTimeout)
+	}
+	return nil
+}
+
+// listen открывает слушающий сокет addr (см. httpapi.Listen), принимающий
+// соединения по спискам доступа (access может быть nil)
+func listen(addr string, access *httpapi.AccessList) (net.Listener, error) {
+	ln, err := httpapi.Listen(addr)
+	if err != nil {
+		return nil, err
+	}
+	return access.Listener(ln), nil
+}
+
+// canaryURL адрес, по которому канарейка обращается к HTTP API на addr;
+// сокет systemd неизвестен заранее, для него используется --port
+func canaryURL(addr string, port int) string {
+	if strings.HasPrefix(addr, "unix://") {
+		return addr
+	}
+	if host, p, err := net.SplitHostPort(strings.TrimPrefix(addr, "tcp://")); err == nil {
+		if host == "" || host == "0.0.0.0" || host == "::" {
+			host = "127.0.0.1"
+		}
+		return "http://" + net.JoinHostPort(host, p)
+	}
+	return fmt.Sprintf("http://127.0.0.1:%d", port)
+}
+
+// keySource возвращает источник набора ключей шифрования при хранении: файл
+// или команду (например, расшифровку набора через KMS), печатающую набор
+// в stdout; nil — шифрование выключено
+func keySource(file, command string) httpapi.KeySource {
+	switch {
+	case command != "":
+		return func() (*broker.Keyring, error) {
+			cmd := exec.Command("sh", "-c", command)
+			cmd.Stderr = os.Stderr
+			data, err := cmd.Output()
+			if err != nil {
+				return nil, fmt.Errorf("encryption keys command: %w", err)
+			}
+			return broker.ParseKeyring(data)
+		}
+	case file != "":
+		return func() (*broker.Keyring, error) {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			return broker.ParseKeyring(data)
+		}
+	}
+	return nil
+}
+
+func main() {
+	// Парсинг аргументов командной строки
+	args := os.Args[1:]
+	if len(args) < 1 {
+		fmt.Println("Usage: ./queue_broker --port <port> [--listen <host:port|unix:///path|systemd[:name]>] [--admin-listen <addr>] [--metrics-listen <addr>] [--peer-listen <addr>] --max-queue-size <size> --max-queues <count> --default-timeout <seconds|duration> [--max-timeout <seconds|duration>] [--routing-rules <file>] [--dedup-window <seconds>] [--transaction-ttl <seconds>] [--compress-threshold <bytes>] [--at-rest-compression <gzip|snappy|none>] [--encryption-keys <file> | --encryption-keys-command <command>] [--region <name> --peers <url,...> --federation-dedup-window <seconds>] [--canary-interval <seconds>] [--config <file>] [--plugins <file.so|name,...>] [--mqtt-port <port>] [--nats-port <port>] [--stomp-port <port>] [--sqs-port <port>] [--shed-heap-mb <mb>] [--shed-gc-pause-ms <ms>] [--shed-goroutines <count>] [--max-message-size <bytes>] [--seed-dir <dir>] [--max-concurrent <count> [--max-waiting <count>]] [--max-queue-bytes <bytes>] [--max-total-bytes <bytes>] [--follow <primary url>] [--peer-secret-file <file>] [--cluster-self <url> --cluster-nodes <url,...>] [--raft-self <url> --raft-peers <url,...> --raft-dir <dir>] [--archive-dir <dir>] [--simulate-latency <true|false>] [--read-header-timeout <seconds>] [--idle-timeout <seconds>] [--max-header-bytes <bytes>] [--max-concurrent-streams <count>] [--h2c <true|false>] [--compress-min-size <bytes>] [--snapshot-store <dir|s3://bucket/prefix>] [--restore-from <file|s3://bucket/key>] [--wal <file> [--wal-sync <always|interval|never>] [--wal-sync-interval <ms>]] [--offload-store <dir|s3://bucket/prefix> [--offload-threshold <bytes>] [--offload-presign <seconds>]] [--segment-dir <dir> [--segment-size <bytes>]] [--spill-threshold <bytes>] [--audit-log <file:path|syslog:|syslog://host:port|https://url,...> [--audit-data <true|false>]] [--usage-dir <dir>] [--rest-status-codes <true|false>] | --promote <standby url> [--peer-secret-file <file>]")
+		return
+	}
+
+	port := 8080
+	maxQueueSize := 100
+	maxQueues := 10
+	routingRules := ""
+	dedupWindow := 0
+	transactionTTL := 0
+	compressThreshold := 0
+	atRestCompression := ""
+	encryptionKeys := ""
+	encryptionKeysCommand := ""
+	region := "default"
+	peers := ""
+	federationDedupWindow := 3600
+	canaryInterval := 0
+	configFile := ""
+	plugins := ""
+	mqttPort := 0
+	natsPort := 0
+	stompPort := 0
+	sqsPort := 0
+	shedHeapMB := 0
+	shedGCPauseMs := 0
+	shedGoroutines := 0
+	maxMessageSize := httpapi.DefaultMaxMessageSize
+	seedDir := ""
+	maxConcurrent := 0
+	maxQueueBytes := 0
+	maxTotalBytes := 0
+	maxWaiting := 0
+	follow := ""
+	promote := ""
+	peerSecretFile := ""
+	clusterSelf := ""
+	clusterNodes := ""
+	raftSelf := ""
+	raftPeers := ""
+	raftDir := ""
+	archiveDir := ""
+	simulateLatency := false
+	restStatusCodes := false
+	auditLog := ""
+	auditData := false
+	var serverFlags httpapi.ServerConfig
+	var timeoutFlags timeoutConfig
+	h2c := ""
+	snapshotStore := ""
+	restoreFrom := ""
+	walPath := ""
+	walSync := ""
+	walSyncInterval := 0
+	compressMinSize := httpapi.DefaultCompressMinSize
+	offloadStore := ""
+	offloadThreshold := 256 << 10
+	offloadPresign := 0
+	offloadThresholdSet := false
+	segmentDir := ""
+	segmentSize := 0
+	spillThreshold := 0
+	usageDir := ""
+	listenAddr := ""
+	adminListen := ""
+	metricsListen := ""
+	peerListen := ""
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--port":
+			port, _ = strconv.Atoi(args[i+1])
+		case "--listen":
+			listenAddr = args[i+1]
+		case "--admin-listen":
+			adminListen = args[i+1]
+		case "--metrics-listen":
+			metricsListen = args[i+1]
+		case "--peer-listen":
+			peerListen = args[i+1]
+		case "--max-queue-size":
+			maxQueueSize, _ = strconv.Atoi(args[i+1])
+		case "--max-queues":
+			maxQueues, _ = strconv.Atoi(args[i+1])
+		case "--default-timeout":
+			timeoutFlags.Default = args[i+1]
+		case "--max-timeout":
+			timeoutFlags.Max = args[i+1]
+		case "--routing-rules":
+			routingRules = args[i+1]
+		case "--dedup-window":
+			dedupWindow, _ = strconv.Atoi(args[i+1])
+		case "--transaction-ttl":
+			transactionTTL, _ = strconv.Atoi(args[i+1])
+		case "--compress-threshold":
+			compressThreshold, _ = strconv.Atoi(args[i+1])
+		case "--at-rest-compression":
+			atRestCompression = args[i+1]
+		case "--encryption-keys":
+			encryptionKeys = args[i+1]
+		case "--encryption-keys-command":
+			encryptionKeysCommand = args[i+1]
+		case "--region":
+			region = args[i+1]
+		case "--peers":
+			peers = args[i+1]
+		case "--federation-dedup-window":
+			federationDedupWindow, _ = strconv.Atoi(args[i+1])
+		case "--canary-interval":
+			canaryInterval, _ = strconv.Atoi(args[i+1])
+		case "--config":
+			configFile = args[i+1]
+		case "--plugins":
+			plugins = args[i+1]
+		case "--mqtt-port":
+			mqttPort, _ = strconv.Atoi(args[i+1])
+		case "--nats-port":
+			natsPort, _ = strconv.Atoi(args[i+1])
+		case "--stomp-port":
+			stompPort, _ = strconv.Atoi(args[i+1])
+		case "--sqs-port":
+			sqsPort, _ = strconv.Atoi(args[i+1])
+		case "--shed-heap-mb":
+			shedHeapMB, _ = strconv.Atoi(args[i+1])
+		case "--shed-gc-pause-ms":
+			shedGCPauseMs, _ = strconv.Atoi(args[i+1])
+		case "--shed-goroutines":
+			shedGoroutines, _ = strconv.Atoi(args[i+1])
+		case "--max-message-size":
+			maxMessageSize, _ = strconv.Atoi(args[i+1])
+		case "--seed-dir":
+			seedDir = args[i+1]
+		case "--max-queue-bytes":
+			maxQueueBytes, _ = strconv.Atoi(args[i+1])
+		case "--max-total-bytes":
+			maxTotalBytes, _ = strconv.Atoi(args[i+1])
+		case "--max-concurrent":
+			maxConcurrent, _ = strconv.Atoi(args[i+1])
+		case "--max-waiting":
+			maxWaiting, _ = strconv.Atoi(args[i+1])
+		case "--follow":
+			follow = args[i+1]
+		case "--promote":
+			promote = args[i+1]
+		case "--peer-secret-file":
+			peerSecretFile = args[i+1]
+		case "--cluster-self":
+			clusterSelf = args[i+1]
+		case "--cluster-nodes":
+			clusterNodes = args[i+1]
+		case "--raft-self":
+			raftSelf = args[i+1]
+		case "--raft-peers":
+			raftPeers = args[i+1]
+		case "--raft-dir":
+			raftDir = args[i+1]
+		case "--usage-dir":
+			usageDir = args[i+1]
+		case "--archive-dir":
+			archiveDir = args[i+1]
+		case "--simulate-latency":
+			simulateLatency, _ = strconv.ParseBool(args[i+1])
+		case "--rest-status-codes":
+			restStatusCodes, _ = strconv.ParseBool(args[i+1])
+		case "--audit-log":
+			auditLog = args[i+1]
+		case "--audit-data":
+			auditData, _ = strconv.ParseBool(args[i+1])
+		case "--read-header-timeout":
+			serverFlags.ReadHeaderTimeout, _ = strconv.Atoi(args[i+1])
+		case "--idle-timeout":
+			serverFlags.IdleTimeout, _ = strconv.Atoi(args[i+1])
+		case "--max-header-bytes":
+			serverFlags.MaxHeaderBytes, _ = strconv.Atoi(args[i+1])
+		case "--max-concurrent-streams":
+			serverFlags.MaxConcurrentStreams, _ = strconv.Atoi(args[i+1])
+		case "--h2c":
+			h2c = args[i+1]
+		case "--snapshot-store":
+			snapshotStore = args[i+1]
+		case "--restore-from":
+			restoreFrom = args[i+1]
+		case "--wal":
+			walPath = args[i+1]
+		case "--wal-sync":
+			walSync = args[i+1]
+		case "--wal-sync-interval":
+			walSyncInterval, _ = strconv.Atoi(args[i+1])
+		case "--compress-min-size":
+			compressMinSize, _ = strconv.Atoi(args[i+1])
+		case "--offload-store":
+			offloadStore = args[i+1]
+		case "--offload-threshold":
+			offloadThreshold, _ = strconv.Atoi(args[i+1])
+			offloadThresholdSet = true
+		case "--segment-dir":
+			segmentDir = args[i+1]
+		case "--segment-size":
+			segmentSize, _ = strconv.Atoi(args[i+1])
+		case "--spill-threshold":
+			spillThreshold, _ = strconv.Atoi(args[i+1])
+		case "--offload-presign":
+			offloadPresign, _ = strconv.Atoi(args[i+1])
+		}
+	}
+
+	// Общий секрет межброкерных запросов
+	peerSecret := ""
+	if peerSecretFile != "" {
+		data, err := os.ReadFile(peerSecretFile)
+		if err != nil {
+			fmt.Println("Error reading peer secret:", err)
+			os.Exit(1)
+		}
+		peerSecret = strings.TrimSpace(string(data))
+	}
+
+	// Переключение ведомого брокера в основной
+	if promote != "" {
+		req, err := http.NewRequest(http.MethodPost, strings.TrimRight(promote, "/")+"/replication/promote", nil)
+		if err != nil {
+			fmt.Println("Error promoting standby:", err)
+			os.Exit(1)
+		}
+		peer.Sign(req, peerSecret)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			fmt.Println("Error promoting standby:", err)
+			os.Exit(1)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			fmt.Println("Error promoting standby:", resp.Status)
+			os.Exit(1)
+		}
+		fmt.Println("Standby promoted to primary")
+		return
+	}
+
+	// Создание и запуск сервера
+	// Ожидание сообщения задается ниже, после чтения --config
+	qb := broker.NewQueueBroker(maxQueueSize, maxQueues, 0)
+	qb.SetDefaultDedupWindow(dedupWindow)
+	if transactionTTL > 0 {
+		qb.SetTransactionTTL(transactionTTL)
+	}
+	if err := qb.SetDefaultCompression(atRestCompression); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	// Выбранный алгоритм без порога сжимает тела больше 1 КиБ
+	if compressThreshold == 0 && atRestCompression != "" && atRestCompression != broker.CompressionNone {
+		compressThreshold = 1024
+	}
+	qb.SetDefaultCompressThreshold(compressThreshold)
+	keys := keySource(encryptionKeys, encryptionKeysCommand)
+	if keys != nil {
+		keyring, err := keys()
+		if err == nil {
+			err = qb.SetKeyring(keyring)
+		}
+		if err != nil {
+			fmt.Println("Error loading encryption keys:", err)
+			return
+		}
+	}
+	qb.SetByteLimits(int64(maxQueueBytes), int64(maxTotalBytes))
+	qb.SetLatencySimulation(simulateLatency)
+	var auditor *audit.Logger
+	if auditLog != "" {
+		var sinks []audit.Sink
+		for _, spec := range strings.Split(auditLog, ",") {
+			sink, err := audit.Open(strings.TrimSpace(spec))
+			if err != nil {
+				fmt.Println("Error opening audit log:", err)
+				return
+			}
+			sinks = append(sinks, sink)
+		}
+		auditor = audit.New(auditData, sinks...)
+		defer auditor.Close()
+		qb.AddQueueListener(func(event broker.QueueEvent, queueName string) {
+			action := audit.QueueCreate
+			if event == broker.QueueDeleted {
+				action = audit.QueueDelete
+			}
+			auditor.Log(audit.Event{Action: action, Queue: queueName})
+		})
+	}
+	if archiveDir != "" {
+		qb.SetArchive(broker.DirArchive{Dir: archiveDir})
+	}
+	if offloadStore != "" {
+		store, err := objstore.Open(offloadStore)
+		if err != nil {
+			fmt.Println("Error opening offload store:", err)
+			return
+		}
+		qb.SetOffload(store, broker.OffloadConfig{Threshold: offloadThreshold, PresignTTL: time.Duration(offloadPresign) * time.Second, SpillBytes: int64(spillThreshold)})
+	}
+	var segments *segment.Store
+	if segmentDir != "" {
+		var err error
+		segments, err = segment.Open(segmentDir, segment.Options{Size: int64(segmentSize), SyncWrites: walPath != "" && (walSync == "" || walSync == broker.WALSyncAlways)})
+		if err != nil {
+			fmt.Println("Error opening segment store:", err)
+			return
+		}
+		defer segments.Close()
+		// В сегментах по умолчанию хранятся все тела: в памяти остаются ссылки.
+		// С --spill-threshold тела выгружаются только сверх порога.
+		if !offloadThresholdSet {
+			offloadThreshold = 1
+			if spillThreshold > 0 {
+				offloadThreshold = 0
+			}
+		}
+		qb.SetOffload(segments, broker.OffloadConfig{Threshold: offloadThreshold, SpillBytes: int64(spillThreshold)})
+	}
+	if spillThreshold > 0 && offloadStore == "" && segmentDir == "" {
+		fmt.Println("Error: --spill-threshold requires --segment-dir or --offload-store")
+		return
+	}
+	if routingRules != "" {
+		router, err := broker.LoadRouter(routingRules)
+		if err != nil {
+			fmt.Println("Error loading routing rules:", err)
+			return
+		}
+		qb.SetRouter(router)
+	}
+	if plugins != "" {
+		for _, name := range strings.Split(plugins, ",") {
+			var p broker.Plugin
+			var err error
+			if strings.HasSuffix(name, ".so") {
+				p, err = broker.LoadPlugin(name)
+			} else {
+				p, err = broker.NewRegisteredPlugin(name)
+			}
+			if err != nil {
+				fmt.Println("Error loading plugin:", err)
+				return
+			}
+			qb.RegisterPlugin(p)
+		}
+	}
+	if peers != "" {
+		federation := broker.NewFederation(region, strings.Split(peers, ","), time.Duration(federationDedupWindow)*time.Second)
+		federation.SetPeerSecret(peerSecret)
+		qb.SetFederation(federation)
+		defer federation.Close()
+	}
+	if follow != "" {
+		follower := broker.NewFollower(follow)
+		follower.SetPeerSecret(peerSecret)
+		qb.SetFollower(follower)
+		defer follower.Close()
+	}
+	var signingConfig *httpapi.SigningConfig
+	var oidcConfig *httpapi.OIDCConfig
+	var rateLimits *httpapi.RateLimitConfig
+	var serverConfig httpapi.ServerConfig
+	var corsConfig *httpapi.CORSConfig
+	var access *httpapi.AccessList
+	timeouts := timeoutConfig{Default: "10"}
+	if configFile != "" {
+		cfg, err := loadConfig(configFile)
+		if err != nil {
+			fmt.Println("Error loading config:", err)
+			return
+		}
+		for _, tenant := range cfg.Tenants {
+			if err := qb.AddTenant(tenant); err != nil {
+				fmt.Println("Error loading config:", err)
+				return
+			}
+		}
+		if cfg.Kafka != nil {
+			kafka := bridge.NewKafkaBridge(*cfg.Kafka, qb)
+			kafka.Start()
+			qb.RegisterHealthCheck("kafka", kafka.Health)
+			defer kafka.Close()
+		}
+		if cfg.Webhooks != nil {
+			webhooks := bridge.NewWebhookNotifier(*cfg.Webhooks, qb)
+			webhooks.Start()
+			qb.RegisterHealthCheck("webhooks", webhooks.Health)
+			defer webhooks.Close()
+		}
+		signingConfig = cfg.Signing
+		if cfg.OIDC != nil && len(cfg.Tenants) > 0 {
+			fmt.Println("Error loading config: oidc cannot be combined with tenants")
+			return
+		}
+		oidcConfig = cfg.OIDC
+		rateLimits = cfg.RateLimits
+		corsConfig = cfg.CORS
+		if cfg.Access != nil {
+			if access, err = httpapi.NewAccessList(*cfg.Access); err != nil {
+				fmt.Println("Error loading config: access:", err)
+				return
+			}
+		}
+		if cfg.Server != nil {
+			serverConfig = *cfg.Server
+		}
+		if cfg.Timeouts != nil {
+			timeouts = mergeTimeouts(timeouts, *cfg.Timeouts)
+		}
+	}
+	timeouts = mergeTimeouts(timeouts, timeoutFlags)
+	if err := applyTimeouts(qb, timeouts); err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	if serverFlags.ReadHeaderTimeout > 0 {
+		serverConfig.ReadHeaderTimeout = serverFlags.ReadHeaderTimeout
+	}
+	if serverFlags.IdleTimeout > 0 {
+		serverConfig.IdleTimeout = serverFlags.IdleTimeout
+	}
+	if serverFlags.MaxHeaderBytes > 0 {
+		serverConfig.MaxHeaderBytes = serverFlags.MaxHeaderBytes
+	}
+	if serverFlags.MaxConcurrentStreams > 0 {
+		serverConfig.MaxConcurrentStreams = serverFlags.MaxConcurrentStreams
+	}
+	if enabled, err := strconv.ParseBool(h2c); err == nil {
+		serverConfig.DisableH2C = !enabled
+	}
+	// Очереди узла кластера Raft восстанавливаются только из его журнала
+	if raftSelf != "" && (raftPeers == "" || raftDir == "") {
+		fmt.Println("Error: --raft-self requires --raft-peers and --raft-dir")
+		return
+	}
+	if raftSelf != "" && (follow != "" || clusterNodes != "" || walPath != "" || seedDir != "" || restoreFrom != "" || peerListen != "") {
+		fmt.Println("Error: --raft-self cannot be used with --follow, --cluster-nodes, --wal, --seed-dir, --restore-from or --peer-listen")
+		return
+	}
+	if restoreFrom != "" {
+		data, err := objstore.ReadObject(context.Background(), restoreFrom)
+		if err != nil {
+			fmt.Println("Error restoring snapshot:", err)
+			return
+		}
+		snap, err := broker.DecodeSnapshot(data)
+		if err == nil {
+			err = qb.Restore(snap)
+		}
+		if err != nil {
+			fmt.Println("Error restoring snapshot:", err)
+			return
+		}
+		fmt.Printf("Restored %d queues from %s\n", len(snap.Queues), restoreFrom)
+	}
+	if walPath != "" {
+		wal, err := qb.OpenWAL(walPath, broker.WALOptions{Sync: walSync, Interval: time.Duration(walSyncInterval) * time.Millisecond})
+		if err != nil {
+			fmt.Println("Error opening write-ahead log:", err)
+			return
+		}
+		defer func() {
+			if err := wal.Close(); err != nil {
+				fmt.Println("Error closing write-ahead log:", err)
+			}
+		}()
+		fmt.Printf("Restored %d queues from %s\n", len(qb.Queues()), walPath)
+	}
+	if segments != nil {
+		// Тела, на которые не ссылается ни одно восстановленное сообщение
+		segments.Sweep()
+	}
+	qb.Spill()
+	if seedDir != "" {
+		count, err := qb.Seed(seedDir)
+		if err != nil {
+			fmt.Println("Error seeding queues:", err)
+			return
+		}
+		fmt.Printf("Seeded %d messages from %s\n", count, seedDir)
+	}
+	var consensus *broker.Consensus
+	if raftSelf != "" {
+		var err error
+		consensus, err = qb.StartConsensus(raft.Config{
+			ID:        strings.TrimRight(raftSelf, "/"),
+			Peers:     strings.Split(raftPeers, ","),
+			Dir:       raftDir,
+			Transport: raft.NewHTTPTransport(peerSecret),
+		})
+		if err != nil {
+			fmt.Println("Error starting raft node:", err)
+			return
+		}
+		defer consensus.Close()
+	}
+	if mqttPort > 0 {
+		mqttServer := mqtt.NewServer(qb)
+		go func() {
+			ln, err := listen(fmt.Sprintf(":%d", mqttPort), access)
+			if err == nil {
+				err = mqttServer.Serve(ln)
+			}
+			if err != nil {
+				fmt.Println("Error starting MQTT listener:", err)
+			}
+		}()
+		defer mqttServer.Close()
+	}
+	if natsPort > 0 {
+		natsServer := nats.NewServer(qb)
+		go func() {
+			ln, err := listen(fmt.Sprintf(":%d", natsPort), access)
+			if err == nil {
+				err = natsServer.Serve(ln)
+			}
+			if err != nil {
+				fmt.Println("Error starting NATS listener:", err)
+			}
+		}()
+		defer natsServer.Close()
+	}
+	if sqsPort > 0 {
+		go func() {
+			ln, err := listen(fmt.Sprintf(":%d", sqsPort), access)
+			if err == nil {
+				err = http.Serve(ln, sqs.NewServer(qb))
+			}
+			if err != nil {
+				fmt.Println("Error starting SQS listener:", err)
+			}
+		}()
+	}
+	// HTTP API слушает --listen, а если он не задан — --port на всех интерфейсах
+	httpAddr := fmt.Sprintf(":%d", port)
+	if listenAddr != "" {
+		httpAddr = listenAddr
+	}
+	var canary *httpapi.Canary
+	if canaryInterval > 0 {
+		canary = httpapi.NewCanary(canaryURL(httpAddr, port), time.Duration(canaryInterval)*time.Second)
+		canary.Start()
+		defer canary.Stop()
+	}
+
+	opts := []httpapi.Option{httpapi.WithMaxMessageSize(int64(maxMessageSize)), httpapi.WithCompression(compressMinSize), httpapi.WithKeySource(keys), httpapi.WithAuditLog(auditor), httpapi.WithPeerSecret(peerSecret)}
+	// STOMP поверх WebSocket доступен на /stomp всегда, по TCP — при заданном порте
+	stompServer := stomp.NewServer(qb)
+	defer stompServer.Close()
+	opts = append(opts, httpapi.WithHandler("/stomp", stompServer.WebSocketHandler()))
+	if stompPort > 0 {
+		go func() {
+			ln, err := listen(fmt.Sprintf(":%d", stompPort), access)
+			if err == nil {
+				err = stompServer.Serve(ln)
+			}
+			if err != nil {
+				fmt.Println("Error starting STOMP listener:", err)
+			}
+		}()
+	}
+	if shedHeapMB > 0 || shedGCPauseMs > 0 || shedGoroutines > 0 {
+		shedder := httpapi.NewLoadShedder(httpapi.ShedThresholds{
+			HeapBytes:  uint64(shedHeapMB) << 20,
+			GCPause:    time.Duration(shedGCPauseMs) * time.Millisecond,
+			Goroutines: shedGoroutines,
+		}, time.Second)
+		shedder.Start()
+		defer shedder.Stop()
+		opts = append(opts, httpapi.WithLoadShedder(shedder))
+	}
+	if usageDir != "" {
+		usage := httpapi.NewUsageMeter(usageDir)
+		usage.Start()
+		defer usage.Stop()
+		opts = append(opts, httpapi.WithUsageMeter(usage))
+	}
+	if restStatusCodes {
+		opts = append(opts, httpapi.WithRESTStatusCodes())
+	}
+	if maxConcurrent > 0 {
+		opts = append(opts, httpapi.WithConcurrencyLimiter(httpapi.NewConcurrencyLimiter(maxConcurrent, maxWaiting, time.Second)))
+	}
+	if signingConfig != nil {
+		opts = append(opts, httpapi.WithRequestVerifier(httpapi.NewRequestVerifier(*signingConfig)))
+	}
+	if oidcConfig != nil {
+		opts = append(opts, httpapi.WithTokenValidator(httpapi.NewTokenValidator(*oidcConfig)))
+	}
+	if snapshotStore != "" {
+		store, err := objstore.Open(snapshotStore)
+		if err != nil {
+			fmt.Println("Error opening snapshot store:", err)
+			return
+		}
+		opts = append(opts, httpapi.WithSnapshots(store))
+	}
+	if corsConfig != nil {
+		opts = append(opts, httpapi.WithCORS(httpapi.NewCORS(*corsConfig)))
+	}
+	if rateLimits != nil {
+		opts = append(opts, httpapi.WithRateLimiter(httpapi.NewRateLimiter(*rateLimits)))
+	}
+	if clusterNodes != "" {
+		partitioner := cluster.NewPartitioner(qb, clusterSelf, strings.Split(clusterNodes, ","), 10*time.Second)
+		partitioner.SetPeerSecret(peerSecret)
+		partitioner.Start()
+		qb.RegisterHealthCheck("cluster", partitioner.Health)
+		defer partitioner.Close()
+		opts = append(opts, httpapi.WithPartitioner(partitioner))
+	}
+	if consensus != nil {
+		opts = append(opts, httpapi.WithConsensus(consensus))
+	}
+	if access != nil {
+		opts = append(opts, httpapi.WithAccessList(access))
+	}
+
+	handler := httpapi.NewHandler(qb, canary, opts...)
+	// Административная часть API, метрики и запросы брокеров, вынесенные на
+	// отдельные адреса, не обслуживаются основным. Узлы кластера пересылают
+	// друг другу и запросы клиентов, и перенос сообщений по одному адресу.
+	if peerListen != "" && clusterNodes != "" {
+		fmt.Println("Error: --peer-listen cannot be used with --cluster-nodes")
+		return
+	}
+	surfaces := []httpapi.Surface{httpapi.SurfaceData, httpapi.SurfaceAdmin, httpapi.SurfaceMetrics, httpapi.SurfacePeer}
+	for _, extra := range []struct {
+		addr    string
+		surface httpapi.Surface
+	}{{adminListen, httpapi.SurfaceAdmin}, {metricsListen, httpapi.SurfaceMetrics}, {peerListen, httpapi.SurfacePeer}} {
+		if extra.addr == "" {
+			continue
+		}
+		surfaces = slices.DeleteFunc(surfaces, func(s httpapi.Surface) bool { return s == extra.surface })
+		ln, err := listen(extra.addr, access)
+		if err != nil {
+			fmt.Printf("Error starting %s listener: %v\n", extra.surface, err)
+			return
+		}
+		fmt.Printf("Serving %s API on %s...\n", extra.surface, extra.addr)
+		go func() {
+			if err := httpapi.NewServer(extra.addr, httpapi.Restrict(handler, extra.surface), serverConfig).Serve(ln); err != nil {
+				fmt.Printf("Error starting %s listener: %v\n", extra.surface, err)
+			}
+		}()
+	}
+
+	fmt.Printf("Starting server on %s...\n", httpAddr)
+	server := httpapi.NewServer(httpAddr, httpapi.Restrict(handler, surfaces...), serverConfig)
+	ln, err := listen(httpAddr, access)
+	if err == nil {
+		err = server.Serve(ln)
+	}
+	if err != nil {
+		fmt.Println("Error starting server:", err)
+	}
+}
@@ -0,0 +1,7 @@
+package main
+
+// Плагины, встраиваемые в исполняемый файл при сборке: пакет плагина
+// регистрирует себя через broker.Register в init() и подключается здесь
+// пустым импортом, а включается флагом --plugins <name>, например:
+//
+//	import _ "example.com/acme/broker-metrics"
@@ -1,3 +1,3 @@
 module queue-broker
 
-go 1.23.3
+go 1.24
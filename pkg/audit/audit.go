@@ -0,0 +1,140 @@
+// Package audit ведет журнал аудита брокера: кто, что, когда и откуда
+// сделал с очередями. Записи передаются в приемники (файл, syslog, HTTP)
+// и не изменяются после записи.
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Действия журнала аудита
+const (
+	QueueCreate    = "queue.create"
+	QueueDelete    = "queue.delete"
+	QueueConfig    = "queue.config"
+	QueueSchema    = "queue.schema"
+	QueueACL       = "queue.acl"
+	QueueOwner     = "queue.owner"
+	QueuePurge     = "queue.purge"
+	QueuePause     = "queue.pause"
+	QueueResume    = "queue.resume"
+	QueueArchive   = "queue.archive"
+	MessageDelete  = "message.delete"
+	MessageRequeue = "message.requeue"
+	SnapshotCreate = "snapshot.create"
+	KeysRotate     = "keys.rotate"
+	ScheduleSet    = "schedule.set"
+	ScheduleDelete = "schedule.delete"
+
+	// Операции с данными записываются, только если журнал создан с data
+	MessageProduce = "message.produce"
+	MessageConsume = "message.consume"
+	MessageBrowse  = "message.browse"
+	MessageSettle  = "message.settle"
+)
+
+// Event запись журнала аудита
+type Event struct {
+	Time time.Time `json:"time"`
+	// Actor субъект запроса: идентификатор ключа подписи или арендатор;
+	// пусто — неаутентифицированный запрос или сам брокер
+	Actor string `json:"actor,omitempty"`
+	// Remote адрес клиента
+	Remote string `json:"remote,omitempty"`
+	Action string `json:"action"`
+	Queue  string `json:"queue,omitempty"`
+	// Request метод и путь HTTP-запроса
+	Request string `json:"request,omitempty"`
+	// Status код ответа (0 — событие не связано с запросом)
+	Status int `json:"status,omitempty"`
+}
+
+// Sink приемник записей журнала
+type Sink interface {
+	Write(e Event) error
+	Close() error
+}
+
+// Logger журнал аудита. Nil-журнал ничего не записывает.
+type Logger struct {
+	sinks []Sink
+	data  bool
+
+	mu sync.Mutex
+	// failures число записей, не принятых приемниками
+	failures int
+}
+
+// New создает журнал; data — записывать также постановку и получение сообщений
+func New(data bool, sinks ...Sink) *Logger {
+	return &Logger{sinks: sinks, data: data}
+}
+
+// Data сообщает, записываются ли операции с данными
+func (l *Logger) Data() bool {
+	return l != nil && l.data
+}
+
+// Log передает запись всем приемникам; время проставляется, если не задано.
+// Ошибки приемников выводятся в лог и учитываются в Failures.
+func (l *Logger) Log(e Event) {
+	if l == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	for _, sink := range l.sinks {
+		if err := sink.Write(e); err != nil {
+			l.mu.Lock()
+			l.failures++
+			l.mu.Unlock()
+			log.Printf("audit: %v", err)
+		}
+	}
+}
+
+// Failures возвращает число записей, не принятых приемниками
+func (l *Logger) Failures() int {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.failures
+}
+
+// Close закрывает приемники, дописав накопленные записи
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	var errs []error
+	for _, sink := range l.sinks {
+		errs = append(errs, sink.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// Open создает приемник по описанию: file:<путь>, syslog: (локальный syslog),
+// syslog://host:port (UDP), syslog+tcp://host:port или http(s)://адрес
+func Open(spec string) (Sink, error) {
+	switch {
+	case strings.HasPrefix(spec, "file:"):
+		return OpenFile(strings.TrimPrefix(spec, "file:"))
+	case spec == "syslog:":
+		return DialSyslog("", "")
+	case strings.HasPrefix(spec, "syslog://"):
+		return DialSyslog("udp", strings.TrimPrefix(spec, "syslog://"))
+	case strings.HasPrefix(spec, "syslog+tcp://"):
+		return DialSyslog("tcp", strings.TrimPrefix(spec, "syslog+tcp://"))
+	case strings.HasPrefix(spec, "http://"), strings.HasPrefix(spec, "https://"):
+		return NewHTTPSink(spec), nil
+	}
+	return nil, fmt.Errorf("unknown audit sink %q", spec)
+}
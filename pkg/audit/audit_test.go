@@ -0,0 +1,94 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestFileSink проверяет дозапись в файл, в том числе после повторного открытия
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	for _, action := range []string{QueuePurge, QueueConfig} {
+		sink, err := OpenFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		logger := New(false, sink)
+		logger.Log(Event{Actor: "ops", Action: action, Queue: "jobs"})
+		if err := logger.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var actions []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil || e.Time.IsZero() || e.Actor != "ops" {
+			t.Fatalf("invalid record %q: %v", scanner.Text(), err)
+		}
+		actions = append(actions, e.Action)
+	}
+	if len(actions) != 2 || actions[0] != QueuePurge || actions[1] != QueueConfig {
+		t.Errorf("unexpected records %v", actions)
+	}
+}
+
+// TestHTTPSink проверяет отправку записей пачками и досылку при закрытии
+func TestHTTPSink(t *testing.T) {
+	var mu sync.Mutex
+	var received []Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dec := json.NewDecoder(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		for dec.More() {
+			var e Event
+			if err := dec.Decode(&e); err != nil {
+				t.Error(err)
+				return
+			}
+			received = append(received, e)
+		}
+	}))
+	defer server.Close()
+
+	sink, err := Open(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := New(true, sink)
+	for i := 0; i < 250; i++ {
+		logger.Log(Event{Action: MessageProduce, Queue: "jobs", Time: time.Unix(int64(i), 0)})
+	}
+	logger.Close()
+	if len(received) != 250 || received[249].Time.Unix() != 249 {
+		t.Errorf("expected 250 records in order, got %d", len(received))
+	}
+}
+
+// TestOpen проверяет отказ на неверных адресах журнала и пустой журнал nil
+func TestOpen(t *testing.T) {
+	for _, spec := range []string{"", "kafka://events", "/var/log/audit.log"} {
+		if _, err := Open(spec); err == nil {
+			t.Errorf("%q: expected error", spec)
+		}
+	}
+	var logger *Logger
+	logger.Log(Event{Action: QueuePurge})
+	if logger.Data() || logger.Failures() != 0 || logger.Close() != nil {
+		t.Error("nil logger must be a no-op")
+	}
+}
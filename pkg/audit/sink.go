@@ -0,0 +1,164 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"log/syslog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// FileSink дописывает записи в файл по одной JSON-строке
+type FileSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// OpenFile открывает файл журнала на дозапись, создавая его при необходимости
+func OpenFile(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{file: file}, nil
+}
+
+// Write дописывает запись в конец файла
+func (s *FileSink) Write(e Event) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.file.Write(append(line, '\n'))
+	return err
+}
+
+// Close сбрасывает файл на диск и закрывает его
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.file.Sync(); err != nil {
+		s.file.Close()
+		return err
+	}
+	return s.file.Close()
+}
+
+// SyslogSink передает записи в syslog (facility AUTH, уровень INFO) в виде JSON
+type SyslogSink struct {
+	w *syslog.Writer
+}
+
+// DialSyslog подключается к syslog; пустые network и addr — локальный syslog
+func DialSyslog(network, addr string) (*SyslogSink, error) {
+	w, err := syslog.Dial(network, addr, syslog.LOG_AUTH|syslog.LOG_INFO, "queue-broker")
+	if err != nil {
+		return nil, err
+	}
+	return &SyslogSink{w: w}, nil
+}
+
+// Write передает запись в syslog
+func (s *SyslogSink) Write(e Event) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return s.w.Info(string(line))
+}
+
+// Close закрывает соединение с syslog
+func (s *SyslogSink) Close() error {
+	return s.w.Close()
+}
+
+// httpBatchSize сколько записей HTTPSink отправляет одним запросом
+const httpBatchSize = 100
+
+// HTTPSink отправляет записи POST-запросами (JSON по строке на запись) пачками
+// в фоне. Когда буфер заполнен, Write ждет отправки, а не теряет записи.
+// Пачка, которую не удалось отправить после повторов, теряется с ошибкой в логе.
+type HTTPSink struct {
+	url    string
+	client *http.Client
+	events chan Event
+	done   chan struct{}
+}
+
+// NewHTTPSink создает приемник и запускает отправку
+func NewHTTPSink(url string) *HTTPSink {
+	s := &HTTPSink{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+		events: make(chan Event, 10000),
+		done:   make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Write ставит запись в очередь на отправку
+func (s *HTTPSink) Write(e Event) error {
+	s.events <- e
+	return nil
+}
+
+// Close отправляет оставшиеся записи и останавливает приемник
+func (s *HTTPSink) Close() error {
+	close(s.events)
+	<-s.done
+	return nil
+}
+
+func (s *HTTPSink) run() {
+	defer close(s.done)
+	batch := make([]Event, 0, httpBatchSize)
+	for e := range s.events {
+		batch = append(batch[:0], e)
+		// Забираем уже накопленные записи, не дожидаясь новых
+	collect:
+		for len(batch) < httpBatchSize {
+			select {
+			case e, ok := <-s.events:
+				if !ok {
+					break collect
+				}
+				batch = append(batch, e)
+			default:
+				break collect
+			}
+		}
+		s.send(batch)
+	}
+}
+
+// send отправляет пачку, повторяя до трех раз
+func (s *HTTPSink) send(batch []Event) {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, e := range batch {
+		enc.Encode(e)
+	}
+	var err error
+	for attempt := 0; attempt < 3; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+		var resp *http.Response
+		resp, err = s.client.Post(s.url, "application/x-ndjson", bytes.NewReader(body.Bytes()))
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode/100 == 2 {
+				return
+			}
+			err = fmt.Errorf("unexpected status %s", resp.Status)
+		}
+	}
+	log.Printf("audit: %d events to %s lost: %v", len(batch), s.url, err)
+}
@@ -0,0 +1,429 @@
+// Package bridge связывает очереди брокера с внешними системами сообщений
+// и уведомлений.
+package bridge
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"queue-broker/pkg/broker"
+)
+
+const (
+	kafkaContentType = "application/vnd.kafka.json.v2+json"
+	kafkaAccept      = "application/vnd.kafka.v2+json"
+	// kafkaBufferSize сколько сообщений копится для недоступного Kafka
+	kafkaBufferSize = 10000
+	// kafkaBatchSize максимальное число записей в одном запросе
+	kafkaBatchSize = 100
+	// kafkaMaxBackoff максимальная пауза между повторами
+	kafkaMaxBackoff = 30 * time.Second
+	// topicHeader заголовок, которым помечаются сообщения, пришедшие из Kafka
+	topicHeader = "kafka-topic"
+)
+
+// KafkaConfig настройки моста с Kafka. Мост работает через Confluent REST Proxy
+// (API v2), поэтому брокеру не нужен нативный клиент Kafka.
+type KafkaConfig struct {
+	RESTProxyURL string        `json:"rest_proxy_url"`
+	Sinks        []KafkaSink   `json:"sinks"`
+	Sources      []KafkaSource `json:"sources"`
+	// PollInterval пауза между опросами пустого топика в миллисекундах
+	PollInterval int `json:"poll_interval_ms"`
+}
+
+// KafkaSink зеркалирование очереди в топик: каждое принятое сообщение
+// копируется в Kafka, сама очередь при этом не потребляется
+type KafkaSink struct {
+	Queue string `json:"queue"`
+	Topic string `json:"topic"`
+}
+
+// KafkaSource перенос сообщений топика в очередь брокера. Смещение фиксируется
+// в Kafka только после успешной постановки в очередь.
+type KafkaSource struct {
+	Topic string `json:"topic"`
+	Queue string `json:"queue"`
+	Group string `json:"group"`
+}
+
+// kafkaMessage значение записи Kafka с сообщением брокера; тело, не
+// являющееся корректным UTF-8, передается в поле message_base64, как в HTTP API
+type kafkaMessage struct {
+	*broker.Message
+	Body   string `json:"message"`
+	Base64 string `json:"message_base64,omitempty"`
+}
+
+// kafkaRecord запись Kafka в формате REST Proxy
+type kafkaRecord struct {
+	Key   string          `json:"key,omitempty"`
+	Value json.RawMessage `json:"value"`
+	Topic string          `json:"topic,omitempty"`
+}
+
+// KafkaBridge мост между очередями брокера и топиками Kafka
+type KafkaBridge struct {
+	cfg    KafkaConfig
+	qb     *broker.QueueBroker
+	client *http.Client
+	done   chan struct{}
+	wg     sync.WaitGroup
+
+	sinks map[string][]*kafkaSinkWorker
+
+	mu        sync.Mutex
+	lastError error
+	// lastFailure последняя ошибка, не сбрасываемая после успешного обмена
+	lastFailure   error
+	lastFailureAt time.Time
+}
+
+// kafkaSinkWorker очередь исходящих записей одного топика
+type kafkaSinkWorker struct {
+	topic  string
+	outbox chan *broker.Message
+}
+
+// NewKafkaBridge создает мост; Start запускает его
+func NewKafkaBridge(cfg KafkaConfig, qb *broker.QueueBroker) *KafkaBridge {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 1000
+	}
+	cfg.RESTProxyURL = strings.TrimRight(cfg.RESTProxyURL, "/")
+	return &KafkaBridge{
+		cfg:    cfg,
+		qb:     qb,
+		client: &http.Client{Timeout: 30 * time.Second},
+		done:   make(chan struct{}),
+		sinks:  make(map[string][]*kafkaSinkWorker),
+	}
+}
+
+// Start подписывается на очереди-источники зеркалирования и запускает
+// чтение топиков
+func (kb *KafkaBridge) Start() {
+	for _, sink := range kb.cfg.Sinks {
+		worker := &kafkaSinkWorker{topic: sink.Topic, outbox: make(chan *broker.Message, kafkaBufferSize)}
+		kb.sinks[sink.Queue] = append(kb.sinks[sink.Queue], worker)
+		kb.wg.Add(1)
+		go kb.runSink(worker)
+	}
+	if len(kb.sinks) > 0 {
+		kb.qb.AddEnqueueListener(kb.mirror)
+	}
+	for _, source := range kb.cfg.Sources {
+		kb.wg.Add(1)
+		go kb.runSource(source)
+	}
+}
+
+// Close останавливает мост и ждет завершения фоновых задач
+func (kb *KafkaBridge) Close() {
+	close(kb.done)
+	kb.wg.Wait()
+}
+
+// LastError возвращает последнюю ошибку обмена с Kafka (nil, если обмен успешен)
+func (kb *KafkaBridge) LastError() error {
+	kb.mu.Lock()
+	defer kb.mu.Unlock()
+	return kb.lastError
+}
+
+func (kb *KafkaBridge) setError(err error) {
+	kb.mu.Lock()
+	kb.lastError = err
+	if err != nil {
+		kb.lastFailure, kb.lastFailureAt = err, time.Now()
+	}
+	kb.mu.Unlock()
+	if err != nil {
+		log.Printf("kafka bridge: %v", err)
+	}
+}
+
+// Health сообщает состояние моста для /healthz: он деградирован, пока
+// последний обмен с Kafka завершился ошибкой
+func (kb *KafkaBridge) Health() broker.SubsystemHealth {
+	backlog := make(map[string]int)
+	for _, workers := range kb.sinks {
+		for _, worker := range workers {
+			backlog[worker.topic] = len(worker.outbox)
+		}
+	}
+	kb.mu.Lock()
+	defer kb.mu.Unlock()
+	return subsystemHealth(kb.lastError, kb.lastFailure, kb.lastFailureAt, map[string]any{"sink_backlog": backlog})
+}
+
+// subsystemHealth состояние фоновой задачи по ее последним ошибкам
+func subsystemHealth(lastError, lastFailure error, lastFailureAt time.Time, detail any) broker.SubsystemHealth {
+	h := broker.SubsystemHealth{Status: broker.HealthOK, Detail: detail}
+	if lastError != nil {
+		h.Status = broker.HealthDegraded
+	}
+	if lastFailure != nil {
+		h.LastError = lastFailure.Error()
+		h.LastErrorAt = &lastFailureAt
+	}
+	return h
+}
+
+// mirror ставит сообщение в очередь отправки в топики, связанные с очередью.
+// Сообщения, пришедшие из того же топика, обратно не отправляются.
+func (kb *KafkaBridge) mirror(queueName string, msg *broker.Message) {
+	for _, worker := range kb.sinks[queueName] {
+		if msg.Headers[topicHeader] == worker.topic {
+			continue
+		}
+		select {
+		case worker.outbox <- msg:
+		default:
+			kb.setError(fmt.Errorf("sink %s: buffer full, message dropped", worker.topic))
+		}
+	}
+}
+
+func (kb *KafkaBridge) runSink(worker *kafkaSinkWorker) {
+	defer kb.wg.Done()
+	backoff := 100 * time.Millisecond
+	for {
+		var batch []*broker.Message
+		select {
+		case msg := <-worker.outbox:
+			batch = append(batch, msg)
+		case <-kb.done:
+			return
+		}
+	fill:
+		for len(batch) < kafkaBatchSize {
+			select {
+			case msg := <-worker.outbox:
+				batch = append(batch, msg)
+			default:
+				break fill
+			}
+		}
+
+		for {
+			err := kb.produce(worker.topic, batch)
+			kb.setError(err)
+			if err == nil {
+				backoff = 100 * time.Millisecond
+				break
+			}
+			if !kb.sleep(backoff) {
+				return
+			}
+			if backoff *= 2; backoff > kafkaMaxBackoff {
+				backoff = kafkaMaxBackoff
+			}
+		}
+	}
+}
+
+// produce отправляет записи в топик через POST /topics/{topic}
+func (kb *KafkaBridge) produce(topic string, batch []*broker.Message) error {
+	records := make([]kafkaRecord, len(batch))
+	for i, msg := range batch {
+		v := kafkaMessage{Message: msg}
+		if utf8.ValidString(msg.Body) {
+			v.Body = msg.Body
+		} else {
+			v.Base64 = base64.StdEncoding.EncodeToString([]byte(msg.Body))
+		}
+		value, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		records[i] = kafkaRecord{Key: msg.DedupID, Value: value}
+	}
+	body, _ := json.Marshal(map[string]any{"records": records})
+	if _, err := kb.request(http.MethodPost, kb.cfg.RESTProxyURL+"/topics/"+topic, body); err != nil {
+		return fmt.Errorf("produce to %s: %w", topic, err)
+	}
+	return nil
+}
+
+func (kb *KafkaBridge) runSource(source KafkaSource) {
+	defer kb.wg.Done()
+	backoff := 100 * time.Millisecond
+	for {
+		baseURI, err := kb.subscribe(source)
+		if err == nil {
+			err = kb.consume(source, baseURI)
+			// Экземпляр потребителя удаляется, чтобы группа сразу перебалансировалась
+			kb.request(http.MethodDelete, baseURI, nil)
+		}
+		if err == nil {
+			return
+		}
+		kb.setError(fmt.Errorf("source %s: %w", source.Topic, err))
+		if !kb.sleep(backoff) {
+			return
+		}
+		if backoff *= 2; backoff > kafkaMaxBackoff {
+			backoff = kafkaMaxBackoff
+		}
+	}
+}
+
+// subscribe создает экземпляр потребителя в группе и подписывает его на топик
+func (kb *KafkaBridge) subscribe(source KafkaSource) (string, error) {
+	group := source.Group
+	if group == "" {
+		group = "queue-broker-" + source.Queue
+	}
+	body, _ := json.Marshal(map[string]string{
+		"format":             "json",
+		"auto.offset.reset":  "earliest",
+		"auto.commit.enable": "false",
+	})
+	resp, err := kb.request(http.MethodPost, kb.cfg.RESTProxyURL+"/consumers/"+group, body)
+	if err != nil {
+		return "", fmt.Errorf("create consumer: %w", err)
+	}
+	var instance struct {
+		BaseURI string `json:"base_uri"`
+	}
+	if err := json.Unmarshal(resp, &instance); err != nil || instance.BaseURI == "" {
+		return "", fmt.Errorf("create consumer: invalid response %q", resp)
+	}
+
+	body, _ = json.Marshal(map[string][]string{"topics": {source.Topic}})
+	if _, err := kb.request(http.MethodPost, instance.BaseURI+"/subscription", body); err != nil {
+		kb.request(http.MethodDelete, instance.BaseURI, nil)
+		return "", fmt.Errorf("subscribe: %w", err)
+	}
+	return instance.BaseURI, nil
+}
+
+// consume читает записи и ставит их в очередь; возвращает nil при остановке моста
+func (kb *KafkaBridge) consume(source KafkaSource, baseURI string) error {
+	for {
+		select {
+		case <-kb.done:
+			return nil
+		default:
+		}
+
+		resp, err := kb.request(http.MethodGet, baseURI+"/records", nil)
+		if err != nil {
+			return fmt.Errorf("poll: %w", err)
+		}
+		var records []kafkaRecord
+		if err := json.Unmarshal(resp, &records); err != nil {
+			return fmt.Errorf("poll: %w", err)
+		}
+		kb.setError(nil)
+		if len(records) == 0 {
+			if !kb.sleep(time.Duration(kb.cfg.PollInterval) * time.Millisecond) {
+				return nil
+			}
+			continue
+		}
+
+		for _, record := range records {
+			msg := recordMessage(source.Topic, record)
+			for {
+				err := kb.qb.Enqueue(source.Queue, msg)
+				if err == nil || errors.Is(err, broker.ErrDuplicate) {
+					break
+				}
+				// Очередь заполнена: смещение не фиксируется, пока запись не принята
+				kb.setError(fmt.Errorf("source %s: enqueue to %s: %w", source.Topic, source.Queue, err))
+				if !kb.sleep(time.Second) {
+					return nil
+				}
+			}
+		}
+
+		// Пустое тело фиксирует смещения всех полученных записей
+		if _, err := kb.request(http.MethodPost, baseURI+"/offsets", []byte("{}")); err != nil {
+			return fmt.Errorf("commit offsets: %w", err)
+		}
+	}
+}
+
+// recordMessage превращает запись Kafka в сообщение: объект с полем message
+// или message_base64 разбирается как сообщение брокера, строка становится
+// телом, остальные значения передаются как JSON-текст
+func recordMessage(topic string, record kafkaRecord) *broker.Message {
+	msg := &broker.Message{}
+	v := kafkaMessage{Message: msg}
+	var str string
+	err := json.Unmarshal(record.Value, &v)
+	msg.Body = v.Body
+	if err == nil && v.Base64 != "" {
+		var body []byte
+		body, err = base64.StdEncoding.DecodeString(v.Base64)
+		msg.Body = string(body)
+	}
+	if err != nil || msg.Body == "" {
+		msg = &broker.Message{}
+		if err := json.Unmarshal(record.Value, &str); err == nil {
+			msg.Body = str
+		} else {
+			msg.Body = string(record.Value)
+		}
+	}
+	if msg.Headers == nil {
+		msg.Headers = make(map[string]string)
+	}
+	msg.Headers[topicHeader] = topic
+	if msg.DedupID == "" {
+		msg.DedupID = record.Key
+	}
+	msg.Queue = ""
+	return msg
+}
+
+func (kb *KafkaBridge) request(method, url string, body []byte) ([]byte, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", kafkaContentType)
+	}
+	req.Header.Set("Accept", kafkaAccept+", "+kafkaContentType)
+
+	resp, err := kb.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
+
+// sleep ждет d; возвращает false, если мост остановлен
+func (kb *KafkaBridge) sleep(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-kb.done:
+		return false
+	}
+}
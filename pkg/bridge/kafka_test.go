@@ -0,0 +1,223 @@
+package bridge
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"queue-broker/pkg/broker"
+)
+
+// fakeRESTProxy минимальная имитация Confluent REST Proxy: один топик-источник
+// с заданными записями и журнал принятых записей по топикам
+type fakeRESTProxy struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	pending   []kafkaRecord
+	produced  map[string][]kafkaRecord
+	commits   int
+	deleted   bool
+	subscribe []string
+}
+
+func newFakeRESTProxy(records ...kafkaRecord) *fakeRESTProxy {
+	fp := &fakeRESTProxy{pending: records, produced: make(map[string][]kafkaRecord)}
+	fp.Server = httptest.NewServer(http.HandlerFunc(fp.handle))
+	return fp
+}
+
+func (fp *fakeRESTProxy) handle(w http.ResponseWriter, r *http.Request) {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	body, _ := io.ReadAll(r.Body)
+	path := r.URL.Path
+
+	switch {
+	case r.Method == http.MethodPost && strings.HasPrefix(path, "/topics/"):
+		var req struct {
+			Records []kafkaRecord `json:"records"`
+		}
+		json.Unmarshal(body, &req)
+		topic := strings.TrimPrefix(path, "/topics/")
+		fp.produced[topic] = append(fp.produced[topic], req.Records...)
+		w.Write([]byte(`{"offsets":[]}`))
+	case r.Method == http.MethodPost && path == "/consumers/g1":
+		json.NewEncoder(w).Encode(map[string]string{"instance_id": "c1", "base_uri": fp.URL + "/consumers/g1/instances/c1"})
+	case r.Method == http.MethodPost && path == "/consumers/g1/instances/c1/subscription":
+		var req struct {
+			Topics []string `json:"topics"`
+		}
+		json.Unmarshal(body, &req)
+		fp.subscribe = req.Topics
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodGet && path == "/consumers/g1/instances/c1/records":
+		records := fp.pending
+		fp.pending = nil
+		if records == nil {
+			records = []kafkaRecord{}
+		}
+		json.NewEncoder(w).Encode(records)
+	case r.Method == http.MethodPost && path == "/consumers/g1/instances/c1/offsets":
+		fp.commits++
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodDelete && path == "/consumers/g1/instances/c1":
+		fp.deleted = true
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (fp *fakeRESTProxy) producedTo(topic string) []kafkaRecord {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	return append([]kafkaRecord(nil), fp.produced[topic]...)
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestKafkaSinkMirrorsQueue(t *testing.T) {
+	fp := newFakeRESTProxy()
+	defer fp.Close()
+
+	qb := broker.NewQueueBroker(10, 10, 1)
+	kb := NewKafkaBridge(KafkaConfig{
+		RESTProxyURL: fp.URL,
+		Sinks:        []KafkaSink{{Queue: "orders", Topic: "orders-topic"}},
+	}, qb)
+	kb.Start()
+	defer kb.Close()
+
+	if err := qb.Enqueue("orders", &broker.Message{Body: "one", DedupID: "k1"}); err != nil {
+		t.Fatal(err)
+	}
+	qb.PutMessage("other", "ignored")
+
+	waitFor(t, func() bool { return len(fp.producedTo("orders-topic")) == 1 })
+	record := fp.producedTo("orders-topic")[0]
+	if record.Key != "k1" {
+		t.Errorf("expected key k1, got %q", record.Key)
+	}
+	var msg broker.Message
+	if err := json.Unmarshal(record.Value, &msg); err != nil || msg.Body != "one" {
+		t.Errorf("unexpected record value %s", record.Value)
+	}
+
+	// Зеркалирование не потребляет очередь
+	if got, err := qb.GetMessage("orders", 0); err != nil || got != "one" {
+		t.Errorf("expected message to stay in queue, got %q, %v", got, err)
+	}
+	if len(fp.producedTo("other")) != 0 {
+		t.Error("unexpected records for unmapped queue")
+	}
+}
+
+func TestKafkaSourceConsumesTopic(t *testing.T) {
+	fp := newFakeRESTProxy(
+		kafkaRecord{Key: "a", Value: json.RawMessage(`"plain"`)},
+		kafkaRecord{Value: json.RawMessage(`{"message":"structured","headers":{"h":"v"}}`)},
+		kafkaRecord{Value: json.RawMessage(`{"id":1}`)},
+	)
+	defer fp.Close()
+
+	qb := broker.NewQueueBroker(10, 10, 1)
+	kb := NewKafkaBridge(KafkaConfig{
+		RESTProxyURL: fp.URL,
+		Sources:      []KafkaSource{{Topic: "events", Queue: "events", Group: "g1"}},
+		// Зеркало в тот же топик не должно отправлять записи обратно
+		Sinks:        []KafkaSink{{Queue: "events", Topic: "events"}},
+		PollInterval: 10,
+	}, qb)
+	kb.Start()
+
+	// Очередь создается первой записью из топика
+	waitFor(t, func() bool { return qb.Depth("events") > 0 })
+	var got []*broker.Message
+	for len(got) < 3 {
+		msg, err := qb.Dequeue("events", time.Second)
+		if err != nil {
+			t.Fatalf("expected message %d: %v", len(got)+1, err)
+		}
+		got = append(got, msg)
+	}
+	if got[0].Body != "plain" || got[0].DedupID != "a" {
+		t.Errorf("unexpected first message %+v", got[0])
+	}
+	if got[1].Body != "structured" || got[1].Headers["h"] != "v" {
+		t.Errorf("unexpected second message %+v", got[1])
+	}
+	if got[2].Body != `{"id":1}` {
+		t.Errorf("unexpected third message %+v", got[2])
+	}
+	if got[0].Headers[topicHeader] != "events" {
+		t.Errorf("expected %s header, got %v", topicHeader, got[0].Headers)
+	}
+
+	waitFor(t, func() bool {
+		fp.mu.Lock()
+		defer fp.mu.Unlock()
+		return fp.commits > 0
+	})
+	kb.Close()
+
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	if len(fp.subscribe) != 1 || fp.subscribe[0] != "events" {
+		t.Errorf("unexpected subscription %v", fp.subscribe)
+	}
+	if !fp.deleted {
+		t.Error("expected consumer instance to be deleted on close")
+	}
+	if len(fp.produced["events"]) != 0 {
+		t.Errorf("records from the topic must not be mirrored back, got %d", len(fp.produced["events"]))
+	}
+}
+
+// TestKafkaBinaryBody проверяет, что тело, не являющееся корректным UTF-8,
+// проходит через топик в обе стороны без искажений
+func TestKafkaBinaryBody(t *testing.T) {
+	body := "\xff\x00\xfe\x80"
+	sink := newFakeRESTProxy()
+	defer sink.Close()
+	qb := broker.NewQueueBroker(10, 10, 1)
+	kb := NewKafkaBridge(KafkaConfig{
+		RESTProxyURL: sink.URL,
+		Sinks:        []KafkaSink{{Queue: "orders", Topic: "orders-topic"}},
+	}, qb)
+	kb.Start()
+	defer kb.Close()
+	if err := qb.Enqueue("orders", &broker.Message{Body: body}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return len(sink.producedTo("orders-topic")) == 1 })
+
+	source := newFakeRESTProxy(sink.producedTo("orders-topic")[0])
+	defer source.Close()
+	restored := broker.NewQueueBroker(10, 10, 1)
+	consumer := NewKafkaBridge(KafkaConfig{
+		RESTProxyURL: source.URL,
+		Sources:      []KafkaSource{{Topic: "events", Queue: "events", Group: "g1"}},
+		PollInterval: 10,
+	}, restored)
+	consumer.Start()
+	defer consumer.Close()
+	waitFor(t, func() bool { return restored.Depth("events") > 0 })
+	if msg, err := restored.Dequeue("events", 0); err != nil || msg.Body != body {
+		t.Fatalf("binary body was not mirrored intact: %+v %v", msg, err)
+	}
+}
@@ -0,0 +1,279 @@
+package bridge
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"queue-broker/pkg/broker"
+)
+
+const (
+	// webhookBufferSize сколько уведомлений копится для недоступных получателей
+	webhookBufferSize = 1000
+	// webhookAttempts число попыток доставки уведомления одному получателю
+	webhookAttempts = 3
+)
+
+// События уведомлений
+const (
+	EventHighWatermark = "high_watermark"
+	EventLowWatermark  = "low_watermark"
+	EventMaxQueues     = "max_queues"
+	EventDeadLetter    = "dead_letter"
+	EventStuckQueue    = "stuck_queue"
+)
+
+// Watermarks пороги очереди: уведомление high_watermark отправляется,
+// когда глубина достигает High, low_watermark — когда после этого опускается
+// до Low или ниже. Нулевой High отключает уведомления. stuck_queue
+// отправляется, когда самое старое сообщение ждет дольше MaxAge секунд
+// (0 — не проверять).
+type Watermarks struct {
+	High   int `json:"high_watermark"`
+	Low    int `json:"low_watermark"`
+	MaxAge int `json:"max_age"`
+}
+
+// WebhookConfig настройки уведомлений о состоянии очередей
+type WebhookConfig struct {
+	// URLs адреса, на которые уведомления отправляются POST-запросом в JSON
+	URLs []string `json:"urls"`
+	// Watermarks пороги по умолчанию, Queues — для отдельных очередей
+	Watermarks
+	Queues map[string]Watermarks `json:"queues"`
+	// DeadLetterQueues шаблоны имен очередей недоставленных сообщений:
+	// о каждом сообщении в них отправляется dead_letter
+	DeadLetterQueues []string `json:"dead_letter_queues"`
+	// Interval период проверки глубины очередей и возраста сообщений в секундах (по умолчанию 1)
+	Interval int `json:"interval"`
+}
+
+// WebhookEvent уведомление, отправляемое получателям
+type WebhookEvent struct {
+	Event     string          `json:"event"`
+	Queue     string          `json:"queue,omitempty"`
+	Depth     int             `json:"depth"`
+	Threshold int             `json:"threshold"`
+	Age       float64         `json:"age_seconds,omitempty"`
+	Time      time.Time       `json:"time"`
+	Message   *broker.Message `json:"message,omitempty"`
+}
+
+// WebhookNotifier отправляет уведомления о превышении порогов глубины
+// очередей и возраста сообщений, достижении лимита очередей и попадании
+// сообщений в очереди недоставленных сообщений
+type WebhookNotifier struct {
+	cfg    WebhookConfig
+	qb     *broker.QueueBroker
+	client *http.Client
+	events chan WebhookEvent
+	done   chan struct{}
+	wg     sync.WaitGroup
+
+	// above очереди, глубина которых превысила верхний порог
+	above map[string]bool
+	// stuck очереди, самое старое сообщение которых ждет дольше MaxAge
+	stuck     map[string]bool
+	maxQueues bool
+
+	mu        sync.Mutex
+	lastError error
+	// lastFailure последняя ошибка, не сбрасываемая после успешного обмена
+	lastFailure   error
+	lastFailureAt time.Time
+}
+
+// NewWebhookNotifier создает уведомления; Start запускает их
+func NewWebhookNotifier(cfg WebhookConfig, qb *broker.QueueBroker) *WebhookNotifier {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 1
+	}
+	return &WebhookNotifier{
+		cfg:    cfg,
+		qb:     qb,
+		client: &http.Client{Timeout: 10 * time.Second},
+		events: make(chan WebhookEvent, webhookBufferSize),
+		done:   make(chan struct{}),
+		above:  make(map[string]bool),
+		stuck:  make(map[string]bool),
+	}
+}
+
+// Start запускает проверку очередей и отправку уведомлений
+func (wn *WebhookNotifier) Start() {
+	if len(wn.cfg.DeadLetterQueues) > 0 {
+		wn.qb.AddEnqueueListener(wn.deadLetter)
+	}
+	wn.wg.Add(2)
+	go wn.watch()
+	go wn.deliver()
+}
+
+// Close останавливает уведомления и ждет завершения фоновых задач
+func (wn *WebhookNotifier) Close() {
+	close(wn.done)
+	wn.wg.Wait()
+}
+
+// LastError возвращает последнюю ошибку доставки (nil, если доставка успешна)
+func (wn *WebhookNotifier) LastError() error {
+	wn.mu.Lock()
+	defer wn.mu.Unlock()
+	return wn.lastError
+}
+
+func (wn *WebhookNotifier) setError(err error) {
+	wn.mu.Lock()
+	wn.lastError = err
+	if err != nil {
+		wn.lastFailure, wn.lastFailureAt = err, time.Now()
+	}
+	wn.mu.Unlock()
+	if err != nil {
+		log.Printf("webhook: %v", err)
+	}
+}
+
+// Health сообщает состояние уведомлений для /healthz: они деградированы,
+// пока последняя доставка завершилась ошибкой
+func (wn *WebhookNotifier) Health() broker.SubsystemHealth {
+	wn.mu.Lock()
+	defer wn.mu.Unlock()
+	return subsystemHealth(wn.lastError, wn.lastFailure, wn.lastFailureAt, map[string]any{"backlog": len(wn.events)})
+}
+
+func (wn *WebhookNotifier) notify(event WebhookEvent) {
+	event.Time = time.Now()
+	select {
+	case wn.events <- event:
+	default:
+		wn.setError(fmt.Errorf("buffer full, %s event for %q dropped", event.Event, event.Queue))
+	}
+}
+
+// deadLetter уведомляет о сообщении, попавшем в очередь недоставленных сообщений
+func (wn *WebhookNotifier) deadLetter(queueName string, msg *broker.Message) {
+	for _, pattern := range wn.cfg.DeadLetterQueues {
+		if broker.MatchPattern(pattern, queueName) {
+			wn.notify(WebhookEvent{Event: EventDeadLetter, Queue: queueName, Depth: wn.qb.Depth(queueName), Message: msg})
+			return
+		}
+	}
+}
+
+func (wn *WebhookNotifier) watch() {
+	defer wn.wg.Done()
+	ticker := time.NewTicker(time.Duration(wn.cfg.Interval) * time.Second)
+	defer ticker.Stop()
+	for {
+		wn.check()
+		select {
+		case <-ticker.C:
+		case <-wn.done:
+			return
+		}
+	}
+}
+
+// check сравнивает глубину очередей, возраст их сообщений и число очередей
+// с порогами; уведомление отправляется один раз при пересечении порога
+func (wn *WebhookNotifier) check() {
+	names := slices.DeleteFunc(wn.qb.QueueNames(), func(name string) bool { return name == broker.CanaryQueue })
+	for _, name := range names {
+		limits, ok := wn.cfg.Queues[name]
+		if !ok {
+			limits = wn.cfg.Watermarks
+		}
+		wn.checkAge(name, limits.MaxAge)
+		if limits.High <= 0 {
+			continue
+		}
+		switch depth := wn.qb.Depth(name); {
+		case !wn.above[name] && depth >= limits.High:
+			wn.above[name] = true
+			wn.notify(WebhookEvent{Event: EventHighWatermark, Queue: name, Depth: depth, Threshold: limits.High})
+		case wn.above[name] && depth <= limits.Low:
+			delete(wn.above, name)
+			wn.notify(WebhookEvent{Event: EventLowWatermark, Queue: name, Depth: depth, Threshold: limits.Low})
+		}
+	}
+
+	switch count := len(names); {
+	case !wn.maxQueues && count >= wn.qb.MaxQueues():
+		wn.maxQueues = true
+		wn.notify(WebhookEvent{Event: EventMaxQueues, Depth: count, Threshold: wn.qb.MaxQueues()})
+	case wn.maxQueues && count < wn.qb.MaxQueues():
+		wn.maxQueues = false
+	}
+}
+
+// checkAge уведомляет об очереди, самое старое сообщение которой ждет дольше
+// maxAge секунд: обычно это значит, что ее потребители остановились. Повторное
+// уведомление отправляется после того, как возраст опустится ниже порога.
+func (wn *WebhookNotifier) checkAge(name string, maxAge int) {
+	if maxAge <= 0 {
+		return
+	}
+	age := wn.qb.OldestAge(name)
+	switch stuck := age >= time.Duration(maxAge)*time.Second; {
+	case stuck && !wn.stuck[name]:
+		wn.stuck[name] = true
+		wn.notify(WebhookEvent{Event: EventStuckQueue, Queue: name, Depth: wn.qb.Depth(name), Threshold: maxAge, Age: age.Seconds()})
+	case !stuck:
+		delete(wn.stuck, name)
+	}
+}
+
+func (wn *WebhookNotifier) deliver() {
+	defer wn.wg.Done()
+	for {
+		select {
+		case event := <-wn.events:
+			body, _ := json.Marshal(event)
+			for _, url := range wn.cfg.URLs {
+				wn.send(url, body)
+			}
+		case <-wn.done:
+			return
+		}
+	}
+}
+
+// send доставляет уведомление получателю, повторяя попытку после ошибки
+func (wn *WebhookNotifier) send(url string, body []byte) {
+	backoff := 500 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		err := wn.post(url, body)
+		wn.setError(err)
+		if err == nil || attempt == webhookAttempts {
+			return
+		}
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-wn.done:
+			return
+		}
+	}
+}
+
+func (wn *WebhookNotifier) post(url string, body []byte) error {
+	resp, err := wn.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("post to %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("post to %s: unexpected status %s: %s", url, resp.Status, strings.TrimSpace(string(data)))
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package bridge
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"queue-broker/pkg/broker"
+)
+
+// TestWebhookNotifier проверяет уведомления о порогах глубины, лимите очередей
+// и очереди недоставленных сообщений
+func TestWebhookNotifier(t *testing.T) {
+	var mu sync.Mutex
+	var events []WebhookEvent
+	failures := 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if failures > 0 {
+			failures--
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		var event WebhookEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		events = append(events, event)
+	}))
+	defer server.Close()
+	received := func() []WebhookEvent {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]WebhookEvent(nil), events...)
+	}
+
+	qb := broker.NewQueueBroker(100, 3, 10)
+	wn := NewWebhookNotifier(WebhookConfig{
+		URLs:             []string{server.URL},
+		Watermarks:       Watermarks{High: 3, Low: 1},
+		Queues:           map[string]Watermarks{"quiet": {}},
+		DeadLetterQueues: []string{"*.dlq"},
+	}, qb)
+	qb.AddEnqueueListener(wn.deadLetter)
+	wn.wg.Add(1)
+	go wn.deliver()
+	defer wn.Close()
+
+	for i := 0; i < 3; i++ {
+		qb.PutMessage("jobs", "job")
+		qb.PutMessage("quiet", "job")
+	}
+	wn.check()
+	wn.check()
+	waitFor(t, func() bool { return len(received()) == 1 })
+	if e := received()[0]; e.Event != EventHighWatermark || e.Queue != "jobs" || e.Depth != 3 || e.Threshold != 3 {
+		t.Errorf("unexpected event: %+v", e)
+	}
+
+	qb.Dequeue("jobs", 0)
+	wn.check()
+	qb.Dequeue("jobs", 0)
+	wn.check()
+	waitFor(t, func() bool { return len(received()) == 2 })
+	if e := received()[1]; e.Event != EventLowWatermark || e.Depth != 1 {
+		t.Errorf("unexpected event: %+v", e)
+	}
+
+	qb.PutMessage("jobs.dlq", "failed job")
+	waitFor(t, func() bool { return len(received()) == 3 })
+	if e := received()[2]; e.Event != EventDeadLetter || e.Queue != "jobs.dlq" || e.Message == nil || e.Message.Body != "failed job" {
+		t.Errorf("unexpected event: %+v", e)
+	}
+
+	wn.check()
+	waitFor(t, func() bool { return len(received()) == 4 })
+	if e := received()[3]; e.Event != EventMaxQueues || e.Depth != 3 {
+		t.Errorf("unexpected event: %+v", e)
+	}
+}
+
+// TestWebhookStuckQueue проверяет уведомление о сообщении, ждущем дольше max_age
+func TestWebhookStuckQueue(t *testing.T) {
+	events := make(chan WebhookEvent, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event WebhookEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		events <- event
+	}))
+	defer server.Close()
+
+	qb := broker.NewQueueBroker(100, 10, 10)
+	wn := NewWebhookNotifier(WebhookConfig{
+		URLs:       []string{server.URL},
+		Watermarks: Watermarks{MaxAge: 1},
+		Queues:     map[string]Watermarks{"quiet": {}},
+	}, qb)
+	wn.wg.Add(1)
+	go wn.deliver()
+	defer wn.Close()
+
+	qb.PutMessage("jobs", "job")
+	qb.PutMessage("quiet", "job")
+	wn.check()
+	time.Sleep(time.Second)
+	wn.check()
+	wn.check()
+	select {
+	case e := <-events:
+		if e.Event != EventStuckQueue || e.Queue != "jobs" || e.Threshold != 1 || e.Age < 1 || e.Depth != 1 {
+			t.Errorf("unexpected event: %+v", e)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no stuck_queue event")
+	}
+
+	// После выдачи старого сообщения очередь снова может стать зависшей
+	qb.Dequeue("jobs", 0)
+	wn.check()
+	if len(wn.stuck) != 0 {
+		t.Errorf("queue still marked stuck: %v", wn.stuck)
+	}
+	select {
+	case e := <-events:
+		t.Errorf("unexpected event: %+v", e)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
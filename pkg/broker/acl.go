@@ -0,0 +1,179 @@
+package broker
+
+import (
+	"slices"
+	"time"
+)
+
+// maxAuditEntries число хранимых записей журнала изменений прав
+const maxAuditEntries = 1000
+
+// Permission право на действие с очередью
+type Permission string
+
+const (
+	// PermProduce постановка сообщений
+	PermProduce Permission = "produce"
+	// PermConsume получение и подтверждение сообщений
+	PermConsume Permission = "consume"
+	// PermAdmin изменение настроек и прав очереди
+	PermAdmin Permission = "admin"
+)
+
+// Everyone элемент списка доступа, разрешающий действие любому клиенту,
+// в том числе неаутентифицированному
+const Everyone = "*"
+
+// QueueACL владелец и списки доступа очереди. Владелец обладает всеми
+// правами; право admin включает produce и consume.
+type QueueACL struct {
+	Owner   string   `json:"owner"`
+	Produce []string `json:"produce"`
+	Consume []string `json:"consume"`
+	Admin   []string `json:"admin"`
+}
+
+// Allows сообщает, есть ли у субъекта право на действие
+func (acl *QueueACL) Allows(principal string, perm Permission) bool {
+	listed := func(list []string) bool {
+		return slices.Contains(list, Everyone) || (principal != "" && slices.Contains(list, principal))
+	}
+	if (principal != "" && principal == acl.Owner) || listed(acl.Admin) {
+		return true
+	}
+	switch perm {
+	case PermProduce:
+		return listed(acl.Produce)
+	case PermConsume:
+		return listed(acl.Consume)
+	}
+	return false
+}
+
+// AuditEntry запись журнала изменений владельца и прав очереди
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	Principal string    `json:"principal"`
+	Queue     string    `json:"queue"`
+	Action    string    `json:"action"`
+	Before    *QueueACL `json:"before,omitempty"`
+	After     *QueueACL `json:"after"`
+}
+
+// QueueACL возвращает права очереди; false, если очередь не закреплена за владельцем
+func (qb *QueueBroker) QueueACL(queueName string) (QueueACL, bool) {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	if acl, ok := qb.acls[queueName]; ok {
+		return *acl, true
+	}
+	return QueueACL{}, false
+}
+
+// Authorize проверяет право субъекта на действие с очередью. Очереди без
+// владельца доступны всем. Для шаблона право требуется во всех очередях с
+// владельцем, совпадающих с ним. Разрешенное правами действие могут
+// запретить плагины AuthPlugin.
+func (qb *QueueBroker) Authorize(principal, queueName string, perm Permission) bool {
+	qb.mu.Lock()
+	allowed := qb.authorizeLocked(principal, queueName, perm)
+	plugins := qb.plugins
+	qb.mu.Unlock()
+	return allowed && pluginsAuthorize(plugins, principal, queueName, perm)
+}
+
+func (qb *QueueBroker) authorizeLocked(principal, queueName string, perm Permission) bool {
+	if !IsPattern(queueName) {
+		acl, ok := qb.acls[queueName]
+		return !ok || acl.Allows(principal, perm)
+	}
+
+	owned := newQueueIndex()
+	for name := range qb.acls {
+		owned.add(name)
+	}
+	for _, name := range owned.match(queueName) {
+		if !qb.acls[name].Allows(principal, perm) {
+			return false
+		}
+	}
+	return true
+}
+
+// SetQueueACL заменяет права очереди. Очередь без владельца может закрепить
+// за собой любой аутентифицированный субъект (пустой Owner означает его
+// самого), иначе требуется право admin. Очередь при этом не создается.
+func (qb *QueueBroker) SetQueueACL(principal, queueName string, acl QueueACL) error {
+	if principal == "" {
+		return ErrAuthRequired
+	}
+	if queueName == "" || IsPattern(queueName) {
+		return ErrInvalidQueueName
+	}
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+
+	before := qb.acls[queueName]
+	if before != nil && !before.Allows(principal, PermAdmin) {
+		return ErrPermissionDenied
+	}
+	if acl.Owner == "" {
+		acl.Owner = principal
+		if before != nil {
+			acl.Owner = before.Owner
+		}
+	}
+	qb.acls[queueName] = &acl
+	qb.auditLocked(principal, queueName, "set_acl", before, &acl)
+	return nil
+}
+
+// TransferQueueOwner передает очередь новому владельцу; списки доступа
+// сохраняются. Требуется право admin.
+func (qb *QueueBroker) TransferQueueOwner(principal, queueName, owner string) error {
+	if owner == "" {
+		return ErrOwnerRequired
+	}
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+
+	before := qb.acls[queueName]
+	if before == nil {
+		return ErrNoOwner
+	}
+	if !before.Allows(principal, PermAdmin) {
+		return ErrPermissionDenied
+	}
+	after := *before
+	after.Owner = owner
+	qb.acls[queueName] = &after
+	qb.auditLocked(principal, queueName, "transfer_owner", before, &after)
+	return nil
+}
+
+// AuditLog возвращает записи журнала изменений прав очереди, начиная со старых
+func (qb *QueueBroker) AuditLog(queueName string) []AuditEntry {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	var entries []AuditEntry
+	for _, entry := range qb.audit {
+		if entry.Queue == queueName {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func (qb *QueueBroker) auditLocked(principal, queueName, action string, before, after *QueueACL) {
+	if len(qb.audit) >= maxAuditEntries {
+		qb.audit = qb.audit[1:]
+	}
+	qb.audit = append(qb.audit, AuditEntry{
+		Time:      time.Now(),
+		Principal: principal,
+		Queue:     queueName,
+		Action:    action,
+		Before:    before,
+		After:     after,
+	})
+}
@@ -0,0 +1,70 @@
+package broker
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestQueueACL проверяет закрепление очереди, права из списков доступа,
+// передачу владельца и журнал изменений
+func TestQueueACL(t *testing.T) {
+	qb := NewQueueBroker(100, 10, 10)
+
+	if !qb.Authorize("", "orders", PermProduce) {
+		t.Fatal("queue without owner must be open")
+	}
+	if err := qb.SetQueueACL("", "orders", QueueACL{}); !errors.Is(err, ErrAuthRequired) {
+		t.Fatalf("expected anonymous claim to fail, got %v", err)
+	}
+	if err := qb.SetQueueACL("alice", "orders", QueueACL{Produce: []string{"bob"}, Consume: []string{Everyone}}); err != nil {
+		t.Fatal(err)
+	}
+	if acl, _ := qb.QueueACL("orders"); acl.Owner != "alice" {
+		t.Errorf("expected claimer to become owner, got %q", acl.Owner)
+	}
+
+	cases := []struct {
+		principal string
+		perm      Permission
+		allowed   bool
+	}{
+		{"alice", PermAdmin, true},
+		{"bob", PermProduce, true},
+		{"bob", PermAdmin, false},
+		{"carol", PermProduce, false},
+		{"", PermConsume, true},
+	}
+	for _, c := range cases {
+		if got := qb.Authorize(c.principal, "orders", c.perm); got != c.allowed {
+			t.Errorf("Authorize(%q, %s) = %v, want %v", c.principal, c.perm, got, c.allowed)
+		}
+	}
+	if qb.Authorize("carol", "orders.*", PermProduce) != true || qb.Authorize("carol", "*", PermProduce) {
+		t.Error("pattern must require permission in every owned matching queue")
+	}
+
+	if err := qb.SetQueueACL("bob", "orders", QueueACL{}); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("expected non-admin change to be denied, got %v", err)
+	}
+	if err := qb.TransferQueueOwner("alice", "orders", "dave"); err != nil {
+		t.Fatal(err)
+	}
+	if qb.Authorize("alice", "orders", PermAdmin) || !qb.Authorize("dave", "orders", PermAdmin) || !qb.Authorize("bob", "orders", PermProduce) {
+		t.Error("ownership transfer must move admin rights and keep access lists")
+	}
+
+	entries := qb.AuditLog("orders")
+	if len(entries) != 2 || entries[0].Action != "set_acl" || entries[0].Before != nil ||
+		entries[1].Action != "transfer_owner" || entries[1].Principal != "alice" || entries[1].Before.Owner != "alice" || entries[1].After.Owner != "dave" {
+		t.Errorf("unexpected audit log: %+v", entries)
+	}
+
+	restored := NewQueueBroker(100, 10, 10)
+	qb.PutMessage("orders", "o1")
+	if err := restored.Restore(qb.Snapshot()); err != nil {
+		t.Fatal(err)
+	}
+	if acl, ok := restored.QueueACL("orders"); !ok || acl.Owner != "dave" {
+		t.Errorf("ACL was not restored from snapshot: %+v", acl)
+	}
+}
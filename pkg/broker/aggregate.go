@@ -0,0 +1,181 @@
+package broker
+
+import (
+	"errors"
+	"time"
+)
+
+// maxAggregateMessages наибольший размер пакета агрегации
+const maxAggregateMessages = 1000
+
+// AggregatePolicy настройки агрегации: сообщения очереди выдаются пакетом
+// (DequeueAggregate), как только их набирается MaxMessages или самое старое
+// из них ждет MaxWait секунд
+type AggregatePolicy struct {
+	MaxMessages int `json:"max_messages"`
+	MaxWait     int `json:"max_wait"`
+}
+
+// Validate проверяет параметры агрегации
+func (p AggregatePolicy) Validate() error {
+	if p.MaxMessages <= 0 || p.MaxMessages > maxAggregateMessages {
+		return errors.New("max_messages must be between 1 and 1000")
+	}
+	if p.MaxWait <= 0 {
+		return errors.New("max_wait must be positive")
+	}
+	return nil
+}
+
+// DequeueAggregate извлекает пакет сообщений очереди с политикой агрегации
+// (QueueConfig.Aggregate): MaxMessages сообщений или все накопленные, если
+// первое из них ждет дольше MaxWait. Если пакет не собрался за timeout
+// секунд, возвращается ErrTimeout, а сообщения остаются в очереди.
+//
+// Если сообщение пакета не удалось выдать (например, расшифровать), оно, как
+// в Dequeue, удаляется, пакет завершается выданными до него сообщениями, а
+// остальные возвращаются в начало очереди; ошибка возвращается, только если
+// не выдано ни одного сообщения.
+func (qb *QueueBroker) DequeueAggregate(queueName string, timeout time.Duration) ([]*Message, error) {
+	batch, err := qb.dequeueAggregate(queueName, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	msgs := make([]*Message, 0, len(batch))
+	for _, stored := range batch {
+		var msg *Message
+		if msg, err = qb.deliver(stored); err != nil {
+			qb.mu.Lock()
+			qb.releaseLocked(stored.Queue, stored)
+			qb.returnBatchLocked(queueName, batch[len(msgs)+1:])
+			qb.mu.Unlock()
+			break
+		}
+		msgs = append(msgs, msg)
+	}
+	qb.mu.Lock()
+	for _, stored := range batch[:len(msgs)] {
+		qb.releaseLocked(stored.Queue, stored)
+	}
+	qb.mu.Unlock()
+	if len(msgs) == 0 {
+		return nil, err
+	}
+	return msgs, nil
+}
+
+// returnBatchLocked возвращает невыданные сообщения пакета в начало очереди
+// в прежнем порядке; если очередь уже удалена, они удаляются вместе с ней
+func (qb *QueueBroker) returnBatchLocked(queueName string, rest []*Message) {
+	queue := qb.queues[queueName]
+	for i := len(rest) - 1; i >= 0; i-- {
+		if queue == nil {
+			qb.releaseLocked(queueName, rest[i])
+		} else {
+			queue.insertAt(0, rest[i])
+		}
+	}
+}
+
+// dequeueAggregate ждет, пока соберется пакет. Как и выборочный получатель
+// (dequeueMatching), он не резервирует сообщений и будится каждым новым
+// сообщением, а окно MaxWait отсчитывает по времени постановки первого.
+func (qb *QueueBroker) dequeueAggregate(queueName string, timeout time.Duration) ([]*Message, error) {
+	if queueName == "" || IsPattern(queueName) {
+		return nil, ErrInvalidQueueName
+	}
+	deadline := time.NewTimer(qb.waitLimit(timeout))
+	defer deadline.Stop()
+
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	var w *waiter
+	attached := false
+	defer func() {
+		if w != nil {
+			qb.removeSelectiveWaiterLocked(queueName, w)
+		}
+		if attached {
+			qb.detachConsumerLocked(queueName)
+		}
+	}()
+	for {
+		if err := qb.standbyLocked(queueName); err != nil {
+			return nil, err
+		}
+		policy := qb.queueConfigLocked(queueName).Aggregate
+		if policy == nil {
+			return nil, ErrNoAggregation
+		}
+		queue := qb.queues[queueName]
+		if queue == nil {
+			return nil, ErrQueueNotFound
+		}
+		if qb.archiving[queueName] {
+			return nil, ErrQueueArchiving
+		}
+
+		// wait через сколько истечет окно первого сообщения (0 — сообщений нет)
+		var wait time.Duration
+		now := time.Now()
+		paused := qb.pausedLocked(queueName, now)
+		if available := queue.len() - qb.reservedLocked(queueName); paused == 0 && available > 0 {
+			wait = queue.messages[0].enqueuedAt.Add(time.Duration(policy.MaxWait) * time.Second).Sub(now)
+			if available >= policy.MaxMessages || wait <= 0 {
+				if batch := qb.popBatchLocked(queueName, queue, min(available, policy.MaxMessages)); len(batch) > 0 {
+					return batch, nil
+				}
+				wait = 0
+			}
+		}
+		if timeout <= 0 {
+			return nil, ErrTimeout
+		}
+		if !attached {
+			if err := qb.attachConsumerLocked(queueName); err != nil {
+				return nil, err
+			}
+			attached = true
+		}
+		if w == nil {
+			w = &waiter{ready: make(chan struct{}, 1)}
+			qb.selectiveWaiters[queueName] = append(qb.selectiveWaiters[queueName], w)
+		}
+		if paused > 0 && (wait == 0 || paused < wait) {
+			wait = paused
+		}
+		qb.mu.Unlock()
+
+		window, stop := resumeTimer(wait)
+		expired := false
+		select {
+		case <-w.ready:
+		case <-window:
+		case <-deadline.C:
+			expired = true
+		}
+		stop()
+		qb.mu.Lock()
+		if expired {
+			if qb.queues[queueName] == nil {
+				return nil, ErrQueueNotFound
+			}
+			return nil, ErrTimeout
+		}
+	}
+}
+
+// popBatchLocked извлекает до n сообщений очереди, пропуская занятые группы;
+// сообщения одной группы попадают в пакет по порядку
+func (qb *QueueBroker) popBatchLocked(queueName string, queue *messageQueue, n int) []*Message {
+	batch := make([]*Message, 0, n)
+	for len(batch) < n {
+		stored := qb.popLocked(queueName, queue)
+		if stored == nil {
+			break
+		}
+		batch = append(batch, stored)
+	}
+	return batch
+}
@@ -0,0 +1,101 @@
+package broker
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestDequeueAggregate проверяет выдачу пакета по числу сообщений и по окну
+func TestDequeueAggregate(t *testing.T) {
+	qb := NewQueueBroker(100, 10, 10)
+	if _, err := qb.DequeueAggregate("rows", 0); !errors.Is(err, ErrNoAggregation) {
+		t.Errorf("expected ErrNoAggregation, got %v", err)
+	}
+	qb.SetQueueConfig("rows", QueueConfig{LockDuration: 30, Aggregate: &AggregatePolicy{MaxMessages: 3, MaxWait: 1}})
+	for _, body := range []string{"1", "2", "3", "4"} {
+		qb.PutMessage("rows", body)
+	}
+
+	batch, err := qb.DequeueAggregate("rows", 0)
+	if err != nil || len(batch) != 3 || batch[0].Body != "1" || batch[2].Body != "3" {
+		t.Fatalf("unexpected batch %+v %v", batch, err)
+	}
+	// Одно сообщение: пакет еще не собран
+	if _, err := qb.DequeueAggregate("rows", 0); !errors.Is(err, ErrTimeout) {
+		t.Errorf("expected ErrTimeout, got %v", err)
+	}
+	// По истечении окна выдается неполный пакет
+	start := time.Now()
+	batch, err = qb.DequeueAggregate("rows", 5*time.Second)
+	if err != nil || len(batch) != 1 || batch[0].Body != "4" {
+		t.Fatalf("unexpected batch %+v %v", batch, err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("window was not applied: %v", elapsed)
+	}
+}
+
+// TestDequeueAggregateDeliverFailure проверяет, что сообщение пакета, которое
+// не удалось распаковать, не отменяет выдачу предыдущих и не удаляет следующие
+func TestDequeueAggregateDeliverFailure(t *testing.T) {
+	qb := NewQueueBroker(100, 10, 10)
+	qb.SetQueueConfig("rows", QueueConfig{LockDuration: 30, Aggregate: &AggregatePolicy{MaxMessages: 3, MaxWait: 60}})
+	for i, msg := range []*ReplicatedMessage{
+		{Body: []byte("1")},
+		{Body: []byte("not gzip"), Compression: CompressionGzip},
+		{Body: []byte("3")},
+	} {
+		qb.ApplyReplication(ReplicationOp{Op: ReplicationPut, Queue: "rows", ID: uint64(i + 1), Message: msg})
+	}
+
+	batch, err := qb.DequeueAggregate("rows", 0)
+	if err != nil || len(batch) != 1 || batch[0].Body != "1" {
+		t.Fatalf("unexpected batch %+v %v", batch, err)
+	}
+	if browsed, _, _ := qb.Browse("rows", 0, 10); len(browsed) != 1 || browsed[0].Body != "3" {
+		t.Fatalf("rest of the batch not returned: %+v", browsed)
+	}
+
+	// Неудача на первом сообщении пакета возвращается ошибкой
+	qb.SetQueueConfig("heads", QueueConfig{LockDuration: 30, Aggregate: &AggregatePolicy{MaxMessages: 3, MaxWait: 60}})
+	for i, msg := range []*ReplicatedMessage{
+		{Body: []byte("not gzip"), Compression: CompressionGzip},
+		{Body: []byte("b")},
+		{Body: []byte("c")},
+	} {
+		qb.ApplyReplication(ReplicationOp{Op: ReplicationPut, Queue: "heads", ID: uint64(i + 10), Message: msg})
+	}
+	if _, err := qb.DequeueAggregate("heads", 0); err == nil {
+		t.Fatal("failed delivery not reported")
+	}
+	if qb.Depth("heads") != 2 {
+		t.Errorf("depth %d after a failed batch, want 2", qb.Depth("heads"))
+	}
+}
+
+// TestDequeueAggregateWait проверяет, что ожидающий пакета будится, когда
+// он набирается
+func TestDequeueAggregateWait(t *testing.T) {
+	qb := NewQueueBroker(100, 10, 10)
+	qb.SetQueueConfig("rows", QueueConfig{LockDuration: 30, Aggregate: &AggregatePolicy{MaxMessages: 2, MaxWait: 60}})
+	qb.PutMessage("rows", "1")
+	done := make(chan []*Message)
+	go func() {
+		batch, err := qb.DequeueAggregate("rows", 5*time.Second)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- batch
+	}()
+	time.Sleep(50 * time.Millisecond)
+	qb.PutMessage("rows", "2")
+	select {
+	case batch := <-done:
+		if len(batch) != 2 {
+			t.Errorf("unexpected batch %+v", batch)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("waiter was not woken")
+	}
+}
@@ -0,0 +1,179 @@
+package broker
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+	"unicode/utf8"
+)
+
+// Archive хранилище остатков удаляемых очередей
+type Archive interface {
+	// Store сохраняет снимок очереди и возвращает его расположение;
+	// очередь удаляется, только если Store вернул nil
+	Store(qs QueueSnapshot) (string, error)
+}
+
+// DirArchive сохраняет снимки очередей JSON-файлами в каталоге
+type DirArchive struct {
+	Dir string
+}
+
+// archivedMessage сообщение в файле архива; тело, не являющееся корректным
+// UTF-8, записывается в поле message_base64, как в HTTP API
+type archivedMessage struct {
+	*Message
+	Body   string `json:"message,omitempty"`
+	Base64 string `json:"message_base64,omitempty"`
+	// DeliverAt срок выдачи отложенного сообщения
+	DeliverAt time.Time `json:"deliver_at,omitzero"`
+}
+
+// Store записывает снимок в файл <очередь>-<время>.json. Файл сначала
+// пишется во временный и сбрасывается на диск, поэтому частично записанный
+// архив не принимается за полный.
+func (a DirArchive) Store(qs QueueSnapshot) (string, error) {
+	messages := make([]archivedMessage, len(qs.Messages))
+	for i, msg := range qs.Messages {
+		messages[i] = archivedMessage{Message: msg, DeliverAt: msg.DeliverAt}
+		if utf8.ValidString(msg.Body) {
+			messages[i].Body = msg.Body
+		} else {
+			messages[i].Base64 = base64.StdEncoding.EncodeToString([]byte(msg.Body))
+		}
+	}
+	data, err := json.MarshalIndent(struct {
+		QueueSnapshot
+		ArchivedAt time.Time         `json:"archived_at"`
+		Messages   []archivedMessage `json:"messages"`
+	}{qs, time.Now().UTC(), messages}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(a.Dir, 0o755); err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("%s-%s.json", url.PathEscape(qs.Name), time.Now().UTC().Format("20060102T150405.000000000Z"))
+	path := filepath.Join(a.Dir, name)
+	tmp, err := os.CreateTemp(a.Dir, ".archive-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// SetArchive задает хранилище для ArchiveQueue
+func (qb *QueueBroker) SetArchive(archive Archive) {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	qb.archive = archive
+}
+
+// ArchiveQueue сохраняет оставшиеся сообщения очереди (включая выданные,
+// но не подтвержденные) в архив и удаляет очередь. На время записи архива
+// постановка и выдача из очереди отклоняются; при ошибке записи очередь
+// остается без изменений. Возвращает расположение архива и число сообщений.
+func (qb *QueueBroker) ArchiveQueue(queueName string) (string, int, error) {
+	qb.mu.Lock()
+	archive := qb.archive
+	switch {
+	case archive == nil:
+		qb.mu.Unlock()
+		return "", 0, ErrNoArchive
+	case qb.queues[queueName] == nil:
+		qb.mu.Unlock()
+		return "", 0, ErrQueueNotFound
+	case qb.archiving[queueName]:
+		qb.mu.Unlock()
+		return "", 0, ErrQueueArchiving
+	}
+	qb.archiving[queueName] = true
+	stored := qb.storedMessagesLocked()[queueName]
+	qs := qb.queueSnapshotLocked(queueName, stored)
+	qb.mu.Unlock()
+
+	qb.encodeSnapshot(&qs)
+	location, err := archive.Store(qs)
+
+	qb.mu.Lock()
+	delete(qb.archiving, queueName)
+	if err != nil {
+		err = fmt.Errorf("archive queue %s: %w", queueName, err)
+		qb.archiveError, qb.archiveErrorAt = err, time.Now()
+		qb.mu.Unlock()
+		return "", 0, err
+	}
+	qb.deleteQueueLocked(queueName)
+	qb.mu.Unlock()
+	qb.notifyQueueListeners(QueueDeleted, queueName)
+	return location, len(qs.Messages), nil
+}
+
+// DeleteQueue удаляет очередь вместе с сообщениями, настройками и правами.
+// Ожидающие получатели и потоковые потребители получают ErrQueueNotFound.
+func (qb *QueueBroker) DeleteQueue(queueName string) error {
+	qb.mu.Lock()
+	if qb.queues[queueName] == nil {
+		qb.mu.Unlock()
+		return ErrQueueNotFound
+	}
+	if qb.archiving[queueName] {
+		qb.mu.Unlock()
+		return ErrQueueArchiving
+	}
+	qb.deleteQueueLocked(queueName)
+	qb.mu.Unlock()
+	qb.notifyQueueListeners(QueueDeleted, queueName)
+	return nil
+}
+
+func (qb *QueueBroker) deleteQueueLocked(queueName string) {
+	for _, stored := range qb.storedMessagesLocked()[queueName] {
+		qb.releaseLocked(queueName, stored)
+	}
+	qb.dropDelayedLocked(queueName)
+	for token, lock := range qb.locks {
+		if lock.queueName == queueName {
+			lock.timer.Stop()
+			delete(qb.locks, token)
+		}
+	}
+	for _, s := range qb.heartbeats[queueName] {
+		qb.removeConsumerLocked(s)
+	}
+	delete(qb.queues, queueName)
+	delete(qb.inflight, queueName)
+	delete(qb.configs, queueName)
+	delete(qb.acls, queueName)
+	delete(qb.schemas, queueName)
+	delete(qb.dedup, queueName)
+	delete(qb.affinity, queueName)
+	delete(qb.groups, queueName)
+	delete(qb.stats, queueName)
+	qb.dropLogLocked(queueName)
+	delete(qb.spills, queueName)
+	qb.index.remove(queueName)
+	qb.stopIdleLocked(queueName)
+	// Пробуждение ожидающих: они обнаружат, что очереди больше нет
+	qb.wakeAllLocked(queueName)
+}
@@ -0,0 +1,135 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// failingArchive хранилище, которое не может записать архив
+type failingArchive struct{}
+
+func (failingArchive) Store(QueueSnapshot) (string, error) {
+	return "", errors.New("disk full")
+}
+
+// TestArchiveQueue проверяет сохранение оставшихся сообщений и удаление очереди
+func TestArchiveQueue(t *testing.T) {
+	qb := NewQueueBroker(10, 10, 1)
+	if _, _, err := qb.ArchiveQueue("jobs"); !errors.Is(err, ErrNoArchive) {
+		t.Errorf("expected ErrNoArchive, got %v", err)
+	}
+	dir := t.TempDir()
+	qb.SetArchive(DirArchive{Dir: dir})
+
+	payload := string([]byte{0x00, 0xff})
+	qb.Enqueue("jobs", &Message{Body: "pending"})
+	qb.Enqueue("jobs", &Message{Body: payload})
+	if _, err := qb.PeekLock("jobs", 0, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	qb.SetQueueConfig("jobs", QueueConfig{LockDuration: 5})
+
+	location, count, err := qb.ArchiveQueue("jobs")
+	if err != nil || count != 2 {
+		t.Fatalf("archive failed: %d %v", count, err)
+	}
+	data, err := os.ReadFile(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var archived struct {
+		Name     string       `json:"name"`
+		Config   *QueueConfig `json:"config"`
+		Messages []struct {
+			Body   string `json:"message"`
+			Base64 string `json:"message_base64"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(data, &archived); err != nil {
+		t.Fatal(err)
+	}
+	// Сначала ожидающее сообщение, затем выданное, но не подтвержденное
+	if archived.Name != "jobs" || archived.Config == nil || len(archived.Messages) != 2 ||
+		archived.Messages[0].Base64 != "AP8=" || archived.Messages[1].Body != "pending" {
+		t.Errorf("unexpected archive: %s", data)
+	}
+
+	if _, err := qb.Dequeue("jobs", 0); !errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("expected deleted queue, got %v", err)
+	}
+	if qb.TotalBytes() != 0 || qb.QueueConfig("jobs").LockDuration != defaultLockDuration {
+		t.Errorf("queue state not cleaned up")
+	}
+}
+
+// TestArchiveFailureKeepsQueue проверяет, что очередь не удаляется без архива
+func TestArchiveFailureKeepsQueue(t *testing.T) {
+	qb := NewQueueBroker(10, 10, 1)
+	qb.SetArchive(failingArchive{})
+	qb.Enqueue("jobs", &Message{Body: "job"})
+	if _, _, err := qb.ArchiveQueue("jobs"); err == nil {
+		t.Fatal("expected archive error")
+	}
+	if msg, err := qb.Dequeue("jobs", 0); err != nil || msg.Body != "job" {
+		t.Errorf("queue changed after failed archive: %v %v", msg, err)
+	}
+}
+
+// TestDeleteQueueWakesConsumers проверяет, что ожидающие получатели
+// и потоковые потребители узнают об удалении очереди
+func TestDeleteQueueWakesConsumers(t *testing.T) {
+	qb := NewQueueBroker(10, 10, 5)
+	qb.Enqueue("jobs", &Message{Body: "x"})
+	qb.Dequeue("jobs", 0)
+	sub, err := qb.Subscribe("jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	errs := make(chan error, 2)
+	go func() {
+		_, err := qb.Dequeue("jobs", 5*time.Second)
+		errs <- err
+	}()
+	go func() {
+		_, err := sub.Next(context.Background())
+		errs <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if err := qb.DeleteQueue("jobs"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-errs:
+			if !errors.Is(err, ErrQueueNotFound) {
+				t.Errorf("expected ErrQueueNotFound, got %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("consumer was not woken by queue deletion")
+		}
+	}
+}
+
+// TestQueueListener проверяет уведомления о создании и удалении очередей
+func TestQueueListener(t *testing.T) {
+	qb := NewQueueBroker(100, 10, 10)
+	var events []string
+	qb.AddQueueListener(func(event QueueEvent, queueName string) {
+		events = append(events, string(event)+" "+queueName)
+	})
+	qb.PutMessage("jobs", "job 1")
+	qb.PutMessage("jobs", "job 2")
+	qb.PutMessage(CanaryQueue, "ping")
+	qb.DeleteQueue("jobs")
+	qb.DeleteQueue("jobs")
+	if strings.Join(events, ", ") != "created jobs, deleted jobs" {
+		t.Errorf("unexpected events %v", events)
+	}
+}
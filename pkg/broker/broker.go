@@ -0,0 +1,676 @@
+// Package broker реализует очереди сообщений брокера без привязки к транспорту:
+// HTTP API, клиенты и другие протоколы надстраиваются поверх QueueBroker.
+package broker
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Message сообщение в очереди
+type Message struct {
+	Body    string            `json:"message"`
+	Headers map[string]string `json:"headers,omitempty"`
+	DedupID string            `json:"dedup_id,omitempty"`
+	// ContentType тип содержимого тела, принятого как есть (не в JSON)
+	ContentType string `json:"content_type,omitempty"`
+	// Queue очередь, из которой выдано сообщение
+	Queue string `json:"queue,omitempty"`
+	// GroupID группа сообщения: сообщения одной группы выдаются строго по
+	// порядку и по одному, разных групп — параллельно
+	GroupID string `json:"group_id,omitempty"`
+	// DeliverAt откладывает выдачу сообщения до этого момента
+	DeliverAt time.Time `json:"-"`
+
+	// compression алгоритм, которым сжато хранимое тело (пусто — не сжато)
+	compression string
+	// encrypted тело хранится зашифрованным ключом арендатора
+	encrypted bool
+	// keyID ключ брокера, которым зашифровано хранимое тело (см. SetKeyring)
+	keyID string
+	// id идентификатор хранимого сообщения для журнала репликации
+	id uint64
+	// enqueuedAt время постановки в очередь (для ведомого и восстановленного
+	// из снимка брокера — время получения)
+	enqueuedAt time.Time
+}
+
+// CanaryQueue служебная очередь для самопроверки брокера. Она не учитывается
+// в лимите очередей, не маршрутизируется и не реплицируется.
+const CanaryQueue = "__canary"
+
+// QueueBroker управляет очередями и сообщениями
+type QueueBroker struct {
+	queues         map[string]*messageQueue
+	maxQueueSize   int
+	maxQueues      int
+	defaultTimeout time.Duration
+	// maxTimeout предельное ожидание сообщения получателем (0 — без предела)
+	maxTimeout time.Duration
+	router     *Router
+	mu         sync.Mutex
+
+	configs            map[string]*QueueConfig
+	dedup              map[string]*dedupCache
+	defaultDedupWindow int
+	// idle отсчет простоя очередей с AutoDeleteAfterIdle
+	idle map[string]*idleTimer
+
+	locks    map[string]*messageLock
+	inflight map[string]int
+
+	federation *Federation
+
+	defaultCompressThreshold int
+	defaultCompression       string
+
+	// keys набор ключей шифрования при хранении; nil — не шифровать
+	keys         *keyring
+	reencrypting bool
+
+	affinity map[string]*affinityState
+
+	// paused очереди, выдача из которых приостановлена вызовом Pause
+	paused map[string]bool
+
+	index         *queueIndex
+	patternCursor map[string]int
+	// receiveCursor с какой очереди начинать следующий DequeueAny
+	receiveCursor int
+
+	enqueueListeners []EnqueueListener
+	queueListeners   []QueueListener
+	plugins          []Plugin
+
+	tenants map[string]*tenant
+
+	acls  map[string]*QueueACL
+	audit []AuditEntry
+
+	queueBytes    map[string]int64
+	totalBytes    int64
+	maxQueueBytes int64
+	maxTotalBytes int64
+
+	nextMessageID uint64
+	replicas      map[*ReplicationFeed]struct{}
+	follower      *Follower
+	consensus     *Consensus
+	// wal открытый журнал предзаписи (nil — очереди не хранятся на диске)
+	wal *WAL
+
+	archive   Archive
+	archiving map[string]bool
+	// offloadStore хранилище вынесенных тел сообщений (nil — вынос выключен)
+	offloadStore BlobStore
+	offload      OffloadConfig
+	// spills состояние выгрузки тел очередей на диск (см. spill)
+	spills map[string]*spillState
+	// spillListener слушатель постановок, выгружающий тела, подписан
+	spillListener bool
+
+	latencySimulation bool
+	schemas           map[string]*Schema
+	// consumers число ожидающих и потоковых потребителей каждой очереди
+	consumers map[string]int
+	// heartbeats зарегистрированные потребители каждой очереди по идентификатору
+	heartbeats map[string]map[string]*consumerSession
+	// transactions транзакции постановки по идентификатору (см. EnqueueTx)
+	transactions   map[string]*transaction
+	transactionTTL time.Duration
+	taps           map[*Tap]struct{}
+	// delayed отложенные сообщения каждой очереди в порядке срока выдачи
+	delayed map[string][]*delayedMessage
+	// waiters и patternWaiters ожидающие получатели каждой очереди и шаблона в порядке прихода
+	waiters        map[string][]*waiter
+	patternWaiters map[string][]*waiter
+	// selectiveWaiters ожидающие сообщения с определенным correlation_id
+	selectiveWaiters map[string][]*waiter
+	// groups занятые группы каждой очереди и выданные сообщения, которые их занимают
+	groups map[string]map[string]*Message
+	// spaceFreed закрывается, когда в очереди освобождается место; его ждут
+	// производители очередей с политикой OverflowBlock
+	spaceFreed map[string]chan struct{}
+	// stats скорости и задержки выдачи каждой очереди (см. Stats)
+	stats map[string]*queueStats
+	// logs журналы очередей с хранением (см. ReadLog)
+	logs map[string]*messageLog
+
+	healthChecks map[string]HealthCheck
+	// schedules расписания постановки сообщений по ID
+	schedules map[string]*scheduleEntry
+	// archiveError последняя ошибка записи архива очереди
+	archiveError   error
+	archiveErrorAt time.Time
+}
+
+// EnqueueListener вызывается после успешной постановки сообщения в очередь
+// (в том числе реплицированного). Вызов синхронный, поэтому долгую работу
+// слушатель должен выполнять асинхронно.
+type EnqueueListener func(queueName string, msg *Message)
+
+// QueueEvent событие жизненного цикла очереди
+type QueueEvent string
+
+const (
+	// QueueCreated очередь создана первым поставленным в нее сообщением
+	QueueCreated QueueEvent = "created"
+	// QueueDeleted очередь удалена (DeleteQueue или ArchiveQueue)
+	QueueDeleted QueueEvent = "deleted"
+)
+
+// QueueListener вызывается после создания или удаления очереди. Очереди,
+// получаемые ведомым по репликации или восстановленные из снимка, не
+// сообщаются. Вызов синхронный, как у EnqueueListener.
+type QueueListener func(event QueueEvent, queueName string)
+
+// NewQueueBroker создает новый экземпляр QueueBroker; defaultTimeout — в
+// секундах, более точное значение задает SetDefaultTimeout
+func NewQueueBroker(maxQueueSize, maxQueues, defaultTimeout int) *QueueBroker {
+	return &QueueBroker{
+		queues:           make(map[string]*messageQueue),
+		maxQueueSize:     maxQueueSize,
+		maxQueues:        maxQueues,
+		defaultTimeout:   time.Duration(defaultTimeout) * time.Second,
+		configs:          make(map[string]*QueueConfig),
+		idle:             make(map[string]*idleTimer),
+		dedup:            make(map[string]*dedupCache),
+		paused:           make(map[string]bool),
+		locks:            make(map[string]*messageLock),
+		inflight:         make(map[string]int),
+		affinity:         make(map[string]*affinityState),
+		index:            newQueueIndex(),
+		patternCursor:    make(map[string]int),
+		tenants:          make(map[string]*tenant),
+		acls:             make(map[string]*QueueACL),
+		queueBytes:       make(map[string]int64),
+		replicas:         make(map[*ReplicationFeed]struct{}),
+		archiving:        make(map[string]bool),
+		spills:           make(map[string]*spillState),
+		schemas:          make(map[string]*Schema),
+		consumers:        make(map[string]int),
+		heartbeats:       make(map[string]map[string]*consumerSession),
+		transactions:     make(map[string]*transaction),
+		transactionTTL:   defaultTransactionTTL * time.Second,
+		taps:             make(map[*Tap]struct{}),
+		delayed:          make(map[string][]*delayedMessage),
+		groups:           make(map[string]map[string]*Message),
+		spaceFreed:       make(map[string]chan struct{}),
+		stats:            make(map[string]*queueStats),
+		logs:             make(map[string]*messageLog),
+		waiters:          make(map[string][]*waiter),
+		patternWaiters:   make(map[string][]*waiter),
+		selectiveWaiters: make(map[string][]*waiter),
+		healthChecks:     make(map[string]HealthCheck),
+		schedules:        make(map[string]*scheduleEntry),
+	}
+}
+
+// SetRouter включает маршрутизацию сообщений по правилам при постановке в очередь
+func (qb *QueueBroker) SetRouter(router *Router) {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	qb.router = router
+}
+
+// AddEnqueueListener подписывает слушателя на постановку сообщений в очереди
+func (qb *QueueBroker) AddEnqueueListener(listener EnqueueListener) {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	qb.enqueueListeners = append(qb.enqueueListeners, listener)
+}
+
+// AddQueueListener подписывает слушателя на создание и удаление очередей
+func (qb *QueueBroker) AddQueueListener(listener QueueListener) {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	qb.queueListeners = append(qb.queueListeners, listener)
+}
+
+// notifyQueueListeners сообщает слушателям о событии очереди; вызывается без qb.mu
+func (qb *QueueBroker) notifyQueueListeners(event QueueEvent, queueName string) {
+	qb.mu.Lock()
+	listeners := qb.queueListeners
+	qb.mu.Unlock()
+	for _, listener := range listeners {
+		listener(event, queueName)
+	}
+	if event == QueueCreated {
+		qb.pluginsOnQueueCreate(queueName)
+	}
+}
+
+// PutMessage добавляет сообщение в очередь
+func (qb *QueueBroker) PutMessage(queueName, message string) error {
+	return qb.Enqueue(queueName, &Message{Body: message})
+}
+
+// Enqueue добавляет сообщение с заголовками в очередь.
+// Сначала сообщение проходит скрипт преобразования очереди, затем правила
+// маршрутизации могут выбрать другую очередь назначения и добавить очереди,
+// в которые ставятся копии сообщения.
+// Сообщение с DedupID, уже принятым в очередь в пределах окна
+// дедупликации, отбрасывается с ошибкой "duplicate message".
+func (qb *QueueBroker) Enqueue(queueName string, msg *Message) error {
+	return qb.EnqueueWait(queueName, msg, 0)
+}
+
+// EnqueueWait работает как Enqueue, но в очереди с политикой OverflowBlock
+// ждет освобождения места до timeout; не дождавшись, возвращает
+// CapacityError с ErrPutTimeout. В остальных очередях timeout не действует.
+func (qb *QueueBroker) EnqueueWait(queueName string, msg *Message, timeout time.Duration) error {
+	if queueName == CanaryQueue {
+		return qb.enqueueLocal(queueName, msg)
+	}
+	queueName, copies, federation, err := qb.prepareEnqueue(queueName, msg)
+	if err != nil {
+		return err
+	}
+
+	copied := make([]*Message, len(copies))
+	for i := range copies {
+		copied[i] = copyMessage(msg)
+	}
+	if err := qb.enqueueBlocking(queueName, msg, timeout); err != nil {
+		return err
+	}
+	federation.publish(queueName, msg)
+	qb.enqueueCopies(queueName, copies, copied, federation)
+	return nil
+}
+
+// prepareEnqueue проводит сообщение через конверт, скрипт преобразования,
+// плагины и маршрутизацию до постановки в локальную очередь: возвращает
+// очередь назначения, очереди копий и федерацию, которой сообщение
+// передается после постановки
+func (qb *QueueBroker) prepareEnqueue(queueName string, msg *Message) (string, []string, *Federation, error) {
+	if replyTo, ok := msg.Headers[ReplyToHeader]; ok && (replyTo == "" || IsPattern(replyTo)) {
+		return "", nil, nil, ErrInvalidReplyTo
+	}
+	if err := qb.celeryEnqueue(queueName, msg); err != nil {
+		return "", nil, nil, err
+	}
+	if err := qb.transform(queueName, msg); err != nil {
+		return "", nil, nil, err
+	}
+	dropClaimCheck(msg)
+	if err := qb.pluginsOnEnqueue(queueName, msg); err != nil {
+		return "", nil, nil, err
+	}
+
+	qb.mu.Lock()
+	router := qb.router
+	qb.mu.Unlock()
+
+	source := queueName
+	queueName, copies, err := router.Routes(queueName, msg)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	for _, dest := range append(copies, queueName) {
+		if TenantOf(dest) != TenantOf(source) {
+			return "", nil, nil, ErrCrossTenant
+		}
+	}
+	if err := qb.offloadBody(queueName, msg); err != nil {
+		return "", nil, nil, err
+	}
+
+	qb.mu.Lock()
+	federation := qb.federation
+	qb.mu.Unlock()
+	if federation != nil && msg.DedupID == "" {
+		// Без идентификатора реплика не сможет распознать повтор
+		msg.DedupID = federation.region + ":" + newToken()
+	}
+	return queueName, copies, federation, nil
+}
+
+// enqueueCopies ставит копии сообщения, поставленного в queueName, в очереди
+// copies. Копии ставятся после исходного сообщения; ошибка постановки копии
+// (например, заполненная очередь) не отменяет его.
+func (qb *QueueBroker) enqueueCopies(queueName string, copies []string, copied []*Message, federation *Federation) {
+	for i, dest := range copies {
+		if err := qb.enqueueLocal(dest, copied[i]); err != nil {
+			log.Printf("routing: copy from %s to %s: %v", queueName, dest, err)
+			continue
+		}
+		federation.publish(dest, copied[i])
+	}
+}
+
+// copyMessage копирует сообщение для постановки в другую очередь
+func copyMessage(msg *Message) *Message {
+	copied := &Message{Body: msg.Body, DedupID: msg.DedupID, ContentType: msg.ContentType, GroupID: msg.GroupID, DeliverAt: msg.DeliverAt}
+	if len(msg.Headers) > 0 {
+		copied.Headers = make(map[string]string, len(msg.Headers))
+		for k, v := range msg.Headers {
+			copied.Headers[k] = v
+		}
+	}
+	return copied
+}
+
+// enqueueLocal помещает сообщение в локальную очередь без маршрутизации и репликации
+func (qb *QueueBroker) enqueueLocal(queueName string, msg *Message) error {
+	qb.mu.Lock()
+	existed := qb.queues[queueName] != nil
+	err := qb.enqueueLocked(queueName, msg)
+	if err == nil {
+		qb.notifyTapsLocked(queueName, msg)
+	}
+	listeners := qb.enqueueListeners
+	created := err == nil && !existed && queueName != CanaryQueue
+	qb.mu.Unlock()
+
+	if created {
+		qb.notifyQueueListeners(QueueCreated, queueName)
+	}
+	if err == nil {
+		for _, listener := range listeners {
+			listener(queueName, msg)
+		}
+	}
+	if err == nil && queueName != CanaryQueue {
+		err = qb.persist()
+	}
+	return err
+}
+
+// persist ждет, пока операции, выполненные до вызова, будут зафиксированы
+// в журнале кластера Raft и записаны журналом предзаписи (см. WAL.Sync);
+// вызывается без qb.mu
+func (qb *QueueBroker) persist() error {
+	qb.mu.Lock()
+	consensus, wal := qb.consensus, qb.wal
+	qb.mu.Unlock()
+	if consensus != nil {
+		if err := consensus.commit(); err != nil {
+			return err
+		}
+	}
+	if wal != nil {
+		return wal.Sync()
+	}
+	return nil
+}
+
+func (qb *QueueBroker) enqueueLocked(queueName string, msg *Message) error {
+	_, err := qb.enqueueStoredLocked(queueName, msg)
+	return err
+}
+
+// enqueueStoredLocked помещает сообщение в очередь и возвращает хранимую копию
+func (qb *QueueBroker) enqueueStoredLocked(queueName string, msg *Message) (*Message, error) {
+	if IsPattern(queueName) {
+		return nil, ErrInvalidQueueName
+	}
+	if err := qb.standbyLocked(queueName); err != nil {
+		return nil, err
+	}
+	if qb.archiving[queueName] {
+		return nil, ErrQueueArchiving
+	}
+	if err := qb.validateLocked(queueName, msg); err != nil {
+		return nil, err
+	}
+
+	// Временная очередь после удаления не создается заново
+	if qb.queues[queueName] == nil && IsTemporaryQueue(queueName) {
+		return nil, ErrQueueNotFound
+	}
+	if qb.queues[queueName] == nil && queueName != CanaryQueue && qb.userQueueCountLocked() >= qb.maxQueues {
+		return nil, &CapacityError{Err: ErrTooManyQueues, Queue: queueName, Used: int64(qb.userQueueCountLocked()), Limit: int64(qb.maxQueues), Unit: "queues"}
+	}
+
+	if qb.queues[queueName] == nil {
+		if err := qb.tenantQueueQuotaLocked(queueName); err != nil {
+			return nil, err
+		}
+		qb.queues[queueName] = qb.newQueueLocked(queueName)
+		qb.index.add(queueName)
+	}
+
+	now := time.Now()
+	window := time.Duration(qb.queueConfigLocked(queueName).DedupWindow) * time.Second
+	if qb.federation != nil && window < qb.federation.dedupWindow {
+		window = qb.federation.dedupWindow
+	}
+	dedup := qb.dedup[queueName]
+	if msg.DedupID != "" && window > 0 {
+		if dedup == nil {
+			dedup = newDedupCache()
+			qb.dedup[queueName] = dedup
+		}
+		if dedup.isDuplicate(msg.DedupID, window, now) {
+			return nil, ErrDuplicate
+		}
+	}
+
+	// Заблокированные и отложенные сообщения занимают место в очереди
+	if held := qb.queues[queueName].len() + qb.inflight[queueName] + len(qb.delayed[queueName]); held >= qb.maxQueueSize {
+		return nil, &CapacityError{Err: ErrQueueFull, Queue: queueName, Used: int64(held), Limit: int64(qb.maxQueueSize), Unit: "messages"}
+	}
+
+	stored := qb.packLocked(queueName, msg)
+	if stored.ContentType == "" {
+		stored.ContentType = qb.queueConfigLocked(queueName).DefaultContentType
+	}
+	if err := qb.tenantMessageQuotaLocked(queueName, storedSize(stored)); err != nil {
+		return nil, err
+	}
+	if err := qb.reserveLocked(queueName, stored); err != nil {
+		return nil, err
+	}
+	if msg.DeliverAt.After(now) {
+		qb.scheduleLocked(queueName, stored, msg.DeliverAt)
+	} else {
+		qb.queues[queueName].push(stored)
+	}
+	if msg.DedupID != "" && window > 0 {
+		dedup.remember(msg.DedupID, window, now)
+	}
+	qb.appendLogLocked(queueName, stored, now)
+	qb.recordEnqueueLocked(queueName)
+	qb.touchLocked(queueName)
+	return stored, nil
+}
+
+// CreateQueue создает пустую очередь, если ее еще нет, с теми же
+// ограничениями, что и постановка первого сообщения: числом очередей и квотой
+// арендатора. Временная очередь так не создается: после удаления ее нет.
+func (qb *QueueBroker) CreateQueue(queueName string) error {
+	if queueName == "" || queueName == CanaryQueue || IsPattern(queueName) {
+		return ErrInvalidQueueName
+	}
+	qb.mu.Lock()
+	if qb.queues[queueName] != nil {
+		qb.mu.Unlock()
+		return nil
+	}
+	if err := qb.standbyLocked(queueName); err != nil {
+		qb.mu.Unlock()
+		return err
+	}
+	if IsTemporaryQueue(queueName) {
+		qb.mu.Unlock()
+		return ErrQueueNotFound
+	}
+	if count := qb.userQueueCountLocked(); count >= qb.maxQueues {
+		qb.mu.Unlock()
+		return &CapacityError{Err: ErrTooManyQueues, Queue: queueName, Used: int64(count), Limit: int64(qb.maxQueues), Unit: "queues"}
+	}
+	if err := qb.tenantQueueQuotaLocked(queueName); err != nil {
+		qb.mu.Unlock()
+		return err
+	}
+	qb.queues[queueName] = qb.newQueueLocked(queueName)
+	qb.index.add(queueName)
+	qb.touchLocked(queueName)
+	qb.mu.Unlock()
+
+	qb.notifyQueueListeners(QueueCreated, queueName)
+	return nil
+}
+
+// userQueueCountLocked возвращает число очередей без учета служебных
+func (qb *QueueBroker) userQueueCountLocked() int {
+	n := len(qb.queues)
+	if _, ok := qb.queues[CanaryQueue]; ok {
+		n--
+	}
+	return n
+}
+
+// QueueNames возвращает имена существующих очередей
+func (qb *QueueBroker) QueueNames() []string {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+
+	names := make([]string, 0, len(qb.queues))
+	for name := range qb.queues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// EnqueueReplicated помещает в очередь сообщение, принятое другим регионом:
+// без маршрутизации и повторной пересылки пирам, но с дедупликацией
+func (qb *QueueBroker) EnqueueReplicated(queueName string, msg *Message) error {
+	return qb.enqueueLocal(queueName, msg)
+}
+
+// MaxQueues возвращает максимальное число очередей
+func (qb *QueueBroker) MaxQueues() int {
+	return qb.maxQueues
+}
+
+// Depth возвращает число сообщений, ожидающих в очереди
+func (qb *QueueBroker) Depth(queueName string) int {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	if queue := qb.queues[queueName]; queue != nil {
+		return queue.len()
+	}
+	return 0
+}
+
+// GetMessage извлекает сообщение из очереди
+func (qb *QueueBroker) GetMessage(queueName string, timeout time.Duration) (string, error) {
+	msg, err := qb.Dequeue(queueName, timeout)
+	if err != nil {
+		return "", err
+	}
+	return msg.Body, nil
+}
+
+// Dequeue извлекает сообщение вместе с заголовками
+func (qb *QueueBroker) Dequeue(queueName string, timeout time.Duration) (*Message, error) {
+	stored, err := qb.dequeueStored(queueName, timeout)
+	if err != nil {
+		return nil, err
+	}
+	qb.mu.Lock()
+	qb.releaseLocked(stored.Queue, stored)
+	qb.mu.Unlock()
+	return qb.deliver(stored)
+}
+
+// dequeueStored извлекает сообщение в том виде, в котором оно хранится в очереди.
+// Имя может быть шаблоном (orders.*), тогда сообщение берется из любой совпадающей очереди.
+// С ненулевым timeout получатель ждет и еще не созданную очередь; ожидающие
+// получают сообщения в порядке прихода.
+func (qb *QueueBroker) dequeueStored(queueName string, timeout time.Duration) (*Message, error) {
+	if IsPattern(queueName) {
+		return qb.dequeuePattern(queueName, timeout)
+	}
+
+	// Таймер нужен, только если сообщения сразу не нашлось
+	var deadline *time.Timer
+	defer func() {
+		if deadline != nil {
+			deadline.Stop()
+		}
+	}()
+	start := time.Now()
+	wait := qb.waitLimit(timeout)
+
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	// Получатель считается подключенным, только пока ждет сообщения
+	var w *waiter
+	attached := false
+	defer func() {
+		if w != nil {
+			qb.removeWaiterLocked(queueName, w)
+		}
+		if attached {
+			qb.detachConsumerLocked(queueName)
+		}
+	}()
+	// seen очередь, которую застал получатель: если ее удалят, ожидание прекращается
+	var seen *messageQueue
+	for {
+		if w != nil {
+			w.signaled = false
+		}
+		if err := qb.standbyLocked(queueName); err != nil {
+			return nil, err
+		}
+		queue := qb.queues[queueName]
+		if queue == nil && (seen != nil || timeout <= 0) {
+			return nil, ErrQueueNotFound
+		}
+		var paused time.Duration
+		if queue != nil {
+			seen = queue
+			if qb.archiving[queueName] {
+				return nil, ErrQueueArchiving
+			}
+			paused = qb.pausedLocked(queueName, time.Now())
+			if paused == 0 && qb.availableLocked(queueName, queue) {
+				if msg := qb.popLocked(queueName, queue); msg != nil {
+					if qb.forwardToOwnerLocked(queueName, nil, msg) {
+						continue
+					}
+					qb.holdGroupLocked(queueName, msg)
+					return msg, nil
+				}
+			}
+		}
+		if timeout <= 0 {
+			return nil, ErrTimeout
+		}
+		if !attached {
+			if err := qb.attachConsumerLocked(queueName); err != nil {
+				return nil, err
+			}
+			attached = true
+		}
+		if w == nil {
+			w = qb.addWaiterLocked(queueName)
+			deadline = time.NewTimer(time.Until(start.Add(wait)))
+		}
+		qb.mu.Unlock()
+
+		resume, stop := resumeTimer(paused)
+		expired := false
+		select {
+		case <-w.ready:
+		case <-resume:
+		case <-deadline.C:
+			expired = true
+		}
+		stop()
+		qb.mu.Lock()
+		if expired {
+			if qb.queues[queueName] == nil {
+				return nil, ErrQueueNotFound
+			}
+			return nil, ErrTimeout
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package broker
+
+import (
+	"errors"
+	"testing"
+)
+
+// BenchmarkPutMessage измеряет постановку сообщений в очередь
+func BenchmarkPutMessage(b *testing.B) {
+	qb := NewQueueBroker(b.N+1, 10, 0)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := qb.PutMessage("bench", "payload"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkGetMessage измеряет извлечение сообщений из очереди
+func BenchmarkGetMessage(b *testing.B) {
+	qb := NewQueueBroker(b.N+1, 10, 0)
+	for i := 0; i < b.N; i++ {
+		qb.PutMessage("bench", "payload")
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := qb.GetMessage("bench", 0); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkPutGetParallel измеряет постановку и извлечение из нескольких горутин
+func BenchmarkPutGetParallel(b *testing.B) {
+	qb := NewQueueBroker(1000, 100, 0)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		// Каждое извлечение следует за своей постановкой, поэтому очередь не пуста
+		for pb.Next() {
+			if err := qb.PutMessage("bench", "payload"); err != nil {
+				b.Fatal(err)
+			}
+			if _, err := qb.GetMessage("bench", 0); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// TestCreateQueue проверяет создание пустой очереди и его ограничения
+func TestCreateQueue(t *testing.T) {
+	qb := NewQueueBroker(10, 1, 0)
+	var created []string
+	qb.AddQueueListener(func(event QueueEvent, queueName string) { created = append(created, queueName) })
+
+	if err := qb.CreateQueue("jobs"); err != nil {
+		t.Fatal(err)
+	}
+	// Повторное создание существующей очереди не ошибка
+	if err := qb.CreateQueue("jobs"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := qb.Dequeue("jobs", 0); !errors.Is(err, ErrTimeout) {
+		t.Errorf("expected empty queue, got %v", err)
+	}
+	if len(created) != 1 || created[0] != "jobs" {
+		t.Errorf("unexpected queue events %v", created)
+	}
+	if err := qb.CreateQueue("other"); !errors.Is(err, ErrTooManyQueues) {
+		t.Errorf("expected ErrTooManyQueues, got %v", err)
+	}
+	for _, name := range []string{"", "jobs.*", CanaryQueue} {
+		if err := qb.CreateQueue(name); !errors.Is(err, ErrInvalidQueueName) {
+			t.Errorf("%q: expected ErrInvalidQueueName, got %v", name, err)
+		}
+	}
+}
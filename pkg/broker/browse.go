@@ -0,0 +1,50 @@
+package broker
+
+import "time"
+
+// BrowsedMessage ожидающее сообщение очереди, просматриваемое без извлечения
+type BrowsedMessage struct {
+	ID uint64 `json:"id"`
+	*Message
+	// Position порядковый номер в очереди (с 1): первым будет выдано сообщение 1
+	Position   int       `json:"position"`
+	EnqueuedAt time.Time `json:"enqueued_at"`
+}
+
+// Browse возвращает limit ожидающих сообщений очереди начиная с offset (в
+// порядке выдачи) и общее число ожидающих сообщений. Сообщения не извлекаются
+// и не блокируются; выданные, но не подтвержденные, и отложенные сообщения не
+// входят в выборку. Тела возвращаются в исходном виде.
+func (qb *QueueBroker) Browse(queueName string, offset, limit int) ([]BrowsedMessage, int, error) {
+	qb.mu.Lock()
+	queue := qb.queues[queueName]
+	if queue == nil {
+		qb.mu.Unlock()
+		return nil, 0, ErrQueueNotFound
+	}
+	total := queue.len()
+	var page []*Message
+	if offset < total {
+		// Копии: хранимые сообщения могут быть выданы, пока выборка кодируется
+		for _, stored := range queue.messages[offset:min(offset+limit, total)] {
+			c := *stored
+			page = append(page, &c)
+		}
+	}
+	qb.mu.Unlock()
+
+	browsed := make([]BrowsedMessage, 0, len(page))
+	for i, stored := range page {
+		msg, err := qb.unpack(stored)
+		if err != nil {
+			return nil, 0, err
+		}
+		browsed = append(browsed, BrowsedMessage{
+			ID:         stored.id,
+			Message:    msg,
+			Position:   offset + i + 1,
+			EnqueuedAt: stored.enqueuedAt,
+		})
+	}
+	return browsed, total, nil
+}
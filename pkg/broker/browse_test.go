@@ -0,0 +1,41 @@
+package broker
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestBrowse проверяет постраничный просмотр ожидающих сообщений без извлечения
+func TestBrowse(t *testing.T) {
+	qb := NewQueueBroker(10, 10, 1)
+	qb.SetDefaultCompressThreshold(1)
+	before := time.Now()
+	for _, body := range []string{"m1", "m2", "m3", "m4"} {
+		qb.Enqueue("jobs", &Message{Body: body})
+	}
+	if _, err := qb.PeekLock("jobs", 0, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	page, total, err := qb.Browse("jobs", 1, 5)
+	if err != nil || total != 3 || len(page) != 2 {
+		t.Fatalf("Browse() = %+v, %d, %v", page, total, err)
+	}
+	if page[0].Body != "m3" || page[0].Position != 2 || page[1].Body != "m4" || page[1].Position != 3 {
+		t.Errorf("unexpected page: %+v", page)
+	}
+	if page[0].ID == 0 || page[0].ID == page[1].ID || page[0].EnqueuedAt.Before(before) {
+		t.Errorf("unexpected id or timestamp: %+v", page[0])
+	}
+	if qb.Depth("jobs") != 3 {
+		t.Errorf("browse consumed messages: depth %d", qb.Depth("jobs"))
+	}
+
+	if page, total, _ := qb.Browse("jobs", 10, 5); len(page) != 0 || total != 3 {
+		t.Errorf("expected empty page past the end, got %+v", page)
+	}
+	if _, _, err := qb.Browse("missing", 0, 5); !errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("expected ErrQueueNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,258 @@
+package broker
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// EnvelopeCelery режим очереди (QueueConfig.Envelope), в котором сообщения
+// хранятся как задачи Celery и выдаются в конверте протокола Celery v2
+const EnvelopeCelery = "celery"
+
+// CeleryTask задача Celery в том виде, в каком она хранится в очереди
+// в режиме EnvelopeCelery
+type CeleryTask struct {
+	// Task имя задачи, например tasks.add
+	Task string `json:"task"`
+	// ID идентификатор задачи; пустой при постановке — генерируется
+	ID     string         `json:"id"`
+	Args   []any          `json:"args"`
+	Kwargs map[string]any `json:"kwargs"`
+	// ETA время, раньше которого задачу выполнять нельзя
+	ETA *time.Time `json:"eta,omitempty"`
+	// Expires время, после которого задача не выполняется
+	Expires  *time.Time `json:"expires,omitempty"`
+	Retries  int        `json:"retries,omitempty"`
+	RootID   string     `json:"root_id,omitempty"`
+	ParentID string     `json:"parent_id,omitempty"`
+	Group    string     `json:"group,omitempty"`
+}
+
+// celeryEnvelope конверт сообщения kombu, в котором Celery передает задачу
+type celeryEnvelope struct {
+	Body            string           `json:"body"`
+	ContentEncoding string           `json:"content-encoding"`
+	ContentType     string           `json:"content-type"`
+	Headers         celeryHeaders    `json:"headers"`
+	Properties      celeryProperties `json:"properties"`
+}
+
+// celeryHeaders заголовки задачи протокола v2
+type celeryHeaders struct {
+	Lang         string     `json:"lang"`
+	Task         string     `json:"task"`
+	ID           string     `json:"id"`
+	Shadow       *string    `json:"shadow"`
+	ETA          *time.Time `json:"eta"`
+	Expires      *time.Time `json:"expires"`
+	Group        *string    `json:"group"`
+	GroupIndex   *int       `json:"group_index"`
+	Retries      int        `json:"retries"`
+	TimeLimit    [2]*int    `json:"timelimit"`
+	RootID       string     `json:"root_id"`
+	ParentID     *string    `json:"parent_id"`
+	ArgsRepr     string     `json:"argsrepr,omitempty"`
+	KwargsRepr   string     `json:"kwargsrepr,omitempty"`
+	Origin       string     `json:"origin,omitempty"`
+	IgnoreResult bool       `json:"ignore_result"`
+}
+
+type celeryProperties struct {
+	CorrelationID string             `json:"correlation_id"`
+	ReplyTo       string             `json:"reply_to,omitempty"`
+	DeliveryMode  int                `json:"delivery_mode"`
+	DeliveryInfo  celeryDeliveryInfo `json:"delivery_info"`
+	Priority      int                `json:"priority"`
+	BodyEncoding  string             `json:"body_encoding"`
+	DeliveryTag   string             `json:"delivery_tag"`
+}
+
+type celeryDeliveryInfo struct {
+	Exchange   string `json:"exchange"`
+	RoutingKey string `json:"routing_key"`
+}
+
+// celeryEmbed третий элемент тела задачи: связанные задачи
+type celeryEmbed struct {
+	Callbacks any `json:"callbacks"`
+	Errbacks  any `json:"errbacks"`
+	Chain     any `json:"chain"`
+	Chord     any `json:"chord"`
+}
+
+// UnwrapCelery извлекает задачу из конверта Celery v2 (JSON или JSON в base64,
+// как его передает транспорт SQS kombu)
+func UnwrapCelery(body string) (CeleryTask, error) {
+	data := []byte(body)
+	if decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(body)); err == nil {
+		data = decoded
+	}
+	var env celeryEnvelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return CeleryTask{}, fmt.Errorf("%w: %v", ErrInvalidCeleryTask, err)
+	}
+	if env.Headers.Task == "" {
+		return CeleryTask{}, fmt.Errorf("%w: only protocol v2 messages with headers.task are supported", ErrInvalidCeleryTask)
+	}
+	if env.ContentType != "" && env.ContentType != "application/json" {
+		return CeleryTask{}, fmt.Errorf("%w: unsupported content type %q", ErrInvalidCeleryTask, env.ContentType)
+	}
+	payload := []byte(env.Body)
+	if env.Properties.BodyEncoding == "base64" {
+		var err error
+		if payload, err = base64.StdEncoding.DecodeString(env.Body); err != nil {
+			return CeleryTask{}, fmt.Errorf("%w: invalid base64 body", ErrInvalidCeleryTask)
+		}
+	}
+	var parts []json.RawMessage
+	if err := json.Unmarshal(payload, &parts); err != nil || len(parts) == 0 {
+		return CeleryTask{}, fmt.Errorf("%w: body must be [args, kwargs, embed]", ErrInvalidCeleryTask)
+	}
+	task := CeleryTask{
+		Task:    env.Headers.Task,
+		ID:      env.Headers.ID,
+		ETA:     env.Headers.ETA,
+		Expires: env.Headers.Expires,
+		Retries: env.Headers.Retries,
+		RootID:  env.Headers.RootID,
+	}
+	if env.Headers.ParentID != nil {
+		task.ParentID = *env.Headers.ParentID
+	}
+	if env.Headers.Group != nil {
+		task.Group = *env.Headers.Group
+	}
+	if err := json.Unmarshal(parts[0], &task.Args); err != nil {
+		return CeleryTask{}, fmt.Errorf("%w: args must be an array", ErrInvalidCeleryTask)
+	}
+	if len(parts) > 1 {
+		if err := json.Unmarshal(parts[1], &task.Kwargs); err != nil {
+			return CeleryTask{}, fmt.Errorf("%w: kwargs must be an object", ErrInvalidCeleryTask)
+		}
+	}
+	return task, nil
+}
+
+// WrapCelery собирает конверт Celery v2 для задачи; routingKey — очередь,
+// из которой выдается задача
+func WrapCelery(task CeleryTask, routingKey string) (string, error) {
+	args, kwargs := task.Args, task.Kwargs
+	if args == nil {
+		args = []any{}
+	}
+	if kwargs == nil {
+		kwargs = map[string]any{}
+	}
+	payload, err := json.Marshal([]any{args, kwargs, celeryEmbed{}})
+	if err != nil {
+		return "", err
+	}
+	rootID := task.RootID
+	if rootID == "" {
+		rootID = task.ID
+	}
+	env := celeryEnvelope{
+		Body:            base64.StdEncoding.EncodeToString(payload),
+		ContentEncoding: "utf-8",
+		ContentType:     "application/json",
+		Headers: celeryHeaders{
+			Lang:    "py",
+			Task:    task.Task,
+			ID:      task.ID,
+			ETA:     task.ETA,
+			Expires: task.Expires,
+			Retries: task.Retries,
+			RootID:  rootID,
+		},
+		Properties: celeryProperties{
+			CorrelationID: task.ID,
+			DeliveryMode:  2,
+			DeliveryInfo:  celeryDeliveryInfo{RoutingKey: routingKey},
+			BodyEncoding:  "base64",
+			DeliveryTag:   newToken(),
+		},
+	}
+	if task.ParentID != "" {
+		env.Headers.ParentID = &task.ParentID
+	}
+	if task.Group != "" {
+		env.Headers.Group = &task.Group
+	}
+	data, err := json.Marshal(env)
+	return string(data), err
+}
+
+// celeryEnqueue приводит сообщение для очереди в режиме EnvelopeCelery к
+// хранимой задаче: тело — конверт Celery или задача CeleryTask в JSON.
+// Задача с ETA в будущем откладывается до этого времени.
+func (qb *QueueBroker) celeryEnqueue(queueName string, msg *Message) error {
+	qb.mu.Lock()
+	envelope := qb.queueConfigLocked(queueName).Envelope
+	qb.mu.Unlock()
+	if envelope != EnvelopeCelery {
+		return nil
+	}
+
+	var task CeleryTask
+	if json.Unmarshal([]byte(msg.Body), &task) != nil || task.Task == "" {
+		var err error
+		if task, err = UnwrapCelery(msg.Body); err != nil {
+			return err
+		}
+	}
+	if task.ID == "" {
+		task.ID = newUUID()
+	}
+	data, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	msg.Body, msg.ContentType = string(data), "application/json"
+	if task.ETA != nil && task.ETA.After(time.Now()) && msg.DeliverAt.IsZero() {
+		msg.DeliverAt = *task.ETA
+	}
+	return nil
+}
+
+// celeryDeliver заворачивает выдаваемую задачу очереди в режиме
+// EnvelopeCelery в конверт; сообщения, не являющиеся задачей, не меняются
+func (qb *QueueBroker) celeryDeliver(msg *Message) *Message {
+	qb.mu.Lock()
+	envelope := qb.queueConfigLocked(msg.Queue).Envelope
+	qb.mu.Unlock()
+	if envelope != EnvelopeCelery {
+		return msg
+	}
+	var task CeleryTask
+	if json.Unmarshal([]byte(msg.Body), &task) != nil || task.Task == "" {
+		return msg
+	}
+	body, err := WrapCelery(task, msg.Queue)
+	if err != nil {
+		return msg
+	}
+	wrapped := *msg
+	wrapped.Body = body
+	return &wrapped
+}
+
+// ValidateEnvelope проверяет режим конверта очереди (QueueConfig.Envelope)
+func ValidateEnvelope(envelope string) error {
+	if envelope != "" && envelope != EnvelopeCelery {
+		return fmt.Errorf("unknown envelope %q", envelope)
+	}
+	return nil
+}
+
+// newUUID случайный идентификатор в формате UUID версии 4, как у задач Celery
+func newUUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
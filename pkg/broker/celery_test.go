@@ -0,0 +1,110 @@
+package broker
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// celeryMessage конверт, который отправляет Celery 5 для tasks.add.delay(2, 3)
+const celeryMessage = `{"body": "W1syLCAzXSwge30sIHsiY2FsbGJhY2tzIjogbnVsbCwgImVycmJhY2tzIjogbnVsbCwgImNoYWluIjogbnVsbCwgImNob3JkIjogbnVsbH1d",
+ "content-encoding": "utf-8", "content-type": "application/json",
+ "headers": {"lang": "py", "task": "tasks.add", "id": "5f0c1b3e-7d1a-4c47-9d35-1b0f5e7c2a11", "shadow": null, "eta": null,
+  "expires": null, "group": null, "group_index": null, "retries": 0, "timelimit": [null, null],
+  "root_id": "5f0c1b3e-7d1a-4c47-9d35-1b0f5e7c2a11", "parent_id": null, "argsrepr": "(2, 3)", "kwargsrepr": "{}",
+  "origin": "gen1@host", "ignore_result": false},
+ "properties": {"correlation_id": "5f0c1b3e-7d1a-4c47-9d35-1b0f5e7c2a11", "reply_to": "b3c1", "delivery_mode": 2,
+  "delivery_info": {"exchange": "", "routing_key": "celery"}, "priority": 0, "body_encoding": "base64",
+  "delivery_tag": "f1e2"}}`
+
+// TestUnwrapCelery проверяет разбор конверта Celery в JSON и base64 и отказ на неверных задачах
+func TestUnwrapCelery(t *testing.T) {
+	for name, body := range map[string]string{
+		"json":   celeryMessage,
+		"base64": base64.StdEncoding.EncodeToString([]byte(celeryMessage)),
+	} {
+		task, err := UnwrapCelery(body)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if task.Task != "tasks.add" || task.ID != "5f0c1b3e-7d1a-4c47-9d35-1b0f5e7c2a11" || !reflect.DeepEqual(task.Args, []any{2.0, 3.0}) || len(task.Kwargs) != 0 {
+			t.Errorf("%s: unexpected task %+v", name, task)
+		}
+	}
+
+	for _, body := range []string{`not json`, `{"body": "W10=", "headers": {}}`, `{"body": "e30=", "headers": {"task": "t"}, "properties": {"body_encoding": "base64"}}`} {
+		if _, err := UnwrapCelery(body); !errors.Is(err, ErrInvalidCeleryTask) {
+			t.Errorf("%q: expected ErrInvalidCeleryTask, got %v", body, err)
+		}
+	}
+}
+
+// TestWrapCeleryRoundTrip проверяет, что задача переживает упаковку в конверт и разбор
+func TestWrapCeleryRoundTrip(t *testing.T) {
+	eta := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	task := CeleryTask{Task: "tasks.mul", ID: "id-1", Args: []any{"a"}, Kwargs: map[string]any{"x": 1.0}, ETA: &eta, ParentID: "p"}
+	body, err := WrapCelery(task, "work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var env map[string]any
+	if err := json.Unmarshal([]byte(body), &env); err != nil {
+		t.Fatal(err)
+	}
+	if env["properties"].(map[string]any)["delivery_info"].(map[string]any)["routing_key"] != "work" {
+		t.Errorf("unexpected envelope %s", body)
+	}
+	got, err := UnwrapCelery(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	task.RootID = "id-1"
+	if !reflect.DeepEqual(got, task) {
+		t.Errorf("round trip mismatch:\n got %+v\nwant %+v", got, task)
+	}
+}
+
+// TestCeleryQueue проверяет хранение задач в очереди с envelope=celery и выдачу конвертов
+func TestCeleryQueue(t *testing.T) {
+	qb := NewQueueBroker(10, 10, 1)
+	cfg := qb.QueueConfig("work")
+	cfg.Envelope = EnvelopeCelery
+	qb.SetQueueConfig("work", cfg)
+
+	if err := qb.Enqueue("work", &Message{Body: `{"task": "tasks.add", "args": [1, 2]}`}); err != nil {
+		t.Fatal(err)
+	}
+	if err := qb.Enqueue("work", &Message{Body: celeryMessage}); err != nil {
+		t.Fatal(err)
+	}
+	if err := qb.Enqueue("work", &Message{Body: `{"hello": "world"}`}); !errors.Is(err, ErrInvalidCeleryTask) {
+		t.Errorf("expected ErrInvalidCeleryTask, got %v", err)
+	}
+
+	// В очереди хранится задача, потребитель получает конверт
+	browsed, _, err := qb.Browse("work", 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored CeleryTask
+	if err := json.Unmarshal([]byte(browsed[1].Body), &stored); err != nil || stored.Task != "tasks.add" || stored.ID == "" {
+		t.Errorf("unexpected stored task %q", browsed[1].Body)
+	}
+
+	for _, want := range []string{"", "5f0c1b3e-7d1a-4c47-9d35-1b0f5e7c2a11"} {
+		msg, err := qb.Dequeue("work", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		task, err := UnwrapCelery(msg.Body)
+		if err != nil {
+			t.Fatalf("delivered message is not an envelope: %v", err)
+		}
+		if task.Task != "tasks.add" || want != "" && task.ID != want || task.ID == "" {
+			t.Errorf("unexpected delivered task %+v", task)
+		}
+	}
+}
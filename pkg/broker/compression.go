@@ -0,0 +1,176 @@
+package broker
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/cipher"
+	"fmt"
+	"io"
+)
+
+// Алгоритмы сжатия тел сообщений при хранении
+const (
+	CompressionGzip   = "gzip"
+	CompressionSnappy = "snappy"
+	// CompressionNone отключает сжатие для очереди при включенном по умолчанию
+	CompressionNone = "none"
+)
+
+// ValidCompression сообщает, поддерживается ли алгоритм сжатия; пустое
+// значение означает алгоритм по умолчанию
+func ValidCompression(algorithm string) bool {
+	switch algorithm {
+	case "", CompressionGzip, CompressionSnappy, CompressionNone:
+		return true
+	}
+	return false
+}
+
+// SetDefaultCompressThreshold задает размер тела в байтах, начиная с которого
+// сообщения хранятся сжатыми (0 — не сжимать)
+func (qb *QueueBroker) SetDefaultCompressThreshold(threshold int) {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	qb.defaultCompressThreshold = threshold
+}
+
+// SetDefaultCompression задает алгоритм сжатия для очередей, в настройках
+// которых он не указан (по умолчанию gzip)
+func (qb *QueueBroker) SetDefaultCompression(algorithm string) error {
+	if !ValidCompression(algorithm) {
+		return fmt.Errorf("unknown compression algorithm %q", algorithm)
+	}
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	qb.defaultCompression = algorithm
+	return nil
+}
+
+// compressionLocked возвращает алгоритм сжатия очереди; пусто — не сжимать
+func (qb *QueueBroker) compressionLocked(cfg QueueConfig) string {
+	algorithm := cfg.Compression
+	if algorithm == "" {
+		algorithm = qb.defaultCompression
+	}
+	switch algorithm {
+	case CompressionNone:
+		return ""
+	case "":
+		return CompressionGzip
+	}
+	return algorithm
+}
+
+func compressBody(algorithm string, body []byte) ([]byte, error) {
+	switch algorithm {
+	case CompressionGzip:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write(body)
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case CompressionSnappy:
+		return snappyEncode(body), nil
+	}
+	return nil, fmt.Errorf("unknown compression algorithm %q", algorithm)
+}
+
+func decompressBody(algorithm string, body []byte) ([]byte, error) {
+	switch algorithm {
+	case CompressionGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(zr)
+	case CompressionSnappy:
+		return snappyDecode(body)
+	}
+	return nil, fmt.Errorf("unknown compression algorithm %q", algorithm)
+}
+
+// packLocked возвращает копию сообщения в том виде, в котором она хранится
+// в очереди queueName: тело больше порога сжимается алгоритмом очереди, если
+// это дает выигрыш, а затем шифруется ключом арендатора или, если задан
+// набор ключей, текущим ключом брокера
+func (qb *QueueBroker) packLocked(queueName string, msg *Message) *Message {
+	stored := *msg
+	stored.Queue = queueName
+	if msg.compression != "" || msg.encrypted || msg.keyID != "" {
+		return &stored
+	}
+
+	cfg := qb.queueConfigLocked(queueName)
+	algorithm := qb.compressionLocked(cfg)
+	if algorithm != "" && cfg.CompressThreshold > 0 && len(msg.Body) > cfg.CompressThreshold {
+		if body, err := compressBody(algorithm, []byte(msg.Body)); err == nil && len(body) < len(msg.Body) {
+			stored.Body = string(body)
+			stored.compression = algorithm
+		}
+	}
+
+	if aead := qb.tenantCipherLocked(queueName); aead != nil {
+		stored.Body = string(seal(aead, TenantOf(queueName), []byte(stored.Body)))
+		stored.encrypted = true
+	} else if qb.keys != nil {
+		stored.Body = string(seal(qb.keys.aeads[qb.keys.current], keyAAD(qb.keys.current), []byte(stored.Body)))
+		stored.keyID = qb.keys.current
+	}
+	return &stored
+}
+
+// unpack восстанавливает исходное тело хранимого сообщения
+func (qb *QueueBroker) unpack(stored *Message) (*Message, error) {
+	if !stored.encrypted && stored.keyID == "" {
+		return unpackWith(stored, nil)
+	}
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	return qb.unpackLocked(stored)
+}
+
+// unpackLocked то же, что unpack, под qb.mu
+func (qb *QueueBroker) unpackLocked(stored *Message) (*Message, error) {
+	if stored.keyID != "" {
+		return unpackWith(stored, qb.keys.aead(stored.keyID))
+	}
+	return unpackWith(stored, qb.tenantCipherLocked(stored.Queue))
+}
+
+// unpackWith восстанавливает тело; aead — ключ, которым оно зашифровано
+func unpackWith(stored *Message, aead cipher.AEAD) (*Message, error) {
+	if stored.compression == "" && !stored.encrypted && stored.keyID == "" {
+		return stored, nil
+	}
+
+	body := []byte(stored.Body)
+	if stored.encrypted || stored.keyID != "" {
+		if aead == nil {
+			return nil, fmt.Errorf("decrypt message: no key for queue %s", stored.Queue)
+		}
+		aad := TenantOf(stored.Queue)
+		if stored.keyID != "" {
+			aad = keyAAD(stored.keyID)
+		}
+		var err error
+		if body, err = open(aead, aad, body); err != nil {
+			return nil, err
+		}
+	}
+
+	if stored.compression != "" {
+		var err error
+		if body, err = decompressBody(stored.compression, body); err != nil {
+			return nil, fmt.Errorf("decompress message: %w", err)
+		}
+	}
+
+	msg := *stored
+	msg.Body = string(body)
+	msg.compression = ""
+	msg.encrypted = false
+	msg.keyID = ""
+	return &msg, nil
+}
@@ -0,0 +1,100 @@
+package broker
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCompressionThreshold проверяет сжатие крупных сообщений при хранении
+func TestCompressionThreshold(t *testing.T) {
+	qb := NewQueueBroker(100, 10, 10)
+	qb.SetDefaultCompressThreshold(1024)
+
+	large := strings.Repeat("highly compressible payload ", 1000)
+	qb.PutMessage("docs", large)
+	qb.PutMessage("docs", "small")
+
+	stored := qb.queues["docs"].messages
+	if stored[0].compression != CompressionGzip || len(stored[0].Body) >= len(large) {
+		t.Fatalf("large message was not compressed: %d bytes", len(stored[0].Body))
+	}
+	if stored[1].compression != "" {
+		t.Errorf("small message must be stored as is")
+	}
+
+	for _, want := range []string{large, "small"} {
+		message, err := qb.GetMessage("docs", time.Second)
+		if err != nil || message != want {
+			t.Errorf("got %d bytes (%v) want %d bytes", len(message), err, len(want))
+		}
+	}
+}
+
+// TestCompressionPeekLockRedelivery проверяет распаковку при повторной доставке
+func TestCompressionPeekLockRedelivery(t *testing.T) {
+	qb := NewQueueBroker(100, 10, 10)
+	qb.SetQueueConfig("docs", QueueConfig{LockDuration: 1, CompressThreshold: 16})
+
+	large := strings.Repeat("a", 4096)
+	qb.PutMessage("docs", large)
+
+	delivery, err := qb.PeekLock("docs", time.Second, 0)
+	if err != nil || delivery.Body != large {
+		t.Fatalf("unexpected delivery: %v", err)
+	}
+	qb.expireLock(delivery.LockToken)
+
+	message, err := qb.GetMessage("docs", time.Second)
+	if err != nil || message != large {
+		t.Errorf("redelivered message was not decompressed: %d bytes (%v)", len(message), err)
+	}
+}
+
+// TestPeekLockDeliverFailure проверяет, что сообщение, которое не удалось
+// распаковать при выдаче в режиме peek-lock, не теряется, а возвращается в
+// очередь по истечении блокировки
+func TestPeekLockDeliverFailure(t *testing.T) {
+	qb := NewQueueBroker(100, 10, 10)
+	qb.ApplyReplication(ReplicationOp{Op: ReplicationPut, Queue: "docs", ID: 1, Message: &ReplicatedMessage{Body: []byte("not gzip"), Compression: CompressionGzip}})
+
+	if _, err := qb.PeekLock("docs", 0, 50*time.Millisecond); err == nil {
+		t.Fatal("corrupted message delivered")
+	}
+	if info := qb.Queues(); len(info) != 1 || info[0].InFlight != 1 {
+		t.Fatalf("message not locked after a failed delivery: %+v", info)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for qb.Depth("docs") != 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if info := qb.Queues(); info[0].Depth != 1 || info[0].InFlight != 0 || qb.TotalBytes() == 0 {
+		t.Errorf("message not returned after the lock expired: %+v", info)
+	}
+}
+
+// TestCompressionAlgorithm проверяет алгоритм по умолчанию и его переопределение
+// в настройках очереди
+func TestCompressionAlgorithm(t *testing.T) {
+	qb := NewQueueBroker(100, 10, 10)
+	qb.SetDefaultCompressThreshold(64)
+	if err := qb.SetDefaultCompression("zstd"); err == nil {
+		t.Fatal("unknown algorithm was accepted")
+	}
+	if err := qb.SetDefaultCompression(CompressionSnappy); err != nil {
+		t.Fatal(err)
+	}
+	qb.SetQueueConfig("gzipped", QueueConfig{LockDuration: 30, CompressThreshold: 64, Compression: CompressionGzip})
+	qb.SetQueueConfig("plain", QueueConfig{LockDuration: 30, CompressThreshold: 64, Compression: CompressionNone})
+
+	large := strings.Repeat("highly compressible payload ", 100)
+	for queue, want := range map[string]string{"docs": CompressionSnappy, "gzipped": CompressionGzip, "plain": ""} {
+		qb.PutMessage(queue, large)
+		if got := qb.queues[queue].messages[0].compression; got != want {
+			t.Errorf("%s: expected compression %q, got %q", queue, want, got)
+		}
+		if message, err := qb.GetMessage(queue, time.Second); err != nil || message != large {
+			t.Errorf("%s: got %d bytes (%v)", queue, len(message), err)
+		}
+	}
+}
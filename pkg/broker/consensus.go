@@ -0,0 +1,423 @@
+package broker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"queue-broker/pkg/raft"
+	"queue-broker/pkg/rpc"
+)
+
+// Кластерный режим на Raft: все узлы кластера хранят одни и те же очереди.
+// Клиентов обслуживает лидер: операции выполняются на нем как обычно, а
+// изменения хранимых сообщений (те же операции, что получают ведомые
+// горячего резерва, см. Replicate) пачками записываются в журнал Raft, и
+// постановка завершается, когда ее операции зафиксированы большинством
+// узлов. Остальные узлы применяют зафиксированные операции и, как брокер
+// в режиме резерва, клиентов не обслуживают.
+//
+// Лидер выполняет операции раньше их фиксации, поэтому его очереди могут
+// опережать журнал. Каждый узел отдельно хранит зафиксированное состояние
+// (committedState): из него строятся снимки журнала, и им узел, переставший
+// быть лидером, заменяет свои очереди, отбрасывая незафиксированные
+// изменения. Блокировки peek-lock, как и в режиме резерва, не передаются:
+// после смены лидера неподтвержденные сообщения доставляются повторно.
+
+const (
+	// consensusCommitTimeout сколько постановка ждет фиксации своих операций
+	consensusCommitTimeout = 10 * time.Second
+	// consensusBatchOps сколько операций записывается в журнал одной записью
+	consensusBatchOps = 1024
+	// consensusRetryDelay пауза перед повторной записью после ошибки журнала
+	consensusRetryDelay = 100 * time.Millisecond
+)
+
+// Consensus узел кластера Raft, на котором работает брокер
+type Consensus struct {
+	qb   *QueueBroker
+	node *raft.Node
+	// committed зафиксированное состояние; меняется только при применении
+	// записей журнала
+	committed *committedState
+
+	// Поля ниже защищены qb.mu
+	// leading узел — лидер срока term и обслуживает клиентов
+	leading bool
+	term    uint64
+	// feed операции брокера, которые лидер записывает в журнал
+	feed *ReplicationFeed
+	// commits запросы фиксации: в канал передается результат после фиксации
+	// всех операций, переданных журналу до запроса
+	commits chan chan error
+	// stop закрывается, когда узел перестает быть лидером
+	stop chan struct{}
+}
+
+// StartConsensus включает кластерный режим: брокер становится узлом Raft с
+// настройками cfg и до избрания лидером не обслуживает клиентов. Сообщения,
+// уже находящиеся в очередях, заменяются зафиксированным состоянием
+// кластера из каталога cfg.Dir.
+func (qb *QueueBroker) StartConsensus(cfg raft.Config) (*Consensus, error) {
+	c := &Consensus{qb: qb, committed: newCommittedState()}
+	qb.mu.Lock()
+	if qb.follower != nil || qb.consensus != nil {
+		qb.mu.Unlock()
+		return nil, errors.New("broker is already a standby or a cluster node")
+	}
+	qb.consensus = c
+	qb.mu.Unlock()
+
+	node, err := raft.New(cfg, c)
+	if err != nil {
+		qb.mu.Lock()
+		qb.consensus = nil
+		qb.mu.Unlock()
+		return nil, err
+	}
+	c.node = node
+	qb.mu.Lock()
+	c.rebuildLocked()
+	qb.mu.Unlock()
+	node.Start()
+	return c, nil
+}
+
+// Handler обслуживает запросы других узлов кластера (пути /raft/...)
+func (c *Consensus) Handler() http.Handler {
+	return c.node.Handler()
+}
+
+// Self возвращает адрес этого узла
+func (c *Consensus) Self() string {
+	return c.node.ID()
+}
+
+// Leader возвращает адрес лидера кластера ("" — лидер неизвестен)
+func (c *Consensus) Leader() string {
+	return c.node.Leader()
+}
+
+// Leading сообщает, обслуживает ли узел клиентов как лидер
+func (c *Consensus) Leading() bool {
+	c.qb.mu.Lock()
+	defer c.qb.mu.Unlock()
+	return c.leading
+}
+
+// Close останавливает узел; брокер остается в режиме резерва
+func (c *Consensus) Close() {
+	c.node.Close()
+	qb := c.qb
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	if c.leading {
+		c.leading = false
+		close(c.stop)
+		c.feed.closeLocked()
+	}
+}
+
+// health состояние узла кластера
+func (c *Consensus) health() SubsystemHealth {
+	status := c.node.Status()
+	h := SubsystemHealth{Status: HealthOK, Detail: status}
+	if status.Leader == "" {
+		h.Status = HealthDegraded
+	}
+	return h
+}
+
+// commit ждет фиксации в журнале всех операций, выполненных лидером до вызова
+func (c *Consensus) commit() error {
+	qb := c.qb
+	qb.mu.Lock()
+	leading, commits, stop := c.leading, c.commits, c.stop
+	qb.mu.Unlock()
+	if !leading {
+		return fmt.Errorf("%w: %v", ErrNotCommitted, raft.ErrLeadershipLost)
+	}
+	done := make(chan error, 1)
+	select {
+	case commits <- done:
+	case <-stop:
+		return fmt.Errorf("%w: %v", ErrNotCommitted, raft.ErrLeadershipLost)
+	}
+	if err := <-done; err != nil {
+		return fmt.Errorf("%w: %v", ErrNotCommitted, err)
+	}
+	return nil
+}
+
+// replicate записывает операции брокера в журнал, пока узел остается лидером
+// срока term. Операции и запросы фиксации, накопившиеся за время записи
+// предыдущей пачки, записываются одной записью журнала.
+func (c *Consensus) replicate(term uint64, feed *ReplicationFeed, commits chan chan error, stop chan struct{}) {
+	var last uint64
+	for {
+		var batch []ReplicationOp
+		var waiting []chan error
+		lost := false
+		select {
+		case op, ok := <-feed.Ops:
+			if ok {
+				batch = append(batch, op)
+			}
+			lost = !ok
+		case done := <-commits:
+			waiting = append(waiting, done)
+		case <-stop:
+			return
+		}
+	drain:
+		for !lost && len(batch) < consensusBatchOps {
+			select {
+			case op, ok := <-feed.Ops:
+				if ok {
+					batch = append(batch, op)
+				}
+				lost = !ok
+			case done := <-commits:
+				waiting = append(waiting, done)
+			default:
+				break drain
+			}
+		}
+		if lost {
+			// Журнал отстал от брокера больше чем на буфер операций или не
+			// принял пачку: лидер записывает в него свое состояние целиком
+			if feed = c.resubscribe(term); feed == nil {
+				reply(waiting, raft.ErrLeadershipLost)
+				return
+			}
+			batch = feed.Initial
+		}
+		if len(batch) > 0 {
+			index, err := c.node.Propose(encodeOps(batch), term)
+			if err != nil {
+				reply(waiting, err)
+				// Переставший быть лидером узел скоро отбросит невыполненные
+				// операции; при ошибке записи журнала пачка повторяется вместе
+				// со всем состоянием
+				if errors.Is(err, raft.ErrNotLeader) || errors.Is(err, raft.ErrStopped) {
+					return
+				}
+				log.Printf("raft: propose: %v", err)
+				feed.Close()
+				time.Sleep(consensusRetryDelay)
+				continue
+			}
+			last = index
+		}
+		if len(waiting) > 0 {
+			go func(index uint64) {
+				ctx, cancel := context.WithTimeout(context.Background(), consensusCommitTimeout)
+				defer cancel()
+				reply(waiting, c.node.Wait(ctx, index, term))
+			}(last)
+		}
+	}
+}
+
+// resubscribe подключает новый поток операций с текущим состоянием брокера;
+// nil — узел больше не лидер срока term
+func (c *Consensus) resubscribe(term uint64) *ReplicationFeed {
+	feed := c.qb.replicate(true)
+	qb := c.qb
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	if !c.leading || c.term != term {
+		feed.closeLocked()
+		return nil
+	}
+	c.feed = feed
+	return feed
+}
+
+func reply(waiting []chan error, err error) {
+	for _, done := range waiting {
+		done <- err
+	}
+}
+
+// Apply применяет зафиксированную запись журнала. Операции своего срока
+// лидер уже выполнил, они учитываются только в зафиксированном состоянии.
+func (c *Consensus) Apply(entry raft.Entry) {
+	ops, err := decodeOps(entry.Data)
+	if err != nil {
+		log.Printf("raft: entry %d: %v", entry.Index, err)
+		return
+	}
+	qb := c.qb
+	qb.mu.Lock()
+	if !c.leading || c.term != entry.Term {
+		for _, op := range ops {
+			if err := qb.applyLocked(op); err != nil {
+				log.Printf("raft: entry %d: %v", entry.Index, err)
+			}
+		}
+	}
+	qb.mu.Unlock()
+	for _, op := range ops {
+		c.committed.apply(op)
+	}
+}
+
+// Snapshot возвращает зафиксированное состояние для сжатия журнала
+func (c *Consensus) Snapshot() ([]byte, error) {
+	return encodeOps(c.committed.ops()), nil
+}
+
+// Restore заменяет зафиксированное состояние снимком, а очереди узла, не
+// являющегося лидером, — его содержимым
+func (c *Consensus) Restore(data []byte) error {
+	ops, err := decodeOps(data)
+	if err != nil {
+		return err
+	}
+	committed := newCommittedState()
+	for _, op := range ops {
+		committed.apply(op)
+	}
+	c.committed = committed
+	qb := c.qb
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	if !c.leading {
+		c.rebuildLocked()
+	}
+	return nil
+}
+
+// LeadershipChanged начинает обслуживание клиентов, когда узел становится
+// лидером: к этому моменту его очереди совпадают с зафиксированным
+// состоянием. Переставший быть лидером узел отбрасывает незафиксированные
+// изменения.
+func (c *Consensus) LeadershipChanged(leader bool, term uint64) {
+	qb := c.qb
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	if leader {
+		c.leading, c.term = true, term
+		c.feed = qb.subscribeLocked(true)
+		c.commits, c.stop = make(chan chan error), make(chan struct{})
+		go c.replicate(term, c.feed, c.commits, c.stop)
+		log.Printf("raft: serving clients as the leader of term %d", term)
+		return
+	}
+	if !c.leading {
+		return
+	}
+	c.leading = false
+	close(c.stop)
+	c.feed.closeLocked()
+	c.rebuildLocked()
+	log.Printf("raft: no longer the leader, forwarding clients to %q", c.node.Leader())
+}
+
+// rebuildLocked заменяет сообщения очередей зафиксированным состоянием
+func (c *Consensus) rebuildLocked() {
+	for _, op := range c.committed.ops() {
+		if err := c.qb.applyLocked(op); err != nil {
+			log.Printf("raft: rebuild queues: %v", err)
+		}
+	}
+}
+
+// encodeOps кодирует операции записи журнала кадрами gRPC с сообщениями Op
+func encodeOps(ops []ReplicationOp) []byte {
+	var buf bytes.Buffer
+	for _, op := range ops {
+		data, err := op.MarshalBinary()
+		if err != nil {
+			continue
+		}
+		rpc.WriteMessage(&buf, data)
+	}
+	return buf.Bytes()
+}
+
+func decodeOps(data []byte) ([]ReplicationOp, error) {
+	r := bytes.NewReader(data)
+	var ops []ReplicationOp
+	for {
+		msg, err := rpc.ReadMessage(r, math.MaxInt32)
+		if err == io.EOF {
+			return ops, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		var op ReplicationOp
+		if err := op.UnmarshalBinary(msg); err != nil {
+			return nil, err
+		}
+		ops = append(ops, op)
+	}
+}
+
+// committedState хранимые сообщения очередей по зафиксированным операциям
+type committedState struct {
+	queues map[string]map[uint64]committedMessage
+	// seq порядковый номер последней поставленной операции, по нему
+	// восстанавливается порядок сообщений в очереди
+	seq uint64
+}
+
+type committedMessage struct {
+	seq     uint64
+	message *ReplicatedMessage
+}
+
+func newCommittedState() *committedState {
+	return &committedState{queues: make(map[string]map[uint64]committedMessage)}
+}
+
+func (s *committedState) apply(op ReplicationOp) {
+	switch op.Op {
+	case ReplicationReset:
+		s.queues = make(map[string]map[uint64]committedMessage)
+	case ReplicationPut:
+		if op.Queue == "" || op.Message == nil {
+			return
+		}
+		queue := s.queues[op.Queue]
+		if queue == nil {
+			queue = make(map[uint64]committedMessage)
+			s.queues[op.Queue] = queue
+		}
+		s.seq++
+		queue[op.ID] = committedMessage{seq: s.seq, message: op.Message}
+	case ReplicationRemove:
+		delete(s.queues[op.Queue], op.ID)
+	}
+}
+
+// ops возвращает операции, воспроизводящие состояние (начиная с ReplicationReset)
+func (s *committedState) ops() []ReplicationOp {
+	ops := []ReplicationOp{{Op: ReplicationReset}}
+	names := make([]string, 0, len(s.queues))
+	for name := range s.queues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		queue := s.queues[name]
+		ids := make([]uint64, 0, len(queue))
+		for id := range queue {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool { return queue[ids[i]].seq < queue[ids[j]].seq })
+		for _, id := range ids {
+			ops = append(ops, ReplicationOp{Op: ReplicationPut, Queue: name, ID: id, Message: queue[id].message})
+		}
+	}
+	return ops
+}
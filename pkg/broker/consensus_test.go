@@ -0,0 +1,258 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"queue-broker/pkg/peer"
+	"queue-broker/pkg/raft"
+)
+
+// partitionTransport передает запросы узлов по HTTP, кроме запросов от
+// отключенных узлов и к ним
+type partitionTransport struct {
+	*raft.HTTPTransport
+	from string
+	net  *testNetwork
+}
+
+type testNetwork struct {
+	mu   sync.Mutex
+	down map[string]bool
+}
+
+func (n *testNetwork) set(id string, down bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.down[id] = down
+}
+
+func (t *partitionTransport) check(to string) error {
+	t.net.mu.Lock()
+	defer t.net.mu.Unlock()
+	if t.net.down[t.from] || t.net.down[to] {
+		return errors.New("unreachable")
+	}
+	return nil
+}
+
+func (t *partitionTransport) RequestVote(ctx context.Context, to string, req *raft.VoteRequest) (*raft.VoteResponse, error) {
+	if err := t.check(to); err != nil {
+		return nil, err
+	}
+	return t.HTTPTransport.RequestVote(ctx, to, req)
+}
+
+func (t *partitionTransport) AppendEntries(ctx context.Context, to string, req *raft.AppendRequest) (*raft.AppendResponse, error) {
+	if err := t.check(to); err != nil {
+		return nil, err
+	}
+	return t.HTTPTransport.AppendEntries(ctx, to, req)
+}
+
+func (t *partitionTransport) InstallSnapshot(ctx context.Context, to string, req *raft.SnapshotRequest) (*raft.SnapshotResponse, error) {
+	if err := t.check(to); err != nil {
+		return nil, err
+	}
+	return t.HTTPTransport.InstallSnapshot(ctx, to, req)
+}
+
+// consensusCluster три брокера-узла кластера Raft, обменивающихся запросами по HTTP
+type consensusCluster struct {
+	t       *testing.T
+	net     *testNetwork
+	urls    []string
+	dirs    []string
+	slots   []atomic.Pointer[Consensus]
+	brokers []*QueueBroker
+	nodes   []*Consensus
+}
+
+func startConsensusCluster(t *testing.T) *consensusCluster {
+	c := &consensusCluster{t: t, net: &testNetwork{down: make(map[string]bool)}, slots: make([]atomic.Pointer[Consensus], 3)}
+	for i := range c.slots {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			node := c.slots[i].Load()
+			if node == nil {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			peer.Require("s3cret", node.Handler()).ServeHTTP(w, r)
+		}))
+		t.Cleanup(server.Close)
+		c.urls = append(c.urls, server.URL)
+		c.dirs = append(c.dirs, t.TempDir())
+	}
+	c.brokers = make([]*QueueBroker, 3)
+	c.nodes = make([]*Consensus, 3)
+	for i := range c.urls {
+		c.start(i)
+	}
+	return c
+}
+
+// start запускает узел i на новом брокере с прежним каталогом журнала
+func (c *consensusCluster) start(i int) {
+	qb := NewQueueBroker(100, 10, 1)
+	node, err := qb.StartConsensus(raft.Config{
+		ID:              c.urls[i],
+		Peers:           c.urls,
+		Dir:             c.dirs[i],
+		Transport:       &partitionTransport{HTTPTransport: raft.NewHTTPTransport("s3cret"), from: c.urls[i], net: c.net},
+		ElectionTimeout: 100 * time.Millisecond,
+	})
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.slots[i].Store(node)
+	c.brokers[i], c.nodes[i] = qb, node
+	c.t.Cleanup(node.Close)
+}
+
+func (c *consensusCluster) stop(i int) {
+	c.slots[i].Store(nil)
+	c.nodes[i].Close()
+}
+
+// waitLeader ждет узел, обслуживающий клиентов, среди узлов кроме except
+func waitLeader(t *testing.T, nodes []*Consensus, except int) int {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for i, c := range nodes {
+			if i != except && c.Leading() {
+				return i
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("no leader elected")
+	return -1
+}
+
+// waitBodies ждет, пока в очереди брокера окажутся сообщения с телами want
+func waitBodies(t *testing.T, qb *QueueBroker, queueName string, want ...string) {
+	t.Helper()
+	var got []string
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		got = got[:0]
+		browsed, _, _ := qb.Browse(queueName, 0, 100)
+		for _, msg := range browsed {
+			got = append(got, msg.Body)
+		}
+		if slices.Equal(got, want) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("queue %s has %q, want %q", queueName, got, want)
+}
+
+// TestConsensusReplication проверяет, что постановка и выдача на лидере
+// применяются на всех узлах, а остальные узлы клиентов не обслуживают
+func TestConsensusReplication(t *testing.T) {
+	c := startConsensusCluster(t)
+	brokers, nodes := c.brokers, c.nodes
+	leader := waitLeader(t, nodes, -1)
+
+	for _, body := range []string{"a", "b"} {
+		if err := brokers[leader].Enqueue("jobs", &Message{Body: body}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, qb := range brokers {
+		waitBodies(t, qb, "jobs", "a", "b")
+	}
+	if msg, err := brokers[leader].Dequeue("jobs", 0); err != nil || msg.Body != "a" {
+		t.Fatalf("dequeue: %v, %v", msg, err)
+	}
+	for i, qb := range brokers {
+		waitBodies(t, qb, "jobs", "b")
+		if i != leader {
+			if err := qb.Enqueue("jobs", &Message{Body: "x"}); !errors.Is(err, ErrStandby) {
+				t.Fatalf("enqueue on a follower: %v, want ErrStandby", err)
+			}
+			if nodes[i].Leader() != nodes[leader].Self() {
+				t.Fatalf("follower sees leader %q, want %q", nodes[i].Leader(), nodes[leader].Self())
+			}
+		}
+	}
+}
+
+// TestConsensusFailover проверяет смену лидера при отключении прежнего:
+// новый лидер обслуживает клиентов с зафиксированными сообщениями, а
+// постановка, не зафиксированная прежним лидером, завершается ошибкой и
+// отбрасывается, когда он возвращается в кластер ведомым
+func TestConsensusFailover(t *testing.T) {
+	c := startConsensusCluster(t)
+	brokers, nodes, net := c.brokers, c.nodes, c.net
+	old := waitLeader(t, nodes, -1)
+	if err := brokers[old].Enqueue("jobs", &Message{Body: "committed"}); err != nil {
+		t.Fatal(err)
+	}
+
+	net.set(nodes[old].Self(), true)
+	lost := make(chan error, 1)
+	go func() { lost <- brokers[old].Enqueue("jobs", &Message{Body: "lost"}) }()
+
+	leader := waitLeader(t, nodes, old)
+	waitBodies(t, brokers[leader], "jobs", "committed")
+	if err := brokers[leader].Enqueue("jobs", &Message{Body: "after"}); err != nil {
+		t.Fatal(err)
+	}
+
+	net.set(nodes[old].Self(), false)
+	select {
+	case err := <-lost:
+		if !errors.Is(err, ErrNotCommitted) {
+			t.Fatalf("enqueue on the isolated leader: %v, want ErrNotCommitted", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("enqueue on the isolated leader did not finish")
+	}
+	for _, qb := range brokers {
+		waitBodies(t, qb, "jobs", "committed", "after")
+	}
+	if nodes[old].Leading() || !brokers[old].Standby() {
+		t.Fatal("old leader still serves clients")
+	}
+}
+
+// TestConsensusRestart проверяет, что перезапущенный узел восстанавливает
+// зафиксированные сообщения из своего журнала, а снимок зафиксированного
+// состояния воспроизводит очереди
+func TestConsensusRestart(t *testing.T) {
+	c := startConsensusCluster(t)
+	leader := waitLeader(t, c.nodes, -1)
+	if err := c.brokers[leader].Enqueue("jobs", &Message{Body: "kept"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, qb := range c.brokers {
+		waitBodies(t, qb, "jobs", "kept")
+	}
+
+	follower := (leader + 1) % 3
+	c.stop(follower)
+	c.start(follower)
+	waitBodies(t, c.brokers[follower], "jobs", "kept")
+
+	ops, err := decodeOps(encodeOps(c.nodes[leader].committed.ops()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := NewQueueBroker(100, 10, 1)
+	for _, op := range ops {
+		if err := restored.ApplyReplication(op); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitBodies(t, restored, "jobs", "kept")
+}
@@ -0,0 +1,26 @@
+package broker
+
+// attachConsumerLocked регистрирует ожидающего получателя (long-poll)
+// или потокового потребителя очереди с учетом MaxConsumers
+func (qb *QueueBroker) attachConsumerLocked(queueName string) error {
+	limit := qb.queueConfigLocked(queueName).MaxConsumers
+	if limit > 0 && queueName != CanaryQueue && qb.consumers[queueName] >= limit {
+		return ErrTooManyConsumers
+	}
+	qb.consumers[queueName]++
+	return nil
+}
+
+func (qb *QueueBroker) detachConsumerLocked(queueName string) {
+	if qb.consumers[queueName]--; qb.consumers[queueName] <= 0 {
+		delete(qb.consumers, queueName)
+	}
+}
+
+// Consumers возвращает число подключенных к очереди потребителей:
+// ожидающих long-poll получателей и потоковых потребителей
+func (qb *QueueBroker) Consumers(queueName string) int {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	return qb.consumers[queueName]
+}
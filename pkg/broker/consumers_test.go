@@ -0,0 +1,52 @@
+package broker
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestMaxConsumers проверяет ограничение числа подключенных потребителей очереди
+func TestMaxConsumers(t *testing.T) {
+	qb := NewQueueBroker(10, 10, 1)
+	qb.SetQueueConfig("jobs", QueueConfig{LockDuration: 30, MaxConsumers: 2})
+	qb.Enqueue("jobs", &Message{Body: "x"})
+	qb.Dequeue("jobs", 0)
+
+	sub, err := qb.Subscribe("jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := qb.Dequeue("jobs", 5*time.Second)
+		done <- err
+	}()
+	for deadline := time.Now().Add(time.Second); qb.Consumers("jobs") != 2; {
+		if time.Now().After(deadline) {
+			t.Fatal("long-poll consumer was not registered")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if _, err := qb.Subscribe("jobs"); !errors.Is(err, ErrTooManyConsumers) {
+		t.Errorf("expected ErrTooManyConsumers for stream, got %v", err)
+	}
+	if _, err := qb.Dequeue("jobs", time.Second); !errors.Is(err, ErrTooManyConsumers) {
+		t.Errorf("expected ErrTooManyConsumers for long-poll, got %v", err)
+	}
+	// Немедленная выдача не подключает потребителя и не ограничивается
+	qb.Enqueue("jobs", &Message{Body: "y"})
+	if err := <-done; err != nil {
+		t.Fatalf("waiting consumer failed: %v", err)
+	}
+	qb.Enqueue("jobs", &Message{Body: "z"})
+	if msg, err := qb.Dequeue("jobs", time.Second); err != nil || msg.Body != "z" {
+		t.Errorf("expected immediate delivery, got %v %v", msg, err)
+	}
+
+	sub.Close()
+	if n := qb.Consumers("jobs"); n != 0 {
+		t.Errorf("expected no consumers after close, got %d", n)
+	}
+}
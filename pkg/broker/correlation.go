@@ -0,0 +1,23 @@
+package broker
+
+import "time"
+
+// CorrelationIDHeader заголовок, по которому ответ сопоставляется с запросом
+const CorrelationIDHeader = "correlation_id"
+
+// DequeueCorrelated извлекает из очереди сообщение с заголовком
+// correlation_id, равным correlationID, ожидая его до timeout.
+// Остальные сообщения остаются в очереди на своих местах, поэтому несколько
+// клиентов могут получать ответы из общей очереди, каждый — свои.
+func (qb *QueueBroker) DequeueCorrelated(queueName, correlationID string, timeout time.Duration) (*Message, error) {
+	stored, err := qb.dequeueMatching(queueName, timeout, func(stored *Message) bool {
+		return stored.Headers[CorrelationIDHeader] == correlationID
+	})
+	if err != nil {
+		return nil, err
+	}
+	qb.mu.Lock()
+	qb.releaseLocked(stored.Queue, stored)
+	qb.mu.Unlock()
+	return qb.deliver(stored)
+}
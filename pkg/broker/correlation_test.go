@@ -0,0 +1,77 @@
+package broker
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestDequeueCorrelated проверяет выборочное получение по correlation_id
+func TestDequeueCorrelated(t *testing.T) {
+	qb := NewQueueBroker(10, 10, 10)
+	reply := func(id, body string) *Message {
+		return &Message{Body: body, Headers: map[string]string{CorrelationIDHeader: id}}
+	}
+	qb.Enqueue("replies", reply("a", "for a"))
+	qb.Enqueue("replies", reply("b", "for b"))
+
+	msg, err := qb.DequeueCorrelated("replies", "b", 0)
+	if err != nil || msg.Body != "for b" {
+		t.Fatalf("unexpected message %+v %v", msg, err)
+	}
+	if _, err := qb.DequeueCorrelated("replies", "b", 0); !errors.Is(err, ErrTimeout) {
+		t.Errorf("expected ErrTimeout, got %v", err)
+	}
+	// Пропущенное сообщение осталось первым в очереди
+	if msg, err := qb.Dequeue("replies", 0); err != nil || msg.Body != "for a" {
+		t.Errorf("unexpected message %+v %v", msg, err)
+	}
+	if _, err := qb.DequeueCorrelated("missing", "a", 0); !errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("expected ErrQueueNotFound, got %v", err)
+	}
+	if _, err := qb.DequeueCorrelated("replies.*", "a", 0); !errors.Is(err, ErrInvalidQueueName) {
+		t.Errorf("expected ErrInvalidQueueName, got %v", err)
+	}
+}
+
+// TestDequeueCorrelatedWait проверяет, что ожидающий выборочного получения
+// дожидается своего ответа и не мешает обычному получателю
+func TestDequeueCorrelatedWait(t *testing.T) {
+	qb := NewQueueBroker(10, 10, 10)
+	want := make(chan *Message)
+	go func() {
+		msg, err := qb.DequeueCorrelated("replies", "x", 5*time.Second)
+		if err != nil {
+			t.Error(err)
+		}
+		want <- msg
+	}()
+	plain := make(chan *Message)
+	go func() {
+		msg, err := qb.Dequeue("replies", 5*time.Second)
+		if err != nil {
+			t.Error(err)
+		}
+		plain <- msg
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	qb.PutMessage("replies", "other")
+	select {
+	case msg := <-plain:
+		if msg.Body != "other" {
+			t.Errorf("unexpected message %+v", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("plain receiver was not woken")
+	}
+	qb.Enqueue("replies", &Message{Body: "mine", Headers: map[string]string{CorrelationIDHeader: "x"}})
+	select {
+	case msg := <-want:
+		if msg.Body != "mine" {
+			t.Errorf("unexpected message %+v", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("correlated receiver was not woken")
+	}
+}
@@ -0,0 +1,51 @@
+package broker
+
+import (
+	"testing"
+	"time"
+)
+
+// TestCronNext проверяет расчет следующего срабатывания для списков,
+// диапазонов, шага, имен, сокращений и дня месяца или недели
+func TestCronNext(t *testing.T) {
+	after := time.Date(2024, time.January, 31, 10, 17, 30, 0, time.UTC) // среда
+	for _, tc := range []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 1, 31, 10, 18, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 1, 31, 10, 30, 0, 0, time.UTC)},
+		{"5/20 * * * *", time.Date(2024, 1, 31, 10, 25, 0, 0, time.UTC)},
+		{"0 9-17 * * MON-FRI", time.Date(2024, 1, 31, 11, 0, 0, 0, time.UTC)},
+		{"0 0 * * sun", time.Date(2024, 2, 4, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 2, 4, 0, 0, 0, 0, time.UTC)},
+		{"30 6 1,15 * *", time.Date(2024, 2, 1, 6, 30, 0, 0, time.UTC)},
+		{"0 0 29 FEB *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 13 * FRI", time.Date(2024, 2, 2, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 1, 31, 11, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	} {
+		spec, err := parseCron(tc.expr)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.expr, err)
+			continue
+		}
+		if got := spec.next(after); !got.Equal(tc.want) {
+			t.Errorf("%s: expected %v, got %v", tc.expr, tc.want, got)
+		}
+	}
+
+	// Расписание вычисляется в часовом поясе after
+	moscow := time.FixedZone("MSK", 3*60*60)
+	spec, _ := parseCron("0 9 * * *")
+	if got := spec.next(after.In(moscow)); !got.Equal(time.Date(2024, 2, 1, 6, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected next run in time zone: %v", got)
+	}
+
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "0 0 0 * *", "*/0 * * * *", "5-1 * * * *", "0 0 * FOO *"} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("%q: expected error", expr)
+		}
+	}
+}
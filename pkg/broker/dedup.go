@@ -0,0 +1,34 @@
+package broker
+
+import "time"
+
+// dedupCache запоминает ключи идемпотентности, увиденные в очереди
+type dedupCache struct {
+	seen      map[string]time.Time
+	lastPrune time.Time
+}
+
+func newDedupCache() *dedupCache {
+	return &dedupCache{seen: make(map[string]time.Time)}
+}
+
+// isDuplicate сообщает, встречался ли ключ в пределах окна window
+func (dc *dedupCache) isDuplicate(key string, window time.Duration, now time.Time) bool {
+	seenAt, ok := dc.seen[key]
+	return ok && now.Sub(seenAt) < window
+}
+
+// remember запоминает ключ и заодно удаляет устаревшие записи,
+// не чаще одного раза за окно
+func (dc *dedupCache) remember(key string, window time.Duration, now time.Time) {
+	dc.seen[key] = now
+	if now.Sub(dc.lastPrune) < window {
+		return
+	}
+	for k, seenAt := range dc.seen {
+		if now.Sub(seenAt) >= window {
+			delete(dc.seen, k)
+		}
+	}
+	dc.lastPrune = now
+}
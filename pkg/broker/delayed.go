@@ -0,0 +1,116 @@
+package broker
+
+import (
+	"sort"
+	"time"
+)
+
+// delayedMessage сообщение, поставленное с задержкой: до наступления
+// deliverAt оно не выдается, но занимает место в очереди
+type delayedMessage struct {
+	msg       *Message
+	deliverAt time.Time
+	timer     *time.Timer
+}
+
+// ScheduledMessage отложенное сообщение очереди и срок его выдачи
+type ScheduledMessage struct {
+	ID uint64 `json:"id"`
+	*Message
+	// Position порядковый номер среди отложенных сообщений очереди (с 1)
+	// в порядке наступления срока
+	Position  int       `json:"position"`
+	DeliverAt time.Time `json:"deliver_at"`
+	// RemainingDelay сколько секунд осталось до выдачи
+	RemainingDelay float64 `json:"remaining_delay"`
+}
+
+// scheduleLocked откладывает хранимое сообщение до deliverAt
+func (qb *QueueBroker) scheduleLocked(queueName string, stored *Message, deliverAt time.Time) {
+	d := &delayedMessage{msg: stored, deliverAt: deliverAt}
+	list := qb.delayed[queueName]
+	i := sort.Search(len(list), func(i int) bool { return list[i].deliverAt.After(deliverAt) })
+	list = append(list, nil)
+	copy(list[i+1:], list[i:])
+	list[i] = d
+	qb.delayed[queueName] = list
+	d.timer = time.AfterFunc(time.Until(deliverAt), func() { qb.releaseDelayed(queueName, d) })
+}
+
+// releaseDelayed переносит сообщение в очередь по наступлении срока
+func (qb *QueueBroker) releaseDelayed(queueName string, d *delayedMessage) {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+
+	if !qb.removeDelayedLocked(queueName, d) {
+		return
+	}
+	// Место гарантировано: отложенное сообщение учитывается в емкости очереди
+	if qb.groupHeldLocked(queueName, d.msg) {
+		// Повтор сообщения группы возвращается на свое место в группе
+		qb.returnLocked(queueName, d.msg)
+	} else if queue := qb.queues[queueName]; queue != nil {
+		queue.push(d.msg)
+	}
+}
+
+// removeDelayedLocked убирает отложенное сообщение из списка очереди;
+// false, если его там уже нет
+func (qb *QueueBroker) removeDelayedLocked(queueName string, d *delayedMessage) bool {
+	list := qb.delayed[queueName]
+	for i, item := range list {
+		if item != d {
+			continue
+		}
+		qb.delayed[queueName] = append(list[:i:i], list[i+1:]...)
+		if len(qb.delayed[queueName]) == 0 {
+			delete(qb.delayed, queueName)
+		}
+		return true
+	}
+	return false
+}
+
+// dropDelayedLocked отменяет все отложенные сообщения очереди и возвращает их
+func (qb *QueueBroker) dropDelayedLocked(queueName string) []*Message {
+	var dropped []*Message
+	for _, d := range qb.delayed[queueName] {
+		d.timer.Stop()
+		dropped = append(dropped, d.msg)
+	}
+	delete(qb.delayed, queueName)
+	return dropped
+}
+
+// Scheduled возвращает отложенные сообщения очереди в порядке наступления
+// срока выдачи; тела возвращаются в исходном виде
+func (qb *QueueBroker) Scheduled(queueName string) ([]ScheduledMessage, error) {
+	qb.mu.Lock()
+	if qb.queues[queueName] == nil {
+		qb.mu.Unlock()
+		return nil, ErrQueueNotFound
+	}
+	delayed := append([]*delayedMessage(nil), qb.delayed[queueName]...)
+	qb.mu.Unlock()
+
+	now := time.Now()
+	scheduled := make([]ScheduledMessage, 0, len(delayed))
+	for _, d := range delayed {
+		msg, err := qb.unpack(d.msg)
+		if err != nil {
+			return nil, err
+		}
+		remaining := d.deliverAt.Sub(now)
+		if remaining < 0 {
+			remaining = 0
+		}
+		scheduled = append(scheduled, ScheduledMessage{
+			ID:             d.msg.id,
+			Message:        msg,
+			Position:       len(scheduled) + 1,
+			DeliverAt:      d.deliverAt,
+			RemainingDelay: remaining.Seconds(),
+		})
+	}
+	return scheduled, nil
+}
@@ -0,0 +1,58 @@
+package broker
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestDelayedMessages проверяет отложенную выдачу и список отложенных сообщений
+func TestDelayedMessages(t *testing.T) {
+	qb := NewQueueBroker(2, 10, 1)
+	if err := qb.Enqueue("jobs", &Message{Body: "later", DeliverAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := qb.Enqueue("jobs", &Message{Body: "soon", DeliverAt: time.Now().Add(50 * time.Millisecond)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := qb.Dequeue("jobs", 0); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("delayed message delivered early: %v", err)
+	}
+	// Отложенные сообщения занимают место в очереди
+	if err := qb.Enqueue("jobs", &Message{Body: "now"}); err == nil {
+		t.Error("expected capacity error for queue with delayed messages")
+	}
+
+	scheduled, err := qb.Scheduled("jobs")
+	if err != nil || len(scheduled) != 2 {
+		t.Fatalf("Scheduled() = %+v, %v", scheduled, err)
+	}
+	if scheduled[0].Body != "soon" || scheduled[0].Position != 1 || scheduled[1].Body != "later" || scheduled[1].Position != 2 {
+		t.Errorf("unexpected order: %+v", scheduled)
+	}
+	if remaining := scheduled[1].RemainingDelay; remaining <= 3500 || remaining > 3600 {
+		t.Errorf("unexpected remaining delay %v", remaining)
+	}
+	if scheduled[0].ID == scheduled[1].ID {
+		t.Error("scheduled messages share an id")
+	}
+
+	msg, err := qb.Dequeue("jobs", time.Second)
+	if err != nil || msg.Body != "soon" {
+		t.Fatalf("Dequeue() = %+v, %v", msg, err)
+	}
+	if scheduled, _ := qb.Scheduled("jobs"); len(scheduled) != 1 {
+		t.Errorf("expected one scheduled message, got %d", len(scheduled))
+	}
+
+	if count, err := qb.Purge("jobs"); err != nil || count != 1 {
+		t.Fatalf("Purge() = %d, %v", count, err)
+	}
+	if scheduled, _ := qb.Scheduled("jobs"); len(scheduled) != 0 {
+		t.Errorf("purge left scheduled messages: %+v", scheduled)
+	}
+	if _, err := qb.Scheduled("missing"); !errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("expected ErrQueueNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,124 @@
+package broker
+
+import "errors"
+
+// Error ошибка брокера с машиночитаемым кодом. Экспортированные ошибки пакета
+// имеют этот тип, поэтому код любой из них, в том числе обернутой в
+// *CapacityError, *SchemaError или fmt.Errorf("%w"), дает errors.As или ErrorCode.
+type Error struct {
+	// Code код ошибки в верхнем регистре, например QUEUE_FULL; передается
+	// клиентам HTTP API
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string { return e.Message }
+
+func newError(code, message string) error {
+	return &Error{Code: code, Message: message}
+}
+
+// ErrorCode возвращает код ошибки брокера из цепочки err или "", если в ней
+// нет ошибок пакета
+func ErrorCode(err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return ""
+}
+
+// Ошибки брокера; сравнивать их следует через errors.Is. Тексты ошибок
+// совпадают с прежними и возвращаются клиентам HTTP API вместе с кодом.
+var (
+	// ErrQueueNotFound очередь (или очереди по шаблону) не существует
+	ErrQueueNotFound = newError("QUEUE_NOT_FOUND", "queue does not exist")
+	// ErrTimeout сообщение не появилось в очереди за время ожидания
+	ErrTimeout = newError("NO_MESSAGE", "not found")
+	// ErrQueueFull в очереди нет места (с учетом неподтвержденных сообщений)
+	ErrQueueFull = newError("QUEUE_FULL", "queue is full")
+	// ErrTooManyQueues достигнуто максимальное число очередей
+	ErrTooManyQueues = newError("TOO_MANY_QUEUES", "maximum number of queues reached")
+	// ErrPutTimeout в очереди с политикой OverflowBlock не освободилось место
+	// за время ожидания производителя
+	ErrPutTimeout = newError("PUT_TIMEOUT", "no space in queue within timeout")
+	// ErrDuplicate сообщение с тем же DedupID уже принято в окне дедупликации
+	ErrDuplicate = newError("DUPLICATE", "duplicate message")
+	// ErrInvalidQueueName имя не может использоваться как имя очереди
+	ErrInvalidQueueName = newError("INVALID_QUEUE_NAME", "invalid queue name")
+	// ErrInvalidReplyTo заголовок reply_to не является именем очереди
+	ErrInvalidReplyTo = newError("INVALID_REPLY_TO", "invalid reply_to queue")
+	// ErrLockNotFound блокировка peek-lock истекла или не существует
+	ErrLockNotFound = newError("LOCK_NOT_FOUND", "lock not found")
+	// ErrInvalidConsumerID пустой или слишком длинный идентификатор потребителя
+	ErrInvalidConsumerID = newError("INVALID_CONSUMER_ID", "invalid consumer id")
+	// ErrInvalidTransactionID пустой или слишком длинный идентификатор транзакции
+	ErrInvalidTransactionID = newError("INVALID_TRANSACTION_ID", "invalid transaction id")
+	// ErrTransactionNotFound транзакция не существует, отменена или истекла
+	ErrTransactionNotFound = newError("TRANSACTION_NOT_FOUND", "transaction not found")
+	// ErrTransactionCommitted транзакция уже зафиксирована
+	ErrTransactionCommitted = newError("TRANSACTION_COMMITTED", "transaction already committed")
+	// ErrTransactionBusy транзакция фиксируется другим запросом
+	ErrTransactionBusy = newError("TRANSACTION_BUSY", "transaction is being committed")
+	// ErrTransactionTooLarge в транзакции уже maxTransactionMessages сообщений
+	ErrTransactionTooLarge = newError("TRANSACTION_TOO_LARGE", "too many messages in transaction")
+	// ErrNoAggregation для очереди не задана политика агрегации
+	ErrNoAggregation = newError("NO_AGGREGATION", "aggregation is not configured for queue")
+	// ErrNoRetention для очереди не задано хранение сообщений в журнале
+	ErrNoRetention = newError("NO_RETENTION", "retention is not configured for queue")
+	// ErrInvalidGroup пустое или слишком длинное имя группы потребителей журнала
+	ErrInvalidGroup = newError("INVALID_GROUP", "invalid consumer group")
+	// ErrInvalidOffset смещение за концом журнала очереди
+	ErrInvalidOffset = newError("INVALID_OFFSET", "offset is beyond the end of the log")
+	// ErrMessageNotFound в очереди нет сообщения с таким идентификатором
+	ErrMessageNotFound = newError("MESSAGE_NOT_FOUND", "message not found")
+	// ErrTooManyConsumers к очереди подключено MaxConsumers потребителей
+	ErrTooManyConsumers = newError("TOO_MANY_CONSUMERS", "too many consumers for queue")
+	// ErrQueueArchiving очередь сохраняется в архив перед удалением
+	ErrQueueArchiving = newError("QUEUE_ARCHIVING", "queue is being archived")
+	// ErrNoArchive хранилище архива не задано
+	ErrNoArchive = newError("NO_ARCHIVE", "archive is not configured")
+	// ErrRejected сообщение отклонено скриптом преобразования очереди
+	ErrRejected = newError("MESSAGE_REJECTED", "message rejected by transform")
+	// ErrInvalidCeleryTask сообщение для очереди в режиме Celery не является
+	// задачей Celery
+	ErrInvalidCeleryTask = newError("INVALID_CELERY_TASK", "invalid celery task")
+	// ErrSchemaViolation тело сообщения не соответствует схеме очереди;
+	// подробности — в *SchemaError
+	ErrSchemaViolation = newError("SCHEMA_VIOLATION", "message does not match queue schema")
+
+	// ErrQueueByteLimit превышен объем сообщений одной очереди
+	ErrQueueByteLimit = newError("QUEUE_BYTE_LIMIT", "queue byte limit exceeded")
+	// ErrTotalByteLimit превышен общий объем сообщений
+	ErrTotalByteLimit = newError("TOTAL_BYTE_LIMIT", "total byte limit exceeded")
+
+	// ErrCrossTenant маршрутизация в очередь другого арендатора
+	ErrCrossTenant = newError("CROSS_TENANT", "cross-tenant routing is not allowed")
+	// ErrTenantQueueLimit арендатор достиг квоты на число очередей
+	ErrTenantQueueLimit = newError("TENANT_QUEUE_LIMIT", "tenant queue limit reached")
+	// ErrTenantMessageLimit арендатор достиг квоты на число сообщений
+	ErrTenantMessageLimit = newError("TENANT_MESSAGE_LIMIT", "tenant message limit reached")
+	// ErrTenantByteLimit превышена квота арендатора на объем сообщений
+	ErrTenantByteLimit = newError("TENANT_BYTE_LIMIT", "tenant byte limit exceeded")
+
+	// ErrAuthRequired операция требует известного субъекта
+	ErrAuthRequired = newError("AUTH_REQUIRED", "authentication required")
+	// ErrPermissionDenied у субъекта нет нужного права на очередь
+	ErrPermissionDenied = newError("PERMISSION_DENIED", "permission denied")
+	// ErrNoOwner у очереди нет владельца
+	ErrNoOwner = newError("NO_OWNER", "queue has no owner")
+	// ErrOwnerRequired не указан новый владелец очереди
+	ErrOwnerRequired = newError("OWNER_REQUIRED", "owner is required")
+
+	// ErrStandby брокер в режиме резерва и не обслуживает клиентов
+	ErrStandby = newError("STANDBY", "broker is in standby mode")
+	// ErrNotStandby брокер не является ведомым
+	ErrNotStandby = newError("NOT_STANDBY", "broker is not a standby")
+	// ErrNotCommitted операции постановки не зафиксированы в журнале кластера
+	// Raft: лидер сменился или большинство узлов недоступно. Сообщение могло
+	// остаться в очереди, поэтому повторять постановку стоит с DedupID.
+	ErrNotCommitted = newError("NOT_COMMITTED", "not committed to the cluster log")
+	// ErrNotPersisted журнал предзаписи не смог записать операции постановки
+	// на диск. Сообщение остается в очереди, но может не пережить перезапуск.
+	ErrNotPersisted = newError("NOT_PERSISTED", "not written to the write-ahead log")
+)
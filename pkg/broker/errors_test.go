@@ -0,0 +1,49 @@
+package broker
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// TestSentinelErrors проверяет, что операции возвращают экспортированные ошибки
+func TestSentinelErrors(t *testing.T) {
+	qb := NewQueueBroker(1, 1, 0)
+	if _, err := qb.Dequeue("jobs", 0); !errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("expected ErrQueueNotFound, got %v", err)
+	}
+	qb.Enqueue("jobs", &Message{Body: "x", DedupID: "1"})
+	if err := qb.Enqueue("jobs", &Message{Body: "y"}); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("expected ErrQueueFull, got %v", err)
+	}
+	if err := qb.Enqueue("other", &Message{Body: "y"}); !errors.Is(err, ErrTooManyQueues) {
+		t.Errorf("expected ErrTooManyQueues, got %v", err)
+	}
+	if err := qb.Enqueue("jobs.*", &Message{Body: "y"}); !errors.Is(err, ErrInvalidQueueName) {
+		t.Errorf("expected ErrInvalidQueueName, got %v", err)
+	}
+	qb.Dequeue("jobs", 0)
+	if _, err := qb.Dequeue("jobs", 0); !errors.Is(err, ErrTimeout) {
+		t.Errorf("expected ErrTimeout, got %v", err)
+	}
+	if err := qb.Complete("jobs", "missing"); !errors.Is(err, ErrLockNotFound) {
+		t.Errorf("expected ErrLockNotFound, got %v", err)
+	}
+}
+
+// TestErrorCode проверяет коды ошибок, в том числе обернутых
+func TestErrorCode(t *testing.T) {
+	qb := NewQueueBroker(1, 10, 0)
+	qb.PutMessage("jobs", "x")
+	err := qb.PutMessage("jobs", "y")
+	var e *Error
+	if !errors.As(err, &e) || e.Code != "QUEUE_FULL" || ErrorCode(err) != "QUEUE_FULL" {
+		t.Errorf("unexpected code for %v", err)
+	}
+	if code := ErrorCode(fmt.Errorf("%w: script failed", ErrRejected)); code != "MESSAGE_REJECTED" {
+		t.Errorf("unexpected code %q for wrapped error", code)
+	}
+	if code := ErrorCode(errors.New("other")); code != "" {
+		t.Errorf("unexpected code %q for foreign error", code)
+	}
+}
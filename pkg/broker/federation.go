@@ -0,0 +1,239 @@
+package broker
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"queue-broker/pkg/peer"
+)
+
+const (
+	// federationBufferSize сколько сообщений копится для недоступного пира
+	federationBufferSize = 10000
+	// FederationBatchSize максимальный размер пакета репликации
+	FederationBatchSize = 100
+	// federationMaxBackoff максимальная пауза между повторами отправки
+	federationMaxBackoff = 30 * time.Second
+)
+
+// Federation режим active-active: каждый регион принимает сообщения локально
+// и асинхронно пересылает их пирам. Повторы распознаются по DedupID,
+// поэтому продюсер может повторить запрос в любом регионе.
+type Federation struct {
+	region      string
+	dedupWindow time.Duration
+	client      *http.Client
+	secret      string
+	peers       []*federationPeer
+}
+
+// federationPeer очередь исходящих сообщений для одного пира
+type federationPeer struct {
+	url    string
+	outbox chan FederatedMessage
+	done   chan struct{}
+
+	mu        sync.Mutex
+	dropped   int
+	lastError error
+	// lastFailure последняя ошибка отправки, не сбрасываемая после успеха
+	lastFailure   error
+	lastFailureAt time.Time
+}
+
+// FederatedMessage сообщение вместе с очередью назначения. Тело, не
+// являющееся корректным UTF-8, передается в поле message_base64, как в архиве.
+type FederatedMessage struct {
+	Queue string `json:"queue"`
+	*Message
+}
+
+// federatedMessageJSON представление FederatedMessage в теле запроса
+type federatedMessageJSON struct {
+	Queue string `json:"queue"`
+	*Message
+	Body   string `json:"message"`
+	Base64 string `json:"message_base64,omitempty"`
+}
+
+func (fm FederatedMessage) MarshalJSON() ([]byte, error) {
+	v := federatedMessageJSON{Queue: fm.Queue, Message: fm.Message}
+	if fm.Message != nil {
+		if utf8.ValidString(fm.Body) {
+			v.Body = fm.Body
+		} else {
+			v.Base64 = base64.StdEncoding.EncodeToString([]byte(fm.Body))
+		}
+	}
+	return json.Marshal(v)
+}
+
+func (fm *FederatedMessage) UnmarshalJSON(data []byte) error {
+	var v federatedMessageJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	fm.Queue, fm.Message = v.Queue, v.Message
+	if fm.Message == nil {
+		if v.Body == "" && v.Base64 == "" {
+			return nil
+		}
+		fm.Message = &Message{}
+	}
+	fm.Body = v.Body
+	if v.Base64 != "" {
+		body, err := base64.StdEncoding.DecodeString(v.Base64)
+		if err != nil {
+			return err
+		}
+		fm.Body = string(body)
+	}
+	return nil
+}
+
+// FederationBatch тело POST /federation/messages
+type FederationBatch struct {
+	Origin   string             `json:"origin"`
+	Messages []FederatedMessage `json:"messages"`
+}
+
+// NewFederation создает репликацию в пиры peers (базовые URL брокеров).
+// dedupWindow — минимальное окно дедупликации для всех очередей.
+func NewFederation(region string, peers []string, dedupWindow time.Duration) *Federation {
+	f := &Federation{
+		region:      region,
+		dedupWindow: dedupWindow,
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}
+	for _, url := range peers {
+		f.peers = append(f.peers, &federationPeer{
+			url:    url,
+			outbox: make(chan FederatedMessage, federationBufferSize),
+			done:   make(chan struct{}),
+		})
+	}
+	return f
+}
+
+// SetPeerSecret задает общий секрет, который передается пирам (см. пакет
+// peer); вызывается до SetFederation
+func (f *Federation) SetPeerSecret(secret string) {
+	f.secret = secret
+}
+
+// SetFederation включает режим active-active и запускает отправку пирам
+func (qb *QueueBroker) SetFederation(f *Federation) {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	qb.federation = f
+	for _, peer := range f.peers {
+		go f.run(peer)
+	}
+}
+
+// Close останавливает отправку сообщений пирам
+func (f *Federation) Close() {
+	for _, peer := range f.peers {
+		close(peer.done)
+	}
+}
+
+// publish ставит локально принятое сообщение в очередь отправки всем пирам.
+// При долгой недоступности пира самые старые сообщения вытесняются.
+func (f *Federation) publish(queueName string, msg *Message) {
+	if f == nil {
+		return
+	}
+	item := FederatedMessage{Queue: queueName, Message: msg}
+	for _, peer := range f.peers {
+		for sent := false; !sent; {
+			select {
+			case peer.outbox <- item:
+				sent = true
+			default:
+				select {
+				case <-peer.outbox:
+					peer.mu.Lock()
+					peer.dropped++
+					peer.mu.Unlock()
+				default:
+				}
+			}
+		}
+	}
+}
+
+// run отправляет пакеты сообщений пиру, повторяя с экспоненциальной паузой при ошибках
+func (f *Federation) run(peer *federationPeer) {
+	backoff := 100 * time.Millisecond
+	for {
+		var batch []FederatedMessage
+		select {
+		case item := <-peer.outbox:
+			batch = append(batch, item)
+		case <-peer.done:
+			return
+		}
+	fill:
+		for len(batch) < FederationBatchSize {
+			select {
+			case item := <-peer.outbox:
+				batch = append(batch, item)
+			default:
+				break fill
+			}
+		}
+
+		for {
+			err := f.send(peer, batch)
+			peer.mu.Lock()
+			peer.lastError = err
+			if err != nil {
+				peer.lastFailure, peer.lastFailureAt = err, time.Now()
+			}
+			peer.mu.Unlock()
+			if err == nil {
+				backoff = 100 * time.Millisecond
+				break
+			}
+			log.Printf("federation: send to %s failed: %v", peer.url, err)
+			select {
+			case <-time.After(backoff):
+			case <-peer.done:
+				return
+			}
+			if backoff *= 2; backoff > federationMaxBackoff {
+				backoff = federationMaxBackoff
+			}
+		}
+	}
+}
+
+func (f *Federation) send(dest *federationPeer, batch []FederatedMessage) error {
+	body, err := json.Marshal(FederationBatch{Origin: f.region, Messages: batch})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, dest.url+"/federation/messages", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	peer.Sign(req, f.secret)
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package broker
+
+// Группы сообщений: сообщения с одинаковым GroupID выдаются строго в порядке
+// постановки и по одному. Пока сообщение группы выдано в режиме peek-lock
+// (или ждет повтора по политике очереди), остальные сообщения группы не
+// выдаются, а сообщения других групп и без группы выдаются как обычно.
+
+// popLocked извлекает первое сообщение очереди, группа которого не занята
+func (qb *QueueBroker) popLocked(queueName string, queue *messageQueue) *Message {
+	held := qb.groups[queueName]
+	if len(held) == 0 {
+		stored := queue.pop()
+		if stored != nil {
+			qb.recordDequeueLocked(queueName, stored)
+			qb.touchLocked(queueName)
+		}
+		return stored
+	}
+	for i, stored := range queue.messages {
+		if stored.GroupID == "" || held[stored.GroupID] == nil {
+			queue.removeAt(i)
+			qb.recordDequeueLocked(queueName, stored)
+			qb.touchLocked(queueName)
+			return stored
+		}
+	}
+	return nil
+}
+
+// holdGroupLocked занимает группу выданного сообщения до его подтверждения,
+// удаления или возврата в очередь
+func (qb *QueueBroker) holdGroupLocked(queueName string, stored *Message) {
+	if stored.GroupID == "" {
+		return
+	}
+	held := qb.groups[queueName]
+	if held == nil {
+		held = make(map[string]*Message)
+		qb.groups[queueName] = held
+	}
+	held[stored.GroupID] = stored
+}
+
+// releaseGroupLocked освобождает группу, если ее занимает stored, и будит
+// ожидающих: им могут стать доступны следующие сообщения группы
+func (qb *QueueBroker) releaseGroupLocked(queueName string, stored *Message) {
+	held := qb.groups[queueName]
+	if stored.GroupID == "" || held[stored.GroupID] != stored {
+		return
+	}
+	delete(held, stored.GroupID)
+	if len(held) == 0 {
+		delete(qb.groups, queueName)
+	}
+	if queue := qb.queues[queueName]; queue != nil {
+		queue.wake()
+	}
+}
+
+// groupHeldLocked сообщает, что stored занимает свою группу
+func (qb *QueueBroker) groupHeldLocked(queueName string, stored *Message) bool {
+	return stored.GroupID != "" && qb.groups[queueName][stored.GroupID] == stored
+}
+
+// returnLocked возвращает выданное сообщение в очередь для повторной выдачи.
+// Сообщение группы встает перед остальными сообщениями своей группы, чтобы
+// порядок внутри группы не нарушился.
+func (qb *QueueBroker) returnLocked(queueName string, stored *Message) {
+	queue := qb.queues[queueName]
+	if queue == nil {
+		return
+	}
+	qb.releaseGroupLocked(queueName, stored)
+	if stored.GroupID != "" {
+		for i, msg := range queue.messages {
+			if msg.GroupID == stored.GroupID {
+				queue.insertAt(i, stored)
+				return
+			}
+		}
+	}
+	queue.push(stored)
+}
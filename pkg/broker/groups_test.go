@@ -0,0 +1,89 @@
+package broker
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestMessageGroupsOrdering проверяет, что сообщения группы выдаются по одному
+// и по порядку, а другие группы при этом не ждут
+func TestMessageGroupsOrdering(t *testing.T) {
+	qb := NewQueueBroker(10, 10, 1)
+	qb.Enqueue("orders", &Message{Body: "a1", GroupID: "a"})
+	qb.Enqueue("orders", &Message{Body: "a2", GroupID: "a"})
+	qb.Enqueue("orders", &Message{Body: "b1", GroupID: "b"})
+	qb.Enqueue("orders", &Message{Body: "plain"})
+
+	a1, err := qb.PeekLock("orders", 0, time.Minute)
+	if err != nil || a1.Body != "a1" || a1.GroupID != "a" {
+		t.Fatalf("unexpected first delivery: %+v, %v", a1, err)
+	}
+	// a2 пропускается, пока a1 не подтверждено
+	for _, want := range []string{"b1", "plain"} {
+		msg, err := qb.Dequeue("orders", 0)
+		if err != nil || msg.Body != want {
+			t.Fatalf("expected %s, got %+v, %v", want, msg, err)
+		}
+	}
+	if _, err := qb.Dequeue("orders", 0); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("group message delivered while group is busy: %v", err)
+	}
+
+	// Подтверждение освобождает группу и будит ожидающего получателя
+	got := make(chan string, 1)
+	go func() {
+		msg, err := qb.Dequeue("orders", time.Second)
+		if err != nil {
+			got <- err.Error()
+			return
+		}
+		got <- msg.Body
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if err := qb.Complete("orders", a1.LockToken); err != nil {
+		t.Fatal(err)
+	}
+	if body := <-got; body != "a2" {
+		t.Fatalf("expected a2 after complete, got %s", body)
+	}
+}
+
+// TestMessageGroupsRedelivery проверяет, что возвращенное сообщение группы
+// выдается раньше следующих сообщений группы, в том числе после задержки повтора
+func TestMessageGroupsRedelivery(t *testing.T) {
+	qb := NewQueueBroker(10, 10, 1)
+	qb.Enqueue("jobs", &Message{Body: "g1", GroupID: "g"})
+	qb.Enqueue("jobs", &Message{Body: "g2", GroupID: "g"})
+
+	first, _ := qb.PeekLock("jobs", 0, time.Minute)
+	if err := qb.Abandon("jobs", first.LockToken); err != nil {
+		t.Fatal(err)
+	}
+	again, err := qb.PeekLock("jobs", 0, time.Minute)
+	if err != nil || again.Body != "g1" {
+		t.Fatalf("expected g1 to be redelivered first, got %+v, %v", again, err)
+	}
+
+	// С задержкой повтора группа остается занятой до повторной выдачи
+	qb.SetQueueConfig("jobs", QueueConfig{Retry: &RetryPolicy{InitialDelayMs: 50}})
+	if err := qb.Abandon("jobs", again.LockToken); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := qb.PeekLock("jobs", 0, time.Minute); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("g2 delivered while g1 waits for retry: %v", err)
+	}
+	retried, err := qb.PeekLock("jobs", time.Second, time.Minute)
+	if err != nil || retried.Body != "g1" {
+		t.Fatalf("expected retried g1, got %+v, %v", retried, err)
+	}
+
+	// Удаление выданного сообщения тоже освобождает группу
+	if err := qb.DeleteMessage("jobs", retried.Message.id); err != nil {
+		t.Fatal(err)
+	}
+	next, err := qb.PeekLock("jobs", 0, time.Minute)
+	if err != nil || next.Body != "g2" {
+		t.Fatalf("expected g2 after delete, got %+v, %v", next, err)
+	}
+}
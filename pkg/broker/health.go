@@ -0,0 +1,173 @@
+package broker
+
+import (
+	"sort"
+	"time"
+)
+
+// Состояния подсистем брокера
+const (
+	HealthOK       = "ok"
+	HealthDegraded = "degraded"
+	HealthDown     = "down"
+)
+
+// storageDegradedRatio доля лимита объема или числа очередей, после которой
+// хранилище считается перегруженным
+const storageDegradedRatio = 0.9
+
+// SubsystemHealth состояние подсистемы брокера
+type SubsystemHealth struct {
+	Status string `json:"status"`
+	// LastError последняя ошибка подсистемы; она сохраняется и после
+	// восстановления, чтобы были видны недавние сбои
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+	Detail      any        `json:"detail,omitempty"`
+}
+
+// HealthCheck возвращает текущее состояние подсистемы
+type HealthCheck func() SubsystemHealth
+
+// setLastError заполняет сведения о последней ошибке
+func (h *SubsystemHealth) setLastError(err error, at time.Time) {
+	if err == nil && at.IsZero() {
+		return
+	}
+	if err != nil {
+		h.LastError = err.Error()
+	}
+	if !at.IsZero() {
+		h.LastErrorAt = &at
+	}
+}
+
+// RegisterHealthCheck добавляет подсистему в сводку Health (например, мост
+// Kafka или уведомления); проверка вызывается без блокировки брокера
+func (qb *QueueBroker) RegisterHealthCheck(name string, check HealthCheck) {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	qb.healthChecks[name] = check
+}
+
+// Health возвращает состояние подсистем брокера: хранилища, фоновых таймеров,
+// репликации, кластера Raft, журнала предзаписи и федерации (если включены) и зарегистрированных
+// проверок
+func (qb *QueueBroker) Health() map[string]SubsystemHealth {
+	qb.mu.Lock()
+	health := map[string]SubsystemHealth{
+		"storage":  qb.storageHealthLocked(),
+		"janitors": qb.janitorsHealthLocked(),
+	}
+	federation, follower, consensus, wal := qb.federation, qb.follower, qb.consensus, qb.wal
+	checks := make(map[string]HealthCheck, len(qb.healthChecks))
+	for name, check := range qb.healthChecks {
+		checks[name] = check
+	}
+	qb.mu.Unlock()
+
+	if federation != nil {
+		health["federation"] = federation.health()
+	}
+	if follower != nil {
+		health["replication"] = follower.health()
+	}
+	if consensus != nil {
+		health["raft"] = consensus.health()
+	}
+	if wal != nil {
+		health["wal"] = wal.health()
+	}
+	for name, check := range checks {
+		health[name] = check()
+	}
+	return health
+}
+
+func (qb *QueueBroker) storageHealthLocked() SubsystemHealth {
+	queues := len(qb.queues)
+	if qb.queues[CanaryQueue] != nil {
+		queues--
+	}
+	h := SubsystemHealth{
+		Status: HealthOK,
+		Detail: map[string]any{
+			"queues":          queues,
+			"max_queues":      qb.maxQueues,
+			"total_bytes":     qb.totalBytes,
+			"max_total_bytes": qb.maxTotalBytes,
+		},
+	}
+	if float64(queues) >= storageDegradedRatio*float64(qb.maxQueues) ||
+		(qb.maxTotalBytes > 0 && float64(qb.totalBytes) >= storageDegradedRatio*float64(qb.maxTotalBytes)) {
+		h.Status = HealthDegraded
+	}
+	h.setLastError(qb.archiveError, qb.archiveErrorAt)
+	return h
+}
+
+// janitorsHealthLocked сведения о таймерах истечения блокировок и выдачи
+// отложенных сообщений; они срабатывают внутри процесса и не отказывают
+func (qb *QueueBroker) janitorsHealthLocked() SubsystemHealth {
+	delayed := 0
+	for _, list := range qb.delayed {
+		delayed += len(list)
+	}
+	return SubsystemHealth{
+		Status: HealthOK,
+		Detail: map[string]int{"lock_timers": len(qb.locks), "delayed_timers": delayed},
+	}
+}
+
+// federationPeerHealth состояние отправки одному пиру
+type federationPeerHealth struct {
+	URL       string `json:"url"`
+	Backlog   int    `json:"backlog"`
+	Dropped   int    `json:"dropped"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// health федерация деградирована, если отправка хотя бы одному пиру
+// не удается, и недоступна, если не удается отправка всем пирам
+func (f *Federation) health() SubsystemHealth {
+	h := SubsystemHealth{Status: HealthOK}
+	peers := make([]federationPeerHealth, 0, len(f.peers))
+	failing := 0
+	var lastAt time.Time
+	var lastErr error
+	for _, peer := range f.peers {
+		peer.mu.Lock()
+		p := federationPeerHealth{URL: peer.url, Backlog: len(peer.outbox), Dropped: peer.dropped}
+		if peer.lastError != nil {
+			failing++
+			p.LastError = peer.lastError.Error()
+		}
+		if peer.lastFailureAt.After(lastAt) {
+			lastAt, lastErr = peer.lastFailureAt, peer.lastFailure
+		}
+		peer.mu.Unlock()
+		peers = append(peers, p)
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].URL < peers[j].URL })
+	switch {
+	case failing > 0 && failing == len(peers):
+		h.Status = HealthDown
+	case failing > 0:
+		h.Status = HealthDegraded
+	}
+	h.setLastError(lastErr, lastAt)
+	h.Detail = map[string]any{"region": f.region, "peers": peers}
+	return h
+}
+
+// health резерв деградирован, пока нет связи с основным брокером
+func (f *Follower) health() SubsystemHealth {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	h := SubsystemHealth{Status: HealthOK, Detail: map[string]any{"primary": f.primary, "connected": f.connected}}
+	if !f.connected {
+		h.Status = HealthDegraded
+	}
+	h.setLastError(f.lastFailure, f.lastFailureAt)
+	return h
+}
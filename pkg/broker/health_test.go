@@ -0,0 +1,48 @@
+package broker
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestHealth проверяет состояние хранилища, федерации и зарегистрированных подсистем
+func TestHealth(t *testing.T) {
+	qb := NewQueueBroker(10, 2, 1)
+	health := qb.Health()
+	if health["storage"].Status != HealthOK || health["janitors"].Status != HealthOK {
+		t.Errorf("unexpected initial health: %+v", health)
+	}
+	if _, ok := health["federation"]; ok {
+		t.Error("federation reported without federation")
+	}
+
+	// Лимит очередей исчерпан, а запись архива не удалась
+	qb.Enqueue("a", &Message{Body: "a"})
+	qb.Enqueue("b", &Message{Body: "b"})
+	qb.SetArchive(failingArchive{})
+	if _, _, err := qb.ArchiveQueue("a"); err == nil {
+		t.Fatal("expected archive failure")
+	}
+	storage := qb.Health()["storage"]
+	if storage.Status != HealthDegraded || storage.LastError == "" || storage.LastErrorAt == nil {
+		t.Errorf("unexpected storage health: %+v", storage)
+	}
+
+	qb.RegisterHealthCheck("webhooks", func() SubsystemHealth { return SubsystemHealth{Status: HealthDown} })
+	if h := qb.Health()["webhooks"]; h.Status != HealthDown {
+		t.Errorf("registered check not reported: %+v", h)
+	}
+
+	f := NewFederation("eu", []string{"http://a", "http://b"}, time.Hour)
+	f.peers[0].lastError = errors.New("connection refused")
+	f.peers[0].lastFailure, f.peers[0].lastFailureAt = f.peers[0].lastError, time.Now()
+	qb.federation = f
+	if h := qb.Health()["federation"]; h.Status != HealthDegraded || h.LastError != "connection refused" {
+		t.Errorf("unexpected federation health: %+v", h)
+	}
+	f.peers[1].lastError = errors.New("timeout")
+	if h := qb.Health()["federation"]; h.Status != HealthDown {
+		t.Errorf("expected federation down, got %+v", h)
+	}
+}
@@ -0,0 +1,145 @@
+package broker
+
+import (
+	"sort"
+	"time"
+)
+
+// defaultHeartbeatTimeout через сколько секунд без сигнала жизни потребитель
+// считается потерянным, если время не задано при регистрации
+const defaultHeartbeatTimeout = 30
+
+// maxConsumerIDLength ограничение длины идентификатора потребителя
+const maxConsumerIDLength = 256
+
+// consumerSession зарегистрированный потребитель очереди
+type consumerSession struct {
+	id            string
+	queueName     string
+	lastHeartbeat time.Time
+	timeout       time.Duration
+	timer         *time.Timer
+}
+
+func (s *consumerSession) expiresAt() time.Time {
+	return s.lastHeartbeat.Add(s.timeout)
+}
+
+// ConsumerInfo состояние зарегистрированного потребителя
+type ConsumerInfo struct {
+	ID            string    `json:"id"`
+	LastHeartbeat time.Time `json:"last_heartbeat"`
+	// ExpiresAt срок, после которого без нового сигнала жизни выданные
+	// потребителю сообщения вернутся в очередь
+	ExpiresAt time.Time `json:"expires_at"`
+	// Timeout время ожидания сигнала жизни в секундах
+	Timeout int `json:"timeout"`
+	// InFlight число выданных потребителю сообщений без подтверждения
+	InFlight int `json:"in_flight"`
+	// Messages идентификаторы этих сообщений (как в просмотре очереди)
+	Messages []uint64 `json:"messages"`
+}
+
+// Heartbeat регистрирует потребителя очереди или продлевает его регистрацию.
+// Если следующий сигнал не придет за timeout (0 — прежнее значение, для
+// нового потребителя 30 с), выданные ему в режиме peek-lock сообщения
+// возвращаются в очередь, не дожидаясь истечения блокировок.
+func (qb *QueueBroker) Heartbeat(queueName, consumerID string, timeout time.Duration) (ConsumerInfo, error) {
+	if consumerID == "" || len(consumerID) > maxConsumerIDLength {
+		return ConsumerInfo{}, ErrInvalidConsumerID
+	}
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	return qb.consumerInfoLocked(qb.heartbeatLocked(queueName, consumerID, timeout)), nil
+}
+
+func (qb *QueueBroker) heartbeatLocked(queueName, consumerID string, timeout time.Duration) *consumerSession {
+	sessions := qb.heartbeats[queueName]
+	if sessions == nil {
+		sessions = make(map[string]*consumerSession)
+		qb.heartbeats[queueName] = sessions
+	}
+	s := sessions[consumerID]
+	if s == nil {
+		s = &consumerSession{id: consumerID, queueName: queueName, timeout: defaultHeartbeatTimeout * time.Second}
+		sessions[consumerID] = s
+	}
+	if timeout > 0 {
+		s.timeout = timeout
+	}
+	s.lastHeartbeat = time.Now()
+	if s.timer == nil {
+		s.timer = time.AfterFunc(s.timeout, func() { qb.expireConsumer(s) })
+	} else {
+		s.timer.Reset(s.timeout)
+	}
+	return s
+}
+
+// expireConsumer снимает регистрацию потребителя, пропустившего сигнал
+// жизни, и возвращает выданные ему сообщения в очередь
+func (qb *QueueBroker) expireConsumer(s *consumerSession) {
+	qb.mu.Lock()
+	if qb.heartbeats[s.queueName][s.id] != s || time.Now().Before(s.expiresAt()) {
+		qb.mu.Unlock()
+		return
+	}
+	qb.removeConsumerLocked(s)
+	var notify []func()
+	for token, lock := range qb.locks {
+		if lock.consumer != s {
+			continue
+		}
+		lock.timer.Stop()
+		delete(qb.locks, token)
+		qb.inflight[lock.queueName]--
+		if n := qb.retryLocked(lock.queueName, lock.msg, retryReasonConsumerLost); n != nil {
+			notify = append(notify, n)
+		}
+	}
+	qb.mu.Unlock()
+
+	for _, n := range notify {
+		n()
+	}
+}
+
+func (qb *QueueBroker) removeConsumerLocked(s *consumerSession) {
+	s.timer.Stop()
+	sessions := qb.heartbeats[s.queueName]
+	delete(sessions, s.id)
+	if len(sessions) == 0 {
+		delete(qb.heartbeats, s.queueName)
+	}
+}
+
+func (qb *QueueBroker) consumerInfoLocked(s *consumerSession) ConsumerInfo {
+	info := ConsumerInfo{
+		ID:            s.id,
+		LastHeartbeat: s.lastHeartbeat,
+		ExpiresAt:     s.expiresAt(),
+		Timeout:       lockSeconds(s.timeout),
+		Messages:      []uint64{},
+	}
+	for _, lock := range qb.locks {
+		if lock.consumer == s {
+			info.Messages = append(info.Messages, lock.msg.id)
+		}
+	}
+	sort.Slice(info.Messages, func(i, j int) bool { return info.Messages[i] < info.Messages[j] })
+	info.InFlight = len(info.Messages)
+	return info
+}
+
+// RegisteredConsumers возвращает зарегистрированных потребителей очереди
+// по возрастанию идентификатора
+func (qb *QueueBroker) RegisteredConsumers(queueName string) []ConsumerInfo {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	infos := make([]ConsumerInfo, 0, len(qb.heartbeats[queueName]))
+	for _, s := range qb.heartbeats[queueName] {
+		infos = append(infos, qb.consumerInfoLocked(s))
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
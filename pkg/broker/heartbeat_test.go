@@ -0,0 +1,85 @@
+package broker
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestConsumerHeartbeat проверяет возврат сообщений потребителя, пропустившего
+// сигнал жизни, до истечения блокировок
+func TestConsumerHeartbeat(t *testing.T) {
+	qb := NewQueueBroker(10, 10, 1)
+	qb.Enqueue("jobs", &Message{Body: "a"})
+	qb.Enqueue("jobs", &Message{Body: "b"})
+
+	if _, err := qb.Heartbeat("jobs", "w1", 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := qb.PeekLockAs("jobs", "w1", 0, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	anonymous, err := qb.PeekLock("jobs", 0, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	consumers := qb.RegisteredConsumers("jobs")
+	if len(consumers) != 1 || consumers[0].ID != "w1" || consumers[0].InFlight != 1 || consumers[0].Timeout != 1 {
+		t.Fatalf("unexpected consumers %+v", consumers)
+	}
+
+	for deadline := time.Now().Add(time.Second); qb.Depth("jobs") != 1; {
+		if time.Now().After(deadline) {
+			t.Fatal("message of lost consumer was not returned")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if consumers := qb.RegisteredConsumers("jobs"); len(consumers) != 0 {
+		t.Errorf("lost consumer must be unregistered, got %+v", consumers)
+	}
+	if msg, err := qb.Dequeue("jobs", 0); err != nil || msg.Body != "a" {
+		t.Errorf("expected returned message, got %v %v", msg, err)
+	}
+	// Сообщение без потребителя остается заблокированным
+	if err := qb.Complete("jobs", anonymous.LockToken); err != nil {
+		t.Errorf("anonymous lock must survive: %v", err)
+	}
+}
+
+// TestConsumerHeartbeatRenew проверяет, что сигналы жизни и продление
+// блокировки сохраняют сообщения за потребителем
+func TestConsumerHeartbeatRenew(t *testing.T) {
+	qb := NewQueueBroker(10, 10, 1)
+	qb.SetQueueConfig("jobs", QueueConfig{LockDuration: 30, Retry: &RetryPolicy{MaxAttempts: 1}})
+	qb.Enqueue("jobs", &Message{Body: "a"})
+
+	qb.Heartbeat("jobs", "w1", 60*time.Millisecond)
+	delivery, err := qb.PeekLockAs("jobs", "w1", 0, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 3 {
+		time.Sleep(30 * time.Millisecond)
+		if _, err := qb.RenewLock("jobs", delivery.LockToken, time.Minute); err != nil {
+			t.Fatalf("lock lost while consumer is alive: %v", err)
+		}
+	}
+
+	// После потери потребителя сообщение уходит по политике повторов
+	// в очередь недоставленных с причиной consumer_lost
+	msg, err := qb.Dequeue("jobs.dlq", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Headers[DeadLetterReasonHeader] != retryReasonConsumerLost {
+		t.Errorf("unexpected dead letter reason %q", msg.Headers[DeadLetterReasonHeader])
+	}
+	if _, err := qb.RenewLock("jobs", delivery.LockToken, time.Minute); !errors.Is(err, ErrLockNotFound) {
+		t.Errorf("expected ErrLockNotFound, got %v", err)
+	}
+
+	if _, err := qb.Heartbeat("jobs", "", 0); !errors.Is(err, ErrInvalidConsumerID) {
+		t.Errorf("expected ErrInvalidConsumerID, got %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package broker
+
+import "time"
+
+// idleTimer отслеживает простой очереди с AutoDeleteAfterIdle
+type idleTimer struct {
+	// lastUsed время последней постановки или выдачи сообщения
+	lastUsed time.Time
+	timer    *time.Timer
+}
+
+// touchLocked отмечает постановку или выдачу сообщения очереди и, если для
+// нее задано AutoDeleteAfterIdle, запускает отсчет простоя
+func (qb *QueueBroker) touchLocked(queueName string) {
+	if t := qb.idle[queueName]; t != nil {
+		t.lastUsed = time.Now()
+		return
+	}
+	after := qb.idleAfterLocked(queueName)
+	if after <= 0 || queueName == CanaryQueue || qb.queues[queueName] == nil {
+		return
+	}
+	t := &idleTimer{lastUsed: time.Now()}
+	t.timer = time.AfterFunc(after, func() { qb.expireIdle(queueName, t) })
+	qb.idle[queueName] = t
+}
+
+// idleAfterLocked через сколько простоя очередь удаляется (0 — никогда)
+func (qb *QueueBroker) idleAfterLocked(queueName string) time.Duration {
+	return time.Duration(qb.queueConfigLocked(queueName).AutoDeleteAfterIdle) * time.Minute
+}
+
+// expireIdle удаляет очередь, простоявшую AutoDeleteAfterIdle: без постановок
+// и выдач, без подключенных потребителей и заблокированных сообщений.
+// Если очередь использовалась, отсчет продолжается от последнего обращения.
+func (qb *QueueBroker) expireIdle(queueName string, t *idleTimer) {
+	qb.mu.Lock()
+	if qb.idle[queueName] != t {
+		qb.mu.Unlock()
+		return
+	}
+	after := qb.idleAfterLocked(queueName)
+	if after <= 0 || qb.queues[queueName] == nil {
+		delete(qb.idle, queueName)
+		qb.mu.Unlock()
+		return
+	}
+	if qb.consumers[queueName] > 0 || qb.inflight[queueName] > 0 || qb.archiving[queueName] {
+		t.lastUsed = time.Now()
+	}
+	if idle := time.Since(t.lastUsed); idle < after {
+		t.timer.Reset(after - idle)
+		qb.mu.Unlock()
+		return
+	}
+	qb.deleteQueueLocked(queueName)
+	qb.mu.Unlock()
+	qb.notifyQueueListeners(QueueDeleted, queueName)
+}
+
+// stopIdleLocked прекращает отсчет простоя удаляемой очереди
+func (qb *QueueBroker) stopIdleLocked(queueName string) {
+	if t := qb.idle[queueName]; t != nil {
+		t.timer.Stop()
+		delete(qb.idle, queueName)
+	}
+}
@@ -0,0 +1,59 @@
+package broker
+
+import (
+	"testing"
+	"time"
+)
+
+// TestAutoDeleteAfterIdle проверяет удаление простаивающей очереди
+func TestAutoDeleteAfterIdle(t *testing.T) {
+	qb := NewQueueBroker(10, 1, 10)
+	qb.SetQueueConfig("tmp", QueueConfig{LockDuration: 30, AutoDeleteAfterIdle: 1})
+	if err := qb.PutMessage("tmp", "x"); err != nil {
+		t.Fatal(err)
+	}
+	expire := func(idle time.Duration) {
+		qb.mu.Lock()
+		timer := qb.idle["tmp"]
+		if timer == nil {
+			qb.mu.Unlock()
+			t.Fatal("idle timer was not started")
+		}
+		timer.lastUsed = time.Now().Add(-idle)
+		qb.mu.Unlock()
+		qb.expireIdle("tmp", timer)
+	}
+
+	// Очередь использовалась недавно
+	expire(30 * time.Second)
+	if len(qb.QueueNames()) != 1 {
+		t.Fatal("recently used queue was deleted")
+	}
+
+	// Заблокированное сообщение — признак использования
+	delivery, err := qb.PeekLock("tmp", 0, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expire(2 * time.Minute)
+	if len(qb.QueueNames()) != 1 {
+		t.Fatal("queue with a locked message was deleted")
+	}
+
+	if err := qb.Complete("tmp", delivery.LockToken); err != nil {
+		t.Fatal(err)
+	}
+	expire(2 * time.Minute)
+	if len(qb.QueueNames()) != 0 {
+		t.Fatal("idle queue was not deleted")
+	}
+	// Место в лимите очередей освободилось
+	if err := qb.PutMessage("other", "y"); err != nil {
+		t.Fatal(err)
+	}
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	if qb.idle["other"] != nil {
+		t.Error("idle timer started for queue without auto deletion")
+	}
+}
@@ -0,0 +1,189 @@
+package broker
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Keyring ключи шифрования тел сообщений при хранении. Сообщения арендаторов
+// шифруются ключами арендаторов, остальные — текущим ключом набора.
+type Keyring struct {
+	// Current идентификатор ключа, которым шифруются новые сообщения
+	Current string `json:"current"`
+	// Keys ключи AES-256 (32 байта, в JSON — base64) по идентификаторам.
+	// Прежний ключ нужен, пока им зашифровано хоть одно хранимое сообщение.
+	Keys map[string][]byte `json:"keys"`
+}
+
+// KeyStatus состояние шифрования при хранении
+type KeyStatus struct {
+	Current string   `json:"current"`
+	Keys    []string `json:"keys,omitempty"`
+	// Messages число хранимых сообщений, зашифрованных каждым ключом
+	Messages map[string]int `json:"messages"`
+	// Reencrypting идет перешифрование сообщений текущим ключом
+	Reencrypting bool `json:"reencrypting"`
+}
+
+// ErrKeyInUse в новом наборе нет ключа, которым зашифрованы хранимые сообщения
+var ErrKeyInUse = newError("KEY_IN_USE", "key is still used by stored messages")
+
+// reencryptBatch сколько сообщений перешифровывается за одну блокировку брокера
+const reencryptBatch = 1000
+
+type keyring struct {
+	current string
+	aeads   map[string]cipher.AEAD
+}
+
+// aead возвращает ключ по идентификатору; nil-безопасен
+func (k *keyring) aead(id string) cipher.AEAD {
+	if k == nil {
+		return nil
+	}
+	return k.aeads[id]
+}
+
+// ParseKeyring разбирает набор ключей в JSON
+// ({"current": "k2", "keys": {"k1": "<base64>", "k2": "<base64>"}})
+func ParseKeyring(data []byte) (*Keyring, error) {
+	var kr Keyring
+	if err := json.Unmarshal(data, &kr); err != nil {
+		return nil, fmt.Errorf("parse keyring: %w", err)
+	}
+	return &kr, nil
+}
+
+// SetKeyring включает шифрование тел сообщений при хранении или меняет
+// набор ключей: новые сообщения шифруются ключом Current, уже хранимые
+// остаются зашифрованными прежними ключами до перешифрования (см. Reencrypt).
+// Набор без ключа, которым зашифровано хоть одно сообщение, не принимается.
+func (qb *QueueBroker) SetKeyring(kr *Keyring) error {
+	if _, ok := kr.Keys[kr.Current]; !ok {
+		return fmt.Errorf("keyring: no current key %q", kr.Current)
+	}
+	ring := &keyring{current: kr.Current, aeads: make(map[string]cipher.AEAD, len(kr.Keys))}
+	for id, key := range kr.Keys {
+		if id == "" {
+			return errors.New("keyring: empty key id")
+		}
+		if len(key) != 32 {
+			return fmt.Errorf("keyring: key %s must be 32 bytes", id)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return err
+		}
+		if ring.aeads[id], err = cipher.NewGCM(block); err != nil {
+			return err
+		}
+	}
+
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	for id, count := range qb.keyUsageLocked() {
+		if _, ok := ring.aeads[id]; !ok {
+			return fmt.Errorf("keyring: key %s: %w (%d messages)", id, ErrKeyInUse, count)
+		}
+	}
+	qb.keys = ring
+	return nil
+}
+
+// KeyStatus возвращает текущий ключ и число сообщений под каждым ключом
+func (qb *QueueBroker) KeyStatus() KeyStatus {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	status := KeyStatus{Messages: qb.keyUsageLocked(), Reencrypting: qb.reencrypting}
+	if qb.keys != nil {
+		status.Current = qb.keys.current
+		for id := range qb.keys.aeads {
+			status.Keys = append(status.Keys, id)
+		}
+		sort.Strings(status.Keys)
+	}
+	return status
+}
+
+// keyUsageLocked считает хранимые сообщения по ключам шифрования
+func (qb *QueueBroker) keyUsageLocked() map[string]int {
+	usage := make(map[string]int)
+	for _, messages := range qb.storedMessagesLocked() {
+		for _, stored := range messages {
+			if stored.keyID != "" {
+				usage[stored.keyID]++
+			}
+		}
+	}
+	return usage
+}
+
+// Reencrypt перешифровывает текущим ключом сообщения очередей, зашифрованные
+// прежними ключами, порциями по reencryptBatch, отпуская блокировку между
+// ними. Выданные и отложенные сообщения перешифровываются, когда вернутся
+// в очередь, при следующем вызове. Возвращает число перешифрованных сообщений;
+// одновременно выполняется только один вызов, остальные сразу возвращают 0.
+func (qb *QueueBroker) Reencrypt() int {
+	qb.mu.Lock()
+	if qb.reencrypting || qb.keys == nil {
+		qb.mu.Unlock()
+		return 0
+	}
+	qb.reencrypting = true
+	qb.mu.Unlock()
+	defer func() {
+		qb.mu.Lock()
+		qb.reencrypting = false
+		qb.mu.Unlock()
+	}()
+
+	total := 0
+	for {
+		n := qb.reencryptSome()
+		total += n
+		if n < reencryptBatch {
+			return total
+		}
+	}
+}
+
+// reencryptSome перешифровывает до reencryptBatch сообщений. Хранимые
+// сообщения не изменяются (их читают без блокировки), а заменяются новыми.
+func (qb *QueueBroker) reencryptSome() int {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	ring := qb.keys
+	n := 0
+	for _, queue := range qb.queues {
+		for i, stored := range queue.messages {
+			if stored.keyID == "" || stored.keyID == ring.current {
+				continue
+			}
+			aead := ring.aeads[stored.keyID]
+			if aead == nil {
+				continue
+			}
+			body, err := open(aead, keyAAD(stored.keyID), []byte(stored.Body))
+			if err != nil {
+				continue
+			}
+			replaced := *stored
+			replaced.Body = string(seal(ring.aeads[ring.current], keyAAD(ring.current), body))
+			replaced.keyID = ring.current
+			queue.messages[i] = &replaced
+			if n++; n == reencryptBatch {
+				return n
+			}
+		}
+	}
+	return n
+}
+
+// keyAAD дополнительные данные шифротекста: привязывают его к ключу
+func keyAAD(keyID string) string {
+	return "key:" + keyID
+}
@@ -0,0 +1,99 @@
+package broker
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testKeyring(current string, ids ...string) *Keyring {
+	kr := &Keyring{Current: current, Keys: make(map[string][]byte)}
+	for _, id := range ids {
+		kr.Keys[id] = bytes.Repeat([]byte(id[:1]), 32)
+	}
+	return kr
+}
+
+// TestKeyring проверяет шифрование тел при хранении, смену ключа
+// и перешифрование хранимых сообщений
+func TestKeyring(t *testing.T) {
+	qb := NewQueueBroker(100, 10, 10)
+	if err := qb.SetKeyring(&Keyring{Current: "a", Keys: map[string][]byte{"a": []byte("short")}}); err == nil {
+		t.Fatal("short key was accepted")
+	}
+	if err := qb.SetKeyring(testKeyring("b", "a")); err == nil {
+		t.Fatal("keyring without current key was accepted")
+	}
+	if err := qb.SetKeyring(testKeyring("a", "a")); err != nil {
+		t.Fatal(err)
+	}
+	qb.SetDefaultCompressThreshold(16)
+	secret := strings.Repeat("card number 4111 ", 10)
+	qb.PutMessage("payments", secret)
+	qb.PutMessage("payments", "short secret")
+	for _, stored := range qb.queues["payments"].messages {
+		if stored.keyID != "a" || strings.Contains(stored.Body, "secret") || strings.Contains(stored.Body, "card") {
+			t.Fatalf("body is not encrypted: key %q", stored.keyID)
+		}
+	}
+
+	if err := qb.SetKeyring(testKeyring("b", "b")); !errors.Is(err, ErrKeyInUse) {
+		t.Fatalf("expected ErrKeyInUse, got %v", err)
+	}
+	if err := qb.SetKeyring(testKeyring("b", "a", "b")); err != nil {
+		t.Fatal(err)
+	}
+	qb.PutMessage("payments", "new secret")
+	if status := qb.KeyStatus(); status.Current != "b" || status.Messages["a"] != 2 || status.Messages["b"] != 1 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+	if n := qb.Reencrypt(); n != 2 {
+		t.Errorf("expected 2 reencrypted messages, got %d", n)
+	}
+	if status := qb.KeyStatus(); status.Messages["a"] != 0 || status.Messages["b"] != 3 || status.Reencrypting {
+		t.Fatalf("unexpected status after reencryption %+v", status)
+	}
+	if err := qb.SetKeyring(testKeyring("b", "b")); err != nil {
+		t.Fatalf("retired key is still required: %v", err)
+	}
+
+	for _, want := range []string{secret, "short secret", "new secret"} {
+		if message, err := qb.GetMessage("payments", time.Second); err != nil || message != want {
+			t.Errorf("got %q (%v), want %q", message, err, want)
+		}
+	}
+}
+
+// TestKeyringSnapshot проверяет, что снимок хранит тела зашифрованными
+// и восстанавливается только с ключом
+func TestKeyringSnapshot(t *testing.T) {
+	qb := NewQueueBroker(100, 10, 10)
+	qb.SetKeyring(testKeyring("a", "a"))
+	qb.PutMessage("payments", "secret")
+
+	data, err := EncodeSnapshot(qb.Snapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("secret")) || !bytes.Contains(data, []byte(`"key_id":"a"`)) {
+		t.Fatalf("snapshot is not encrypted: %s", data)
+	}
+	snap, err := DecodeSnapshot(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := NewQueueBroker(100, 10, 10).Restore(snap); err == nil {
+		t.Error("snapshot was restored without key")
+	}
+	restored := NewQueueBroker(100, 10, 10)
+	restored.SetKeyring(testKeyring("a", "a"))
+	if err := restored.Restore(snap); err != nil {
+		t.Fatal(err)
+	}
+	if message, err := restored.GetMessage("payments", time.Second); err != nil || message != "secret" {
+		t.Errorf("got %q (%v)", message, err)
+	}
+}
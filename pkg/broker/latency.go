@@ -0,0 +1,36 @@
+package broker
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// SetLatencySimulation разрешает искусственную задержку выдачи сообщений
+// (DeliveryDelayMs и DeliveryJitterMs в настройках очереди). Предназначено
+// для тестовых стендов; без этого задержки из настроек не применяются.
+func (qb *QueueBroker) SetLatencySimulation(enabled bool) {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	qb.latencySimulation = enabled
+}
+
+// LatencySimulation сообщает, разрешена ли искусственная задержка выдачи
+func (qb *QueueBroker) LatencySimulation() bool {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	return qb.latencySimulation
+}
+
+// simulatedDelayLocked возвращает задержку выдачи очередного сообщения
+// очереди: постоянная часть плюс случайная в пределах [0, jitter]
+func (qb *QueueBroker) simulatedDelayLocked(queueName string) time.Duration {
+	if !qb.latencySimulation || queueName == CanaryQueue {
+		return 0
+	}
+	cfg := qb.queueConfigLocked(queueName)
+	delay := time.Duration(cfg.DeliveryDelayMs) * time.Millisecond
+	if cfg.DeliveryJitterMs > 0 {
+		delay += time.Duration(rand.IntN(cfg.DeliveryJitterMs+1)) * time.Millisecond
+	}
+	return delay
+}
@@ -0,0 +1,41 @@
+package broker
+
+import (
+	"testing"
+	"time"
+)
+
+// TestSimulatedLatency проверяет задержку выдачи и ее отключение вне тестового стенда
+func TestSimulatedLatency(t *testing.T) {
+	qb := NewQueueBroker(10, 10, 1)
+	qb.SetQueueConfig("slow", QueueConfig{LockDuration: 30, DeliveryDelayMs: 100, DeliveryJitterMs: 50})
+	qb.Enqueue("slow", &Message{Body: "a"})
+	qb.Enqueue("slow", &Message{Body: "b"})
+
+	// Без SetLatencySimulation настройки задержки игнорируются
+	start := time.Now()
+	if _, err := qb.Dequeue("slow", 0); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed >= 100*time.Millisecond {
+		t.Errorf("delay applied without simulation enabled: %v", elapsed)
+	}
+
+	qb.SetLatencySimulation(true)
+	start = time.Now()
+	if _, err := qb.PeekLock("slow", 0, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > time.Second {
+		t.Errorf("unexpected simulated delay: %v", elapsed)
+	}
+
+	for i := 0; i < 100; i++ {
+		qb.mu.Lock()
+		delay := qb.simulatedDelayLocked("slow")
+		qb.mu.Unlock()
+		if delay < 100*time.Millisecond || delay > 150*time.Millisecond {
+			t.Fatalf("delay out of range: %v", delay)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package broker
+
+import "time"
+
+// findMessageLocked ищет хранимое сообщение очереди по идентификатору среди
+// ожидающих, выданных в режиме peek-lock, отложенных и закрепленных за
+// потоковыми потребителями. remove извлекает найденное сообщение, снимая его
+// блокировку или таймер; объем сообщения при этом не освобождается.
+func (qb *QueueBroker) findMessageLocked(queueName string, id uint64) (*Message, func(), bool) {
+	queue := qb.queues[queueName]
+	for i, stored := range queue.messages {
+		if stored.id == id {
+			return stored, func() { queue.removeAt(i) }, true
+		}
+	}
+	for token, lock := range qb.locks {
+		if lock.queueName == queueName && lock.msg.id == id {
+			return lock.msg, func() {
+				lock.timer.Stop()
+				delete(qb.locks, token)
+				qb.inflight[queueName]--
+			}, true
+		}
+	}
+	for _, d := range qb.delayed[queueName] {
+		if d.msg.id == id {
+			return d.msg, func() {
+				d.timer.Stop()
+				qb.removeDelayedLocked(queueName, d)
+			}, true
+		}
+	}
+	if aff := qb.affinity[queueName]; aff != nil {
+		for _, owner := range aff.owners {
+			for i, stored := range owner.mailbox {
+				if stored.id == id {
+					return stored, func() { owner.mailbox = append(owner.mailbox[:i:i], owner.mailbox[i+1:]...) }, true
+				}
+			}
+		}
+	}
+	return nil, nil, false
+}
+
+// messageActionLocked проверяет, что с сообщениями очереди можно работать
+func (qb *QueueBroker) messageActionLocked(queueName string) error {
+	if qb.queues[queueName] == nil {
+		return ErrQueueNotFound
+	}
+	if err := qb.standbyLocked(queueName); err != nil {
+		return err
+	}
+	if qb.archiving[queueName] {
+		return ErrQueueArchiving
+	}
+	return nil
+}
+
+// DeleteMessage удаляет сообщение очереди по идентификатору (см. Browse),
+// где бы оно ни находилось: ожидающее, выданное, но не подтвержденное
+// (его блокировка теряется), или отложенное
+func (qb *QueueBroker) DeleteMessage(queueName string, id uint64) error {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	if err := qb.messageActionLocked(queueName); err != nil {
+		return err
+	}
+	stored, remove, ok := qb.findMessageLocked(queueName, id)
+	if !ok {
+		return ErrMessageNotFound
+	}
+	remove()
+	qb.releaseLocked(queueName, stored)
+	return nil
+}
+
+// RequeueMessage возвращает сообщение очереди в конец очереди target для
+// немедленной выдачи. Пустой target — очередь, из которой сообщение попало
+// в очередь недоставленных (заголовок DeadLetterSourceHeader), а если его
+// нет — та же очередь (так снимается блокировка или задержка). При переносе
+// в другую очередь сообщение получает новый идентификатор, теряет заголовки
+// повторов и проверяется схемой и ограничениями очереди назначения, а ее окно
+// дедупликации его не отбрасывает. Перенос не передается пирам федерации.
+func (qb *QueueBroker) RequeueMessage(queueName string, id uint64, target string) error {
+	qb.mu.Lock()
+	if err := qb.messageActionLocked(queueName); err != nil {
+		qb.mu.Unlock()
+		return err
+	}
+	stored, remove, ok := qb.findMessageLocked(queueName, id)
+	if !ok {
+		qb.mu.Unlock()
+		return ErrMessageNotFound
+	}
+	if target == "" {
+		target = stored.Headers[DeadLetterSourceHeader]
+	}
+	if target == "" || target == queueName {
+		remove()
+		qb.releaseGroupLocked(queueName, stored)
+		qb.queues[queueName].push(stored)
+		qb.mu.Unlock()
+		return nil
+	}
+	if TenantOf(target) != TenantOf(queueName) {
+		qb.mu.Unlock()
+		return ErrCrossTenant
+	}
+
+	headers := make(map[string]string, len(stored.Headers))
+	for name, value := range stored.Headers {
+		switch name {
+		case RetryCountHeader, DeadLetterSourceHeader, DeadLetterReasonHeader:
+		default:
+			headers[name] = value
+		}
+	}
+	msg, err := qb.moveLocked(queueName, stored, remove, target, headers)
+	listeners := qb.enqueueListeners
+	qb.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	for _, listener := range listeners {
+		listener(target, msg)
+	}
+	return qb.persist()
+}
+
+// moveLocked переносит хранимое сообщение очереди queueName в конец очереди
+// target как новое сообщение с заголовками headers; окно дедупликации target
+// его не отбрасывает. remove извлекает сообщение из исходного места и
+// вызывается, только если очередь назначения приняла сообщение.
+func (qb *QueueBroker) moveLocked(queueName string, stored *Message, remove func(), target string, headers map[string]string) (*Message, error) {
+	// Очередь назначения может сжимать и шифровать тела по-своему
+	unpacked, err := qb.unpackLocked(stored)
+	if err != nil {
+		return nil, err
+	}
+	msg := &Message{Body: unpacked.Body, Headers: headers, DedupID: unpacked.DedupID, ContentType: unpacked.ContentType, GroupID: unpacked.GroupID}
+
+	var seenAt time.Time
+	remembered := false
+	dedup := qb.dedup[target]
+	if dedup != nil && msg.DedupID != "" {
+		seenAt, remembered = dedup.seen[msg.DedupID]
+		delete(dedup.seen, msg.DedupID)
+	}
+	if err := qb.enqueueLocked(target, msg); err != nil {
+		if remembered {
+			dedup.seen[msg.DedupID] = seenAt
+		}
+		return nil, err
+	}
+	remove()
+	qb.releaseLocked(queueName, stored)
+	qb.notifyTapsLocked(target, msg)
+	return msg, nil
+}
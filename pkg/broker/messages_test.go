@@ -0,0 +1,84 @@
+package broker
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestDeleteMessage проверяет удаление ожидающего, выданного и отложенного сообщения
+func TestDeleteMessage(t *testing.T) {
+	qb := NewQueueBroker(10, 10, 1)
+	qb.Enqueue("jobs", &Message{Body: "locked"})
+	qb.Enqueue("jobs", &Message{Body: "pending"})
+	qb.Enqueue("jobs", &Message{Body: "delayed", DeliverAt: time.Now().Add(time.Hour)})
+	delivery, err := qb.PeekLock("jobs", 0, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _, _ := qb.Browse("jobs", 0, 10)
+	scheduled, _ := qb.Scheduled("jobs")
+
+	for _, id := range []uint64{delivery.id, page[0].ID, scheduled[0].ID} {
+		if err := qb.DeleteMessage("jobs", id); err != nil {
+			t.Fatalf("DeleteMessage(%d) = %v", id, err)
+		}
+	}
+	if qb.Depth("jobs") != 0 || qb.QueueBytes("jobs") != 0 {
+		t.Errorf("unexpected state after delete: depth %d, bytes %d", qb.Depth("jobs"), qb.QueueBytes("jobs"))
+	}
+	if err := qb.Complete("jobs", delivery.LockToken); !errors.Is(err, ErrLockNotFound) {
+		t.Errorf("expected lock of deleted message to be gone, got %v", err)
+	}
+	if scheduled, _ := qb.Scheduled("jobs"); len(scheduled) != 0 {
+		t.Errorf("deleted delayed message still scheduled")
+	}
+	if err := qb.DeleteMessage("jobs", page[0].ID); !errors.Is(err, ErrMessageNotFound) {
+		t.Errorf("expected ErrMessageNotFound, got %v", err)
+	}
+	if err := qb.DeleteMessage("missing", 1); !errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("expected ErrQueueNotFound, got %v", err)
+	}
+}
+
+// TestRequeueMessage проверяет возврат сообщения в ту же и в другую очередь
+func TestRequeueMessage(t *testing.T) {
+	qb := NewQueueBroker(10, 10, 1)
+	qb.SetQueueConfig("jobs", QueueConfig{DedupWindow: 60})
+	qb.Enqueue("jobs", &Message{Body: "poison", DedupID: "p1", Headers: map[string]string{"k": "v"}})
+	delivery, err := qb.PeekLock("jobs", 0, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qb.Enqueue("jobs.dlq", &Message{Body: "dead", DedupID: "p1"})
+
+	// Возврат в ту же очередь снимает блокировку
+	if err := qb.RequeueMessage("jobs", delivery.id, ""); err != nil {
+		t.Fatal(err)
+	}
+	if qb.Depth("jobs") != 1 {
+		t.Fatalf("expected requeued message to be pending, depth %d", qb.Depth("jobs"))
+	}
+	qb.Dequeue("jobs", 0)
+
+	// Перенос из очереди недоставленных не отбрасывается дедупликацией
+	page, _, _ := qb.Browse("jobs.dlq", 0, 1)
+	if err := qb.RequeueMessage("jobs.dlq", page[0].ID, "jobs"); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := qb.Dequeue("jobs", 0)
+	if err != nil || msg.Body != "dead" || msg.DedupID != "p1" {
+		t.Errorf("unexpected requeued message: %+v %v", msg, err)
+	}
+	if qb.Depth("jobs.dlq") != 0 || qb.QueueBytes("jobs.dlq") != 0 {
+		t.Errorf("message left in source queue")
+	}
+	if err := qb.RequeueMessage("jobs", 999, "other"); !errors.Is(err, ErrMessageNotFound) {
+		t.Errorf("expected ErrMessageNotFound, got %v", err)
+	}
+	qb.Enqueue("jobs", &Message{Body: "x"})
+	page, _, _ = qb.Browse("jobs", 0, 1)
+	if err := qb.RequeueMessage("jobs", page[0].ID, "@acme.jobs"); !errors.Is(err, ErrCrossTenant) {
+		t.Errorf("expected ErrCrossTenant, got %v", err)
+	}
+}
@@ -0,0 +1,174 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// ClaimCheckHeader заголовок сообщения, тело которого вынесено во внешнее
+// хранилище; значение — ключ объекта. Заголовок с таким именем,
+// переданный при постановке, отбрасывается.
+const ClaimCheckHeader = "X-Claim-Check"
+
+// ClaimCheckURLHeader заголовок выданного сообщения со ссылкой с подписью
+// на вынесенное тело (режим OffloadConfig.PresignTTL)
+const ClaimCheckURLHeader = "X-Claim-Check-Url"
+
+// BlobStore хранилище вынесенных тел сообщений (например, objstore.Store)
+type BlobStore interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+}
+
+// Presigner хранилище, умеющее выдавать ссылки с подписью на объекты
+type Presigner interface {
+	Presign(key string, expires time.Duration) (string, error)
+}
+
+// BlobRefCounter хранилище, учитывающее ссылки сообщений на вынесенные тела
+// (например, segment.Store): брокер вызывает Retain, когда сообщение с телом
+// попадает в очередь или журнал, и Release, когда оно окончательно удалено,
+// так что хранилище может освободить место
+type BlobRefCounter interface {
+	Retain(key string)
+	Release(key string)
+}
+
+// OffloadConfig настройки выноса больших тел сообщений
+type OffloadConfig struct {
+	// Threshold размер тела в байтах, начиная с которого тело выносится в хранилище
+	Threshold int
+	// PresignTTL ненулевой — при выдаче тело не загружается: сообщение
+	// содержит ключ объекта и ссылку с подписью, действующую указанное время
+	// (если хранилище реализует Presigner)
+	PresignTTL time.Duration
+	// SpillBytes ненулевой — объем очереди в памяти, сверх которого тела самых
+	// старых сообщений выгружаются в хранилище (см. spill)
+	SpillBytes int64
+}
+
+// SetOffload включает вынос больших тел сообщений во внешнее хранилище:
+// в очереди остается только ссылка на объект (claim check), а тело загружается
+// обратно при выдаче
+func (qb *QueueBroker) SetOffload(store BlobStore, cfg OffloadConfig) {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	qb.offloadStore = store
+	qb.offload = cfg
+	if cfg.SpillBytes > 0 && !qb.spillListener {
+		qb.spillListener = true
+		qb.enqueueListeners = append(qb.enqueueListeners, func(queueName string, _ *Message) {
+			qb.spill(queueName)
+		})
+	}
+}
+
+// retainBodyLocked учитывает ссылку сообщения на вынесенное тело
+func (qb *QueueBroker) retainBodyLocked(stored *Message) {
+	if refs, ok := qb.offloadStore.(BlobRefCounter); ok && stored.Headers[ClaimCheckHeader] != "" {
+		refs.Retain(stored.Headers[ClaimCheckHeader])
+	}
+}
+
+// releaseBodyLocked снимает ссылку удаленного сообщения на вынесенное тело
+func (qb *QueueBroker) releaseBodyLocked(stored *Message) {
+	if refs, ok := qb.offloadStore.(BlobRefCounter); ok && stored.Headers[ClaimCheckHeader] != "" {
+		refs.Release(stored.Headers[ClaimCheckHeader])
+	}
+}
+
+// dropClaimCheck убирает заголовок ClaimCheckHeader, переданный при постановке:
+// иначе клиент мог бы получить чужой объект хранилища
+func dropClaimCheck(msg *Message) {
+	if _, ok := msg.Headers[ClaimCheckHeader]; !ok {
+		return
+	}
+	headers := make(map[string]string, len(msg.Headers))
+	for k, v := range msg.Headers {
+		if k != ClaimCheckHeader {
+			headers[k] = v
+		}
+	}
+	msg.Headers = headers
+}
+
+// offloadBody выносит тело сообщения, поставленного в очередь queueName,
+// в хранилище. Тела сообщений арендаторов шифруются его ключом. Схема
+// очереди проверяется до выноса, так как в очереди остается только ссылка.
+func (qb *QueueBroker) offloadBody(queueName string, msg *Message) error {
+	qb.mu.Lock()
+	store, cfg := qb.offloadStore, qb.offload
+	qb.mu.Unlock()
+	if store == nil || cfg.Threshold <= 0 || len(msg.Body) < cfg.Threshold || IsPattern(queueName) {
+		return nil
+	}
+	qb.mu.Lock()
+	err := qb.validateLocked(queueName, msg)
+	aead := qb.tenantCipherLocked(queueName)
+	qb.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	body := []byte(msg.Body)
+	if aead != nil {
+		body = seal(aead, TenantOf(queueName), body)
+	}
+	key := url.PathEscape(queueName) + "/" + newToken()
+	if err := store.Put(context.Background(), key, body); err != nil {
+		return fmt.Errorf("offload message body: %w", err)
+	}
+	headers := make(map[string]string, len(msg.Headers)+1)
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	headers[ClaimCheckHeader] = key
+	msg.Headers = headers
+	msg.Body = key
+	return nil
+}
+
+// resolveBody загружает вынесенное тело выдаваемого сообщения или, в режиме
+// ссылок с подписью, добавляет ссылку. Если загрузить тело не удалось,
+// сообщение выдается со ссылкой, чтобы не потерять его.
+func (qb *QueueBroker) resolveBody(msg *Message) *Message {
+	key := msg.Headers[ClaimCheckHeader]
+	if key == "" {
+		return msg
+	}
+	qb.mu.Lock()
+	store, cfg := qb.offloadStore, qb.offload
+	aead := qb.tenantCipherLocked(msg.Queue)
+	qb.mu.Unlock()
+	if store == nil {
+		return msg
+	}
+
+	resolved := *msg
+	resolved.Headers = make(map[string]string, len(msg.Headers))
+	for k, v := range msg.Headers {
+		resolved.Headers[k] = v
+	}
+	if presigner, ok := store.(Presigner); ok && cfg.PresignTTL > 0 && aead == nil {
+		if link, err := presigner.Presign(key, cfg.PresignTTL); err == nil {
+			resolved.Headers[ClaimCheckURLHeader] = link
+			return &resolved
+		}
+	}
+
+	body, err := store.Get(context.Background(), key)
+	if err == nil && aead != nil {
+		body, err = open(aead, TenantOf(msg.Queue), body)
+	}
+	if err != nil {
+		return msg
+	}
+	delete(resolved.Headers, ClaimCheckHeader)
+	if len(resolved.Headers) == 0 {
+		resolved.Headers = nil
+	}
+	resolved.Body = string(body)
+	return &resolved
+}
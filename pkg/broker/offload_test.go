@@ -0,0 +1,160 @@
+package broker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryBlobs хранилище тел в памяти
+type memoryBlobs struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	presign bool
+}
+
+func (m *memoryBlobs) Put(_ context.Context, key string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[key] = append([]byte(nil), data...)
+	return nil
+}
+
+func (m *memoryBlobs) Get(_ context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.objects[key]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return data, nil
+}
+
+func (m *memoryBlobs) Presign(key string, expires time.Duration) (string, error) {
+	if !m.presign {
+		return "", errors.New("presign disabled")
+	}
+	return "https://blobs.example/" + key + "?expires=" + expires.String(), nil
+}
+
+// TestOffload проверяет вынос большого тела в хранилище и его загрузку при выдаче
+func TestOffload(t *testing.T) {
+	qb := NewQueueBroker(100, 10, 10)
+	blobs := &memoryBlobs{objects: make(map[string][]byte)}
+	qb.SetOffload(blobs, OffloadConfig{Threshold: 1024})
+	large := strings.Repeat("x", 4096)
+
+	if err := qb.Enqueue("jobs", &Message{Body: large, Headers: map[string]string{"trace": "abc"}}); err != nil {
+		t.Fatal(err)
+	}
+	qb.Enqueue("jobs", &Message{Body: "small", Headers: map[string]string{ClaimCheckHeader: "other/secret"}})
+	if len(blobs.objects) != 1 || qb.QueueBytes("jobs") >= 1024 {
+		t.Fatalf("body not offloaded: %d objects, %d bytes in queue", len(blobs.objects), qb.QueueBytes("jobs"))
+	}
+
+	msg, err := qb.Dequeue("jobs", 0)
+	if err != nil || msg.Body != large || msg.Headers["trace"] != "abc" || msg.Headers[ClaimCheckHeader] != "" {
+		t.Fatalf("body not resolved: %d bytes, headers %v, %v", len(msg.Body), msg.Headers, err)
+	}
+	msg, err = qb.Dequeue("jobs", 0)
+	if err != nil || msg.Body != "small" || msg.Headers[ClaimCheckHeader] != "" {
+		t.Errorf("forged claim check not dropped: %+v, %v", msg, err)
+	}
+
+	// В режиме ссылок тело не загружается
+	blobs.presign = true
+	qb.SetOffload(blobs, OffloadConfig{Threshold: 1024, PresignTTL: time.Minute})
+	qb.Enqueue("jobs", &Message{Body: large})
+	msg, _ = qb.Dequeue("jobs", 0)
+	if key := msg.Headers[ClaimCheckHeader]; key == "" || msg.Body != key || !strings.HasPrefix(msg.Headers[ClaimCheckURLHeader], "https://blobs.example/jobs/") {
+		t.Errorf("unexpected presigned delivery: %q %v", msg.Body, msg.Headers)
+	}
+}
+
+// TestOffloadTenantAndSchema проверяет шифрование вынесенных тел арендатора
+// и проверку схемы до выноса
+func TestOffloadTenantAndSchema(t *testing.T) {
+	qb := NewQueueBroker(100, 10, 10)
+	qb.AddTenant(Tenant{ID: "acme", Key: bytes.Repeat([]byte{1}, 32), Token: "acme-token"})
+	blobs := &memoryBlobs{objects: make(map[string][]byte), presign: true}
+	qb.SetOffload(blobs, OffloadConfig{Threshold: 16, PresignTTL: time.Minute})
+
+	body := `{"secret": "` + strings.Repeat("s", 64) + `"}`
+	if err := qb.Enqueue("@acme.jobs", &Message{Body: body}); err != nil {
+		t.Fatal(err)
+	}
+	for _, data := range blobs.objects {
+		if bytes.Contains(data, []byte("sss")) {
+			t.Error("tenant body stored unencrypted")
+		}
+	}
+	// Ссылка на зашифрованный объект бесполезна, поэтому тело загружается
+	if msg, err := qb.Dequeue("@acme.jobs", 0); err != nil || msg.Body != body {
+		t.Errorf("tenant body not resolved: %+v, %v", msg, err)
+	}
+
+	schema, err := ParseSchema([]byte(`{"type": "object", "required": ["id"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	qb.SetQueueSchema("orders", schema)
+	before := len(blobs.objects)
+	if err := qb.Enqueue("orders", &Message{Body: body}); !errors.Is(err, ErrSchemaViolation) {
+		t.Errorf("expected schema violation, got %v", err)
+	}
+	if len(blobs.objects) != before {
+		t.Error("rejected message body was offloaded")
+	}
+	if err := qb.Enqueue("orders", &Message{Body: `{"id": 1, "pad": "` + strings.Repeat("p", 64) + `"}`}); err != nil {
+		t.Errorf("valid message rejected: %v", err)
+	}
+}
+
+// countingBlobs хранилище тел, учитывающее ссылки сообщений
+type countingBlobs struct {
+	memoryBlobs
+	refs map[string]int
+}
+
+func (c *countingBlobs) Retain(key string)  { c.refs[key]++ }
+func (c *countingBlobs) Release(key string) { c.refs[key]-- }
+
+// TestOffloadRefs проверяет учет ссылок очереди и журнала на вынесенные тела
+func TestOffloadRefs(t *testing.T) {
+	qb := NewQueueBroker(100, 10, 10)
+	blobs := &countingBlobs{memoryBlobs: memoryBlobs{objects: make(map[string][]byte)}, refs: make(map[string]int)}
+	qb.SetOffload(blobs, OffloadConfig{Threshold: 1})
+	refs := func() (total int) {
+		for _, n := range blobs.refs {
+			total += n
+		}
+		return total
+	}
+
+	qb.PutMessage("jobs", "a")
+	if refs() != 1 {
+		t.Errorf("enqueued: %d refs", refs())
+	}
+	qb.GetMessage("jobs", 0)
+	if refs() != 0 {
+		t.Errorf("dequeued: %d refs", refs())
+	}
+
+	qb.SetQueueConfig("events", QueueConfig{LockDuration: 30, Retention: 3600})
+	qb.PutMessage("events", "b")
+	if refs() != 2 {
+		t.Errorf("enqueued with retention: %d refs", refs())
+	}
+	qb.GetMessage("events", 0)
+	if refs() != 1 {
+		t.Errorf("dequeued, kept in log: %d refs", refs())
+	}
+	qb.DeleteQueue("events")
+	if refs() != 0 {
+		t.Errorf("queue deleted: %d refs", refs())
+	}
+}
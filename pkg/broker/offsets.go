@@ -0,0 +1,97 @@
+package broker
+
+import "time"
+
+// maxGroupLength ограничение длины имени группы потребителей журнала
+const maxGroupLength = 256
+
+// LogOffsets границы журнала очереди и зафиксированные смещения групп
+type LogOffsets struct {
+	// First номер самой старой хранимой записи, Next — номер следующей
+	First uint64 `json:"first"`
+	Next  uint64 `json:"next"`
+	// Groups смещения групп: номер записи, с которой группа продолжит чтение
+	Groups map[string]uint64 `json:"groups"`
+}
+
+// CommitOffset фиксирует смещение группы потребителей журнала очереди: номер
+// записи, с которой группа продолжит чтение (номер обработанной записи + 1).
+// Смещение можно сдвигать и назад, чтобы перечитать журнал.
+func (qb *QueueBroker) CommitOffset(queueName, group string, offset uint64) error {
+	if group == "" || len(group) > maxGroupLength {
+		return ErrInvalidGroup
+	}
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	log, err := qb.logLocked(queueName)
+	if err != nil {
+		return err
+	}
+	if offset > log.next {
+		return ErrInvalidOffset
+	}
+	if log.offsets == nil {
+		log.offsets = make(map[string]uint64)
+	}
+	log.offsets[group] = offset
+	return nil
+}
+
+// CommittedOffset возвращает смещение группы потребителей журнала очереди;
+// группа без зафиксированного смещения читает с самой старой хранимой записи
+func (qb *QueueBroker) CommittedOffset(queueName, group string) (uint64, error) {
+	if group == "" || len(group) > maxGroupLength {
+		return 0, ErrInvalidGroup
+	}
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	log, err := qb.logLocked(queueName)
+	if err != nil {
+		return 0, err
+	}
+	offset, ok := log.offsets[group]
+	if !ok {
+		return log.first, nil
+	}
+	return max(offset, log.first), nil
+}
+
+// LogOffsets возвращает границы журнала очереди и смещения всех групп
+func (qb *QueueBroker) LogOffsets(queueName string) (LogOffsets, error) {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	log, err := qb.logLocked(queueName)
+	if err != nil {
+		return LogOffsets{}, err
+	}
+	offsets := LogOffsets{First: log.first, Next: log.next, Groups: make(map[string]uint64, len(log.offsets))}
+	for group, offset := range log.offsets {
+		offsets.Groups[group] = offset
+	}
+	return offsets, nil
+}
+
+// GroupOffset возвращает смещение группы потребителей журнала очереди, как
+// CommittedOffset, но группа без зафиксированного смещения начинает с первой
+// записи, поставленной не раньше since, и это смещение сразу фиксируется:
+// повторное чтение до первой фиксации не пропускает новые записи
+func (qb *QueueBroker) GroupOffset(queueName, group string, since time.Time) (uint64, error) {
+	if group == "" || len(group) > maxGroupLength {
+		return 0, ErrInvalidGroup
+	}
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	log, err := qb.logLocked(queueName)
+	if err != nil {
+		return 0, err
+	}
+	if offset, ok := log.offsets[group]; ok {
+		return max(offset, log.first), nil
+	}
+	offset := log.offsetAt(since)
+	if log.offsets == nil {
+		log.offsets = make(map[string]uint64)
+	}
+	log.offsets[group] = offset
+	return offset, nil
+}
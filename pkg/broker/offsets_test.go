@@ -0,0 +1,80 @@
+package broker
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCommitOffset проверяет фиксацию смещений групп и продолжение чтения
+// журнала с зафиксированного смещения
+func TestCommitOffset(t *testing.T) {
+	qb := NewQueueBroker(100, 10, 1)
+	qb.PutMessage("plain", "x")
+	if err := qb.CommitOffset("plain", "g", 0); !errors.Is(err, ErrNoRetention) {
+		t.Errorf("queue without retention: got %v", err)
+	}
+
+	qb.SetQueueConfig("jobs", QueueConfig{LockDuration: 30, Retention: 3600, RetentionBytes: 2})
+	for _, body := range []string{"a", "b", "c"} {
+		qb.PutMessage("jobs", body)
+	}
+	for _, group := range []string{"", strings.Repeat("g", maxGroupLength+1)} {
+		if err := qb.CommitOffset("jobs", group, 0); !errors.Is(err, ErrInvalidGroup) {
+			t.Errorf("group %.8q: got %v", group, err)
+		}
+	}
+	if err := qb.CommitOffset("jobs", "g", 4); !errors.Is(err, ErrInvalidOffset) {
+		t.Errorf("offset beyond the log: got %v", err)
+	}
+
+	// Новая группа читает с самой старой хранимой записи
+	if offset, err := qb.CommittedOffset("jobs", "g"); err != nil || offset != 1 {
+		t.Errorf("new group: got %d %v", offset, err)
+	}
+	if err := qb.CommitOffset("jobs", "g", 2); err != nil {
+		t.Fatal(err)
+	}
+	offset, err := qb.CommittedOffset("jobs", "g")
+	if err != nil || offset != 2 {
+		t.Fatalf("committed: got %d %v", offset, err)
+	}
+	if record, err := qb.ReadLog("jobs", offset, 0); err != nil || record.Body != "c" {
+		t.Errorf("resume: got %+v %v", record, err)
+	}
+	// Смещение, отставшее от журнала, сдвигается к самой старой записи
+	qb.CommitOffset("jobs", "h", 0)
+	if offset, _ := qb.CommittedOffset("jobs", "h"); offset != 1 {
+		t.Errorf("stale offset: got %d", offset)
+	}
+
+	offsets, err := qb.LogOffsets("jobs")
+	if err != nil || offsets.First != 1 || offsets.Next != 3 || offsets.Groups["g"] != 2 || offsets.Groups["h"] != 0 {
+		t.Errorf("unexpected offsets %+v %v", offsets, err)
+	}
+}
+
+// TestGroupOffset проверяет начальную позицию новой группы по времени постановки
+func TestGroupOffset(t *testing.T) {
+	qb := NewQueueBroker(100, 10, 1)
+	qb.SetQueueConfig("jobs", QueueConfig{LockDuration: 30, Retention: 3600})
+	qb.PutMessage("jobs", "old")
+	since := time.Now()
+	qb.PutMessage("jobs", "new")
+
+	offset, err := qb.GroupOffset("jobs", "fresh", since)
+	if err != nil || offset != 1 {
+		t.Fatalf("new group: got %d %v", offset, err)
+	}
+	// Начальное смещение зафиксировано и не сдвигается с новыми записями
+	qb.PutMessage("jobs", "newer")
+	if offset, _ := qb.GroupOffset("jobs", "fresh", time.Now()); offset != 1 {
+		t.Errorf("second read: got %d", offset)
+	}
+	// Зафиксированное смещение важнее since
+	qb.CommitOffset("jobs", "old", 0)
+	if offset, _ := qb.GroupOffset("jobs", "old", time.Now()); offset != 0 {
+		t.Errorf("committed group: got %d", offset)
+	}
+}
@@ -0,0 +1,64 @@
+package broker
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Политики заполненной очереди (QueueConfig.Overflow)
+const (
+	// OverflowReject сообщение сразу отклоняется с ErrQueueFull
+	OverflowReject = "reject"
+	// OverflowBlock производитель ждет, пока в очереди освободится место
+	// (см. EnqueueWait)
+	OverflowBlock = "block"
+)
+
+// ValidateOverflow проверяет политику заполненной очереди (QueueConfig.Overflow)
+func ValidateOverflow(policy string) error {
+	switch policy {
+	case "", OverflowReject, OverflowBlock:
+		return nil
+	}
+	return fmt.Errorf("unknown overflow policy %q", policy)
+}
+
+// enqueueBlocking помещает сообщение в локальную очередь; в очереди с
+// политикой OverflowBlock при нехватке места ждет его освобождения до timeout
+func (qb *QueueBroker) enqueueBlocking(queueName string, msg *Message, timeout time.Duration) error {
+	if timeout <= 0 || qb.QueueConfig(queueName).Overflow != OverflowBlock {
+		return qb.enqueueLocal(queueName, msg)
+	}
+	deadline := time.NewTimer(qb.waitLimit(timeout))
+	defer deadline.Stop()
+	for {
+		// Подписка до попытки: место, освободившееся между ними, не теряется
+		qb.mu.Lock()
+		freed := qb.spaceFreed[queueName]
+		if freed == nil {
+			freed = make(chan struct{})
+			qb.spaceFreed[queueName] = freed
+		}
+		qb.mu.Unlock()
+
+		err := qb.enqueueLocal(queueName, msg)
+		var capErr *CapacityError
+		if !errors.As(err, &capErr) || !errors.Is(err, ErrQueueFull) && !errors.Is(err, ErrQueueByteLimit) {
+			return err
+		}
+		select {
+		case <-freed:
+		case <-deadline.C:
+			return &CapacityError{Err: ErrPutTimeout, Queue: capErr.Queue, Used: capErr.Used, Limit: capErr.Limit, Unit: capErr.Unit}
+		}
+	}
+}
+
+// notifySpaceLocked будит производителей, ждущих места в очереди
+func (qb *QueueBroker) notifySpaceLocked(queueName string) {
+	if freed := qb.spaceFreed[queueName]; freed != nil {
+		close(freed)
+		delete(qb.spaceFreed, queueName)
+	}
+}
@@ -0,0 +1,64 @@
+package broker
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestOverflowBlock проверяет ожидание места производителем в очереди с
+// политикой OverflowBlock
+func TestOverflowBlock(t *testing.T) {
+	qb := NewQueueBroker(1, 10, 10)
+	cfg := qb.QueueConfig("jobs")
+	cfg.Overflow = OverflowBlock
+	qb.SetQueueConfig("jobs", cfg)
+	if err := qb.PutMessage("jobs", "first"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Без времени ожидания заполненная очередь отклоняет сразу
+	if err := qb.Enqueue("jobs", &Message{Body: "second"}); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+
+	start := time.Now()
+	err := qb.EnqueueWait("jobs", &Message{Body: "second"}, 50*time.Millisecond)
+	var capErr *CapacityError
+	if !errors.Is(err, ErrPutTimeout) || !errors.As(err, &capErr) || capErr.Used != 1 || capErr.Limit != 1 {
+		t.Fatalf("expected ErrPutTimeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("returned after %v", elapsed)
+	}
+
+	// Получение освобождает место, и ждущий производитель ставит сообщение
+	done := make(chan error, 1)
+	go func() { done <- qb.EnqueueWait("jobs", &Message{Body: "second"}, 5*time.Second) }()
+	time.Sleep(20 * time.Millisecond)
+	if message, err := qb.GetMessage("jobs", 0); err != nil || message != "first" {
+		t.Fatalf("unexpected message %q: %v", message, err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("blocked producer was not woken")
+	}
+	if message, err := qb.GetMessage("jobs", 0); err != nil || message != "second" {
+		t.Errorf("unexpected message %q: %v", message, err)
+	}
+
+	// В очереди с политикой по умолчанию время ожидания не действует
+	qb.PutMessage("other", "x")
+	start = time.Now()
+	if err := qb.EnqueueWait("other", &Message{Body: "y"}, time.Minute); !errors.Is(err, ErrQueueFull) || time.Since(start) > time.Second {
+		t.Errorf("expected immediate ErrQueueFull, got %v", err)
+	}
+
+	if ValidateOverflow("drop") == nil || ValidateOverflow(OverflowBlock) != nil {
+		t.Error("unexpected overflow policy validation")
+	}
+}
@@ -0,0 +1,139 @@
+package broker
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// PauseWindow ежедневный интервал времени, в который выдача сообщений из
+// очереди приостановлена (постановка продолжается). Время задается как
+// "HH:MM"; если Start позже End, интервал переходит через полночь.
+type PauseWindow struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+	// Timezone часовой пояс IANA (например, Europe/Moscow), по умолчанию UTC
+	Timezone string `json:"timezone,omitempty"`
+}
+
+// locations кэш загруженных часовых поясов
+var locations sync.Map
+
+func loadLocation(name string) (*time.Location, error) {
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(name, loc)
+	return loc, nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Validate проверяет формат времени и часовой пояс
+func (w PauseWindow) Validate() error {
+	if _, err := parseClock(w.Start); err != nil {
+		return err
+	}
+	if _, err := parseClock(w.End); err != nil {
+		return err
+	}
+	if _, err := loadLocation(w.Timezone); err != nil {
+		return fmt.Errorf("invalid timezone %q", w.Timezone)
+	}
+	return nil
+}
+
+// remaining возвращает, сколько еще продлится интервал, или 0, если now вне его
+func (w PauseWindow) remaining(now time.Time) time.Duration {
+	start, err1 := parseClock(w.Start)
+	end, err2 := parseClock(w.End)
+	loc, err3 := loadLocation(w.Timezone)
+	if err1 != nil || err2 != nil || err3 != nil || start == end {
+		return 0
+	}
+	now = now.In(loc)
+	sinceMidnight := now.Sub(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc))
+
+	switch {
+	case start < end && sinceMidnight >= start && sinceMidnight < end:
+		return end - sinceMidnight
+	case start > end && sinceMidnight >= start:
+		return end + 24*time.Hour - sinceMidnight
+	case start > end && sinceMidnight < end:
+		return end - sinceMidnight
+	}
+	return 0
+}
+
+// manualPauseRecheck через сколько ожидающие перепроверяют паузу, заданную
+// Pause; Resume будит их сразу
+const manualPauseRecheck = time.Minute
+
+// Pause приостанавливает выдачу сообщений из очереди до вызова Resume,
+// например на время разбора инцидента; постановка продолжается. Очередь
+// может еще не существовать, пауза сохраняется и при ее удалении.
+func (qb *QueueBroker) Pause(queueName string) error {
+	if IsPattern(queueName) {
+		return ErrInvalidQueueName
+	}
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	qb.paused[queueName] = true
+	return nil
+}
+
+// Resume возобновляет выдачу сообщений, приостановленную Pause; интервалы
+// паузы из настроек очереди продолжают действовать
+func (qb *QueueBroker) Resume(queueName string) {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	if qb.paused[queueName] {
+		delete(qb.paused, queueName)
+		qb.wakeAllLocked(queueName)
+	}
+}
+
+// Paused сообщает, приостановлена ли выдача из очереди вызовом Pause
+func (qb *QueueBroker) Paused(queueName string) bool {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	return qb.paused[queueName]
+}
+
+// pausedLocked возвращает, сколько еще выдача из очереди приостановлена
+// (0 — не приостановлена). После этого срока интервалы проверяются заново,
+// поэтому смежные интервалы продлевают паузу.
+func (qb *QueueBroker) pausedLocked(queueName string, now time.Time) time.Duration {
+	if qb.paused[queueName] {
+		return manualPauseRecheck
+	}
+	cfg, ok := qb.configs[queueName]
+	if !ok {
+		return 0
+	}
+	var paused time.Duration
+	for _, w := range cfg.PauseWindows {
+		paused = max(paused, w.remaining(now))
+	}
+	return paused
+}
+
+// resumeTimer возвращает канал, срабатывающий по окончании паузы, и функцию
+// его остановки; для d == 0 канал nil и никогда не срабатывает
+func resumeTimer(d time.Duration) (<-chan time.Time, func() bool) {
+	if d == 0 {
+		return nil, func() bool { return false }
+	}
+	timer := time.NewTimer(d)
+	return timer.C, timer.Stop
+}
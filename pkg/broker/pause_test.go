@@ -0,0 +1,128 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestPauseWindowRemaining проверяет расчет оставшейся паузы, в том числе
+// для интервала через полночь и в другом часовом поясе
+func TestPauseWindowRemaining(t *testing.T) {
+	at := func(clock string) time.Time {
+		t, _ := time.Parse("2006-01-02 15:04", "2024-03-10 "+clock)
+		return t
+	}
+	cases := []struct {
+		window PauseWindow
+		now    string
+		want   time.Duration
+	}{
+		{PauseWindow{Start: "02:00", End: "04:00"}, "03:30", 30 * time.Minute},
+		{PauseWindow{Start: "02:00", End: "04:00"}, "04:00", 0},
+		{PauseWindow{Start: "23:00", End: "01:00"}, "23:30", 90 * time.Minute},
+		{PauseWindow{Start: "23:00", End: "01:00"}, "00:15", 45 * time.Minute},
+		{PauseWindow{Start: "23:00", End: "01:00"}, "12:00", 0},
+		{PauseWindow{Start: "02:00", End: "04:00", Timezone: "Europe/Moscow"}, "00:00", time.Hour},
+	}
+	for _, c := range cases {
+		if got := c.window.remaining(at(c.now)); got != c.want {
+			t.Errorf("%+v at %s: remaining %v, want %v", c.window, c.now, got, c.want)
+		}
+	}
+
+	if err := (PauseWindow{Start: "25:00", End: "01:00"}).Validate(); err == nil {
+		t.Error("expected invalid time to be rejected")
+	}
+	if err := (PauseWindow{Start: "01:00", End: "02:00", Timezone: "Mars/Base"}).Validate(); err == nil {
+		t.Error("expected invalid timezone to be rejected")
+	}
+}
+
+// TestPausedQueue проверяет, что во время паузы выдача останавливается,
+// а постановка продолжается
+func TestPausedQueue(t *testing.T) {
+	qb := NewQueueBroker(100, 10, 10)
+	now := time.Now().UTC()
+	window := PauseWindow{Start: now.Add(-time.Minute).Format("15:04"), End: now.Add(2 * time.Minute).Format("15:04")}
+	cfg := qb.QueueConfig("billing")
+	cfg.PauseWindows = []PauseWindow{window}
+	qb.SetQueueConfig("billing", cfg)
+
+	if err := qb.PutMessage("billing", "job"); err != nil {
+		t.Fatalf("enqueue must continue during pause: %v", err)
+	}
+	if _, err := qb.Dequeue("billing", 0); !errors.Is(err, ErrTimeout) {
+		t.Errorf("expected no delivery during pause, got %v", err)
+	}
+	qb.PutMessage("billing.eu", "job")
+	if msg, err := qb.Dequeue(">", 0); err != nil || msg.Queue != "billing.eu" {
+		t.Errorf("expected pattern to skip paused queue, got %+v %v", msg, err)
+	}
+
+	sub, _ := qb.Subscribe("billing")
+	defer sub.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := sub.Next(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected subscription to wait during pause, got %v", err)
+	}
+
+	cfg.PauseWindows = nil
+	qb.SetQueueConfig("billing", cfg)
+	if msg, err := qb.Dequeue("billing", 0); err != nil || msg.Body != "job" {
+		t.Errorf("expected delivery after pause, got %+v %v", msg, err)
+	}
+}
+
+// TestManualPause проверяет ручную паузу: постановка продолжается, выдача
+// ждет, а Resume сразу будит ожидающих получателей
+func TestManualPause(t *testing.T) {
+	qb := NewQueueBroker(100, 10, 10)
+	if err := qb.Pause("billing.*"); !errors.Is(err, ErrInvalidQueueName) {
+		t.Errorf("expected ErrInvalidQueueName for pattern, got %v", err)
+	}
+	if err := qb.Pause("billing"); err != nil || !qb.Paused("billing") {
+		t.Fatalf("unexpected pause result: %v", err)
+	}
+	if err := qb.PutMessage("billing", "job"); err != nil {
+		t.Fatalf("enqueue must continue during pause: %v", err)
+	}
+	if _, err := qb.Dequeue("billing", 0); !errors.Is(err, ErrTimeout) {
+		t.Errorf("expected no delivery during pause, got %v", err)
+	}
+	if queues := qb.Queues(); len(queues) != 1 || !queues[0].Paused {
+		t.Errorf("expected paused queue in list, got %+v", queues)
+	}
+
+	done := make(chan *Message, 1)
+	go func() {
+		msg, _ := qb.Dequeue("billing", 5*time.Second)
+		done <- msg
+	}()
+	time.Sleep(50 * time.Millisecond)
+	qb.Resume("billing")
+	select {
+	case msg := <-done:
+		if msg == nil || msg.Body != "job" {
+			t.Errorf("unexpected message after resume: %+v", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("resume did not wake waiting consumer")
+	}
+
+	qb.Pause("billing")
+	qb.PutMessage("billing", "next")
+	sub, _ := qb.Subscribe("billing")
+	defer sub.Close()
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		qb.Resume("billing")
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if msg, err := sub.Next(ctx); err != nil || msg.Body != "next" {
+		t.Errorf("expected subscription delivery after resume, got %+v %v", msg, err)
+	}
+}
@@ -0,0 +1,174 @@
+package broker
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// defaultLockDuration длительность блокировки в режиме peek-lock по умолчанию (секунды)
+const defaultLockDuration = 30
+
+// Delivery сообщение, выданное в режиме peek-lock. До вызова Complete
+// сообщение скрыто от других потребителей, а по истечении блокировки
+// возвращается в очередь.
+type Delivery struct {
+	*Message
+	LockToken   string    `json:"lock_token"`
+	LockedUntil time.Time `json:"locked_until"`
+	// LockDuration длительность блокировки в секундах (с округлением вверх):
+	// по ней потребитель может рассчитать срок по своим часам, не завися
+	// от расхождения с часами брокера
+	LockDuration int `json:"lock_duration"`
+}
+
+// lockSeconds переводит длительность блокировки в целые секунды с округлением вверх
+func lockSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
+
+// messageLock заблокированное сообщение
+type messageLock struct {
+	queueName string
+	msg       *Message
+	expiresAt time.Time
+	timer     *time.Timer
+	// consumer зарегистрированный потребитель, которому выдано сообщение
+	consumer *consumerSession
+}
+
+// newToken генерирует случайный идентификатор
+func newToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// PeekLock извлекает сообщение, скрывая его на время lockDuration
+func (qb *QueueBroker) PeekLock(queueName string, timeout time.Duration, lockDuration time.Duration) (*Delivery, error) {
+	return qb.PeekLockAs(queueName, "", timeout, lockDuration)
+}
+
+// PeekLockAs работает как PeekLock и закрепляет сообщение за потребителем
+// consumerID: запрос считается его сигналом жизни (см. Heartbeat), а при
+// потере потребителя сообщение возвращается в очередь. Пустой consumerID —
+// потребитель не отслеживается.
+func (qb *QueueBroker) PeekLockAs(queueName, consumerID string, timeout time.Duration, lockDuration time.Duration) (*Delivery, error) {
+	if len(consumerID) > maxConsumerIDLength {
+		return nil, ErrInvalidConsumerID
+	}
+	if consumerID != "" {
+		qb.mu.Lock()
+		qb.heartbeatLocked(queueName, consumerID, 0)
+		qb.mu.Unlock()
+	}
+	stored, err := qb.dequeueStored(queueName, timeout)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := qb.deliver(stored)
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+
+	// Для шаблона блокировка относится к очереди, из которой выдано сообщение,
+	// а потребитель — к очереди или шаблону запроса. Сообщение, которое не
+	// удалось выдать (например, расшифровать), тоже блокируется: по истечении
+	// блокировки оно вернется в очередь или, по политике повторов, в очередь
+	// недоставленных, а не будет потеряно и не задержит следующие.
+	lock := &messageLock{
+		queueName: stored.Queue,
+		msg:       stored,
+		expiresAt: time.Now().Add(lockDuration),
+	}
+	if consumerID != "" && err == nil {
+		// Пока получатель ждал, регистрация могла истечь: она возобновляется
+		lock.consumer = qb.heartbeatLocked(queueName, consumerID, 0)
+	}
+	queueName = stored.Queue
+	token := newToken()
+	lock.timer = time.AfterFunc(lockDuration, func() { qb.expireLock(token) })
+	qb.locks[token] = lock
+	qb.inflight[queueName]++
+	if err != nil {
+		return nil, err
+	}
+
+	return &Delivery{Message: msg, LockToken: token, LockedUntil: lock.expiresAt, LockDuration: lockSeconds(lockDuration)}, nil
+}
+
+// Complete подтверждает обработку заблокированного сообщения и удаляет его
+func (qb *QueueBroker) Complete(queueName, lockToken string) error {
+	qb.mu.Lock()
+	lock, ok := qb.locks[lockToken]
+	if !ok || lock.queueName != queueName {
+		qb.mu.Unlock()
+		return ErrLockNotFound
+	}
+	lock.timer.Stop()
+	delete(qb.locks, lockToken)
+	qb.inflight[queueName]--
+	qb.releaseLocked(queueName, lock.msg)
+	plugins := qb.plugins
+	qb.mu.Unlock()
+
+	qb.pluginsOnAck(plugins, queueName, lock.msg)
+	return nil
+}
+
+// Abandon снимает блокировку и возвращает сообщение в очередь для повторной
+// доставки: сразу или по политике повторов очереди (см. RetryPolicy)
+func (qb *QueueBroker) Abandon(queueName, lockToken string) error {
+	qb.mu.Lock()
+	lock, ok := qb.locks[lockToken]
+	if !ok || lock.queueName != queueName {
+		qb.mu.Unlock()
+		return ErrLockNotFound
+	}
+	lock.timer.Stop()
+	delete(qb.locks, lockToken)
+	qb.inflight[queueName]--
+	notify := qb.retryLocked(queueName, lock.msg, retryReasonNack)
+	qb.mu.Unlock()
+
+	if notify != nil {
+		notify()
+	}
+	return nil
+}
+
+// RenewLock продлевает блокировку сообщения на lockDuration от текущего
+// момента и регистрацию потребителя, которому оно выдано
+func (qb *QueueBroker) RenewLock(queueName, lockToken string, lockDuration time.Duration) (time.Time, error) {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+
+	lock, ok := qb.locks[lockToken]
+	if !ok || lock.queueName != queueName {
+		return time.Time{}, ErrLockNotFound
+	}
+	lock.expiresAt = time.Now().Add(lockDuration)
+	lock.timer.Reset(lockDuration)
+	if s := lock.consumer; s != nil && qb.heartbeats[s.queueName][s.id] == s {
+		// Продление блокировки — тоже сигнал жизни потребителя
+		qb.heartbeatLocked(s.queueName, s.id, 0)
+	}
+	return lock.expiresAt, nil
+}
+
+// expireLock возвращает сообщение с истекшей блокировкой в очередь
+func (qb *QueueBroker) expireLock(lockToken string) {
+	qb.mu.Lock()
+	lock, ok := qb.locks[lockToken]
+	if !ok || time.Now().Before(lock.expiresAt) {
+		qb.mu.Unlock()
+		return
+	}
+	delete(qb.locks, lockToken)
+	qb.inflight[lock.queueName]--
+	notify := qb.retryLocked(lock.queueName, lock.msg, retryReasonExpired)
+	qb.mu.Unlock()
+
+	if notify != nil {
+		notify()
+	}
+}
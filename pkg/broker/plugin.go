@@ -0,0 +1,209 @@
+package broker
+
+import (
+	"fmt"
+	"plugin"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Plugin расширение брокера, вызываемое при постановке и выдаче сообщений.
+// Плагин может изменять сообщение (например, добавлять заголовки) и отклонять
+// его при постановке, возвращая ошибку.
+type Plugin interface {
+	// Name имя плагина для сообщений об ошибках
+	Name() string
+	// OnEnqueue вызывается до маршрутизации; ошибка отклоняет сообщение
+	OnEnqueue(queueName string, msg *Message) error
+	// OnDequeue вызывается перед выдачей сообщения потребителю; изменения
+	// касаются только выдаваемой копии
+	OnDequeue(queueName string, msg *Message)
+}
+
+// AckPlugin плагин, которому сообщается о подтверждении обработки сообщения
+// (Complete при peek-lock, PUBACK MQTT, ACK STOMP). Вынесенное в хранилище
+// тело в сообщение не подставляется.
+type AckPlugin interface {
+	Plugin
+	OnAck(queueName string, msg *Message)
+}
+
+// QueueCreatePlugin плагин, которому сообщается о создании очереди
+type QueueCreatePlugin interface {
+	Plugin
+	OnQueueCreate(queueName string)
+}
+
+// AuthPlugin плагин, ограничивающий доступ к очередям сверх их прав:
+// действие разрешено, только если его разрешают права очереди и все такие плагины
+type AuthPlugin interface {
+	Plugin
+	Authorize(principal, queueName string, perm Permission) bool
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = map[string]func() Plugin{}
+)
+
+// Register регистрирует фабрику плагина под именем name при сборке брокера,
+// обычно из init() пакета плагина, подключенного пустым импортом. Повторная
+// регистрация имени вызывает панику.
+func Register(name string, factory func() Plugin) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if factory == nil {
+		panic("broker: Register plugin factory is nil")
+	}
+	if _, dup := registry[name]; dup {
+		panic("broker: Register called twice for plugin " + name)
+	}
+	registry[name] = factory
+}
+
+// RegisteredPlugins возвращает имена плагинов, зарегистрированных через
+// Register, по алфавиту
+func RegisteredPlugins() []string {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewRegisteredPlugin создает плагин, зарегистрированный под именем name
+func NewRegisteredPlugin(name string) (Plugin, error) {
+	registryMu.Lock()
+	factory := registry[name]
+	registryMu.Unlock()
+	if factory == nil {
+		return nil, fmt.Errorf("unknown plugin %q", name)
+	}
+	return factory(), nil
+}
+
+// RegisterPlugin подключает плагин; плагины вызываются в порядке подключения
+func (qb *QueueBroker) RegisterPlugin(p Plugin) {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	qb.plugins = append(qb.plugins, p)
+}
+
+// LoadPlugin загружает плагин из разделяемой библиотеки, собранной с
+// go build -buildmode=plugin. Библиотека должна экспортировать переменную
+// Plugin типа broker.Plugin или функцию NewPlugin() broker.Plugin.
+func LoadPlugin(path string) (Plugin, error) {
+	lib, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if sym, err := lib.Lookup("Plugin"); err == nil {
+		if p, ok := sym.(*Plugin); ok && *p != nil {
+			return *p, nil
+		}
+		return nil, fmt.Errorf("%s: symbol Plugin is not a broker.Plugin", path)
+	}
+	if sym, err := lib.Lookup("NewPlugin"); err == nil {
+		if newPlugin, ok := sym.(func() Plugin); ok {
+			return newPlugin(), nil
+		}
+		return nil, fmt.Errorf("%s: symbol NewPlugin is not a func() broker.Plugin", path)
+	}
+	return nil, fmt.Errorf("%s: neither Plugin nor NewPlugin is exported", path)
+}
+
+// pluginsOnEnqueue прогоняет сообщение через плагины перед постановкой
+func (qb *QueueBroker) pluginsOnEnqueue(queueName string, msg *Message) error {
+	qb.mu.Lock()
+	plugins := qb.plugins
+	qb.mu.Unlock()
+
+	for _, p := range plugins {
+		if err := p.OnEnqueue(queueName, msg); err != nil {
+			return fmt.Errorf("rejected by plugin %s: %w", p.Name(), err)
+		}
+	}
+	return nil
+}
+
+// pluginsOnAck сообщает плагинам AckPlugin о подтверждении сообщения;
+// вызывается без qb.mu
+func (qb *QueueBroker) pluginsOnAck(plugins []Plugin, queueName string, stored *Message) {
+	var msg *Message
+	for _, p := range plugins {
+		ack, ok := p.(AckPlugin)
+		if !ok {
+			continue
+		}
+		if msg == nil {
+			var err error
+			if msg, err = qb.unpack(stored); err != nil {
+				return
+			}
+		}
+		ack.OnAck(queueName, msg)
+	}
+}
+
+// pluginsOnQueueCreate сообщает плагинам QueueCreatePlugin о новой очереди;
+// вызывается без qb.mu
+func (qb *QueueBroker) pluginsOnQueueCreate(queueName string) {
+	qb.mu.Lock()
+	plugins := qb.plugins
+	qb.mu.Unlock()
+	for _, p := range plugins {
+		if created, ok := p.(QueueCreatePlugin); ok {
+			created.OnQueueCreate(queueName)
+		}
+	}
+}
+
+// pluginsAuthorize спрашивает плагины AuthPlugin; false — хотя бы один запретил
+func pluginsAuthorize(plugins []Plugin, principal, queueName string, perm Permission) bool {
+	for _, p := range plugins {
+		if auth, ok := p.(AuthPlugin); ok && !auth.Authorize(principal, queueName, perm) {
+			return false
+		}
+	}
+	return true
+}
+
+// deliver восстанавливает хранимое сообщение (в том числе вынесенное тело)
+// и прогоняет копию через плагины;
+// при включенной имитации задержки выдача откладывается
+func (qb *QueueBroker) deliver(stored *Message) (*Message, error) {
+	qb.mu.Lock()
+	delay := qb.simulatedDelayLocked(stored.Queue)
+	qb.mu.Unlock()
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+
+	msg, err := qb.unpack(stored)
+	if err != nil {
+		return nil, err
+	}
+	msg = qb.celeryDeliver(qb.resolveBody(msg))
+
+	qb.mu.Lock()
+	plugins := qb.plugins
+	qb.mu.Unlock()
+	if len(plugins) == 0 {
+		return msg, nil
+	}
+
+	// Хранимое сообщение может вернуться в очередь, поэтому плагины получают копию
+	copied := *msg
+	copied.Headers = make(map[string]string, len(msg.Headers))
+	for k, v := range msg.Headers {
+		copied.Headers[k] = v
+	}
+	for _, p := range plugins {
+		p.OnDequeue(copied.Queue, &copied)
+	}
+	return &copied, nil
+}
@@ -0,0 +1,166 @@
+package broker
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testPlugin отклоняет пустые сообщения и помечает выдаваемые
+type testPlugin struct {
+	enqueued int
+}
+
+func (p *testPlugin) Name() string { return "test" }
+
+func (p *testPlugin) OnEnqueue(queueName string, msg *Message) error {
+	if msg.Body == "" {
+		return errors.New("empty body")
+	}
+	if msg.Headers == nil {
+		msg.Headers = make(map[string]string)
+	}
+	msg.Headers["x-enriched"] = queueName
+	p.enqueued++
+	return nil
+}
+
+func (p *testPlugin) OnDequeue(queueName string, msg *Message) {
+	msg.Headers["x-delivered-from"] = queueName
+}
+
+func TestPluginEnqueueValidationAndEnrichment(t *testing.T) {
+	qb := NewQueueBroker(10, 10, 1)
+	p := &testPlugin{}
+	qb.RegisterPlugin(p)
+
+	err := qb.Enqueue("orders", &Message{})
+	if err == nil || !strings.Contains(err.Error(), "rejected by plugin test: empty body") {
+		t.Fatalf("expected rejection, got %v", err)
+	}
+	if qb.Depth("orders") != 0 {
+		t.Error("rejected message must not be stored")
+	}
+
+	if err := qb.Enqueue("orders", &Message{Body: "one"}); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := qb.Dequeue("orders", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Headers["x-enriched"] != "orders" || msg.Headers["x-delivered-from"] != "orders" {
+		t.Errorf("unexpected headers %v", msg.Headers)
+	}
+	if p.enqueued != 1 {
+		t.Errorf("expected 1 enqueue call, got %d", p.enqueued)
+	}
+}
+
+// TestPluginDequeueDoesNotTouchStoredMessage проверяет, что изменения при выдаче
+// не попадают в хранимое сообщение, которое вернется в очередь после истечения блокировки
+func TestPluginDequeueDoesNotTouchStoredMessage(t *testing.T) {
+	qb := NewQueueBroker(10, 10, 1)
+	qb.PutMessage("orders", "one")
+	qb.RegisterPlugin(&testPlugin{})
+
+	delivery, err := qb.PeekLock("orders", 0, time.Minute)
+	if err != nil || delivery.Headers["x-delivered-from"] != "orders" {
+		t.Fatalf("unexpected delivery %+v %v", delivery, err)
+	}
+
+	qb.mu.Lock()
+	stored := qb.locks[delivery.LockToken].msg
+	qb.mu.Unlock()
+	if len(stored.Headers) != 0 {
+		t.Errorf("stored message was modified: %v", stored.Headers)
+	}
+}
+
+func TestLoadPluginMissingFile(t *testing.T) {
+	if _, err := LoadPlugin("/nonexistent/plugin.so"); err == nil {
+		t.Error("expected error for missing plugin")
+	}
+}
+
+// hookPlugin запоминает подтверждения и созданные очереди и запрещает
+// потреблять из очереди secret
+type hookPlugin struct {
+	testPlugin
+	acked   []string
+	created []string
+}
+
+func (p *hookPlugin) OnAck(queueName string, msg *Message) {
+	p.acked = append(p.acked, queueName+":"+msg.Body)
+}
+
+func (p *hookPlugin) OnQueueCreate(queueName string) {
+	p.created = append(p.created, queueName)
+}
+
+func (p *hookPlugin) Authorize(principal, queueName string, perm Permission) bool {
+	return queueName != "secret" || perm != PermConsume
+}
+
+func TestPluginHooks(t *testing.T) {
+	qb := NewQueueBroker(10, 10, 1)
+	p := &hookPlugin{}
+	qb.RegisterPlugin(p)
+
+	for _, queueName := range []string{"jobs", "jobs", "secret"} {
+		if err := qb.Enqueue(queueName, &Message{Body: "one"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if strings.Join(p.created, ",") != "jobs,secret" {
+		t.Errorf("unexpected created queues %v", p.created)
+	}
+
+	delivery, err := qb.PeekLock("jobs", 0, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.acked) != 0 {
+		t.Fatal("lock must not be reported as ack")
+	}
+	if err := qb.Complete("jobs", delivery.LockToken); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(p.acked, ",") != "jobs:one" {
+		t.Errorf("unexpected acks %v", p.acked)
+	}
+
+	if qb.Authorize("alice", "secret", PermConsume) {
+		t.Error("plugin must deny consume from secret")
+	}
+	if !qb.Authorize("alice", "secret", PermProduce) || !qb.Authorize("alice", "jobs", PermConsume) {
+		t.Error("plugin must not deny other actions")
+	}
+}
+
+func TestRegisteredPlugin(t *testing.T) {
+	Register("test-registry", func() Plugin { return &testPlugin{} })
+	found := false
+	for _, name := range RegisteredPlugins() {
+		found = found || name == "test-registry"
+	}
+	if !found {
+		t.Errorf("registered plugin missing from %v", RegisteredPlugins())
+	}
+	p, err := NewRegisteredPlugin("test-registry")
+	if err != nil || p.Name() != "test" {
+		t.Fatalf("unexpected plugin %v, %v", p, err)
+	}
+	if _, err := NewRegisteredPlugin("missing"); err == nil {
+		t.Error("expected error for unknown plugin")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("duplicate registration must panic")
+		}
+	}()
+	Register("test-registry", func() Plugin { return &testPlugin{} })
+}
@@ -0,0 +1,134 @@
+package broker
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Publication сообщение и очередь, в которую его нужно поставить (см. EnqueueAll)
+type Publication struct {
+	Queue   string
+	Message *Message
+}
+
+// PublishError ошибка постановки одного из сообщений EnqueueAll
+type PublishError struct {
+	// Index номер сообщения в списке
+	Index int
+	Err   error
+}
+
+func (e *PublishError) Error() string {
+	return fmt.Sprintf("message %d: %v", e.Index, e.Err)
+}
+
+func (e *PublishError) Unwrap() error { return e.Err }
+
+// EnqueueAll ставит сообщения в их очереди атомарно: либо ставятся все, либо
+// ни одно. Каждое сообщение проходит те же преобразования и маршрутизацию,
+// что и в Enqueue; сообщения ставятся под одной блокировкой брокера, и если
+// какое-то не принято, уже поставленные удаляются раньше, чем их увидят
+// потребители. Повтор по DedupID считается принятым сообщением. Копии
+// сообщений по правилам маршрутизации ставятся после всех сообщений и,
+// как в Enqueue, отдельно от них.
+func (qb *QueueBroker) EnqueueAll(pubs []Publication) error {
+	type prepared struct {
+		queueName string
+		msg       *Message
+		copies    []string
+		copied    []*Message
+	}
+	items := make([]prepared, len(pubs))
+	var federation *Federation
+	for i, pub := range pubs {
+		if pub.Queue == CanaryQueue {
+			return &PublishError{Index: i, Err: ErrInvalidQueueName}
+		}
+		queueName, copies, f, err := qb.prepareEnqueue(pub.Queue, pub.Message)
+		if err != nil {
+			return &PublishError{Index: i, Err: err}
+		}
+		federation = f
+		copied := make([]*Message, len(copies))
+		for j := range copies {
+			copied[j] = copyMessage(pub.Message)
+		}
+		items[i] = prepared{queueName: queueName, msg: pub.Message, copies: copies, copied: copied}
+	}
+
+	qb.mu.Lock()
+	type placed struct {
+		queueName string
+		stored    *Message
+		created   bool
+	}
+	var done []placed
+	accepted := make([]bool, len(items))
+	for i, item := range items {
+		existed := qb.queues[item.queueName] != nil
+		stored, err := qb.enqueueStoredLocked(item.queueName, item.msg)
+		if errors.Is(err, ErrDuplicate) {
+			continue
+		}
+		if err != nil {
+			for k := len(done) - 1; k >= 0; k-- {
+				qb.rollbackEnqueueLocked(done[k].queueName, done[k].stored, done[k].created)
+			}
+			qb.mu.Unlock()
+			return &PublishError{Index: i, Err: err}
+		}
+		accepted[i] = true
+		done = append(done, placed{queueName: item.queueName, stored: stored, created: !existed})
+	}
+	for i, item := range items {
+		if accepted[i] {
+			qb.notifyTapsLocked(item.queueName, item.msg)
+		}
+	}
+	listeners := qb.enqueueListeners
+	qb.mu.Unlock()
+
+	for _, p := range done {
+		if p.created {
+			qb.notifyQueueListeners(QueueCreated, p.queueName)
+		}
+	}
+	for i, item := range items {
+		if !accepted[i] {
+			continue
+		}
+		for _, listener := range listeners {
+			listener(item.queueName, item.msg)
+		}
+		federation.publish(item.queueName, item.msg)
+	}
+	if err := qb.persist(); err != nil {
+		return err
+	}
+	for i, item := range items {
+		if accepted[i] {
+			qb.enqueueCopies(item.queueName, item.copies, item.copied, federation)
+		}
+	}
+	return nil
+}
+
+// rollbackEnqueueLocked удаляет только что поставленное сообщение и
+// созданную для него очередь. Ожидающие, разбуженные этим сообщением,
+// не найдут его и продолжат ждать.
+func (qb *QueueBroker) rollbackEnqueueLocked(queueName string, stored *Message, created bool) {
+	if _, remove, ok := qb.findMessageLocked(queueName, stored.id); ok {
+		remove()
+	}
+	qb.releaseLocked(queueName, stored)
+	if stored.DedupID != "" {
+		if dedup := qb.dedup[queueName]; dedup != nil {
+			delete(dedup.seen, stored.DedupID)
+		}
+	}
+	if created && qb.queues[queueName] != nil && qb.queues[queueName].len() == 0 && len(qb.delayed[queueName]) == 0 {
+		delete(qb.queues, queueName)
+		qb.index.remove(queueName)
+		delete(qb.dedup, queueName)
+	}
+}
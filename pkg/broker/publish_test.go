@@ -0,0 +1,55 @@
+package broker
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestEnqueueAll проверяет атомарную постановку в несколько очередей
+func TestEnqueueAll(t *testing.T) {
+	qb := NewQueueBroker(2, 10, 1)
+	qb.Enqueue("billing", &Message{Body: "old"})
+
+	fanOut := func(body string) []Publication {
+		return []Publication{
+			{Queue: "jobs", Message: &Message{Body: body}},
+			{Queue: "audit", Message: &Message{Body: body, DedupID: body}},
+			{Queue: "billing", Message: &Message{Body: body}},
+		}
+	}
+	if err := qb.EnqueueAll(fanOut("a")); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"jobs", "audit"} {
+		if qb.Depth(name) != 1 {
+			t.Errorf("expected 1 message in %s, got %d", name, qb.Depth(name))
+		}
+	}
+
+	// billing заполнена: не ставится ни одно сообщение, а созданная для
+	// них очередь удаляется
+	pubs := append(fanOut("b"), Publication{Queue: "extra", Message: &Message{Body: "b"}})
+	pubs[0], pubs[3] = pubs[3], pubs[0]
+	err := qb.EnqueueAll(pubs)
+	var publishErr *PublishError
+	if !errors.As(err, &publishErr) || publishErr.Index != 2 || !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull for message 2, got %v", err)
+	}
+	if qb.Depth("jobs") != 1 || qb.Depth("audit") != 1 || qb.Depth("billing") != 2 {
+		t.Errorf("partial publish was not rolled back: %d %d %d", qb.Depth("jobs"), qb.Depth("audit"), qb.Depth("billing"))
+	}
+	for _, name := range qb.QueueNames() {
+		if name == "extra" {
+			t.Error("queue created by rolled back publish must be removed")
+		}
+	}
+
+	// Ключ дедупликации отмененной постановки не запоминается
+	qb.Dequeue("billing", 0)
+	if err := qb.EnqueueAll(fanOut("b")); err != nil {
+		t.Fatal(err)
+	}
+	if qb.Depth("audit") != 2 {
+		t.Errorf("message with dedup id of rolled back publish was dropped")
+	}
+}
@@ -0,0 +1,58 @@
+package broker
+
+import "sort"
+
+// QueueInfo состояние очереди для списка очередей
+type QueueInfo struct {
+	Name string `json:"name"`
+	// Depth число ожидающих сообщений
+	Depth int `json:"depth"`
+	// Delayed число отложенных сообщений
+	Delayed int `json:"delayed"`
+	// InFlight число выданных в режиме peek-lock, но не подтвержденных сообщений
+	InFlight int `json:"in_flight"`
+	// Bytes объем хранимых сообщений очереди
+	Bytes int64 `json:"bytes"`
+	// Paused выдача из очереди приостановлена (Pause)
+	Paused bool `json:"paused,omitempty"`
+}
+
+// Queues возвращает существующие очереди (без служебной) в порядке имен
+func (qb *QueueBroker) Queues() []QueueInfo {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+
+	infos := make([]QueueInfo, 0, len(qb.queues))
+	for name, queue := range qb.queues {
+		if name == CanaryQueue {
+			continue
+		}
+		infos = append(infos, QueueInfo{Name: name, Depth: queue.len(), Delayed: len(qb.delayed[name]), InFlight: qb.inflight[name], Bytes: qb.queueBytes[name], Paused: qb.paused[name]})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// Purge удаляет все ожидающие (в том числе отложенные) сообщения очереди
+// и возвращает их число. Выданные, но не подтвержденные сообщения не затрагиваются.
+func (qb *QueueBroker) Purge(queueName string) (int, error) {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+
+	queue := qb.queues[queueName]
+	if queue == nil {
+		return 0, ErrQueueNotFound
+	}
+	if err := qb.standbyLocked(queueName); err != nil {
+		return 0, err
+	}
+	if qb.archiving[queueName] {
+		return 0, ErrQueueArchiving
+	}
+	purged := append(queue.messages, qb.dropDelayedLocked(queueName)...)
+	for _, stored := range purged {
+		qb.releaseLocked(queueName, stored)
+	}
+	queue.messages = nil
+	return len(purged), nil
+}
@@ -0,0 +1,40 @@
+package broker
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestQueuesAndPurge проверяет список очередей и очистку очереди
+func TestQueuesAndPurge(t *testing.T) {
+	qb := NewQueueBroker(10, 10, 1)
+	qb.Enqueue("b", &Message{Body: "b1"})
+	qb.Enqueue("a", &Message{Body: "a1"})
+	qb.Enqueue("a", &Message{Body: "a2"})
+	qb.Enqueue("a", &Message{Body: "a3"})
+	delivery, err := qb.PeekLock("a", 0, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []QueueInfo{{Name: "a", Depth: 2, InFlight: 1, Bytes: 6}, {Name: "b", Depth: 1, Bytes: 2}}
+	if got := qb.Queues(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Queues() = %+v, want %+v", got, want)
+	}
+
+	if count, err := qb.Purge("a"); err != nil || count != 2 {
+		t.Fatalf("Purge() = %d, %v", count, err)
+	}
+	if qb.Depth("a") != 0 || qb.QueueBytes("a") != 2 {
+		t.Errorf("unexpected state after purge: depth %d, bytes %d", qb.Depth("a"), qb.QueueBytes("a"))
+	}
+	// Заблокированное сообщение по-прежнему можно подтвердить
+	if err := qb.Complete("a", delivery.LockToken); err != nil {
+		t.Errorf("locked message lost by purge: %v", err)
+	}
+	if _, err := qb.Purge("missing"); !errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("expected ErrQueueNotFound, got %v", err)
+	}
+}
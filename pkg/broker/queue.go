@@ -0,0 +1,54 @@
+package broker
+
+// messageQueue хранилище сообщений одной очереди; все методы вызываются под qb.mu
+type messageQueue struct {
+	messages []*Message
+	// onReady вызывается (под qb.mu), когда в очереди может появиться
+	// доступное сообщение, и будит одного ожидающего получателя
+	onReady func()
+}
+
+func newMessageQueue(onReady func()) *messageQueue {
+	return &messageQueue{onReady: onReady}
+}
+
+// push добавляет сообщение в конец очереди и будит ожидающего
+func (q *messageQueue) push(msg *Message) {
+	q.messages = append(q.messages, msg)
+	q.wake()
+}
+
+// insertAt вставляет сообщение на позицию i и будит ожидающего
+func (q *messageQueue) insertAt(i int, msg *Message) {
+	q.messages = append(q.messages, nil)
+	copy(q.messages[i+1:], q.messages[i:])
+	q.messages[i] = msg
+	q.wake()
+}
+
+// wake будит ожидающего получателя
+func (q *messageQueue) wake() {
+	q.onReady()
+}
+
+// pop извлекает первое сообщение или возвращает nil для пустой очереди
+func (q *messageQueue) pop() *Message {
+	if len(q.messages) == 0 {
+		return nil
+	}
+	msg := q.messages[0]
+	q.messages[0] = nil
+	q.messages = q.messages[1:]
+	return msg
+}
+
+// removeAt удаляет сообщение с позиции i
+func (q *messageQueue) removeAt(i int) {
+	copy(q.messages[i:], q.messages[i+1:])
+	q.messages[len(q.messages)-1] = nil
+	q.messages = q.messages[:len(q.messages)-1]
+}
+
+func (q *messageQueue) len() int {
+	return len(q.messages)
+}
@@ -0,0 +1,97 @@
+package broker
+
+// QueueConfig настройки отдельной очереди
+type QueueConfig struct {
+	// DedupWindow окно подавления дубликатов в секундах (0 — выключено)
+	DedupWindow int `json:"dedup_window"`
+	// LockDuration длительность блокировки сообщения в режиме peek-lock в секундах
+	LockDuration int `json:"lock_duration"`
+	// CompressThreshold размер тела в байтах, начиная с которого сообщение хранится сжатым (0 — не сжимать)
+	CompressThreshold int `json:"compress_threshold"`
+	// Compression алгоритм сжатия: gzip, snappy или none (пусто — алгоритм по умолчанию)
+	Compression string `json:"compression,omitempty"`
+	// AffinityHeader заголовок, по значению которого сообщения закрепляются
+	// за потоковым потребителем, пока он подключен (пусто — выключено)
+	AffinityHeader string `json:"affinity_header,omitempty"`
+	// PauseWindows интервалы времени, в которые выдача сообщений приостановлена
+	PauseWindows []PauseWindow `json:"pause_windows,omitempty"`
+	// DefaultContentType тип содержимого сообщений, поставленных без него
+	// (например, application/octet-stream для очереди двоичных данных)
+	DefaultContentType string `json:"default_content_type,omitempty"`
+	// DeliveryDelayMs и DeliveryJitterMs искусственная задержка выдачи
+	// сообщений в миллисекундах: постоянная и случайная добавка к ней.
+	// Действуют, только если брокер запущен с SetLatencySimulation(true).
+	DeliveryDelayMs  int `json:"delivery_delay_ms,omitempty"`
+	DeliveryJitterMs int `json:"delivery_jitter_ms,omitempty"`
+	// MaxConsumers сколько потребителей (ожидающих long-poll и потоковых)
+	// может быть подключено к очереди одновременно (0 — без ограничения)
+	MaxConsumers int `json:"max_consumers,omitempty"`
+	// Retry политика повторов и переноса в очередь недоставленных сообщений
+	// (nil — сообщение сразу возвращается в очередь)
+	Retry *RetryPolicy `json:"retry,omitempty"`
+	// Transform скрипт, который при постановке изменяет, дополняет или
+	// отклоняет сообщение (см. QueueBroker.transform)
+	Transform string `json:"transform,omitempty"`
+	// Envelope режим конверта сообщений: celery — задачи хранятся как
+	// CeleryTask и выдаются в конверте протокола Celery v2 (пусто — выключено)
+	Envelope string `json:"envelope,omitempty"`
+	// AutoDeleteAfterIdle через сколько минут без постановок и выдач очередь
+	// удаляется вместе с сообщениями и настройками (0 — не удаляется)
+	AutoDeleteAfterIdle int `json:"auto_delete_after_idle,omitempty"`
+	// Aggregate выдача сообщений пакетами (nil — выключено)
+	Aggregate *AggregatePolicy `json:"aggregate,omitempty"`
+	// Overflow поведение при заполненной очереди: OverflowReject (по
+	// умолчанию) или OverflowBlock
+	Overflow string `json:"overflow,omitempty"`
+	// Retention и RetentionBytes сколько секунд и до какого объема в байтах
+	// хранить поставленные сообщения в журнале очереди, в том числе после
+	// выдачи, чтобы их можно было перечитать (см. ReadLog); 0 и 0 — журнал
+	// не ведется
+	Retention      int   `json:"retention,omitempty"`
+	RetentionBytes int64 `json:"retention_bytes,omitempty"`
+	// CompactionHeader заголовок с ключом сообщения: в журнале очереди
+	// остается только последняя запись с каждым значением ключа, как для
+	// очередей с обновлениями состояния сущностей (пусто — без уплотнения)
+	CompactionHeader string `json:"compaction_header,omitempty"`
+}
+
+// defaultQueueConfig настройки для очередей без явной конфигурации
+func (qb *QueueBroker) defaultQueueConfig() QueueConfig {
+	return QueueConfig{
+		DedupWindow:       qb.defaultDedupWindow,
+		LockDuration:      defaultLockDuration,
+		CompressThreshold: qb.defaultCompressThreshold,
+	}
+}
+
+// QueueConfig возвращает действующие настройки очереди
+func (qb *QueueBroker) QueueConfig(queueName string) QueueConfig {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	return qb.queueConfigLocked(queueName)
+}
+
+func (qb *QueueBroker) queueConfigLocked(queueName string) QueueConfig {
+	if cfg, ok := qb.configs[queueName]; ok {
+		return *cfg
+	}
+	return qb.defaultQueueConfig()
+}
+
+// SetQueueConfig задает настройки очереди. Очередь при этом не создается:
+// настройки можно задать заранее.
+func (qb *QueueBroker) SetQueueConfig(queueName string, cfg QueueConfig) {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	qb.configs[queueName] = &cfg
+	// Простой отсчитывается заново от момента, когда заданы настройки
+	qb.stopIdleLocked(queueName)
+	qb.touchLocked(queueName)
+}
+
+// SetDefaultDedupWindow задает окно подавления дубликатов по умолчанию в секундах
+func (qb *QueueBroker) SetDefaultDedupWindow(seconds int) {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	qb.defaultDedupWindow = seconds
+}
@@ -0,0 +1,105 @@
+package broker
+
+import "time"
+
+// CapacityError отказ в постановке сообщения из-за нехватки места: Err —
+// ErrQueueFull, ErrTooManyQueues, ошибка ограничения объема или квоты
+// арендатора. Текст ошибки совпадает с Err.
+type CapacityError struct {
+	Err   error
+	Queue string
+	// Used и Limit текущая заполненность и ограничение в единицах Unit
+	// ("messages", "bytes" или "queues")
+	Used  int64
+	Limit int64
+	Unit  string
+}
+
+func (e *CapacityError) Error() string { return e.Err.Error() }
+
+func (e *CapacityError) Unwrap() error { return e.Err }
+
+// storedSize объем памяти, занимаемый хранимым сообщением: тело (в хранимом,
+// возможно сжатом виде), заголовки и ключ дедупликации
+func storedSize(stored *Message) int64 {
+	size := len(stored.Body) + len(stored.DedupID) + len(stored.ContentType)
+	for name, value := range stored.Headers {
+		size += len(name) + len(value)
+	}
+	return int64(size)
+}
+
+// SetByteLimits задает ограничения объема сообщений в одной очереди и во всех
+// очередях в байтах (0 — без ограничения). Как и лимит числа сообщений,
+// объем учитывает выданные, но не подтвержденные сообщения.
+func (qb *QueueBroker) SetByteLimits(maxQueueBytes, maxTotalBytes int64) {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	qb.maxQueueBytes = maxQueueBytes
+	qb.maxTotalBytes = maxTotalBytes
+}
+
+// reserveLocked учитывает объем нового сообщения или возвращает ошибку при
+// превышении ограничений; служебная очередь самопроверки не ограничивается
+func (qb *QueueBroker) reserveLocked(queueName string, stored *Message) error {
+	size := storedSize(stored)
+	if queueName != CanaryQueue {
+		if qb.maxQueueBytes > 0 && qb.queueBytes[queueName]+size > qb.maxQueueBytes {
+			return &CapacityError{Err: ErrQueueByteLimit, Queue: queueName, Used: qb.queueBytes[queueName], Limit: qb.maxQueueBytes, Unit: "bytes"}
+		}
+		if qb.maxTotalBytes > 0 && qb.totalBytes+size > qb.maxTotalBytes {
+			return &CapacityError{Err: ErrTotalByteLimit, Queue: queueName, Used: qb.totalBytes, Limit: qb.maxTotalBytes, Unit: "bytes"}
+		}
+	}
+	qb.trackLocked(queueName, stored)
+	return nil
+}
+
+// trackLocked присваивает новому сообщению идентификатор и учитывает его объем
+func (qb *QueueBroker) trackLocked(queueName string, stored *Message) {
+	qb.nextMessageID++
+	stored.id = qb.nextMessageID
+	stored.enqueuedAt = time.Now()
+	qb.accountLocked(queueName, stored)
+}
+
+// accountLocked учитывает объем сообщения и передает его ведомым
+func (qb *QueueBroker) accountLocked(queueName string, stored *Message) {
+	size := storedSize(stored)
+	qb.queueBytes[queueName] += size
+	qb.totalBytes += size
+	qb.retainBodyLocked(stored)
+	// Без ведомых копия для журнала не нужна
+	if len(qb.replicas) > 0 {
+		qb.replicateLocked(ReplicationOp{Op: ReplicationPut, Queue: queueName, ID: stored.id, Message: replicatedMessage(stored)})
+	}
+}
+
+// releaseLocked снимает учет объема окончательно удаленного сообщения
+// и освобождает его группу
+func (qb *QueueBroker) releaseLocked(queueName string, stored *Message) {
+	size := storedSize(stored)
+	qb.queueBytes[queueName] -= size
+	qb.totalBytes -= size
+	if qb.queueBytes[queueName] <= 0 {
+		delete(qb.queueBytes, queueName)
+	}
+	qb.releaseGroupLocked(queueName, stored)
+	qb.releaseBodyLocked(stored)
+	qb.notifySpaceLocked(queueName)
+	qb.replicateLocked(ReplicationOp{Op: ReplicationRemove, Queue: queueName, ID: stored.id})
+}
+
+// QueueBytes возвращает объем сообщений очереди в байтах
+func (qb *QueueBroker) QueueBytes(queueName string) int64 {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	return qb.queueBytes[queueName]
+}
+
+// TotalBytes возвращает объем сообщений во всех очередях в байтах
+func (qb *QueueBroker) TotalBytes() int64 {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	return qb.totalBytes
+}
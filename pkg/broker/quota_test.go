@@ -0,0 +1,78 @@
+package broker
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestByteLimits проверяет учет объема сообщений и ограничения на очередь и на брокер
+func TestByteLimits(t *testing.T) {
+	qb := NewQueueBroker(100, 10, 10)
+	qb.SetByteLimits(10, 15)
+
+	if err := qb.PutMessage("a", "12345678"); err != nil {
+		t.Fatal(err)
+	}
+	if err := qb.PutMessage("a", "123"); !errors.Is(err, ErrQueueByteLimit) {
+		t.Errorf("expected queue byte limit, got %v", err)
+	}
+	if err := qb.PutMessage("b", "12345678"); !errors.Is(err, ErrTotalByteLimit) {
+		t.Errorf("expected total byte limit, got %v", err)
+	}
+	if qb.QueueBytes("a") != 8 || qb.TotalBytes() != 8 {
+		t.Errorf("unexpected accounting: %d %d", qb.QueueBytes("a"), qb.TotalBytes())
+	}
+
+	// Выданное в режиме peek-lock сообщение учитывается до подтверждения
+	delivery, err := qb.PeekLock("a", 0, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if qb.TotalBytes() != 8 {
+		t.Errorf("locked message must stay accounted, got %d", qb.TotalBytes())
+	}
+	qb.Complete("a", delivery.LockToken)
+	if qb.TotalBytes() != 0 || qb.QueueBytes("a") != 0 {
+		t.Errorf("expected accounting to drop after complete, got %d", qb.TotalBytes())
+	}
+
+	qb.PutMessage("a", "1234")
+	qb.Dequeue("a", 0)
+	if qb.TotalBytes() != 0 {
+		t.Errorf("expected accounting to drop after dequeue, got %d", qb.TotalBytes())
+	}
+
+	// Учитывается хранимый (сжатый) объем
+	qb.SetByteLimits(0, 0)
+	qb.SetDefaultCompressThreshold(100)
+	qb.PutMessage("c", strings.Repeat("x", 10000))
+	if size := qb.QueueBytes("c"); size == 0 || size >= 10000 {
+		t.Errorf("expected compressed size to be accounted, got %d", size)
+	}
+}
+
+// TestCapacityError проверяет заполненность и ограничение в ошибке нехватки места
+func TestCapacityError(t *testing.T) {
+	qb := NewQueueBroker(2, 1, 10)
+	qb.SetByteLimits(0, 5)
+	qb.PutMessage("jobs", "a")
+	qb.PutMessage("jobs", "b")
+
+	var capErr *CapacityError
+	err := qb.PutMessage("jobs", "c")
+	if !errors.As(err, &capErr) || !errors.Is(err, ErrQueueFull) || err.Error() != ErrQueueFull.Error() {
+		t.Fatalf("expected capacity error, got %v", err)
+	}
+	if capErr.Queue != "jobs" || capErr.Used != 2 || capErr.Limit != 2 || capErr.Unit != "messages" {
+		t.Errorf("unexpected capacity error %+v", capErr)
+	}
+	if err := qb.PutMessage("other", "x"); !errors.As(err, &capErr) || capErr.Unit != "queues" || capErr.Used != 1 || capErr.Limit != 1 {
+		t.Errorf("unexpected queue limit error %v", err)
+	}
+	qb.Dequeue("jobs", 0)
+	if err := qb.PutMessage("jobs", "12345"); !errors.As(err, &capErr) || !errors.Is(err, ErrTotalByteLimit) || capErr.Used != 1 || capErr.Limit != 5 {
+		t.Errorf("unexpected byte limit error %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package broker
+
+import "time"
+
+// maxReceiveQueues сколько очередей можно перечислить в DequeueAny
+const maxReceiveQueues = 100
+
+// DequeueAny извлекает сообщение из любой из очередей names, ожидая до
+// timeout, пока оно появится хотя бы в одной. Очередь, из которой
+// выдано сообщение, указана в Message.Queue. Очереди перебираются по кругу
+// с разных позиций, чтобы ни одна не простаивала.
+func (qb *QueueBroker) DequeueAny(names []string, timeout time.Duration) (*Message, error) {
+	stored, err := qb.dequeueAny(names, timeout)
+	if err != nil {
+		return nil, err
+	}
+	qb.mu.Lock()
+	qb.releaseLocked(stored.Queue, stored)
+	qb.mu.Unlock()
+	return qb.deliver(stored)
+}
+
+// dequeueAny извлекает хранимое сообщение из любой из очередей, как
+// dequeuePattern для шаблона: ожидающий ставится в очередь ожидающих
+// каждой из них и будится первым сообщением в любой
+func (qb *QueueBroker) dequeueAny(names []string, timeout time.Duration) (*Message, error) {
+	if len(names) == 0 || len(names) > maxReceiveQueues {
+		return nil, ErrInvalidQueueName
+	}
+	seen := make(map[string]bool, len(names))
+	unique := make([]string, 0, len(names))
+	for _, name := range names {
+		if name == "" || IsPattern(name) {
+			return nil, ErrInvalidQueueName
+		}
+		if !seen[name] {
+			seen[name] = true
+			unique = append(unique, name)
+		}
+	}
+	names = unique
+	deadline := time.NewTimer(qb.waitLimit(timeout))
+	defer deadline.Stop()
+
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	start := qb.receiveCursor
+	qb.receiveCursor++
+	var w *waiter
+	defer func() {
+		if w != nil {
+			for _, name := range names {
+				qb.removeWaiterLocked(name, w)
+			}
+		}
+	}()
+
+	for {
+		if w != nil {
+			w.signaled = false
+		}
+		exists := false
+		var paused time.Duration
+		now := time.Now()
+		for i := range names {
+			name := names[(start+i)%len(names)]
+			if err := qb.standbyLocked(name); err != nil {
+				return nil, err
+			}
+			queue := qb.queues[name]
+			if queue == nil {
+				continue
+			}
+			exists = true
+			if qb.archiving[name] || !qb.availableLocked(name, queue) {
+				continue
+			}
+			if d := qb.pausedLocked(name, now); d > 0 {
+				if paused == 0 || d < paused {
+					paused = d
+				}
+				continue
+			}
+			if msg := qb.popLocked(name, queue); msg != nil && !qb.forwardToOwnerLocked(name, nil, msg) {
+				qb.holdGroupLocked(name, msg)
+				return msg, nil
+			}
+		}
+		if !exists && timeout <= 0 {
+			return nil, ErrQueueNotFound
+		}
+		if timeout <= 0 {
+			return nil, ErrTimeout
+		}
+
+		if w == nil {
+			// Один ожидающий во всех очередях: сигнал любой из них будит его,
+			// и сообщение резервируется только в той, откуда пришел сигнал
+			w = &waiter{ready: make(chan struct{}, 1)}
+			for _, name := range names {
+				qb.waiters[name] = append(qb.waiters[name], w)
+			}
+		}
+		qb.mu.Unlock()
+		// Пробуждение по окончании самой короткой паузы среди очередей
+		resume, stop := resumeTimer(paused)
+		expired := false
+		select {
+		case <-w.ready:
+		case <-resume:
+		case <-deadline.C:
+			expired = true
+		}
+		stop()
+		qb.mu.Lock()
+		if expired {
+			for _, name := range names {
+				if qb.queues[name] != nil {
+					return nil, ErrTimeout
+				}
+			}
+			return nil, ErrQueueNotFound
+		}
+	}
+}
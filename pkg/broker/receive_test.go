@@ -0,0 +1,71 @@
+package broker
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestDequeueAny проверяет получение из нескольких очередей
+func TestDequeueAny(t *testing.T) {
+	qb := NewQueueBroker(10, 10, 10)
+	qb.PutMessage("a", "1")
+	qb.PutMessage("b", "2")
+
+	seen := map[string]bool{}
+	for range 2 {
+		msg, err := qb.DequeueAny([]string{"a", "b"}, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[msg.Queue] = true
+	}
+	if !seen["a"] || !seen["b"] {
+		t.Errorf("messages were not taken from both queues: %v", seen)
+	}
+	if _, err := qb.DequeueAny([]string{"a", "b"}, 0); !errors.Is(err, ErrTimeout) {
+		t.Errorf("expected ErrTimeout, got %v", err)
+	}
+	if _, err := qb.DequeueAny([]string{"x", "y"}, 0); !errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("expected ErrQueueNotFound, got %v", err)
+	}
+	for _, names := range [][]string{nil, {""}, {"a", "orders.*"}} {
+		if _, err := qb.DequeueAny(names, 0); !errors.Is(err, ErrInvalidQueueName) {
+			t.Errorf("%v: expected ErrInvalidQueueName, got %v", names, err)
+		}
+	}
+}
+
+// TestDequeueAnyWait проверяет, что ожидающий будится сообщением в любой
+// из очередей, в том числе еще не созданной, и не резервирует сообщения
+// других очередей
+func TestDequeueAnyWait(t *testing.T) {
+	qb := NewQueueBroker(10, 10, 10)
+	qb.PutMessage("a", "old")
+	qb.Dequeue("a", 0)
+
+	done := make(chan *Message)
+	go func() {
+		msg, err := qb.DequeueAny([]string{"a", "c"}, 5*time.Second)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- msg
+	}()
+	time.Sleep(50 * time.Millisecond)
+	qb.PutMessage("c", "new")
+	select {
+	case msg := <-done:
+		if msg.Queue != "c" || msg.Body != "new" {
+			t.Errorf("unexpected message %+v", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("waiter was not woken")
+	}
+
+	// Разбуженный сообщением из c не занимает сообщение в a
+	qb.PutMessage("a", "x")
+	if msg, err := qb.Dequeue("a", 0); err != nil || msg.Body != "x" {
+		t.Errorf("unexpected %+v %v", msg, err)
+	}
+}
@@ -0,0 +1,457 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"queue-broker/pkg/peer"
+	"queue-broker/pkg/rpc"
+)
+
+// Режим горячего резерва: основной брокер передает ведомым журнал изменений
+// хранимых сообщений — постановку и окончательное удаление (выдачу без
+// подтверждения, Complete, доставку потоковому потребителю). Блокировки
+// peek-lock не передаются: сообщение остается у ведомого до подтверждения,
+// поэтому после переключения неподтвержденные сообщения доставляются повторно.
+
+const (
+	// ReplicationReset очистить все очереди перед полной передачей состояния
+	ReplicationReset = "reset"
+	// ReplicationPut сообщение поставлено в очередь
+	ReplicationPut = "put"
+	// ReplicationRemove сообщение окончательно удалено из очереди
+	ReplicationRemove = "remove"
+
+	// replicationBufferSize сколько операций копится для медленного ведомого;
+	// при переполнении ведомый отключается и после переподключения получает
+	// состояние целиком
+	replicationBufferSize = 10000
+	// followerMaxBackoff максимальная пауза между попытками подключения к основному брокеру
+	followerMaxBackoff = 30 * time.Second
+)
+
+// ReplicationOp операция журнала репликации
+type ReplicationOp struct {
+	Op    string `json:"op"`
+	Queue string `json:"queue,omitempty"`
+	// ID идентификатор сообщения, уникальный в пределах основного брокера
+	ID      uint64             `json:"id,omitempty"`
+	Message *ReplicatedMessage `json:"message,omitempty"`
+}
+
+// ReplicatedMessage сообщение в хранимом виде: тело может быть сжато
+// и зашифровано ключом арендатора, поэтому передается как байты
+type ReplicatedMessage struct {
+	Body        []byte            `json:"body"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	DedupID     string            `json:"dedup_id,omitempty"`
+	ContentType string            `json:"content_type,omitempty"`
+	GroupID     string            `json:"group_id,omitempty"`
+	// Compressed тело сжато gzip; оставлено для ведомых, не знающих Compression
+	Compressed bool `json:"compressed,omitempty"`
+	// Compression алгоритм сжатия тела (пусто — не сжато или, при Compressed, gzip)
+	Compression string `json:"compression,omitempty"`
+	Encrypted   bool   `json:"encrypted,omitempty"`
+	// KeyID ключ из набора ключей брокера, которым зашифровано тело
+	KeyID string `json:"key_id,omitempty"`
+	// DeliverAt срок выдачи отложенного сообщения
+	DeliverAt time.Time `json:"deliver_at,omitzero"`
+}
+
+// compression возвращает алгоритм сжатия тела с учетом прежнего поля Compressed
+func (m *ReplicatedMessage) compression() string {
+	if m.Compression == "" && m.Compressed {
+		return CompressionGzip
+	}
+	return m.Compression
+}
+
+// ReplicationFeed поток операций для одного ведомого
+type ReplicationFeed struct {
+	// Initial операции, воспроизводящие состояние на момент подключения
+	// (начинаются с ReplicationReset)
+	Initial []ReplicationOp
+	// Ops последующие операции; канал закрывается, если ведомый не успевает
+	// их забирать, и после Close
+	Ops <-chan ReplicationOp
+
+	qb *QueueBroker
+	ch chan ReplicationOp
+	// local поток журнала предзаписи, а не ведомого (не учитывается в Followers)
+	local bool
+}
+
+// Replicate подключает ведомого: возвращает текущее состояние и поток
+// последующих изменений без пропусков между ними
+func (qb *QueueBroker) Replicate() *ReplicationFeed {
+	return qb.replicate(false)
+}
+
+func (qb *QueueBroker) replicate(local bool) *ReplicationFeed {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+
+	feed := qb.subscribeLocked(local)
+	feed.Initial = []ReplicationOp{{Op: ReplicationReset}}
+	stored := qb.storedMessagesLocked()
+	names := make([]string, 0, len(stored))
+	for name := range stored {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if name == CanaryQueue {
+			continue
+		}
+		for _, msg := range stored[name] {
+			feed.Initial = append(feed.Initial, ReplicationOp{Op: ReplicationPut, Queue: name, ID: msg.id, Message: replicatedMessage(msg)})
+		}
+	}
+	return feed
+}
+
+// subscribeLocked подключает поток последующих операций без начального состояния
+func (qb *QueueBroker) subscribeLocked(local bool) *ReplicationFeed {
+	feed := &ReplicationFeed{qb: qb, ch: make(chan ReplicationOp, replicationBufferSize), local: local}
+	feed.Ops = feed.ch
+	qb.replicas[feed] = struct{}{}
+	return feed
+}
+
+// Close отключает ведомого
+func (feed *ReplicationFeed) Close() {
+	qb := feed.qb
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	feed.closeLocked()
+}
+
+func (feed *ReplicationFeed) closeLocked() {
+	if _, ok := feed.qb.replicas[feed]; ok {
+		delete(feed.qb.replicas, feed)
+		close(feed.ch)
+	}
+}
+
+// Followers возвращает число подключенных ведомых
+func (qb *QueueBroker) Followers() int {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	count := 0
+	for feed := range qb.replicas {
+		if !feed.local {
+			count++
+		}
+	}
+	return count
+}
+
+func replicatedMessage(stored *Message) *ReplicatedMessage {
+	return &ReplicatedMessage{
+		Body:        []byte(stored.Body),
+		Headers:     stored.Headers,
+		DedupID:     stored.DedupID,
+		ContentType: stored.ContentType,
+		GroupID:     stored.GroupID,
+		Compressed:  stored.compression == CompressionGzip,
+		Compression: stored.compression,
+		Encrypted:   stored.encrypted,
+		KeyID:       stored.keyID,
+		DeliverAt:   stored.DeliverAt,
+	}
+}
+
+// replicateLocked передает операцию всем ведомым; не успевающий ведомый отключается
+func (qb *QueueBroker) replicateLocked(op ReplicationOp) {
+	if op.Queue == CanaryQueue {
+		return
+	}
+	for feed := range qb.replicas {
+		select {
+		case feed.ch <- op:
+		default:
+			delete(qb.replicas, feed)
+			close(feed.ch)
+		}
+	}
+}
+
+// ApplyReplication применяет операцию журнала основного брокера. Лимиты
+// очередей при этом не проверяются.
+func (qb *QueueBroker) ApplyReplication(op ReplicationOp) error {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	return qb.applyLocked(op)
+}
+
+func (qb *QueueBroker) applyLocked(op ReplicationOp) error {
+	switch op.Op {
+	case ReplicationReset:
+		qb.resetStoredLocked()
+	case ReplicationPut:
+		if op.Queue == "" || op.Message == nil {
+			return errors.New("invalid replication op")
+		}
+		queue := qb.queues[op.Queue]
+		if queue == nil {
+			queue = qb.newQueueLocked(op.Queue)
+			qb.queues[op.Queue] = queue
+			qb.index.add(op.Queue)
+		}
+		stored := &Message{
+			Body:        string(op.Message.Body),
+			Headers:     op.Message.Headers,
+			DedupID:     op.Message.DedupID,
+			ContentType: op.Message.ContentType,
+			GroupID:     op.Message.GroupID,
+			DeliverAt:   op.Message.DeliverAt,
+			Queue:       op.Queue,
+			compression: op.Message.compression(),
+			encrypted:   op.Message.Encrypted,
+			keyID:       op.Message.KeyID,
+			id:          op.ID,
+			enqueuedAt:  time.Now(),
+		}
+		if op.ID > qb.nextMessageID {
+			qb.nextMessageID = op.ID
+		}
+		// Ведомый запоминает ключи дедупликации, чтобы повтор продюсера после
+		// переключения не создал дубликат
+		if window := time.Duration(qb.queueConfigLocked(op.Queue).DedupWindow) * time.Second; stored.DedupID != "" && window > 0 {
+			if qb.dedup[op.Queue] == nil {
+				qb.dedup[op.Queue] = newDedupCache()
+			}
+			qb.dedup[op.Queue].remember(stored.DedupID, window, time.Now())
+		}
+		qb.accountLocked(op.Queue, stored)
+		// Отложенное сообщение выдается по прежнему сроку
+		if stored.DeliverAt.After(time.Now()) {
+			qb.scheduleLocked(op.Queue, stored, stored.DeliverAt)
+		} else {
+			queue.push(stored)
+		}
+	case ReplicationRemove:
+		if qb.queues[op.Queue] == nil {
+			return nil
+		}
+		// Сообщение может быть и отложенным
+		if stored, remove, ok := qb.findMessageLocked(op.Queue, op.ID); ok {
+			remove()
+			qb.releaseLocked(op.Queue, stored)
+		}
+	default:
+		return fmt.Errorf("unknown replication op %q", op.Op)
+	}
+	return nil
+}
+
+// resetStoredLocked удаляет все хранимые сообщения перед полной передачей
+// состояния: ожидающие, отложенные, выданные в режиме peek-lock и переданные
+// потокам по сродству, — вместе с их учетом и журналами очередей. Очереди,
+// их настройки и права сохраняются.
+func (qb *QueueBroker) resetStoredLocked() {
+	stored := qb.storedMessagesLocked()
+	for token, lock := range qb.locks {
+		if lock.queueName != CanaryQueue {
+			lock.timer.Stop()
+			delete(qb.locks, token)
+		}
+	}
+	for name, queue := range qb.queues {
+		if name == CanaryQueue {
+			continue
+		}
+		for _, msg := range stored[name] {
+			qb.releaseLocked(name, msg)
+		}
+		queue.messages = nil
+		qb.dropDelayedLocked(name)
+		if aff := qb.affinity[name]; aff != nil {
+			for _, owner := range aff.owners {
+				owner.mailbox = nil
+			}
+		}
+		delete(qb.inflight, name)
+		delete(qb.groups, name)
+		qb.dropLogLocked(name)
+	}
+}
+
+// Follower получает журнал операций основного брокера и применяет его
+// к локальному брокеру, который до переключения не обслуживает клиентов
+type Follower struct {
+	primary string
+	client  *http.Client
+	secret  string
+	ctx     context.Context
+	cancel  context.CancelFunc
+
+	mu        sync.Mutex
+	connected bool
+	lastError error
+	// lastFailure последняя ошибка связи, не сбрасываемая после переподключения
+	lastFailure   error
+	lastFailureAt time.Time
+}
+
+// NewFollower создает ведомого для основного брокера с базовым URL primaryURL
+func NewFollower(primaryURL string) *Follower {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Follower{
+		primary: strings.TrimRight(primaryURL, "/"),
+		client:  rpc.NewClient(),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// SetPeerSecret задает общий секрет, который ведомый передает основному
+// брокеру (см. пакет peer); вызывается до SetFollower
+func (f *Follower) SetPeerSecret(secret string) {
+	f.secret = secret
+}
+
+// SetFollower переводит брокер в режим резерва и запускает получение журнала.
+// В этом режиме постановка и выдача сообщений отклоняются до вызова Promote.
+func (qb *QueueBroker) SetFollower(f *Follower) {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	qb.follower = f
+	go f.run(qb)
+}
+
+// Standby сообщает, находится ли брокер в режиме резерва; узел кластера
+// Raft (см. StartConsensus) находится в нем, пока не станет лидером
+func (qb *QueueBroker) Standby() bool {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	return qb.passiveLocked()
+}
+
+// passiveLocked брокер не обслуживает клиентов: он ведомый горячего резерва
+// или узел кластера Raft, не являющийся лидером
+func (qb *QueueBroker) passiveLocked() bool {
+	return qb.follower != nil || qb.consensus != nil && !qb.consensus.leading
+}
+
+// Promote переключает ведомый брокер в основной: получение журнала
+// прекращается, и брокер начинает обслуживать клиентов
+func (qb *QueueBroker) Promote() error {
+	qb.mu.Lock()
+	f := qb.follower
+	qb.follower = nil
+	qb.mu.Unlock()
+	if f == nil {
+		return ErrNotStandby
+	}
+	f.Close()
+	return nil
+}
+
+// standbyLocked возвращает ошибку для клиентских операций в режиме резерва;
+// служебная очередь самопроверки работает всегда
+func (qb *QueueBroker) standbyLocked(queueName string) error {
+	if qb.passiveLocked() && queueName != CanaryQueue {
+		return ErrStandby
+	}
+	return nil
+}
+
+// Close прекращает получение журнала
+func (f *Follower) Close() {
+	f.cancel()
+}
+
+// Connected сообщает, подключен ли ведомый к основному брокеру
+func (f *Follower) Connected() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.connected
+}
+
+// LastError возвращает последнюю ошибку связи с основным брокером
+func (f *Follower) LastError() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.lastError
+}
+
+// run подключается к основному брокеру, повторяя с экспоненциальной паузой при обрыве
+func (f *Follower) run(qb *QueueBroker) {
+	backoff := 100 * time.Millisecond
+	for {
+		received, err := f.follow(qb)
+		f.mu.Lock()
+		f.connected = false
+		f.lastError = err
+		if err != nil && f.ctx.Err() == nil {
+			f.lastFailure, f.lastFailureAt = err, time.Now()
+		}
+		f.mu.Unlock()
+		if f.ctx.Err() != nil {
+			return
+		}
+		if received {
+			backoff = 100 * time.Millisecond
+		}
+		log.Printf("replication: connection to %s lost: %v", f.primary, err)
+
+		select {
+		case <-f.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > followerMaxBackoff {
+			backoff = followerMaxBackoff
+		}
+	}
+}
+
+// follow читает поток операций; received сообщает, было ли получено состояние
+func (f *Follower) follow(qb *QueueBroker) (received bool, err error) {
+	stream, err := rpc.Call(f.ctx, f.client, f.primary, ReplicationStreamMethod, nil, func(req *http.Request) {
+		peer.Sign(req, f.secret)
+	})
+	if err != nil {
+		return false, err
+	}
+	defer stream.Close()
+
+	f.mu.Lock()
+	f.connected = true
+	f.mu.Unlock()
+
+	for {
+		data, err := stream.Recv()
+		if err == io.EOF {
+			return received, errors.New("stream closed by primary")
+		}
+		if err != nil {
+			return received, err
+		}
+		var op ReplicationOp
+		if err := op.UnmarshalBinary(data); err != nil {
+			return received, fmt.Errorf("decode replication op: %w", err)
+		}
+		qb.mu.Lock()
+		// После Promote оставшиеся в потоке операции не применяются
+		if qb.follower != f {
+			qb.mu.Unlock()
+			return received, errors.New("promoted")
+		}
+		err = qb.applyLocked(op)
+		qb.mu.Unlock()
+		if err != nil {
+			return received, err
+		}
+		received = true
+	}
+}
@@ -0,0 +1,115 @@
+package broker
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"queue-broker/pkg/rpc"
+)
+
+// ReplicationStreamMethod метод gRPC потока журнала (см. replication.proto)
+const ReplicationStreamMethod = "/queuebroker.replication.v1.Replication/Stream"
+
+// replicationOpTypes значения OpType для операций журнала
+var replicationOpTypes = map[string]uint64{ReplicationReset: 1, ReplicationPut: 2, ReplicationRemove: 3}
+
+// MarshalBinary кодирует операцию в сообщение protobuf Op
+func (op ReplicationOp) MarshalBinary() ([]byte, error) {
+	opType, ok := replicationOpTypes[op.Op]
+	if !ok {
+		return nil, fmt.Errorf("unknown replication op %q", op.Op)
+	}
+	b := rpc.AppendVarint(nil, 1, opType)
+	b = rpc.AppendString(b, 2, op.Queue)
+	b = rpc.AppendVarint(b, 3, op.ID)
+	if m := op.Message; m != nil {
+		var msg []byte
+		msg = rpc.AppendBytes(msg, 1, m.Body)
+		for k, v := range m.Headers {
+			msg = rpc.AppendMessage(msg, 2, rpc.AppendString(rpc.AppendString(nil, 1, k), 2, v))
+		}
+		msg = rpc.AppendString(msg, 3, m.DedupID)
+		msg = rpc.AppendString(msg, 4, m.ContentType)
+		msg = rpc.AppendString(msg, 5, m.GroupID)
+		msg = rpc.AppendString(msg, 6, m.compression())
+		msg = rpc.AppendBool(msg, 7, m.Encrypted)
+		msg = rpc.AppendString(msg, 8, m.KeyID)
+		if !m.DeliverAt.IsZero() {
+			msg = rpc.AppendVarint(msg, 9, uint64(m.DeliverAt.UnixNano()))
+		}
+		b = rpc.AppendMessage(b, 4, msg)
+	}
+	return b, nil
+}
+
+// UnmarshalBinary разбирает сообщение protobuf Op
+func (op *ReplicationOp) UnmarshalBinary(data []byte) error {
+	*op = ReplicationOp{}
+	err := rpc.ParseFields(data, func(f rpc.Field) error {
+		switch f.Num {
+		case 1:
+			for name, opType := range replicationOpTypes {
+				if opType == f.Varint {
+					op.Op = name
+				}
+			}
+			if op.Op == "" {
+				return fmt.Errorf("unknown replication op type %d", f.Varint)
+			}
+		case 2:
+			op.Queue = string(f.Bytes)
+		case 3:
+			op.ID = f.Varint
+		case 4:
+			op.Message = &ReplicatedMessage{}
+			return op.Message.unmarshal(f.Bytes)
+		}
+		return nil
+	})
+	if err == nil && op.Op == "" {
+		err = errors.New("replication op type is missing")
+	}
+	return err
+}
+
+func (m *ReplicatedMessage) unmarshal(data []byte) error {
+	return rpc.ParseFields(data, func(f rpc.Field) error {
+		switch f.Num {
+		case 1:
+			m.Body = append([]byte(nil), f.Bytes...)
+		case 2:
+			var key, value string
+			if err := rpc.ParseFields(f.Bytes, func(e rpc.Field) error {
+				switch e.Num {
+				case 1:
+					key = string(e.Bytes)
+				case 2:
+					value = string(e.Bytes)
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+			if m.Headers == nil {
+				m.Headers = make(map[string]string)
+			}
+			m.Headers[key] = value
+		case 3:
+			m.DedupID = string(f.Bytes)
+		case 4:
+			m.ContentType = string(f.Bytes)
+		case 5:
+			m.GroupID = string(f.Bytes)
+		case 6:
+			m.Compression = string(f.Bytes)
+		case 7:
+			m.Encrypted = f.Varint != 0
+		case 8:
+			m.KeyID = string(f.Bytes)
+		case 9:
+			m.DeliverAt = time.Unix(0, int64(f.Varint))
+		}
+		return nil
+	})
+}
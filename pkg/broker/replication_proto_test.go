@@ -0,0 +1,46 @@
+package broker
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestReplicationOpProto проверяет кодирование операций журнала в protobuf
+func TestReplicationOpProto(t *testing.T) {
+	for _, op := range []ReplicationOp{
+		{Op: ReplicationReset},
+		{Op: ReplicationPut, Queue: "jobs", ID: 42, Message: &ReplicatedMessage{
+			Body: []byte{0x00, 0xff}, Headers: map[string]string{"k": "v", "empty": ""}, DedupID: "d-1",
+			ContentType: "application/octet-stream", GroupID: "g", Compression: CompressionSnappy, Encrypted: true, KeyID: "2026-10",
+			DeliverAt: time.Unix(0, 1791000000123456789),
+		}},
+		{Op: ReplicationPut, Queue: "jobs", ID: 43, Message: &ReplicatedMessage{}},
+		{Op: ReplicationRemove, Queue: "jobs", ID: 42},
+	} {
+		data, err := op.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded ReplicationOp
+		if err := decoded.UnmarshalBinary(data); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(decoded, op) {
+			t.Errorf("round trip: got %+v, want %+v", decoded, op)
+		}
+	}
+
+	// Прежнее поле Compressed передается как алгоритм gzip
+	data, _ := ReplicationOp{Op: ReplicationPut, Queue: "jobs", Message: &ReplicatedMessage{Compressed: true}}.MarshalBinary()
+	var decoded ReplicationOp
+	if err := decoded.UnmarshalBinary(data); err != nil || decoded.Message.compression() != CompressionGzip {
+		t.Errorf("legacy compression flag lost: %+v %v", decoded.Message, err)
+	}
+	if _, err := (ReplicationOp{Op: "truncate"}).MarshalBinary(); err == nil {
+		t.Error("unknown op encoded")
+	}
+	if err := decoded.UnmarshalBinary(nil); err == nil {
+		t.Error("op without type decoded")
+	}
+}
@@ -0,0 +1,196 @@
+package broker
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pump применяет к ведомому все накопившиеся операции
+func pump(t *testing.T, feed *ReplicationFeed, follower *QueueBroker) {
+	t.Helper()
+	for {
+		select {
+		case op := <-feed.Ops:
+			if err := follower.ApplyReplication(op); err != nil {
+				t.Fatal(err)
+			}
+		default:
+			return
+		}
+	}
+}
+
+// TestReplicationFeed проверяет, что ведомый повторяет состояние основного
+// брокера: начальное состояние, постановку, выдачу и подтверждение
+func TestReplicationFeed(t *testing.T) {
+	primary := NewQueueBroker(10, 10, 1)
+	primary.SetDefaultCompressThreshold(10)
+	primary.Enqueue("jobs", &Message{Body: "before"})
+
+	feed := primary.Replicate()
+	defer feed.Close()
+	follower := NewQueueBroker(10, 10, 1)
+	follower.Enqueue("stale", &Message{Body: "x"})
+	for _, op := range feed.Initial {
+		if err := follower.ApplyReplication(op); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if follower.Depth("jobs") != 1 || follower.Depth("stale") != 0 {
+		t.Fatalf("initial state not applied: jobs=%d stale=%d", follower.Depth("jobs"), follower.Depth("stale"))
+	}
+
+	primary.Enqueue("jobs", &Message{Body: strings.Repeat("compressed ", 10)})
+	primary.Enqueue("jobs", &Message{Body: "third", Headers: map[string]string{"k": "v"}})
+	if _, err := primary.Dequeue("jobs", 0); err != nil {
+		t.Fatal(err)
+	}
+	delivery, err := primary.PeekLock("jobs", 0, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pump(t, feed, follower)
+	// Заблокированное сообщение остается у ведомого до подтверждения
+	if follower.Depth("jobs") != 2 {
+		t.Fatalf("expected 2 messages on follower, got %d", follower.Depth("jobs"))
+	}
+	primary.Complete("jobs", delivery.LockToken)
+	pump(t, feed, follower)
+
+	msg, err := follower.Dequeue("jobs", 0)
+	if err != nil || msg.Body != "third" || msg.Headers["k"] != "v" {
+		t.Fatalf("unexpected follower message %+v %v", msg, err)
+	}
+	if follower.TotalBytes() != 0 {
+		t.Errorf("byte accounting not released on follower: %d", follower.TotalBytes())
+	}
+}
+
+// TestReplicationSlowFollower проверяет отключение не успевающего ведомого
+func TestReplicationSlowFollower(t *testing.T) {
+	primary := NewQueueBroker(replicationBufferSize+10, 10, 1)
+	feed := primary.Replicate()
+	for i := 0; i <= replicationBufferSize; i++ {
+		primary.Enqueue("jobs", &Message{Body: "x"})
+	}
+	for range feed.Ops {
+	}
+	if primary.Followers() != 0 {
+		t.Errorf("slow follower was not disconnected")
+	}
+	feed.Close()
+}
+
+// TestStandbyAndPromote проверяет отказ в обслуживании до переключения
+func TestStandbyAndPromote(t *testing.T) {
+	qb := NewQueueBroker(10, 10, 1)
+	if err := qb.Promote(); err == nil {
+		t.Error("expected promote of a primary to fail")
+	}
+	qb.SetFollower(NewFollower("http://127.0.0.1:1"))
+	if err := qb.Enqueue("jobs", &Message{Body: "x"}); !errors.Is(err, ErrStandby) {
+		t.Errorf("expected standby error, got %v", err)
+	}
+	if _, err := qb.Dequeue("jobs.*", 0); !errors.Is(err, ErrStandby) {
+		t.Errorf("expected standby error for pattern, got %v", err)
+	}
+	if err := qb.Enqueue(CanaryQueue, &Message{Body: "ping"}); err != nil {
+		t.Errorf("canary rejected in standby: %v", err)
+	}
+
+	if err := qb.Promote(); err != nil {
+		t.Fatal(err)
+	}
+	if qb.Standby() {
+		t.Error("broker still in standby after promote")
+	}
+	if err := qb.Enqueue("jobs", &Message{Body: "x"}); err != nil {
+		t.Errorf("enqueue after promote failed: %v", err)
+	}
+}
+
+// TestReplicationResetClearsState проверяет, что при повторном подключении
+// ведомого его выданные, отложенные и учтенные сообщения заменяются
+// состоянием основного брокера
+func TestReplicationResetClearsState(t *testing.T) {
+	primary := NewQueueBroker(10, 10, 1)
+	primary.Enqueue("jobs", &Message{Body: "current"})
+
+	follower := NewQueueBroker(10, 10, 1)
+	follower.Enqueue("jobs", &Message{Body: "locked", GroupID: "g"})
+	follower.Enqueue("jobs", &Message{Body: "delayed", DeliverAt: time.Now().Add(50 * time.Millisecond)})
+	follower.Enqueue("jobs", &Message{Body: "waiting", GroupID: "g"})
+	delivery, err := follower.PeekLock("jobs", 0, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	feed := primary.Replicate()
+	defer feed.Close()
+	for _, op := range feed.Initial {
+		if err := follower.ApplyReplication(op); err != nil {
+			t.Fatal(err)
+		}
+	}
+	info := follower.Queues()
+	if len(info) != 1 || info[0].Depth != 1 || info[0].Delayed != 0 || info[0].InFlight != 0 || info[0].Bytes != primary.QueueBytes("jobs") {
+		t.Fatalf("stale state after reset: %+v", info)
+	}
+	if follower.TotalBytes() != primary.TotalBytes() {
+		t.Errorf("byte accounting: follower %d, primary %d", follower.TotalBytes(), primary.TotalBytes())
+	}
+	if err := follower.Complete("jobs", delivery.LockToken); !errors.Is(err, ErrLockNotFound) {
+		t.Errorf("lock survived reset: %v", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	msg, err := follower.Dequeue("jobs", 0)
+	if err != nil || msg.Body != "current" {
+		t.Fatalf("unexpected message %+v %v", msg, err)
+	}
+	if msg, err := follower.Dequeue("jobs", 0); err == nil {
+		t.Errorf("message from before reset delivered: %q", msg.Body)
+	}
+	if follower.TotalBytes() != 0 {
+		t.Errorf("byte accounting not released: %d", follower.TotalBytes())
+	}
+}
+
+// TestReplicationDelayed проверяет, что ведомый откладывает сообщение до
+// срока основного брокера и удаляет его вместе с основным
+func TestReplicationDelayed(t *testing.T) {
+	primary := NewQueueBroker(10, 10, 1)
+	deliverAt := time.Now().Add(time.Hour)
+	primary.Enqueue("jobs", &Message{Body: "later", DeliverAt: deliverAt})
+	primary.Enqueue("jobs", &Message{Body: "cancelled", DeliverAt: deliverAt})
+
+	follower := NewQueueBroker(10, 10, 1)
+	feed := primary.Replicate()
+	defer feed.Close()
+	for _, op := range feed.Initial {
+		if err := follower.ApplyReplication(op); err != nil {
+			t.Fatal(err)
+		}
+	}
+	info := follower.Queues()
+	if len(info) != 1 || info[0].Depth != 0 || info[0].Delayed != 2 {
+		t.Fatalf("delayed messages delivered early: %+v", info)
+	}
+	scheduled, _ := follower.Scheduled("jobs")
+	if len(scheduled) != 2 || !scheduled[0].DeliverAt.Equal(deliverAt) {
+		t.Fatalf("delivery time lost: %+v", scheduled)
+	}
+
+	if err := primary.DeleteMessage("jobs", scheduled[1].ID); err != nil {
+		t.Fatal(err)
+	}
+	pump(t, feed, follower)
+	if scheduled, _ := follower.Scheduled("jobs"); len(scheduled) != 1 || scheduled[0].Body != "later" {
+		t.Errorf("removed delayed message kept on the follower: %+v", scheduled)
+	}
+	if follower.TotalBytes() != primary.TotalBytes() {
+		t.Errorf("byte accounting: follower %d, primary %d", follower.TotalBytes(), primary.TotalBytes())
+	}
+}
@@ -0,0 +1,254 @@
+package broker
+
+import (
+	"sort"
+	"time"
+)
+
+// LogRecord сообщение журнала очереди с хранением (см. QueueConfig.Retention)
+type LogRecord struct {
+	*Message
+	// Offset номер сообщения в журнале очереди: растет с каждой постановкой
+	// и не меняется после выдачи
+	Offset     uint64    `json:"offset"`
+	EnqueuedAt time.Time `json:"enqueued_at"`
+}
+
+// logEntry хранимая запись журнала; тело в том же виде, что и в очереди
+// (сжатое или зашифрованное). Запись, вытесненная при уплотнении, остается
+// в entries с пустым stored, пока журнал не будет переупакован.
+type logEntry struct {
+	stored *Message
+	offset uint64
+	at     time.Time
+	size   int64
+	// key ключ уплотнения записи (см. QueueConfig.CompactionHeader)
+	key string
+}
+
+// messageLog журнал очереди: все поставленные сообщения, в том числе уже
+// выданные, пока они не старше Retention и умещаются в RetentionBytes
+type messageLog struct {
+	// entries записи по возрастанию номеров; после уплотнения номера идут
+	// с пропусками
+	entries []logEntry
+	// first номер записи entries[0], next — номер следующей записи
+	first, next uint64
+	bytes       int64
+	// keys номер последней записи по ключу уплотнения keyHeader
+	keys      map[string]uint64
+	keyHeader string
+	// removed сколько записей entries вытеснено при уплотнении
+	removed int
+	// appended закрывается при добавлении записи и будит читателей журнала
+	appended chan struct{}
+	// offsets зафиксированные смещения групп потребителей (см. CommitOffset)
+	offsets map[string]uint64
+	// release снимает ссылку удаленной записи на вынесенное тело
+	release func(*Message)
+}
+
+// retains сообщает, ведется ли для очереди с настройками cfg журнал
+func (cfg QueueConfig) retains() bool {
+	return cfg.Retention > 0 || cfg.RetentionBytes > 0
+}
+
+// appendLogLocked добавляет поставленное сообщение в журнал очереди, если
+// для нее задано хранение
+func (qb *QueueBroker) appendLogLocked(queueName string, stored *Message, now time.Time) {
+	cfg := qb.queueConfigLocked(queueName)
+	if !cfg.retains() || queueName == CanaryQueue {
+		qb.dropLogLocked(queueName)
+		return
+	}
+	log := qb.logs[queueName]
+	if log == nil {
+		log = &messageLog{release: qb.releaseBodyLocked}
+		qb.logs[queueName] = log
+	}
+	// Копия: сообщение в очереди могут изменить при выдаче и повторах
+	c := *stored
+	qb.retainBodyLocked(&c)
+	size := storedSize(&c)
+	e := logEntry{stored: &c, offset: log.next, at: now, size: size}
+	if cfg.CompactionHeader != "" {
+		e.key = c.Headers[cfg.CompactionHeader]
+	}
+	log.compact(cfg.CompactionHeader, e.key)
+	log.entries = append(log.entries, e)
+	log.next++
+	log.bytes += size
+	log.trim(cfg, now)
+	if log.appended != nil {
+		close(log.appended)
+		log.appended = nil
+	}
+}
+
+// compact вытесняет из журнала прежнюю запись с ключом key, которая станет
+// неактуальной после записи log.next; записи без ключа не уплотняются
+func (log *messageLog) compact(header, key string) {
+	if header != log.keyHeader {
+		// Заголовок ключа изменен: прежние записи больше не уплотняются
+		log.keys, log.keyHeader = nil, header
+	}
+	if key == "" {
+		return
+	}
+	if log.keys == nil {
+		log.keys = make(map[string]uint64)
+	}
+	if offset, ok := log.keys[key]; ok {
+		if i := log.find(offset); i >= 0 && log.entries[i].offset == offset {
+			log.bytes -= log.entries[i].size
+			log.release(log.entries[i].stored)
+			log.entries[i].stored = nil
+			log.removed++
+		}
+	}
+	log.keys[key] = log.next
+
+	// Переупаковка, когда вытесненные записи занимают больше половины журнала
+	if log.removed > len(log.entries)/2 {
+		live := log.entries[:0]
+		for _, e := range log.entries {
+			if e.stored != nil {
+				live = append(live, e)
+			}
+		}
+		clear(log.entries[len(live):])
+		log.entries, log.removed = live, 0
+	}
+}
+
+// trim удаляет записи старше Retention и самые старые записи сверх
+// RetentionBytes, а также вытесненные записи в начале журнала
+func (log *messageLog) trim(cfg QueueConfig, now time.Time) {
+	maxAge := time.Duration(cfg.Retention) * time.Second
+	for len(log.entries) > 0 {
+		e := log.entries[0]
+		if e.stored != nil && !(cfg.Retention > 0 && now.Sub(e.at) > maxAge) && !(cfg.RetentionBytes > 0 && log.bytes > cfg.RetentionBytes) {
+			break
+		}
+		log.entries[0] = logEntry{}
+		log.entries = log.entries[1:]
+		if e.stored == nil {
+			log.removed--
+		} else {
+			log.bytes -= e.size
+			log.release(e.stored)
+			if e.key != "" && log.keys[e.key] == e.offset {
+				delete(log.keys, e.key)
+			}
+		}
+	}
+	log.first = log.next
+	if len(log.entries) > 0 {
+		log.first = log.entries[0].offset
+	}
+}
+
+// dropLogLocked удаляет журнал очереди вместе с его записями
+func (qb *QueueBroker) dropLogLocked(queueName string) {
+	if log := qb.logs[queueName]; log != nil {
+		for _, e := range log.entries {
+			if e.stored != nil {
+				log.release(e.stored)
+			}
+		}
+		delete(qb.logs, queueName)
+	}
+}
+
+// find индекс первой невытесненной записи с номером не меньше offset или -1
+func (log *messageLog) find(offset uint64) int {
+	i := sort.Search(len(log.entries), func(i int) bool { return log.entries[i].offset >= offset })
+	for ; i < len(log.entries); i++ {
+		if log.entries[i].stored != nil {
+			return i
+		}
+	}
+	return -1
+}
+
+// logLocked возвращает журнал очереди без устаревших записей
+func (qb *QueueBroker) logLocked(queueName string) (*messageLog, error) {
+	if qb.queues[queueName] == nil || queueName == CanaryQueue {
+		return nil, ErrQueueNotFound
+	}
+	cfg := qb.queueConfigLocked(queueName)
+	if !cfg.retains() {
+		qb.dropLogLocked(queueName)
+		return nil, ErrNoRetention
+	}
+	log := qb.logs[queueName]
+	if log == nil {
+		log = &messageLog{release: qb.releaseBodyLocked}
+		qb.logs[queueName] = log
+	}
+	log.trim(cfg, time.Now())
+	return log, nil
+}
+
+// ReadLog возвращает сообщение журнала очереди с номером offset, не извлекая
+// его из очереди. Если такой записи уже нет (удалена по сроку, объему или
+// при уплотнении), выдается ближайшая следующая; если записи offset еще нет,
+// ReadLog ждет ее до timeout. Возвращает ErrNoRetention, если для очереди не задано хранение.
+func (qb *QueueBroker) ReadLog(queueName string, offset uint64, timeout time.Duration) (*LogRecord, error) {
+	deadline := time.Now().Add(qb.waitLimit(timeout))
+	for {
+		qb.mu.Lock()
+		log, err := qb.logLocked(queueName)
+		if err != nil {
+			qb.mu.Unlock()
+			return nil, err
+		}
+		if i := log.find(offset); i >= 0 {
+			e := log.entries[i]
+			msg, err := qb.unpackLocked(e.stored)
+			qb.mu.Unlock()
+			if err != nil {
+				return nil, err
+			}
+			return &LogRecord{Message: msg, Offset: e.offset, EnqueuedAt: e.at}, nil
+		}
+		if log.appended == nil {
+			log.appended = make(chan struct{})
+		}
+		appended := log.appended
+		qb.mu.Unlock()
+
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return nil, ErrTimeout
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-appended:
+			timer.Stop()
+		case <-timer.C:
+			return nil, ErrTimeout
+		}
+	}
+}
+
+// LogOffsetAt возвращает номер первой записи журнала очереди, поставленной
+// не раньше at; если таких еще нет — номер следующей записи
+func (qb *QueueBroker) LogOffsetAt(queueName string, at time.Time) (uint64, error) {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	log, err := qb.logLocked(queueName)
+	if err != nil {
+		return 0, err
+	}
+	return log.offsetAt(at), nil
+}
+
+// offsetAt номер первой записи журнала, поставленной не раньше at
+func (log *messageLog) offsetAt(at time.Time) uint64 {
+	i := sort.Search(len(log.entries), func(i int) bool { return !log.entries[i].at.Before(at) })
+	if i == len(log.entries) {
+		return log.next
+	}
+	return log.entries[i].offset
+}
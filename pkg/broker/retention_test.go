@@ -0,0 +1,156 @@
+package broker
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestReadLog проверяет чтение журнала очереди, в том числе уже выданных
+// сообщений, и ожидание новой записи
+func TestReadLog(t *testing.T) {
+	qb := NewQueueBroker(100, 10, 1)
+	if _, err := qb.ReadLog("jobs", 0, 0); !errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("missing queue: got %v", err)
+	}
+	qb.PutMessage("plain", "x")
+	if _, err := qb.ReadLog("plain", 0, 0); !errors.Is(err, ErrNoRetention) {
+		t.Errorf("queue without retention: got %v", err)
+	}
+
+	qb.SetQueueConfig("jobs", QueueConfig{LockDuration: 30, Retention: 3600})
+	for _, body := range []string{"a", "b", "c"} {
+		qb.PutMessage("jobs", body)
+	}
+	if _, err := qb.GetMessage("jobs", 0); err != nil {
+		t.Fatal(err)
+	}
+	for offset, want := range []string{"a", "b", "c"} {
+		record, err := qb.ReadLog("jobs", uint64(offset), 0)
+		if err != nil || record.Body != want || record.Offset != uint64(offset) {
+			t.Errorf("offset %d: got %+v %v", offset, record, err)
+		}
+	}
+	// Чтение журнала не извлекает сообщения
+	if depth := qb.Depth("jobs"); depth != 2 {
+		t.Errorf("unexpected depth %d", depth)
+	}
+	if _, err := qb.ReadLog("jobs", 3, 20*time.Millisecond); !errors.Is(err, ErrTimeout) {
+		t.Errorf("expected ErrTimeout, got %v", err)
+	}
+
+	done := make(chan *LogRecord)
+	go func() {
+		record, _ := qb.ReadLog("jobs", 3, 5*time.Second)
+		done <- record
+	}()
+	time.Sleep(20 * time.Millisecond)
+	qb.PutMessage("jobs", "d")
+	if record := <-done; record == nil || record.Body != "d" || record.Offset != 3 {
+		t.Errorf("unexpected record %+v", record)
+	}
+
+	start := time.Now()
+	if offset, err := qb.LogOffsetAt("jobs", start); err != nil || offset != 4 {
+		t.Errorf("LogOffsetAt(now): got %d %v", offset, err)
+	}
+	if offset, _ := qb.LogOffsetAt("jobs", start.Add(-time.Hour)); offset != 0 {
+		t.Errorf("LogOffsetAt(past): got %d", offset)
+	}
+}
+
+// TestLogRetention проверяет удаление записей журнала по сроку и объему
+func TestLogRetention(t *testing.T) {
+	qb := NewQueueBroker(100, 10, 1)
+	qb.SetQueueConfig("jobs", QueueConfig{LockDuration: 30, Retention: 60, RetentionBytes: 10})
+	for _, body := range []string{"aaaa", "bbbb", "cccc"} {
+		qb.PutMessage("jobs", body)
+	}
+	// Третья запись не умещается в 10 байт вместе с первыми двумя
+	record, err := qb.ReadLog("jobs", 0, 0)
+	if err != nil || record.Offset != 1 || record.Body != "bbbb" {
+		t.Errorf("got %+v %v", record, err)
+	}
+
+	qb.mu.Lock()
+	qb.logs["jobs"].entries[0].at = time.Now().Add(-2 * time.Minute)
+	qb.mu.Unlock()
+	if record, _ := qb.ReadLog("jobs", 0, 0); record == nil || record.Offset != 2 {
+		t.Errorf("expired record not removed: %+v", record)
+	}
+
+	// Без хранения журнал не ведется
+	qb.SetQueueConfig("jobs", QueueConfig{LockDuration: 30})
+	if _, err := qb.ReadLog("jobs", 0, 0); !errors.Is(err, ErrNoRetention) {
+		t.Errorf("expected ErrNoRetention, got %v", err)
+	}
+	if qb.logs["jobs"] != nil {
+		t.Error("log kept after retention was disabled")
+	}
+}
+
+// TestLogCompaction проверяет, что в журнале остается последняя запись по
+// ключу уплотнения, а записи без ключа не уплотняются
+func TestLogCompaction(t *testing.T) {
+	qb := NewQueueBroker(1000, 10, 1)
+	qb.SetQueueConfig("users", QueueConfig{LockDuration: 30, Retention: 3600, CompactionHeader: "user"})
+	put := func(key, body string) {
+		msg := &Message{Body: body}
+		if key != "" {
+			msg.Headers = map[string]string{"user": key}
+		}
+		if err := qb.Enqueue("users", msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	put("1", "alice")
+	put("2", "bob")
+	put("", "note")
+	put("1", "alice v2")
+	put("1", "alice v3")
+
+	var bodies []string
+	var offsets []uint64
+	for offset := uint64(0); ; {
+		record, err := qb.ReadLog("users", offset, 0)
+		if errors.Is(err, ErrTimeout) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		bodies = append(bodies, record.Body)
+		offsets = append(offsets, record.Offset)
+		offset = record.Offset + 1
+	}
+	if !slices.Equal(bodies, []string{"bob", "note", "alice v3"}) || !slices.Equal(offsets, []uint64{1, 2, 4}) {
+		t.Errorf("unexpected log %q %v", bodies, offsets)
+	}
+	// Уплотняется только журнал, очередь выдает все сообщения
+	if depth := qb.Depth("users"); depth != 5 {
+		t.Errorf("unexpected depth %d", depth)
+	}
+	if offset, _ := qb.LogOffsetAt("users", time.Time{}); offset != 1 {
+		t.Errorf("first record: got %d", offset)
+	}
+	if record, err := qb.ReadLog("users", 3, 0); err != nil || record.Offset != 4 {
+		t.Errorf("compacted offset: got %+v %v", record, err)
+	}
+
+	// Переупаковка журнала, в котором почти все записи вытеснены
+	for i := range 100 {
+		put("2", "bob "+strconv.Itoa(i))
+	}
+	record, err := qb.ReadLog("users", 0, 0)
+	if err != nil || record.Body != "note" {
+		t.Errorf("after repack: got %+v %v", record, err)
+	}
+	qb.mu.Lock()
+	entries := len(qb.logs["users"].entries)
+	qb.mu.Unlock()
+	if entries > 6 {
+		t.Errorf("log is not repacked: %d entries", entries)
+	}
+}
@@ -0,0 +1,152 @@
+package broker
+
+import (
+	"errors"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Заголовки, которые брокер добавляет сообщениям при повторах
+const (
+	// RetryCountHeader сколько раз обработка сообщения уже не удалась
+	RetryCountHeader = "x-retry-count"
+	// DeadLetterSourceHeader очередь, из которой сообщение попало в очередь недоставленных
+	DeadLetterSourceHeader = "x-dead-letter-source"
+	// DeadLetterReasonHeader причина последней неудачи: nack, lock_expired или consumer_lost
+	DeadLetterReasonHeader = "x-dead-letter-reason"
+)
+
+// Причины повторной выдачи сообщения
+const (
+	retryReasonNack    = "nack"
+	retryReasonExpired = "lock_expired"
+	// retryReasonConsumerLost сообщение возвращено из-за пропущенного
+	// сигнала жизни потребителя (см. Heartbeat)
+	retryReasonConsumerLost = "consumer_lost"
+)
+
+// defaultRetryMultiplier во сколько раз растет задержка с каждым повтором по умолчанию
+const defaultRetryMultiplier = 2
+
+// RetryPolicy политика повторов очереди: сообщение, возвращенное
+// потребителем (Abandon) или с истекшей блокировкой peek-lock, выдается
+// снова с экспоненциально растущей задержкой, а после MaxAttempts неудачных
+// выдач переносится в очередь недоставленных сообщений
+type RetryPolicy struct {
+	// MaxAttempts сколько раз сообщение выдается, прежде чем попасть в
+	// очередь недоставленных (0 — повторять без ограничения)
+	MaxAttempts int `json:"max_attempts,omitempty"`
+	// InitialDelayMs задержка перед первым повтором; каждая следующая больше
+	// в Multiplier раз (по умолчанию 2), но не больше MaxDelayMs (если задан)
+	InitialDelayMs int     `json:"initial_delay_ms,omitempty"`
+	MaxDelayMs     int     `json:"max_delay_ms,omitempty"`
+	Multiplier     float64 `json:"multiplier,omitempty"`
+	// DeadLetterQueue очередь недоставленных сообщений (по умолчанию
+	// <очередь>.dlq); для очереди арендатора — имя в его пространстве
+	DeadLetterQueue string `json:"dead_letter_queue,omitempty"`
+}
+
+// Validate проверяет параметры политики
+func (p RetryPolicy) Validate() error {
+	if p.MaxAttempts < 0 || p.InitialDelayMs < 0 || p.MaxDelayMs < 0 {
+		return errors.New("values must not be negative")
+	}
+	if p.Multiplier != 0 && p.Multiplier < 1 {
+		return errors.New("multiplier must be at least 1")
+	}
+	if p.DeadLetterQueue != "" && (IsPattern(p.DeadLetterQueue) || strings.HasPrefix(p.DeadLetterQueue, tenantPrefix)) {
+		return ErrInvalidQueueName
+	}
+	return nil
+}
+
+// Delay задержка перед повтором с номером retry (с 1)
+func (p RetryPolicy) Delay(retry int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier == 0 {
+		multiplier = defaultRetryMultiplier
+	}
+	delay := float64(p.InitialDelayMs) * math.Pow(multiplier, float64(retry-1))
+	if p.MaxDelayMs > 0 && delay > float64(p.MaxDelayMs) {
+		delay = float64(p.MaxDelayMs)
+	}
+	return time.Duration(delay * float64(time.Millisecond))
+}
+
+// deadLetterQueue внутреннее имя очереди недоставленных сообщений очереди queueName
+func (p RetryPolicy) deadLetterQueue(queueName string) string {
+	if p.DeadLetterQueue == "" {
+		return queueName + ".dlq"
+	}
+	if tenantID := TenantOf(queueName); tenantID != "" {
+		return tenantPrefix + tenantID + "." + p.DeadLetterQueue
+	}
+	return p.DeadLetterQueue
+}
+
+// retryLocked возвращает в очередь сообщение, обработка которого не удалась.
+// Без политики повторов сообщение сразу становится доступным. Возвращает
+// функцию уведомления слушателей о переносе в очередь недоставленных,
+// которую нужно вызвать после освобождения qb.mu (или nil).
+func (qb *QueueBroker) retryLocked(queueName string, stored *Message, reason string) func() {
+	// Место гарантировано: сообщение уже учитывается в емкости очереди
+	policy := qb.queueConfigLocked(queueName).Retry
+	if policy == nil {
+		qb.returnLocked(queueName, stored)
+		return nil
+	}
+
+	retries, _ := strconv.Atoi(stored.Headers[RetryCountHeader])
+	retries++
+	if policy.MaxAttempts > 0 && retries >= policy.MaxAttempts {
+		dlq := policy.deadLetterQueue(queueName)
+		headers := make(map[string]string, len(stored.Headers)+3)
+		for name, value := range stored.Headers {
+			headers[name] = value
+		}
+		headers[RetryCountHeader] = strconv.Itoa(retries)
+		headers[DeadLetterSourceHeader] = queueName
+		headers[DeadLetterReasonHeader] = reason
+		msg, err := qb.moveLocked(queueName, stored, func() {}, dlq, headers)
+		if err == nil {
+			listeners := qb.enqueueListeners
+			return func() {
+				for _, listener := range listeners {
+					listener(dlq, msg)
+				}
+				if err := qb.persist(); err != nil {
+					log.Printf("retry: moving message from %s to %s: %v", queueName, dlq, err)
+				}
+			}
+		}
+		// Сообщение не теряется: оно повторяется, пока очередь недоставленных не примет его
+		log.Printf("retry: moving message from %s to %s: %v", queueName, dlq, err)
+	}
+
+	qb.setHeaderLocked(queueName, stored, RetryCountHeader, strconv.Itoa(retries))
+	if delay := policy.Delay(retries); delay > 0 {
+		// Группа остается занятой до повторной выдачи
+		qb.scheduleLocked(queueName, stored, time.Now().Add(delay))
+	} else {
+		qb.returnLocked(queueName, stored)
+	}
+	return nil
+}
+
+// setHeaderLocked задает заголовок хранимого сообщения и учитывает изменение объема.
+// Карта заголовков заменяется копией: прежняя могла быть выдана потребителю.
+func (qb *QueueBroker) setHeaderLocked(queueName string, stored *Message, name, value string) {
+	before := storedSize(stored)
+	headers := make(map[string]string, len(stored.Headers)+1)
+	for k, v := range stored.Headers {
+		headers[k] = v
+	}
+	headers[name] = value
+	stored.Headers = headers
+	delta := storedSize(stored) - before
+	qb.queueBytes[queueName] += delta
+	qb.totalBytes += delta
+}
@@ -0,0 +1,74 @@
+package broker
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestRetryPolicyDelay проверяет рост задержки и ее ограничение
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{InitialDelayMs: 100, MaxDelayMs: 350}
+	for retry, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 350 * time.Millisecond} {
+		if got := p.Delay(retry); got != want {
+			t.Errorf("Delay(%d) = %v, want %v", retry, got, want)
+		}
+	}
+	if err := (RetryPolicy{Multiplier: 0.5}).Validate(); err == nil {
+		t.Error("expected error for multiplier below 1")
+	}
+	if err := (RetryPolicy{DeadLetterQueue: "dlq.*"}).Validate(); !errors.Is(err, ErrInvalidQueueName) {
+		t.Errorf("expected ErrInvalidQueueName, got %v", err)
+	}
+}
+
+// TestRetryAndDeadLetter проверяет повторы с задержкой, перенос в очередь
+// недоставленных и возврат оттуда в исходную очередь
+func TestRetryAndDeadLetter(t *testing.T) {
+	qb := NewQueueBroker(10, 10, 1)
+	qb.SetQueueConfig("jobs", QueueConfig{LockDuration: 30, Retry: &RetryPolicy{MaxAttempts: 3, InitialDelayMs: 30}})
+	qb.Enqueue("jobs", &Message{Body: "poison", Headers: map[string]string{"k": "v"}})
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		delivery, err := qb.PeekLock("jobs", time.Second, time.Minute)
+		if err != nil {
+			t.Fatalf("attempt %d: %v", attempt, err)
+		}
+		if attempt == 2 && delivery.Headers[RetryCountHeader] != "1" {
+			t.Errorf("expected retry count 1, got %+v", delivery.Headers)
+		}
+		if err := qb.Abandon("jobs", delivery.LockToken); err != nil {
+			t.Fatal(err)
+		}
+		// Повтор выдается не сразу
+		if _, err := qb.PeekLock("jobs", 0, time.Minute); !errors.Is(err, ErrTimeout) {
+			t.Fatalf("attempt %d: message redelivered without delay: %v", attempt, err)
+		}
+	}
+
+	// Третья неудача — по истечении блокировки
+	if _, err := qb.PeekLock("jobs", time.Second, 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if qb.Depth("jobs") != 0 || qb.Depth("jobs.dlq") != 1 {
+		t.Fatalf("message not dead-lettered: jobs %d, dlq %d", qb.Depth("jobs"), qb.Depth("jobs.dlq"))
+	}
+	page, _, _ := qb.Browse("jobs.dlq", 0, 1)
+	headers := page[0].Headers
+	if headers[RetryCountHeader] != "3" || headers[DeadLetterSourceHeader] != "jobs" || headers[DeadLetterReasonHeader] != "lock_expired" || headers["k"] != "v" {
+		t.Errorf("unexpected dead letter headers: %+v", headers)
+	}
+
+	// Возврат без указания очереди идет в исходную очередь со сброшенным счетчиком
+	if err := qb.RequeueMessage("jobs.dlq", page[0].ID, ""); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := qb.Dequeue("jobs", 0)
+	if err != nil || msg.Headers[RetryCountHeader] != "" || msg.Headers[DeadLetterSourceHeader] != "" || msg.Headers["k"] != "v" {
+		t.Errorf("unexpected requeued message: %+v %v", msg, err)
+	}
+	if qb.QueueBytes("jobs") != 0 || qb.TotalBytes() != 0 {
+		t.Errorf("byte accounting drifted: queue %d, total %d", qb.QueueBytes("jobs"), qb.TotalBytes())
+	}
+}
@@ -0,0 +1,276 @@
+package broker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// RoutingRule правило маршрутизации, проверяемое при постановке сообщения
+// в очередь Queue ("*" или пусто — любая очередь).
+//
+// Правило без Copy и Move — скрипт, который должен вернуть имя очереди
+// назначения; null или пустая строка означают, что правило не сработало
+// и проверяется следующее. Правило с Copy или Move — привязка: если сообщение
+// подходит под все заданные условия (Headers, JSONPath и Script как условие),
+// оно ставится в очередь Move вместо исходной и/или копируется в очереди Copy.
+type RoutingRule struct {
+	Queue  string `json:"queue"`
+	Script string `json:"script,omitempty"`
+	// Headers условие: заголовки сообщения имеют указанные значения
+	Headers map[string]string `json:"headers,omitempty"`
+	// JSONPath условие: тело — JSON, и значения по путям вида
+	// $.customer.tier или $.items[0].sku равны указанным
+	JSONPath map[string]any `json:"jsonpath,omitempty"`
+	// Copy очереди, в которые ставятся копии сообщения
+	Copy []string `json:"copy,omitempty"`
+	// Move очередь, в которую сообщение ставится вместо исходной
+	Move string `json:"move,omitempty"`
+
+	compiled *script
+	paths    map[string][]any
+}
+
+// binding правило задает очереди назначения, а не вычисляет их скриптом
+func (rule *RoutingRule) binding() bool {
+	return rule.Move != "" || len(rule.Copy) > 0
+}
+
+// Router выбирает очередь назначения по содержимому сообщения
+type Router struct {
+	rules []*RoutingRule
+}
+
+// NewRouter компилирует правила маршрутизации
+func NewRouter(rules []*RoutingRule) (*Router, error) {
+	for _, rule := range rules {
+		if !rule.binding() {
+			if rule.Script == "" {
+				return nil, errors.New("routing rule without script, move or copy")
+			}
+			if len(rule.Headers) > 0 || len(rule.JSONPath) > 0 {
+				return nil, errors.New("routing rule with headers or jsonpath needs move or copy")
+			}
+		}
+		if IsPattern(rule.Move) {
+			return nil, fmt.Errorf("invalid routing destination %q", rule.Move)
+		}
+		for _, dest := range rule.Copy {
+			if dest == "" || IsPattern(dest) {
+				return nil, fmt.Errorf("invalid routing destination %q", dest)
+			}
+		}
+		if rule.Script != "" {
+			compiled, err := compileScript(rule.Script)
+			if err != nil {
+				return nil, err
+			}
+			rule.compiled = compiled
+		}
+		rule.paths = make(map[string][]any, len(rule.JSONPath))
+		for path := range rule.JSONPath {
+			segments, err := parseJSONPath(path)
+			if err != nil {
+				return nil, err
+			}
+			rule.paths[path] = segments
+		}
+	}
+	return &Router{rules: rules}, nil
+}
+
+// LoadRouter читает правила маршрутизации из JSON-файла вида
+// [{"queue": "orders", "script": "payload.total > 1000 ? \"orders-vip\" : null"}]
+func LoadRouter(path string) (*Router, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []*RoutingRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("parse routing rules %s: %w", path, err)
+	}
+	return NewRouter(rules)
+}
+
+// Route возвращает очередь назначения для сообщения, отправленного в queueName.
+// Если ни одно правило не сработало, возвращается исходная очередь.
+func (rt *Router) Route(queueName string, msg *Message) (string, error) {
+	dest, _, err := rt.Routes(queueName, msg)
+	return dest, err
+}
+
+// Routes возвращает очередь назначения и очереди, в которые ставятся копии
+// сообщения. Назначение выбирает первое сработавшее правило со скриптом
+// или Move; правила Copy проверяются все, в том числе после выбора назначения.
+func (rt *Router) Routes(queueName string, msg *Message) (dest string, copies []string, err error) {
+	if rt == nil || len(rt.rules) == 0 {
+		return queueName, nil, nil
+	}
+
+	vars := scriptVars(queueName, msg)
+	for _, rule := range rt.rules {
+		if rule.Queue != "" && rule.Queue != "*" && rule.Queue != queueName {
+			continue
+		}
+		if dest != "" && len(rule.Copy) == 0 {
+			continue
+		}
+		if !rule.binding() {
+			result, err := rule.compiled.Eval(vars)
+			if err != nil {
+				return "", nil, fmt.Errorf("routing failed: %w", err)
+			}
+			switch routed := result.(type) {
+			case nil:
+			case string:
+				dest = routed
+			default:
+				return "", nil, fmt.Errorf("routing failed: script %q returned %s, want string", rule.Script, typeName(result))
+			}
+			continue
+		}
+
+		matched, err := rule.matches(vars)
+		if err != nil {
+			return "", nil, err
+		}
+		if !matched {
+			continue
+		}
+		if dest == "" {
+			dest = rule.Move
+		}
+		copies = append(copies, rule.Copy...)
+	}
+	if dest == "" {
+		dest = queueName
+	}
+	return dest, uniqueCopies(dest, copies), nil
+}
+
+// matches проверяет условия правила-привязки
+func (rule *RoutingRule) matches(vars map[string]any) (bool, error) {
+	headers := vars["headers"].(map[string]any)
+	for name, want := range rule.Headers {
+		if got, ok := headers[name]; !ok || got != want {
+			return false, nil
+		}
+	}
+	for path, want := range rule.JSONPath {
+		got, ok := lookupJSONPath(vars["payload"], rule.paths[path])
+		if !ok || !reflect.DeepEqual(got, want) {
+			return false, nil
+		}
+	}
+	if rule.compiled == nil {
+		return true, nil
+	}
+	result, err := rule.compiled.Eval(vars)
+	if err != nil {
+		return false, fmt.Errorf("routing failed: %w", err)
+	}
+	return truthy(result), nil
+}
+
+// uniqueCopies убирает повторы и очередь назначения из списка копий
+func uniqueCopies(dest string, copies []string) []string {
+	var unique []string
+	seen := map[string]bool{dest: true}
+	for _, queue := range copies {
+		if !seen[queue] {
+			seen[queue] = true
+			unique = append(unique, queue)
+		}
+	}
+	return unique
+}
+
+// parseJSONPath разбирает путь вида $.a.b[0]['c d'] в последовательность
+// имен полей и индексов
+func parseJSONPath(path string) ([]any, error) {
+	rest, ok := strings.CutPrefix(path, "$")
+	if !ok {
+		return nil, fmt.Errorf("invalid jsonpath %q: must start with $", path)
+	}
+	var segments []any
+	for rest != "" {
+		switch {
+		case rest[0] == '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("invalid jsonpath %q", path)
+			}
+			segments = append(segments, rest[1:end+1])
+			rest = rest[end+1:]
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid jsonpath %q: unclosed [", path)
+			}
+			inner := rest[1:end]
+			if n, err := strconv.Atoi(inner); err == nil && n >= 0 {
+				segments = append(segments, n)
+			} else if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				segments = append(segments, inner[1:len(inner)-1])
+			} else {
+				return nil, fmt.Errorf("invalid jsonpath %q: bad index %q", path, inner)
+			}
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("invalid jsonpath %q", path)
+		}
+	}
+	return segments, nil
+}
+
+// lookupJSONPath возвращает значение по разобранному пути; false — пути нет
+func lookupJSONPath(value any, segments []any) (any, bool) {
+	for _, segment := range segments {
+		switch key := segment.(type) {
+		case string:
+			object, ok := value.(map[string]any)
+			if !ok {
+				return nil, false
+			}
+			if value, ok = object[key]; !ok {
+				return nil, false
+			}
+		case int:
+			list, ok := value.([]any)
+			if !ok || key >= len(list) {
+				return nil, false
+			}
+			value = list[key]
+		}
+	}
+	return value, true
+}
+
+// scriptVars формирует окружение скрипта: queue, body, payload (разобранный
+// JSON, если тело им является) и headers
+func scriptVars(queueName string, msg *Message) map[string]any {
+	headers := make(map[string]any, len(msg.Headers))
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+
+	var payload any
+	if err := json.Unmarshal([]byte(msg.Body), &payload); err != nil {
+		payload = nil
+	}
+
+	return map[string]any{
+		"queue":   queueName,
+		"body":    msg.Body,
+		"payload": payload,
+		"headers": headers,
+	}
+}
@@ -0,0 +1,140 @@
+package broker
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestRoutingRules проверяет выбор очереди назначения скриптом при постановке в очередь
+func TestRoutingRules(t *testing.T) {
+	qb := NewQueueBroker(100, 10, 10)
+	router, err := NewRouter([]*RoutingRule{
+		{Queue: "orders", Script: `payload.total > 1000 ? "orders-vip" : null`},
+		{Script: `headers.region == "eu" ? queue + "-eu" : null`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	qb.SetRouter(router)
+
+	qb.Enqueue("orders", &Message{Body: `{"total": 5000}`})
+	qb.Enqueue("orders", &Message{Body: `{"total": 5}`})
+	qb.Enqueue("events", &Message{Body: "ping", Headers: map[string]string{"region": "eu"}})
+
+	for queue, want := range map[string]string{"orders-vip": `{"total": 5000}`, "orders": `{"total": 5}`, "events-eu": "ping"} {
+		message, err := qb.GetMessage(queue, time.Second)
+		if err != nil || message != want {
+			t.Errorf("queue %s: got %q (%v) want %q", queue, message, err, want)
+		}
+	}
+}
+
+// TestRoutingScriptError проверяет отказ в постановке при ошибке скрипта
+func TestRoutingScriptError(t *testing.T) {
+	qb := NewQueueBroker(100, 10, 10)
+	router, err := NewRouter([]*RoutingRule{{Script: `payload.total > 1 ? 42 : null`}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	qb.SetRouter(router)
+
+	if err := qb.Enqueue("orders", &Message{Body: `{"total": 5}`}); err == nil {
+		t.Errorf("expected an error for a script returning a number")
+	}
+}
+
+// TestRoutingBindings проверяет копирование и перенос сообщений правилами
+// с условиями по заголовкам, JSONPath и скрипту
+func TestRoutingBindings(t *testing.T) {
+	qb := NewQueueBroker(100, 10, 10)
+	router, err := NewRouter([]*RoutingRule{
+		{Queue: "orders", Headers: map[string]string{"type": "order.created"}, Copy: []string{"audit", "analytics"}},
+		{Queue: "orders", JSONPath: map[string]any{"$.customer.tier": "gold", "$.items[0].qty": 1.0}, Move: "orders-vip"},
+		{Queue: "orders", Script: `payload.total > 1000`, Move: "orders-large", Copy: []string{"audit"}},
+		{Queue: "orders", Script: `payload.total < 0 ? "never" : null`},
+		{Queue: "*", Copy: []string{"all"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	qb.SetRouter(router)
+
+	vip := `{"customer": {"tier": "gold"}, "items": [{"qty": 1}], "total": 5000}`
+	qb.Enqueue("orders", &Message{Body: vip, Headers: map[string]string{"type": "order.created"}})
+	qb.Enqueue("orders", &Message{Body: `{"total": 5}`})
+
+	for queue, want := range map[string][]string{
+		"orders-vip":   {vip},
+		"orders-large": nil,
+		"orders":       {`{"total": 5}`},
+		"audit":        {vip},
+		"analytics":    {vip},
+		"all":          {vip, `{"total": 5}`},
+		"never":        nil,
+	} {
+		if qb.Depth(queue) != len(want) {
+			t.Errorf("queue %s: expected %d messages, got %d", queue, len(want), qb.Depth(queue))
+			continue
+		}
+		for _, body := range want {
+			if msg, err := qb.Dequeue(queue, 0); err != nil || msg.Body != body {
+				t.Errorf("queue %s: got %+v (%v) want %q", queue, msg, err, body)
+			}
+		}
+	}
+	if msg, err := qb.Dequeue("orders", 0); err == nil {
+		t.Errorf("unexpected extra message: %+v", msg)
+	}
+}
+
+// TestRoutingCopyTenant проверяет запрет копирования в очереди другого
+// арендатора и разбор ошибочных правил
+func TestRoutingCopyTenant(t *testing.T) {
+	qb := NewQueueBroker(100, 10, 10)
+	router, _ := NewRouter([]*RoutingRule{{Copy: []string{"@other.audit"}}})
+	qb.SetRouter(router)
+	if err := qb.Enqueue("@acme.orders", &Message{Body: "x"}); !errors.Is(err, ErrCrossTenant) {
+		t.Errorf("expected ErrCrossTenant, got %v", err)
+	}
+
+	for _, rule := range []*RoutingRule{
+		{},
+		{Headers: map[string]string{"a": "b"}},
+		{Copy: []string{"audit.*"}},
+		{Copy: []string{""}},
+		{Move: "x", JSONPath: map[string]any{"customer": "gold"}},
+		{Move: "x", JSONPath: map[string]any{"$.items[": 1}},
+		{Move: "x", JSONPath: map[string]any{"$.items[a]": 1}},
+	} {
+		if _, err := NewRouter([]*RoutingRule{rule}); err == nil {
+			t.Errorf("expected error for rule %+v", rule)
+		}
+	}
+}
+
+// TestJSONPath проверяет разбор путей и поиск значений
+func TestJSONPath(t *testing.T) {
+	var payload any
+	json.Unmarshal([]byte(`{"a": {"b c": [10, {"d": true}]}}`), &payload)
+	for path, want := range map[string]any{
+		"$":               payload,
+		"$.a['b c'][0]":   10.0,
+		`$.a["b c"][1].d`: true,
+	} {
+		segments, err := parseJSONPath(path)
+		if err != nil {
+			t.Errorf("%s: %v", path, err)
+			continue
+		}
+		if got, ok := lookupJSONPath(payload, segments); !ok || !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v %v", path, got, ok)
+		}
+	}
+	segments, _ := parseJSONPath("$.a.missing")
+	if _, ok := lookupJSONPath(payload, segments); ok {
+		t.Error("expected missing path")
+	}
+}
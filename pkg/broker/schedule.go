@@ -0,0 +1,224 @@
+package broker
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Schedule расписание периодической постановки сообщения в очередь
+// по выражению cron (вместо отдельного cron, отправляющего задания по HTTP)
+type Schedule struct {
+	// ID идентификатор расписания; пустой при создании — генерируется
+	ID string `json:"id"`
+	// Cron выражение из пяти полей (минута, час, день месяца, месяц,
+	// день недели) или сокращение @hourly, @daily, @weekly, @monthly, @yearly
+	Cron string `json:"cron"`
+	// Timezone часовой пояс IANA, в котором вычисляется расписание, по умолчанию UTC
+	Timezone string `json:"timezone,omitempty"`
+	Queue    string `json:"queue"`
+	// Message шаблон тела сообщения в синтаксисе text/template: доступны
+	// .Time (время срабатывания), .Schedule (идентификатор) и .Queue
+	Message     string            `json:"message"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	ContentType string            `json:"content_type,omitempty"`
+
+	// Next время следующего срабатывания; заполняется брокером
+	Next time.Time `json:"next,omitzero"`
+	// LastRun время последнего срабатывания
+	LastRun *time.Time `json:"last_run,omitempty"`
+	// LastError ошибка постановки при последнем срабатывании
+	LastError string `json:"last_error,omitempty"`
+}
+
+// ScheduleData данные, доступные шаблону сообщения расписания
+type ScheduleData struct {
+	Time     time.Time
+	Schedule string
+	Queue    string
+}
+
+// scheduleEntry зарегистрированное расписание с разобранным выражением
+// и таймером следующего срабатывания
+type scheduleEntry struct {
+	Schedule
+	spec  *cronSpec
+	loc   *time.Location
+	tmpl  *template.Template
+	timer *time.Timer
+}
+
+// compileSchedule проверяет расписание и разбирает выражение и шаблон
+func compileSchedule(s Schedule) (*scheduleEntry, error) {
+	switch {
+	case s.Queue == "":
+		return nil, errors.New("schedule queue is required")
+	case IsPattern(s.Queue):
+		return nil, ErrInvalidQueueName
+	case s.Message == "":
+		return nil, errors.New("schedule message is required")
+	case strings.Contains(s.ID, "/"):
+		return nil, fmt.Errorf("invalid schedule id %q", s.ID)
+	}
+	spec, err := parseCron(s.Cron)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := loadLocation(s.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q", s.Timezone)
+	}
+	tmpl, err := template.New(s.ID).Option("missingkey=error").Parse(s.Message)
+	if err != nil {
+		return nil, fmt.Errorf("invalid message template: %w", err)
+	}
+	return &scheduleEntry{Schedule: s, spec: spec, loc: loc, tmpl: tmpl}, nil
+}
+
+func (e *scheduleEntry) stop() {
+	if e.timer != nil {
+		e.timer.Stop()
+	}
+}
+
+// SetSchedule добавляет расписание или заменяет расписание с тем же ID
+// и возвращает его с временем следующего срабатывания; created — расписания
+// с таким ID не было
+func (qb *QueueBroker) SetSchedule(s Schedule) (saved Schedule, created bool, err error) {
+	if s.ID == "" {
+		s.ID = newToken()
+	}
+	s.Next, s.LastRun, s.LastError = time.Time{}, nil, ""
+	entry, err := compileSchedule(s)
+	if err != nil {
+		return Schedule{}, false, err
+	}
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	old := qb.schedules[s.ID]
+	if old != nil {
+		old.stop()
+	}
+	qb.armScheduleLocked(entry, time.Now())
+	return entry.Schedule, old == nil, nil
+}
+
+// DeleteSchedule удаляет расписание; false, если его не было
+func (qb *QueueBroker) DeleteSchedule(id string) bool {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	entry := qb.schedules[id]
+	if entry == nil {
+		return false
+	}
+	entry.stop()
+	delete(qb.schedules, id)
+	return true
+}
+
+// GetSchedule возвращает расписание по ID
+func (qb *QueueBroker) GetSchedule(id string) (Schedule, bool) {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	entry := qb.schedules[id]
+	if entry == nil {
+		return Schedule{}, false
+	}
+	return entry.Schedule, true
+}
+
+// Schedules возвращает все расписания, упорядоченные по ID
+func (qb *QueueBroker) Schedules() []Schedule {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	return qb.schedulesLocked()
+}
+
+func (qb *QueueBroker) schedulesLocked() []Schedule {
+	list := make([]Schedule, 0, len(qb.schedules))
+	for _, entry := range qb.schedules {
+		list = append(list, entry.Schedule)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// armScheduleLocked регистрирует расписание и заводит таймер до срабатывания
+// после now; у выражения без будущих срабатываний таймер не заводится
+func (qb *QueueBroker) armScheduleLocked(entry *scheduleEntry, now time.Time) {
+	qb.schedules[entry.ID] = entry
+	entry.Next = entry.spec.next(now.In(entry.loc))
+	if entry.Next.IsZero() {
+		entry.timer = nil
+		return
+	}
+	entry.timer = time.AfterFunc(time.Until(entry.Next), func() { qb.fireSchedule(entry) })
+}
+
+// fireSchedule ставит сообщение расписания в очередь и заводит таймер до
+// следующего срабатывания. Сообщение ставится как обычное, с маршрутизацией
+// и репликацией; если в очереди нет места, срабатывание пропускается.
+func (qb *QueueBroker) fireSchedule(entry *scheduleEntry) {
+	qb.mu.Lock()
+	if qb.schedules[entry.ID] != entry {
+		qb.mu.Unlock()
+		return
+	}
+	at := entry.Next
+	var body strings.Builder
+	err := entry.tmpl.Execute(&body, ScheduleData{Time: at, Schedule: entry.ID, Queue: entry.Queue})
+	headers := make(map[string]string, len(entry.Headers))
+	for k, v := range entry.Headers {
+		headers[k] = v
+	}
+	qb.mu.Unlock()
+
+	if err == nil {
+		err = qb.Enqueue(entry.Queue, &Message{Body: body.String(), Headers: headers, ContentType: entry.ContentType})
+	}
+
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	if qb.schedules[entry.ID] != entry {
+		return
+	}
+	next := *entry
+	next.LastRun, next.LastError = &at, ""
+	if err != nil {
+		next.LastError = err.Error()
+	}
+	// Следующее срабатывание — строго после запланированного, даже если
+	// часы системы отстают от таймера
+	now := time.Now()
+	if now.Before(at) {
+		now = at
+	}
+	qb.armScheduleLocked(&next, now)
+}
+
+// restoreSchedulesLocked добавляет расписания из снимка, заменяя расписания
+// с теми же ID; пропущенные за время простоя срабатывания не выполняются
+func (qb *QueueBroker) restoreSchedulesLocked(schedules []Schedule) error {
+	entries := make([]*scheduleEntry, len(schedules))
+	for i, s := range schedules {
+		if s.ID == "" {
+			return errors.New("restore schedule: schedule without id")
+		}
+		entry, err := compileSchedule(s)
+		if err != nil {
+			return fmt.Errorf("restore schedule %s: %w", s.ID, err)
+		}
+		entries[i] = entry
+	}
+	now := time.Now()
+	for _, entry := range entries {
+		if old := qb.schedules[entry.ID]; old != nil {
+			old.stop()
+		}
+		qb.armScheduleLocked(entry, now)
+	}
+	return nil
+}
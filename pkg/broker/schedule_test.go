@@ -0,0 +1,93 @@
+package broker
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSchedule проверяет регистрацию расписания, постановку сообщения
+// по шаблону и замену, удаление и ошибки расписаний
+func TestSchedule(t *testing.T) {
+	qb := NewQueueBroker(100, 10, 10)
+	saved, created, err := qb.SetSchedule(Schedule{
+		Cron:    "*/5 * * * *",
+		Queue:   "heartbeats",
+		Message: `{"schedule": "{{.Schedule}}", "at": "{{.Time.Format "15:04"}}"}`,
+		Headers: map[string]string{"source": "cron"},
+	})
+	if err != nil || !created || saved.ID == "" {
+		t.Fatalf("unexpected result: %+v %v %v", saved, created, err)
+	}
+	if saved.Next.Minute()%5 != 0 || !saved.Next.After(time.Now()) || saved.Next.Sub(time.Now()) > 5*time.Minute {
+		t.Errorf("unexpected next run: %v", saved.Next)
+	}
+
+	qb.mu.Lock()
+	entry := qb.schedules[saved.ID]
+	qb.mu.Unlock()
+	qb.fireSchedule(entry)
+	msg, err := qb.Dequeue("heartbeats", 0)
+	want := `{"schedule": "` + saved.ID + `", "at": "` + saved.Next.Format("15:04") + `"}`
+	if err != nil || msg.Body != want || msg.Headers["source"] != "cron" {
+		t.Errorf("unexpected message: %+v %v", msg, err)
+	}
+	got, ok := qb.GetSchedule(saved.ID)
+	if !ok || got.LastRun == nil || !got.LastRun.Equal(saved.Next) || !got.Next.After(saved.Next) || got.LastError != "" {
+		t.Errorf("unexpected schedule after run: %+v", got)
+	}
+
+	// Замененное расписание больше не срабатывает по прежнему таймеру
+	if _, created, err := qb.SetSchedule(Schedule{ID: saved.ID, Cron: "@daily", Queue: "heartbeats", Message: "tick"}); err != nil || created {
+		t.Errorf("unexpected replace result: %v %v", created, err)
+	}
+	qb.fireSchedule(entry)
+	if qb.Depth("heartbeats") != 0 {
+		t.Error("replaced schedule must not fire")
+	}
+	if list := qb.Schedules(); len(list) != 1 || list[0].Cron != "@daily" {
+		t.Errorf("unexpected schedules: %+v", list)
+	}
+	if !qb.DeleteSchedule(saved.ID) || qb.DeleteSchedule(saved.ID) || len(qb.Schedules()) != 0 {
+		t.Error("unexpected delete result")
+	}
+
+	for _, s := range []Schedule{
+		{Cron: "* * *", Queue: "q", Message: "m"},
+		{Cron: "@daily", Queue: "q.*", Message: "m"},
+		{Cron: "@daily", Queue: "q"},
+		{Cron: "@daily", Queue: "q", Message: "{{.Missing"},
+		{Cron: "@daily", Queue: "q", Message: "m", Timezone: "Mars/Olympus"},
+		{ID: "a/b", Cron: "@daily", Queue: "q", Message: "m"},
+	} {
+		if _, _, err := qb.SetSchedule(s); err == nil {
+			t.Errorf("expected error for %+v", s)
+		}
+	}
+}
+
+// TestScheduleSnapshot проверяет сохранение расписаний в снимке
+// и их восстановление с новым временем срабатывания
+func TestScheduleSnapshot(t *testing.T) {
+	qb := NewQueueBroker(100, 10, 10)
+	qb.SetSchedule(Schedule{ID: "nightly", Cron: "0 3 * * *", Timezone: "Europe/Moscow", Queue: "reports", Message: "build"})
+	data, err := EncodeSnapshot(qb.Snapshot())
+	if err != nil || !strings.Contains(string(data), `"id":"nightly"`) {
+		t.Fatalf("unexpected snapshot: %s %v", data, err)
+	}
+	snap, err := DecodeSnapshot(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored := NewQueueBroker(100, 10, 10)
+	if err := restored.Restore(snap); err != nil {
+		t.Fatal(err)
+	}
+	s, ok := restored.GetSchedule("nightly")
+	if !ok || s.Queue != "reports" || s.Next.In(time.UTC).Hour() != 0 || s.Next.Minute() != 0 {
+		t.Errorf("unexpected restored schedule: %+v", s)
+	}
+	restored.DeleteSchedule("nightly")
+	qb.DeleteSchedule("nightly")
+}
@@ -0,0 +1,403 @@
+package broker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema JSON Schema тела сообщений очереди. Поддерживается подмножество
+// ключевых слов: type, enum, const, properties, required,
+// additionalProperties, items, minItems, maxItems, minLength, maxLength,
+// pattern, minimum, maximum, exclusiveMinimum, exclusiveMaximum. Прочие
+// ключевые слова (кроме ссылок $ref, которые отклоняются) не проверяются.
+type Schema struct {
+	// source исходный текст схемы, возвращаемый через API и сохраняемый в снимках
+	source json.RawMessage
+	root   *schemaNode
+}
+
+type schemaNode struct {
+	types      []string
+	enum       []any
+	constValue any
+	hasConst   bool
+
+	properties           map[string]*schemaNode
+	required             []string
+	additionalProperties *schemaNode
+	noAdditional         bool
+
+	items    *schemaNode
+	minItems *int
+	maxItems *int
+
+	minLength *int
+	maxLength *int
+	pattern   *regexp.Regexp
+
+	minimum          *float64
+	maximum          *float64
+	exclusiveMinimum *float64
+	exclusiveMaximum *float64
+}
+
+// SchemaError сообщение не соответствует схеме очереди
+type SchemaError struct {
+	Queue string
+	// Violations нарушения в виде "<JSON Pointer>: <описание>"
+	Violations []string
+}
+
+func (e *SchemaError) Error() string {
+	return ErrSchemaViolation.Error() + ": " + strings.Join(e.Violations, "; ")
+}
+
+func (e *SchemaError) Unwrap() error {
+	return ErrSchemaViolation
+}
+
+// ParseSchema разбирает JSON Schema
+func ParseSchema(data []byte) (*Schema, error) {
+	var raw any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	root, err := parseSchemaNode(raw, "")
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	var compact bytes.Buffer
+	json.Compact(&compact, data)
+	return &Schema{source: compact.Bytes(), root: root}, nil
+}
+
+// MarshalJSON возвращает исходный текст схемы
+func (s *Schema) MarshalJSON() ([]byte, error) {
+	return s.source, nil
+}
+
+// UnmarshalJSON разбирает схему, например, при загрузке снимка
+func (s *Schema) UnmarshalJSON(data []byte) error {
+	parsed, err := ParseSchema(data)
+	if err != nil {
+		return err
+	}
+	*s = *parsed
+	return nil
+}
+
+func parseSchemaNode(raw any, path string) (*schemaNode, error) {
+	if b, ok := raw.(bool); ok {
+		// true допускает любое значение, false — никакое
+		if b {
+			return &schemaNode{}, nil
+		}
+		return &schemaNode{enum: []any{}}, nil
+	}
+	obj, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: schema must be an object or a boolean", pathOrRoot(path))
+	}
+	if _, ok := obj["$ref"]; ok {
+		return nil, fmt.Errorf("%s: $ref is not supported", pathOrRoot(path))
+	}
+
+	node := &schemaNode{}
+	switch t := obj["type"].(type) {
+	case nil:
+	case string:
+		node.types = []string{t}
+	case []any:
+		for _, v := range t {
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: invalid type", pathOrRoot(path))
+			}
+			node.types = append(node.types, s)
+		}
+	default:
+		return nil, fmt.Errorf("%s: invalid type", pathOrRoot(path))
+	}
+	for _, t := range node.types {
+		switch t {
+		case "null", "boolean", "object", "array", "number", "integer", "string":
+		default:
+			return nil, fmt.Errorf("%s: unknown type %q", pathOrRoot(path), t)
+		}
+	}
+
+	if enum, ok := obj["enum"]; ok {
+		values, ok := enum.([]any)
+		if !ok {
+			return nil, fmt.Errorf("%s: enum must be an array", pathOrRoot(path))
+		}
+		node.enum = values
+	}
+	if c, ok := obj["const"]; ok {
+		node.constValue, node.hasConst = c, true
+	}
+
+	if props, ok := obj["properties"]; ok {
+		propsObj, ok := props.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%s: properties must be an object", pathOrRoot(path))
+		}
+		node.properties = make(map[string]*schemaNode, len(propsObj))
+		for name, sub := range propsObj {
+			child, err := parseSchemaNode(sub, path+"/properties/"+name)
+			if err != nil {
+				return nil, err
+			}
+			node.properties[name] = child
+		}
+	}
+	if req, ok := obj["required"]; ok {
+		names, ok := req.([]any)
+		if !ok {
+			return nil, fmt.Errorf("%s: required must be an array", pathOrRoot(path))
+		}
+		for _, v := range names {
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: required must contain strings", pathOrRoot(path))
+			}
+			node.required = append(node.required, s)
+		}
+	}
+	switch additional := obj["additionalProperties"].(type) {
+	case nil:
+	case bool:
+		node.noAdditional = !additional
+	default:
+		child, err := parseSchemaNode(additional, path+"/additionalProperties")
+		if err != nil {
+			return nil, err
+		}
+		node.additionalProperties = child
+	}
+	if items, ok := obj["items"]; ok {
+		child, err := parseSchemaNode(items, path+"/items")
+		if err != nil {
+			return nil, err
+		}
+		node.items = child
+	}
+
+	var err error
+	ints := map[string]**int{"minItems": &node.minItems, "maxItems": &node.maxItems, "minLength": &node.minLength, "maxLength": &node.maxLength}
+	for keyword, dst := range ints {
+		if *dst, err = intKeyword(obj, keyword, path); err != nil {
+			return nil, err
+		}
+	}
+	numbers := map[string]**float64{"minimum": &node.minimum, "maximum": &node.maximum, "exclusiveMinimum": &node.exclusiveMinimum, "exclusiveMaximum": &node.exclusiveMaximum}
+	for keyword, dst := range numbers {
+		if v, ok := obj[keyword]; ok {
+			f, ok := v.(float64)
+			if !ok {
+				return nil, fmt.Errorf("%s: %s must be a number", pathOrRoot(path), keyword)
+			}
+			*dst = &f
+		}
+	}
+	if p, ok := obj["pattern"]; ok {
+		s, ok := p.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: pattern must be a string", pathOrRoot(path))
+		}
+		if node.pattern, err = regexp.Compile(s); err != nil {
+			return nil, fmt.Errorf("%s: invalid pattern: %w", pathOrRoot(path), err)
+		}
+	}
+	return node, nil
+}
+
+func intKeyword(obj map[string]any, keyword, path string) (*int, error) {
+	v, ok := obj[keyword]
+	if !ok {
+		return nil, nil
+	}
+	f, ok := v.(float64)
+	if !ok || f < 0 || f != math.Trunc(f) {
+		return nil, fmt.Errorf("%s: %s must be a non-negative integer", pathOrRoot(path), keyword)
+	}
+	n := int(f)
+	return &n, nil
+}
+
+func pathOrRoot(path string) string {
+	if path == "" {
+		return "/"
+	}
+	return path
+}
+
+// Validate проверяет тело сообщения и возвращает найденные нарушения
+func (s *Schema) Validate(body string) []string {
+	var value any
+	if err := json.Unmarshal([]byte(body), &value); err != nil {
+		return []string{"/: body is not valid JSON"}
+	}
+	var violations []string
+	s.root.validate(value, "", &violations)
+	return violations
+}
+
+func (n *schemaNode) validate(value any, path string, violations *[]string) {
+	report := func(format string, args ...any) {
+		*violations = append(*violations, pathOrRoot(path)+": "+fmt.Sprintf(format, args...))
+	}
+
+	if len(n.types) > 0 && !n.matchesType(value) {
+		report("expected %s, got %s", strings.Join(n.types, " or "), jsonType(value))
+		return
+	}
+	if n.enum != nil && !inEnum(n.enum, value) {
+		report("value is not one of the allowed values")
+	}
+	if n.hasConst && !equalValues(n.constValue, value) {
+		report("value does not match const")
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		for _, name := range n.required {
+			if _, ok := v[name]; !ok {
+				report("missing required property %q", name)
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			childPath := path + "/" + escapePointer(name)
+			if child, ok := n.properties[name]; ok {
+				child.validate(v[name], childPath, violations)
+			} else if n.noAdditional {
+				report("unexpected property %q", name)
+			} else if n.additionalProperties != nil {
+				n.additionalProperties.validate(v[name], childPath, violations)
+			}
+		}
+	case []any:
+		if n.minItems != nil && len(v) < *n.minItems {
+			report("expected at least %d items", *n.minItems)
+		}
+		if n.maxItems != nil && len(v) > *n.maxItems {
+			report("expected at most %d items", *n.maxItems)
+		}
+		if n.items != nil {
+			for i, item := range v {
+				n.items.validate(item, fmt.Sprintf("%s/%d", path, i), violations)
+			}
+		}
+	case string:
+		length := utf8.RuneCountInString(v)
+		if n.minLength != nil && length < *n.minLength {
+			report("expected at least %d characters", *n.minLength)
+		}
+		if n.maxLength != nil && length > *n.maxLength {
+			report("expected at most %d characters", *n.maxLength)
+		}
+		if n.pattern != nil && !n.pattern.MatchString(v) {
+			report("does not match pattern %q", n.pattern.String())
+		}
+	case float64:
+		if n.minimum != nil && v < *n.minimum {
+			report("must be >= %v", *n.minimum)
+		}
+		if n.maximum != nil && v > *n.maximum {
+			report("must be <= %v", *n.maximum)
+		}
+		if n.exclusiveMinimum != nil && v <= *n.exclusiveMinimum {
+			report("must be > %v", *n.exclusiveMinimum)
+		}
+		if n.exclusiveMaximum != nil && v >= *n.exclusiveMaximum {
+			report("must be < %v", *n.exclusiveMaximum)
+		}
+	}
+}
+
+func (n *schemaNode) matchesType(value any) bool {
+	actual := jsonType(value)
+	for _, t := range n.types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonType(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	}
+	return "unknown"
+}
+
+func inEnum(values []any, value any) bool {
+	for _, v := range values {
+		if equalValues(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func escapePointer(name string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(name, "~", "~0"), "/", "~1")
+}
+
+// SetQueueSchema задает схему тел сообщений очереди; nil снимает проверку.
+// Сообщения, уже находящиеся в очереди, не проверяются.
+func (qb *QueueBroker) SetQueueSchema(queueName string, schema *Schema) {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	if schema == nil {
+		delete(qb.schemas, queueName)
+		return
+	}
+	qb.schemas[queueName] = schema
+}
+
+// QueueSchema возвращает схему очереди или nil, если она не задана
+func (qb *QueueBroker) QueueSchema(queueName string) *Schema {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	return qb.schemas[queueName]
+}
+
+// validateLocked проверяет тело сообщения по схеме очереди назначения
+func (qb *QueueBroker) validateLocked(queueName string, msg *Message) error {
+	schema := qb.schemas[queueName]
+	// Вынесенное тело проверено до выноса (см. offloadBody)
+	if schema == nil || msg.Headers[ClaimCheckHeader] != "" {
+		return nil
+	}
+	if violations := schema.Validate(msg.Body); len(violations) > 0 {
+		return &SchemaError{Queue: queueName, Violations: violations}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package broker
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+const orderSchema = `{
+	"type": "object",
+	"required": ["id", "total"],
+	"additionalProperties": false,
+	"properties": {
+		"id": {"type": "string", "pattern": "^o-[0-9]+$"},
+		"total": {"type": "number", "minimum": 0},
+		"status": {"enum": ["new", "paid"]},
+		"items": {"type": "array", "minItems": 1, "items": {"type": "integer"}}
+	}
+}`
+
+// TestSchemaValidate проверяет поддерживаемые ключевые слова JSON Schema
+func TestSchemaValidate(t *testing.T) {
+	schema, err := ParseSchema([]byte(orderSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		body       string
+		violations []string
+	}{
+		{`{"id": "o-1", "total": 10, "status": "paid", "items": [1, 2]}`, nil},
+		{`not json`, []string{"/: body is not valid JSON"}},
+		{`[]`, []string{"/: expected object, got array"}},
+		{`{"id": "x", "total": -1}`, []string{`/id: does not match pattern "^o-[0-9]+$"`, "/total: must be >= 0"}},
+		{`{"total": 1, "extra": true}`, []string{`/: missing required property "id"`, `/: unexpected property "extra"`}},
+		{`{"id": "o-1", "total": 1, "status": "lost", "items": [1.5]}`, []string{"/items/0: expected integer, got number", "/status: value is not one of the allowed values"}},
+	}
+	for _, tt := range tests {
+		if got := schema.Validate(tt.body); !reflect.DeepEqual(got, tt.violations) {
+			t.Errorf("Validate(%s) = %q, want %q", tt.body, got, tt.violations)
+		}
+	}
+
+	for _, invalid := range []string{`[]`, `{"type": "text"}`, `{"$ref": "#/x"}`, `{"minLength": -1}`, `{"pattern": "("}`} {
+		if _, err := ParseSchema([]byte(invalid)); err == nil {
+			t.Errorf("expected %s to be rejected", invalid)
+		}
+	}
+}
+
+// TestEnqueueSchema проверяет отклонение сообщений, не соответствующих схеме,
+// и сохранение схемы в снимке
+func TestEnqueueSchema(t *testing.T) {
+	qb := NewQueueBroker(10, 10, 1)
+	schema, _ := ParseSchema([]byte(orderSchema))
+	qb.SetQueueSchema("orders", schema)
+
+	err := qb.Enqueue("orders", &Message{Body: `{"id": "o-1"}`})
+	var schemaErr *SchemaError
+	if !errors.Is(err, ErrSchemaViolation) || !errors.As(err, &schemaErr) || len(schemaErr.Violations) != 1 {
+		t.Fatalf("expected schema violation, got %v", err)
+	}
+	if qb.Depth("orders") != 0 {
+		t.Errorf("invalid message was enqueued")
+	}
+	if err := qb.Enqueue("orders", &Message{Body: `{"id": "o-1", "total": 5}`}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(qb.Snapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		t.Fatal(err)
+	}
+	restored := NewQueueBroker(10, 10, 1)
+	if err := restored.Restore(&snap); err != nil {
+		t.Fatal(err)
+	}
+	if err := restored.Enqueue("orders", &Message{Body: `{}`}); !errors.Is(err, ErrSchemaViolation) {
+		t.Errorf("schema was not restored from snapshot: %v", err)
+	}
+
+	qb.SetQueueSchema("orders", nil)
+	if err := qb.Enqueue("orders", &Message{Body: `{}`}); err != nil {
+		t.Errorf("expected schema to be removed, got %v", err)
+	}
+}
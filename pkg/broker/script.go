@@ -0,0 +1,904 @@
+package broker
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// script скомпилированное выражение на небольшом CEL-подобном языке.
+//
+// Поддерживаются литералы (строки, числа, true/false/null, списки, объекты),
+// доступ к полям через точку и индекс, арифметика, сравнения, логические
+// операторы, оператор in, тернарный оператор и встроенные функции,
+// которые можно вызывать и как методы: headers.type.startsWith("order.").
+type script struct {
+	src  string
+	root node
+}
+
+// compileScript разбирает исходный текст выражения
+func compileScript(src string) (*script, error) {
+	p := &scriptParser{lex: scriptLexer{src: src}}
+	p.next()
+	root, err := p.parseExpr()
+	if err != nil {
+		return nil, fmt.Errorf("script %q: %w", src, err)
+	}
+	if p.tok.kind != tokEOF {
+		return nil, fmt.Errorf("script %q: unexpected %q at %d", src, p.tok.text, p.tok.pos)
+	}
+	return &script{src: src, root: root}, nil
+}
+
+// Eval вычисляет выражение в окружении vars
+func (s *script) Eval(vars map[string]any) (any, error) {
+	v, err := s.root.eval(vars)
+	if err != nil {
+		return nil, fmt.Errorf("script %q: %w", s.src, err)
+	}
+	return v, nil
+}
+
+// String возвращает исходный текст выражения
+func (s *script) String() string {
+	return s.src
+}
+
+// Лексер
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+type scriptLexer struct {
+	src string
+	pos int
+}
+
+func (l *scriptLexer) next() (token, error) {
+	for l.pos < len(l.src) && unicode.IsSpace(rune(l.src[l.pos])) {
+		l.pos++
+	}
+	start := l.pos
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF, pos: start}, nil
+	}
+
+	c := l.src[l.pos]
+	switch {
+	case c == '_' || unicode.IsLetter(rune(c)):
+		for l.pos < len(l.src) && (l.src[l.pos] == '_' || unicode.IsLetter(rune(l.src[l.pos])) || unicode.IsDigit(rune(l.src[l.pos]))) {
+			l.pos++
+		}
+		return token{kind: tokIdent, text: l.src[start:l.pos], pos: start}, nil
+	case unicode.IsDigit(rune(c)):
+		for l.pos < len(l.src) && (unicode.IsDigit(rune(l.src[l.pos])) || l.src[l.pos] == '.') {
+			l.pos++
+		}
+		return token{kind: tokNumber, text: l.src[start:l.pos], pos: start}, nil
+	case c == '"' || c == '\'':
+		l.pos++
+		var sb strings.Builder
+		for l.pos < len(l.src) && l.src[l.pos] != c {
+			if l.src[l.pos] == '\\' && l.pos+1 < len(l.src) {
+				l.pos++
+				switch l.src[l.pos] {
+				case 'n':
+					sb.WriteByte('\n')
+				case 't':
+					sb.WriteByte('\t')
+				default:
+					sb.WriteByte(l.src[l.pos])
+				}
+			} else {
+				sb.WriteByte(l.src[l.pos])
+			}
+			l.pos++
+		}
+		if l.pos >= len(l.src) {
+			return token{}, fmt.Errorf("unterminated string at %d", start)
+		}
+		l.pos++
+		return token{kind: tokString, text: sb.String(), pos: start}, nil
+	}
+
+	for _, op := range []string{"==", "!=", "<=", ">=", "&&", "||"} {
+		if strings.HasPrefix(l.src[l.pos:], op) {
+			l.pos += len(op)
+			return token{kind: tokOp, text: op, pos: start}, nil
+		}
+	}
+	if strings.ContainsRune("+-*/%<>!?:.,()[]{}", rune(c)) {
+		l.pos++
+		return token{kind: tokOp, text: string(c), pos: start}, nil
+	}
+	return token{}, fmt.Errorf("unexpected character %q at %d", c, start)
+}
+
+// Парсер (рекурсивный спуск)
+
+type scriptParser struct {
+	lex scriptLexer
+	tok token
+	err error
+}
+
+func (p *scriptParser) next() {
+	if p.err != nil {
+		return
+	}
+	p.tok, p.err = p.lex.next()
+	if p.err != nil {
+		p.tok = token{kind: tokEOF}
+	}
+}
+
+func (p *scriptParser) isOp(ops ...string) bool {
+	if p.tok.kind != tokOp {
+		return false
+	}
+	for _, op := range ops {
+		if p.tok.text == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *scriptParser) expect(op string) error {
+	if p.err != nil {
+		return p.err
+	}
+	if !p.isOp(op) {
+		return fmt.Errorf("expected %q at %d", op, p.tok.pos)
+	}
+	p.next()
+	return nil
+}
+
+func (p *scriptParser) parseExpr() (node, error) {
+	cond, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	if !p.isOp("?") {
+		return cond, nil
+	}
+	p.next()
+	then, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	els, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	return &ternaryNode{cond: cond, then: then, els: els}, nil
+}
+
+// binaryLevels операторы по возрастанию приоритета
+var binaryLevels = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!="},
+	{"<", "<=", ">", ">=", "in"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *scriptParser) parseBinary(level int) (node, error) {
+	if level == len(binaryLevels) {
+		return p.parseUnary()
+	}
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := ""
+		if p.isOp(binaryLevels[level]...) {
+			op = p.tok.text
+		} else if p.tok.kind == tokIdent && p.tok.text == "in" && level == 3 {
+			op = "in"
+		}
+		if op == "" {
+			return left, p.err
+		}
+		p.next()
+		right, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *scriptParser) parseUnary() (node, error) {
+	if p.isOp("!", "-") {
+		op := p.tok.text
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op: op, operand: operand}, nil
+	}
+	return p.parsePostfix()
+}
+
+func (p *scriptParser) parsePostfix() (node, error) {
+	n, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.isOp("."):
+			p.next()
+			if p.tok.kind != tokIdent {
+				return nil, fmt.Errorf("expected field name at %d", p.tok.pos)
+			}
+			name := p.tok.text
+			p.next()
+			if p.isOp("(") {
+				if _, ok := scriptFuncs[name]; !ok {
+					return nil, fmt.Errorf("unknown function %q at %d", name, p.tok.pos)
+				}
+				args, err := p.parseArgs(")")
+				if err != nil {
+					return nil, err
+				}
+				n = &callNode{name: name, args: append([]node{n}, args...)}
+			} else {
+				n = &indexNode{target: n, index: &literalNode{value: name}}
+			}
+		case p.isOp("["):
+			p.next()
+			idx, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			n = &indexNode{target: n, index: idx}
+		default:
+			return n, p.err
+		}
+	}
+}
+
+func (p *scriptParser) parseArgs(closing string) ([]node, error) {
+	p.next()
+	var args []node
+	for !p.isOp(closing) {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	p.next()
+	return args, p.err
+}
+
+func (p *scriptParser) parsePrimary() (node, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	tok := p.tok
+	switch tok.kind {
+	case tokNumber:
+		p.next()
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at %d", tok.text, tok.pos)
+		}
+		return &literalNode{value: f}, nil
+	case tokString:
+		p.next()
+		return &literalNode{value: tok.text}, nil
+	case tokIdent:
+		p.next()
+		switch tok.text {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		case "null":
+			return &literalNode{value: nil}, nil
+		}
+		if p.isOp("(") {
+			args, err := p.parseArgs(")")
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := scriptFuncs[tok.text]; !ok {
+				return nil, fmt.Errorf("unknown function %q at %d", tok.text, tok.pos)
+			}
+			return &callNode{name: tok.text, args: args}, nil
+		}
+		return &identNode{name: tok.text}, nil
+	case tokOp:
+		switch tok.text {
+		case "(":
+			p.next()
+			n, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			return n, p.expect(")")
+		case "[":
+			items, err := p.parseArgs("]")
+			if err != nil {
+				return nil, err
+			}
+			return &listNode{items: items}, nil
+		case "{":
+			return p.parseObject()
+		}
+	}
+	if tok.kind == tokEOF {
+		return nil, errors.New("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected %q at %d", tok.text, tok.pos)
+}
+
+func (p *scriptParser) parseObject() (node, error) {
+	p.next()
+	obj := &objectNode{}
+	for !p.isOp("}") {
+		if len(obj.keys) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		if p.tok.kind != tokString && p.tok.kind != tokIdent {
+			return nil, fmt.Errorf("expected object key at %d", p.tok.pos)
+		}
+		obj.keys = append(obj.keys, p.tok.text)
+		p.next()
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		v, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		obj.values = append(obj.values, v)
+	}
+	p.next()
+	return obj, p.err
+}
+
+// Узлы дерева выражения
+
+type node interface {
+	eval(vars map[string]any) (any, error)
+}
+
+type literalNode struct{ value any }
+
+func (n *literalNode) eval(map[string]any) (any, error) { return n.value, nil }
+
+type identNode struct{ name string }
+
+func (n *identNode) eval(vars map[string]any) (any, error) {
+	v, ok := vars[n.name]
+	if !ok {
+		return nil, fmt.Errorf("undefined variable %q", n.name)
+	}
+	return v, nil
+}
+
+type listNode struct{ items []node }
+
+func (n *listNode) eval(vars map[string]any) (any, error) {
+	list := make([]any, len(n.items))
+	for i, item := range n.items {
+		v, err := item.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		list[i] = v
+	}
+	return list, nil
+}
+
+type objectNode struct {
+	keys   []string
+	values []node
+}
+
+func (n *objectNode) eval(vars map[string]any) (any, error) {
+	obj := make(map[string]any, len(n.keys))
+	for i, key := range n.keys {
+		v, err := n.values[i].eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		obj[key] = v
+	}
+	return obj, nil
+}
+
+type indexNode struct{ target, index node }
+
+// eval возвращает null для отсутствующих полей, чтобы выражения вида
+// headers.type == "x" не падали на сообщениях без заголовка
+func (n *indexNode) eval(vars map[string]any) (any, error) {
+	target, err := n.target.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := n.index.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	switch t := target.(type) {
+	case map[string]any:
+		key, ok := idx.(string)
+		if !ok {
+			return nil, fmt.Errorf("object index must be a string, got %s", typeName(idx))
+		}
+		return t[key], nil
+	case []any:
+		f, ok := idx.(float64)
+		if !ok {
+			return nil, fmt.Errorf("list index must be a number, got %s", typeName(idx))
+		}
+		i := int(f)
+		if i < 0 || i >= len(t) {
+			return nil, nil
+		}
+		return t[i], nil
+	case nil:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("cannot index %s", typeName(target))
+}
+
+type unaryNode struct {
+	op      string
+	operand node
+}
+
+func (n *unaryNode) eval(vars map[string]any) (any, error) {
+	v, err := n.operand.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "!" {
+		return !truthy(v), nil
+	}
+	f, ok := v.(float64)
+	if !ok {
+		return nil, fmt.Errorf("cannot negate %s", typeName(v))
+	}
+	return -f, nil
+}
+
+type ternaryNode struct{ cond, then, els node }
+
+func (n *ternaryNode) eval(vars map[string]any) (any, error) {
+	c, err := n.cond.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	if truthy(c) {
+		return n.then.eval(vars)
+	}
+	return n.els.eval(vars)
+}
+
+type binaryNode struct {
+	op          string
+	left, right node
+}
+
+func (n *binaryNode) eval(vars map[string]any) (any, error) {
+	l, err := n.left.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	// Логические операторы вычисляются лениво
+	switch n.op {
+	case "&&":
+		if !truthy(l) {
+			return false, nil
+		}
+		r, err := n.right.eval(vars)
+		return truthy(r), err
+	case "||":
+		if truthy(l) {
+			return true, nil
+		}
+		r, err := n.right.eval(vars)
+		return truthy(r), err
+	}
+
+	r, err := n.right.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==":
+		return equalValues(l, r), nil
+	case "!=":
+		return !equalValues(l, r), nil
+	case "in":
+		return containsValue(r, l)
+	case "+":
+		if ls, ok := l.(string); ok {
+			return ls + toString(r), nil
+		}
+	}
+
+	if ls, ok := l.(string); ok {
+		if rs, ok := r.(string); ok {
+			switch n.op {
+			case "<":
+				return ls < rs, nil
+			case "<=":
+				return ls <= rs, nil
+			case ">":
+				return ls > rs, nil
+			case ">=":
+				return ls >= rs, nil
+			}
+		}
+	}
+
+	lf, lok := l.(float64)
+	rf, rok := r.(float64)
+	if !lok || !rok {
+		return nil, fmt.Errorf("operator %s: unsupported operands %s and %s", n.op, typeName(l), typeName(r))
+	}
+	switch n.op {
+	case "+":
+		return lf + rf, nil
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	case "/":
+		if rf == 0 {
+			return nil, errors.New("division by zero")
+		}
+		return lf / rf, nil
+	case "%":
+		if rf == 0 {
+			return nil, errors.New("division by zero")
+		}
+		return math.Mod(lf, rf), nil
+	case "<":
+		return lf < rf, nil
+	case "<=":
+		return lf <= rf, nil
+	case ">":
+		return lf > rf, nil
+	case ">=":
+		return lf >= rf, nil
+	}
+	return nil, fmt.Errorf("unknown operator %s", n.op)
+}
+
+type callNode struct {
+	name string
+	args []node
+}
+
+func (n *callNode) eval(vars map[string]any) (any, error) {
+	fn, ok := scriptFuncs[n.name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q", n.name)
+	}
+	args := make([]any, len(n.args))
+	for i, arg := range n.args {
+		v, err := arg.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	return fn(args)
+}
+
+// Встроенные функции
+
+type scriptFunc func(args []any) (any, error)
+
+var scriptFuncs map[string]scriptFunc
+
+func init() {
+	scriptFuncs = map[string]scriptFunc{
+		"size": func(args []any) (any, error) {
+			if err := wantArgs("size", args, 1); err != nil {
+				return nil, err
+			}
+			switch v := args[0].(type) {
+			case string:
+				return float64(len(v)), nil
+			case []any:
+				return float64(len(v)), nil
+			case map[string]any:
+				return float64(len(v)), nil
+			case nil:
+				return float64(0), nil
+			}
+			return nil, fmt.Errorf("size: unsupported %s", typeName(args[0]))
+		},
+		"has": func(args []any) (any, error) {
+			if err := wantArgs("has", args, 2); err != nil {
+				return nil, err
+			}
+			obj, _ := args[0].(map[string]any)
+			_, ok := obj[toString(args[1])]
+			return ok, nil
+		},
+		"contains":   stringPredicate("contains", strings.Contains),
+		"startsWith": stringPredicate("startsWith", strings.HasPrefix),
+		"endsWith":   stringPredicate("endsWith", strings.HasSuffix),
+		"matches": func(args []any) (any, error) {
+			if err := wantArgs("matches", args, 2); err != nil {
+				return nil, err
+			}
+			re, err := regexp.Compile(toString(args[1]))
+			if err != nil {
+				return nil, fmt.Errorf("matches: %w", err)
+			}
+			return re.MatchString(toString(args[0])), nil
+		},
+		"merge": func(args []any) (any, error) {
+			merged := make(map[string]any)
+			for _, arg := range args {
+				obj, ok := arg.(map[string]any)
+				if !ok && arg != nil {
+					return nil, fmt.Errorf("merge: unsupported %s", typeName(arg))
+				}
+				for k, v := range obj {
+					merged[k] = v
+				}
+			}
+			return merged, nil
+		},
+		"omit": func(args []any) (any, error) {
+			if len(args) < 1 {
+				return nil, errors.New("omit: expected an object and keys")
+			}
+			obj, ok := args[0].(map[string]any)
+			if !ok && args[0] != nil {
+				return nil, fmt.Errorf("omit: unsupported %s", typeName(args[0]))
+			}
+			omitted := make(map[string]bool)
+			for _, arg := range args[1:] {
+				if list, ok := arg.([]any); ok {
+					for _, key := range list {
+						omitted[toString(key)] = true
+					}
+				} else {
+					omitted[toString(arg)] = true
+				}
+			}
+			result := make(map[string]any, len(obj))
+			for k, v := range obj {
+				if !omitted[k] {
+					result[k] = v
+				}
+			}
+			return result, nil
+		},
+		"now": func(args []any) (any, error) {
+			if err := wantArgs("now", args, 0); err != nil {
+				return nil, err
+			}
+			return float64(time.Now().UnixMilli()) / 1000, nil
+		},
+		"lower": stringMapper("lower", strings.ToLower),
+		"upper": stringMapper("upper", strings.ToUpper),
+		"trim":  stringMapper("trim", strings.TrimSpace),
+		"string": func(args []any) (any, error) {
+			if err := wantArgs("string", args, 1); err != nil {
+				return nil, err
+			}
+			return toString(args[0]), nil
+		},
+		"number": func(args []any) (any, error) {
+			if err := wantArgs("number", args, 1); err != nil {
+				return nil, err
+			}
+			switch v := args[0].(type) {
+			case float64:
+				return v, nil
+			case string:
+				f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+				if err != nil {
+					return nil, fmt.Errorf("number: %w", err)
+				}
+				return f, nil
+			case bool:
+				if v {
+					return float64(1), nil
+				}
+				return float64(0), nil
+			}
+			return nil, fmt.Errorf("number: unsupported %s", typeName(args[0]))
+		},
+	}
+}
+
+func wantArgs(name string, args []any, n int) error {
+	if len(args) != n {
+		return fmt.Errorf("%s: expected %d arguments, got %d", name, n, len(args))
+	}
+	return nil
+}
+
+func stringPredicate(name string, fn func(s, sub string) bool) scriptFunc {
+	return func(args []any) (any, error) {
+		if err := wantArgs(name, args, 2); err != nil {
+			return nil, err
+		}
+		if args[0] == nil {
+			return false, nil
+		}
+		return fn(toString(args[0]), toString(args[1])), nil
+	}
+}
+
+func stringMapper(name string, fn func(s string) string) scriptFunc {
+	return func(args []any) (any, error) {
+		if err := wantArgs(name, args, 1); err != nil {
+			return nil, err
+		}
+		return fn(toString(args[0])), nil
+	}
+}
+
+// Вспомогательные функции для значений
+
+func truthy(v any) bool {
+	switch t := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return t
+	case float64:
+		return t != 0
+	case string:
+		return t != ""
+	case []any:
+		return len(t) > 0
+	case map[string]any:
+		return len(t) > 0
+	}
+	return true
+}
+
+func equalValues(a, b any) bool {
+	switch at := a.(type) {
+	case []any:
+		bt, ok := b.([]any)
+		if !ok || len(at) != len(bt) {
+			return false
+		}
+		for i := range at {
+			if !equalValues(at[i], bt[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]any:
+		bt, ok := b.(map[string]any)
+		if !ok || len(at) != len(bt) {
+			return false
+		}
+		for k, v := range at {
+			if !equalValues(v, bt[k]) {
+				return false
+			}
+		}
+		return true
+	}
+	switch b.(type) {
+	case []any, map[string]any:
+		return false
+	}
+	return a == b
+}
+
+func containsValue(container, v any) (any, error) {
+	switch c := container.(type) {
+	case []any:
+		for _, item := range c {
+			if equalValues(item, v) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case map[string]any:
+		_, ok := c[toString(v)]
+		return ok, nil
+	case string:
+		return strings.Contains(c, toString(v)), nil
+	case nil:
+		return false, nil
+	}
+	return nil, fmt.Errorf("operator in: unsupported %s", typeName(container))
+}
+
+func toString(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(t)
+	case map[string]any:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		parts := make([]string, len(keys))
+		for i, k := range keys {
+			parts[i] = k + ":" + toString(t[k])
+		}
+		return "{" + strings.Join(parts, ", ") + "}"
+	case []any:
+		parts := make([]string, len(t))
+		for i, item := range t {
+			parts[i] = toString(item)
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	}
+	return fmt.Sprint(v)
+}
+
+func typeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "bool"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "list"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
@@ -0,0 +1,40 @@
+package broker
+
+import "testing"
+
+// TestScriptEval проверяет вычисление выражений скриптового языка
+func TestScriptEval(t *testing.T) {
+	vars := map[string]any{
+		"headers": map[string]any{"type": "order.created"},
+		"payload": map[string]any{"total": float64(1500), "tags": []any{"vip"}},
+	}
+
+	cases := map[string]any{
+		`headers.type == "order.created"`:               true,
+		`headers.type.startsWith("order.")`:             true,
+		`headers["missing"] == null`:                    true,
+		`payload.total > 1000 && "vip" in payload.tags`: true,
+		`payload.total > 1000 ? "big" : "small"`:        "big",
+		`size(payload.tags) + 1`:                        float64(2),
+		`!(payload.total < 10) || false`:                true,
+	}
+	for src, want := range cases {
+		s, err := compileScript(src)
+		if err != nil {
+			t.Fatalf("compile %q: %v", src, err)
+		}
+		got, err := s.Eval(vars)
+		if err != nil {
+			t.Fatalf("eval %q: %v", src, err)
+		}
+		if !equalValues(got, want) {
+			t.Errorf("eval %q: got %v want %v", src, got, want)
+		}
+	}
+
+	for _, src := range []string{`headers.type ==`, `unknown(1)`, `"unterminated`} {
+		if _, err := compileScript(src); err == nil {
+			t.Errorf("compile %q: expected error", src)
+		}
+	}
+}
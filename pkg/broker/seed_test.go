@@ -0,0 +1,32 @@
+package broker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestSeed проверяет загрузку сообщений из NDJSON и обычных файлов
+func TestSeed(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "orders.eu.ndjson"), []byte(`{"message": "o1", "headers": {"type": "a"}}`+"\n\n"+`{"message": "o2"}`+"\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "blob.bin"), []byte{0xff, 0x00}, 0o644)
+	os.WriteFile(filepath.Join(dir, ".hidden"), []byte("skip"), 0o644)
+
+	qb := NewQueueBroker(100, 10, 10)
+	count, err := qb.Seed(dir)
+	if err != nil || count != 3 {
+		t.Fatalf("expected 3 seeded messages, got %d %v", count, err)
+	}
+	if msg, _ := qb.Dequeue("orders.eu", 0); msg == nil || msg.Body != "o1" || msg.Headers["type"] != "a" {
+		t.Errorf("unexpected first message: %+v", msg)
+	}
+	if msg, _ := qb.Dequeue("blob", 0); msg == nil || msg.Body != "\xff\x00" || msg.ContentType != "application/octet-stream" {
+		t.Errorf("unexpected file message: %+v", msg)
+	}
+
+	os.WriteFile(filepath.Join(dir, "broken.jsonl"), []byte("{not json}\n"), 0o644)
+	if _, err := NewQueueBroker(100, 10, 10).Seed(dir); err == nil || err.Error() != "seed broken.jsonl:1: invalid message" {
+		t.Errorf("expected error with file and line, got %v", err)
+	}
+}
@@ -0,0 +1,184 @@
+package broker
+
+import (
+	"sync"
+	"time"
+)
+
+// Selector условие выборочного получения на языке скриптов маршрутизации,
+// например headers.type == "order.created" или payload.total > 100.
+// Выражение вычисляется в том же окружении, что и правила маршрутизации.
+type Selector struct {
+	compiled *script
+}
+
+// selectors кэш скомпилированных условий по исходному тексту
+var selectors sync.Map
+
+// CompileSelector разбирает условие выборочного получения
+func CompileSelector(src string) (*Selector, error) {
+	if compiled, ok := selectors.Load(src); ok {
+		return compiled.(*Selector), nil
+	}
+	compiled, err := compileScript(src)
+	if err != nil {
+		return nil, err
+	}
+	sel := &Selector{compiled: compiled}
+	selectors.Store(src, sel)
+	return sel, nil
+}
+
+// String возвращает исходный текст условия
+func (s *Selector) String() string {
+	return s.compiled.String()
+}
+
+// matchesLocked проверяет хранимое сообщение; ошибка вычисления (например,
+// сравнение строки с числом) означает, что сообщение не подходит
+func (s *Selector) matchesLocked(qb *QueueBroker, queueName string, stored *Message) bool {
+	msg, err := qb.unpackLocked(stored)
+	if err != nil {
+		return false
+	}
+	result, err := s.compiled.Eval(scriptVars(queueName, msg))
+	return err == nil && truthy(result)
+}
+
+// DequeueSelected извлекает из очереди первое сообщение, удовлетворяющее
+// условию sel, ожидая его до timeout. Неподходящие сообщения
+// остаются в очереди на своих местах для других получателей.
+func (qb *QueueBroker) DequeueSelected(queueName string, sel *Selector, timeout time.Duration) (*Message, error) {
+	stored, err := qb.dequeueMatching(queueName, timeout, func(stored *Message) bool {
+		return sel.matchesLocked(qb, queueName, stored)
+	})
+	if err != nil {
+		return nil, err
+	}
+	qb.mu.Lock()
+	qb.releaseLocked(stored.Queue, stored)
+	qb.mu.Unlock()
+	return qb.deliver(stored)
+}
+
+// dequeueMatching извлекает первое хранимое сообщение, для которого match
+// (вызывается под qb.mu) возвращает true. Ожидающий выборочного получения
+// не становится в общую очередь ожидающих и не резервирует сообщений: его
+// будит каждое новое сообщение очереди, и он проверяет, не то ли это,
+// которого он ждет.
+func (qb *QueueBroker) dequeueMatching(queueName string, timeout time.Duration, match func(*Message) bool) (*Message, error) {
+	if queueName == "" || IsPattern(queueName) {
+		return nil, ErrInvalidQueueName
+	}
+	deadline := time.NewTimer(qb.waitLimit(timeout))
+	defer deadline.Stop()
+
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	var w *waiter
+	attached := false
+	defer func() {
+		if w != nil {
+			qb.removeSelectiveWaiterLocked(queueName, w)
+		}
+		if attached {
+			qb.detachConsumerLocked(queueName)
+		}
+	}()
+	var seen *messageQueue
+	for {
+		if err := qb.standbyLocked(queueName); err != nil {
+			return nil, err
+		}
+		queue := qb.queues[queueName]
+		if queue == nil && (seen != nil || timeout <= 0) {
+			return nil, ErrQueueNotFound
+		}
+		var paused time.Duration
+		if queue != nil {
+			seen = queue
+			if qb.archiving[queueName] {
+				return nil, ErrQueueArchiving
+			}
+			paused = qb.pausedLocked(queueName, time.Now())
+			if paused == 0 {
+				if msg := qb.popMatchingLocked(queueName, queue, match); msg != nil {
+					qb.holdGroupLocked(queueName, msg)
+					return msg, nil
+				}
+			}
+		}
+		if timeout <= 0 {
+			return nil, ErrTimeout
+		}
+		if !attached {
+			if err := qb.attachConsumerLocked(queueName); err != nil {
+				return nil, err
+			}
+			attached = true
+		}
+		if w == nil {
+			w = &waiter{ready: make(chan struct{}, 1)}
+			qb.selectiveWaiters[queueName] = append(qb.selectiveWaiters[queueName], w)
+		}
+		qb.mu.Unlock()
+
+		resume, stop := resumeTimer(paused)
+		expired := false
+		select {
+		case <-w.ready:
+		case <-resume:
+		case <-deadline.C:
+			expired = true
+		}
+		stop()
+		qb.mu.Lock()
+		if expired {
+			if qb.queues[queueName] == nil {
+				return nil, ErrQueueNotFound
+			}
+			return nil, ErrTimeout
+		}
+	}
+}
+
+// popMatchingLocked извлекает первое подходящее сообщение очереди, группа
+// которого не занята
+func (qb *QueueBroker) popMatchingLocked(queueName string, queue *messageQueue, match func(*Message) bool) *Message {
+	held := qb.groups[queueName]
+	for i, stored := range queue.messages {
+		if stored.GroupID != "" && held[stored.GroupID] != nil {
+			continue
+		}
+		if !match(stored) {
+			continue
+		}
+		queue.removeAt(i)
+		qb.recordDequeueLocked(queueName, stored)
+		qb.touchLocked(queueName)
+		return stored
+	}
+	return nil
+}
+
+// wakeSelectiveLocked будит всех ожидающих выборочного получения из очереди
+func (qb *QueueBroker) wakeSelectiveLocked(queueName string) {
+	for _, w := range qb.selectiveWaiters[queueName] {
+		w.signal(queueName)
+	}
+}
+
+func (qb *QueueBroker) removeSelectiveWaiterLocked(queueName string, w *waiter) {
+	list := qb.selectiveWaiters[queueName]
+	for i, item := range list {
+		if item == w {
+			list = append(list[:i:i], list[i+1:]...)
+			break
+		}
+	}
+	if len(list) == 0 {
+		delete(qb.selectiveWaiters, queueName)
+	} else {
+		qb.selectiveWaiters[queueName] = list
+	}
+}
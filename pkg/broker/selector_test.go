@@ -0,0 +1,38 @@
+package broker
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestDequeueSelected проверяет выборочное получение по условию
+func TestDequeueSelected(t *testing.T) {
+	qb := NewQueueBroker(10, 10, 10)
+	qb.SetQueueConfig("events", QueueConfig{LockDuration: 30, CompressThreshold: 1})
+	qb.Enqueue("events", &Message{Body: `{"total": 5}`, Headers: map[string]string{"type": "order.created"}})
+	qb.Enqueue("events", &Message{Body: `{"total": 500}`, Headers: map[string]string{"type": "order.created"}})
+	qb.Enqueue("events", &Message{Body: "plain", Headers: map[string]string{"type": "order.paid"}})
+
+	sel, err := CompileSelector(`headers.type == "order.paid"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg, err := qb.DequeueSelected("events", sel, 0); err != nil || msg.Body != "plain" {
+		t.Fatalf("unexpected message %+v %v", msg, err)
+	}
+	// Условие по телу проверяется и для сжатых сообщений
+	sel, _ = CompileSelector(`payload.total > 100`)
+	if msg, err := qb.DequeueSelected("events", sel, 0); err != nil || msg.Body != `{"total": 500}` {
+		t.Fatalf("unexpected message %+v %v", msg, err)
+	}
+	if _, err := qb.DequeueSelected("events", sel, 0); !errors.Is(err, ErrTimeout) {
+		t.Errorf("expected ErrTimeout, got %v", err)
+	}
+	if qb.Depth("events") != 1 {
+		t.Errorf("non-matching message was removed")
+	}
+
+	if _, err := CompileSelector(`headers.type ==`); err == nil {
+		t.Error("expected error for invalid selector")
+	}
+}
@@ -0,0 +1,150 @@
+package broker
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Кодек формата Snappy (блочный формат без кадров): сжимает слабее gzip, но
+// в несколько раз быстрее, что важно для сжатия на пути постановки сообщения.
+
+var errSnappyCorrupt = errors.New("snappy: corrupt input")
+
+const snappyTableBits = 14
+
+// snappyEncode сжимает src в блочном формате Snappy
+func snappyEncode(src []byte) []byte {
+	dst := binary.AppendUvarint(make([]byte, 0, len(src)/2+16), uint64(len(src)))
+	var table [1 << snappyTableBits]int32
+	literal := 0
+	for i := 0; i+4 <= len(src); {
+		current := binary.LittleEndian.Uint32(src[i:])
+		h := (current * 0x1e35a7bd) >> (32 - snappyTableBits)
+		candidate := int(table[h]) - 1
+		table[h] = int32(i + 1)
+		if candidate < 0 || i-candidate > 0xffff || binary.LittleEndian.Uint32(src[candidate:]) != current {
+			i++
+			continue
+		}
+		dst = snappyLiteral(dst, src[literal:i])
+		length := 4
+		for i+length < len(src) && src[candidate+length] == src[i+length] {
+			length++
+		}
+		dst = snappyCopy(dst, i-candidate, length)
+		i += length
+		literal = i
+	}
+	return snappyLiteral(dst, src[literal:])
+}
+
+func snappyLiteral(dst, lit []byte) []byte {
+	if len(lit) == 0 {
+		return dst
+	}
+	n := len(lit) - 1
+	switch {
+	case n < 60:
+		dst = append(dst, byte(n)<<2)
+	case n < 1<<8:
+		dst = append(dst, 60<<2, byte(n))
+	case n < 1<<16:
+		dst = append(dst, 61<<2, byte(n), byte(n>>8))
+	case n < 1<<24:
+		dst = append(dst, 62<<2, byte(n), byte(n>>8), byte(n>>16))
+	default:
+		dst = append(dst, 63<<2, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+	}
+	return append(dst, lit...)
+}
+
+// snappyCopy записывает ссылку на length байт, начинающихся offset байт назад
+// (offset не больше 65535)
+func snappyCopy(dst []byte, offset, length int) []byte {
+	for length >= 68 {
+		dst = append(dst, 63<<2|2, byte(offset), byte(offset>>8))
+		length -= 64
+	}
+	if length > 64 {
+		dst = append(dst, 59<<2|2, byte(offset), byte(offset>>8))
+		length -= 60
+	}
+	if length >= 12 || offset >= 2048 {
+		return append(dst, byte(length-1)<<2|2, byte(offset), byte(offset>>8))
+	}
+	return append(dst, byte(offset>>8)<<5|byte(length-4)<<2|1, byte(offset))
+}
+
+// snappyDecode распаковывает блок формата Snappy
+func snappyDecode(src []byte) ([]byte, error) {
+	size, n := binary.Uvarint(src)
+	if n <= 0 || size > 1<<32-1 {
+		return nil, errSnappyCorrupt
+	}
+	src = src[n:]
+	// Каждый байт входа дает не больше 64 байт выхода
+	if size > uint64(len(src))*64 {
+		return nil, errSnappyCorrupt
+	}
+	dst := make([]byte, 0, size)
+	for len(src) > 0 {
+		tag := src[0]
+		var length, offset int
+		switch tag & 3 {
+		case 0:
+			length = int(tag >> 2)
+			extra := 0
+			if length >= 60 {
+				extra = length - 59
+				if len(src) < 1+extra {
+					return nil, errSnappyCorrupt
+				}
+				length = 0
+				for i := extra; i >= 1; i-- {
+					length = length<<8 | int(src[i])
+				}
+			}
+			length++
+			src = src[1+extra:]
+			if length <= 0 || length > len(src) || uint64(len(dst)+length) > size {
+				return nil, errSnappyCorrupt
+			}
+			dst = append(dst, src[:length]...)
+			src = src[length:]
+			continue
+		case 1:
+			if len(src) < 2 {
+				return nil, errSnappyCorrupt
+			}
+			length = 4 + int(tag>>2&7)
+			offset = int(tag>>5)<<8 | int(src[1])
+			src = src[2:]
+		case 2:
+			if len(src) < 3 {
+				return nil, errSnappyCorrupt
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint16(src[1:]))
+			src = src[3:]
+		case 3:
+			if len(src) < 5 {
+				return nil, errSnappyCorrupt
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint32(src[1:]))
+			src = src[5:]
+		}
+		if offset <= 0 || offset > len(dst) || uint64(len(dst)+length) > size {
+			return nil, errSnappyCorrupt
+		}
+		// Ссылка может перекрывать записываемые байты, поэтому копируем побайтно
+		start := len(dst) - offset
+		for i := 0; i < length; i++ {
+			dst = append(dst, dst[start+i])
+		}
+	}
+	if uint64(len(dst)) != size {
+		return nil, errSnappyCorrupt
+	}
+	return dst, nil
+}
@@ -0,0 +1,43 @@
+package broker
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// TestSnappy проверяет совместимость с форматом Snappy на известном блоке
+// и обратимость сжатия
+func TestSnappy(t *testing.T) {
+	known := []byte("\x0c\x0cabcd\x11\x04")
+	if got := snappyEncode([]byte("abcdabcdabcd")); !bytes.Equal(got, known) {
+		t.Errorf("unexpected encoding %q", got)
+	}
+	if got, err := snappyDecode(known); err != nil || string(got) != "abcdabcdabcd" {
+		t.Errorf("unexpected decoding %q (%v)", got, err)
+	}
+
+	random := make([]byte, 100000)
+	rand.New(rand.NewSource(1)).Read(random)
+	for _, input := range [][]byte{
+		nil,
+		[]byte("abc"),
+		[]byte(strings.Repeat("a", 100000)),
+		[]byte(strings.Repeat("highly compressible payload ", 5000)),
+		random,
+		append(random[:70000:70000], random[:70000]...),
+	} {
+		encoded := snappyEncode(input)
+		decoded, err := snappyDecode(encoded)
+		if err != nil || !bytes.Equal(decoded, input) {
+			t.Errorf("round trip of %d bytes failed: %v", len(input), err)
+		}
+	}
+
+	for _, corrupt := range []string{"", "\x05\x10hel", "\x04\x01\x00", "\x08\x0cabcd\x11\x08", "\xff\xff\xff\xff\xff\x01"} {
+		if _, err := snappyDecode([]byte(corrupt)); err == nil {
+			t.Errorf("corrupt input %q was accepted", corrupt)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package broker
+
+import (
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+	"unicode/utf8"
+)
+
+// Snapshot согласованный на один момент времени снимок всех очередей брокера
+type Snapshot struct {
+	CreatedAt time.Time       `json:"created_at"`
+	Queues    []QueueSnapshot `json:"queues"`
+	// Schedules расписания постановки сообщений
+	Schedules []Schedule `json:"schedules,omitempty"`
+}
+
+// QueueSnapshot содержимое одной очереди в снимке
+type QueueSnapshot struct {
+	Name   string       `json:"name"`
+	Config *QueueConfig `json:"config,omitempty"`
+	ACL    *QueueACL    `json:"acl,omitempty"`
+	Schema *Schema      `json:"schema,omitempty"`
+	// Messages ожидающие сообщения в порядке доставки, затем сообщения,
+	// выданные потребителям, но еще не подтвержденные: после восстановления
+	// они будут доставлены повторно
+	Messages []*Message `json:"messages"`
+	// Encrypted тела сообщений зашифрованы ключом арендатора очереди
+	// и закодированы в base64
+	Encrypted bool `json:"encrypted,omitempty"`
+	// KeyID тела сообщений зашифрованы этим ключом из набора ключей брокера
+	// и закодированы в base64
+	KeyID string `json:"key_id,omitempty"`
+}
+
+// Snapshot снимает состояние всех очередей. На время копирования ссылок на
+// сообщения (но не самих сообщений) брокер блокирует постановку и выдачу,
+// поэтому снимок не содержит очередей из разных моментов времени.
+// Распаковка тел выполняется уже после снятия блокировки. Сообщения
+// арендаторов остаются в снимке зашифрованными.
+func (qb *QueueBroker) Snapshot() *Snapshot {
+	qb.mu.Lock()
+	snap := &Snapshot{CreatedAt: time.Now()}
+	stored := qb.storedMessagesLocked()
+	for name := range qb.queues {
+		snap.Queues = append(snap.Queues, qb.queueSnapshotLocked(name, stored[name]))
+	}
+	if len(qb.schedules) > 0 {
+		snap.Schedules = qb.schedulesLocked()
+	}
+	qb.mu.Unlock()
+
+	// Хранимые сообщения не изменяются после постановки, поэтому читать их можно без блокировки
+	sort.Slice(snap.Queues, func(i, j int) bool { return snap.Queues[i].Name < snap.Queues[j].Name })
+	for i := range snap.Queues {
+		qb.encodeSnapshot(&snap.Queues[i])
+	}
+	return snap
+}
+
+// queueSnapshotLocked собирает снимок очереди из хранимых сообщений и копий
+// настроек; тела еще не распакованы (см. encodeSnapshot)
+func (qb *QueueBroker) queueSnapshotLocked(name string, stored []*Message) QueueSnapshot {
+	qs := QueueSnapshot{Name: name, Messages: stored}
+	if cfg, ok := qb.configs[name]; ok {
+		cfgCopy := *cfg
+		qs.Config = &cfgCopy
+	}
+	if acl, ok := qb.acls[name]; ok {
+		aclCopy := *acl
+		qs.ACL = &aclCopy
+	}
+	qs.Schema = qb.schemas[name]
+	return qs
+}
+
+// encodeSnapshot распаковывает тела сообщений снимка; тела сообщений
+// арендатора шифруются его ключом, остальные — текущим ключом брокера, если
+// задан набор ключей, и кодируются в base64
+func (qb *QueueBroker) encodeSnapshot(qs *QueueSnapshot) {
+	qb.mu.Lock()
+	aead, aad := qb.tenantCipherLocked(qs.Name), TenantOf(qs.Name)
+	qs.Encrypted = aead != nil
+	if aead == nil && qb.keys != nil {
+		qs.KeyID = qb.keys.current
+		aead, aad = qb.keys.aead(qs.KeyID), keyAAD(qs.KeyID)
+	}
+	qb.mu.Unlock()
+	for j, stored := range qs.Messages {
+		msg, err := qb.unpack(stored)
+		if err != nil {
+			continue
+		}
+		if aead != nil {
+			sealed := seal(aead, aad, []byte(msg.Body))
+			msg = &Message{Body: base64.StdEncoding.EncodeToString(sealed), Headers: msg.Headers, DedupID: msg.DedupID, ContentType: msg.ContentType, Queue: msg.Queue, GroupID: msg.GroupID, DeliverAt: msg.DeliverAt}
+		}
+		qs.Messages[j] = msg
+	}
+}
+
+// storedMessagesLocked возвращает хранимые сообщения каждой очереди:
+// ожидающие в порядке доставки, затем выданные, но не подтвержденные,
+// и отложенные
+func (qb *QueueBroker) storedMessagesLocked() map[string][]*Message {
+	stored := make(map[string][]*Message, len(qb.queues))
+	for name, queue := range qb.queues {
+		stored[name] = append([]*Message(nil), queue.messages...)
+	}
+	for _, lock := range qb.locks {
+		stored[lock.queueName] = append(stored[lock.queueName], lock.msg)
+	}
+	for queueName, delayed := range qb.delayed {
+		for _, d := range delayed {
+			stored[queueName] = append(stored[queueName], d.msg)
+		}
+	}
+	for queueName, aff := range qb.affinity {
+		seen := make(map[*Subscription]bool)
+		for _, owner := range aff.owners {
+			if !seen[owner] {
+				seen[owner] = true
+				stored[queueName] = append(stored[queueName], owner.mailbox...)
+			}
+		}
+	}
+	return stored
+}
+
+// Restore заменяет содержимое очередей из снимка; очереди, которых нет
+// в снимке, не затрагиваются; расписания из снимка добавляются к имеющимся
+// или заменяют их по ID. Лимиты на размер и число очередей не применяются.
+// Зашифрованные очереди восстанавливаются только при наличии ключа арендатора
+// или ключа из набора ключей брокера.
+func (qb *QueueBroker) Restore(snap *Snapshot) error {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+
+	plain := make([][]*Message, len(snap.Queues))
+	for i, qs := range snap.Queues {
+		plain[i] = qs.Messages
+		var aead cipher.AEAD
+		aad := TenantOf(qs.Name)
+		switch {
+		case qs.Encrypted:
+			if aead = qb.tenantCipherLocked(qs.Name); aead == nil {
+				return fmt.Errorf("restore %s: no key for tenant %q", qs.Name, TenantOf(qs.Name))
+			}
+		case qs.KeyID != "":
+			if aead, aad = qb.keys.aead(qs.KeyID), keyAAD(qs.KeyID); aead == nil {
+				return fmt.Errorf("restore %s: no key %q in keyring", qs.Name, qs.KeyID)
+			}
+		default:
+			continue
+		}
+		plain[i] = make([]*Message, len(qs.Messages))
+		for j, msg := range qs.Messages {
+			sealed, err := base64.StdEncoding.DecodeString(msg.Body)
+			if err != nil {
+				return fmt.Errorf("restore %s: %w", qs.Name, err)
+			}
+			body, err := open(aead, aad, sealed)
+			if err != nil {
+				return fmt.Errorf("restore %s: %w", qs.Name, err)
+			}
+			decrypted := *msg
+			decrypted.Body = string(body)
+			plain[i][j] = &decrypted
+		}
+	}
+	if err := qb.restoreSchedulesLocked(snap.Schedules); err != nil {
+		return err
+	}
+
+	for i, qs := range snap.Queues {
+		if qs.Config != nil {
+			cfg := *qs.Config
+			qb.configs[qs.Name] = &cfg
+		}
+		if qs.ACL != nil {
+			acl := *qs.ACL
+			qb.acls[qs.Name] = &acl
+		}
+		if qs.Schema != nil {
+			qb.schemas[qs.Name] = qs.Schema
+		}
+		queue := qb.queues[qs.Name]
+		if queue == nil {
+			queue = qb.newQueueLocked(qs.Name)
+			qb.queues[qs.Name] = queue
+			qb.index.add(qs.Name)
+			qb.touchLocked(qs.Name)
+		}
+		for _, stored := range append(queue.messages, qb.dropDelayedLocked(qs.Name)...) {
+			qb.releaseLocked(qs.Name, stored)
+		}
+		queue.messages = nil
+		now := time.Now()
+		for _, msg := range plain[i] {
+			stored := qb.packLocked(qs.Name, msg)
+			// Лимиты при восстановлении не применяются, но объем учитывается
+			qb.trackLocked(qs.Name, stored)
+			if stored.DeliverAt.After(now) {
+				qb.scheduleLocked(qs.Name, stored, stored.DeliverAt)
+			} else {
+				queue.push(stored)
+			}
+		}
+	}
+	return nil
+}
+
+// snapshotFile снимок в виде JSON; тело, не являющееся корректным UTF-8,
+// записывается в поле message_base64, как в архиве очередей
+type snapshotFile struct {
+	CreatedAt time.Time           `json:"created_at"`
+	Queues    []snapshotFileQueue `json:"queues"`
+	Schedules []Schedule          `json:"schedules,omitempty"`
+}
+
+type snapshotFileQueue struct {
+	QueueSnapshot
+	Messages []archivedMessage `json:"messages"`
+}
+
+// EncodeSnapshot сериализует снимок в JSON для переноса брокера на другой узел
+func EncodeSnapshot(snap *Snapshot) ([]byte, error) {
+	file := snapshotFile{CreatedAt: snap.CreatedAt, Queues: make([]snapshotFileQueue, len(snap.Queues)), Schedules: snap.Schedules}
+	for i, qs := range snap.Queues {
+		file.Queues[i] = snapshotFileQueue{QueueSnapshot: qs, Messages: make([]archivedMessage, len(qs.Messages))}
+		for j, msg := range qs.Messages {
+			file.Queues[i].Messages[j] = archivedMessage{Message: msg, DeliverAt: msg.DeliverAt}
+			if utf8.ValidString(msg.Body) {
+				file.Queues[i].Messages[j].Body = msg.Body
+			} else {
+				file.Queues[i].Messages[j].Base64 = base64.StdEncoding.EncodeToString([]byte(msg.Body))
+			}
+		}
+	}
+	return json.Marshal(file)
+}
+
+// DecodeSnapshot разбирает снимок, записанный EncodeSnapshot
+func DecodeSnapshot(data []byte) (*Snapshot, error) {
+	var file snapshotFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse snapshot: %w", err)
+	}
+	snap := &Snapshot{CreatedAt: file.CreatedAt, Queues: make([]QueueSnapshot, len(file.Queues)), Schedules: file.Schedules}
+	for i, fq := range file.Queues {
+		qs := fq.QueueSnapshot
+		if qs.Name == "" {
+			return nil, errors.New("parse snapshot: queue without name")
+		}
+		qs.Messages = make([]*Message, len(fq.Messages))
+		for j, am := range fq.Messages {
+			msg := &Message{}
+			if am.Message != nil {
+				*msg = *am.Message
+			}
+			msg.Body, msg.DeliverAt = am.Body, am.DeliverAt
+			if am.Base64 != "" {
+				body, err := base64.StdEncoding.DecodeString(am.Base64)
+				if err != nil {
+					return nil, fmt.Errorf("parse snapshot: queue %s: %w", qs.Name, err)
+				}
+				msg.Body = string(body)
+			}
+			qs.Messages[j] = msg
+		}
+		snap.Queues[i] = qs
+	}
+	return snap, nil
+}
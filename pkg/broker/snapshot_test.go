@@ -0,0 +1,150 @@
+package broker
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestSnapshotConsistency проверяет, что снимок не смешивает очереди из разных моментов:
+// один продюсер пишет последовательные номера по кругу в три очереди,
+// поэтому в согласованном снимке номера образуют непрерывный префикс
+func TestSnapshotConsistency(t *testing.T) {
+	qb := NewQueueBroker(30000, 10, 10)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			qb.PutMessage(fmt.Sprintf("q%d", i%3), strconv.Itoa(i))
+		}
+	}()
+
+	for attempt := 0; attempt < 10; attempt++ {
+		time.Sleep(200 * time.Microsecond)
+		snap := qb.Snapshot()
+		seen := make(map[int]bool)
+		for _, qs := range snap.Queues {
+			for _, msg := range qs.Messages {
+				n, _ := strconv.Atoi(msg.Body)
+				seen[n] = true
+			}
+		}
+		for n := 0; n < len(seen); n++ {
+			if !seen[n] {
+				t.Fatalf("snapshot %d has a gap at message %d of %d", attempt, n, len(seen))
+			}
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
+
+// TestSnapshotRestore проверяет восстановление очередей, настроек и неподтвержденных сообщений
+func TestSnapshotRestore(t *testing.T) {
+	qb := NewQueueBroker(100, 10, 10)
+	qb.SetQueueConfig("jobs", QueueConfig{LockDuration: 30, CompressThreshold: 8})
+	qb.PutMessage("jobs", "locked message body")
+	qb.PutMessage("jobs", "pending message body")
+	qb.PutMessage("events", "event")
+	if _, err := qb.PeekLock("jobs", time.Second, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	snap := qb.Snapshot()
+	restored := NewQueueBroker(100, 10, 10)
+	if err := restored.Restore(snap); err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg := restored.QueueConfig("jobs"); cfg.CompressThreshold != 8 {
+		t.Errorf("queue config was not restored: %+v", cfg)
+	}
+	for _, want := range []string{"pending message body", "locked message body"} {
+		if message, err := restored.GetMessage("jobs", time.Second); err != nil || message != want {
+			t.Errorf("got %q (%v) want %q", message, err, want)
+		}
+	}
+	if message, err := restored.GetMessage("events", time.Second); err != nil || message != "event" {
+		t.Errorf("got %q (%v) want %q", message, err, "event")
+	}
+}
+
+// TestSnapshotEncode проверяет перенос очередей через сериализованный снимок,
+// в том числе двоичных тел и настроек
+func TestSnapshotEncode(t *testing.T) {
+	qb := NewQueueBroker(100, 10, 10)
+	qb.Enqueue("jobs", &Message{Body: "job 1", Headers: map[string]string{"trace": "abc"}, GroupID: "g"})
+	qb.Enqueue("images", &Message{Body: "\xff\xd8binary", ContentType: "image/jpeg"})
+	qb.SetQueueConfig("jobs", QueueConfig{LockDuration: 45})
+
+	data, err := EncodeSnapshot(qb.Snapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap, err := DecodeSnapshot(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := NewQueueBroker(100, 10, 10)
+	if err := restored.Restore(snap); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := restored.Dequeue("images", 0)
+	if err != nil || msg.Body != "\xff\xd8binary" || msg.ContentType != "image/jpeg" {
+		t.Fatalf("binary body not restored: %+v, %v", msg, err)
+	}
+	msg, err = restored.Dequeue("jobs", 0)
+	if err != nil || msg.Body != "job 1" || msg.Headers["trace"] != "abc" || msg.GroupID != "g" {
+		t.Fatalf("message not restored: %+v, %v", msg, err)
+	}
+	if restored.QueueConfig("jobs").LockDuration != 45 {
+		t.Error("queue config not restored")
+	}
+
+	if _, err := DecodeSnapshot([]byte(`{"queues": [{"messages": []}]}`)); err == nil {
+		t.Error("queue without name should be rejected")
+	}
+}
+
+// TestSnapshotDelayed проверяет, что отложенное сообщение после
+// восстановления из снимка, в том числе сериализованного, выдается по
+// прежнему сроку
+func TestSnapshotDelayed(t *testing.T) {
+	qb := NewQueueBroker(100, 10, 10)
+	deliverAt := time.Now().Add(time.Hour)
+	qb.Enqueue("jobs", &Message{Body: "later", DeliverAt: deliverAt})
+	qb.Enqueue("jobs", &Message{Body: "now"})
+
+	data, err := EncodeSnapshot(qb.Snapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeSnapshot(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, snap := range map[string]*Snapshot{"snapshot": qb.Snapshot(), "encoded": decoded} {
+		restored := NewQueueBroker(100, 10, 10)
+		if err := restored.Restore(snap); err != nil {
+			t.Fatal(err)
+		}
+		if msg, err := restored.Dequeue("jobs", 0); err != nil || msg.Body != "now" {
+			t.Fatalf("%s: got %+v, %v", name, msg, err)
+		}
+		if msg, err := restored.Dequeue("jobs", 0); err == nil {
+			t.Errorf("%s: delayed message delivered early: %q", name, msg.Body)
+		}
+		if scheduled, _ := restored.Scheduled("jobs"); len(scheduled) != 1 || !scheduled[0].DeliverAt.Equal(deliverAt) {
+			t.Errorf("%s: delivery time lost: %+v", name, scheduled)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package broker
+
+import (
+	"context"
+	"log"
+	"net/url"
+)
+
+// Выгрузка на диск (OffloadConfig.SpillBytes): пока объем очереди в памяти
+// не больше порога, тела хранятся в ней; сверх порога тела самых старых
+// сообщений переносятся в хранилище вынесенных тел и заменяются ссылкой
+// (ClaimCheckHeader), как при выносе больших тел, пока объем не опустится
+// до половины порога. При выдаче тело загружается обратно (resolveBody),
+// поэтому для потребителей выгрузка незаметна.
+
+// spillState состояние выгрузки тел очереди
+type spillState struct {
+	// running тела очереди сейчас записываются в хранилище
+	running bool
+	// mark объем очереди после последней выгрузки; следующая начинается, когда
+	// объем вырастет на половину порога, — иначе очередь из мелких тел, которые
+	// не выгружаются, просматривалась бы при каждой постановке
+	mark int64
+}
+
+// spillCandidate сообщение, тело которого выгружается
+type spillCandidate struct {
+	stored *Message
+	key    string
+	body   []byte
+}
+
+// Spill выгружает тела сообщений всех очередей сверх OffloadConfig.SpillBytes,
+// например, после восстановления очередей при запуске. Новые сообщения
+// выгружаются при постановке.
+func (qb *QueueBroker) Spill() {
+	for _, info := range qb.Queues() {
+		qb.spill(info.Name)
+	}
+}
+
+// spill выгружает тела самых старых сообщений очереди, если ее объем больше
+// OffloadConfig.SpillBytes. Тела записываются в хранилище без блокировки
+// брокера; сообщение, выданное или удаленное за это время, не меняется.
+func (qb *QueueBroker) spill(queueName string) {
+	qb.mu.Lock()
+	store, cfg := qb.offloadStore, qb.offload
+	queue := qb.queues[queueName]
+	if store == nil || cfg.SpillBytes <= 0 || queue == nil || queueName == CanaryQueue {
+		qb.mu.Unlock()
+		return
+	}
+	state := qb.spills[queueName]
+	if state == nil {
+		state = &spillState{}
+		qb.spills[queueName] = state
+	}
+	size := qb.queueBytes[queueName]
+	if state.running || size <= cfg.SpillBytes || size >= state.mark && size-state.mark < cfg.SpillBytes/2 {
+		qb.mu.Unlock()
+		return
+	}
+	state.running = true
+	aead := qb.tenantCipherLocked(queueName)
+	excess := size - cfg.SpillBytes/2
+	var batch []spillCandidate
+	for _, stored := range queue.messages {
+		if excess <= 0 {
+			break
+		}
+		key := url.PathEscape(queueName) + "/" + newToken()
+		// Ссылка занимает место и в теле, и в заголовке: мелкие тела не выгружаются
+		saved := len(stored.Body) - 2*len(key) - len(ClaimCheckHeader)
+		if saved <= 0 || stored.Headers[ClaimCheckHeader] != "" {
+			continue
+		}
+		msg, err := qb.unpackLocked(stored)
+		if err != nil {
+			continue
+		}
+		body := []byte(msg.Body)
+		if aead != nil {
+			body = seal(aead, TenantOf(queueName), body)
+		}
+		batch = append(batch, spillCandidate{stored: stored, key: key, body: body})
+		excess -= int64(saved)
+	}
+	qb.mu.Unlock()
+
+	written := 0
+	for _, c := range batch {
+		if err := store.Put(context.Background(), c.key, c.body); err != nil {
+			log.Printf("spill: queue %s: %v", queueName, err)
+			break
+		}
+		written++
+	}
+
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	queued := make(map[*Message]bool, len(batch))
+	if queue := qb.queues[queueName]; queue != nil {
+		for _, stored := range queue.messages {
+			queued[stored] = true
+		}
+	}
+	refs, _ := store.(BlobRefCounter)
+	for _, c := range batch[:written] {
+		if !queued[c.stored] || c.stored.Headers[ClaimCheckHeader] != "" {
+			// Тело без ссылок освобождается хранилищем
+			if refs != nil {
+				refs.Retain(c.key)
+				refs.Release(c.key)
+			}
+			continue
+		}
+		stored := c.stored
+		before := storedSize(stored)
+		headers := make(map[string]string, len(stored.Headers)+1)
+		for k, v := range stored.Headers {
+			headers[k] = v
+		}
+		headers[ClaimCheckHeader] = c.key
+		stored.Headers = headers
+		stored.Body = c.key
+		stored.compression, stored.encrypted, stored.keyID = "", false, ""
+		delta := storedSize(stored) - before
+		qb.queueBytes[queueName] += delta
+		qb.totalBytes += delta
+		qb.retainBodyLocked(stored)
+	}
+	state.running = false
+	state.mark = qb.queueBytes[queueName]
+}
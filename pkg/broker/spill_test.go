@@ -0,0 +1,63 @@
+package broker
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestSpill проверяет выгрузку тел старых сообщений очереди сверх порога и их
+// загрузку обратно при выдаче
+func TestSpill(t *testing.T) {
+	qb := NewQueueBroker(1000, 10, 10)
+	blobs := &countingBlobs{memoryBlobs: memoryBlobs{objects: make(map[string][]byte)}, refs: make(map[string]int)}
+	qb.SetOffload(blobs, OffloadConfig{SpillBytes: 4096})
+	body := func(i int) string { return strconv.Itoa(i) + strings.Repeat("x", 200) }
+	// resident объем невыгруженных тел очереди
+	resident := func() (size int) {
+		qb.mu.Lock()
+		defer qb.mu.Unlock()
+		for _, stored := range qb.queues["jobs"].messages {
+			if stored.Headers[ClaimCheckHeader] == "" {
+				size += len(stored.Body)
+			}
+		}
+		return size
+	}
+
+	for i := range 100 {
+		if err := qb.PutMessage("jobs", body(i)); err != nil {
+			t.Fatal(err)
+		}
+		if size := resident(); size > 4096+256 {
+			t.Fatalf("message %d: %d bytes of bodies in memory", i, size)
+		}
+	}
+	// Мелкие тела остаются в памяти
+	qb.PutMessage("jobs", "small")
+	if len(blobs.objects) < 50 {
+		t.Errorf("bodies are not spilled: %d objects", len(blobs.objects))
+	}
+	// Новые сообщения остаются в памяти, выгружены самые старые
+	qb.mu.Lock()
+	first, last := qb.queues["jobs"].messages[0], qb.queues["jobs"].messages[99]
+	qb.mu.Unlock()
+	if first.Headers[ClaimCheckHeader] == "" || last.Headers[ClaimCheckHeader] != "" {
+		t.Errorf("unexpected spill order: first %v, last %v", first.Headers, last.Headers)
+	}
+
+	for i := range 100 {
+		msg, err := qb.Dequeue("jobs", 0)
+		if err != nil || msg.Body != body(i) || msg.Headers[ClaimCheckHeader] != "" {
+			t.Fatalf("message %d: got %.10q %v %v", i, msg.Body, msg.Headers, err)
+		}
+	}
+	if msg, _ := qb.Dequeue("jobs", 0); msg.Body != "small" {
+		t.Errorf("small message: got %q", msg.Body)
+	}
+	for key, n := range blobs.refs {
+		if n != 0 {
+			t.Errorf("body %s has %d refs after the queue is drained", key, n)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package broker
+
+import (
+	"math"
+	"slices"
+	"time"
+)
+
+// statsTick шаг, с которым пересчитываются скользящие средние скоростей
+const statsTick = 5 * time.Second
+
+// latencySamples сколько последних задержек выдачи очереди хранится для процентилей
+const latencySamples = 1024
+
+// rateWindows окна сглаживания скоростей (как у load average)
+var rateWindows = [3]time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute}
+
+// Rates число событий в секунду, экспоненциально сглаженное за 1, 5 и 15 минут
+type Rates struct {
+	M1  float64 `json:"m1"`
+	M5  float64 `json:"m5"`
+	M15 float64 `json:"m15"`
+}
+
+// Latency процентили задержки выдачи в миллисекундах по последним выдачам:
+// от постановки (у отложенного сообщения — от срока выдачи) до получения
+type Latency struct {
+	Samples int     `json:"samples"`
+	P50     float64 `json:"p50_ms"`
+	P90     float64 `json:"p90_ms"`
+	P99     float64 `json:"p99_ms"`
+	Max     float64 `json:"max_ms"`
+}
+
+// QueueStats статистика очереди
+type QueueStats struct {
+	Name     string `json:"name"`
+	Depth    int    `json:"depth"`
+	Delayed  int    `json:"delayed"`
+	InFlight int    `json:"in_flight"`
+	// OldestAge сколько ждет самое старое сообщение очереди в секундах (0 — очередь пуста)
+	OldestAge   float64 `json:"oldest_age_seconds"`
+	EnqueueRate Rates   `json:"enqueue_rate"`
+	DequeueRate Rates   `json:"dequeue_rate"`
+	Latency     Latency `json:"delivery_latency"`
+}
+
+// rateMeter скользящие средние скорости событий. Пересчет ленивый — при
+// записи и чтении, поэтому отдельная горутина не нужна.
+type rateMeter struct {
+	rates [3]float64
+	// pending события текущего шага
+	pending  int64
+	lastTick time.Time
+	started  bool
+}
+
+func (m *rateMeter) mark(now time.Time) {
+	m.tick(now)
+	m.pending++
+}
+
+// tick применяет к средним законченные шаги
+func (m *rateMeter) tick(now time.Time) {
+	if m.lastTick.IsZero() {
+		m.lastTick = now
+		return
+	}
+	steps := int64(now.Sub(m.lastTick) / statsTick)
+	if steps <= 0 {
+		return
+	}
+	instant := float64(m.pending) / statsTick.Seconds()
+	for i, window := range rateWindows {
+		if !m.started {
+			m.rates[i] = instant
+		} else {
+			m.rates[i] += (1 - math.Exp(-statsTick.Seconds()/window.Seconds())) * (instant - m.rates[i])
+		}
+		// Остальные шаги прошли без событий
+		m.rates[i] *= math.Exp(-float64(steps-1) * statsTick.Seconds() / window.Seconds())
+	}
+	m.started = true
+	m.pending = 0
+	m.lastTick = m.lastTick.Add(time.Duration(steps) * statsTick)
+}
+
+func (m *rateMeter) snapshot(now time.Time) Rates {
+	m.tick(now)
+	return Rates{M1: m.rates[0], M5: m.rates[1], M15: m.rates[2]}
+}
+
+// queueStats накопленная статистика очереди
+type queueStats struct {
+	enqueued, dequeued rateMeter
+	// latencies кольцевой буфер последних задержек выдачи
+	latencies []time.Duration
+	next      int
+}
+
+// statsLocked возвращает статистику очереди, создавая ее при первом обращении
+func (qb *QueueBroker) statsLocked(queueName string) *queueStats {
+	s := qb.stats[queueName]
+	if s == nil {
+		s = &queueStats{}
+		qb.stats[queueName] = s
+	}
+	return s
+}
+
+// recordEnqueueLocked учитывает постановку сообщения в очередь
+func (qb *QueueBroker) recordEnqueueLocked(queueName string) {
+	if queueName != CanaryQueue {
+		qb.statsLocked(queueName).enqueued.mark(time.Now())
+	}
+}
+
+// recordDequeueLocked учитывает выдачу сообщения и ее задержку
+func (qb *QueueBroker) recordDequeueLocked(queueName string, stored *Message) {
+	if queueName == CanaryQueue {
+		return
+	}
+	now := time.Now()
+	s := qb.statsLocked(queueName)
+	s.dequeued.mark(now)
+	ready := stored.enqueuedAt
+	if stored.DeliverAt.After(ready) {
+		ready = stored.DeliverAt
+	}
+	latency := max(now.Sub(ready), 0)
+	if len(s.latencies) < latencySamples {
+		s.latencies = append(s.latencies, latency)
+		return
+	}
+	s.latencies[s.next] = latency
+	s.next = (s.next + 1) % latencySamples
+}
+
+// Stats возвращает статистику очереди: глубину, скорости постановки и
+// выдачи, возраст самого старого сообщения и процентили задержки выдачи
+func (qb *QueueBroker) Stats(queueName string) (QueueStats, error) {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	queue := qb.queues[queueName]
+	if queue == nil || queueName == CanaryQueue {
+		return QueueStats{}, ErrQueueNotFound
+	}
+	now := time.Now()
+	stats := QueueStats{
+		Name:     queueName,
+		Depth:    queue.len(),
+		Delayed:  len(qb.delayed[queueName]),
+		InFlight: qb.inflight[queueName],
+	}
+	stats.OldestAge = oldestAge(queue, now).Seconds()
+	s := qb.statsLocked(queueName)
+	stats.EnqueueRate = s.enqueued.snapshot(now)
+	stats.DequeueRate = s.dequeued.snapshot(now)
+	stats.Latency = latencyPercentiles(s.latencies)
+	return stats, nil
+}
+
+// OldestAge возвращает, сколько ждет выдачи самое старое сообщение очереди
+// (0 — очередь пуста или не существует). Долго растущий возраст при
+// небольшой глубине обычно означает, что потребители очереди остановились.
+func (qb *QueueBroker) OldestAge(queueName string) time.Duration {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	if queue := qb.queues[queueName]; queue != nil {
+		return oldestAge(queue, time.Now())
+	}
+	return 0
+}
+
+// oldestAge возраст самого старого сообщения очереди. Обычно это первое
+// сообщение, но сообщения с приоритетом и возвращенные после блокировки
+// встают раньше более молодых, поэтому просматривается вся очередь.
+func oldestAge(queue *messageQueue, now time.Time) time.Duration {
+	var oldest time.Duration
+	for _, stored := range queue.messages {
+		oldest = max(oldest, now.Sub(stored.enqueuedAt))
+	}
+	return oldest
+}
+
+// latencyPercentiles вычисляет процентили по выборке задержек
+func latencyPercentiles(samples []time.Duration) Latency {
+	if len(samples) == 0 {
+		return Latency{}
+	}
+	sorted := slices.Clone(samples)
+	slices.Sort(sorted)
+	at := func(p float64) float64 {
+		i := int(math.Ceil(p*float64(len(sorted)))) - 1
+		return float64(sorted[max(i, 0)]) / float64(time.Millisecond)
+	}
+	return Latency{Samples: len(sorted), P50: at(0.5), P90: at(0.9), P99: at(0.99), Max: at(1)}
+}
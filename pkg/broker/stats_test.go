@@ -0,0 +1,91 @@
+package broker
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+// TestRateMeter проверяет скользящие средние скорости и их затухание без событий
+func TestRateMeter(t *testing.T) {
+	var m rateMeter
+	start := time.Now()
+	m.tick(start)
+	// 10 событий в секунду в течение первого шага
+	for range 50 {
+		m.mark(start.Add(time.Second))
+	}
+	rates := m.snapshot(start.Add(statsTick))
+	if rates.M1 != 10 || rates.M5 != 10 || rates.M15 != 10 {
+		t.Fatalf("unexpected first rates %+v", rates)
+	}
+	// Минута без событий: минутное среднее уменьшается в e раз, остальные медленнее
+	rates = m.snapshot(start.Add(statsTick + time.Minute))
+	if math.Abs(rates.M1-10/math.E) > 1e-9 {
+		t.Errorf("unexpected 1m rate %v", rates.M1)
+	}
+	if !(rates.M1 < rates.M5 && rates.M5 < rates.M15 && rates.M15 < 10) {
+		t.Errorf("unexpected decay %+v", rates)
+	}
+}
+
+// TestQueueStats проверяет глубину, возраст самого старого сообщения и задержку выдачи
+func TestQueueStats(t *testing.T) {
+	qb := NewQueueBroker(100, 10, 1)
+	if _, err := qb.Stats("jobs"); !errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("missing queue: got %v", err)
+	}
+	for _, body := range []string{"a", "b", "c"} {
+		if err := qb.Enqueue("jobs", &Message{Body: body}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, err := qb.GetMessage("jobs", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := qb.PeekLock("jobs", 0, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := qb.Stats("jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Name != "jobs" || stats.Depth != 1 || stats.InFlight != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if stats.OldestAge < 0.02 || stats.OldestAge > 5 {
+		t.Errorf("unexpected oldest age %v", stats.OldestAge)
+	}
+	if age := qb.OldestAge("jobs"); age < 20*time.Millisecond || qb.OldestAge("missing") != 0 {
+		t.Errorf("unexpected OldestAge %v", age)
+	}
+	if stats.Latency.Samples != 2 || stats.Latency.P50 < 20 || stats.Latency.Max < stats.Latency.P50 {
+		t.Errorf("unexpected latency %+v", stats.Latency)
+	}
+
+	if _, err := qb.GetMessage("jobs", 0); err != nil {
+		t.Fatal(err)
+	}
+	if stats, _ := qb.Stats("jobs"); stats.Depth != 0 || stats.OldestAge != 0 || stats.Latency.Samples != 3 {
+		t.Errorf("unexpected stats of empty queue %+v", stats)
+	}
+}
+
+// TestLatencyPercentiles проверяет процентили по выборке задержек
+func TestLatencyPercentiles(t *testing.T) {
+	var samples []time.Duration
+	for i := 100; i >= 1; i-- {
+		samples = append(samples, time.Duration(i)*time.Millisecond)
+	}
+	got := latencyPercentiles(samples)
+	want := Latency{Samples: 100, P50: 50, P90: 90, P99: 99, Max: 100}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if got := latencyPercentiles(nil); got != (Latency{}) {
+		t.Errorf("empty sample: got %+v", got)
+	}
+}
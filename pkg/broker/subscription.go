@@ -0,0 +1,189 @@
+package broker
+
+import (
+	"context"
+	"time"
+)
+
+// Subscription потоковый потребитель очереди: получает сообщения одно за другим,
+// пока не будет закрыт. Если у очереди задан AffinityHeader, сообщения с одинаковым
+// значением этого заголовка доставляются одному и тому же подключенному потребителю.
+type Subscription struct {
+	qb        *QueueBroker
+	queueName string
+	queue     *messageQueue
+	// mailbox сообщения, закрепленные за этим потребителем другими потребителями (под qb.mu)
+	mailbox []*Message
+	// wake сигнализирует о новом сообщении в mailbox
+	wake   chan struct{}
+	closed bool
+}
+
+// affinityState закрепление значений заголовка за потребителями очереди
+type affinityState struct {
+	owners map[string]*Subscription
+}
+
+// Subscribe регистрирует потокового потребителя очереди
+func (qb *QueueBroker) Subscribe(queueName string) (*Subscription, error) {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+
+	if err := qb.standbyLocked(queueName); err != nil {
+		return nil, err
+	}
+	queue, exists := qb.queues[queueName]
+	if !exists {
+		return nil, ErrQueueNotFound
+	}
+	if err := qb.attachConsumerLocked(queueName); err != nil {
+		return nil, err
+	}
+	return &Subscription{
+		qb:        qb,
+		queueName: queueName,
+		queue:     queue,
+		wake:      make(chan struct{}, 1),
+	}, nil
+}
+
+// Next ждет следующее сообщение, пока не будет отменен ctx
+func (s *Subscription) Next(ctx context.Context) (*Message, error) {
+	qb := s.qb
+	qb.mu.Lock()
+	var w *waiter
+	defer func() {
+		if w != nil {
+			qb.mu.Lock()
+			qb.removeWaiterLocked(s.queueName, w)
+			qb.mu.Unlock()
+		}
+	}()
+	for {
+		if w != nil {
+			w.signaled = false
+		}
+		// Очередь удалена (или удалена и создана заново)
+		if qb.queues[s.queueName] != s.queue {
+			qb.mu.Unlock()
+			return nil, ErrQueueNotFound
+		}
+		paused := qb.pausedLocked(s.queueName, time.Now())
+		if paused > 0 {
+			// Ожидающий нужен, чтобы Resume разбудил потребителя сразу
+			if w == nil {
+				w = qb.addWaiterLocked(s.queueName)
+			}
+			qb.mu.Unlock()
+			resume, stop := resumeTimer(paused)
+			select {
+			case <-resume:
+			case <-w.ready:
+			case <-s.wake:
+			case <-ctx.Done():
+				stop()
+				return nil, ctx.Err()
+			}
+			stop()
+			qb.mu.Lock()
+			continue
+		}
+		if len(s.mailbox) > 0 {
+			stored := s.mailbox[0]
+			s.mailbox = s.mailbox[1:]
+			qb.inflight[s.queueName]--
+			qb.releaseLocked(s.queueName, stored)
+			qb.mu.Unlock()
+			return qb.deliver(stored)
+		}
+		if qb.availableLocked(s.queueName, s.queue) {
+			if stored := qb.popLocked(s.queueName, s.queue); stored != nil {
+				forwarded := qb.forwardToOwnerLocked(s.queueName, s, stored)
+				if forwarded {
+					continue
+				}
+				qb.releaseLocked(s.queueName, stored)
+				qb.mu.Unlock()
+				return qb.deliver(stored)
+			}
+		}
+		if w == nil {
+			w = qb.addWaiterLocked(s.queueName)
+		}
+		qb.mu.Unlock()
+
+		select {
+		case <-w.ready:
+		case <-s.wake:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		qb.mu.Lock()
+	}
+}
+
+// Close отключает потребителя: закрепления снимаются, а переданные
+// ему, но еще не доставленные сообщения возвращаются в очередь
+func (s *Subscription) Close() {
+	qb := s.qb
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+	s.closed = true
+	qb.detachConsumerLocked(s.queueName)
+	if qb.queues[s.queueName] != s.queue {
+		s.mailbox = nil
+		return
+	}
+	if aff := qb.affinity[s.queueName]; aff != nil {
+		for key, owner := range aff.owners {
+			if owner == s {
+				delete(aff.owners, key)
+			}
+		}
+	}
+
+	for _, stored := range s.mailbox {
+		s.queue.push(stored)
+		qb.inflight[s.queueName]--
+	}
+	s.mailbox = nil
+}
+
+// forwardToOwnerLocked передает сообщение потребителю, за которым закреплено значение
+// заголовка сродства. Возвращает false, если сообщение должен получить self
+// (для обычного GET self равен nil и закрепление не создается).
+func (qb *QueueBroker) forwardToOwnerLocked(queueName string, self *Subscription, stored *Message) bool {
+	header := qb.queueConfigLocked(queueName).AffinityHeader
+	if header == "" {
+		return false
+	}
+	key := stored.Headers[header]
+	if key == "" {
+		return false
+	}
+
+	aff := qb.affinity[queueName]
+	if aff == nil {
+		aff = &affinityState{owners: make(map[string]*Subscription)}
+		qb.affinity[queueName] = aff
+	}
+
+	owner := aff.owners[key]
+	if owner != nil && owner != self && !owner.closed {
+		owner.mailbox = append(owner.mailbox, stored)
+		qb.inflight[queueName]++
+		select {
+		case owner.wake <- struct{}{}:
+		default:
+		}
+		return true
+	}
+	if self != nil {
+		aff.owners[key] = self
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package broker
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func entityMessage(body, entity string) *Message {
+	return &Message{Body: body, Headers: map[string]string{"entity": entity}}
+}
+
+// TestSubscriptionAffinity проверяет закрепление значения заголовка за потребителем
+func TestSubscriptionAffinity(t *testing.T) {
+	qb := NewQueueBroker(100, 10, 10)
+	qb.SetQueueConfig("events", QueueConfig{LockDuration: 30, AffinityHeader: "entity"})
+	qb.Enqueue("events", entityMessage("e1-first", "e1"))
+
+	a, err := qb.Subscribe("events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b, _ := qb.Subscribe("events")
+	defer b.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if msg, err := a.Next(ctx); err != nil || msg.Body != "e1-first" {
+		t.Fatalf("unexpected message for a: %v %v", msg, err)
+	}
+
+	// b забирает из очереди сообщение e1, но оно передается a
+	qb.Enqueue("events", entityMessage("e1-second", "e1"))
+	qb.Enqueue("events", entityMessage("e2-first", "e2"))
+	if msg, err := b.Next(ctx); err != nil || msg.Body != "e2-first" {
+		t.Fatalf("unexpected message for b: %v %v", msg, err)
+	}
+	if msg, err := a.Next(ctx); err != nil || msg.Body != "e1-second" {
+		t.Fatalf("message was not delivered to the affine consumer: %v %v", msg, err)
+	}
+
+	// Обычный GET тоже не забирает закрепленные сообщения
+	qb.Enqueue("events", entityMessage("e2-second", "e2"))
+	if msg, err := qb.Dequeue("events", time.Second); err == nil {
+		t.Fatalf("plain GET received an affine message: %v", msg)
+	}
+	if msg, err := b.Next(ctx); err != nil || msg.Body != "e2-second" {
+		t.Fatalf("unexpected message for b: %v %v", msg, err)
+	}
+}
+
+// TestSubscriptionCloseReleasesMessages проверяет возврат закрепленных сообщений при отключении
+func TestSubscriptionCloseReleasesMessages(t *testing.T) {
+	qb := NewQueueBroker(100, 10, 10)
+	qb.SetQueueConfig("events", QueueConfig{LockDuration: 30, AffinityHeader: "entity"})
+	qb.Enqueue("events", entityMessage("first", "e1"))
+
+	a, _ := qb.Subscribe("events")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	a.Next(ctx)
+
+	qb.Enqueue("events", entityMessage("second", "e1"))
+	qb.Dequeue("events", time.Second) // передает сообщение в почтовый ящик a
+	a.Close()
+
+	message, err := qb.GetMessage("events", time.Second)
+	if err != nil || message != "second" {
+		t.Errorf("message of the closed consumer was not returned: %q %v", message, err)
+	}
+}
@@ -0,0 +1,83 @@
+package broker
+
+import "sync"
+
+// tapBufferSize сколько сообщений копится для медленного наблюдателя;
+// при переполнении новые сообщения пропускаются
+const tapBufferSize = 100
+
+// Tap наблюдатель очереди: получает копии сообщений, поставленных в очередь
+// после подключения, не извлекая их. Сообщения, поставленные до подключения,
+// не передаются.
+type Tap struct {
+	// C копии поставленных сообщений; закрывается после Close
+	C <-chan *Message
+
+	qb      *QueueBroker
+	pattern string
+	ch      chan *Message
+
+	mu      sync.Mutex
+	dropped int
+}
+
+// Tap подключает наблюдателя к очереди; имя может быть шаблоном (orders.*)
+func (qb *QueueBroker) Tap(queueName string) (*Tap, error) {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+
+	if err := qb.standbyLocked(queueName); err != nil {
+		return nil, err
+	}
+	if !IsPattern(queueName) && qb.queues[queueName] == nil {
+		return nil, ErrQueueNotFound
+	}
+	tap := &Tap{qb: qb, pattern: queueName, ch: make(chan *Message, tapBufferSize)}
+	tap.C = tap.ch
+	qb.taps[tap] = struct{}{}
+	return tap, nil
+}
+
+// Close отключает наблюдателя
+func (t *Tap) Close() {
+	qb := t.qb
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	if _, ok := qb.taps[t]; ok {
+		delete(qb.taps, t)
+		close(t.ch)
+	}
+}
+
+// Dropped возвращает число сообщений, пропущенных из-за переполнения буфера
+func (t *Tap) Dropped() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.dropped
+}
+
+// notifyTapsLocked передает копию поставленного сообщения наблюдателям очереди
+func (qb *QueueBroker) notifyTapsLocked(queueName string, msg *Message) {
+	for tap := range qb.taps {
+		if tap.pattern != queueName && !(IsPattern(tap.pattern) && MatchPattern(tap.pattern, queueName)) {
+			continue
+		}
+		copied := &Message{Body: msg.Body, DedupID: msg.DedupID, ContentType: msg.ContentType, Queue: queueName, GroupID: msg.GroupID}
+		if copied.ContentType == "" {
+			copied.ContentType = qb.queueConfigLocked(queueName).DefaultContentType
+		}
+		if len(msg.Headers) > 0 {
+			copied.Headers = make(map[string]string, len(msg.Headers))
+			for k, v := range msg.Headers {
+				copied.Headers[k] = v
+			}
+		}
+		select {
+		case tap.ch <- copied:
+		default:
+			tap.mu.Lock()
+			tap.dropped++
+			tap.mu.Unlock()
+		}
+	}
+}
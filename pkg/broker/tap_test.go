@@ -0,0 +1,57 @@
+package broker
+
+import (
+	"testing"
+	"time"
+)
+
+// TestTap проверяет получение копий новых сообщений без извлечения из очереди
+func TestTap(t *testing.T) {
+	qb := NewQueueBroker(200, 10, 1)
+	if _, err := qb.Tap("orders.eu"); err == nil {
+		t.Error("expected error for missing queue")
+	}
+	qb.Enqueue("orders.eu", &Message{Body: "before"})
+
+	tap, err := qb.Tap("orders.eu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pattern, err := qb.Tap("orders.*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	qb.Enqueue("orders.eu", &Message{Body: "after", Headers: map[string]string{"k": "v"}})
+	qb.Enqueue("orders.us", &Message{Body: "us"})
+
+	select {
+	case msg := <-tap.C:
+		if msg.Body != "after" || msg.Headers["k"] != "v" || msg.Queue != "orders.eu" {
+			t.Errorf("unexpected copy: %+v", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("tap received nothing")
+	}
+	if len(tap.C) != 0 {
+		t.Errorf("tap received messages of other queues")
+	}
+	if len(pattern.C) != 2 {
+		t.Errorf("expected 2 messages for pattern tap, got %d", len(pattern.C))
+	}
+	if qb.Depth("orders.eu") != 2 {
+		t.Errorf("tap consumed messages")
+	}
+
+	// Переполненный наблюдатель не задерживает постановку
+	for i := 0; i < tapBufferSize+5; i++ {
+		qb.Enqueue("orders.us", &Message{Body: "x"})
+	}
+	if pattern.Dropped() != 7 {
+		t.Errorf("expected 7 dropped messages, got %d", pattern.Dropped())
+	}
+	tap.Close()
+	pattern.Close()
+	if _, ok := <-tap.C; ok {
+		t.Error("tap channel is not closed")
+	}
+}
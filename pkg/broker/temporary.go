@@ -0,0 +1,71 @@
+package broker
+
+import "strings"
+
+// TemporaryQueuePrefix начало имен временных очередей. Такие очереди
+// создаются только CreateTemporaryQueue: постановка в несуществующую
+// временную очередь (например, ответ на запрос, клиент которого уже ушел)
+// не создает ее заново.
+const TemporaryQueuePrefix = "tmp."
+
+// ReplyToHeader заголовок сообщения-запроса с очередью для ответа
+const ReplyToHeader = "reply_to"
+
+// defaultTemporaryIdle через сколько минут простоя временная очередь удаляется
+const defaultTemporaryIdle = 5
+
+// IsTemporaryQueue сообщает, что имя (без префикса арендатора) — имя временной очереди
+func IsTemporaryQueue(queueName string) bool {
+	return strings.HasPrefix(TrimTenant(queueName), TemporaryQueuePrefix)
+}
+
+// NewTemporaryQueueName возвращает уникальное имя для временной очереди
+func NewTemporaryQueueName() string {
+	return TemporaryQueuePrefix + newToken()
+}
+
+// CreateTemporaryQueue создает временную очередь для ответов (см.
+// NewTemporaryQueueName), которая удаляется после idleMinutes минут без
+// обращений (0 — 5 минут). Очередь закрепляется за owner: получать из нее
+// сообщения может только он, а ставить ответы — любой клиент. Без owner
+// очередь доступна всем, кто знает ее имя.
+func (qb *QueueBroker) CreateTemporaryQueue(queueName, owner string, idleMinutes int) error {
+	if !IsTemporaryQueue(queueName) || IsPattern(queueName) {
+		return ErrInvalidQueueName
+	}
+	if idleMinutes <= 0 {
+		idleMinutes = defaultTemporaryIdle
+	}
+	qb.mu.Lock()
+	if err := qb.standbyLocked(queueName); err != nil {
+		qb.mu.Unlock()
+		return err
+	}
+	if qb.queues[queueName] != nil {
+		qb.mu.Unlock()
+		return ErrInvalidQueueName
+	}
+	if count := qb.userQueueCountLocked(); count >= qb.maxQueues {
+		qb.mu.Unlock()
+		return &CapacityError{Err: ErrTooManyQueues, Queue: queueName, Used: int64(count), Limit: int64(qb.maxQueues), Unit: "queues"}
+	}
+	if err := qb.tenantQueueQuotaLocked(queueName); err != nil {
+		qb.mu.Unlock()
+		return err
+	}
+	qb.queues[queueName] = qb.newQueueLocked(queueName)
+	qb.index.add(queueName)
+	cfg := qb.defaultQueueConfig()
+	cfg.AutoDeleteAfterIdle = idleMinutes
+	qb.configs[queueName] = &cfg
+	if owner != "" {
+		acl := &QueueACL{Owner: owner, Produce: []string{Everyone}}
+		qb.acls[queueName] = acl
+		qb.auditLocked(owner, queueName, "create_temporary", nil, acl)
+	}
+	qb.touchLocked(queueName)
+	qb.mu.Unlock()
+
+	qb.notifyQueueListeners(QueueCreated, queueName)
+	return nil
+}
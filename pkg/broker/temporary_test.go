@@ -0,0 +1,58 @@
+package broker
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestTemporaryQueue проверяет создание и права временной очереди
+func TestTemporaryQueue(t *testing.T) {
+	qb := NewQueueBroker(10, 10, 10)
+	name := NewTemporaryQueueName()
+	if !strings.HasPrefix(name, TemporaryQueuePrefix) || name == NewTemporaryQueueName() {
+		t.Fatalf("unexpected name %q", name)
+	}
+	if err := qb.CreateTemporaryQueue(name, "client", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := qb.CreateTemporaryQueue(name, "client", 0); !errors.Is(err, ErrInvalidQueueName) {
+		t.Errorf("expected ErrInvalidQueueName for existing queue, got %v", err)
+	}
+	if err := qb.CreateTemporaryQueue("replies", "client", 0); !errors.Is(err, ErrInvalidQueueName) {
+		t.Errorf("expected ErrInvalidQueueName for regular name, got %v", err)
+	}
+	if got := qb.QueueConfig(name).AutoDeleteAfterIdle; got != defaultTemporaryIdle {
+		t.Errorf("unexpected idle timeout %d", got)
+	}
+
+	// Ответ может поставить любой, получить — только создатель
+	if !qb.Authorize("worker", name, PermProduce) || qb.Authorize("worker", name, PermConsume) {
+		t.Error("unexpected permissions for other principal")
+	}
+	if !qb.Authorize("client", name, PermConsume) {
+		t.Error("owner cannot consume")
+	}
+
+	// Удаленная временная очередь не создается ответом заново
+	if err := qb.DeleteQueue(name); err != nil {
+		t.Fatal(err)
+	}
+	if err := qb.PutMessage(name, "late reply"); !errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("expected ErrQueueNotFound, got %v", err)
+	}
+}
+
+// TestReplyToHeader проверяет проверку заголовка reply_to
+func TestReplyToHeader(t *testing.T) {
+	qb := NewQueueBroker(10, 10, 10)
+	for _, replyTo := range []string{"", "replies.*"} {
+		err := qb.Enqueue("requests", &Message{Body: "x", Headers: map[string]string{ReplyToHeader: replyTo}})
+		if !errors.Is(err, ErrInvalidReplyTo) {
+			t.Errorf("%q: expected ErrInvalidReplyTo, got %v", replyTo, err)
+		}
+	}
+	if err := qb.Enqueue("requests", &Message{Body: "x", Headers: map[string]string{ReplyToHeader: "tmp.abc"}}); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,247 @@
+package broker
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// В многоарендном режиме очереди арендатора хранятся под именами вида
+// @acme.orders. Первый токен с "@" зарезервирован: арендатор не может указать
+// его сам, поэтому имена очередей разных арендаторов не пересекаются.
+
+// tenantPrefix начало имени очереди арендатора
+const tenantPrefix = "@"
+
+var tenantIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// Tenant арендатор брокера
+type Tenant struct {
+	ID string `json:"id"`
+	// Key ключ AES-256 (32 байта), которым шифруются тела сообщений арендатора
+	Key []byte `json:"key"`
+	// Token секрет, по которому запросы HTTP API относятся к арендатору
+	Token string `json:"token"`
+	// Tokens дополнительные секреты арендатора (например, отдельные ключи команд
+	// или новый ключ на время смены старого)
+	Tokens []string `json:"tokens,omitempty"`
+	// Quota ограничения ресурсов арендатора
+	Quota TenantQuota `json:"quota"`
+}
+
+// TenantQuota ограничения ресурсов арендатора (0 — без ограничения). Сообщения
+// и объем учитываются вместе с выданными, но не подтвержденными сообщениями.
+type TenantQuota struct {
+	MaxQueues   int   `json:"max_queues"`
+	MaxMessages int   `json:"max_messages"`
+	MaxBytes    int64 `json:"max_bytes"`
+}
+
+// TenantUsage текущее потребление ресурсов арендатора
+type TenantUsage struct {
+	Queues   int   `json:"queues"`
+	Messages int   `json:"messages"`
+	Bytes    int64 `json:"bytes"`
+}
+
+// tenant зарегистрированный арендатор
+type tenant struct {
+	id     string
+	aead   cipher.AEAD
+	tokens []string
+	quota  TenantQuota
+}
+
+// AddTenant регистрирует арендатора и включает многоарендный режим
+func (qb *QueueBroker) AddTenant(t Tenant) error {
+	if !tenantIDPattern.MatchString(t.ID) {
+		return fmt.Errorf("invalid tenant id %q", t.ID)
+	}
+	if len(t.Key) != 32 {
+		return fmt.Errorf("tenant %s: key must be 32 bytes", t.ID)
+	}
+	tokens := append([]string{t.Token}, t.Tokens...)
+	for _, token := range tokens {
+		if token == "" {
+			return fmt.Errorf("tenant %s: empty token", t.ID)
+		}
+	}
+	block, err := aes.NewCipher(t.Key)
+	if err != nil {
+		return err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	for _, other := range qb.tenants {
+		if other.id == t.ID {
+			continue
+		}
+		for _, token := range tokens {
+			if slices.Contains(other.tokens, token) {
+				return fmt.Errorf("tenant %s: token already used by another tenant", t.ID)
+			}
+		}
+	}
+	qb.tenants[t.ID] = &tenant{id: t.ID, aead: aead, tokens: tokens, quota: t.Quota}
+	return nil
+}
+
+// Tenants возвращает идентификаторы зарегистрированных арендаторов
+func (qb *QueueBroker) Tenants() []string {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	ids := make([]string, 0, len(qb.tenants))
+	for id := range qb.tenants {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// HasTenant сообщает, зарегистрирован ли арендатор
+func (qb *QueueBroker) HasTenant(tenantID string) bool {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	return qb.tenants[tenantID] != nil
+}
+
+// TenantUsage возвращает потребление ресурсов арендатора
+func (qb *QueueBroker) TenantUsage(tenantID string) TenantUsage {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	return qb.tenantUsageLocked(tenantID)
+}
+
+func (qb *QueueBroker) tenantUsageLocked(tenantID string) TenantUsage {
+	var usage TenantUsage
+	for name, queue := range qb.queues {
+		if TenantOf(name) != tenantID {
+			continue
+		}
+		usage.Queues++
+		usage.Messages += queue.len() + qb.inflight[name] + len(qb.delayed[name])
+		usage.Bytes += qb.queueBytes[name]
+	}
+	return usage
+}
+
+// tenantQueueQuotaLocked проверяет, может ли арендатор создать еще одну очередь
+func (qb *QueueBroker) tenantQueueQuotaLocked(queueName string) error {
+	t := qb.tenants[TenantOf(queueName)]
+	if t == nil || t.quota.MaxQueues <= 0 {
+		return nil
+	}
+	if queues := qb.tenantUsageLocked(t.id).Queues; queues >= t.quota.MaxQueues {
+		return &CapacityError{Err: ErrTenantQueueLimit, Queue: queueName, Used: int64(queues), Limit: int64(t.quota.MaxQueues), Unit: "queues"}
+	}
+	return nil
+}
+
+// tenantMessageQuotaLocked проверяет, помещается ли сообщение размером size
+// в квоты арендатора очереди
+func (qb *QueueBroker) tenantMessageQuotaLocked(queueName string, size int64) error {
+	t := qb.tenants[TenantOf(queueName)]
+	if t == nil || (t.quota.MaxMessages <= 0 && t.quota.MaxBytes <= 0) {
+		return nil
+	}
+	usage := qb.tenantUsageLocked(t.id)
+	if t.quota.MaxMessages > 0 && usage.Messages >= t.quota.MaxMessages {
+		return &CapacityError{Err: ErrTenantMessageLimit, Queue: queueName, Used: int64(usage.Messages), Limit: int64(t.quota.MaxMessages), Unit: "messages"}
+	}
+	if t.quota.MaxBytes > 0 && usage.Bytes+size > t.quota.MaxBytes {
+		return &CapacityError{Err: ErrTenantByteLimit, Queue: queueName, Used: usage.Bytes, Limit: t.quota.MaxBytes, Unit: "bytes"}
+	}
+	return nil
+}
+
+// MultiTenant сообщает, зарегистрирован ли хотя бы один арендатор
+func (qb *QueueBroker) MultiTenant() bool {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	return len(qb.tenants) > 0
+}
+
+// TenantByToken возвращает арендатора, которому принадлежит токен
+func (qb *QueueBroker) TenantByToken(token string) (string, bool) {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	for _, t := range qb.tenants {
+		for _, candidate := range t.tokens {
+			if subtle.ConstantTimeCompare([]byte(candidate), []byte(token)) == 1 {
+				return t.id, true
+			}
+		}
+	}
+	return "", false
+}
+
+// TenantQueueName возвращает внутреннее имя очереди арендатора
+func TenantQueueName(tenantID, queueName string) (string, error) {
+	if queueName == "" || strings.HasPrefix(queueName, tenantPrefix) {
+		return "", ErrInvalidQueueName
+	}
+	return tenantPrefix + tenantID + "." + queueName, nil
+}
+
+// TenantOf возвращает арендатора, которому принадлежит очередь
+// (пустую строку для очередей вне арендаторов)
+func TenantOf(queueName string) string {
+	if !strings.HasPrefix(queueName, tenantPrefix) {
+		return ""
+	}
+	id, _, _ := strings.Cut(queueName[len(tenantPrefix):], ".")
+	return id
+}
+
+// TrimTenant возвращает имя очереди без префикса арендатора
+func TrimTenant(queueName string) string {
+	if tenantID := TenantOf(queueName); tenantID != "" {
+		return strings.TrimPrefix(queueName, tenantPrefix+tenantID+".")
+	}
+	return queueName
+}
+
+// tenantCipherLocked возвращает шифр арендатора очереди или nil
+func (qb *QueueBroker) tenantCipherLocked(queueName string) cipher.AEAD {
+	if t := qb.tenants[TenantOf(queueName)]; t != nil {
+		return t.aead
+	}
+	return nil
+}
+
+func (qb *QueueBroker) tenantCipher(queueName string) cipher.AEAD {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	return qb.tenantCipherLocked(queueName)
+}
+
+// seal шифрует данные; идентификатор арендатора привязывается к шифротексту,
+// поэтому данные одного арендатора не расшифровываются ключом другого
+func seal(aead cipher.AEAD, tenantID string, plain []byte) []byte {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plain)+aead.Overhead())
+	rand.Read(nonce)
+	return aead.Seal(nonce, nonce, plain, []byte(tenantID))
+}
+
+func open(aead cipher.AEAD, tenantID string, sealed []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("decrypt message: ciphertext too short")
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(tenantID))
+	if err != nil {
+		return nil, fmt.Errorf("decrypt message: %w", err)
+	}
+	return plain, nil
+}
@@ -0,0 +1,195 @@
+package broker
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func newTenantBroker(t *testing.T) *QueueBroker {
+	t.Helper()
+	qb := NewQueueBroker(10, 10, 1)
+	for _, tenant := range []Tenant{
+		{ID: "acme", Key: bytes.Repeat([]byte{1}, 32), Token: "acme-token"},
+		{ID: "globex", Key: bytes.Repeat([]byte{2}, 32), Token: "globex-token"},
+	} {
+		if err := qb.AddTenant(tenant); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return qb
+}
+
+// TestTenantEncryptionAtRest проверяет, что тело хранится зашифрованным
+// и прозрачно расшифровывается при выдаче
+func TestTenantEncryptionAtRest(t *testing.T) {
+	qb := newTenantBroker(t)
+	qb.SetDefaultCompressThreshold(10)
+	name, _ := TenantQueueName("acme", "orders")
+	body := strings.Repeat("secret order ", 20)
+	if err := qb.Enqueue(name, &Message{Body: body}); err != nil {
+		t.Fatal(err)
+	}
+
+	qb.mu.Lock()
+	stored := qb.queues[name].messages[0]
+	qb.mu.Unlock()
+	if !stored.encrypted || strings.Contains(stored.Body, "secret") {
+		t.Fatalf("message body is stored in plaintext")
+	}
+
+	msg, err := qb.Dequeue(name, 0)
+	if err != nil || msg.Body != body {
+		t.Fatalf("unexpected message %q, %v", msg.Body, err)
+	}
+}
+
+func TestTenantSnapshotStaysEncrypted(t *testing.T) {
+	qb := newTenantBroker(t)
+	name, _ := TenantQueueName("acme", "orders")
+	qb.Enqueue(name, &Message{Body: "secret"})
+	qb.PutMessage("public", "hello")
+
+	snap := qb.Snapshot()
+	for _, qs := range snap.Queues {
+		if qs.Name == name && (!qs.Encrypted || qs.Messages[0].Body == "secret") {
+			t.Errorf("tenant queue is not encrypted in snapshot: %+v", qs)
+		}
+		if qs.Name == "public" && (qs.Encrypted || qs.Messages[0].Body != "hello") {
+			t.Errorf("unexpected public queue in snapshot: %+v", qs)
+		}
+	}
+
+	// Без ключа арендатора снимок не восстанавливается
+	if err := NewQueueBroker(10, 10, 1).Restore(snap); err == nil {
+		t.Error("expected restore without tenant key to fail")
+	}
+	restored := newTenantBroker(t)
+	if err := restored.Restore(snap); err != nil {
+		t.Fatal(err)
+	}
+	if msg, err := restored.Dequeue(name, 0); err != nil || msg.Body != "secret" {
+		t.Errorf("unexpected restored message %+v, %v", msg, err)
+	}
+}
+
+func TestTenantKeyBoundToTenant(t *testing.T) {
+	qb := newTenantBroker(t)
+	name, _ := TenantQueueName("acme", "orders")
+	qb.Enqueue(name, &Message{Body: "secret"})
+	snap := qb.Snapshot()
+
+	// Очередь acme, подмененная на globex, не расшифровывается ключом globex
+	snap.Queues[0].Name, _ = TenantQueueName("globex", "orders")
+	if err := newTenantBroker(t).Restore(snap); err == nil {
+		t.Error("expected ciphertext of one tenant to be rejected for another")
+	}
+}
+
+func TestTenantIsolation(t *testing.T) {
+	qb := newTenantBroker(t)
+	acme, _ := TenantQueueName("acme", "orders")
+	globex, _ := TenantQueueName("globex", "orders")
+	qb.Enqueue(acme, &Message{Body: "acme order"})
+	qb.PutMessage("orders", "public order")
+
+	if _, err := TenantQueueName("acme", "@globex.orders"); err == nil {
+		t.Error("expected reserved prefix to be rejected")
+	}
+	if _, err := qb.Dequeue(globex, 0); err == nil {
+		t.Error("queues with the same name must not be shared between tenants")
+	}
+	if msg, err := qb.Dequeue(">", 0); err != nil || msg.Body != "public order" {
+		t.Errorf("pattern outside tenants matched a tenant queue: %+v %v", msg, err)
+	}
+	if _, err := qb.Dequeue(">", 0); err == nil {
+		t.Error("pattern outside tenants matched a tenant queue")
+	}
+
+	router, _ := NewRouter([]*RoutingRule{{Script: `"orders"`}})
+	qb.SetRouter(router)
+	if err := qb.Enqueue(acme, &Message{Body: "escape"}); err == nil || !strings.Contains(err.Error(), "cross-tenant") {
+		t.Errorf("expected cross-tenant routing to be rejected, got %v", err)
+	}
+}
+
+func TestAddTenantValidation(t *testing.T) {
+	qb := newTenantBroker(t)
+	for _, tenant := range []Tenant{
+		{ID: "Bad.ID", Key: make([]byte, 32), Token: "x"},
+		{ID: "short", Key: make([]byte, 16), Token: "x"},
+		{ID: "notoken", Key: make([]byte, 32)},
+		{ID: "dup", Key: make([]byte, 32), Token: "acme-token"},
+	} {
+		if err := qb.AddTenant(tenant); err == nil {
+			t.Errorf("expected tenant %q to be rejected", tenant.ID)
+		}
+	}
+}
+
+// TestTenantQuota проверяет квоты арендатора на очереди, сообщения и объем
+func TestTenantQuota(t *testing.T) {
+	qb := NewQueueBroker(10, 10, 1)
+	err := qb.AddTenant(Tenant{ID: "acme", Key: make([]byte, 32), Token: "acme-token", Quota: TenantQuota{MaxQueues: 2, MaxMessages: 3, MaxBytes: 100}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue := func(name string) string {
+		internal, _ := TenantQueueName("acme", name)
+		return internal
+	}
+
+	for _, name := range []string{"a", "b"} {
+		if err := qb.Enqueue(queue(name), &Message{Body: "x"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := qb.Enqueue(queue("c"), &Message{Body: "x"}); !errors.Is(err, ErrTenantQueueLimit) {
+		t.Errorf("expected tenant queue limit, got %v", err)
+	}
+	// Очереди вне арендатора квотой не ограничиваются
+	if err := qb.Enqueue("c", &Message{Body: "x"}); err != nil {
+		t.Errorf("queue outside tenants rejected: %v", err)
+	}
+
+	if err := qb.Enqueue(queue("a"), &Message{Body: strings.Repeat("x", 200)}); !errors.Is(err, ErrTenantByteLimit) {
+		t.Errorf("expected tenant byte limit, got %v", err)
+	}
+	if err := qb.Enqueue(queue("a"), &Message{Body: "x"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := qb.Enqueue(queue("b"), &Message{Body: "x"}); !errors.Is(err, ErrTenantMessageLimit) {
+		t.Errorf("expected tenant message limit, got %v", err)
+	}
+	if usage := qb.TenantUsage("acme"); usage.Queues != 2 || usage.Messages != 3 {
+		t.Errorf("unexpected usage %+v", usage)
+	}
+
+	// Выданное сообщение освобождает место в квоте
+	if _, err := qb.Dequeue(queue("a"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := qb.Enqueue(queue("b"), &Message{Body: "x"}); err != nil {
+		t.Errorf("enqueue after dequeue failed: %v", err)
+	}
+}
+
+// TestTenantTokens проверяет дополнительные токены арендатора
+func TestTenantTokens(t *testing.T) {
+	qb := newTenantBroker(t)
+	if err := qb.AddTenant(Tenant{ID: "initech", Key: make([]byte, 32), Token: "main", Tokens: []string{"team-a", "team-b"}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range []string{"main", "team-a", "team-b"} {
+		if id, ok := qb.TenantByToken(token); !ok || id != "initech" {
+			t.Errorf("token %q resolved to %q %v", token, id, ok)
+		}
+	}
+	if err := qb.AddTenant(Tenant{ID: "other", Key: make([]byte, 32), Token: "x", Tokens: []string{"team-a"}}); err == nil {
+		t.Error("expected token of another tenant to be rejected")
+	}
+	if err := qb.AddTenant(Tenant{ID: "other", Key: make([]byte, 32), Token: "x", Tokens: []string{""}}); err == nil {
+		t.Error("expected empty extra token to be rejected")
+	}
+}
@@ -0,0 +1,64 @@
+package broker
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+// ErrInvalidTimeout время ожидания не число секунд и не длительность Go
+var ErrInvalidTimeout = errors.New("invalid timeout")
+
+// ParseTimeout разбирает время ожидания: целое число секунд ("5") или
+// длительность Go ("250ms", "2m"). Отрицательные значения не принимаются.
+func ParseTimeout(s string) (time.Duration, error) {
+	if seconds, err := strconv.Atoi(s); err == nil {
+		if seconds < 0 {
+			return 0, ErrInvalidTimeout
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+	timeout, err := time.ParseDuration(s)
+	if err != nil || timeout < 0 {
+		return 0, ErrInvalidTimeout
+	}
+	return timeout, nil
+}
+
+// SetDefaultTimeout задает ожидание сообщения для запросов, в которых оно не указано
+func (qb *QueueBroker) SetDefaultTimeout(timeout time.Duration) {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	qb.defaultTimeout = timeout
+}
+
+// DefaultTimeout возвращает ожидание сообщения по умолчанию
+func (qb *QueueBroker) DefaultTimeout() time.Duration {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	return qb.defaultTimeout
+}
+
+// SetMaxTimeout ограничивает ожидание сообщения одним получателем: запросы с
+// большим timeout ждут не дольше limit, чтобы клиент не мог удерживать
+// соединение бесконечно. 0 — без ограничения.
+func (qb *QueueBroker) SetMaxTimeout(limit time.Duration) {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	qb.maxTimeout = limit
+}
+
+// MaxTimeout возвращает предельное ожидание сообщения (0 — без ограничения)
+func (qb *QueueBroker) MaxTimeout() time.Duration {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	return qb.maxTimeout
+}
+
+// waitLimit возвращает, сколько получатель с timeout ждет на самом деле
+func (qb *QueueBroker) waitLimit(timeout time.Duration) time.Duration {
+	if limit := qb.MaxTimeout(); limit > 0 && timeout > limit {
+		return limit
+	}
+	return timeout
+}
@@ -0,0 +1,69 @@
+package broker
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestParseTimeout проверяет разбор времени ожидания в секундах и длительностью Go
+func TestParseTimeout(t *testing.T) {
+	cases := []struct {
+		in   string
+		want time.Duration
+		fail bool
+	}{
+		{in: "0"},
+		{in: "5", want: 5 * time.Second},
+		{in: "250ms", want: 250 * time.Millisecond},
+		{in: "2m", want: 2 * time.Minute},
+		{in: "-1", fail: true},
+		{in: "-5s", fail: true},
+		{in: "soon", fail: true},
+		{in: "", fail: true},
+	}
+	for _, tc := range cases {
+		got, err := ParseTimeout(tc.in)
+		if tc.fail {
+			if !errors.Is(err, ErrInvalidTimeout) {
+				t.Errorf("%q: expected ErrInvalidTimeout, got %v", tc.in, err)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("%q: got %v %v, want %v", tc.in, got, err, tc.want)
+		}
+	}
+}
+
+// TestMaxTimeout проверяет ожидание с точностью до миллисекунд и его предел
+func TestMaxTimeout(t *testing.T) {
+	qb := NewQueueBroker(100, 10, 10)
+	qb.PutMessage("jobs.a", "x")
+	qb.GetMessage("jobs.a", 0)
+
+	start := time.Now()
+	if _, err := qb.Dequeue("jobs.a", 100*time.Millisecond); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected ErrTimeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > time.Second {
+		t.Errorf("unexpected wait %v", elapsed)
+	}
+
+	qb.SetMaxTimeout(50 * time.Millisecond)
+	start = time.Now()
+	for _, dequeue := range []func() error{
+		func() error { _, err := qb.Dequeue("jobs.a", time.Minute); return err },
+		func() error { _, err := qb.Dequeue("jobs.*", time.Minute); return err },
+		func() error { _, err := qb.DequeueAny([]string{"jobs.a"}, time.Minute); return err },
+		func() error { _, err := qb.DequeueCorrelated("jobs.a", "id", time.Minute); return err },
+		func() error { _, err := qb.PeekLock("jobs.a", time.Minute, time.Minute); return err },
+	} {
+		if err := dequeue(); !errors.Is(err, ErrTimeout) {
+			t.Errorf("expected ErrTimeout, got %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("max timeout was not applied: waited %v", elapsed)
+	}
+}
@@ -0,0 +1,191 @@
+package broker
+
+import (
+	"errors"
+	"slices"
+	"time"
+)
+
+// defaultTransactionTTL через сколько секунд незафиксированная транзакция
+// отменяется, а зафиксированная забывается
+const defaultTransactionTTL = 300
+
+const (
+	// maxTransactionIDLength ограничение длины идентификатора транзакции
+	maxTransactionIDLength = 256
+	// maxTransactionMessages сколько сообщений можно поставить в одну транзакцию
+	maxTransactionMessages = 1000
+)
+
+// transaction сообщения, поставленные в транзакцию, до фиксации или отмены
+type transaction struct {
+	// pending сообщения в порядке постановки, еще не переданные в очереди
+	pending []pendingMessage
+	// committed число сообщений, переданных в очереди при фиксации;
+	// done — фиксация завершена
+	committed int
+	done      bool
+	// committing идет фиксация: транзакцию нельзя менять и отменять
+	committing bool
+	timer      *time.Timer
+}
+
+type pendingMessage struct {
+	queueName string
+	msg       *Message
+}
+
+// SetTransactionTTL задает, сколько секунд транзакция ждет фиксации
+// и сколько помнится после нее (по умолчанию 300)
+func (qb *QueueBroker) SetTransactionTTL(seconds int) {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	qb.transactionTTL = time.Duration(seconds) * time.Second
+}
+
+// EnqueueTx ставит сообщение в транзакцию txID; сообщение не видно
+// потребителям, пока транзакция не зафиксирована CommitTx. Транзакция
+// создается первым сообщением и отменяется, если не зафиксирована за время
+// жизни (SetTransactionTTL). owner — субъект запроса: идентификаторы
+// транзакций разных субъектов не пересекаются.
+func (qb *QueueBroker) EnqueueTx(owner, txID, queueName string, msg *Message) error {
+	if txID == "" || len(txID) > maxTransactionIDLength {
+		return ErrInvalidTransactionID
+	}
+	if queueName == "" || IsPattern(queueName) || queueName == CanaryQueue {
+		return ErrInvalidQueueName
+	}
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	if err := qb.standbyLocked(queueName); err != nil {
+		return err
+	}
+
+	key := txKey(owner, txID)
+	tx := qb.transactions[key]
+	switch {
+	case tx == nil:
+		tx = &transaction{}
+		qb.transactions[key] = tx
+		tx.timer = time.AfterFunc(qb.transactionTTL, func() { qb.expireTx(key, tx) })
+	case tx.done:
+		return ErrTransactionCommitted
+	case tx.committing:
+		return ErrTransactionBusy
+	case len(tx.pending)+tx.committed >= maxTransactionMessages:
+		return ErrTransactionTooLarge
+	}
+	tx.pending = append(tx.pending, pendingMessage{queueName: queueName, msg: copyMessage(msg)})
+	return nil
+}
+
+// TxQueues возвращает очереди, в которые поставлены еще не переданные
+// сообщения транзакции txID субъекта owner
+func (qb *QueueBroker) TxQueues(owner, txID string) ([]string, error) {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	tx := qb.transactions[txKey(owner, txID)]
+	if tx == nil {
+		return nil, ErrTransactionNotFound
+	}
+	var queues []string
+	for _, p := range tx.pending {
+		if !slices.Contains(queues, p.queueName) {
+			queues = append(queues, p.queueName)
+		}
+	}
+	return queues, nil
+}
+
+// CommitTx фиксирует транзакцию: ставит ее сообщения в очереди в порядке
+// постановки и возвращает их число. Если очередь не принимает сообщение,
+// возвращается ошибка, а оно и следующие остаются в транзакции: повторная
+// фиксация продолжает с него, не ставя принятые сообщения еще раз. Повтор
+// фиксации завершенной транзакции ничего не ставит и не считается ошибкой.
+func (qb *QueueBroker) CommitTx(owner, txID string) (int, error) {
+	qb.mu.Lock()
+	tx := qb.transactions[txKey(owner, txID)]
+	switch {
+	case tx == nil:
+		qb.mu.Unlock()
+		return 0, ErrTransactionNotFound
+	case tx.done:
+		qb.mu.Unlock()
+		return tx.committed, nil
+	case tx.committing:
+		qb.mu.Unlock()
+		return 0, ErrTransactionBusy
+	}
+	tx.committing = true
+	pending := tx.pending
+	qb.mu.Unlock()
+
+	var err error
+	for len(pending) > 0 {
+		// Enqueue меняет сообщение, поэтому в очередь ставится копия:
+		// при повторе фиксации нужна исходная
+		p := pending[0]
+		if err = qb.Enqueue(p.queueName, copyMessage(p.msg)); err != nil && !errors.Is(err, ErrDuplicate) {
+			break
+		}
+		err = nil
+		pending = pending[1:]
+		qb.mu.Lock()
+		tx.pending = pending
+		tx.committed++
+		qb.mu.Unlock()
+	}
+
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	tx.committing = false
+	if err != nil {
+		return tx.committed, err
+	}
+	// Зафиксированная транзакция помнится, чтобы повтор фиксации после
+	// обрыва связи не считался ошибкой
+	tx.done = true
+	tx.timer.Reset(qb.transactionTTL)
+	return tx.committed, nil
+}
+
+// AbortTx отменяет незафиксированную транзакцию вместе с ее сообщениями;
+// сообщения, уже поставленные в очереди прерванной фиксацией, остаются
+func (qb *QueueBroker) AbortTx(owner, txID string) error {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	key := txKey(owner, txID)
+	tx := qb.transactions[key]
+	switch {
+	case tx == nil:
+		return ErrTransactionNotFound
+	case tx.done:
+		return ErrTransactionCommitted
+	case tx.committing:
+		return ErrTransactionBusy
+	}
+	tx.timer.Stop()
+	delete(qb.transactions, key)
+	return nil
+}
+
+// expireTx отменяет незафиксированную транзакцию или забывает
+// зафиксированную по истечении времени жизни; идущая фиксация не
+// прерывается — транзакция истечет после нее
+func (qb *QueueBroker) expireTx(key string, tx *transaction) {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	if qb.transactions[key] != tx {
+		return
+	}
+	if tx.committing {
+		tx.timer.Reset(qb.transactionTTL)
+		return
+	}
+	delete(qb.transactions, key)
+}
+
+// txKey ключ транзакции: у каждого субъекта свои идентификаторы
+func txKey(owner, txID string) string {
+	return owner + "\x00" + txID
+}
@@ -0,0 +1,90 @@
+package broker
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestTransactionCommit проверяет, что сообщения транзакции не видны до
+// фиксации, а повтор фиксации не ставит их еще раз
+func TestTransactionCommit(t *testing.T) {
+	qb := NewQueueBroker(10, 10, 1)
+	for _, body := range []string{"a", "b"} {
+		if err := qb.EnqueueTx("app", "tx1", "jobs", &Message{Body: body}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	qb.EnqueueTx("app", "tx1", "audit", &Message{Body: "c"})
+	if _, err := qb.Dequeue("jobs", 0); !errors.Is(err, ErrQueueNotFound) {
+		t.Fatalf("uncommitted message is visible: %v", err)
+	}
+	if _, err := qb.CommitTx("other", "tx1"); !errors.Is(err, ErrTransactionNotFound) {
+		t.Errorf("transaction of another owner must not be found, got %v", err)
+	}
+
+	for range 2 {
+		if n, err := qb.CommitTx("app", "tx1"); err != nil || n != 3 {
+			t.Fatalf("unexpected commit result %d %v", n, err)
+		}
+	}
+	if qb.Depth("jobs") != 2 || qb.Depth("audit") != 1 {
+		t.Errorf("unexpected depths %d %d", qb.Depth("jobs"), qb.Depth("audit"))
+	}
+	if msg, _ := qb.Dequeue("jobs", 0); msg == nil || msg.Body != "a" {
+		t.Errorf("messages must keep order, got %v", msg)
+	}
+	if err := qb.EnqueueTx("app", "tx1", "jobs", &Message{Body: "d"}); !errors.Is(err, ErrTransactionCommitted) {
+		t.Errorf("expected ErrTransactionCommitted, got %v", err)
+	}
+	if err := qb.AbortTx("app", "tx1"); !errors.Is(err, ErrTransactionCommitted) {
+		t.Errorf("expected ErrTransactionCommitted, got %v", err)
+	}
+}
+
+// TestTransactionPartialCommit проверяет продолжение фиксации после ошибки
+func TestTransactionPartialCommit(t *testing.T) {
+	qb := NewQueueBroker(1, 10, 1)
+	qb.EnqueueTx("", "tx1", "jobs", &Message{Body: "a"})
+	qb.EnqueueTx("", "tx1", "jobs", &Message{Body: "b"})
+
+	if n, err := qb.CommitTx("", "tx1"); !errors.Is(err, ErrQueueFull) || n != 1 {
+		t.Fatalf("expected ErrQueueFull after 1 message, got %d %v", n, err)
+	}
+	qb.Dequeue("jobs", 0)
+	if n, err := qb.CommitTx("", "tx1"); err != nil || n != 2 {
+		t.Fatalf("unexpected commit result %d %v", n, err)
+	}
+	if msg, _ := qb.Dequeue("jobs", 0); msg == nil || msg.Body != "b" {
+		t.Errorf("expected remaining message, got %v", msg)
+	}
+}
+
+// TestTransactionAbortAndExpiry проверяет отмену и истечение транзакций
+func TestTransactionAbortAndExpiry(t *testing.T) {
+	qb := NewQueueBroker(10, 10, 1)
+	qb.EnqueueTx("", "tx1", "jobs", &Message{Body: "a"})
+	if err := qb.AbortTx("", "tx1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := qb.CommitTx("", "tx1"); !errors.Is(err, ErrTransactionNotFound) {
+		t.Errorf("aborted transaction must not be committed, got %v", err)
+	}
+
+	qb.transactionTTL = 20 * time.Millisecond
+	qb.EnqueueTx("", "tx2", "jobs", &Message{Body: "b"})
+	time.Sleep(50 * time.Millisecond)
+	if _, err := qb.CommitTx("", "tx2"); !errors.Is(err, ErrTransactionNotFound) {
+		t.Errorf("expired transaction must not be committed, got %v", err)
+	}
+	if qb.Depth("jobs") != 0 {
+		t.Error("messages of aborted and expired transactions must be dropped")
+	}
+
+	if err := qb.EnqueueTx("", "", "jobs", &Message{Body: "c"}); !errors.Is(err, ErrInvalidTransactionID) {
+		t.Errorf("expected ErrInvalidTransactionID, got %v", err)
+	}
+	if err := qb.EnqueueTx("", "tx3", "jobs.*", &Message{Body: "c"}); !errors.Is(err, ErrInvalidQueueName) {
+		t.Errorf("expected ErrInvalidQueueName, got %v", err)
+	}
+}
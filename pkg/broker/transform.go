@@ -0,0 +1,103 @@
+package broker
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// transforms кэш скомпилированных скриптов преобразования по исходному тексту
+var transforms sync.Map
+
+func compileTransform(src string) (*script, error) {
+	if compiled, ok := transforms.Load(src); ok {
+		return compiled.(*script), nil
+	}
+	compiled, err := compileScript(src)
+	if err != nil {
+		return nil, err
+	}
+	transforms.Store(src, compiled)
+	return compiled, nil
+}
+
+// ValidateTransform проверяет скрипт преобразования сообщений
+// (QueueConfig.Transform)
+func ValidateTransform(src string) error {
+	if src == "" {
+		return nil
+	}
+	_, err := compileTransform(src)
+	return err
+}
+
+// transform применяет к сообщению скрипт преобразования очереди queueName.
+// Скрипт вычисляется в том же окружении, что и правила маршрутизации; результат:
+// null или true — сообщение не меняется, false — отклоняется, строка — новое
+// тело, объект — изменения: "message" (строка или значение, записываемое
+// в JSON), "headers" (новые заголовки) и "reject" (причина отказа).
+func (qb *QueueBroker) transform(queueName string, msg *Message) error {
+	qb.mu.Lock()
+	src := qb.queueConfigLocked(queueName).Transform
+	qb.mu.Unlock()
+	if src == "" {
+		return nil
+	}
+	compiled, err := compileTransform(src)
+	if err != nil {
+		return err
+	}
+	result, err := compiled.Eval(scriptVars(queueName, msg))
+	if err != nil {
+		return fmt.Errorf("transform failed: %w", err)
+	}
+
+	switch v := result.(type) {
+	case nil:
+		return nil
+	case bool:
+		if !v {
+			return ErrRejected
+		}
+		return nil
+	case string:
+		msg.Body = v
+		return nil
+	case map[string]any:
+		if reason, ok := v["reject"]; ok && truthy(reason) {
+			if reason == true {
+				return ErrRejected
+			}
+			return fmt.Errorf("%w: %s", ErrRejected, toString(reason))
+		}
+		if body, ok := v["message"]; ok {
+			if s, ok := body.(string); ok {
+				msg.Body = s
+			} else {
+				data, err := json.Marshal(body)
+				if err != nil {
+					return fmt.Errorf("transform failed: %w", err)
+				}
+				msg.Body = string(data)
+			}
+		}
+		if value, ok := v["headers"]; ok {
+			headers, ok := value.(map[string]any)
+			if !ok && value != nil {
+				return fmt.Errorf("transform failed: headers must be an object, got %s", typeName(value))
+			}
+			msg.Headers = nil
+			for name, header := range headers {
+				if header == nil {
+					continue
+				}
+				if msg.Headers == nil {
+					msg.Headers = make(map[string]string, len(headers))
+				}
+				msg.Headers[name] = toString(header)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("transform failed: script %q returned %s", src, typeName(result))
+}
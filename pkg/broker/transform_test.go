@@ -0,0 +1,61 @@
+package broker
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestTransform проверяет изменение тела и заголовков, дополнение и отказ
+// скриптом преобразования очереди
+func TestTransform(t *testing.T) {
+	qb := NewQueueBroker(100, 10, 10)
+	set := func(queue, transform string) {
+		cfg := qb.QueueConfig(queue)
+		cfg.Transform = transform
+		qb.SetQueueConfig(queue, cfg)
+	}
+	set("orders", `payload == null ? {"reject": "body is not JSON"} : {
+		"message": merge(omit(payload, "card", ["cvv"]), {"source": has(headers, "source") ? headers.source : "unknown"}),
+		"headers": merge(headers, {"token": null, "transformed": true})
+	}`)
+	set("upper", `upper(body)`)
+	set("drop", `!startsWith(body, "spam")`)
+
+	if err := qb.Enqueue("orders", &Message{Body: `{"id": 1, "card": "4111", "cvv": "123"}`, Headers: map[string]string{"token": "secret", "source": "web"}}); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := qb.Dequeue("orders", 0)
+	if err != nil || msg.Body != `{"id":1,"source":"web"}` || msg.Headers["transformed"] != "true" || msg.Headers["source"] != "web" || len(msg.Headers) != 2 {
+		t.Errorf("unexpected transformed message: %+v %v", msg, err)
+	}
+	if err := qb.Enqueue("orders", &Message{Body: "plain"}); !errors.Is(err, ErrRejected) || !strings.Contains(err.Error(), "body is not JSON") {
+		t.Errorf("expected rejection with reason, got %v", err)
+	}
+
+	qb.Enqueue("upper", &Message{Body: "hello"})
+	if msg, _ := qb.Dequeue("upper", 0); msg == nil || msg.Body != "HELLO" {
+		t.Errorf("unexpected body: %+v", msg)
+	}
+	if err := qb.Enqueue("drop", &Message{Body: "spam offer"}); !errors.Is(err, ErrRejected) {
+		t.Errorf("expected rejection, got %v", err)
+	}
+	if err := qb.Enqueue("drop", &Message{Body: "hello"}); err != nil || qb.Depth("drop") != 1 {
+		t.Errorf("unexpected result for accepted message: %v", err)
+	}
+
+	// Преобразование не может подставить ссылку на чужое вынесенное тело
+	set("claims", `{"headers": {"`+ClaimCheckHeader+`": "other/object"}}`)
+	qb.Enqueue("claims", &Message{Body: "x"})
+	if msg, _ := qb.Dequeue("claims", 0); msg == nil || msg.Headers[ClaimCheckHeader] != "" {
+		t.Errorf("claim check header must be dropped: %+v", msg)
+	}
+
+	set("broken", `size(payload.items) > 0 ? 42 : null`)
+	if err := qb.Enqueue("broken", &Message{Body: `{"items": [1]}`}); err == nil || errors.Is(err, ErrRejected) {
+		t.Errorf("expected transform error, got %v", err)
+	}
+	if err := ValidateTransform("1 +"); err == nil {
+		t.Error("expected invalid transform error")
+	}
+}
@@ -0,0 +1,143 @@
+package broker
+
+// waiter ожидающий получатель long-poll или потоковый потребитель. Ожидающие
+// очереди (или шаблона) хранятся в порядке прихода; новое сообщение будит
+// одного, самого давнего из еще не разбуженных, поэтому сообщения достаются
+// ожидающим по очереди, а не тому, кто первым успел после общего пробуждения.
+type waiter struct {
+	// ready получает сигнал о сообщении, которое стоит попробовать извлечь
+	ready chan struct{}
+	// signaled ожидающий разбужен, но еще не проверил очередь: сообщение
+	// зарезервировано за ним, и новые получатели его не забирают
+	signaled bool
+	// from очередь, из-за сообщения которой ожидающий разбужен
+	from string
+}
+
+// newQueueLocked создает хранилище очереди, будящее ее ожидающих
+func (qb *QueueBroker) newQueueLocked(queueName string) *messageQueue {
+	return newMessageQueue(func() { qb.notifyWaitersLocked(queueName) })
+}
+
+// waitersLocked возвращает карту ожидающих для имени очереди или шаблона
+func (qb *QueueBroker) waitersLocked(key string) map[string][]*waiter {
+	if IsPattern(key) {
+		return qb.patternWaiters
+	}
+	return qb.waiters
+}
+
+// addWaiterLocked ставит ожидающего в конец очереди ожидающих. Очередь с
+// именем key может еще не существовать: ожидающий будет разбужен первым
+// сообщением, с которым она создастся.
+func (qb *QueueBroker) addWaiterLocked(key string) *waiter {
+	w := &waiter{ready: make(chan struct{}, 1)}
+	waiters := qb.waitersLocked(key)
+	waiters[key] = append(waiters[key], w)
+	return w
+}
+
+// removeWaiterLocked убирает ожидающего; если он был разбужен, но сообщение
+// так и не забрал, сигнал передается следующему
+func (qb *QueueBroker) removeWaiterLocked(key string, w *waiter) {
+	waiters := qb.waitersLocked(key)
+	list := waiters[key]
+	for i, item := range list {
+		if item == w {
+			list = append(list[:i:i], list[i+1:]...)
+			break
+		}
+	}
+	if len(list) == 0 {
+		delete(waiters, key)
+	} else {
+		waiters[key] = list
+	}
+	if w.signaled {
+		w.signaled = false
+		qb.notifyWaitersLocked(w.from)
+	}
+}
+
+// notifyWaitersLocked будит первого не разбуженного ожидающего очереди,
+// а если таких нет — ожидающего по совпадающему шаблону. Ожидающие
+// выборочного получения будятся все: сообщение может оказаться нужным им.
+func (qb *QueueBroker) notifyWaitersLocked(queueName string) {
+	qb.wakeSelectiveLocked(queueName)
+	for _, w := range qb.waiters[queueName] {
+		if !w.signaled {
+			w.signal(queueName)
+			return
+		}
+	}
+	for pattern, list := range qb.patternWaiters {
+		if !MatchPattern(pattern, queueName) {
+			continue
+		}
+		for _, w := range list {
+			if !w.signaled {
+				w.signal(queueName)
+				return
+			}
+		}
+	}
+}
+
+// wakeAllLocked будит всех ожидающих очереди и совпадающих шаблонов,
+// например, при удалении очереди
+func (qb *QueueBroker) wakeAllLocked(queueName string) {
+	qb.wakeSelectiveLocked(queueName)
+	for _, w := range qb.waiters[queueName] {
+		w.signal(queueName)
+	}
+	for pattern, list := range qb.patternWaiters {
+		if MatchPattern(pattern, queueName) {
+			for _, w := range list {
+				w.signal(queueName)
+			}
+		}
+	}
+}
+
+// reservedLocked сколько сообщений очереди зарезервировано за разбуженными
+// ожидающими; ожидающий нескольких очередей (DequeueAny) резервирует
+// сообщение только в той, из-за которой разбужен
+func (qb *QueueBroker) reservedLocked(queueName string) int {
+	reserved := 0
+	for _, w := range qb.waiters[queueName] {
+		if w.signaled && w.from == queueName {
+			reserved++
+		}
+	}
+	return reserved
+}
+
+// availableLocked сообщает, что получатель может попробовать извлечь
+// сообщение из очереди, не забирая зарезервированные за другими
+func (qb *QueueBroker) availableLocked(queueName string, queue *messageQueue) bool {
+	return queue.len() > qb.reservedLocked(queueName)
+}
+
+func (w *waiter) signal(queueName string) {
+	w.signaled = true
+	w.from = queueName
+	select {
+	case w.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Waiters возвращает число ожидающих получателей (long-poll, потоковых и
+// выборочных) по именам очередей и шаблонам, в том числе еще не созданных очередей
+func (qb *QueueBroker) Waiters() map[string]int {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+
+	counts := make(map[string]int)
+	for _, waiters := range []map[string][]*waiter{qb.waiters, qb.patternWaiters, qb.selectiveWaiters} {
+		for key, list := range waiters {
+			counts[key] += len(list)
+		}
+	}
+	return counts
+}
@@ -0,0 +1,104 @@
+package broker
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestWaitersFIFO проверяет, что ожидающие получают сообщения в порядке прихода
+func TestWaitersFIFO(t *testing.T) {
+	qb := NewQueueBroker(10, 10, 1)
+	qb.Enqueue("jobs", &Message{Body: "warmup"})
+	qb.Dequeue("jobs", 0)
+
+	got := make(chan int, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			if _, err := qb.Dequeue("jobs", 2*time.Second); err == nil {
+				got <- i
+			}
+		}()
+		// Следующий получатель приходит после того, как предыдущий начал ждать
+		waitForConsumers(t, qb, "jobs", i+1)
+	}
+	for want := 0; want < 3; want++ {
+		qb.Enqueue("jobs", &Message{Body: "x"})
+		select {
+		case i := <-got:
+			if i != want {
+				t.Fatalf("message went to waiter %d, want %d", i, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("waiter was not woken")
+		}
+	}
+}
+
+// TestWaitForQueueCreation проверяет, что получатель ждет еще не созданную
+// очередь и сразу получает первое сообщение в ней
+func TestWaitForQueueCreation(t *testing.T) {
+	qb := NewQueueBroker(10, 10, 1)
+	for _, name := range []string{"later", "later.*"} {
+		start := time.Now()
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			qb.Enqueue("later.eu", &Message{Body: "hello"})
+			qb.Enqueue("later", &Message{Body: "hello"})
+		}()
+		msg, err := qb.Dequeue(name, 5*time.Second)
+		if err != nil || msg.Body != "hello" {
+			t.Fatalf("%s: unexpected result: %+v, %v", name, msg, err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("%s: waiter was woken after %v", name, elapsed)
+		}
+		qb.DeleteQueue("later")
+		qb.DeleteQueue("later.eu")
+	}
+
+	// Очередь, так и не созданная до конца ожидания, по-прежнему не существует
+	if _, err := qb.Dequeue("never", time.Second); !errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("expected ErrQueueNotFound, got %v", err)
+	}
+}
+
+func waitForConsumers(t *testing.T, qb *QueueBroker, queueName string, n int) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); qb.Consumers(queueName) < n; {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d consumers of %s", n, queueName)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestWaiters проверяет подсчет ожидающих по очередям и шаблонам
+func TestWaiters(t *testing.T) {
+	qb := NewQueueBroker(10, 10, 1)
+	done := make(chan struct{})
+	go func() {
+		qb.Dequeue("jobs", 2*time.Second)
+		done <- struct{}{}
+	}()
+	go func() {
+		qb.Dequeue("jobs.*", 2*time.Second)
+		done <- struct{}{}
+	}()
+	for deadline := time.Now().Add(time.Second); len(qb.Waiters()) < 2; {
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected waiters %v", qb.Waiters())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := qb.Waiters(); got["jobs"] != 1 || got["jobs.*"] != 1 {
+		t.Errorf("unexpected waiters %v", got)
+	}
+	qb.Enqueue("jobs", &Message{Body: "x"})
+	qb.Enqueue("jobs.a", &Message{Body: "y"})
+	<-done
+	<-done
+	if got := qb.Waiters(); len(got) != 0 {
+		t.Errorf("waiters left after delivery: %v", got)
+	}
+}
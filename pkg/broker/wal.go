@@ -0,0 +1,427 @@
+package broker
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Журнал предзаписи (WAL) хранит очереди в файле: в него пишутся те же
+// операции, что передаются ведомым (см. Replicate), — постановка и
+// окончательное удаление сообщений, — и после перезапуска брокер
+// восстанавливает по нему очереди. Файл начинается с контрольной точки
+// (операции ReplicationReset и всех хранимых сообщений), за ней следуют
+// изменения; когда файл вырастает больше CheckpointBytes, он заменяется
+// новой контрольной точкой.
+//
+// Запись журнала — строка "<crc32c в hex> <операция в JSON>\n". Запись с
+// неверной контрольной суммой или без перевода строки (оборванная при
+// сбое) при восстановлении считается концом журнала: файл обрезается по
+// ней, последующие записи отбрасываются.
+//
+// После ошибки записи или fsync журнал считается неисправным: постановки
+// завершаются ErrNotPersisted, а журнал не чаще раза в walRetryDelay
+// пробует начать новый файл с контрольной точки. Когда это удается,
+// журнал снова хранит все сообщения, и постановки принимаются.
+
+const (
+	// WALSyncAlways постановка завершается после fsync журнала; операции
+	// одновременных постановок сбрасываются на диск одним fsync (групповая
+	// фиксация)
+	WALSyncAlways = "always"
+	// WALSyncInterval fsync раз в WALOptions.Interval: при сбое питания
+	// теряются операции последнего интервала
+	WALSyncInterval = "interval"
+	// WALSyncNever журнал только записывается в файл, на диск его сбрасывает
+	// операционная система
+	WALSyncNever = "never"
+
+	defaultWALSyncInterval    = time.Second
+	defaultWALCheckpointBytes = 64 << 20
+	// walRetryDelay пауза между попытками восстановить неисправный журнал
+	walRetryDelay = time.Second
+)
+
+// walCRCTable таблица CRC-32C (Castagnoli) для контрольных сумм записей журнала
+var walCRCTable = crc32.MakeTable(crc32.Castagnoli)
+
+// WALOptions настройки журнала предзаписи
+type WALOptions struct {
+	// Sync политика fsync: WALSyncAlways (по умолчанию), WALSyncInterval или WALSyncNever
+	Sync string
+	// Interval период fsync для WALSyncInterval (по умолчанию 1 с)
+	Interval time.Duration
+	// CheckpointBytes размер файла, после которого он заменяется контрольной
+	// точкой (по умолчанию 64 МиБ)
+	CheckpointBytes int64
+}
+
+// WAL журнал предзаписи брокера в файле
+type WAL struct {
+	qb   *QueueBroker
+	path string
+	opts WALOptions
+
+	file *os.File
+	w    *bufio.Writer
+	size int64
+	// restarted время последней замены файла контрольной точкой
+	restarted time.Time
+
+	// syncs запросы Sync: в канал передается результат после fsync всех
+	// операций, переданных журналу до запроса
+	syncs   chan chan error
+	done    chan struct{}
+	stopped chan struct{}
+
+	mu sync.Mutex
+	// failed ошибка записи, после которой журнал неисправен (nil — исправен);
+	// lastFailure не сбрасывается после восстановления
+	failed        error
+	lastFailure   error
+	lastFailureAt time.Time
+}
+
+// OpenWAL восстанавливает очереди из журнала path, если файл существует,
+// и начинает записывать в него изменения. Восстановленное состояние
+// заменяет сообщения, уже находящиеся в очередях (например, из снимка).
+func (qb *QueueBroker) OpenWAL(path string, opts WALOptions) (*WAL, error) {
+	switch opts.Sync {
+	case "":
+		opts.Sync = WALSyncAlways
+	case WALSyncAlways, WALSyncInterval, WALSyncNever:
+	default:
+		return nil, fmt.Errorf("unknown wal sync policy %q", opts.Sync)
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = defaultWALSyncInterval
+	}
+	if opts.CheckpointBytes <= 0 {
+		opts.CheckpointBytes = defaultWALCheckpointBytes
+	}
+
+	if err := qb.replayWAL(path); err != nil {
+		return nil, err
+	}
+	w := &WAL{qb: qb, path: path, opts: opts, syncs: make(chan chan error), done: make(chan struct{}), stopped: make(chan struct{})}
+	feed, err := w.checkpoint()
+	if err != nil {
+		return nil, err
+	}
+	go w.run(feed)
+	// Постановка ждет Sync (см. QueueBroker.persist)
+	qb.mu.Lock()
+	qb.wal = w
+	qb.mu.Unlock()
+	return w, nil
+}
+
+// replayWAL применяет операции журнала path к брокеру и обрезает файл по
+// первой поврежденной записи
+func (qb *QueueBroker) replayWAL(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var offset int64
+	for line := 1; ; line++ {
+		record, err := r.ReadBytes('\n')
+		if err == io.EOF && len(record) == 0 {
+			return nil
+		}
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("wal %s: %w", path, err)
+		}
+		op, ok := decodeWALRecord(record)
+		if !ok {
+			log.Printf("wal: %s: corrupted record at line %d, truncating at offset %d", path, line, offset)
+			return f.Truncate(offset)
+		}
+		if err := qb.ApplyReplication(op); err != nil {
+			return fmt.Errorf("wal %s: line %d: %w", path, line, err)
+		}
+		offset += int64(len(record))
+	}
+}
+
+// decodeWALRecord разбирает запись журнала; false — запись повреждена или оборвана
+func decodeWALRecord(record []byte) (ReplicationOp, bool) {
+	var op ReplicationOp
+	if len(record) < 10 || record[8] != ' ' || record[len(record)-1] != '\n' {
+		return op, false
+	}
+	sum, err := strconv.ParseUint(string(record[:8]), 16, 32)
+	if err != nil {
+		return op, false
+	}
+	data := record[9 : len(record)-1]
+	if crc32.Checksum(data, walCRCTable) != uint32(sum) || json.Unmarshal(data, &op) != nil {
+		return op, false
+	}
+	return op, true
+}
+
+// checkpoint подключает журнал к брокеру и записывает текущее состояние в
+// новый файл, который атомарно заменяет прежний
+func (w *WAL) checkpoint() (*ReplicationFeed, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(w.path), ".wal-*")
+	if err != nil {
+		return nil, err
+	}
+	feed := w.qb.replicate(true)
+	bw := bufio.NewWriter(tmp)
+	var size int64
+	for _, op := range feed.Initial {
+		n, _ := writeWALOp(bw, op)
+		size += int64(n)
+	}
+	err = bw.Flush()
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), w.path)
+	}
+	if err == nil {
+		err = syncDir(filepath.Dir(w.path))
+	}
+	if err != nil {
+		feed.Close()
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	if w.file != nil {
+		w.file.Close()
+	}
+	w.file, w.w, w.size = tmp, bufio.NewWriter(tmp), size
+	// Новый файл содержит все сообщения, в том числе не записанные прежним
+	w.mu.Lock()
+	w.failed = nil
+	w.mu.Unlock()
+	return feed, nil
+}
+
+// writeWALOp записывает операцию записью журнала с контрольной суммой
+func writeWALOp(w io.Writer, op ReplicationOp) (int, error) {
+	data, err := json.Marshal(op)
+	if err != nil {
+		return 0, err
+	}
+	record := make([]byte, 0, len(data)+10)
+	record = fmt.Appendf(record, "%08x ", crc32.Checksum(data, walCRCTable))
+	record = append(append(record, data...), '\n')
+	return w.Write(record)
+}
+
+// syncDir сбрасывает на диск каталог, чтобы переименование файла пережило сбой
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// run записывает операции брокера в журнал до Close
+func (w *WAL) run(feed *ReplicationFeed) {
+	defer close(w.stopped)
+	var tick <-chan time.Time
+	if w.opts.Sync == WALSyncInterval {
+		ticker := time.NewTicker(w.opts.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	dirty := false
+	for {
+		var waiting []chan error
+		lost := false
+		select {
+		case op, ok := <-feed.Ops:
+			if ok {
+				w.write(op)
+			}
+			lost = !ok
+		case done := <-w.syncs:
+			waiting = append(waiting, done)
+		case <-tick:
+			if dirty {
+				w.flush(true)
+				dirty = false
+			}
+			continue
+		case <-w.done:
+			for len(feed.Ops) > 0 {
+				w.write(<-feed.Ops)
+			}
+			w.flush(w.opts.Sync != WALSyncNever)
+			feed.Close()
+			if err := w.file.Close(); err != nil {
+				w.fail(err)
+			}
+			return
+		}
+
+		// Групповая фиксация: все накопившиеся операции и запросы Sync
+		// завершаются одной записью и одним fsync
+	drain:
+		for !lost {
+			select {
+			case op, ok := <-feed.Ops:
+				if ok {
+					w.write(op)
+				}
+				lost = !ok
+			case done := <-w.syncs:
+				waiting = append(waiting, done)
+			default:
+				break drain
+			}
+		}
+		// Журнал, отставший от брокера больше чем на буфер операций,
+		// выросший сверх CheckpointBytes и неисправный заменяется
+		// контрольной точкой
+		if lost || w.size >= w.opts.CheckpointBytes || w.err() != nil && time.Since(w.restarted) >= walRetryDelay {
+			feed.Close()
+			feed = w.restart()
+			dirty = false
+		} else {
+			w.flush(w.opts.Sync == WALSyncAlways)
+			dirty = w.opts.Sync == WALSyncInterval
+		}
+		err := w.err()
+		for _, done := range waiting {
+			done <- err
+		}
+	}
+}
+
+// restart начинает журнал заново с контрольной точки. Если новый файл
+// записать не удалось, текущее состояние дописывается в прежний: операция
+// ReplicationReset в начале контрольной точки отменяет предыдущие записи.
+func (w *WAL) restart() *ReplicationFeed {
+	w.restarted = time.Now()
+	feed, err := w.checkpoint()
+	if err == nil {
+		return feed
+	}
+	log.Printf("wal: checkpoint %s: %v", w.path, err)
+	feed = w.qb.replicate(true)
+	for _, op := range feed.Initial {
+		w.write(op)
+	}
+	w.flush(true)
+	return feed
+}
+
+func (w *WAL) write(op ReplicationOp) {
+	n, err := writeWALOp(w.w, op)
+	w.size += int64(n)
+	if err != nil {
+		w.fail(err)
+	}
+}
+
+// flush передает записанное в файл и при sync сбрасывает его на диск
+func (w *WAL) flush(sync bool) {
+	err := w.w.Flush()
+	if err == nil && sync {
+		err = w.file.Sync()
+	}
+	if err != nil {
+		w.fail(err)
+	}
+}
+
+// fail отмечает журнал неисправным
+func (w *WAL) fail(err error) {
+	log.Printf("wal: write %s: %v", w.path, err)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.failed == nil {
+		w.failed = err
+	}
+	w.lastFailure, w.lastFailureAt = err, time.Now()
+}
+
+// err возвращает ошибку, после которой журнал неисправен
+func (w *WAL) err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.failed
+}
+
+// Sync ждет, пока операции, переданные журналу до вызова, будут сброшены на
+// диск, и возвращает ErrNotPersisted, если журнал неисправен. Брокер
+// вызывает его после каждой постановки; с политиками, отличными от
+// WALSyncAlways, Sync не ждет и только сообщает о неисправности.
+func (w *WAL) Sync() error {
+	if w.opts.Sync != WALSyncAlways {
+		return w.result(w.err())
+	}
+	done := make(chan error, 1)
+	select {
+	case w.syncs <- done:
+	case <-w.stopped:
+		return w.result(w.err())
+	}
+	select {
+	case err := <-done:
+		return w.result(err)
+	case <-w.stopped:
+		return w.result(w.err())
+	}
+}
+
+func (w *WAL) result(err error) error {
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNotPersisted, err)
+	}
+	return nil
+}
+
+// health журнал неисправен, пока не удалось записать контрольную точку
+func (w *WAL) health() SubsystemHealth {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	h := SubsystemHealth{Status: HealthOK, Detail: map[string]any{"path": w.path, "sync": w.opts.Sync}}
+	if w.failed != nil {
+		h.Status = HealthDown
+	}
+	h.setLastError(w.lastFailure, w.lastFailureAt)
+	return h
+}
+
+// Close записывает накопившиеся операции, сбрасывает журнал на диск и
+// закрывает файл; ошибка — журнал неисправен и записанное может быть неполным
+func (w *WAL) Close() error {
+	select {
+	case <-w.stopped:
+		return w.result(w.err())
+	default:
+	}
+	w.qb.mu.Lock()
+	if w.qb.wal == w {
+		w.qb.wal = nil
+	}
+	w.qb.mu.Unlock()
+	close(w.done)
+	<-w.stopped
+	return w.result(w.err())
+}
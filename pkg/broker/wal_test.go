@@ -0,0 +1,342 @@
+package broker
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestWAL проверяет восстановление очередей из журнала предзаписи при
+// разных политиках fsync
+func TestWAL(t *testing.T) {
+	for _, policy := range []string{WALSyncAlways, WALSyncInterval, WALSyncNever} {
+		t.Run(policy, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "broker.wal")
+			qb := NewQueueBroker(100, 10, 1)
+			wal, err := qb.OpenWAL(path, WALOptions{Sync: policy})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, body := range []string{"a", "b", "c"} {
+				qb.PutMessage("jobs", body)
+			}
+			qb.GetMessage("jobs", 0)
+			if _, err := qb.Dequeue("jobs", 0); err != nil {
+				t.Fatal(err)
+			}
+			if qb.Followers() != 0 {
+				t.Errorf("wal is counted as a follower")
+			}
+			wal.Close()
+
+			restored := NewQueueBroker(100, 10, 1)
+			wal, err = restored.OpenWAL(path, WALOptions{Sync: policy})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer wal.Close()
+			if body, err := restored.GetMessage("jobs", 0); err != nil || body != "c" || restored.Depth("jobs") != 0 {
+				t.Errorf("restored: got %q %v, depth %d", body, err, restored.Depth("jobs"))
+			}
+		})
+	}
+
+	if _, err := NewQueueBroker(1, 1, 1).OpenWAL(filepath.Join(t.TempDir(), "broker.wal"), WALOptions{Sync: "sometimes"}); err == nil {
+		t.Error("expected error for unknown sync policy")
+	}
+}
+
+// TestWALDelayed проверяет, что отложенное сообщение после восстановления из
+// журнала выдается по прежнему сроку
+func TestWALDelayed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broker.wal")
+	qb := NewQueueBroker(100, 10, 1)
+	wal, err := qb.OpenWAL(path, WALOptions{Sync: WALSyncAlways})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deliverAt := time.Now().Add(time.Hour)
+	qb.Enqueue("jobs", &Message{Body: "later", DeliverAt: deliverAt})
+	wal.Close()
+
+	// Второе открытие проверяет и состояние, записанное при сжатии журнала
+	for range 2 {
+		restored := NewQueueBroker(100, 10, 1)
+		wal, err = restored.OpenWAL(path, WALOptions{Sync: WALSyncAlways})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg, err := restored.Dequeue("jobs", 0); err == nil {
+			t.Errorf("delayed message delivered early: %q", msg.Body)
+		}
+		if scheduled, _ := restored.Scheduled("jobs"); len(scheduled) != 1 || !scheduled[0].DeliverAt.Equal(deliverAt) {
+			t.Errorf("delivery time lost: %+v", scheduled)
+		}
+		wal.Close()
+	}
+}
+
+// TestWALAlways проверяет, что с политикой always постановка завершается
+// после записи операции на диск
+func TestWALAlways(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broker.wal")
+	qb := NewQueueBroker(100, 10, 1)
+	wal, err := qb.OpenWAL(path, WALOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+	qb.PutMessage("jobs", "durable")
+
+	// Журнал читается, пока брокер работает, как после падения процесса
+	restored := NewQueueBroker(100, 10, 1)
+	if err := restored.replayWAL(path); err != nil {
+		t.Fatal(err)
+	}
+	if body, err := restored.GetMessage("jobs", 0); err != nil || body != "durable" {
+		t.Errorf("restored: got %q %v", body, err)
+	}
+}
+
+// TestWALFailure проверяет, что с политикой always постановка, не записанная
+// на диск, завершается ErrNotPersisted, а журнал после восстановления снова
+// принимает постановки и хранит все сообщения
+func TestWALFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broker.wal")
+	qb := NewQueueBroker(100, 10, 1)
+	wal, err := qb.OpenWAL(path, WALOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Закрытый файл не принимает записи, как переполненный диск
+	wal.file.Close()
+	if err := qb.Enqueue("jobs", &Message{Body: "a"}); !errors.Is(err, ErrNotPersisted) {
+		t.Fatalf("enqueue to a failed wal: %v, want ErrNotPersisted", err)
+	}
+	if h := qb.Health()["wal"]; h.Status != HealthDown || h.LastError == "" {
+		t.Errorf("failed wal health: %+v", h)
+	}
+
+	// Следующая постановка начинает новый файл с контрольной точки
+	if err := qb.Enqueue("jobs", &Message{Body: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if h := qb.Health()["wal"]; h.Status != HealthOK {
+		t.Errorf("recovered wal health: %+v", h)
+	}
+	if err := wal.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := NewQueueBroker(100, 10, 1)
+	wal, err = restored.OpenWAL(path, WALOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+	waitBodies(t, restored, "jobs", "a", "b")
+}
+
+// TestWALCheckpoint проверяет замену разросшегося журнала контрольной точкой
+func TestWALCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broker.wal")
+	qb := NewQueueBroker(100, 10, 1)
+	wal, err := qb.OpenWAL(path, WALOptions{CheckpointBytes: 4096})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 1000 {
+		qb.PutMessage("jobs", "message "+strconv.Itoa(i))
+		if i%10 != 9 {
+			qb.GetMessage("jobs", 0)
+		}
+	}
+	wal.Close()
+	if info, err := os.Stat(path); err != nil || info.Size() > 16384 {
+		t.Errorf("wal is not checkpointed: %v %v", info.Size(), err)
+	}
+
+	restored := NewQueueBroker(1000, 10, 1)
+	wal, err = restored.OpenWAL(path, WALOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+	if depth := restored.Depth("jobs"); depth != 100 {
+		t.Errorf("restored depth %d", depth)
+	}
+}
+
+// TestWALCorruption проверяет восстановление по журналу, оборванному или
+// поврежденному в произвольном месте: применяются только целые записи до
+// повреждения, а файл обрезается по нему
+func TestWALCorruption(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "broker.wal")
+	qb := NewQueueBroker(100, 10, 1)
+	wal, err := qb.OpenWAL(path, WALOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 5 {
+		qb.PutMessage("jobs", "message "+strconv.Itoa(i))
+	}
+	wal.Close()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Границы записей: после контрольной точки (reset) идут пять постановок
+	var ends []int
+	for i, c := range data {
+		if c == '\n' {
+			ends = append(ends, i+1)
+		}
+	}
+
+	restore := func(corrupted []byte) (int, []byte) {
+		damaged := filepath.Join(dir, "damaged.wal")
+		if err := os.WriteFile(damaged, corrupted, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		restored := NewQueueBroker(100, 10, 1)
+		if err := restored.replayWAL(damaged); err != nil {
+			t.Fatal(err)
+		}
+		left, _ := os.ReadFile(damaged)
+		return restored.Depth("jobs"), left
+	}
+	// complete число целых записей постановки в первых n байтах
+	complete := func(n int) int {
+		count := 0
+		for _, end := range ends[1:] {
+			if end <= n {
+				count++
+			}
+		}
+		return count
+	}
+
+	for n := 0; n <= len(data); n++ {
+		depth, left := restore(data[:n])
+		// Оборванная контрольная точка обрезается целиком
+		want, keep := complete(n), 0
+		if n >= ends[0] {
+			keep = ends[want]
+		}
+		if depth != want || !bytes.Equal(left, data[:keep]) {
+			t.Fatalf("torn at %d: restored %d messages, want %d; %d bytes left", n, depth, want, len(left))
+		}
+	}
+	for _, pos := range []int{ends[0] + 3, ends[2] + 20, len(data) - 2} {
+		flipped := bytes.Clone(data)
+		flipped[pos] ^= 0x40
+		depth, left := restore(flipped)
+		// Повреждена запись, в которую попал pos: остаются записи до нее
+		want := complete(pos)
+		if depth != want || len(left) != ends[want] {
+			t.Errorf("bit flip at %d: restored %d messages, want %d; %d bytes left", pos, depth, want, len(left))
+		}
+	}
+}
+
+// TestWALCrash убивает процесс, ставящий сообщения в брокер с журналом,
+// посреди работы и проверяет, что ни одно подтвержденное сообщение не потеряно
+func TestWALCrash(t *testing.T) {
+	if path := os.Getenv("WAL_CRASH_PATH"); path != "" {
+		walCrashChild(path)
+		return
+	}
+	if testing.Short() {
+		t.Skip("spawns a child process")
+	}
+	for round := range 3 {
+		path := filepath.Join(t.TempDir(), "broker.wal")
+		cmd := exec.Command(os.Args[0], "-test.run=^TestWALCrash$")
+		cmd.Env = append(os.Environ(), "WAL_CRASH_PATH="+path)
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		acked := -1
+		scanner := bufio.NewScanner(stdout)
+		killAt := 200 + round*300
+		for scanner.Scan() {
+			i, err := strconv.Atoi(scanner.Text())
+			if err != nil {
+				continue
+			}
+			acked = i
+			if i == killAt {
+				time.AfterFunc(time.Duration(round)*time.Millisecond, func() { cmd.Process.Kill() })
+			}
+		}
+		cmd.Wait()
+		if acked < killAt {
+			t.Fatalf("round %d: child acknowledged only %d messages", round, acked+1)
+		}
+
+		restored := NewQueueBroker(1<<20, 10, 1)
+		if err := restored.replayWAL(path); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i <= acked; i++ {
+			body, err := restored.GetMessage("jobs", 0)
+			if err != nil || body != strconv.Itoa(i) {
+				t.Fatalf("round %d: acknowledged message %d: got %q %v", round, i, body, err)
+			}
+		}
+	}
+}
+
+// walCrashChild ставит сообщения в брокер с журналом path и печатает номер
+// каждого подтвержденного сообщения, пока процесс не будет убит
+func walCrashChild(path string) {
+	qb := NewQueueBroker(1<<20, 10, 1)
+	if _, err := qb.OpenWAL(path, WALOptions{Sync: WALSyncAlways}); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	for i := 0; ; i++ {
+		if err := qb.PutMessage("jobs", strconv.Itoa(i)); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Println(i)
+	}
+}
+
+// BenchmarkWAL постановка и получение сообщений параллельными клиентами
+// с журналом предзаписи при разных политиках fsync и без него (off)
+func BenchmarkWAL(b *testing.B) {
+	for _, policy := range []string{"off", WALSyncAlways, WALSyncInterval, WALSyncNever} {
+		b.Run(policy, func(b *testing.B) {
+			qb := NewQueueBroker(1<<20, 10, 1)
+			if policy != "off" {
+				wal, err := qb.OpenWAL(filepath.Join(b.TempDir(), "broker.wal"), WALOptions{Sync: policy})
+				if err != nil {
+					b.Fatal(err)
+				}
+				defer wal.Close()
+			}
+			b.SetParallelism(8)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					qb.PutMessage("bench", "payload")
+					qb.GetMessage("bench", 0)
+				}
+			})
+		})
+	}
+}
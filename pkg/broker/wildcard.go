@@ -0,0 +1,201 @@
+package broker
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Имена очередей разбиваются на токены по точке, как темы NATS:
+// "*" в шаблоне совпадает ровно с одним токеном, ">" — с одним и более
+// оставшимися токенами. Например, orders.* совпадает с orders.eu,
+// но не с orders.eu.paid, а orders.> — с обеими.
+
+// IsPattern сообщает, содержит ли имя очереди подстановочные токены
+func IsPattern(queueName string) bool {
+	// Проверяется на каждой постановке, поэтому имя не разбивается на срез токенов
+	for rest, more := queueName, true; more; {
+		var token string
+		token, rest, more = strings.Cut(rest, ".")
+		if token == "*" || token == ">" {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchPattern сообщает, совпадает ли имя очереди с шаблоном (или с именем без подстановок)
+func MatchPattern(pattern, queueName string) bool {
+	patternTokens, nameTokens := strings.Split(pattern, "."), strings.Split(queueName, ".")
+	for i, token := range patternTokens {
+		switch {
+		case token == ">":
+			return i < len(nameTokens)
+		case i >= len(nameTokens):
+			return false
+		case token != "*" && token != nameTokens[i]:
+			return false
+		}
+	}
+	return len(patternTokens) == len(nameTokens)
+}
+
+// queueIndex префиксное дерево имен очередей по токенам
+type queueIndex struct {
+	children map[string]*queueIndex
+	name     string
+}
+
+func newQueueIndex() *queueIndex {
+	return &queueIndex{children: make(map[string]*queueIndex)}
+}
+
+func (idx *queueIndex) add(queueName string) {
+	n := idx
+	for _, token := range strings.Split(queueName, ".") {
+		child := n.children[token]
+		if child == nil {
+			child = newQueueIndex()
+			n.children[token] = child
+		}
+		n = child
+	}
+	n.name = queueName
+}
+
+func (idx *queueIndex) remove(queueName string) {
+	n := idx
+	for _, token := range strings.Split(queueName, ".") {
+		if n = n.children[token]; n == nil {
+			return
+		}
+	}
+	n.name = ""
+}
+
+// match возвращает отсортированные имена очередей, совпадающих с шаблоном.
+// Шаблон не выходит за пределы арендатора: ">" не совпадает с очередями @acme.*.
+func (idx *queueIndex) match(pattern string) []string {
+	var names []string
+	idx.collect(strings.Split(pattern, "."), &names)
+	tenantID := TenantOf(pattern)
+	filtered := names[:0]
+	for _, name := range names {
+		if TenantOf(name) == tenantID {
+			filtered = append(filtered, name)
+		}
+	}
+	sort.Strings(filtered)
+	return filtered
+}
+
+func (idx *queueIndex) collect(tokens []string, names *[]string) {
+	if len(tokens) == 0 {
+		if idx.name != "" {
+			*names = append(*names, idx.name)
+		}
+		return
+	}
+	switch tokens[0] {
+	case ">":
+		for _, child := range idx.children {
+			child.collectAll(names)
+		}
+	case "*":
+		for _, child := range idx.children {
+			child.collect(tokens[1:], names)
+		}
+	default:
+		if child := idx.children[tokens[0]]; child != nil {
+			child.collect(tokens[1:], names)
+		}
+	}
+}
+
+func (idx *queueIndex) collectAll(names *[]string) {
+	if idx.name != "" {
+		*names = append(*names, idx.name)
+	}
+	for _, child := range idx.children {
+		child.collectAll(names)
+	}
+}
+
+// dequeuePattern извлекает сообщение из любой очереди, совпадающей с шаблоном.
+// Очереди опрашиваются по кругу, начиная со следующей после той, с которой
+// начинал предыдущий запрос, чтобы одна загруженная очередь не вытесняла остальные.
+// Ожидающего по шаблону будит сообщение любой совпадающей очереди, в том
+// числе созданной во время ожидания.
+func (qb *QueueBroker) dequeuePattern(pattern string, timeout time.Duration) (*Message, error) {
+	deadline := time.NewTimer(qb.waitLimit(timeout))
+	defer deadline.Stop()
+
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+	start := qb.patternCursor[pattern]
+	qb.patternCursor[pattern]++
+	var w *waiter
+	defer func() {
+		if w != nil {
+			qb.removeWaiterLocked(pattern, w)
+		}
+	}()
+
+	for {
+		if w != nil {
+			w.signaled = false
+		}
+		if err := qb.standbyLocked(pattern); err != nil {
+			return nil, err
+		}
+		names := qb.index.match(pattern)
+		if len(names) == 0 && timeout <= 0 {
+			return nil, ErrQueueNotFound
+		}
+
+		var paused time.Duration
+		now := time.Now()
+		for i := range names {
+			name := names[(start+i)%len(names)]
+			queue := qb.queues[name]
+			if qb.archiving[name] || !qb.availableLocked(name, queue) {
+				continue
+			}
+			if d := qb.pausedLocked(name, now); d > 0 {
+				if paused == 0 || d < paused {
+					paused = d
+				}
+				continue
+			}
+			if msg := qb.popLocked(name, queue); msg != nil && !qb.forwardToOwnerLocked(name, nil, msg) {
+				qb.holdGroupLocked(name, msg)
+				return msg, nil
+			}
+		}
+		if timeout <= 0 {
+			return nil, ErrTimeout
+		}
+
+		if w == nil {
+			w = qb.addWaiterLocked(pattern)
+		}
+		qb.mu.Unlock()
+		// Пробуждение по окончании самой короткой паузы среди совпавших очередей
+		resume, stop := resumeTimer(paused)
+		expired := false
+		select {
+		case <-w.ready:
+		case <-resume:
+		case <-deadline.C:
+			expired = true
+		}
+		stop()
+		qb.mu.Lock()
+		if expired {
+			if len(qb.index.match(pattern)) == 0 {
+				return nil, ErrQueueNotFound
+			}
+			return nil, ErrTimeout
+		}
+	}
+}
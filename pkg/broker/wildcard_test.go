@@ -0,0 +1,99 @@
+package broker
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestQueueIndexMatch проверяет сопоставление шаблонов в стиле NATS
+func TestQueueIndexMatch(t *testing.T) {
+	idx := newQueueIndex()
+	for _, name := range []string{"orders.eu", "orders.us", "orders.eu.paid", "payments.eu"} {
+		idx.add(name)
+	}
+
+	cases := map[string][]string{
+		"orders.*":   {"orders.eu", "orders.us"},
+		"orders.>":   {"orders.eu", "orders.eu.paid", "orders.us"},
+		"*.eu":       {"orders.eu", "payments.eu"},
+		"orders.*.*": {"orders.eu.paid"},
+		"billing.*":  nil,
+	}
+	for pattern, want := range cases {
+		if got := idx.match(pattern); !reflect.DeepEqual(got, want) {
+			t.Errorf("match %q: got %v want %v", pattern, got, want)
+		}
+	}
+
+	idx.remove("orders.us")
+	if got := idx.match("orders.*"); !reflect.DeepEqual(got, []string{"orders.eu"}) {
+		t.Errorf("removed queue still matches: %v", got)
+	}
+}
+
+// TestDequeuePattern проверяет получение из нескольких очередей по шаблону с чередованием
+func TestDequeuePattern(t *testing.T) {
+	qb := NewQueueBroker(100, 10, 10)
+	for _, body := range []string{"eu-1", "eu-2", "eu-3"} {
+		qb.PutMessage("orders.eu", body)
+	}
+	qb.PutMessage("orders.us", "us-1")
+	qb.PutMessage("orders.eu.paid", "paid-1")
+
+	var got []string
+	for i := 0; i < 4; i++ {
+		msg, err := qb.Dequeue("orders.*", time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, msg.Queue+":"+msg.Body)
+	}
+	want := []string{"orders.eu:eu-1", "orders.us:us-1", "orders.eu:eu-2", "orders.eu:eu-3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v want %v", got, want)
+	}
+
+	if _, err := qb.Dequeue("billing.*", time.Second); !errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("expected queue does not exist for a pattern without matches, got %v", err)
+	}
+	if err := qb.PutMessage("orders.*", "x"); err == nil {
+		t.Errorf("PUT to a pattern must be rejected")
+	}
+}
+
+// TestPeekLockPattern проверяет, что блокировка относится к исходной очереди
+func TestPeekLockPattern(t *testing.T) {
+	qb := NewQueueBroker(100, 10, 10)
+	qb.PutMessage("orders.eu", "eu-1")
+
+	delivery, err := qb.PeekLock("orders.*", time.Second, 30*time.Second)
+	if err != nil || delivery.Queue != "orders.eu" {
+		t.Fatalf("unexpected delivery: %+v %v", delivery, err)
+	}
+	if err := qb.Complete("orders.eu", delivery.LockToken); err != nil {
+		t.Errorf("complete on the source queue failed: %v", err)
+	}
+}
+
+// TestMatchPattern проверяет сопоставление отдельного имени с шаблоном
+func TestMatchPattern(t *testing.T) {
+	cases := []struct {
+		pattern, name string
+		match         bool
+	}{
+		{"orders.*", "orders.eu", true},
+		{"orders.*", "orders.eu.paid", false},
+		{"orders.>", "orders.eu.paid", true},
+		{"orders.>", "orders", false},
+		{"*.dlq", "jobs.dlq", true},
+		{"jobs", "jobs", true},
+		{"jobs", "jobs.dlq", false},
+	}
+	for _, c := range cases {
+		if got := MatchPattern(c.pattern, c.name); got != c.match {
+			t.Errorf("MatchPattern(%q, %q) = %v, want %v", c.pattern, c.name, got, c.match)
+		}
+	}
+}
@@ -0,0 +1,926 @@
+// Package client реализует Go-клиент HTTP API брокера очередей. Типы запросов
+// и ответов и пути операций генерируются по спецификации pkg/httpapi/openapi.json
+// (файл openapi_gen.go), поэтому клиент не может разойтись с API.
+package client
+
+//go:generate go run ../../cmd/openapi-gen --spec ../httpapi/openapi.json --out openapi_gen.go
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"queue-broker/pkg/signing"
+)
+
+// Message сообщение, отправляемое в очередь или полученное из нее
+type Message struct {
+	Body    string            `json:"message"`
+	Headers map[string]string `json:"headers,omitempty"`
+	DedupID string            `json:"dedup_id,omitempty"`
+	// ContentType задает отправку тела как есть с этим типом содержимого
+	// (например, application/octet-stream) вместо JSON; Body может содержать
+	// произвольные байты
+	ContentType string `json:"content_type,omitempty"`
+	// GroupID группа сообщения: сообщения одной группы выдаются строго по
+	// порядку постановки и по одному
+	GroupID string `json:"group_id,omitempty"`
+	// Delay откладывает выдачу отправляемого сообщения (с точностью до секунды)
+	Delay time.Duration `json:"-"`
+	// Wait сколько брокеру ждать места для отправляемого сообщения в
+	// заполненной очереди с политикой overflow=block (0 — таймаут брокера по
+	// умолчанию); в остальных очередях не действует
+	Wait time.Duration `json:"-"`
+
+	// LockToken и LockedUntil заполняются при получении в режиме peek-lock
+	LockToken   string    `json:"lock_token,omitempty"`
+	LockedUntil time.Time `json:"locked_until,omitempty"`
+	// LeaseDeadline срок блокировки по часам клиента: момент отправки запроса
+	// плюс выданная длительность блокировки. Не зависит от расхождения часов
+	// с брокером, поэтому по нему удобно планировать RenewLock.
+	LeaseDeadline time.Time `json:"-"`
+}
+
+// GetOptions параметры получения сообщения
+type GetOptions struct {
+	// Timeout время ожидания сообщения одним запросом (long-poll);
+	// 0 — таймаут сервера по умолчанию
+	Timeout time.Duration
+	// PeekLock включает режим peek-lock: сообщение нужно подтвердить через Complete
+	PeekLock bool
+	// LockDuration длительность блокировки в режиме peek-lock; 0 — настройка очереди
+	LockDuration time.Duration
+	// Consumer идентификатор потребителя в режиме peek-lock: каждый запрос
+	// и RenewLock — его сигнал жизни, при потере потребителя брокер
+	// возвращает выданные ему сообщения в очередь
+	Consumer string
+	// CorrelationID выдать только сообщение с этим заголовком correlation_id
+	// (без PeekLock): так клиенты получают свои ответы из общей очереди
+	CorrelationID string
+	// Selector выдать только сообщение, удовлетворяющее условию (без PeekLock),
+	// например headers.type == "order.created"
+	Selector string
+	// MaxAttempts число long-poll запросов до возврата ErrEmpty;
+	// 0 — повторять, пока не отменен ctx
+	MaxAttempts int
+}
+
+// Client клиент брокера очередей
+type Client struct {
+	baseURL string
+
+	// HTTPClient используется для всех запросов; можно заменить своим (TLS, прокси)
+	HTTPClient *http.Client
+	// RetryBackoff начальная пауза перед повтором после сетевой ошибки или 5xx
+	RetryBackoff time.Duration
+	// MaxRetryBackoff максимальная пауза между повторами
+	MaxRetryBackoff time.Duration
+
+	// Namespace и Token задают арендатора многоарендного брокера: запросы
+	// отправляются на /ns/{Namespace}/queue/... с Authorization: Bearer Token.
+	// Token без Namespace передает токен OAuth2/OIDC.
+	Namespace string
+	Token     string
+
+	// SigningKeyID и SigningSecret включают подпись запросов HMAC-SHA256,
+	// если брокер требует подпись
+	SigningKeyID  string
+	SigningSecret []byte
+}
+
+// maxIdleConnsPerHost сколько простаивающих соединений держать открытыми:
+// параллельные long-poll запросы не должны каждый раз открывать новое соединение
+const maxIdleConnsPerHost = 64
+
+// New создает клиента для брокера с базовым URL вида http://localhost:8080
+// или unix:///var/run/qb.sock для брокера на этом же узле
+func New(baseURL string) *Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = maxIdleConnsPerHost
+	if path, ok := strings.CutPrefix(baseURL, "unix://"); ok {
+		var dialer net.Dialer
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", path)
+		}
+		baseURL = "http://unix"
+	}
+	return &Client{
+		baseURL:         strings.TrimRight(baseURL, "/"),
+		HTTPClient:      &http.Client{Transport: transport},
+		RetryBackoff:    100 * time.Millisecond,
+		MaxRetryBackoff: 5 * time.Second,
+	}
+}
+
+// NewH2C создает клиента, который ходит к брокеру по HTTP/2 без TLS (h2c):
+// все запросы, включая long-poll, мультиплексируются в одном соединении.
+// Брокер должен быть запущен с включенным h2c.
+func NewH2C(baseURL string) *Client {
+	c := New(baseURL)
+	transport := c.HTTPClient.Transport.(*http.Transport)
+	transport.Protocols = new(http.Protocols)
+	transport.Protocols.SetUnencryptedHTTP2(true)
+	return c
+}
+
+// Put отправляет сообщение в очередь. Повтор с тем же DedupID
+// не считается ошибкой и не создает дубликат. Сообщение без DedupID после
+// сетевой ошибки или ответа 5xx не отправляется повторно: брокер мог уже
+// принять его, и повтор поставил бы его дважды.
+func (c *Client) Put(ctx context.Context, queue string, msg Message) error {
+	if msg.ContentType != "" {
+		return c.putRaw(ctx, queue, msg)
+	}
+	body, err := json.Marshal(PutRequest{Message: msg.Body, Headers: msg.Headers, DedupID: msg.DedupID, GroupID: msg.GroupID})
+	if err != nil {
+		return err
+	}
+	resp, err := c.send(ctx, opPutMessage.method, c.operationURL(opPutMessage, putQuery(msg), queue), body, nil, msg.DedupID != "")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// putQuery параметры запроса постановки сообщения
+func putQuery(msg Message) url.Values {
+	query := url.Values{}
+	if msg.Delay > 0 {
+		query.Set("delay", strconv.Itoa(int(msg.Delay.Round(time.Second)/time.Second)))
+	}
+	if msg.Wait > 0 {
+		query.Set("timeout", formatTimeout(msg.Wait))
+	}
+	if len(query) == 0 {
+		return nil
+	}
+	return query
+}
+
+// putRaw отправляет тело как есть; заголовки сообщения передаются
+// заголовками X-Message-Header-*, DedupID — заголовком Idempotency-Key,
+// GroupID — заголовком X-Group-Id
+func (c *Client) putRaw(ctx context.Context, queue string, msg Message) error {
+	header := http.Header{"Content-Type": {msg.ContentType}}
+	for name, value := range msg.Headers {
+		header.Set("X-Message-Header-"+name, value)
+	}
+	if msg.DedupID != "" {
+		header.Set("Idempotency-Key", msg.DedupID)
+	}
+	if msg.GroupID != "" {
+		header.Set("X-Group-Id", msg.GroupID)
+	}
+	resp, err := c.send(ctx, opPutMessage.method, c.operationURL(opPutMessage, putQuery(msg), queue), []byte(msg.Body), header, msg.DedupID != "")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// maxPublishMessages сколько сообщений брокер принимает одним PUT /publish
+const maxPublishMessages = 100
+
+// PutBatch ставит сообщения в очередь пакетами PUT /publish по
+// maxPublishMessages: каждый пакет ставится атомарно, целиком или никак.
+// Пакеты отправляются по порядку, после отказа следующие не отправляются:
+// *BatchError содержит ошибку для каждого непоставленного сообщения, от
+// начала отказавшего пакета до конца, а сообщения до него поставлены.
+// Message.Wait в пакете не поддерживается. Как и Put, пакет повторяется
+// после сетевой ошибки или 5xx, только если у всех его сообщений есть DedupID.
+func (c *Client) PutBatch(ctx context.Context, queue string, msgs []Message) error {
+	for start := 0; start < len(msgs); start += maxPublishMessages {
+		chunk := msgs[start:min(start+maxPublishMessages, len(msgs))]
+		if err := c.publish(ctx, queue, chunk); err != nil {
+			batchErr := &BatchError{Errors: make(map[int]error)}
+			for i := start; i < len(msgs); i++ {
+				batchErr.Errors[i] = err
+			}
+			return batchErr
+		}
+	}
+	return nil
+}
+
+// publish ставит пакет сообщений одним запросом PUT /publish
+func (c *Client) publish(ctx context.Context, queue string, msgs []Message) error {
+	request := PublishRequest{Messages: make([]PublishEntry, len(msgs))}
+	retry := true
+	for i, msg := range msgs {
+		entry := PublishEntry{Queue: queue, Headers: msg.Headers, DedupID: msg.DedupID, GroupID: msg.GroupID, ContentType: msg.ContentType}
+		if utf8.ValidString(msg.Body) {
+			entry.Message = msg.Body
+		} else {
+			entry.MessageBase64 = base64.StdEncoding.EncodeToString([]byte(msg.Body))
+		}
+		if msg.Delay > 0 {
+			entry.Delay = int(msg.Delay.Round(time.Second) / time.Second)
+		}
+		request.Messages[i] = entry
+		retry = retry && msg.DedupID != ""
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	resp, err := c.send(ctx, opPublishMessages.method, c.operationURL(opPublishMessages, nil), body, nil, retry)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Get получает сообщение из очереди. Пустая очередь и временные ошибки
+// приводят к повторному long-poll запросу, пока не будет получено сообщение,
+// не исчерпан opts.MaxAttempts или не отменен ctx.
+func (c *Client) Get(ctx context.Context, queue string, opts GetOptions) (*Message, error) {
+	query := url.Values{}
+	if opts.Timeout > 0 {
+		query.Set("timeout", formatTimeout(opts.Timeout))
+	}
+	op := opConsumeMessage
+	if opts.CorrelationID != "" {
+		query.Set("correlation_id", opts.CorrelationID)
+	}
+	if opts.Selector != "" {
+		query.Set("selector", opts.Selector)
+	}
+	if opts.PeekLock {
+		op = opLeaseMessage
+		if opts.LockDuration > 0 {
+			query.Set("lock_duration", strconv.Itoa(int(opts.LockDuration.Round(time.Second)/time.Second)))
+		}
+		if opts.Consumer != "" {
+			query.Set("consumer", opts.Consumer)
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		sent := time.Now()
+		resp, err := c.call(ctx, op, query, nil, queue)
+		if err == nil && resp.StatusCode == http.StatusNoContent {
+			// Брокер с --rest-status-codes отвечает 204, если сообщение не появилось
+			resp.Body.Close()
+			err = ErrEmpty
+		}
+		if err == nil {
+			defer resp.Body.Close()
+			msg, lockDuration, err := decodeMessage(json.NewDecoder(resp.Body))
+			if err != nil {
+				return nil, err
+			}
+			if lockDuration > 0 {
+				msg.LeaseDeadline = sent.Add(lockDuration)
+			}
+			return msg, nil
+		}
+		if !errors.Is(err, ErrEmpty) || (opts.MaxAttempts > 0 && attempt >= opts.MaxAttempts) {
+			return nil, err
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// ReadLog читает из журнала очереди с хранением сообщение с номером offset
+// или, если его уже нет, ближайшее следующее, не извлекая его, и возвращает
+// номер прочитанной записи: следующая читается с него плюс один. Если записи
+// еще нет, брокер ждет ее до timeout (0 — таймаут сервера по умолчанию), а
+// затем ReadLog возвращает ErrEmpty.
+func (c *Client) ReadLog(ctx context.Context, queue string, offset uint64, timeout time.Duration) (*Message, uint64, error) {
+	return c.readLog(ctx, queue, url.Values{"from_offset": {strconv.FormatUint(offset, 10)}}, timeout)
+}
+
+// ReadGroup читает из журнала очереди запись с зафиксированного смещения
+// группы group (новая группа начинает с самой старой хранимой записи).
+// Смещение не сдвигается: после обработки сообщения вызовите CommitOffset
+// с номером прочитанной записи плюс один.
+func (c *Client) ReadGroup(ctx context.Context, queue, group string, timeout time.Duration) (*Message, uint64, error) {
+	return c.readLog(ctx, queue, url.Values{"group": {group}}, timeout)
+}
+
+// CommitOffset фиксирует смещение группы group: номер записи журнала, с
+// которой группа продолжит чтение
+func (c *Client) CommitOffset(ctx context.Context, queue, group string, offset uint64) error {
+	body, _ := json.Marshal(OffsetCommit{Group: group, Offset: offset})
+	resp, err := c.call(ctx, opCommitOffset, nil, body, queue)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Offsets возвращает границы журнала очереди и смещения групп потребителей
+func (c *Client) Offsets(ctx context.Context, queue string) (*LogOffsets, error) {
+	resp, err := c.call(ctx, opGetLogOffsets, nil, nil, queue)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var offsets LogOffsets
+	if err := json.NewDecoder(resp.Body).Decode(&offsets); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return &offsets, nil
+}
+
+// readLog читает запись журнала очереди с позиции из query
+func (c *Client) readLog(ctx context.Context, queue string, query url.Values, timeout time.Duration) (*Message, uint64, error) {
+	if timeout > 0 {
+		query.Set("timeout", formatTimeout(timeout))
+	}
+	resp, err := c.call(ctx, opReadLog, query, nil, queue)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNoContent {
+		return nil, 0, ErrEmpty
+	}
+	msg, _, err := decodeMessage(json.NewDecoder(resp.Body))
+	if err != nil {
+		return nil, 0, err
+	}
+	read, err := strconv.ParseUint(resp.Header.Get("X-Offset"), 10, 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("decode response: invalid X-Offset: %w", err)
+	}
+	return msg, read, nil
+}
+
+// formatTimeout записывает timeout для запроса; целые секунды передаются
+// числом, которое понимают и брокеры без поддержки длительностей Go
+func formatTimeout(timeout time.Duration) string {
+	if timeout%time.Second == 0 {
+		return strconv.Itoa(int(timeout / time.Second))
+	}
+	return timeout.String()
+}
+
+// decodeMessage читает сообщение из ответа брокера; двоичное тело брокер
+// возвращает в поле message_base64
+func decodeMessage(decoder *json.Decoder) (*Message, time.Duration, error) {
+	var delivery Delivery
+	if err := decoder.Decode(&delivery); err != nil {
+		return nil, 0, fmt.Errorf("decode response: %w", err)
+	}
+	body, err := decodeBody(delivery.Message, delivery.MessageBase64)
+	if err != nil {
+		return nil, 0, err
+	}
+	msg := &Message{
+		Body:        body,
+		Headers:     delivery.Headers,
+		DedupID:     delivery.DedupID,
+		ContentType: delivery.ContentType,
+		GroupID:     delivery.GroupID,
+		LockToken:   delivery.LockToken,
+		LockedUntil: delivery.LockedUntil,
+	}
+	return msg, time.Duration(delivery.LockDuration) * time.Second, nil
+}
+
+// decodeBody возвращает тело сообщения: двоичное брокер передает в base64
+func decodeBody(body, bodyBase64 string) (string, error) {
+	if bodyBase64 == "" {
+		return body, nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(bodyBase64)
+	if err != nil {
+		return "", fmt.Errorf("decode response: %w", err)
+	}
+	return string(decoded), nil
+}
+
+// Stream получает сообщения из очереди потоком (GET /queue/{name}/stream)
+// и передает их handler, пока не отменен ctx, не закрыто соединение или
+// handler не вернул ошибку. Сообщение удаляется из очереди при выдаче в поток.
+func (c *Client) Stream(ctx context.Context, queue string, handler func(*Message) error) error {
+	return c.stream(ctx, c.operationURL(opStreamMessages, nil, queue), handler)
+}
+
+// Tail получает потоком копии сообщений, поставленных в очередь после
+// подключения (GET /queue/{name}/tail?peek=true), не извлекая их; имя может
+// быть шаблоном. Удобно для отладки продюсеров.
+func (c *Client) Tail(ctx context.Context, queue string, handler func(*Message) error) error {
+	return c.stream(ctx, c.operationURL(opTailMessages, url.Values{"peek": {"true"}}, queue), handler)
+}
+
+func (c *Client) stream(ctx context.Context, target string, handler func(*Message) error) error {
+	resp, err := c.do(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		msg, _, err := decodeMessage(decoder)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if err := handler(msg); err != nil {
+			return err
+		}
+	}
+}
+
+// Queues возвращает список очередей брокера (в многоарендном режиме —
+// очереди арендатора из Token)
+func (c *Client) Queues(ctx context.Context) ([]QueueInfo, error) {
+	resp, err := c.do(ctx, opListQueues.method, c.baseURL+opListQueues.path, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result QueueList
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return result.Queues, nil
+}
+
+// Purge удаляет все ожидающие сообщения очереди и возвращает их число
+func (c *Client) Purge(ctx context.Context, queue string) (int, error) {
+	resp, err := c.call(ctx, opPurgeQueue, nil, nil, queue)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var result PurgeResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("decode response: %w", err)
+	}
+	return result.Purged, nil
+}
+
+// Stats возвращает статистику очереди: скорости постановки и выдачи,
+// возраст самого старого сообщения и задержку выдачи
+func (c *Client) Stats(ctx context.Context, queue string) (*QueueStats, error) {
+	resp, err := c.call(ctx, opGetQueueStats, nil, nil, queue)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var stats QueueStats
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return &stats, nil
+}
+
+// importChunkSize до скольких байт строк r отправляется одним запросом
+// импорта: вдвое меньше ограничения тела запроса брокера по умолчанию
+const importChunkSize = 128 << 10
+
+// Export выгружает ожидающие сообщения очереди в w в NDJSON, не извлекая
+// их (GET /queue/{name}/export), и возвращает число сообщений
+func (c *Client) Export(ctx context.Context, queue string, w io.Writer) (int, error) {
+	resp, err := c.call(ctx, opExportQueue, nil, nil, queue)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return 0, err
+	}
+	count, _ := strconv.Atoi(resp.Header.Get("X-Total-Count"))
+	return count, nil
+}
+
+// Import загружает в очередь сообщения из NDJSON в формате Export. Данные
+// отправляются частями, чтобы не превысить ограничение тела запроса; при
+// ошибке возвращается результат уже загруженных частей.
+func (c *Client) Import(ctx context.Context, queue string, r io.Reader) (*ImportResult, error) {
+	total := &ImportResult{}
+	header := http.Header{"Content-Type": {"application/x-ndjson"}}
+	var chunk []byte
+	send := func() error {
+		result, err := c.importChunk(ctx, queue, chunk, header)
+		if err != nil {
+			return err
+		}
+		total.Imported += result.Imported
+		total.Duplicates += result.Duplicates
+		chunk = chunk[:0]
+		return nil
+	}
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return total, err
+		}
+		if len(line) > 0 && line[len(line)-1] != '\n' {
+			line = append(line, '\n')
+		}
+		if len(chunk) > 0 && len(chunk)+len(line) > importChunkSize {
+			if err := send(); err != nil {
+				return total, err
+			}
+		}
+		chunk = append(chunk, line...)
+		if err != nil {
+			if len(chunk) > 0 {
+				return total, send()
+			}
+			return total, nil
+		}
+	}
+}
+
+func (c *Client) importChunk(ctx context.Context, queue string, chunk []byte, header http.Header) (*ImportResult, error) {
+	resp, err := c.doWithHeader(ctx, opImportQueue.method, c.operationURL(opImportQueue, nil, queue), chunk, header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result ImportResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return &result, nil
+}
+
+// Pause приостанавливает выдачу сообщений из очереди; постановка продолжается
+func (c *Client) Pause(ctx context.Context, queue string) error {
+	return c.setPaused(ctx, opPauseQueue, queue)
+}
+
+// Resume возобновляет выдачу сообщений из очереди
+func (c *Client) Resume(ctx context.Context, queue string) error {
+	return c.setPaused(ctx, opResumeQueue, queue)
+}
+
+func (c *Client) setPaused(ctx context.Context, op operation, queue string) error {
+	resp, err := c.call(ctx, op, nil, nil, queue)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Schedules возвращает расписания постановки сообщений
+func (c *Client) Schedules(ctx context.Context) ([]Schedule, error) {
+	resp, err := c.call(ctx, opListSchedules, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result ScheduleList
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return result.Schedules, nil
+}
+
+// SetSchedule создает расписание или заменяет расписание с тем же ID
+// и возвращает его с временем следующего срабатывания; пустой ID
+// генерируется брокером
+func (c *Client) SetSchedule(ctx context.Context, s Schedule) (Schedule, error) {
+	body, err := json.Marshal(s)
+	if err != nil {
+		return Schedule{}, err
+	}
+	var resp *http.Response
+	if s.ID == "" {
+		resp, err = c.call(ctx, opCreateSchedule, nil, body)
+	} else {
+		resp, err = c.call(ctx, opPutSchedule, nil, body, s.ID)
+	}
+	if err != nil {
+		return Schedule{}, err
+	}
+	defer resp.Body.Close()
+
+	var saved Schedule
+	if err := json.NewDecoder(resp.Body).Decode(&saved); err != nil {
+		return Schedule{}, fmt.Errorf("decode response: %w", err)
+	}
+	return saved, nil
+}
+
+// DeleteSchedule удаляет расписание
+func (c *Client) DeleteSchedule(ctx context.Context, id string) error {
+	resp, err := c.call(ctx, opDeleteSchedule, nil, nil, id)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Snapshot записывает снимок всех очередей брокера в его хранилище снимков;
+// восстановить брокер из снимка можно флагом --restore-from
+func (c *Client) Snapshot(ctx context.Context) (*SnapshotResult, error) {
+	resp, err := c.call(ctx, opCreateSnapshot, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result SnapshotResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return &result, nil
+}
+
+// KeyStatus возвращает текущий ключ шифрования при хранении и число
+// сообщений под каждым ключом
+func (c *Client) KeyStatus(ctx context.Context) (*KeyStatus, error) {
+	return c.keyStatus(ctx, opGetKeyStatus)
+}
+
+// RotateKeys заставляет брокер перечитать набор ключей: новые сообщения
+// шифруются его текущим ключом, хранимые перешифровываются в фоне
+func (c *Client) RotateKeys(ctx context.Context) (*KeyStatus, error) {
+	return c.keyStatus(ctx, opRotateKeys)
+}
+
+func (c *Client) keyStatus(ctx context.Context, op operation) (*KeyStatus, error) {
+	resp, err := c.call(ctx, op, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var status KeyStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return &status, nil
+}
+
+// BrowsedMessage ожидающее сообщение, полученное просмотром очереди
+type BrowsedMessage struct {
+	Message
+	ID         uint64    `json:"id"`
+	Position   int       `json:"position"`
+	EnqueuedAt time.Time `json:"enqueued_at"`
+	// Size полный размер тела; Truncated сообщает, что Body обрезано
+	Size      int  `json:"size"`
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// Browse возвращает до limit ожидающих сообщений очереди начиная с offset,
+// не извлекая их, и общее число ожидающих сообщений. Тела обрезаются до
+// maxBody байт (0 — ограничение сервера по умолчанию).
+func (c *Client) Browse(ctx context.Context, queue string, offset, limit, maxBody int) ([]BrowsedMessage, int, error) {
+	query := url.Values{"offset": {strconv.Itoa(offset)}, "limit": {strconv.Itoa(limit)}}
+	if maxBody > 0 {
+		query.Set("max_body", strconv.Itoa(maxBody))
+	}
+	resp, err := c.call(ctx, opBrowseMessages, query, nil, queue)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	var result BrowseResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, 0, fmt.Errorf("decode response: %w", err)
+	}
+	messages := make([]BrowsedMessage, len(result.Messages))
+	for i, m := range result.Messages {
+		body, err := decodeBody(m.Message, m.MessageBase64)
+		if err != nil {
+			return nil, 0, err
+		}
+		messages[i] = BrowsedMessage{
+			Message:    Message{Body: body, Headers: m.Headers, DedupID: m.DedupID, ContentType: m.ContentType, GroupID: m.GroupID},
+			ID:         m.ID,
+			Position:   m.Position,
+			EnqueuedAt: m.EnqueuedAt,
+			Size:       m.Size,
+			Truncated:  m.Truncated,
+		}
+	}
+	return messages, result.Total, nil
+}
+
+// DeleteMessage удаляет сообщение очереди по идентификатору (см. Browse)
+func (c *Client) DeleteMessage(ctx context.Context, queue string, id uint64) error {
+	resp, err := c.call(ctx, opDeleteMessage, nil, nil, queue, strconv.FormatUint(id, 10))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// RequeueMessage возвращает сообщение для немедленной выдачи в очередь target
+// (пустая строка — та же очередь), например, из очереди недоставленных
+func (c *Client) RequeueMessage(ctx context.Context, queue string, id uint64, target string) error {
+	var query url.Values
+	if target != "" {
+		query = url.Values{"to": {target}}
+	}
+	resp, err := c.call(ctx, opRequeueMessage, query, nil, queue, strconv.FormatUint(id, 10))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Abandon возвращает сообщение, полученное в режиме peek-lock, в очередь для
+// повторной выдачи (с задержкой, если для очереди задана политика повторов)
+func (c *Client) Abandon(ctx context.Context, queue, lockToken string) error {
+	resp, err := c.call(ctx, opAbandonMessage, nil, nil, queue, lockToken)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Complete подтверждает обработку сообщения, полученного в режиме peek-lock
+func (c *Client) Complete(ctx context.Context, queue, lockToken string) error {
+	resp, err := c.call(ctx, opCompleteMessage, nil, nil, queue, lockToken)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// RenewLock продлевает блокировку сообщения и возвращает новый срок ее действия
+func (c *Client) RenewLock(ctx context.Context, queue, lockToken string, lockDuration time.Duration) (time.Time, error) {
+	body, _ := json.Marshal(RenewRequest{LockDuration: int(lockDuration.Round(time.Second) / time.Second)})
+	resp, err := c.call(ctx, opRenewLock, nil, body, queue, lockToken)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer resp.Body.Close()
+
+	var result RenewResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return time.Time{}, fmt.Errorf("decode response: %w", err)
+	}
+	return result.LockedUntil, nil
+}
+
+// call выполняет операцию op; params подставляются в параметры пути по порядку
+func (c *Client) call(ctx context.Context, op operation, query url.Values, body []byte, params ...string) (*http.Response, error) {
+	return c.do(ctx, op.method, c.operationURL(op, query, params...), body)
+}
+
+// operationURL строит URL операции: параметры пути в фигурных скобках
+// заменяются params по порядку, пути очередей в пространстве имен арендатора
+// имеют вид /v1/ns/{tenant}/queues/...
+func (c *Client) operationURL(op operation, query url.Values, params ...string) string {
+	var path strings.Builder
+	rest := op.path
+	for _, param := range params {
+		start := strings.IndexByte(rest, '{')
+		end := strings.IndexByte(rest, '}')
+		if start < 0 || end < start {
+			break
+		}
+		path.WriteString(rest[:start])
+		path.WriteString(url.PathEscape(param))
+		rest = rest[end+1:]
+	}
+	path.WriteString(rest)
+
+	u := c.baseURL
+	if rest, ok := strings.CutPrefix(path.String(), "/v1/queues/"); ok && c.Namespace != "" {
+		u += "/v1/ns/" + url.PathEscape(c.Namespace) + "/queues/" + rest
+	} else {
+		u += path.String()
+	}
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+// do выполняет запрос, повторяя его после сетевых ошибок и ответов 5xx.
+// Ответы, отличные от 2xx, превращаются в *APIError.
+func (c *Client) do(ctx context.Context, method, url string, body []byte) (*http.Response, error) {
+	return c.doWithHeader(ctx, method, url, body, nil)
+}
+
+// doWithHeader выполняет запрос с дополнительными заголовками; тело без
+// заданного Content-Type отправляется как JSON
+func (c *Client) doWithHeader(ctx context.Context, method, url string, body []byte, header http.Header) (*http.Response, error) {
+	return c.send(ctx, method, url, body, header, true)
+}
+
+// send выполняет запрос; без retry сетевая ошибка или ответ 5xx
+// возвращаются сразу, для неидемпотентных запросов
+func (c *Client) send(ctx context.Context, method, url string, body []byte, header http.Header, retry bool) (*http.Response, error) {
+	backoff := c.RetryBackoff
+	for {
+		req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		if body != nil && req.Header.Get("Content-Type") == "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if c.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.Token)
+		}
+		c.sign(req, body)
+
+		resp, err := c.HTTPClient.Do(req)
+		if err == nil && resp.StatusCode/100 == 2 {
+			return resp, nil
+		}
+		wait := backoff
+		if err == nil {
+			apiErr := newAPIError(resp)
+			// Время ожидания места производитель задал сам (Message.Wait), а
+			// повтор прерванного импорта поставил бы начало данных дважды
+			if resp.StatusCode < 500 || errors.Is(apiErr, ErrPutTimeout) || resp.Header.Get("X-Imported") != "" {
+				return nil, apiErr
+			}
+			// Брокер сам подсказывает, когда повторить
+			wait = max(wait, apiErr.RetryAfter)
+			err = apiErr
+		}
+		if !retry {
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w (last error: %v)", ctx.Err(), err)
+		case <-time.After(wait):
+		}
+		if backoff *= 2; backoff > c.MaxRetryBackoff {
+			backoff = c.MaxRetryBackoff
+		}
+	}
+}
+
+// sign подписывает запрос; каждая попытка получает новый nonce, поэтому
+// повтор после ошибки не отклоняется как воспроизведенный запрос
+func (c *Client) sign(req *http.Request, body []byte) {
+	if c.SigningSecret == nil {
+		return
+	}
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(signing.KeyHeader, c.SigningKeyID)
+	req.Header.Set(signing.TimestampHeader, timestamp)
+	req.Header.Set(signing.NonceHeader, hex.EncodeToString(nonce))
+	req.Header.Set(signing.SignatureHeader, signing.Sign(c.SigningSecret, req.Method, req.URL.RequestURI(), timestamp, hex.EncodeToString(nonce), body))
+}
+
+func newAPIError(resp *http.Response) *APIError {
+	defer resp.Body.Close()
+	text, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	apiErr := &APIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(text))}
+	// Брокер возвращает ошибки в JSON: {"error": {"code": ..., "message": ...}};
+	// прежние версии — простым текстом
+	var body ErrorResponse
+	if json.Unmarshal(text, &body) == nil && body.Error.Code != "" {
+		apiErr.Code = body.Error.Code
+		apiErr.Message = body.Error.Message
+		apiErr.Details = body.Error.Details
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		apiErr.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	return apiErr
+}
@@ -0,0 +1,596 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"queue-broker/pkg/broker"
+	"queue-broker/pkg/httpapi"
+	"queue-broker/pkg/objstore"
+	"queue-broker/pkg/openapi"
+)
+
+// fakeBroker минимальная имитация HTTP API брокера для проверки клиента
+type fakeBroker struct {
+	mu       sync.Mutex
+	messages []Message
+	failures int // сколько следующих запросов завершить ошибкой 503
+	gets     int
+}
+
+func (fb *fakeBroker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+
+	if fb.failures > 0 {
+		fb.failures--
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		var msg Message
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &msg); err != nil || msg.Body == "" {
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+		if msg.Body == "overflow" {
+			http.Error(w, "queue is full", http.StatusBadRequest)
+			return
+		}
+		if msg.Body == "full" {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Retry-After", "2")
+			w.WriteHeader(http.StatusTooManyRequests)
+			io.WriteString(w, `{"error": {"code": "QUEUE_FULL", "message": "Queue is full", "details": {"depth": 10, "capacity": 10}}}`)
+			return
+		}
+		fb.messages = append(fb.messages, msg)
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodDelete:
+		fb.gets++
+		if len(fb.messages) == 0 {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		msg := fb.messages[0]
+		fb.messages = fb.messages[1:]
+		json.NewEncoder(w).Encode(msg)
+	}
+}
+
+func newTestClient(fb *fakeBroker) (*Client, func()) {
+	server := httptest.NewServer(fb)
+	c := New(server.URL)
+	c.RetryBackoff = time.Millisecond
+	return c, server.Close
+}
+
+// TestClientPutGet проверяет работу клиента с настоящим HTTP API брокера
+func TestClientPutGet(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+	server := httptest.NewServer(httpapi.NewHandler(qb, nil))
+	defer server.Close()
+	c := New(server.URL)
+	ctx := context.Background()
+
+	if err := c.Put(ctx, "jobs", Message{Body: "job 1", Headers: map[string]string{"type": "a"}}); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := c.Get(ctx, "jobs", GetOptions{Timeout: time.Second, PeekLock: true, Consumer: "w1"})
+	if err != nil || msg.Body != "job 1" || msg.Headers["type"] != "a" || msg.LockToken == "" {
+		t.Fatalf("unexpected message: %+v %v", msg, err)
+	}
+	if consumers := qb.RegisteredConsumers("jobs"); len(consumers) != 1 || consumers[0].InFlight != 1 {
+		t.Errorf("consumer was not registered: %+v", consumers)
+	}
+	if until := time.Until(msg.LeaseDeadline); until <= 20*time.Second || until > 30*time.Second {
+		t.Errorf("unexpected lease deadline: %v", msg.LeaseDeadline)
+	}
+	if err := c.Complete(ctx, "jobs", msg.LockToken); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Complete(ctx, "jobs", msg.LockToken); !errors.Is(err, ErrLockLost) {
+		t.Errorf("expected ErrLockLost, got %v", err)
+	}
+	if _, err := c.Get(ctx, "missing", GetOptions{Timeout: time.Second}); !errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("expected ErrQueueNotFound, got %v", err)
+	}
+}
+
+// TestClientH2C проверяет работу клиента по HTTP/2 без TLS
+func TestClientH2C(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httpapi.NewServer("", httpapi.NewHandler(broker.NewQueueBroker(100, 10, 10), nil), httpapi.ServerConfig{})
+	go server.Serve(listener)
+	defer server.Close()
+
+	c := NewH2C("http://" + listener.Addr().String())
+	ctx := context.Background()
+	if err := c.Put(ctx, "jobs", Message{Body: "over h2c"}); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := c.Get(ctx, "jobs", GetOptions{Timeout: time.Second})
+	if err != nil || msg.Body != "over h2c" {
+		t.Fatalf("unexpected message: %+v %v", msg, err)
+	}
+}
+
+// TestClientUnixSocket проверяет работу клиента через сокет Unix
+func TestClientUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "qb.sock")
+	listener, err := httpapi.Listen("unix://" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httpapi.NewServer("", httpapi.NewHandler(broker.NewQueueBroker(100, 10, 10), nil), httpapi.ServerConfig{})
+	go server.Serve(listener)
+	defer server.Close()
+
+	c := New("unix://" + path)
+	ctx := context.Background()
+	if err := c.Put(ctx, "jobs", Message{Body: "over unix socket"}); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := c.Get(ctx, "jobs", GetOptions{Timeout: time.Second})
+	if err != nil || msg.Body != "over unix socket" {
+		t.Fatalf("unexpected message: %+v %v", msg, err)
+	}
+}
+
+// TestClientRetries проверяет повтор запросов после 5xx и повтор long-poll на пустой очереди
+func TestClientRetries(t *testing.T) {
+	fb := &fakeBroker{failures: 2}
+	c, stop := newTestClient(fb)
+	defer stop()
+	ctx := context.Background()
+
+	if err := c.Put(ctx, "jobs", Message{Body: "job 1", DedupID: "job-1"}); err != nil {
+		t.Fatalf("put with a dedup id was not retried after 503: %v", err)
+	}
+	c.Get(ctx, "jobs", GetOptions{})
+
+	// Без DedupID повтор мог бы поставить сообщение дважды
+	fb.failures = 2
+	var apiErr *APIError
+	if err := c.Put(ctx, "jobs", Message{Body: "job 2"}); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable || fb.failures != 1 {
+		t.Fatalf("put without a dedup id was retried: %v, %d failures left", err, fb.failures)
+	}
+	fb.failures = 0
+
+	_, err := c.Get(ctx, "jobs", GetOptions{MaxAttempts: 3})
+	if !errors.Is(err, ErrEmpty) || fb.gets != 4 {
+		t.Errorf("expected ErrEmpty after 3 attempts, got %v after %d requests", err, fb.gets)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.Get(ctx, "jobs", GetOptions{}); !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, ErrEmpty) {
+		t.Errorf("expected context error, got %v", err)
+	}
+}
+
+// TestClientTypedErrors проверяет сопоставление ответов брокера с ошибками пакета
+func TestClientTypedErrors(t *testing.T) {
+	fb := &fakeBroker{}
+	c, stop := newTestClient(fb)
+	defer stop()
+	ctx := context.Background()
+
+	if err := c.Put(ctx, "jobs", Message{Body: "overflow"}); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("expected ErrQueueFull, got %v", err)
+	}
+
+	var apiErr *APIError
+	if err := c.Put(ctx, "jobs", Message{}); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected *APIError with 400, got %v", err)
+	}
+	// Ответ 429 с телом JSON и паузой до повтора
+	err := c.Put(ctx, "jobs", Message{Body: "full"})
+	if !errors.Is(err, ErrQueueFull) || !errors.As(err, &apiErr) || apiErr.RetryAfter != 2*time.Second || apiErr.Code != "QUEUE_FULL" || errors.Is(err, ErrTooManyQueues) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+// TestClientPutBatch проверяет атомарную постановку пакетов через PUT /publish
+// и ошибки непоставленных сообщений
+func TestClientPutBatch(t *testing.T) {
+	qb := broker.NewQueueBroker(120, 10, 1)
+	server := httptest.NewServer(httpapi.NewHandler(qb, nil))
+	defer server.Close()
+	c := New(server.URL)
+	ctx := context.Background()
+
+	if err := c.PutBatch(ctx, "jobs", []Message{{Body: "\xff\x00binary", Headers: map[string]string{"kind": "raw"}}}); err != nil {
+		t.Fatalf("put batch: %v", err)
+	}
+	got, err := c.Get(ctx, "jobs", GetOptions{MaxAttempts: 1})
+	if err != nil || got.Body != "\xff\x00binary" || got.Headers["kind"] != "raw" {
+		t.Fatalf("binary body was not preserved: %+v, %v", got, err)
+	}
+
+	// Первый пакет из 100 сообщений помещается, второй из 50 — нет
+	msgs := make([]Message, 150)
+	for i := range msgs {
+		msgs[i] = Message{Body: "job"}
+	}
+	err = c.PutBatch(ctx, "jobs", msgs)
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) || len(batchErr.Errors) != 50 || batchErr.Errors[99] != nil || !errors.Is(batchErr.Errors[100], ErrQueueFull) || batchErr.Errors[149] == nil {
+		t.Fatalf("expected errors for messages 100-149, got %v", err)
+	}
+	if depth := qb.Depth("jobs"); depth != 100 {
+		t.Errorf("expected the first batch only, depth %d", depth)
+	}
+}
+
+// TestClientRESTStatusCodes проверяет ошибки клиента с брокером, отвечающим
+// кодами --rest-status-codes
+func TestClientRESTStatusCodes(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 1)
+	server := httptest.NewServer(httpapi.NewHandler(qb, nil, httpapi.WithRESTStatusCodes()))
+	defer server.Close()
+	c := New(server.URL)
+	ctx := context.Background()
+
+	if _, err := c.Get(ctx, "missing", GetOptions{MaxAttempts: 1}); !errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("expected ErrQueueNotFound, got %v", err)
+	}
+	qb.CreateQueue("jobs")
+	if _, err := c.Get(ctx, "jobs", GetOptions{MaxAttempts: 2}); !errors.Is(err, ErrEmpty) {
+		t.Errorf("expected ErrEmpty, got %v", err)
+	}
+}
+
+// TestClientPutWait проверяет ожидание места в очереди с overflow=block
+func TestClientPutWait(t *testing.T) {
+	qb := broker.NewQueueBroker(1, 10, 10)
+	qb.SetQueueConfig("jobs", broker.QueueConfig{LockDuration: 30, Overflow: broker.OverflowBlock})
+	server := httptest.NewServer(httpapi.NewHandler(qb, nil))
+	defer server.Close()
+	c := New(server.URL)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := c.Put(ctx, "jobs", Message{Body: "first"}); err != nil {
+		t.Fatal(err)
+	}
+	// Ответ PUT_TIMEOUT не повторяется: время ожидания задал производитель
+	if err := c.Put(ctx, "jobs", Message{Body: "second", Wait: 50 * time.Millisecond}); !errors.Is(err, ErrPutTimeout) || errors.Is(err, ErrQueueFull) {
+		t.Errorf("expected ErrPutTimeout, got %v", err)
+	}
+}
+
+// TestClientStats проверяет получение статистики очереди
+func TestClientStats(t *testing.T) {
+	server := httptest.NewServer(httpapi.NewHandler(broker.NewQueueBroker(100, 10, 10), nil))
+	defer server.Close()
+	c := New(server.URL)
+	ctx := context.Background()
+
+	if _, err := c.Stats(ctx, "jobs"); !errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("expected ErrQueueNotFound, got %v", err)
+	}
+	if err := c.Put(ctx, "jobs", Message{Body: "job"}); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := c.Stats(ctx, "jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Name != "jobs" || stats.Depth != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+// TestClientExportImport проверяет перенос сообщений между очередями через
+// NDJSON; загрузка больше importChunkSize идет несколькими запросами
+func TestClientExportImport(t *testing.T) {
+	qb := broker.NewQueueBroker(1000, 10, 10)
+	server := httptest.NewServer(httpapi.NewHandler(qb, nil))
+	defer server.Close()
+	c := New(server.URL)
+	ctx := context.Background()
+
+	body := strings.Repeat("x", 1000)
+	for range 300 {
+		qb.Enqueue("jobs", &broker.Message{Body: body})
+	}
+	var exported bytes.Buffer
+	count, err := c.Export(ctx, "jobs", &exported)
+	if err != nil || count != 300 {
+		t.Fatalf("export: %d %v", count, err)
+	}
+	result, err := c.Import(ctx, "copy", &exported)
+	if err != nil || result.Imported != 300 {
+		t.Fatalf("import: %+v %v", result, err)
+	}
+	if depth := qb.Depth("copy"); depth != 300 {
+		t.Errorf("unexpected depth %d", depth)
+	}
+	if _, err := c.Import(ctx, "copy", strings.NewReader("not json")); err == nil {
+		t.Error("expected error for invalid line")
+	}
+}
+
+// TestClientReadLog проверяет перечитывание журнала очереди с хранением
+func TestClientReadLog(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 1)
+	qb.SetQueueConfig("events", broker.QueueConfig{LockDuration: 30, Retention: 3600})
+	server := httptest.NewServer(httpapi.NewHandler(qb, nil))
+	defer server.Close()
+	c := New(server.URL)
+	ctx := context.Background()
+
+	for _, body := range []string{"first", "second"} {
+		if err := c.Put(ctx, "events", Message{Body: body}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var offset uint64
+	for _, want := range []string{"first", "second"} {
+		msg, read, err := c.ReadLog(ctx, "events", offset, time.Second)
+		if err != nil || msg.Body != want {
+			t.Fatalf("offset %d: got %+v %v", offset, msg, err)
+		}
+		offset = read + 1
+	}
+	if _, _, err := c.ReadLog(ctx, "events", offset, 10*time.Millisecond); !errors.Is(err, ErrEmpty) {
+		t.Errorf("expected ErrEmpty, got %v", err)
+	}
+	c.Put(ctx, "plain", Message{Body: "x"})
+	if _, _, err := c.ReadLog(ctx, "plain", 0, 0); !errors.Is(err, ErrNoRetention) {
+		t.Errorf("expected ErrNoRetention, got %v", err)
+	}
+}
+
+// TestClientCommitOffset проверяет продолжение чтения журнала группой
+// с зафиксированного смещения
+func TestClientCommitOffset(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 1)
+	qb.SetQueueConfig("events", broker.QueueConfig{LockDuration: 30, Retention: 3600})
+	server := httptest.NewServer(httpapi.NewHandler(qb, nil))
+	defer server.Close()
+	c := New(server.URL)
+	ctx := context.Background()
+
+	for _, body := range []string{"first", "second"} {
+		c.Put(ctx, "events", Message{Body: body})
+	}
+	for _, want := range []string{"first", "second"} {
+		msg, read, err := c.ReadGroup(ctx, "events", "billing", time.Second)
+		if err != nil || msg.Body != want {
+			t.Fatalf("read: got %+v %v", msg, err)
+		}
+		if err := c.CommitOffset(ctx, "events", "billing", read+1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	offsets, err := c.Offsets(ctx, "events")
+	if err != nil || offsets.Next != 2 || offsets.Groups["billing"] != 2 {
+		t.Errorf("offsets: got %+v %v", offsets, err)
+	}
+	if err := c.CommitOffset(ctx, "events", "billing", 5); !errors.Is(err, ErrInvalidOffset) {
+		t.Errorf("expected ErrInvalidOffset, got %v", err)
+	}
+}
+
+// TestClientSigning проверяет подпись запросов клиентом
+func TestClientSigning(t *testing.T) {
+	verifier := httpapi.NewRequestVerifier(httpapi.SigningConfig{Keys: map[string]string{"app": "secret"}})
+	server := httptest.NewServer(httpapi.NewHandler(broker.NewQueueBroker(100, 10, 10), nil, httpapi.WithRequestVerifier(verifier)))
+	defer server.Close()
+	ctx := context.Background()
+
+	if err := New(server.URL).Put(ctx, "jobs", Message{Body: "job"}); err == nil {
+		t.Error("expected unsigned request to fail")
+	}
+	c := New(server.URL)
+	c.SigningKeyID, c.SigningSecret = "app", []byte("secret")
+	for i := 0; i < 2; i++ {
+		if err := c.Put(ctx, "jobs", Message{Body: "job"}); err != nil {
+			t.Fatalf("signed put %d failed: %v", i, err)
+		}
+	}
+	if msg, err := c.Get(ctx, "jobs", GetOptions{}); err != nil || msg.Body != "job" {
+		t.Errorf("unexpected message: %+v %v", msg, err)
+	}
+}
+
+// TestClientBinary проверяет отправку и получение двоичного тела
+func TestClientBinary(t *testing.T) {
+	server := httptest.NewServer(httpapi.NewHandler(broker.NewQueueBroker(100, 10, 10), nil))
+	defer server.Close()
+	c := New(server.URL)
+	ctx := context.Background()
+
+	payload := string([]byte{0x00, 0xff, 0x80, 'x'})
+	if err := c.Put(ctx, "blobs", Message{Body: payload, ContentType: "application/octet-stream", Headers: map[string]string{"kind": "raw"}}); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := c.Get(ctx, "blobs", GetOptions{})
+	if err != nil || msg.Body != payload || msg.Headers["kind"] != "raw" || msg.ContentType != "application/octet-stream" {
+		t.Errorf("unexpected message: %+v %v", msg, err)
+	}
+}
+
+// TestClientNamespace проверяет работу с очередями арендатора
+func TestClientNamespace(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+	qb.AddTenant(broker.Tenant{ID: "acme", Key: make([]byte, 32), Token: "acme-token"})
+	server := httptest.NewServer(httpapi.NewHandler(qb, nil))
+	defer server.Close()
+	c := New(server.URL)
+	c.Namespace, c.Token = "acme", "acme-token"
+	ctx := context.Background()
+
+	if err := c.Put(ctx, "jobs", Message{Body: "job"}); err != nil {
+		t.Fatal(err)
+	}
+	if qb.Depth("@acme.jobs") != 1 {
+		t.Fatalf("message is not stored in the tenant queue")
+	}
+	if msg, err := c.Get(ctx, "jobs", GetOptions{}); err != nil || msg.Body != "job" {
+		t.Errorf("unexpected message: %+v %v", msg, err)
+	}
+
+	// Блокировки адресуются токеном в пути /v1/ns/{tenant}/queues/{name}/leases/{token}
+	c.Put(ctx, "jobs", Message{Body: "locked"})
+	msg, err := c.Get(ctx, "jobs", GetOptions{PeekLock: true})
+	if err != nil || msg.LockToken == "" {
+		t.Fatalf("unexpected message: %+v %v", msg, err)
+	}
+	if _, err := c.RenewLock(ctx, "jobs", msg.LockToken, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Complete(ctx, "jobs", msg.LockToken); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestClientAdmin проверяет список очередей, очистку и потоковое получение
+func TestClientAdmin(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+	qb.AddTenant(broker.Tenant{ID: "acme", Key: make([]byte, 32), Token: "acme-token"})
+	qb.Enqueue("@other.jobs", &broker.Message{Body: "foreign"})
+	server := httptest.NewServer(httpapi.NewHandler(qb, nil))
+	defer server.Close()
+	c := New(server.URL)
+	c.Namespace, c.Token = "acme", "acme-token"
+	ctx := context.Background()
+
+	for _, body := range []string{"a", "bb"} {
+		if err := c.Put(ctx, "jobs", Message{Body: body}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	queues, err := c.Queues(ctx)
+	if err != nil || len(queues) != 1 || queues[0].Name != "jobs" || queues[0].Depth != 2 {
+		t.Fatalf("unexpected queues: %+v %v", queues, err)
+	}
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	var received []string
+	err = c.Stream(streamCtx, "jobs", func(msg *Message) error {
+		received = append(received, msg.Body)
+		if len(received) == 2 {
+			cancel()
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) || len(received) != 2 || received[0] != "a" {
+		t.Errorf("unexpected stream result: %v %v", received, err)
+	}
+
+	c.Put(ctx, "jobs", Message{Body: "c"})
+	browsed, total, err := c.Browse(ctx, "jobs", 0, 10, 0)
+	if err != nil || total != 1 || len(browsed) != 1 || browsed[0].Body != "c" || browsed[0].Position != 1 {
+		t.Errorf("unexpected browse result: %+v %d %v", browsed, total, err)
+	}
+	if err := c.RequeueMessage(ctx, "jobs", browsed[0].ID, ""); err != nil {
+		t.Errorf("unexpected requeue error: %v", err)
+	}
+	if err := c.DeleteMessage(ctx, "jobs", 0); err == nil {
+		t.Error("expected error deleting unknown message")
+	}
+	if count, err := c.Purge(ctx, "jobs"); err != nil || count != 1 {
+		t.Errorf("unexpected purge result: %d %v", count, err)
+	}
+	if qb.Depth("@acme.jobs") != 0 || qb.Depth("@other.jobs") != 1 {
+		t.Errorf("purge affected wrong queues")
+	}
+	if err := c.Pause(ctx, "jobs"); err != nil || !qb.Paused("@acme.jobs") || qb.Paused("@other.jobs") {
+		t.Errorf("unexpected pause result: %v", err)
+	}
+	if err := c.Resume(ctx, "jobs"); err != nil || qb.Paused("@acme.jobs") {
+		t.Errorf("unexpected resume result: %v", err)
+	}
+}
+
+// TestClientSnapshot проверяет запись снимка брокера
+func TestClientSnapshot(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+	qb.PutMessage("jobs", "job")
+	dir := t.TempDir()
+	server := httptest.NewServer(httpapi.NewHandler(qb, nil, httpapi.WithSnapshots(objstore.Dir{Path: dir})))
+	defer server.Close()
+
+	result, err := New(server.URL).Snapshot(context.Background())
+	if err != nil || result.Queues != 1 || result.Messages != 1 || !strings.HasPrefix(result.Location, dir) || result.CreatedAt.IsZero() {
+		t.Fatalf("unexpected snapshot result: %+v %v", result, err)
+	}
+}
+
+func TestClientKeys(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+	keyring := &broker.Keyring{Current: "k1", Keys: map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}}
+	server := httptest.NewServer(httpapi.NewHandler(qb, nil, httpapi.WithKeySource(func() (*broker.Keyring, error) { return keyring, nil })))
+	defer server.Close()
+	c := New(server.URL)
+
+	if status, err := c.KeyStatus(context.Background()); err != nil || status.Current != "" {
+		t.Fatalf("unexpected status: %+v %v", status, err)
+	}
+	if status, err := c.RotateKeys(context.Background()); err != nil || status.Current != "k1" || len(status.Keys) != 1 {
+		t.Fatalf("unexpected rotation: %+v %v", status, err)
+	}
+}
+
+// TestClientSchedules проверяет создание, список и удаление расписаний
+func TestClientSchedules(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+	server := httptest.NewServer(httpapi.NewHandler(qb, nil))
+	defer server.Close()
+	c := New(server.URL)
+	ctx := context.Background()
+
+	saved, err := c.SetSchedule(ctx, Schedule{Cron: "@daily", Queue: "heartbeats", Message: "ping"})
+	if err != nil || saved.ID == "" || saved.Next.IsZero() {
+		t.Fatalf("unexpected schedule: %+v %v", saved, err)
+	}
+	if _, err := c.SetSchedule(ctx, Schedule{ID: saved.ID, Cron: "@hourly", Queue: "heartbeats", Message: "ping"}); err != nil {
+		t.Errorf("unexpected replace error: %v", err)
+	}
+	if list, err := c.Schedules(ctx); err != nil || len(list) != 1 || list[0].Cron != "@hourly" {
+		t.Errorf("unexpected schedules: %+v %v", list, err)
+	}
+	if err := c.DeleteSchedule(ctx, saved.ID); err != nil {
+		t.Errorf("unexpected delete error: %v", err)
+	}
+	if err := c.DeleteSchedule(ctx, saved.ID); err == nil {
+		t.Error("expected error deleting unknown schedule")
+	}
+}
+
+// TestGeneratedUpToDate проверяет, что openapi_gen.go сгенерирован по текущей
+// спецификации; после ее изменения нужно выполнить go generate ./pkg/client
+func TestGeneratedUpToDate(t *testing.T) {
+	want, err := openapi.Generate(httpapi.OpenAPISpec, "client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile("openapi_gen.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("openapi_gen.go is out of date, run go generate ./pkg/client")
+	}
+}
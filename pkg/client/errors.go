@@ -0,0 +1,93 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrEmpty сообщение не появилось в очереди за время ожидания
+	ErrEmpty = errors.New("queue is empty")
+	// ErrQueueNotFound очередь не существует
+	ErrQueueNotFound = errors.New("queue does not exist")
+	// ErrQueueFull очередь заполнена
+	ErrQueueFull = errors.New("queue is full")
+	// ErrTooManyQueues достигнуто максимальное число очередей
+	ErrTooManyQueues = errors.New("maximum number of queues reached")
+	// ErrPutTimeout в очереди с политикой overflow=block не освободилось место
+	// за Message.Wait
+	ErrPutTimeout = errors.New("no space in queue within timeout")
+	// ErrLockLost блокировка peek-lock истекла или не существует
+	ErrLockLost = errors.New("lock not found or expired")
+	// ErrNoRetention для очереди не задано хранение сообщений в журнале (ReadLog)
+	ErrNoRetention = errors.New("retention is not configured for queue")
+	// ErrInvalidOffset смещение за концом журнала очереди (CommitOffset)
+	ErrInvalidOffset = errors.New("offset is beyond the end of the log")
+)
+
+// APIError ответ брокера с кодом, отличным от 200
+type APIError struct {
+	StatusCode int
+	// Code машиночитаемый код ошибки, например QUEUE_FULL или NO_MESSAGE;
+	// пустой у ответов прежних версий брокера
+	Code    string
+	Message string
+	// Details подробности ошибки в JSON, если брокер их передал
+	Details json.RawMessage
+	// RetryAfter пауза перед повтором из заголовка Retry-After (например,
+	// при заполненной очереди), ноль — брокер ее не указал
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("broker returned %d: %s", e.StatusCode, e.Message)
+}
+
+// errorCodes коды ошибок брокера, соответствующие ошибкам пакета
+var errorCodes = map[error]string{
+	ErrEmpty:         "NO_MESSAGE",
+	ErrQueueNotFound: "QUEUE_NOT_FOUND",
+	ErrQueueFull:     "QUEUE_FULL",
+	ErrTooManyQueues: "TOO_MANY_QUEUES",
+	ErrPutTimeout:    "PUT_TIMEOUT",
+	ErrLockLost:      "LOCK_NOT_FOUND",
+	ErrNoRetention:   "NO_RETENTION",
+	ErrInvalidOffset: "INVALID_OFFSET",
+}
+
+// Is сопоставляет ответ брокера с ошибками ErrEmpty, ErrQueueFull и т.д.:
+// по коду ошибки, а у ответов прежних версий брокера — по статусу и тексту
+func (e *APIError) Is(target error) bool {
+	if e.Code != "" {
+		code, ok := errorCodes[target]
+		return ok && e.Code == code
+	}
+	switch target {
+	case ErrEmpty:
+		return e.StatusCode == http.StatusNotFound
+	case ErrLockLost:
+		return e.StatusCode == http.StatusGone
+	case ErrQueueNotFound:
+		return e.StatusCode == http.StatusBadRequest && strings.EqualFold(e.Message, target.Error())
+	case ErrQueueFull, ErrTooManyQueues:
+		// Прежние версии брокера отвечали на нехватку места 400
+		switch e.StatusCode {
+		case http.StatusBadRequest, http.StatusTooManyRequests, http.StatusServiceUnavailable:
+			return strings.EqualFold(e.Message, target.Error())
+		}
+	}
+	return false
+}
+
+// BatchError ошибки непоставленных сообщений PutBatch, ключ — индекс сообщения
+type BatchError struct {
+	Errors map[int]error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("%d messages failed", len(e.Errors))
+}
@@ -0,0 +1,369 @@
+package cluster
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"queue-broker/pkg/broker"
+	"queue-broker/pkg/httperr"
+	"queue-broker/pkg/peer"
+)
+
+const (
+	// ForwardedHeader отмечает запрос, уже пересланный другим узлом: такой
+	// запрос обслуживается локально, даже если узлы по-разному видят состав
+	// кластера, поэтому пересылка не зацикливается
+	ForwardedHeader = "X-Broker-Forwarded-By"
+	// handoffBatchSize сколько сообщений переносится одним запросом
+	handoffBatchSize = 100
+	// handoffLock на сколько блокируется переносимое сообщение
+	handoffLock = 30 * time.Second
+)
+
+// Handoff сообщение, переносимое на узел-владелец очереди
+type Handoff struct {
+	Queue string `json:"queue"`
+	// Body передается байтами (base64 в JSON), чтобы не искажать двоичные тела
+	Body        []byte            `json:"body"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	DedupID     string            `json:"dedup_id,omitempty"`
+	ContentType string            `json:"content_type,omitempty"`
+	GroupID     string            `json:"group_id,omitempty"`
+}
+
+// HandoffResult ответ узла на перенос: сколько сообщений пакета принято по порядку
+type HandoffResult struct {
+	Accepted int    `json:"accepted"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Partitioner распределяет очереди между узлами кластера
+type Partitioner struct {
+	qb     *broker.QueueBroker
+	self   string
+	client *http.Client
+	secret string
+
+	mu      sync.Mutex
+	ring    *Ring
+	proxies map[string]*httputil.ReverseProxy
+	// lastError ошибка последнего переноса; lastFailure не сбрасывается после успеха
+	lastError     error
+	lastFailure   error
+	lastFailureAt time.Time
+
+	// rebalanceMu не дает двум переносам идти одновременно
+	rebalanceMu sync.Mutex
+	interval    time.Duration
+	done        chan struct{}
+	closeOnce   sync.Once
+}
+
+// NewPartitioner создает распределение очередей для узла self (его базовый URL
+// должен входить в nodes). interval — период проверки очередей, которые
+// принадлежат другим узлам.
+func NewPartitioner(qb *broker.QueueBroker, self string, nodes []string, interval time.Duration) *Partitioner {
+	p := &Partitioner{
+		qb:       qb,
+		self:     strings.TrimRight(self, "/"),
+		client:   &http.Client{Timeout: 10 * time.Second},
+		proxies:  make(map[string]*httputil.ReverseProxy),
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+	p.setRing(nodes)
+	return p
+}
+
+// SetPeerSecret задает общий секрет, который передается другим узлам при
+// переносе сообщений (см. пакет peer); вызывается до Start
+func (p *Partitioner) SetPeerSecret(secret string) {
+	p.secret = secret
+}
+
+// Start запускает периодический перенос чужих очередей
+func (p *Partitioner) Start() {
+	go func() {
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.Rebalance()
+			case <-p.done:
+				return
+			}
+		}
+	}()
+}
+
+// Close останавливает перенос
+func (p *Partitioner) Close() {
+	p.closeOnce.Do(func() { close(p.done) })
+}
+
+// Self возвращает URL этого узла
+func (p *Partitioner) Self() string {
+	return p.self
+}
+
+// Nodes возвращает текущий состав кластера
+func (p *Partitioner) Nodes() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.ring.Nodes()
+}
+
+// SetNodes меняет состав кластера и запускает перенос очередей,
+// которые теперь принадлежат другим узлам
+func (p *Partitioner) SetNodes(nodes []string) {
+	p.setRing(nodes)
+	go p.Rebalance()
+}
+
+func (p *Partitioner) setRing(nodes []string) {
+	trimmed := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		trimmed = append(trimmed, strings.TrimRight(strings.TrimSpace(node), "/"))
+	}
+	ring := NewRing(trimmed)
+	p.mu.Lock()
+	p.ring = ring
+	p.mu.Unlock()
+}
+
+// Owner возвращает узел-владелец очереди (по внутреннему имени)
+func (p *Partitioner) Owner(queueName string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if owner := p.ring.Owner(queueName); owner != "" {
+		return owner
+	}
+	return p.self
+}
+
+// Forward пересылает запрос владельцу очереди, если это другой узел;
+// возвращает false, если запрос нужно обслужить локально
+func (p *Partitioner) Forward(w http.ResponseWriter, r *http.Request, queueName string) bool {
+	if r.Header.Get(ForwardedHeader) != "" {
+		return false
+	}
+	owner := p.Owner(queueName)
+	if owner == p.self {
+		return false
+	}
+	proxy, err := p.proxy(owner)
+	if err != nil {
+		httperr.Error(w, "Invalid cluster node", http.StatusBadGateway)
+		return true
+	}
+	proxy.ServeHTTP(w, r)
+	return true
+}
+
+func (p *Partitioner) proxy(node string) (*httputil.ReverseProxy, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if proxy, ok := p.proxies[node]; ok {
+		return proxy, nil
+	}
+	target, err := url.Parse(node)
+	if err != nil {
+		return nil, err
+	}
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.Out.Header.Set(ForwardedHeader, p.self)
+		},
+		// Потоковые ответы (/stream) передаются без буферизации
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Printf("cluster: forward to %s failed: %v", node, err)
+			httperr.Error(w, "Queue owner unavailable", http.StatusBadGateway)
+		},
+	}
+	p.proxies[node] = proxy
+	return proxy, nil
+}
+
+// Rebalance переносит сообщения очередей, принадлежащих другим узлам, их
+// владельцам. Сообщение удаляется локально только после того, как владелец
+// его принял; повторная доставка распознается по DedupID.
+func (p *Partitioner) Rebalance() {
+	p.rebalanceMu.Lock()
+	defer p.rebalanceMu.Unlock()
+
+	var failed error
+	for _, name := range p.qb.QueueNames() {
+		if name == broker.CanaryQueue {
+			continue
+		}
+		owner := p.Owner(name)
+		if owner == p.self {
+			continue
+		}
+		if err := p.handoffQueue(name, owner); err != nil {
+			log.Printf("cluster: moving queue %s to %s: %v", name, owner, err)
+			failed = fmt.Errorf("moving queue %s to %s: %w", name, owner, err)
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lastError = failed
+	if failed != nil {
+		p.lastFailure, p.lastFailureAt = failed, time.Now()
+	}
+}
+
+// Health сообщает состояние распределения для /healthz: оно деградировано,
+// если последний перенос чужих очередей не удался
+func (p *Partitioner) Health() broker.SubsystemHealth {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	h := broker.SubsystemHealth{Status: broker.HealthOK, Detail: map[string]any{"self": p.self, "nodes": p.ring.Nodes()}}
+	if p.lastError != nil {
+		h.Status = broker.HealthDegraded
+	}
+	if p.lastFailure != nil {
+		at := p.lastFailureAt
+		h.LastError, h.LastErrorAt = p.lastFailure.Error(), &at
+	}
+	return h
+}
+
+// handoffQueue переносит все доступные сообщения очереди пакетами
+func (p *Partitioner) handoffQueue(queueName, owner string) error {
+	for {
+		var deliveries []*broker.Delivery
+		for len(deliveries) < handoffBatchSize {
+			delivery, err := p.qb.PeekLock(queueName, 0, handoffLock)
+			if err != nil {
+				break
+			}
+			deliveries = append(deliveries, delivery)
+		}
+		if len(deliveries) == 0 {
+			return nil
+		}
+
+		accepted, err := p.sendHandoff(owner, deliveries)
+		for i, delivery := range deliveries {
+			if i < accepted {
+				p.qb.Complete(queueName, delivery.LockToken)
+			} else {
+				p.qb.Abandon(queueName, delivery.LockToken)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (p *Partitioner) sendHandoff(owner string, deliveries []*broker.Delivery) (int, error) {
+	batch := make([]Handoff, len(deliveries))
+	for i, delivery := range deliveries {
+		batch[i] = Handoff{
+			Queue:       delivery.Queue,
+			Body:        []byte(delivery.Body),
+			Headers:     delivery.Headers,
+			DedupID:     delivery.DedupID,
+			ContentType: delivery.ContentType,
+			GroupID:     delivery.GroupID,
+		}
+	}
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequest(http.MethodPost, owner+"/cluster/handoff", bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(ForwardedHeader, p.self)
+	peer.Sign(req, p.secret)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("owner responded %s", resp.Status)
+	}
+	var result HandoffResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("decode handoff response: %w", err)
+	}
+	if result.Error != "" {
+		return result.Accepted, errors.New(result.Error)
+	}
+	return result.Accepted, nil
+}
+
+// HandoffHandler обрабатывает POST /cluster/handoff: принимает сообщения,
+// переносимые другим узлом, без маршрутизации. Запросы других узлов
+// проверяет peer.Require (см. httpapi.NewHandler). Прием останавливается на
+// первой ошибке, в ответе сообщается число принятых сообщений.
+func (p *Partitioner) HandoffHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			httperr.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var batch []Handoff
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+			httperr.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+
+		var result HandoffResult
+		for _, item := range batch {
+			msg := &broker.Message{Body: string(item.Body), Headers: item.Headers, DedupID: item.DedupID, ContentType: item.ContentType, GroupID: item.GroupID}
+			if err := p.qb.EnqueueReplicated(item.Queue, msg); err != nil && !errors.Is(err, broker.ErrDuplicate) {
+				result.Error = err.Error()
+				break
+			}
+			result.Accepted++
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+// NodesHandler обрабатывает GET/PUT /cluster/nodes: текущий состав кластера
+// и его замена (например, при добавлении узла); доступен с общим секретом
+// брокеров, как и HandoffHandler
+func (p *Partitioner) NodesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			var request struct {
+				Nodes []string `json:"nodes"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil || len(request.Nodes) == 0 {
+				httperr.Error(w, "Bad request", http.StatusBadRequest)
+				return
+			}
+			p.SetNodes(request.Nodes)
+		default:
+			httperr.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"self": p.self, "nodes": p.Nodes()})
+	}
+}
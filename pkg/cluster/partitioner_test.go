@@ -0,0 +1,76 @@
+package cluster
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"queue-broker/pkg/broker"
+	"queue-broker/pkg/peer"
+)
+
+// TestRebalanceHandoff проверяет перенос сообщений чужой очереди владельцу
+// после смены состава кластера
+func TestRebalanceHandoff(t *testing.T) {
+	local := broker.NewQueueBroker(100, 10, 1)
+	remote := broker.NewQueueBroker(100, 10, 1)
+
+	remoteMux := http.NewServeMux()
+	remoteServer := httptest.NewServer(remoteMux)
+	defer remoteServer.Close()
+	remotePart := NewPartitioner(remote, remoteServer.URL, []string{remoteServer.URL}, time.Hour)
+	remoteMux.Handle("/cluster/handoff", peer.Require("s3cret", remotePart.HandoffHandler()))
+
+	p := NewPartitioner(local, "http://local", []string{"http://local"}, time.Hour)
+	p.SetPeerSecret("s3cret")
+	payload := string([]byte{0x00, 0xff})
+	local.Enqueue("jobs", &broker.Message{Body: payload, Headers: map[string]string{"k": "v"}, DedupID: "d-1"})
+	local.Enqueue("jobs", &broker.Message{Body: "second"})
+	local.Enqueue(broker.CanaryQueue, &broker.Message{Body: "ping"})
+
+	// Единственный узел кластера — удаленный: все очереди переносятся к нему
+	p.setRing([]string{remoteServer.URL})
+	p.Rebalance()
+
+	if local.Depth("jobs") != 0 || remote.Depth("jobs") != 2 {
+		t.Fatalf("messages not moved: local=%d remote=%d", local.Depth("jobs"), remote.Depth("jobs"))
+	}
+	if local.Depth(broker.CanaryQueue) != 1 {
+		t.Error("canary queue must stay local")
+	}
+	msg, err := remote.Dequeue("jobs", 0)
+	if err != nil || msg.Body != payload || msg.Headers["k"] != "v" || msg.DedupID != "d-1" {
+		t.Errorf("unexpected moved message %+v %v", msg, err)
+	}
+}
+
+// TestRebalanceKeepsMessagesOnFailure проверяет, что при недоступном владельце
+// сообщения остаются в локальной очереди
+func TestRebalanceKeepsMessagesOnFailure(t *testing.T) {
+	local := broker.NewQueueBroker(100, 10, 1)
+	local.Enqueue("jobs", &broker.Message{Body: "job"})
+	p := NewPartitioner(local, "http://local", []string{"http://127.0.0.1:1"}, time.Hour)
+	p.Rebalance()
+	if local.Depth("jobs") != 1 {
+		t.Errorf("message lost when owner is unavailable")
+	}
+}
+
+// TestNodesHandler проверяет просмотр и замену состава кластера
+func TestNodesHandler(t *testing.T) {
+	p := NewPartitioner(broker.NewQueueBroker(100, 10, 1), "http://a/", []string{"http://a/"}, time.Hour)
+	handler := p.NodesHandler()
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("PUT", "/cluster/nodes", strings.NewReader(`{"nodes": ["http://a", "http://b/"]}`)))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"nodes":["http://a","http://b"]`) {
+		t.Errorf("unexpected response %d %s", rr.Code, rr.Body)
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("PUT", "/cluster/nodes", strings.NewReader(`{"nodes": []}`)))
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), `"code":"BAD_REQUEST"`) {
+		t.Errorf("expected empty membership to be rejected with a JSON error, got %d %s", rr.Code, rr.Body)
+	}
+}
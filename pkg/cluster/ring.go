@@ -0,0 +1,79 @@
+// Package cluster распределяет очереди между узлами брокера: имя очереди
+// отображается на узел согласованным хешированием, запросы к чужим очередям
+// пересылаются владельцу, а при смене состава узлов сообщения переносятся.
+package cluster
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+)
+
+// virtualNodes число точек каждого узла на кольце: чем больше, тем
+// равномернее распределение очередей
+const virtualNodes = 128
+
+// Ring кольцо согласованного хеширования. При добавлении или удалении узла
+// меняют владельца только очереди, приходившиеся на этот узел.
+type Ring struct {
+	nodes  []string
+	points []uint64
+	owners map[uint64]string
+}
+
+// NewRing строит кольцо из базовых URL узлов
+func NewRing(nodes []string) *Ring {
+	r := &Ring{owners: make(map[uint64]string)}
+	for _, node := range nodes {
+		if node == "" {
+			continue
+		}
+		r.nodes = append(r.nodes, node)
+		for i := 0; i < virtualNodes; i++ {
+			point := hashKey(node + "#" + strconv.Itoa(i))
+			// Совпадение точек разрешается в пользу меньшего URL, чтобы
+			// кольцо не зависело от порядка узлов в конфигурации
+			if owner, ok := r.owners[point]; ok && owner < node {
+				continue
+			}
+			if _, ok := r.owners[point]; !ok {
+				r.points = append(r.points, point)
+			}
+			r.owners[point] = node
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+	sort.Strings(r.nodes)
+	return r
+}
+
+// Nodes возвращает узлы кольца
+func (r *Ring) Nodes() []string {
+	return append([]string(nil), r.nodes...)
+}
+
+// Owner возвращает узел, которому принадлежит очередь, или пустую строку для пустого кольца
+func (r *Ring) Owner(queueName string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+	h := hashKey(queueName)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]]
+}
+
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	// Перемешивание (finalizer из MurmurHash3) улучшает разброс близких ключей
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb3f99fe07e53
+	x ^= x >> 33
+	return x
+}
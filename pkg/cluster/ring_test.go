@@ -0,0 +1,48 @@
+package cluster
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestRingBalanceAndStability проверяет равномерность распределения и то,
+// что при добавлении узла владельца меняет лишь часть очередей
+func TestRingBalanceAndStability(t *testing.T) {
+	nodes := []string{"http://a:8080", "http://b:8080", "http://c:8080"}
+	ring := NewRing(nodes)
+	counts := make(map[string]int)
+	const queues = 3000
+	for i := 0; i < queues; i++ {
+		counts[ring.Owner(fmt.Sprintf("queue-%d", i))]++
+	}
+	for _, node := range nodes {
+		if counts[node] < queues/3*7/10 || counts[node] > queues/3*13/10 {
+			t.Errorf("unbalanced ring: %v", counts)
+			break
+		}
+	}
+
+	// Порядок узлов не влияет на распределение
+	reversed := NewRing([]string{nodes[2], nodes[1], nodes[0]})
+	grown := NewRing(append(nodes, "http://d:8080"))
+	moved := 0
+	for i := 0; i < queues; i++ {
+		name := fmt.Sprintf("queue-%d", i)
+		if reversed.Owner(name) != ring.Owner(name) {
+			t.Fatalf("owner of %s depends on node order", name)
+		}
+		if owner := grown.Owner(name); owner != ring.Owner(name) {
+			moved++
+			if owner != "http://d:8080" {
+				t.Fatalf("%s moved between existing nodes", name)
+			}
+		}
+	}
+	if moved == 0 || moved > queues/2 {
+		t.Errorf("unexpected number of moved queues: %d", moved)
+	}
+
+	if NewRing(nil).Owner("x") != "" {
+		t.Error("expected empty ring to have no owner")
+	}
+}
@@ -0,0 +1,147 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// AccessConfig списки доступа по адресам клиентов. Адреса задаются в нотации
+// CIDR или отдельными IP.
+type AccessConfig struct {
+	// Allow если не пуст, принимаются только запросы с этих адресов
+	Allow []string `json:"allow"`
+	// Deny адреса, запросы с которых отклоняются всегда
+	Deny []string `json:"deny"`
+	// TrustedProxies балансировщики и прокси, которым брокер доверяет адрес
+	// клиента из X-Forwarded-For и заголовка PROXY protocol
+	TrustedProxies []string `json:"trusted_proxies"`
+	// ProxyProtocol ожидать заголовок PROXY protocol (v1 или v2) в начале
+	// соединений от доверенных прокси
+	ProxyProtocol bool `json:"proxy_protocol"`
+}
+
+type clientIPKey struct{}
+
+// AccessList определяет адрес клиента с учетом доверенных прокси и
+// отклоняет запросы по спискам доступа
+type AccessList struct {
+	allow   []*net.IPNet
+	deny    []*net.IPNet
+	trusted []*net.IPNet
+	// proxyProtocol см. AccessConfig.ProxyProtocol
+	proxyProtocol bool
+}
+
+// NewAccessList разбирает списки доступа
+func NewAccessList(cfg AccessConfig) (*AccessList, error) {
+	if cfg.ProxyProtocol && len(cfg.TrustedProxies) == 0 {
+		return nil, errors.New("proxy_protocol requires trusted_proxies")
+	}
+	a := AccessList{proxyProtocol: cfg.ProxyProtocol}
+	var err error
+	if a.allow, err = ParseCIDRs(cfg.Allow); err != nil {
+		return nil, fmt.Errorf("allow: %w", err)
+	}
+	if a.deny, err = ParseCIDRs(cfg.Deny); err != nil {
+		return nil, fmt.Errorf("deny: %w", err)
+	}
+	if a.trusted, err = ParseCIDRs(cfg.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("trusted_proxies: %w", err)
+	}
+	return &a, nil
+}
+
+// ParseCIDRs разбирает сети в нотации CIDR; отдельный IP означает сеть из
+// одного адреса
+func ParseCIDRs(list []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(list))
+	for _, s := range list {
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", s)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q", s)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allowed сообщает, принимаются ли запросы с адреса ip
+func (a *AccessList) Allowed(ip net.IP) bool {
+	if ip == nil || containsIP(a.deny, ip) {
+		return false
+	}
+	return len(a.allow) == 0 || containsIP(a.allow, ip)
+}
+
+// clientIP адрес клиента: адрес соединения, а если оно пришло от доверенного
+// прокси — самый правый адрес X-Forwarded-For, не принадлежащий доверенным
+// прокси (левые значения заголовка клиент может подделать)
+func (a *AccessList) clientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !containsIP(a.trusted, ip) {
+		return ip
+	}
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if hop == nil {
+			// Нераспознанное значение: дальше по цепочке адресам не верим
+			return ip
+		}
+		ip = hop
+		if !containsIP(a.trusted, ip) {
+			return ip
+		}
+	}
+	return ip
+}
+
+// middleware отклоняет запросы с адресов, не разрешенных списками, до любых
+// других проверок; адрес клиента запоминается для журнала аудита. Запросы
+// через сокет Unix не проверяются.
+func (a *AccessList) middleware(next http.Handler) http.Handler {
+	if a == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, local := r.Context().Value(http.LocalAddrContextKey).(*net.UnixAddr); local {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ip := a.clientIP(r)
+		if !a.Allowed(ip) {
+			httpError(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientIPKey{}, ip.String())))
+	})
+}
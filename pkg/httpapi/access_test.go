@@ -0,0 +1,62 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"queue-broker/pkg/broker"
+)
+
+// TestAccessList проверяет списки доступа и адрес клиента за прокси
+func TestAccessList(t *testing.T) {
+	access, err := NewAccessList(AccessConfig{
+		Allow:          []string{"10.0.0.0/8", "192.0.2.7"},
+		Deny:           []string{"10.6.6.0/24"},
+		TrustedProxies: []string{"172.16.0.1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	qb := broker.NewQueueBroker(100, 10, 10)
+	handler := NewHandler(qb, nil, WithAccessList(access))
+	do := func(remote, forwarded string) int {
+		req := httptest.NewRequest(http.MethodPut, "/queue/jobs", strings.NewReader(`{"message": "x"}`))
+		req.RemoteAddr = remote
+		if forwarded != "" {
+			req.Header.Set("X-Forwarded-For", forwarded)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	cases := []struct {
+		name, remote, forwarded string
+		want                    int
+	}{
+		{"allowed network", "10.1.2.3:5000", "", http.StatusOK},
+		{"allowed address", "192.0.2.7:5000", "", http.StatusOK},
+		{"not allowed", "203.0.113.9:5000", "", http.StatusForbidden},
+		{"denied inside allowed", "10.6.6.1:5000", "", http.StatusForbidden},
+		// X-Forwarded-For от недоверенного адреса не учитывается
+		{"spoofed header", "203.0.113.9:5000", "10.1.2.3", http.StatusForbidden},
+		{"client behind proxy", "172.16.0.1:5000", "10.1.2.3", http.StatusOK},
+		{"denied client behind proxy", "172.16.0.1:5000", "203.0.113.9", http.StatusForbidden},
+		// Левое значение мог подставить сам клиент: берется самое правое после прокси
+		{"forged leftmost value", "172.16.0.1:5000", "10.1.2.3, 203.0.113.9", http.StatusForbidden},
+		{"proxy chain", "172.16.0.1:5000", "10.1.2.3, 172.16.0.1", http.StatusOK},
+	}
+	for _, tc := range cases {
+		if got := do(tc.remote, tc.forwarded); got != tc.want {
+			t.Errorf("%s: got %d, want %d", tc.name, got, tc.want)
+		}
+	}
+
+	for _, cfg := range []AccessConfig{{Allow: []string{"10.0.0.0/33"}}, {Deny: []string{"not-an-ip"}}, {ProxyProtocol: true}} {
+		if _, err := NewAccessList(cfg); err == nil {
+			t.Errorf("%+v: expected error", cfg)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"queue-broker/pkg/broker"
+)
+
+type principalKey struct{}
+
+// principal субъект запроса для проверки прав: идентификатор ключа подписи
+// или арендатор; пусто для неаутентифицированных запросов
+func principal(r *http.Request) string {
+	if keyID, ok := r.Context().Value(principalKey{}).(string); ok {
+		return keyID
+	}
+	if tenantID, ok := r.Context().Value(tenantKey{}).(string); ok {
+		return tenantID
+	}
+	return ""
+}
+
+// requiredPermission право, необходимое для запроса к очереди; пусто, если
+// права проверяет сам обработчик
+func requiredPermission(r *http.Request, sub string) broker.Permission {
+	if strings.HasPrefix(sub, "messages/") {
+		return broker.PermAdmin
+	}
+	switch sub {
+	case "acl", "owner":
+		if r.Method == http.MethodPut {
+			return ""
+		}
+		return broker.PermAdmin
+	case "audit", "archive", "purge", "pause", "resume", "consumers", "export", "import":
+		return broker.PermAdmin
+	case "config", "schema":
+		if r.Method != http.MethodGet {
+			return broker.PermAdmin
+		}
+		return ""
+	case "":
+		if r.Method == http.MethodPut {
+			return broker.PermProduce
+		}
+	}
+	return broker.PermConsume
+}
+
+// tokenPermission право, которое должны выдавать права токена для запроса
+// к очереди; в отличие от requiredPermission определено для всех запросов:
+// изменение прав требует admin, чтение настроек — consume
+func tokenPermission(r *http.Request, sub string) broker.Permission {
+	if perm := requiredPermission(r, sub); perm != "" {
+		return perm
+	}
+	if r.Method == http.MethodGet {
+		return broker.PermConsume
+	}
+	return broker.PermAdmin
+}
+
+// handleQueueACL обрабатывает GET/PUT /queue/{name}/acl
+func handleQueueACL(qb *broker.QueueBroker, w http.ResponseWriter, r *http.Request, queueName string) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var acl broker.QueueACL
+		if err := json.NewDecoder(r.Body).Decode(&acl); err != nil {
+			httpError(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+		if err := qb.SetQueueACL(principal(r), queueName, acl); err != nil {
+			aclError(w, err)
+			return
+		}
+	default:
+		httpError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	acl, ok := qb.QueueACL(queueName)
+	if !ok {
+		httpError(w, "Not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(acl)
+}
+
+// handleQueueOwner обрабатывает PUT /queue/{name}/owner с телом {"owner": "..."}
+func handleQueueOwner(qb *broker.QueueBroker, w http.ResponseWriter, r *http.Request, queueName string) {
+	if r.Method != http.MethodPut {
+		httpError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var request struct {
+		Owner string `json:"owner"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		httpError(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	if err := qb.TransferQueueOwner(principal(r), queueName, request.Owner); err != nil {
+		aclError(w, err)
+		return
+	}
+
+	acl, _ := qb.QueueACL(queueName)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(acl)
+}
+
+// handleQueueAudit обрабатывает GET /queue/{name}/audit
+func handleQueueAudit(qb *broker.QueueBroker, w http.ResponseWriter, r *http.Request, queueName string) {
+	if r.Method != http.MethodGet {
+		httpError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	entries := qb.AuditLog(queueName)
+	for i := range entries {
+		entries[i].Queue = broker.TrimTenant(entries[i].Queue)
+	}
+	if entries == nil {
+		entries = []broker.AuditEntry{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(entries)
+}
+
+func aclError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, broker.ErrAuthRequired):
+		writeError(w, http.StatusUnauthorized, broker.ErrorCode(err), "Unauthorized", nil)
+	case errors.Is(err, broker.ErrPermissionDenied):
+		writeError(w, http.StatusForbidden, broker.ErrorCode(err), "Forbidden", nil)
+	case errors.Is(err, broker.ErrNoOwner):
+		writeError(w, http.StatusNotFound, broker.ErrorCode(err), "Not found", nil)
+	default:
+		errorResponse(w, err, http.StatusBadRequest)
+	}
+}
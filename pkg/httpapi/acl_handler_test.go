@@ -0,0 +1,73 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"queue-broker/pkg/broker"
+	"queue-broker/pkg/signing"
+)
+
+// TestQueueACLHandler проверяет изменение прав и владельца очереди через API
+// и их применение к постановке и получению сообщений
+func TestQueueACLHandler(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+	verifier := NewRequestVerifier(SigningConfig{Keys: map[string]string{"alice": "a", "bob": "b", "carol": "c"}})
+	handler := NewHandler(qb, nil, WithRequestVerifier(verifier))
+
+	nonce := 0
+	do := func(method, target, key, body string) *httptest.ResponseRecorder {
+		nonce++
+		req := httptest.NewRequest(method, target, bytes.NewBufferString(body))
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(signing.KeyHeader, key)
+		req.Header.Set(signing.TimestampHeader, timestamp)
+		req.Header.Set(signing.NonceHeader, strconv.Itoa(nonce))
+		req.Header.Set(signing.SignatureHeader, signing.Sign([]byte(key[:1]), method, target, timestamp, strconv.Itoa(nonce), []byte(body)))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := do("PUT", "/queue/orders/acl", "alice", `{"produce": ["bob"], "consume": ["carol"]}`); rr.Code != http.StatusOK {
+		t.Fatalf("expected claim to succeed, got %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := do("PUT", "/queue/orders", "bob", `{"message": "o1"}`); rr.Code != http.StatusOK {
+		t.Errorf("expected producer to enqueue, got %d", rr.Code)
+	}
+	if rr := do("PUT", "/queue/orders", "carol", `{"message": "o2"}`); rr.Code != http.StatusForbidden {
+		t.Errorf("expected consumer enqueue to be forbidden, got %d", rr.Code)
+	}
+	if rr := do("GET", "/queue/orders?timeout=0", "bob", ""); rr.Code != http.StatusForbidden {
+		t.Errorf("expected producer dequeue to be forbidden, got %d", rr.Code)
+	}
+	if rr := do("GET", "/queue/orders?timeout=0", "carol", ""); rr.Code != http.StatusOK {
+		t.Errorf("expected consumer to dequeue, got %d", rr.Code)
+	}
+	if rr := do("PUT", "/queue/orders/acl", "bob", `{}`); rr.Code != http.StatusForbidden {
+		t.Errorf("expected ACL change by non-admin to be forbidden, got %d", rr.Code)
+	}
+	if rr := do("PUT", "/queue/orders/config", "bob", `{"lock_duration": 5}`); rr.Code != http.StatusForbidden {
+		t.Errorf("expected config change by non-admin to be forbidden, got %d", rr.Code)
+	}
+
+	rr := do("PUT", "/queue/orders/owner", "alice", `{"owner": "bob"}`)
+	var acl broker.QueueACL
+	if rr.Code != http.StatusOK || json.Unmarshal(rr.Body.Bytes(), &acl) != nil || acl.Owner != "bob" {
+		t.Fatalf("unexpected transfer response: %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := do("GET", "/queue/orders/acl", "alice", ""); rr.Code != http.StatusForbidden {
+		t.Errorf("expected former owner to lose admin rights, got %d", rr.Code)
+	}
+
+	rr = do("GET", "/queue/orders/audit", "bob", "")
+	var entries []broker.AuditEntry
+	if rr.Code != http.StatusOK || json.Unmarshal(rr.Body.Bytes(), &entries) != nil || len(entries) != 2 || entries[1].Principal != "alice" {
+		t.Errorf("unexpected audit response: %d %s", rr.Code, rr.Body.String())
+	}
+}
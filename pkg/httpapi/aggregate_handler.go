@@ -0,0 +1,55 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"queue-broker/pkg/broker"
+)
+
+// handleQueueAggregate обрабатывает GET /queue/{name}/aggregate: выдачу
+// пакета сообщений очереди с политикой агрегации
+// {"count": n, "messages": [...]}
+func handleQueueAggregate(qb *broker.QueueBroker, w http.ResponseWriter, r *http.Request, queueName string) {
+	query := r.URL.Query()
+	timeout, err := timeoutParam(qb, query.Get("timeout"))
+	if err != nil {
+		httpError(w, "Invalid timeout", http.StatusBadRequest)
+		return
+	}
+	forceBase64, err := base64Param(query)
+	if err != nil {
+		httpError(w, "Invalid encoding", http.StatusBadRequest)
+		return
+	}
+
+	msgs, err := qb.DequeueAggregate(queueName, timeout)
+	if errors.Is(err, broker.ErrNoAggregation) {
+		errorResponse(w, err, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		dequeueError(w, r, err)
+		return
+	}
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+	b := append(*buf, `{"count":`...)
+	b = strconv.AppendInt(b, int64(len(msgs)), 10)
+	b = append(b, `,"messages":[`...)
+	size := 0
+	for i, msg := range msgs {
+		size += len(msg.Body)
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = appendMessageJSON(b, tenantView(r, msg).(*broker.Message), nil, forceBase64)
+	}
+	*buf = append(b, "]}\n"...)
+	countUsage(r, false, len(msgs), size)
+	w.Header()["Content-Type"] = jsonHeader
+	w.WriteHeader(http.StatusOK)
+	w.Write(*buf)
+}
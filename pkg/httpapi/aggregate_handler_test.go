@@ -0,0 +1,46 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"queue-broker/pkg/broker"
+)
+
+// TestQueueAggregate проверяет настройку агрегации и выдачу пакета
+func TestQueueAggregate(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+	handler := NewHandler(qb, nil)
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return rr
+	}
+
+	if rr := serve(http.MethodGet, "/queue/rows/aggregate?timeout=0", ""); rr.Code != http.StatusConflict {
+		t.Errorf("expected 409 without policy, got %d", rr.Code)
+	}
+	if rr := serve(http.MethodPut, "/queue/rows/config", `{"aggregate": {"max_messages": 0, "max_wait": 1}}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid policy, got %d", rr.Code)
+	}
+	if rr := serve(http.MethodPut, "/queue/rows/config", `{"aggregate": {"max_messages": 2, "max_wait": 10}}`); rr.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d %s", rr.Code, rr.Body)
+	}
+	qb.PutMessage("rows", "a")
+	qb.PutMessage("rows", "b")
+
+	rr := serve(http.MethodGet, "/v1/queues/rows/aggregate?timeout=0", "")
+	var result struct {
+		Count    int               `json:"count"`
+		Messages []*broker.Message `json:"messages"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil || result.Count != 2 || result.Messages[1].Body != "b" {
+		t.Fatalf("unexpected response %d %s", rr.Code, rr.Body)
+	}
+	if rr := serve(http.MethodGet, "/queue/rows/aggregate?timeout=0", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for empty queue, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,40 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"queue-broker/pkg/broker"
+)
+
+// handleQueueArchive обрабатывает POST /queue/{name}/archive: оставшиеся
+// сообщения сохраняются в архив, после чего очередь удаляется
+func handleQueueArchive(qb *broker.QueueBroker, w http.ResponseWriter, r *http.Request, queueName string) {
+	if r.Method != http.MethodPost {
+		httpError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	location, count, err := qb.ArchiveQueue(queueName)
+	switch {
+	case err == nil:
+	case errors.Is(err, broker.ErrQueueNotFound):
+		writeError(w, http.StatusBadRequest, broker.ErrorCode(err), "Queue does not exist", nil)
+		return
+	case errors.Is(err, broker.ErrQueueArchiving):
+		errorResponse(w, err, http.StatusConflict)
+		return
+	case errors.Is(err, broker.ErrNoArchive):
+		errorResponse(w, err, http.StatusNotImplemented)
+		return
+	default:
+		// Очередь не удалена: архив не записан
+		errorResponse(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{"archived": count, "location": location})
+}
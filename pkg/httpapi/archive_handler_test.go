@@ -0,0 +1,50 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"queue-broker/pkg/broker"
+)
+
+// TestQueueArchiveHandler проверяет архивирование и удаление очереди через API
+func TestQueueArchiveHandler(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 1)
+	handler := NewHandler(qb, nil)
+	qb.Enqueue("jobs", &broker.Message{Body: "j1"})
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/queue/jobs/archive", nil))
+	if rr.Code != http.StatusNotImplemented {
+		t.Errorf("expected 501 without archive, got %d", rr.Code)
+	}
+
+	qb.SetArchive(broker.DirArchive{Dir: t.TempDir()})
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/queue/jobs/archive", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 for GET, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/queue/jobs/archive", nil))
+	var result struct {
+		Archived int    `json:"archived"`
+		Location string `json:"location"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); rr.Code != http.StatusOK || err != nil || result.Archived != 1 {
+		t.Fatalf("unexpected archive response: %d %s", rr.Code, rr.Body)
+	}
+	if _, err := os.Stat(result.Location); err != nil {
+		t.Errorf("archive file missing: %v", err)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/queue/jobs/archive", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for deleted queue, got %d", rr.Code)
+	}
+}
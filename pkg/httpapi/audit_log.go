@@ -0,0 +1,146 @@
+package httpapi
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"queue-broker/pkg/audit"
+)
+
+// auditRequests записывает в журнал аудита административные запросы
+// и, если журнал это включает, постановку и получение сообщений. Запись
+// делается после ответа, с его кодом, поэтому отклоненные запросы тоже видны.
+// Вызывается после проверки подписи и арендатора, чтобы знать субъект запроса.
+func auditRequests(logger *audit.Logger, next http.Handler) http.Handler {
+	if logger == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		action, data := auditAction(r)
+		if action == "" || data && !logger.Data() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		e := audit.Event{Actor: principal(r), Remote: remoteHost(r), Action: action, Request: r.Method + " " + r.URL.Path, Status: sw.status}
+		if strings.HasPrefix(r.URL.Path, "/queue/") {
+			e.Queue, _ = splitQueuePath(r.URL.Path)
+		}
+		logger.Log(e)
+	})
+}
+
+// auditAction действие журнала аудита для запроса; data — операция с данными.
+// Запросы только на чтение настроек не записываются.
+func auditAction(r *http.Request) (action string, data bool) {
+	switch r.URL.Path {
+	case "/admin/snapshot":
+		return audit.SnapshotCreate, false
+	case "/admin/keys/rotate":
+		return audit.KeysRotate, false
+	}
+	if r.URL.Path == "/schedules" || strings.HasPrefix(r.URL.Path, "/schedules/") {
+		switch r.Method {
+		case http.MethodPost, http.MethodPut:
+			return audit.ScheduleSet, false
+		case http.MethodDelete:
+			return audit.ScheduleDelete, false
+		}
+		return "", false
+	}
+	if !strings.HasPrefix(r.URL.Path, "/queue/") {
+		return "", false
+	}
+	_, sub := splitQueuePath(r.URL.Path)
+	get := r.Method == http.MethodGet
+	switch sub {
+	case "":
+		if r.Method == http.MethodPut {
+			return audit.MessageProduce, true
+		}
+		return audit.MessageConsume, true
+	case "stream", "tail":
+		return audit.MessageConsume, true
+	case "messages", "scheduled":
+		return audit.MessageBrowse, true
+	case "complete", "renew", "abandon":
+		return audit.MessageSettle, true
+	case "config":
+		if !get {
+			return audit.QueueConfig, false
+		}
+	case "schema":
+		if !get {
+			return audit.QueueSchema, false
+		}
+	case "acl":
+		if !get {
+			return audit.QueueACL, false
+		}
+	case "owner":
+		return audit.QueueOwner, false
+	case "purge":
+		return audit.QueuePurge, false
+	case "pause":
+		return audit.QueuePause, false
+	case "resume":
+		return audit.QueueResume, false
+	case "archive":
+		return audit.QueueArchive, false
+	default:
+		if strings.HasSuffix(sub, "/requeue") {
+			return audit.MessageRequeue, false
+		}
+		if strings.HasPrefix(sub, "messages/") {
+			return audit.MessageDelete, false
+		}
+	}
+	return "", false
+}
+
+// remoteHost адрес клиента без порта
+func remoteHost(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// statusWriter запоминает код ответа
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *statusWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap открывает исходный ResponseWriter для http.ResponseController
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,65 @@
+package httpapi
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"queue-broker/pkg/audit"
+	"queue-broker/pkg/broker"
+)
+
+type memorySink struct {
+	mu     sync.Mutex
+	events []audit.Event
+}
+
+func (s *memorySink) Write(e audit.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, e)
+	return nil
+}
+
+func (s *memorySink) Close() error { return nil }
+
+// TestAuditRequests проверяет запись административных запросов с субъектом,
+// адресом и кодом ответа и запись операций с данными только по настройке
+func TestAuditRequests(t *testing.T) {
+	for _, data := range []bool{false, true} {
+		qb := broker.NewQueueBroker(100, 10, 10)
+		qb.AddTenant(broker.Tenant{ID: "acme", Key: bytes.Repeat([]byte{1}, 32), Token: "acme-token"})
+		sink := &memorySink{}
+		handler := NewHandler(qb, nil, WithAuditLog(audit.New(data, sink)))
+		do := func(method, target, body string) {
+			req := httptest.NewRequest(method, target, strings.NewReader(body))
+			req.Header.Set("Authorization", "Bearer acme-token")
+			req.RemoteAddr = "10.0.0.7:51234"
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+		}
+		do(http.MethodPut, "/queue/jobs", `{"message": "job"}`)
+		do(http.MethodGet, "/queue/jobs/config", "")
+		do(http.MethodPut, "/queue/jobs/config", `{"lock_duration": 60}`)
+		do(http.MethodPost, "/queue/jobs/purge", "")
+		do(http.MethodGet, "/queue/jobs?timeout=0", "")
+
+		want := []string{audit.QueueConfig, audit.QueuePurge}
+		if data {
+			want = []string{audit.MessageProduce, audit.QueueConfig, audit.QueuePurge, audit.MessageConsume}
+		}
+		if len(sink.events) != len(want) {
+			t.Fatalf("data=%v: expected %v, got %+v", data, want, sink.events)
+		}
+		for i, e := range sink.events {
+			if e.Action != want[i] || e.Actor != "acme" || e.Remote != "10.0.0.7" || e.Queue != "@acme.jobs" || e.Time.IsZero() {
+				t.Errorf("data=%v: unexpected record %+v", data, e)
+			}
+		}
+		if last := sink.events[len(sink.events)-1]; data && last.Status != http.StatusNotFound {
+			t.Errorf("consume from empty queue should be recorded with 404, got %d", last.Status)
+		}
+	}
+}
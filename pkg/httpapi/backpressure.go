@@ -0,0 +1,37 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"queue-broker/pkg/broker"
+)
+
+// capacityRetryAfter значение Retry-After при нехватке места в секундах
+const capacityRetryAfter = 1
+
+// capacityError отвечает на нехватку места: 429, если заполнена очередь или
+// квота арендатора, и 503, если достигнуты ограничения всего брокера или
+// производитель не дождался места в очереди с overflow=block. Тело
+// содержит текущую заполненность и ограничение, чтобы производитель мог
+// выбрать паузу перед повтором.
+func capacityError(w http.ResponseWriter, err error) bool {
+	var capErr *broker.CapacityError
+	if !errors.As(err, &capErr) {
+		return false
+	}
+	status := http.StatusTooManyRequests
+	if errors.Is(err, broker.ErrTotalByteLimit) || errors.Is(err, broker.ErrTooManyQueues) || errors.Is(err, broker.ErrPutTimeout) {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(capacityRetryAfter))
+	writeError(w, status, broker.ErrorCode(err), err.Error(), map[string]any{
+		"queue":       broker.TrimTenant(capErr.Queue),
+		"depth":       capErr.Used,
+		"capacity":    capErr.Limit,
+		"unit":        capErr.Unit,
+		"retry_after": capacityRetryAfter,
+	})
+	return true
+}
@@ -0,0 +1,96 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"queue-broker/pkg/broker"
+)
+
+// TestCapacityError проверяет ответ на постановку в заполненную очередь
+func TestCapacityError(t *testing.T) {
+	qb := broker.NewQueueBroker(1, 10, 10)
+	qb.SetByteLimits(0, 100)
+	handler := NewHandler(qb, nil)
+	put := func(queue, message string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPut, "/queue/"+queue, strings.NewReader(`{"message": "`+message+`"}`)))
+		return rr
+	}
+	if rr := put("jobs", "x"); rr.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d", rr.Code)
+	}
+
+	cases := []struct {
+		name, queue, message string
+		status               int
+		code, unit           string
+		depth, capacity      int64
+	}{
+		{"queue full", "jobs", "y", http.StatusTooManyRequests, "QUEUE_FULL", "messages", 1, 1},
+		{"broker byte limit", "big", strings.Repeat("z", 200), http.StatusServiceUnavailable, "TOTAL_BYTE_LIMIT", "bytes", 1, 100},
+	}
+	for _, tc := range cases {
+		rr := put(tc.queue, tc.message)
+		if rr.Code != tc.status || rr.Header().Get("Retry-After") != "1" {
+			t.Errorf("%s: got %d with Retry-After %q", tc.name, rr.Code, rr.Header().Get("Retry-After"))
+			continue
+		}
+		var body struct {
+			Error struct {
+				Code    string `json:"code"`
+				Details struct {
+					Queue    string `json:"queue"`
+					Depth    int64  `json:"depth"`
+					Capacity int64  `json:"capacity"`
+					Unit     string `json:"unit"`
+				} `json:"details"`
+			} `json:"error"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if d := body.Error.Details; d.Queue != tc.queue || d.Unit != tc.unit || d.Depth != tc.depth || d.Capacity != tc.capacity || body.Error.Code != tc.code {
+			t.Errorf("%s: unexpected body %+v", tc.name, body)
+		}
+	}
+}
+
+// TestBlockingPut проверяет ожидание места производителем с timeout в
+// очереди с overflow=block
+func TestBlockingPut(t *testing.T) {
+	qb := broker.NewQueueBroker(1, 10, 10)
+	handler := NewHandler(qb, nil)
+	do := requester(handler)
+	if rr := do(http.MethodPut, "/queue/jobs/config", `{"overflow": "drop"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("unknown policy: got %d", rr.Code)
+	}
+	if rr := do(http.MethodPut, "/queue/jobs/config", `{"overflow": "block"}`); rr.Code != http.StatusOK {
+		t.Fatalf("config: got %d %s", rr.Code, rr.Body)
+	}
+	do(http.MethodPut, "/queue/jobs", `{"message": "first"}`)
+
+	if rr := do(http.MethodPut, "/queue/jobs?timeout=soon", `{"message": "second"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("invalid timeout: got %d", rr.Code)
+	}
+	start := time.Now()
+	rr := do(http.MethodPut, "/queue/jobs?timeout=100ms", `{"message": "second"}`)
+	if rr.Code != http.StatusServiceUnavailable || !strings.Contains(rr.Body.String(), "PUT_TIMEOUT") || rr.Header().Get("Retry-After") == "" {
+		t.Errorf("expected 503 PUT_TIMEOUT, got %d %s", rr.Code, rr.Body)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("unexpected wait %v", elapsed)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		qb.GetMessage("jobs", 0)
+	}()
+	if rr := do(http.MethodPut, "/queue/jobs?timeout=5s", `{"message": "second"}`); rr.Code != http.StatusOK {
+		t.Errorf("blocked put: got %d %s", rr.Code, rr.Body)
+	}
+}
@@ -0,0 +1,160 @@
+package httpapi
+
+import (
+	"encoding/base64"
+	"errors"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"queue-broker/pkg/broker"
+)
+
+const (
+	jsonContentType   = "application/json"
+	binaryContentType = "application/octet-stream"
+	// messageHeaderPrefix префикс HTTP-заголовков, передающих заголовки сообщения
+	// при постановке и получении тела как есть
+	messageHeaderPrefix = "X-Message-Header-"
+	// groupHeader HTTP-заголовок с группой сообщения для тела, переданного как есть
+	groupHeader = "X-Group-Id"
+)
+
+// rawContentType возвращает тип содержимого, если тело PUT нужно сохранить
+// как есть, а не разбирать как JSON. Другие типы (в том числе
+// application/x-www-form-urlencoded, который по умолчанию отправляет curl)
+// по-прежнему разбираются как JSON.
+func rawContentType(r *http.Request) (string, bool) {
+	contentType := r.Header.Get("Content-Type")
+	if mediaType, _, err := mime.ParseMediaType(contentType); err != nil || mediaType != binaryContentType {
+		return "", false
+	}
+	return contentType, true
+}
+
+// rawMessage собирает сообщение из тела запроса, принятого как есть
+func rawMessage(r *http.Request, contentType string, data []byte) *broker.Message {
+	msg := &broker.Message{Body: string(data), ContentType: contentType, GroupID: r.Header.Get(groupHeader)}
+	for name, values := range r.Header {
+		if header, ok := strings.CutPrefix(name, messageHeaderPrefix); ok && header != "" {
+			if msg.Headers == nil {
+				msg.Headers = make(map[string]string)
+			}
+			msg.Headers[strings.ToLower(header)] = values[0]
+		}
+	}
+	return msg
+}
+
+// isBinary сообщает, что тело нельзя передать в JSON строкой: оно не является
+// корректным UTF-8 или принято с нетекстовым типом содержимого
+func isBinary(msg *broker.Message) bool {
+	if !utf8.ValidString(msg.Body) {
+		return true
+	}
+	if msg.ContentType == "" {
+		return false
+	}
+	mediaType, _, _ := mime.ParseMediaType(msg.ContentType)
+	return !strings.HasPrefix(mediaType, "text/") && mediaType != jsonContentType && !strings.HasSuffix(mediaType, "+json")
+}
+
+// binaryMessage представление сообщения в JSON с телом в base64
+type binaryMessage struct {
+	*broker.Message
+	Body   string `json:"message,omitempty"`
+	Base64 string `json:"message_base64"`
+}
+
+// binaryDelivery представление выданного в режиме peek-lock сообщения с телом в base64
+type binaryDelivery struct {
+	*broker.Delivery
+	Body   string `json:"message,omitempty"`
+	Base64 string `json:"message_base64"`
+}
+
+// base64Param разбирает параметр encoding: base64 требует передавать в JSON
+// любое тело полем message_base64
+func base64Param(query url.Values) (bool, error) {
+	switch query.Get("encoding") {
+	case "":
+		return false, nil
+	case "base64":
+		return true, nil
+	}
+	return false, errors.New("invalid encoding")
+}
+
+// jsonView заменяет двоичное тело (или любое тело при force) полем message_base64
+func jsonView(v any, force bool) any {
+	switch v := v.(type) {
+	case *broker.Message:
+		if force || isBinary(v) {
+			return &binaryMessage{Message: v, Base64: base64.StdEncoding.EncodeToString([]byte(v.Body))}
+		}
+	case *broker.Delivery:
+		if force || isBinary(v.Message) {
+			return &binaryDelivery{Delivery: v, Base64: base64.StdEncoding.EncodeToString([]byte(v.Body))}
+		}
+	}
+	return v
+}
+
+// wantsRaw сообщает, что клиент предпочитает тело как есть: в Accept тип
+// application/octet-stream (или тип содержимого сообщения) имеет больший
+// вес, чем application/json
+func wantsRaw(r *http.Request, msg *broker.Message) bool {
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return false
+	}
+	raw, jsonWeight := 0.0, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		weight := 1.0
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil {
+			weight = q
+		}
+		switch {
+		case mediaType == binaryContentType || (msg.ContentType != "" && strings.HasPrefix(msg.ContentType, mediaType)):
+			raw = max(raw, weight)
+		case mediaType == jsonContentType || mediaType == "*/*" || mediaType == "application/*":
+			jsonWeight = max(jsonWeight, weight)
+		}
+	}
+	return raw > 0 && raw > jsonWeight
+}
+
+// writeRaw отдает тело сообщения как есть; заголовки сообщения и данные
+// блокировки передаются HTTP-заголовками
+func writeRaw(w http.ResponseWriter, msg *broker.Message, delivery *broker.Delivery) {
+	contentType := msg.ContentType
+	if contentType == "" {
+		contentType = binaryContentType
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Message-Queue", msg.Queue)
+	if msg.DedupID != "" {
+		w.Header().Set("X-Dedup-Id", msg.DedupID)
+	}
+	if msg.GroupID != "" {
+		w.Header().Set(groupHeader, msg.GroupID)
+	}
+	for name, value := range msg.Headers {
+		w.Header().Set(messageHeaderPrefix+name, value)
+	}
+	if delivery != nil {
+		w.Header().Set("X-Lock-Token", delivery.LockToken)
+		w.Header().Set("X-Locked-Until", delivery.LockedUntil.Format(time.RFC3339Nano))
+		w.Header().Set("X-Lock-Duration", strconv.Itoa(delivery.LockDuration))
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(msg.Body))
+}
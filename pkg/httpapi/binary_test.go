@@ -0,0 +1,132 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"queue-broker/pkg/broker"
+)
+
+// TestBinaryPayload проверяет постановку тела как есть и выдачу в JSON
+// (base64) или как есть в зависимости от Accept
+func TestBinaryPayload(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+	handler := NewHandler(qb, nil)
+	payload := []byte{0x00, 0xff, 0xfe, 'a', '\n'}
+
+	put := func() {
+		t.Helper()
+		req := httptest.NewRequest("PUT", "/queue/blobs", bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/octet-stream")
+		req.Header.Set("X-Message-Header-Type", "image")
+		req.Header.Set("X-Group-Id", "album")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("binary put failed: %d %s", rr.Code, rr.Body.String())
+		}
+	}
+
+	put()
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/queue/blobs", nil))
+	var view struct {
+		Body        *string           `json:"message"`
+		Base64      string            `json:"message_base64"`
+		ContentType string            `json:"content_type"`
+		Headers     map[string]string `json:"headers"`
+		GroupID     string            `json:"group_id"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &view); err != nil {
+		t.Fatal(err)
+	}
+	if decoded, _ := base64.StdEncoding.DecodeString(view.Base64); !bytes.Equal(decoded, payload) || view.Body != nil ||
+		view.ContentType != "application/octet-stream" || view.Headers["type"] != "image" || view.GroupID != "album" {
+		t.Errorf("unexpected JSON view: %s", rr.Body.String())
+	}
+
+	put()
+	req := httptest.NewRequest("GET", "/queue/blobs?mode=peeklock", nil)
+	req.Header.Set("Accept", "application/octet-stream, application/json;q=0.5")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if !bytes.Equal(rr.Body.Bytes(), payload) || rr.Header().Get("Content-Type") != "application/octet-stream" ||
+		rr.Header().Get("X-Message-Header-Type") != "image" || rr.Header().Get("X-Lock-Token") == "" || rr.Header().Get("X-Group-Id") != "album" {
+		t.Errorf("unexpected raw response: %v %q", rr.Header(), rr.Body.Bytes())
+	}
+
+	// Текстовые сообщения по-прежнему отдаются строкой в поле message
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PUT", "/queue/text", bytes.NewBufferString(`{"message": "hello"}`)))
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/queue/text", nil))
+	var text broker.Message
+	if json.Unmarshal(rr.Body.Bytes(), &text); text.Body != "hello" {
+		t.Errorf("unexpected text message: %s", rr.Body.String())
+	}
+}
+
+// TestBase64Envelope проверяет постановку двоичного тела полем message_base64,
+// тип содержимого очереди по умолчанию и параметр encoding=base64
+func TestBase64Envelope(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+	handler := NewHandler(qb, nil)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(method, path, bytes.NewBufferString(body)))
+		return rr
+	}
+	payload := []byte{0x00, 0xff, 'x'}
+	encoded := base64.StdEncoding.EncodeToString(payload)
+
+	for _, body := range []string{
+		`{"message": "text", "message_base64": "` + encoded + `"}`,
+		`{"message_base64": "not base64!"}`,
+		`{}`,
+	} {
+		if rr := do("PUT", "/queue/blobs", body); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", body, rr.Code)
+		}
+	}
+
+	if rr := do("PUT", "/queue/blobs", `{"message_base64": "`+encoded+`"}`); rr.Code != http.StatusOK {
+		t.Fatalf("base64 put failed: %d %s", rr.Code, rr.Body)
+	}
+	var view struct {
+		Base64      string `json:"message_base64"`
+		ContentType string `json:"content_type"`
+	}
+	rr := do("GET", "/queue/blobs", "")
+	json.Unmarshal(rr.Body.Bytes(), &view)
+	if view.Base64 != encoded || view.ContentType != "application/octet-stream" {
+		t.Errorf("binary body did not round-trip: %s", rr.Body)
+	}
+
+	if rr := do("PUT", "/queue/images/config", `{"default_content_type": "image/png"}`); rr.Code != http.StatusOK {
+		t.Fatalf("config failed: %d %s", rr.Code, rr.Body)
+	}
+	if rr := do("PUT", "/queue/images/config", `{"default_content_type": "not a type;;"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected invalid content type to be rejected, got %d", rr.Code)
+	}
+	do("PUT", "/queue/images", `{"message_base64": "`+encoded+`"}`)
+	rr = do("GET", "/queue/images", "")
+	json.Unmarshal(rr.Body.Bytes(), &view)
+	if view.Base64 != encoded || view.ContentType != "image/png" {
+		t.Errorf("queue default content type not applied: %s", rr.Body)
+	}
+
+	// encoding=base64 передает полем message_base64 и текстовое тело
+	do("PUT", "/queue/texts", `{"message": "caption"}`)
+	if rr := do("GET", "/queue/texts?encoding=hex", ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected invalid encoding to be rejected, got %d", rr.Code)
+	}
+	rr = do("GET", "/queue/texts?encoding=base64", "")
+	view.Base64 = ""
+	json.Unmarshal(rr.Body.Bytes(), &view)
+	if view.Base64 != base64.StdEncoding.EncodeToString([]byte("caption")) {
+		t.Errorf("unexpected forced base64 view: %s", rr.Body)
+	}
+}
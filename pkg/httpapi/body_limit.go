@@ -0,0 +1,30 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+)
+
+// DefaultMaxMessageSize ограничение размера тела запроса к очереди по умолчанию
+const DefaultMaxMessageSize = 256 << 10
+
+// limitBody ограничивает размер тела запроса; при maxBytes <= 0 ограничения нет
+func limitBody(maxBytes int64, next http.Handler) http.Handler {
+	if maxBytes <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// bodyError отвечает на ошибку чтения тела: 413 при превышении размера, иначе 400
+func bodyError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		httpError(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	httpError(w, "Bad request", http.StatusBadRequest)
+}
@@ -0,0 +1,49 @@
+package httpapi
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"queue-broker/pkg/broker"
+)
+
+// TestBodyLimit проверяет ответ 413 на слишком большое тело и проверку UTF-8
+func TestBodyLimit(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+	handler := NewHandler(qb, nil, WithMaxMessageSize(64))
+
+	put := func(body []byte) int {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("PUT", "/queue/jobs", bytes.NewReader(body)))
+		return rr.Code
+	}
+
+	if code := put([]byte(`{"message": "job"}`)); code != http.StatusOK {
+		t.Fatalf("expected small message to pass, got %d", code)
+	}
+	if code := put([]byte(`{"message": "` + strings.Repeat("x", 100) + `"}`)); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413 for large message, got %d", code)
+	}
+	if code := put([]byte("{\"message\": \"\xff\xfe\"}")); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid UTF-8, got %d", code)
+	}
+	if qb.Depth("jobs") != 1 {
+		t.Errorf("expected only the valid message to be stored, got %d", qb.Depth("jobs"))
+	}
+
+	unlimited := NewHandler(qb, nil, WithMaxMessageSize(0))
+	rr := httptest.NewRecorder()
+	large := `{"message": "` + strings.Repeat("x", DefaultMaxMessageSize) + `"}`
+	unlimited.ServeHTTP(rr, httptest.NewRequest("PUT", "/queue/jobs", strings.NewReader(large)))
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected limit to be disabled, got %d", rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	NewHandler(qb, nil).ServeHTTP(rr, httptest.NewRequest("PUT", "/queue/jobs", strings.NewReader(large)))
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected default limit to apply, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,111 @@
+package httpapi
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+
+	"queue-broker/pkg/broker"
+)
+
+const (
+	// defaultBrowseLimit и maxBrowseLimit размер страницы просмотра по умолчанию и наибольший
+	defaultBrowseLimit = 50
+	maxBrowseLimit     = 1000
+	// defaultBrowseBodyBytes до скольких байт обрезаются тела по умолчанию
+	defaultBrowseBodyBytes = 256
+)
+
+// browsedView представление просматриваемого сообщения с обрезанным телом
+type browsedView struct {
+	broker.BrowsedMessage
+	Body   *string `json:"message,omitempty"`
+	Base64 string  `json:"message_base64,omitempty"`
+	// Size полный размер тела в байтах
+	Size      int  `json:"size"`
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// intParam разбирает неотрицательный целочисленный параметр запроса
+func intParam(r *http.Request, name string, def int) (int, error) {
+	if r.URL.RawQuery == "" {
+		return def, nil
+	}
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, strconv.ErrSyntax
+	}
+	return n, nil
+}
+
+// truncateBody обрезает тело до maxBytes байт, не разрывая символы UTF-8
+// текстовых тел; 0 означает без ограничения
+func truncateBody(body string, maxBytes int, binary bool) (string, bool) {
+	if maxBytes == 0 || len(body) <= maxBytes {
+		return body, false
+	}
+	n := maxBytes
+	for !binary && n > 0 && !utf8.RuneStart(body[n]) {
+		n--
+	}
+	return body[:n], true
+}
+
+// handleQueueBrowse обрабатывает GET /queue/{name}/messages?offset=&limit=&max_body=:
+// постраничный просмотр ожидающих сообщений без их извлечения
+func handleQueueBrowse(qb *broker.QueueBroker, w http.ResponseWriter, r *http.Request, queueName string) {
+	if r.Method != http.MethodGet {
+		httpError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	offset, err := intParam(r, "offset", 0)
+	if err != nil {
+		httpError(w, "Invalid offset", http.StatusBadRequest)
+		return
+	}
+	limit, err := intParam(r, "limit", defaultBrowseLimit)
+	if err != nil || limit == 0 || limit > maxBrowseLimit {
+		httpError(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+	maxBody, err := intParam(r, "max_body", defaultBrowseBodyBytes)
+	if err != nil {
+		httpError(w, "Invalid max_body", http.StatusBadRequest)
+		return
+	}
+	forceBase64, err := base64Param(r.URL.Query())
+	if err != nil {
+		httpError(w, "Invalid encoding", http.StatusBadRequest)
+		return
+	}
+
+	browsed, total, err := qb.Browse(queueName, offset, limit)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errorCode(err, http.StatusBadRequest), "Queue does not exist", nil)
+		return
+	}
+	views := make([]browsedView, len(browsed))
+	for i, b := range browsed {
+		if msg, ok := tenantView(r, b.Message).(*broker.Message); ok {
+			b.Message = msg
+		}
+		binary := forceBase64 || isBinary(b.Message)
+		body, truncated := truncateBody(b.Body, maxBody, binary)
+		views[i] = browsedView{BrowsedMessage: b, Size: len(b.Body), Truncated: truncated}
+		if binary {
+			views[i].Base64 = base64.StdEncoding.EncodeToString([]byte(body))
+		} else {
+			views[i].Body = &body
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{"total": total, "offset": offset, "limit": limit, "messages": views})
+}
@@ -0,0 +1,63 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"queue-broker/pkg/broker"
+)
+
+// TestBrowseHandler проверяет постраничный просмотр сообщений с обрезкой тел
+func TestBrowseHandler(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 1)
+	handler := NewHandler(qb, nil)
+	qb.Enqueue("jobs", &broker.Message{Body: "short"})
+	qb.Enqueue("jobs", &broker.Message{Body: strings.Repeat("я", 10)})
+	qb.Enqueue("jobs", &broker.Message{Body: "\xff\xfe\xfd\xfc", ContentType: "application/octet-stream"})
+	do := func(target string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", target, bytes.NewBuffer(nil)))
+		return rr
+	}
+
+	rr := do("/queue/jobs/messages?offset=1&limit=2&max_body=5")
+	var response struct {
+		Total    int `json:"total"`
+		Messages []struct {
+			ID         uint64 `json:"id"`
+			Message    string `json:"message"`
+			Base64     string `json:"message_base64"`
+			Position   int    `json:"position"`
+			EnqueuedAt string `json:"enqueued_at"`
+			Size       int    `json:"size"`
+			Truncated  bool   `json:"truncated"`
+		} `json:"messages"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("unexpected browse response: %d %v", rr.Code, err)
+	}
+	if response.Total != 3 || len(response.Messages) != 2 {
+		t.Fatalf("unexpected page: %+v", response)
+	}
+	// Обрезка не разрывает двухбайтовые символы
+	text := response.Messages[0]
+	if text.Message != "яя" || !text.Truncated || text.Size != 20 || text.Position != 2 || text.ID == 0 || text.EnqueuedAt == "" {
+		t.Errorf("unexpected text message: %+v", text)
+	}
+	if binary := response.Messages[1]; binary.Base64 != "//79/A==" || binary.Truncated {
+		t.Errorf("unexpected binary message: %+v", binary)
+	}
+	if qb.Depth("jobs") != 3 {
+		t.Errorf("browse consumed messages: depth %d", qb.Depth("jobs"))
+	}
+
+	for _, target := range []string{"/queue/jobs/messages?limit=0", "/queue/jobs/messages?offset=-1", "/queue/jobs/messages?max_body=x", "/queue/missing/messages"} {
+		if rr := do(target); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", target, rr.Code)
+		}
+	}
+}
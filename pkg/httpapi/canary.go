@@ -0,0 +1,149 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"queue-broker/pkg/broker"
+)
+
+// CanaryResult результат последнего прогона канареечного сообщения
+type CanaryResult struct {
+	OK        bool          `json:"ok"`
+	Latency   time.Duration `json:"latency_ns"`
+	Error     string        `json:"error,omitempty"`
+	CheckedAt time.Time     `json:"checked_at"`
+}
+
+// Canary периодически проводит сообщение через весь конвейер брокера
+// (HTTP → очередь → доставка), чтобы заметить частичные отказы,
+// которые не видны простой проверке доступности порта
+type Canary struct {
+	baseURL  string
+	interval time.Duration
+	client   *http.Client
+	done     chan struct{}
+
+	mu       sync.Mutex
+	last     CanaryResult
+	runs     int
+	failures int
+}
+
+// NewCanary создает канарейку для брокера, доступного по baseURL
+// (http://host:port или unix:///path/to.sock)
+func NewCanary(baseURL string, interval time.Duration) *Canary {
+	client := &http.Client{Timeout: 10 * time.Second}
+	if path, ok := strings.CutPrefix(baseURL, "unix://"); ok {
+		baseURL, client = "http://unix", unixClient(path, 10*time.Second)
+	}
+	return &Canary{
+		baseURL:  baseURL,
+		interval: interval,
+		client:   client,
+		done:     make(chan struct{}),
+	}
+}
+
+// Start запускает периодические проверки
+func (c *Canary) Start() {
+	go func() {
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.Run()
+			case <-c.done:
+				return
+			}
+		}
+	}()
+}
+
+// Stop останавливает периодические проверки
+func (c *Canary) Stop() {
+	close(c.done)
+}
+
+// Run выполняет одну проверку и запоминает результат
+func (c *Canary) Run() CanaryResult {
+	start := time.Now()
+	err := c.roundTrip(fmt.Sprintf("canary-%d", start.UnixNano()))
+	result := CanaryResult{OK: err == nil, Latency: time.Since(start), CheckedAt: start}
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.last = result
+	c.runs++
+	if err != nil {
+		c.failures++
+	}
+	return result
+}
+
+// Result возвращает результат последней проверки
+func (c *Canary) Result() CanaryResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.last
+}
+
+// Stats возвращает результат последней проверки и счетчики прогонов и отказов
+func (c *Canary) Stats() (last CanaryResult, runs, failures int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.last, c.runs, c.failures
+}
+
+// Healthy сообщает, прошла ли последняя проверка и не устарела ли она
+func (c *Canary) Healthy() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.runs == 0 || (c.last.OK && time.Since(c.last.CheckedAt) < 3*c.interval)
+}
+
+func (c *Canary) roundTrip(payload string) error {
+	url := c.baseURL + "/queue/" + broker.CanaryQueue
+	body, _ := json.Marshal(map[string]string{"message": payload})
+	req, err := http.NewRequest(http.MethodPut, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("put: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("put: unexpected status %s", resp.Status)
+	}
+
+	// Старые канареечные сообщения от прерванных проверок пропускаются
+	for {
+		resp, err := c.client.Get(url + "?timeout=5")
+		if err != nil {
+			return fmt.Errorf("get: %w", err)
+		}
+		var msg broker.Message
+		err = json.NewDecoder(resp.Body).Decode(&msg)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("get: unexpected status %s", resp.Status)
+		}
+		if err != nil {
+			return fmt.Errorf("get: %w", err)
+		}
+		if msg.Body == payload {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"queue-broker/pkg/broker"
+)
+
+// TestCanaryRoundTrip проверяет прохождение канарейки через HTTP API и отражение результата в /healthz и /metrics
+func TestCanaryRoundTrip(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 1, 10)
+	server := httptest.NewServer(NewHandler(qb, nil))
+	defer server.Close()
+
+	// Служебная очередь не занимает место пользовательских
+	qb.PutMessage("jobs", "job 1")
+
+	canary := NewCanary(server.URL, time.Minute)
+	if result := canary.Run(); !result.OK {
+		t.Fatalf("canary failed: %s", result.Error)
+	}
+
+	rr := httptest.NewRecorder()
+	HealthHandler(qb, canary).ServeHTTP(rr, httptest.NewRequest("GET", "/healthz", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("healthz returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	rr = httptest.NewRecorder()
+	MetricsHandler(qb, canary).ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.Contains(rr.Body.String(), "queue_broker_canary_success 1") {
+		t.Errorf("metrics do not report canary success:\n%s", rr.Body.String())
+	}
+}
+
+// TestCanaryFailure проверяет, что неудачная проверка делает брокер нездоровым
+func TestCanaryFailure(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	canary := NewCanary(server.URL, time.Minute)
+	if result := canary.Run(); result.OK || result.Error == "" {
+		t.Fatalf("canary should fail against a broken pipeline: %+v", result)
+	}
+
+	rr := httptest.NewRecorder()
+	HealthHandler(qb, canary).ServeHTTP(rr, httptest.NewRequest("GET", "/healthz", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("healthz returned wrong status code: got %v want %v", rr.Code, http.StatusServiceUnavailable)
+	}
+}
@@ -0,0 +1,210 @@
+package httpapi
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DefaultCompressMinSize размер ответа в байтах, начиная с которого он
+// сжимается, по умолчанию
+const DefaultCompressMinSize = 1024
+
+// decompressBody распаковывает тело запроса с Content-Encoding gzip или deflate.
+// Ограничение maxBytes относится к распакованному телу; подпись запроса
+// проверяется раньше, по телу в том виде, в каком оно передано.
+func decompressBody(maxBytes int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body io.ReadCloser
+		var err error
+		switch encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))); encoding {
+		case "", "identity":
+			next.ServeHTTP(w, r)
+			return
+		case "gzip", "x-gzip":
+			body, err = gzip.NewReader(r.Body)
+		case "deflate":
+			body, err = zlib.NewReader(r.Body)
+		default:
+			httpError(w, "Unsupported content encoding", http.StatusUnsupportedMediaType)
+			return
+		}
+		if err != nil {
+			bodyError(w, err)
+			return
+		}
+		defer body.Close()
+		if maxBytes > 0 {
+			body = http.MaxBytesReader(w, body, maxBytes)
+		}
+		r.Body = body
+		r.Header.Del("Content-Encoding")
+		r.ContentLength = -1
+		next.ServeHTTP(w, r)
+	})
+}
+
+// compressResponses сжимает ответы не меньше minSize байт по Accept-Encoding
+// (gzip или deflate); при minSize <= 0 ответы не сжимаются. Потоковые ответы
+// и WebSocket не сжимаются: их данные должны доходить без буферизации.
+func compressResponses(minSize int, next http.Handler) http.Handler {
+	if minSize <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if exempt(r) && r.URL.Path != "/metrics" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := acceptedEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding, minSize: minSize}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// acceptedEncoding выбирает кодирование ответа по Accept-Encoding: gzip
+// предпочтительнее deflate при равном весе; пусто — сжимать нельзя
+func acceptedEncoding(header string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "*" {
+			name = "gzip"
+		}
+		if (name == "gzip" || name == "deflate") && q > 0 && (q > bestQ || q == bestQ && name == "gzip") {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+// compressibleType сообщает, имеет ли смысл сжимать содержимое такого типа
+func compressibleType(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	return mediaType == "" || strings.HasPrefix(mediaType, "text/") ||
+		strings.HasSuffix(mediaType, "json") || strings.HasSuffix(mediaType, "xml") ||
+		mediaType == "application/javascript"
+}
+
+// compressWriter накапливает начало ответа, пока не станет ясно, достигнет ли
+// он minSize; затем передает его сжатым или как есть
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+	code     int
+	buf      []byte
+	// decided ответ уже передается дальше: через enc или напрямую
+	decided bool
+	enc     io.WriteCloser
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if w.code != 0 || w.decided {
+		return
+	}
+	w.code = code
+	// Ответы без тела и ошибки передаются сразу
+	if code < 200 || code == http.StatusNoContent || code == http.StatusNotModified || code >= 300 {
+		w.decide(false)
+	}
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if !w.decided {
+		w.buf = append(w.buf, p...)
+		if len(w.buf) < w.minSize {
+			return len(p), nil
+		}
+		w.decide(true)
+		return len(p), w.flushBuffer()
+	}
+	if w.enc != nil {
+		return w.enc.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// decide начинает передачу ответа; compress — сжимать, если позволяют заголовки
+func (w *compressWriter) decide(compress bool) {
+	w.decided = true
+	header := w.Header()
+	if compress && header.Get("Content-Encoding") == "" && compressibleType(header.Get("Content-Type")) {
+		if header.Get("Content-Type") == "" {
+			header.Set("Content-Type", http.DetectContentType(w.buf))
+		}
+		header.Del("Content-Length")
+		header.Set("Content-Encoding", w.encoding)
+		if w.encoding == "gzip" {
+			w.enc = gzip.NewWriter(w.ResponseWriter)
+		} else {
+			w.enc = zlib.NewWriter(w.ResponseWriter)
+		}
+	}
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	w.ResponseWriter.WriteHeader(w.code)
+}
+
+func (w *compressWriter) flushBuffer() error {
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.enc != nil {
+		_, err = w.enc.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// Flush передает накопленное: ответ короче minSize уходит без сжатия
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.decide(len(w.buf) >= w.minSize)
+	}
+	w.flushBuffer()
+	if flusher, ok := w.enc.(interface{ Flush() error }); ok {
+		flusher.Flush()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *compressWriter) close() {
+	if !w.decided {
+		w.decide(false)
+		w.flushBuffer()
+	}
+	if w.enc != nil {
+		w.enc.Close()
+	}
+}
+
+// Unwrap открывает исходный ResponseWriter для http.ResponseController
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
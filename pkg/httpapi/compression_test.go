@@ -0,0 +1,120 @@
+package httpapi
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"queue-broker/pkg/broker"
+)
+
+func gzipped(t *testing.T, data string) *bytes.Buffer {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(data))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+// TestCompressedRequest проверяет прием сжатых тел PUT и ограничение
+// размера распакованного тела
+func TestCompressedRequest(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+	handler := NewHandler(qb, nil, WithMaxMessageSize(1024))
+	put := func(encoding string, body io.Reader) int {
+		req := httptest.NewRequest(http.MethodPut, "/queue/jobs", body)
+		req.Header.Set("Content-Encoding", encoding)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := put("gzip", gzipped(t, `{"message": "packed"}`)); code != http.StatusOK {
+		t.Fatalf("gzip body rejected: %d", code)
+	}
+	var deflated bytes.Buffer
+	zw := zlib.NewWriter(&deflated)
+	zw.Write([]byte(`{"message": "deflated"}`))
+	zw.Close()
+	if code := put("deflate", &deflated); code != http.StatusOK {
+		t.Fatalf("deflate body rejected: %d", code)
+	}
+	if msg, _ := qb.Dequeue("jobs", 0); msg.Body != "packed" {
+		t.Errorf("unexpected body %q", msg.Body)
+	}
+
+	// Сжатое тело мало, распакованное превышает лимит
+	bomb := gzipped(t, `{"message": "`+strings.Repeat("a", 4096)+`"}`)
+	if code := put("gzip", bomb); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413 for large decompressed body, got %d", code)
+	}
+	if code := put("gzip", strings.NewReader("not gzip")); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for corrupt gzip, got %d", code)
+	}
+	if code := put("br", strings.NewReader(`{"message": "x"}`)); code != http.StatusUnsupportedMediaType {
+		t.Errorf("expected 415 for unknown encoding, got %d", code)
+	}
+}
+
+// TestCompressedResponse проверяет сжатие ответов по Accept-Encoding
+// и минимальный размер
+func TestCompressedResponse(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+	handler := NewHandler(qb, nil, WithCompression(256))
+	large := strings.Repeat("payload ", 100)
+	qb.PutMessage("jobs", large)
+	qb.PutMessage("jobs", "small")
+	qb.PutMessage("jobs", large)
+	get := func(acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/queue/jobs?timeout=0", nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get("deflate;q=0.5, gzip")
+	if rr.Header().Get("Content-Encoding") != "gzip" || rr.Header().Get("Content-Type") != "application/json" || !strings.Contains(rr.Header().Get("Vary"), "Accept-Encoding") {
+		t.Fatalf("response not compressed: %v", rr.Header())
+	}
+	zr, err := gzip.NewReader(rr.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := io.ReadAll(zr); !strings.Contains(string(body), large) {
+		t.Errorf("unexpected decompressed body %q", body)
+	}
+
+	if rr := get("gzip"); rr.Header().Get("Content-Encoding") != "" || !strings.Contains(rr.Body.String(), `"small"`) {
+		t.Errorf("small response should not be compressed: %v %q", rr.Header(), rr.Body)
+	}
+	if rr := get("gzip;q=0, identity"); rr.Header().Get("Content-Encoding") != "" || !strings.Contains(rr.Body.String(), large) {
+		t.Errorf("refused encoding used: %v", rr.Header())
+	}
+	if rr := get("gzip"); rr.Code != http.StatusNotFound || rr.Header().Get("Content-Encoding") != "" {
+		t.Errorf("unexpected empty queue response: %d %v", rr.Code, rr.Header())
+	}
+}
+
+func TestAcceptedEncoding(t *testing.T) {
+	for header, expected := range map[string]string{
+		"":                          "",
+		"gzip, deflate, br":         "gzip",
+		"deflate":                   "deflate",
+		"gzip;q=0.2, deflate;q=0.8": "deflate",
+		"*":                         "gzip",
+		"gzip;q=0":                  "",
+		"identity":                  "",
+	} {
+		if got := acceptedEncoding(header); got != expected {
+			t.Errorf("%q: expected %q, got %q", header, expected, got)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package httpapi
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"queue-broker/pkg/broker"
+)
+
+// ConcurrencyLimiter ограничивает число одновременно обрабатываемых запросов.
+// Запрос сверх лимита ждет освобождения места не дольше waitTimeout, если
+// ожидающих меньше maxWaiting, иначе сразу получает 503.
+type ConcurrencyLimiter struct {
+	slots       chan struct{}
+	maxWaiting  int64
+	waitTimeout time.Duration
+
+	waiting  atomic.Int64
+	rejected atomic.Int64
+}
+
+// NewConcurrencyLimiter создает ограничитель на maxConcurrent одновременных запросов
+func NewConcurrencyLimiter(maxConcurrent, maxWaiting int, waitTimeout time.Duration) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{
+		slots:       make(chan struct{}, maxConcurrent),
+		maxWaiting:  int64(maxWaiting),
+		waitTimeout: waitTimeout,
+	}
+}
+
+// acquire занимает место для запроса; false, если место не освободилось
+func (l *ConcurrencyLimiter) acquire(r *http.Request) bool {
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+	}
+	if l.waiting.Add(1) > l.maxWaiting {
+		l.waiting.Add(-1)
+		return false
+	}
+	defer l.waiting.Add(-1)
+
+	timer := time.NewTimer(l.waitTimeout)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+// exempt сообщает, что запрос не ограничивается: проверки здоровья и метрики
+// должны отвечать и при перегрузке, а потоковые соединения живут долго
+func exempt(r *http.Request) bool {
+	switch r.URL.Path {
+	case "/healthz", "/metrics", broker.ReplicationStreamMethod:
+		return true
+	}
+	return strings.HasSuffix(r.URL.Path, "/stream") || strings.HasSuffix(r.URL.Path, "/tail") || strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+// middleware отклоняет запросы сверх лимита с 503
+func (l *ConcurrencyLimiter) middleware(next http.Handler) http.Handler {
+	if l == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if exempt(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !l.acquire(r) {
+			l.rejected.Add(1)
+			w.Header().Set("Retry-After", "1")
+			httpError(w, "Too many concurrent requests", http.StatusServiceUnavailable)
+			return
+		}
+		defer func() { <-l.slots }()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeMetrics дописывает метрики ограничения параллелизма в формате Prometheus
+func (l *ConcurrencyLimiter) writeMetrics(w io.Writer) {
+	fmt.Fprintln(w, "# TYPE queue_broker_inflight_requests gauge")
+	fmt.Fprintf(w, "queue_broker_inflight_requests %d\n", len(l.slots))
+	fmt.Fprintln(w, "# TYPE queue_broker_waiting_requests gauge")
+	fmt.Fprintf(w, "queue_broker_waiting_requests %d\n", l.waiting.Load())
+	fmt.Fprintln(w, "# TYPE queue_broker_concurrency_rejected_total counter")
+	fmt.Fprintf(w, "queue_broker_concurrency_rejected_total %d\n", l.rejected.Load())
+}
@@ -0,0 +1,70 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"queue-broker/pkg/broker"
+)
+
+// TestConcurrencyLimiter проверяет ожидание свободного места, отказ 503
+// при переполнении очереди ожидания и исключение метрик из лимита
+func TestConcurrencyLimiter(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 10)
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	})
+	limiter := NewConcurrencyLimiter(1, 1, time.Minute)
+	handler := NewHandler(broker.NewQueueBroker(100, 10, 10), nil, WithConcurrencyLimiter(limiter), WithHandler("/slow", slow))
+
+	serve := func(path string) int {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		return rr.Code
+	}
+
+	var wg sync.WaitGroup
+	codes := make([]int, 2)
+	for i := range codes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes[i] = serve("/slow")
+		}()
+		if i == 0 {
+			<-started
+		}
+	}
+	// Второй запрос ждет места, третий получает отказ
+	for limiter.waiting.Load() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	if code := serve("/slow"); code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 when wait queue is full, got %d", code)
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "queue_broker_concurrency_rejected_total 1") ||
+		!strings.Contains(rr.Body.String(), "queue_broker_inflight_requests 1") {
+		t.Errorf("unexpected metrics: %d\n%s", rr.Code, rr.Body.String())
+	}
+
+	close(release)
+	wg.Wait()
+	if codes[0] != http.StatusOK || codes[1] != http.StatusOK {
+		t.Errorf("expected queued request to be served, got %v", codes)
+	}
+
+	// Без очереди ожидания отказ следует сразу
+	limiter = NewConcurrencyLimiter(0, 0, time.Minute)
+	if limiter.acquire(httptest.NewRequest("GET", "/", nil)) {
+		t.Error("expected acquire to fail without free slots")
+	}
+}
@@ -0,0 +1,85 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+
+	"queue-broker/pkg/broker"
+)
+
+// handleQueueConfig обрабатывает GET/PUT /queue/{name}/config
+func handleQueueConfig(qb *broker.QueueBroker, w http.ResponseWriter, r *http.Request, queueName string) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		// Поля, отсутствующие в запросе, сохраняют текущие значения
+		cfg := qb.QueueConfig(queueName)
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil || cfg.DedupWindow < 0 || cfg.LockDuration <= 0 || cfg.CompressThreshold < 0 {
+			httpError(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+		for _, window := range cfg.PauseWindows {
+			if err := window.Validate(); err != nil {
+				httpError(w, "Invalid pause window: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if cfg.DefaultContentType != "" {
+			if _, _, err := mime.ParseMediaType(cfg.DefaultContentType); err != nil {
+				httpError(w, "Invalid default content type", http.StatusBadRequest)
+				return
+			}
+		}
+		if !broker.ValidCompression(cfg.Compression) {
+			httpError(w, "Unknown compression algorithm", http.StatusBadRequest)
+			return
+		}
+		if cfg.DeliveryDelayMs < 0 || cfg.DeliveryJitterMs < 0 || cfg.MaxConsumers < 0 || cfg.AutoDeleteAfterIdle < 0 || cfg.Retention < 0 || cfg.RetentionBytes < 0 {
+			httpError(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+		if (cfg.DeliveryDelayMs > 0 || cfg.DeliveryJitterMs > 0) && !qb.LatencySimulation() {
+			httpError(w, "Latency simulation is disabled", http.StatusBadRequest)
+			return
+		}
+		if cfg.Retry != nil {
+			if err := cfg.Retry.Validate(); err != nil {
+				httpError(w, "Invalid retry policy: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if cfg.Aggregate != nil {
+			if err := cfg.Aggregate.Validate(); err != nil {
+				httpError(w, "Invalid aggregation policy: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if err := broker.ValidateTransform(cfg.Transform); err != nil {
+			httpError(w, "Invalid transform: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := broker.ValidateEnvelope(cfg.Envelope); err != nil {
+			httpError(w, "Invalid envelope: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := broker.ValidateOverflow(cfg.Overflow); err != nil {
+			httpError(w, "Invalid overflow policy: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		qb.SetQueueConfig(queueName, cfg)
+	default:
+		httpError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(qb.QueueConfig(queueName))
+}
+
+// tooManyConsumers отвечает 429: к очереди уже подключено max_consumers потребителей
+func tooManyConsumers(w http.ResponseWriter, err error) {
+	w.Header().Set("Retry-After", "1")
+	errorResponse(w, err, http.StatusTooManyRequests)
+}
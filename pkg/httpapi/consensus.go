@@ -0,0 +1,88 @@
+package httpapi
+
+import (
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+
+	"queue-broker/pkg/broker"
+	"queue-broker/pkg/cluster"
+	"queue-broker/pkg/httperr"
+)
+
+// WithConsensus включает кластерный режим на Raft: узел отвечает на запросы
+// других узлов по /raft/..., а запросы клиентов, пока он не лидер,
+// пересылает лидеру
+func WithConsensus(c *broker.Consensus) Option {
+	return func(o *handlerOptions) { o.consensus = c }
+}
+
+// consensusLocal сообщает, обслуживается ли путь на любом узле кластера:
+// проверка состояния, метрики, документация и запросы узлов
+func consensusLocal(path string) bool {
+	switch path {
+	case "/healthz", "/metrics", "/openapi.json", "/docs", "/ui":
+		return true
+	}
+	return strings.HasPrefix(path, "/raft/") || strings.HasPrefix(path, "/admin/debug/")
+}
+
+// consensusMiddleware пересылает запросы клиентов лидеру кластера, если узел
+// сам клиентов не обслуживает. Запрос, уже пересланный другим узлом, не
+// пересылается повторно, чтобы узлы с устаревшим представлением о лидере не
+// передавали его по кругу.
+func consensusMiddleware(c *broker.Consensus, next http.Handler) http.Handler {
+	if c == nil {
+		return next
+	}
+	var mu sync.Mutex
+	proxies := make(map[string]*httputil.ReverseProxy)
+	proxy := func(node string) (*httputil.ReverseProxy, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if proxy, ok := proxies[node]; ok {
+			return proxy, nil
+		}
+		target, err := url.Parse(node)
+		if err != nil {
+			return nil, err
+		}
+		proxy := &httputil.ReverseProxy{
+			Rewrite: func(pr *httputil.ProxyRequest) {
+				pr.SetURL(target)
+				pr.Out.Header.Set(cluster.ForwardedHeader, c.Self())
+			},
+			// Потоковые ответы (/stream) передаются без буферизации
+			FlushInterval: -1,
+			ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+				log.Printf("raft: forward to %s failed: %v", node, err)
+				httperr.Error(w, "Cluster leader unavailable", http.StatusBadGateway)
+			},
+		}
+		proxies[node] = proxy
+		return proxy, nil
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if consensusLocal(r.URL.Path) || r.Header.Get(cluster.ForwardedHeader) != "" || c.Leading() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		leader := c.Leader()
+		if leader == "" || leader == c.Self() {
+			// Выборы еще идут или новый лидер еще не готов обслуживать клиентов
+			w.Header().Set("Retry-After", "1")
+			httperr.Error(w, "No cluster leader", http.StatusServiceUnavailable)
+			return
+		}
+		p, err := proxy(leader)
+		if err != nil {
+			httperr.Error(w, "Invalid cluster node", http.StatusBadGateway)
+			return
+		}
+		p.ServeHTTP(w, r)
+	})
+}
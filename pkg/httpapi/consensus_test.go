@@ -0,0 +1,105 @@
+package httpapi
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"queue-broker/pkg/broker"
+	"queue-broker/pkg/cluster"
+	"queue-broker/pkg/raft"
+)
+
+// TestConsensusForwarding проверяет, что ведомые узлы кластера Raft
+// пересылают запросы клиентов лидеру, а запросы узлов без общего секрета
+// отклоняются
+func TestConsensusForwarding(t *testing.T) {
+	handlers := make([]atomic.Pointer[http.Handler], 3)
+	servers := make([]*httptest.Server, 3)
+	var urls []string
+	for i := range servers {
+		servers[i] = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if h := handlers[i].Load(); h != nil {
+				(*h).ServeHTTP(w, r)
+				return
+			}
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer servers[i].Close()
+		urls = append(urls, servers[i].URL)
+	}
+	brokers := make([]*broker.QueueBroker, 3)
+	nodes := make([]*broker.Consensus, 3)
+	for i := range nodes {
+		brokers[i] = broker.NewQueueBroker(100, 10, 1)
+		c, err := brokers[i].StartConsensus(raft.Config{
+			ID:              urls[i],
+			Peers:           urls,
+			Dir:             t.TempDir(),
+			Transport:       raft.NewHTTPTransport("s3cret"),
+			ElectionTimeout: 100 * time.Millisecond,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		nodes[i] = c
+		h := NewHandler(brokers[i], nil, WithConsensus(c), WithPeerSecret("s3cret"))
+		handlers[i].Store(&h)
+	}
+
+	leader := -1
+	deadline := time.Now().Add(5 * time.Second)
+	for leader < 0 && time.Now().Before(deadline) {
+		for i, c := range nodes {
+			if c.Leading() {
+				leader = i
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if leader < 0 {
+		t.Fatal("no leader elected")
+	}
+	follower := (leader + 1) % 3
+	for nodes[follower].Leader() != urls[leader] && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	req, _ := http.NewRequest("PUT", urls[follower]+"/queue/jobs", bytes.NewBufferString(`{"message": "routed"}`))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("put through a follower failed: %v %v", err, resp)
+	}
+	resp.Body.Close()
+	if brokers[leader].Depth("jobs") != 1 {
+		t.Fatalf("leader depth %d, want 1", brokers[leader].Depth("jobs"))
+	}
+
+	// Уже пересланный запрос ведомый обслуживает сам и, как резерв, отклоняет
+	req, _ = http.NewRequest("PUT", urls[follower]+"/queue/jobs", bytes.NewBufferString(`{"message": "looped"}`))
+	req.Header.Set(cluster.ForwardedHeader, urls[leader])
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("forwarded put on a follower: %d, want 503", resp.StatusCode)
+	}
+
+	resp, err = http.Post(urls[follower]+raft.VotePath, "application/json", bytes.NewBufferString(`{"term": 100, "candidate": "http://evil"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("vote without the peer secret: %d, want 401", resp.StatusCode)
+	}
+	if pathSurface(raft.AppendPath) != SurfacePeer {
+		t.Errorf("raft requests are not on the peer surface")
+	}
+}
@@ -0,0 +1,47 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"queue-broker/pkg/broker"
+)
+
+// handleHeartbeat обрабатывает POST /queue/{name}/heartbeat: регистрирует
+// потребителя или продлевает его регистрацию на timeout секунд
+func handleHeartbeat(qb *broker.QueueBroker, w http.ResponseWriter, r *http.Request, queueName string) {
+	if r.Method != http.MethodPost {
+		httpError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var requestBody struct {
+		Consumer string `json:"consumer"`
+		Timeout  int    `json:"timeout"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil || requestBody.Timeout < 0 {
+		httpError(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	info, err := qb.Heartbeat(queueName, requestBody.Consumer, time.Duration(requestBody.Timeout)*time.Second)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errorCode(err, http.StatusBadRequest), "Invalid consumer id", nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(info)
+}
+
+// handleQueueConsumers обрабатывает GET /queue/{name}/consumers:
+// зарегистрированные потребители и выданные им сообщения
+func handleQueueConsumers(qb *broker.QueueBroker, w http.ResponseWriter, r *http.Request, queueName string) {
+	if r.Method != http.MethodGet {
+		httpError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{"consumers": qb.RegisteredConsumers(queueName)})
+}
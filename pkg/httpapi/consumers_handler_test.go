@@ -0,0 +1,56 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"queue-broker/pkg/broker"
+)
+
+// TestConsumerHeartbeatEndpoints проверяет регистрацию потребителя и
+// просмотр выданных ему сообщений
+func TestConsumerHeartbeatEndpoints(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+	handler := QueueHandler(qb)
+	qb.PutMessage("jobs", "a")
+
+	heartbeat := func(body string) (int, broker.ConsumerInfo) {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/queue/jobs/heartbeat", strings.NewReader(body)))
+		var info broker.ConsumerInfo
+		if rr.Code == http.StatusOK {
+			json.NewDecoder(rr.Body).Decode(&info)
+		}
+		return rr.Code, info
+	}
+	if code, info := heartbeat(`{"consumer": "w1", "timeout": 60}`); code != http.StatusOK || info.ID != "w1" || info.Timeout != 60 {
+		t.Fatalf("unexpected heartbeat response %d %+v", code, info)
+	}
+	if code, _ := heartbeat(`{"timeout": 60}`); code != http.StatusBadRequest {
+		t.Errorf("heartbeat without consumer returned %d", code)
+	}
+
+	if code, _ := peekLock(t, handler, "/queue/jobs?mode=peeklock&timeout=0&consumer=w1"); code != http.StatusOK {
+		t.Fatalf("unexpected peek-lock status %d", code)
+	}
+	// Получение с новым идентификатором регистрирует потребителя
+	peekLock(t, handler, "/queue/jobs?mode=peeklock&timeout=0&consumer=w2")
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/queue/jobs/consumers", nil))
+	var response struct {
+		Consumers []broker.ConsumerInfo `json:"consumers"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("unexpected consumers response %d: %v", rr.Code, err)
+	}
+	if len(response.Consumers) != 2 || response.Consumers[0].ID != "w1" || response.Consumers[0].InFlight != 1 || len(response.Consumers[0].Messages) != 1 {
+		t.Errorf("unexpected consumers %+v", response.Consumers)
+	}
+	if c := response.Consumers[1]; c.ID != "w2" || c.InFlight != 0 || c.Timeout != 30 {
+		t.Errorf("unexpected implicitly registered consumer %+v", c)
+	}
+}
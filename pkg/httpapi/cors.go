@@ -0,0 +1,124 @@
+package httpapi
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// CORSConfig настройки CORS для браузерных клиентов
+type CORSConfig struct {
+	// AllowedOrigins разрешенные источники вида https://app.example.com;
+	// "*" разрешает любой источник
+	AllowedOrigins []string `json:"allowed_origins"`
+	// AllowedMethods разрешенные методы (по умолчанию GET, PUT, POST, DELETE)
+	AllowedMethods []string `json:"allowed_methods"`
+	// AllowedHeaders разрешенные заголовки запроса; если не заданы,
+	// разрешаются все запрошенные в preflight
+	AllowedHeaders []string `json:"allowed_headers"`
+	// ExposedHeaders заголовки ответа, доступные скрипту, в дополнение
+	// к заголовкам сообщений брокера
+	ExposedHeaders []string `json:"exposed_headers"`
+	// AllowCredentials разрешает запросы с cookie и Authorization
+	AllowCredentials bool `json:"allow_credentials"`
+	// MaxAge сколько секунд браузер может кэшировать ответ на preflight
+	MaxAge int `json:"max_age"`
+}
+
+// corsExposedHeaders заголовки ответов брокера, которые нужны клиенту
+var corsExposedHeaders = []string{
+	"Retry-After", "X-Duplicate", "X-Message-Queue", "X-Dedup-Id", groupHeader,
+	"X-Lock-Token", "X-Locked-Until", "X-Lock-Duration",
+}
+
+// CORS отвечает на preflight-запросы и добавляет заголовки CORS к ответам
+// на запросы с разрешенных источников. Запросы с других источников
+// обрабатываются как обычно, но без заголовков CORS, поэтому браузер не
+// отдаст ответ скрипту.
+type CORS struct {
+	cfg     CORSConfig
+	methods string
+	headers string
+	exposed string
+}
+
+// NewCORS создает обработчик CORS
+func NewCORS(cfg CORSConfig) *CORS {
+	methods := cfg.AllowedMethods
+	if len(methods) == 0 {
+		methods = []string{http.MethodGet, http.MethodPut, http.MethodPost, http.MethodDelete}
+	}
+	return &CORS{
+		cfg:     cfg,
+		methods: strings.Join(methods, ", "),
+		headers: strings.Join(cfg.AllowedHeaders, ", "),
+		exposed: strings.Join(append(slices.Clone(corsExposedHeaders), cfg.ExposedHeaders...), ", "),
+	}
+}
+
+// allowedOrigin возвращает значение Access-Control-Allow-Origin для origin
+// или пустую строку, если источник не разрешен
+func (c *CORS) allowedOrigin(origin string) string {
+	for _, allowed := range c.cfg.AllowedOrigins {
+		if allowed == "*" {
+			// С учетными данными браузер не принимает "*"
+			if c.cfg.AllowCredentials {
+				return origin
+			}
+			return "*"
+		}
+		if strings.EqualFold(allowed, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+func (c *CORS) middleware(next http.Handler) http.Handler {
+	if c == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		allowed := c.allowedOrigin(origin)
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if allowed == "" {
+			if preflight {
+				httpError(w, "Origin not allowed", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		h.Set("Access-Control-Allow-Origin", allowed)
+		if c.cfg.AllowCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if !preflight {
+			h.Set("Access-Control-Expose-Headers", c.exposed)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h.Add("Vary", "Access-Control-Request-Method")
+		h.Add("Vary", "Access-Control-Request-Headers")
+		h.Set("Access-Control-Allow-Methods", c.methods)
+		if c.headers != "" {
+			h.Set("Access-Control-Allow-Headers", c.headers)
+		} else if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+			h.Set("Access-Control-Allow-Headers", requested)
+		}
+		if c.cfg.MaxAge > 0 {
+			h.Set("Access-Control-Max-Age", strconv.Itoa(c.cfg.MaxAge))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,69 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"queue-broker/pkg/broker"
+)
+
+// TestCORSPreflight проверяет ответ на preflight для разрешенного и чужого источника
+func TestCORSPreflight(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+	cors := NewCORS(CORSConfig{AllowedOrigins: []string{"https://app.example.com"}, MaxAge: 600})
+	handler := NewHandler(qb, nil, WithCORS(cors))
+
+	preflight := func(origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodOptions, "/queue/jobs", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", "PUT")
+		req.Header.Set("Access-Control-Request-Headers", "content-type, x-group-id")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := preflight("https://app.example.com")
+	h := rr.Header()
+	if rr.Code != http.StatusNoContent || h.Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		!strings.Contains(h.Get("Access-Control-Allow-Methods"), "PUT") ||
+		h.Get("Access-Control-Allow-Headers") != "content-type, x-group-id" || h.Get("Access-Control-Max-Age") != "600" {
+		t.Errorf("unexpected preflight response: %d %v", rr.Code, h)
+	}
+
+	if rr := preflight("https://evil.example.com"); rr.Code != http.StatusForbidden || rr.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("foreign origin allowed: %d %v", rr.Code, rr.Header())
+	}
+}
+
+// TestCORSSimpleRequest проверяет заголовки CORS на обычных запросах
+func TestCORSSimpleRequest(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+	handler := NewHandler(qb, nil, WithCORS(NewCORS(CORSConfig{AllowedOrigins: []string{"*"}, ExposedHeaders: []string{"X-Message-Header-Trace"}})))
+
+	req := httptest.NewRequest(http.MethodPut, "/queue/jobs", strings.NewReader(`{"message": "hi"}`))
+	req.Header.Set("Origin", "https://spa.example.com")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	exposed := rr.Header().Get("Access-Control-Expose-Headers")
+	if rr.Code != http.StatusOK || rr.Header().Get("Access-Control-Allow-Origin") != "*" ||
+		!strings.Contains(exposed, "X-Lock-Token") || !strings.Contains(exposed, "X-Message-Header-Trace") {
+		t.Errorf("unexpected response: %d %v", rr.Code, rr.Header())
+	}
+
+	// С учетными данными вместо "*" возвращается сам источник
+	credentials := NewCORS(CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true})
+	if got := credentials.allowedOrigin("https://spa.example.com"); got != "https://spa.example.com" {
+		t.Errorf("expected origin to be echoed, got %q", got)
+	}
+
+	// Без заголовка Origin ответ не меняется
+	req = httptest.NewRequest(http.MethodGet, "/queue/jobs?timeout=0", nil)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || rr.Header().Get("Access-Control-Allow-Origin") != "" || rr.Header().Get("Vary") != "" {
+		t.Errorf("unexpected response without origin: %d %v", rr.Code, rr.Header())
+	}
+}
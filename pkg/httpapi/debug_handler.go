@@ -0,0 +1,84 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+
+	"queue-broker/pkg/broker"
+)
+
+// debugState состояние процесса и очередей для диагностики (GET /admin/debug/state)
+type debugState struct {
+	Time       time.Time `json:"time"`
+	Goroutines int       `json:"goroutines"`
+	// HeapAlloc и HeapObjects занятая куча и число объектов в ней
+	HeapAlloc   uint64             `json:"heap_alloc"`
+	HeapObjects uint64             `json:"heap_objects"`
+	NumGC       uint32             `json:"num_gc"`
+	Queues      []broker.QueueInfo `json:"queues"`
+	// Waiters ожидающие получатели по очередям и шаблонам: висящие
+	// long-poll и потоковые потребители
+	Waiters map[string]int `json:"waiters"`
+	// Consumers зарегистрированные через heartbeat потребители по очередям
+	Consumers map[string][]broker.ConsumerInfo `json:"consumers,omitempty"`
+}
+
+// debugOnAdminListener отвечает 404 на отладочные запросы, пришедшие не на
+// отдельный административный сокет: профили и состояние процесса не должны
+// быть доступны там же, где клиенты, даже без настроенной аутентификации
+func debugOnAdminListener(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !adminListener(r) {
+			notFound(w)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// debugHandler обрабатывает /admin/debug/: профили net/http/pprof под
+// /admin/debug/pprof/, переменные expvar на /admin/debug/vars и снимок
+// состояния на /admin/debug/state
+func debugHandler(qb *broker.QueueBroker) http.Handler {
+	mux := http.NewServeMux()
+	// pprof ищет имя профиля после /debug/pprof/
+	profiles := http.NewServeMux()
+	profiles.HandleFunc("/debug/pprof/", pprof.Index)
+	profiles.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	profiles.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	profiles.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	profiles.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/admin/debug/pprof/", http.StripPrefix("/admin", profiles))
+	mux.Handle("/admin/debug/vars", expvar.Handler())
+
+	rt := newRouter()
+	rt.handleFunc("/admin/debug/state", func(w http.ResponseWriter, r *http.Request) {
+		var mem runtime.MemStats
+		runtime.ReadMemStats(&mem)
+		state := debugState{
+			Time:        time.Now().UTC(),
+			Goroutines:  runtime.NumGoroutine(),
+			HeapAlloc:   mem.HeapAlloc,
+			HeapObjects: mem.HeapObjects,
+			NumGC:       mem.NumGC,
+			Queues:      qb.Queues(),
+			Waiters:     qb.Waiters(),
+		}
+		for _, q := range state.Queues {
+			if consumers := qb.RegisteredConsumers(q.Name); len(consumers) > 0 {
+				if state.Consumers == nil {
+					state.Consumers = make(map[string][]broker.ConsumerInfo)
+				}
+				state.Consumers[q.Name] = consumers
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(state)
+	}, http.MethodGet)
+	mux.Handle("/admin/debug/state", rt)
+	return mux
+}
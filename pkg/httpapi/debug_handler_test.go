@@ -0,0 +1,81 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"queue-broker/pkg/broker"
+)
+
+// TestDebugHandler проверяет профили, expvar и снимок состояния на
+// административном сокете
+func TestDebugHandler(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+	qb.PutMessage("jobs", "x")
+	handler := Restrict(NewHandler(qb, nil), SurfaceAdmin)
+	get := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		return rr
+	}
+
+	if rr := get("/admin/debug/pprof/"); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "goroutine") {
+		t.Errorf("pprof index: %d", rr.Code)
+	}
+	if rr := get("/admin/debug/pprof/goroutine?debug=1"); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "goroutine profile") {
+		t.Errorf("goroutine profile: %d %q", rr.Code, rr.Body.String())
+	}
+	if rr := get("/admin/debug/vars"); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "memstats") {
+		t.Errorf("expvar: %d", rr.Code)
+	}
+
+	go qb.Dequeue("idle", 2*time.Second)
+	deadline := time.Now().Add(time.Second)
+	for qb.Waiters()["idle"] == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	rr := get("/admin/debug/state")
+	var state debugState
+	if err := json.NewDecoder(rr.Body).Decode(&state); err != nil {
+		t.Fatal(err)
+	}
+	if state.Goroutines == 0 || len(state.Queues) != 1 || state.Queues[0].Depth != 1 || state.Waiters["idle"] != 1 {
+		t.Errorf("unexpected state %+v", state)
+	}
+	qb.PutMessage("idle", "wake")
+}
+
+// TestDebugHandlerAuth проверяет, что отладочные маршруты требуют аутентификации
+func TestDebugHandlerAuth(t *testing.T) {
+	validator := NewTokenValidator(OIDCConfig{Issuer: "https://issuer.example", JWKSURL: "https://issuer.example/jwks"})
+	handler := Restrict(NewHandler(broker.NewQueueBroker(100, 10, 10), nil, WithTokenValidator(validator)), SurfaceAdmin)
+	for _, path := range []string{"/admin/debug/pprof/", "/admin/debug/vars", "/admin/debug/state"} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("%s: got %d without token", path, rr.Code)
+		}
+	}
+}
+
+// TestDebugHandlerListener проверяет, что отладочные маршруты не обслуживаются
+// сокетом, принимающим запросы клиентов
+func TestDebugHandlerListener(t *testing.T) {
+	handler := NewHandler(broker.NewQueueBroker(100, 10, 10), nil)
+	for name, h := range map[string]http.Handler{
+		"unrestricted": handler,
+		"data":         Restrict(handler, SurfaceData, SurfaceAdmin, SurfaceMetrics, SurfacePeer),
+	} {
+		for _, path := range []string{"/admin/debug/pprof/", "/admin/debug/vars", "/admin/debug/state"} {
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+			if rr.Code != http.StatusNotFound {
+				t.Errorf("%s %s: got %d, want 404", name, path, rr.Code)
+			}
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package httpapi
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"queue-broker/pkg/broker"
+)
+
+// TestPutMessageDeduplication проверяет подавление повторов по Idempotency-Key и dedup_id
+func TestPutMessageDeduplication(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+	qb.SetDefaultDedupWindow(60)
+	handler := QueueHandler(qb)
+
+	put := func(body, key string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("PUT", "/queue/jobs", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+		}
+		return rr
+	}
+
+	put(`{"message": "job 1"}`, "key-1")
+	if rr := put(`{"message": "job 1"}`, "key-1"); rr.Header().Get("X-Duplicate") != "true" {
+		t.Errorf("retry with the same Idempotency-Key was not reported as duplicate")
+	}
+	put(`{"message": "job 2", "dedup_id": "key-2"}`, "")
+	put(`{"message": "job 2", "dedup_id": "key-2"}`, "")
+	put(`{"message": "job 3"}`, "")
+	put(`{"message": "job 3"}`, "")
+
+	if got := qb.Depth("jobs"); got != 4 {
+		t.Errorf("queue contains %d messages, want 4", got)
+	}
+}
+
+// TestQueueConfigDedupWindow проверяет настройку окна дедупликации через /config
+func TestQueueConfigDedupWindow(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+	handler := QueueHandler(qb)
+
+	req, err := http.NewRequest("PUT", "/queue/jobs/config", bytes.NewBufferString(`{"dedup_window": 30}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if cfg := qb.QueueConfig("jobs"); cfg.DedupWindow != 30 {
+		t.Errorf("dedup window was not applied: got %d want 30", cfg.DedupWindow)
+	}
+
+	qb.Enqueue("jobs", &broker.Message{Body: "a", DedupID: "k"})
+	qb.Enqueue("jobs", &broker.Message{Body: "a", DedupID: "k"})
+	qb.Enqueue("other", &broker.Message{Body: "a", DedupID: "k"})
+	qb.Enqueue("other", &broker.Message{Body: "a", DedupID: "k"})
+	if qb.Depth("jobs") != 1 || qb.Depth("other") != 2 {
+		t.Errorf("dedup window must apply only to the configured queue")
+	}
+}
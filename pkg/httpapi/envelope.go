@@ -0,0 +1,326 @@
+package httpapi
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"queue-broker/pkg/broker"
+)
+
+// Быстрый путь PUT и GET: тело запроса читается в буфер из пула, типичный
+// конверт сообщения разбирается и кодируется вручную, без отражения. Все,
+// что быстрый путь не распознал, обрабатывается encoding/json, поэтому
+// формат API не меняется.
+
+// maxPooledBuffer буферы больше этого размера не возвращаются в пул,
+// чтобы одно большое сообщение не удерживало память
+const maxPooledBuffer = 64 << 10
+
+var bufferPool = sync.Pool{New: func() any {
+	b := make([]byte, 0, 512)
+	return &b
+}}
+
+// jsonHeader заранее подготовленное значение заголовка Content-Type
+var jsonHeader = []string{jsonContentType}
+
+func getBuffer() *[]byte {
+	return bufferPool.Get().(*[]byte)
+}
+
+func putBuffer(b *[]byte) {
+	if cap(*b) > maxPooledBuffer {
+		return
+	}
+	*b = (*b)[:0]
+	bufferPool.Put(b)
+}
+
+// readBody дочитывает r в конец b, как io.ReadAll
+func readBody(r io.Reader, b []byte) ([]byte, error) {
+	for {
+		if len(b) == cap(b) {
+			b = append(b, 0)[:len(b)]
+		}
+		n, err := r.Read(b[len(b):cap(b)])
+		b = b[:len(b)+n]
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return b, err
+		}
+	}
+}
+
+// decodeEnvelope разбирает конверт PUT вида {"message": "...", "headers": {...}},
+// если в нем только известные поля со строками без escape-последовательностей.
+// false — конверт нужно разобрать encoding/json.
+func decodeEnvelope(data []byte, msg *broker.Message, base64Body *string) bool {
+	p := &envelopeParser{data: data}
+	if !p.consume('{') {
+		return false
+	}
+	if p.consume('}') {
+		return p.end()
+	}
+	for {
+		key, ok := p.string()
+		if !ok || !p.consume(':') {
+			return false
+		}
+		if key == "headers" {
+			if !p.headers(msg) {
+				return false
+			}
+		} else {
+			value, ok := p.string()
+			if !ok {
+				return false
+			}
+			switch key {
+			case "message":
+				msg.Body = value
+			case "message_base64":
+				*base64Body = value
+			case "dedup_id":
+				msg.DedupID = value
+			case "content_type":
+				msg.ContentType = value
+			case "queue":
+				msg.Queue = value
+			case "group_id":
+				msg.GroupID = value
+			default:
+				return false
+			}
+		}
+		if p.consume('}') {
+			return p.end()
+		}
+		if !p.consume(',') {
+			return false
+		}
+	}
+}
+
+// unmarshalEnvelope разбирает конверт PUT через encoding/json и возвращает
+// значение поля message_base64
+func unmarshalEnvelope(data []byte, msg *broker.Message) (string, error) {
+	envelope := struct {
+		*broker.Message
+		Base64 string `json:"message_base64"`
+	}{Message: msg}
+	err := json.Unmarshal(data, &envelope)
+	return envelope.Base64, err
+}
+
+type envelopeParser struct {
+	data []byte
+	pos  int
+}
+
+func (p *envelopeParser) skipSpace() {
+	for p.pos < len(p.data) {
+		switch p.data[p.pos] {
+		case ' ', '\t', '\n', '\r':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (p *envelopeParser) consume(c byte) bool {
+	p.skipSpace()
+	if p.pos < len(p.data) && p.data[p.pos] == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *envelopeParser) end() bool {
+	p.skipSpace()
+	return p.pos == len(p.data)
+}
+
+// string читает строку без escape-последовательностей и управляющих символов
+func (p *envelopeParser) string() (string, bool) {
+	if !p.consume('"') {
+		return "", false
+	}
+	start := p.pos
+	for p.pos < len(p.data) {
+		switch c := p.data[p.pos]; {
+		case c == '"':
+			s := string(p.data[start:p.pos])
+			p.pos++
+			return s, true
+		case c == '\\' || c < 0x20:
+			return "", false
+		}
+		p.pos++
+	}
+	return "", false
+}
+
+func (p *envelopeParser) headers(msg *broker.Message) bool {
+	if !p.consume('{') {
+		return false
+	}
+	msg.Headers = make(map[string]string)
+	if p.consume('}') {
+		return true
+	}
+	for {
+		name, ok := p.string()
+		if !ok || !p.consume(':') {
+			return false
+		}
+		value, ok := p.string()
+		if !ok {
+			return false
+		}
+		msg.Headers[name] = value
+		if p.consume('}') {
+			return true
+		}
+		if !p.consume(',') {
+			return false
+		}
+	}
+}
+
+// appendMessageJSON кодирует выданное сообщение так же, как encoding/json
+// кодирует jsonView(msg или delivery, force), включая порядок полей
+func appendMessageJSON(b []byte, msg *broker.Message, delivery *broker.Delivery, force bool) []byte {
+	binary := force || isBinary(msg)
+	b = append(b, '{')
+	if !binary {
+		b = appendField(b, "message")
+		b = appendString(b, msg.Body)
+	}
+	if len(msg.Headers) > 0 {
+		b = appendField(b, "headers")
+		b = appendHeaders(b, msg.Headers)
+	}
+	for _, field := range [...]struct{ name, value string }{
+		{"dedup_id", msg.DedupID},
+		{"content_type", msg.ContentType},
+		{"queue", msg.Queue},
+		{"group_id", msg.GroupID},
+	} {
+		if field.value != "" {
+			b = appendField(b, field.name)
+			b = appendString(b, field.value)
+		}
+	}
+	if delivery != nil {
+		b = appendField(b, "lock_token")
+		b = appendString(b, delivery.LockToken)
+		b = appendField(b, "locked_until")
+		b = append(b, '"')
+		b = delivery.LockedUntil.AppendFormat(b, time.RFC3339Nano)
+		b = append(b, '"')
+		b = appendField(b, "lock_duration")
+		b = strconv.AppendInt(b, int64(delivery.LockDuration), 10)
+	}
+	if binary {
+		b = appendField(b, "message_base64")
+		b = append(b, '"')
+		b = base64.StdEncoding.AppendEncode(b, []byte(msg.Body))
+		b = append(b, '"')
+	}
+	return append(b, '}')
+}
+
+// appendField дописывает имя поля объекта и, если нужно, запятую перед ним
+func appendField(b []byte, name string) []byte {
+	if b[len(b)-1] != '{' {
+		b = append(b, ',')
+	}
+	b = append(b, '"')
+	b = append(b, name...)
+	return append(b, '"', ':')
+}
+
+// appendHeaders кодирует заголовки со сортировкой имен, как encoding/json
+func appendHeaders(b []byte, headers map[string]string) []byte {
+	names := make([]string, 0, 8)
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	b = append(b, '{')
+	for _, name := range names {
+		if b[len(b)-1] != '{' {
+			b = append(b, ',')
+		}
+		b = appendString(b, name)
+		b = append(b, ':')
+		b = appendString(b, headers[name])
+	}
+	return append(b, '}')
+}
+
+const hexDigits = "0123456789abcdef"
+
+// appendString кодирует строку JSON так же, как encoding/json с экранированием
+// HTML: <, > и & заменяются \u-последовательностями, некорректный UTF-8 — U+FFFD
+func appendString(b []byte, s string) []byte {
+	b = append(b, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if c := s[i]; c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' && c != '<' && c != '>' && c != '&' {
+				i++
+				continue
+			}
+			b = append(b, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				b = append(b, '\\', c)
+			case '\b':
+				b = append(b, '\\', 'b')
+			case '\f':
+				b = append(b, '\\', 'f')
+			case '\n':
+				b = append(b, '\\', 'n')
+			case '\r':
+				b = append(b, '\\', 'r')
+			case '\t':
+				b = append(b, '\\', 't')
+			default:
+				b = append(b, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			b = append(b, s[start:i]...)
+			b = append(b, `\ufffd`...)
+			i += size
+			start = i
+			continue
+		}
+		if r == '\u2028' || r == '\u2029' {
+			b = append(b, s[start:i]...)
+			b = append(b, '\\', 'u', '2', '0', '2', hexDigits[r&0xf])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	b = append(b, s[start:]...)
+	return append(b, '"')
+}
@@ -0,0 +1,129 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"queue-broker/pkg/broker"
+)
+
+// TestAppendMessageJSON проверяет, что ручное кодирование совпадает с encoding/json
+func TestAppendMessageJSON(t *testing.T) {
+	messages := []*broker.Message{
+		{Body: "plain", Queue: "jobs"},
+		{Body: "quote \" back\\slash <tag> & \u2028 \t\n\b\f\x01 юникод", Headers: map[string]string{"b": "2", "a": "<1>"}, DedupID: "d", GroupID: "g", Queue: "jobs"},
+		{Body: "\x00\xff", ContentType: "application/octet-stream", Queue: "blobs"},
+		{Body: "{}", ContentType: "application/json", Headers: map[string]string{}},
+	}
+	lockedUntil := time.Date(2026, 1, 2, 3, 4, 5, 6000, time.UTC)
+	for _, msg := range messages {
+		delivery := &broker.Delivery{Message: msg, LockToken: "token", LockedUntil: lockedUntil, LockDuration: 30}
+		for _, force := range []bool{false, true} {
+			for _, v := range []any{msg, delivery} {
+				want, _ := json.Marshal(jsonView(v, force))
+				var got []byte
+				if d, ok := v.(*broker.Delivery); ok {
+					got = appendMessageJSON(nil, d.Message, d, force)
+				} else {
+					got = appendMessageJSON(nil, msg, nil, force)
+				}
+				if string(got) != string(want) {
+					t.Errorf("force=%v:\ngot  %s\nwant %s", force, got, want)
+				}
+			}
+		}
+	}
+
+	// Некорректный UTF-8 в заголовках заменяется U+FFFD (версии encoding/json
+	// записывают его по-разному, поэтому сравнивается результат разбора)
+	var decoded string
+	if err := json.Unmarshal(appendString(nil, "a\xffb"), &decoded); err != nil || decoded != "a\uFFFDb" {
+		t.Errorf("unexpected invalid UTF-8 encoding: %q %v", decoded, err)
+	}
+}
+
+// TestDecodeEnvelope проверяет, что быстрый разбор совпадает с encoding/json,
+// а все, что он не поддерживает, передается encoding/json
+func TestDecodeEnvelope(t *testing.T) {
+	for body, fast := range map[string]bool{
+		`{"message": "hi", "headers": {"a": "1", "b": "2"}, "dedup_id": "d", "group_id": "g"}`: true,
+		` { "message_base64" : "aGk=" , "content_type":"text/plain" } `:                        true,
+		`{"headers": {}, "message": "x"}`:                                                      true,
+		`{}`:                                                                                   true,
+		`{"message": "esc\"aped"}`:                                                             false,
+		`{"Message": "case"}`:                                                                  false,
+		`{"message": "hi", "extra": 1}`:                                                        false,
+		`{"message": "hi", "headers": null}`:                                                   false,
+		`{"message": "hi"} trailing`:                                                           false,
+		`{"message": "hi",}`:                                                                   false,
+	} {
+		var msg broker.Message
+		var base64Body string
+		if got := decodeEnvelope([]byte(body), &msg, &base64Body); got != fast {
+			t.Errorf("%s: fast path %v, want %v", body, got, fast)
+			continue
+		}
+		if !fast {
+			continue
+		}
+		var want broker.Message
+		wantBase64, err := unmarshalEnvelope([]byte(body), &want)
+		if err != nil || !reflect.DeepEqual(msg, want) || base64Body != wantBase64 {
+			t.Errorf("%s: got %+v %q, want %+v %q (%v)", body, msg, base64Body, want, wantBase64, err)
+		}
+	}
+}
+
+// nopResponseWriter ответ без записи: в бенчмарках измеряется только обработчик
+type nopResponseWriter struct {
+	header http.Header
+}
+
+func (w *nopResponseWriter) Header() http.Header         { return w.header }
+func (w *nopResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *nopResponseWriter) WriteHeader(int)             {}
+
+// rewindBody тело запроса, которое можно перечитать в следующей итерации
+type rewindBody struct {
+	strings.Reader
+}
+
+func (*rewindBody) Close() error { return nil }
+
+// BenchmarkHTTPPut измеряет постановку сообщения в JSON через HTTP API
+func BenchmarkHTTPPut(b *testing.B) {
+	qb := broker.NewQueueBroker(b.N+1, 10, 0)
+	handler := QueueHandler(qb)
+	body := `{"message": "payload of a typical size for a queue message", "headers": {"trace": "abc"}}`
+	req := httptest.NewRequest("PUT", "/queue/bench", nil)
+	reader := &rewindBody{}
+	w := &nopResponseWriter{header: make(http.Header)}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		reader.Reset(body)
+		req.Body = reader
+		handler.ServeHTTP(w, req)
+	}
+}
+
+// BenchmarkHTTPGet измеряет выдачу сообщения в JSON через HTTP API
+func BenchmarkHTTPGet(b *testing.B) {
+	qb := broker.NewQueueBroker(b.N+1, 10, 0)
+	handler := QueueHandler(qb)
+	for i := 0; i < b.N; i++ {
+		qb.Enqueue("bench", &broker.Message{Body: "payload of a typical size for a queue message", Headers: map[string]string{"trace": "abc"}})
+	}
+	req := httptest.NewRequest("GET", "/queue/bench?timeout=0", nil)
+	w := &nopResponseWriter{header: make(http.Header)}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		handler.ServeHTTP(w, req)
+	}
+}
@@ -0,0 +1,50 @@
+package httpapi
+
+import (
+	"net/http"
+
+	"queue-broker/pkg/broker"
+	"queue-broker/pkg/httperr"
+)
+
+// errorBody тело ответа с ошибкой (см. httperr.Body):
+//
+//	{"error": {"code": "QUEUE_FULL", "message": "queue is full", "details": {...}}}
+type errorBody = httperr.Body
+
+// writeError отвечает ошибкой в формате errorBody; заголовки, заданные до
+// вызова (например, Retry-After), сохраняются
+func writeError(w http.ResponseWriter, status int, code, message string, details any) {
+	httperr.Write(w, status, code, message, details)
+}
+
+// httpError замена http.Error: код ошибки определяется по статусу ответа
+func httpError(w http.ResponseWriter, message string, status int) {
+	httperr.Error(w, message, status)
+}
+
+// errorResponse отвечает ошибкой err со статусом status; код берется из
+// ошибки брокера, если err — она
+func errorResponse(w http.ResponseWriter, err error, status int) {
+	writeError(w, status, errorCode(err, status), err.Error(), nil)
+}
+
+// errorCode код ошибки брокера err, а если err — не она, код по статусу ответа
+func errorCode(err error, status int) string {
+	if code := broker.ErrorCode(err); code != "" {
+		return code
+	}
+	return statusCode(status)
+}
+
+// notFound замена http.NotFound для путей, которых нет в API (или которые
+// не обслуживает этот сервер): код ROUTE_NOT_FOUND отличает их от
+// отсутствующих очередей и сообщений
+func notFound(w http.ResponseWriter) {
+	writeError(w, http.StatusNotFound, "ROUTE_NOT_FOUND", "Not found", nil)
+}
+
+// statusCode код ошибки по статусу ответа: "Not Found" — NOT_FOUND
+func statusCode(status int) string {
+	return httperr.StatusCode(status)
+}
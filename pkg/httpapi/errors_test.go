@@ -0,0 +1,44 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"queue-broker/pkg/broker"
+)
+
+// TestErrorResponses проверяет формат ответов с ошибками и их коды
+func TestErrorResponses(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+	qb.PutMessage("jobs", "x")
+	qb.Dequeue("jobs", 0)
+	handler := NewHandler(qb, nil)
+
+	cases := []struct {
+		method, path, body string
+		status             int
+		code               string
+	}{
+		{http.MethodGet, "/queue/jobs?timeout=0", "", http.StatusNotFound, "NO_MESSAGE"},
+		{http.MethodGet, "/queue/missing?timeout=0", "", http.StatusBadRequest, "QUEUE_NOT_FOUND"},
+		{http.MethodPut, "/queue/jobs", `{"message": 1}`, http.StatusBadRequest, "BAD_REQUEST"},
+		{http.MethodPost, "/queue/jobs", "", http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED"},
+		{http.MethodGet, "/no/such/path", "", http.StatusNotFound, "ROUTE_NOT_FOUND"},
+		{http.MethodPost, "/transactions/missing/commit", "", http.StatusNotFound, "TRANSACTION_NOT_FOUND"},
+	}
+	for _, tc := range cases {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body)))
+		var body errorBody
+		if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil || rr.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("%s %s: not a JSON error: %q", tc.method, tc.path, rr.Body)
+			continue
+		}
+		if rr.Code != tc.status || body.Error.Code != tc.code || body.Error.Message == "" {
+			t.Errorf("%s %s: got %d %+v, want %d %s", tc.method, tc.path, rr.Code, body.Error, tc.status, tc.code)
+		}
+	}
+}
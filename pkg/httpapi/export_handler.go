@@ -0,0 +1,106 @@
+package httpapi
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"queue-broker/pkg/broker"
+)
+
+// importResult ответ на импорт сообщений
+type importResult struct {
+	Imported   int `json:"imported"`
+	Duplicates int `json:"duplicates"`
+}
+
+// handleQueueExport обрабатывает GET /queue/{name}/export: выгрузка всех
+// ожидающих сообщений очереди в NDJSON, по сообщению в формате PUT на строку.
+// Сообщения не извлекаются; выданные, но не подтвержденные, и отложенные
+// сообщения не выгружаются.
+func handleQueueExport(qb *broker.QueueBroker, w http.ResponseWriter, r *http.Request, queueName string) {
+	if r.Method != http.MethodGet {
+		httpError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// Очередь копируется целиком под одной блокировкой, поэтому выгрузка
+	// согласована, даже если сообщения продолжают ставить и получать
+	browsed, _, err := qb.Browse(queueName, 0, math.MaxInt)
+	if errors.Is(err, broker.ErrQueueNotFound) {
+		writeError(w, http.StatusNotFound, broker.ErrorCode(err), "Queue does not exist", nil)
+		return
+	}
+	if err != nil {
+		errorResponse(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("X-Total-Count", strconv.Itoa(len(browsed)))
+	w.WriteHeader(http.StatusOK)
+	bw := bufio.NewWriter(w)
+	encoder := json.NewEncoder(bw)
+	for _, b := range browsed {
+		msg := *b.Message
+		msg.Queue = ""
+		encoder.Encode(jsonView(&msg, false))
+	}
+	bw.Flush()
+}
+
+// handleQueueImport обрабатывает POST /queue/{name}/import: загрузка
+// сообщений из NDJSON в формате выгрузки (и PUT). Сначала разбирается весь
+// запрос, и при ошибке в любой строке ничего не ставится. Повторы уже
+// принятых сообщений (по dedup_id) пропускаются и считаются в duplicates.
+func handleQueueImport(qb *broker.QueueBroker, w http.ResponseWriter, r *http.Request, queueName string) {
+	if r.Method != http.MethodPost {
+		httpError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var messages []*broker.Message
+	scanner := bufio.NewScanner(r.Body)
+	// Размер строки ограничивает только лимит тела запроса
+	scanner.Buffer(nil, math.MaxInt)
+	for line := 1; scanner.Scan(); line++ {
+		data := scanner.Bytes()
+		if len(bytes.TrimSpace(data)) == 0 {
+			continue
+		}
+		msg := &broker.Message{}
+		if problem := parseEnvelope(qb, queueName, data, msg); problem != "" {
+			writeError(w, http.StatusBadRequest, statusCode(http.StatusBadRequest), problem, map[string]int{"line": line})
+			return
+		}
+		messages = append(messages, msg)
+	}
+	if err := scanner.Err(); err != nil {
+		bodyError(w, err)
+		return
+	}
+
+	var result importResult
+	for _, msg := range messages {
+		size := len(msg.Body)
+		err := qb.Enqueue(queueName, msg)
+		if errors.Is(err, broker.ErrDuplicate) {
+			result.Duplicates++
+			continue
+		}
+		if err != nil {
+			// Сообщения до ошибки уже поставлены: X-Imported — сколько сообщений
+			// запроса обработано, чтобы продолжить загрузку со следующего
+			w.Header().Set("X-Imported", strconv.Itoa(result.Imported+result.Duplicates))
+			enqueueError(w, err)
+			return
+		}
+		countUsage(r, true, 1, size)
+		result.Imported++
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(result)
+}
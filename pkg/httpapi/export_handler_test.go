@@ -0,0 +1,69 @@
+package httpapi
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"queue-broker/pkg/broker"
+)
+
+// TestQueueExportImport проверяет выгрузку очереди в NDJSON и загрузку обратно
+func TestQueueExportImport(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+	qb.SetDefaultDedupWindow(60)
+	handler := NewHandler(qb, nil)
+	do := requester(handler)
+
+	if rr := do(http.MethodGet, "/queue/jobs/export", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("missing queue: got %d", rr.Code)
+	}
+	qb.Enqueue("jobs", &broker.Message{Body: "first", Headers: map[string]string{"kind": "text"}, DedupID: "job-1"})
+	qb.Enqueue("jobs", &broker.Message{Body: "\x00\xff", ContentType: "application/octet-stream"})
+	qb.Enqueue("jobs", &broker.Message{Body: "third"})
+
+	rr := do(http.MethodGet, "/v1/queues/jobs/export", "")
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/x-ndjson" || rr.Header().Get("X-Total-Count") != "3" {
+		t.Fatalf("export: got %d %v", rr.Code, rr.Header())
+	}
+	exported := rr.Body.String()
+	if lines := strings.Split(strings.TrimSpace(exported), "\n"); len(lines) != 3 || !strings.Contains(lines[1], `"message_base64":"AP8="`) {
+		t.Fatalf("unexpected export:\n%s", exported)
+	}
+	// Выгрузка не извлекает сообщения
+	if depth := qb.Depth("jobs"); depth != 3 {
+		t.Errorf("depth after export: %d", depth)
+	}
+
+	rr = do(http.MethodPost, "/queue/copy/import", exported+"\n")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `{"imported":3,"duplicates":0}`) {
+		t.Fatalf("import: got %d %s", rr.Code, rr.Body)
+	}
+	if rr := do(http.MethodGet, "/queue/copy/export", ""); rr.Body.String() != exported {
+		t.Errorf("round trip mismatch:\n%s\nwant:\n%s", rr.Body, exported)
+	}
+	// Повтор загрузки отбрасывает сообщения с тем же dedup_id
+	if rr := do(http.MethodPost, "/queue/copy/import", exported); !strings.Contains(rr.Body.String(), `{"imported":2,"duplicates":1}`) {
+		t.Errorf("repeated import: got %d %s", rr.Code, rr.Body)
+	}
+
+	// Ошибка в строке отклоняет весь запрос
+	rr = do(http.MethodPost, "/queue/other/import", "{\"message\": \"ok\"}\nnot json\n")
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), `"line":2`) || qb.Depth("other") != 0 {
+		t.Errorf("invalid line: got %d %s", rr.Code, rr.Body)
+	}
+
+	// Прерванная загрузка сообщает, сколько сообщений уже поставлено
+	small := broker.NewQueueBroker(2, 10, 10)
+	var body bytes.Buffer
+	for range 3 {
+		body.WriteString(`{"message": "x"}` + "\n")
+	}
+	rr = httptest.NewRecorder()
+	NewHandler(small, nil).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/queue/jobs/import", &body))
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("X-Imported") != "2" {
+		t.Errorf("partial import: got %d %v", rr.Code, rr.Header())
+	}
+}
@@ -0,0 +1,61 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"queue-broker/pkg/broker"
+)
+
+// federationPrincipal субъект, от имени которого ставятся сообщения региона
+// origin: в очередь с владельцем регион пишет, только если ему выдано право
+// produce
+func federationPrincipal(origin string) string {
+	return "region:" + origin
+}
+
+// FederationHandler принимает сообщения, реплицированные из других регионов.
+// Запросы других брокеров проверяет peer.Require (см. NewHandler).
+func FederationHandler(qb *broker.QueueBroker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			httpError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var batch broker.FederationBatch
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil || batch.Origin == "" {
+			httpError(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+
+		for _, item := range batch.Messages {
+			if item.Message == nil || item.Queue == "" || item.DedupID == "" || item.Queue == broker.CanaryQueue {
+				continue
+			}
+			// Очередь неизвестного арендатора или без права региона не принимает сообщение
+			if tenantID := broker.TenantOf(item.Queue); tenantID != "" && !qb.HasTenant(tenantID) {
+				log.Printf("federation: message from %s to queue %s rejected: unknown tenant", batch.Origin, item.Queue)
+				continue
+			}
+			if !qb.Authorize(federationPrincipal(batch.Origin), item.Queue, broker.PermProduce) {
+				log.Printf("federation: message from %s to queue %s rejected: %v", batch.Origin, item.Queue, broker.ErrPermissionDenied)
+				continue
+			}
+			// Реплицированные сообщения не маршрутизируются и не пересылаются дальше
+			err := qb.EnqueueReplicated(item.Queue, item.Message)
+			switch {
+			case err == nil, errors.Is(err, broker.ErrDuplicate):
+			case errors.Is(err, broker.ErrQueueFull), errors.Is(err, broker.ErrNotCommitted), errors.Is(err, broker.ErrNotPersisted):
+				// Отправитель повторит пакет целиком, уже принятые сообщения отсеет дедупликация
+				errorResponse(w, err, http.StatusServiceUnavailable)
+				return
+			default:
+				log.Printf("federation: message from %s to queue %s rejected: %v", batch.Origin, item.Queue, err)
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
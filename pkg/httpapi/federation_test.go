@@ -0,0 +1,136 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"queue-broker/pkg/broker"
+	"queue-broker/pkg/peer"
+)
+
+// waitMessage ждет появления очереди и извлекает из нее сообщение
+func waitMessage(qb *broker.QueueBroker, queueName string, timeout int) (string, error) {
+	deadline := time.Now().Add(time.Duration(timeout) * time.Second)
+	for {
+		message, err := qb.GetMessage(queueName, time.Duration(timeout)*time.Second)
+		if !errors.Is(err, broker.ErrQueueNotFound) || time.Now().After(deadline) {
+			return message, err
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestFederationActiveActive проверяет обмен сообщениями между регионами с дедупликацией
+func TestFederationActiveActive(t *testing.T) {
+	east := broker.NewQueueBroker(100, 10, 10)
+	west := broker.NewQueueBroker(100, 10, 10)
+	eastServer := httptest.NewServer(NewHandler(east, nil, WithPeerSecret("s3cret")))
+	defer eastServer.Close()
+	westServer := httptest.NewServer(NewHandler(west, nil, WithPeerSecret("s3cret")))
+	defer westServer.Close()
+
+	eastFederation := broker.NewFederation("east", []string{westServer.URL}, time.Minute)
+	eastFederation.SetPeerSecret("s3cret")
+	defer eastFederation.Close()
+	westFederation := broker.NewFederation("west", []string{eastServer.URL}, time.Minute)
+	westFederation.SetPeerSecret("s3cret")
+	defer westFederation.Close()
+	east.SetFederation(eastFederation)
+	west.SetFederation(westFederation)
+
+	if err := east.Enqueue("jobs", &broker.Message{Body: "job 1", DedupID: "p-1"}); err != nil {
+		t.Fatal(err)
+	}
+	message, err := waitMessage(west, "jobs", 2)
+	if err != nil || message != "job 1" {
+		t.Fatalf("message was not replicated to the peer: %q %v", message, err)
+	}
+
+	// Повтор продюсера в другом регионе распознается как дубликат
+	if err := west.Enqueue("jobs", &broker.Message{Body: "job 1", DedupID: "p-1"}); !errors.Is(err, broker.ErrDuplicate) {
+		t.Errorf("retry in the peer region was not deduplicated: %v", err)
+	}
+
+	// Реплицированное сообщение не возвращается обратно в исходный регион
+	if err := west.Enqueue("jobs", &broker.Message{Body: "job 2"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"job 1", "job 2"} {
+		message, err := east.GetMessage("jobs", 2*time.Second)
+		if err != nil || message != want {
+			t.Fatalf("east: got %q (%v) want %q", message, err, want)
+		}
+	}
+	if message, err := east.GetMessage("jobs", time.Second); err == nil {
+		t.Errorf("message bounced back to its origin: %q", message)
+	}
+}
+
+// TestFederationBinaryBody проверяет, что тело, не являющееся корректным
+// UTF-8, доходит до другого региона без искажений
+func TestFederationBinaryBody(t *testing.T) {
+	west := broker.NewQueueBroker(100, 10, 10)
+	westServer := httptest.NewServer(NewHandler(west, nil, WithPeerSecret("s3cret")))
+	defer westServer.Close()
+	east := broker.NewQueueBroker(100, 10, 10)
+	federation := broker.NewFederation("east", []string{westServer.URL}, time.Minute)
+	federation.SetPeerSecret("s3cret")
+	defer federation.Close()
+	east.SetFederation(federation)
+
+	body := "\xff\x00\xfe\x80"
+	if err := east.Enqueue("jobs", &broker.Message{Body: body, DedupID: "p-1"}); err != nil {
+		t.Fatal(err)
+	}
+	message, err := waitMessage(west, "jobs", 2)
+	if err != nil || message != body {
+		t.Fatalf("binary body was not replicated intact: %q %v", message, err)
+	}
+}
+
+// TestFederationRejectsUnauthorized проверяет, что сообщения принимаются
+// только от брокеров с общим секретом и только в очереди, куда региону
+// разрешено писать
+func TestFederationRejectsUnauthorized(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+	if err := qb.SetQueueACL("alice", "payments", broker.QueueACL{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := qb.SetQueueACL("alice", "audit", broker.QueueACL{Produce: []string{"region:east"}}); err != nil {
+		t.Fatal(err)
+	}
+	handler := NewHandler(qb, nil, WithPeerSecret("s3cret"))
+	post := func(signed bool, queues ...string) int {
+		var batch broker.FederationBatch
+		batch.Origin = "east"
+		for i, queueName := range queues {
+			batch.Messages = append(batch.Messages, broker.FederatedMessage{Queue: queueName, Message: &broker.Message{Body: "x", DedupID: fmt.Sprint("m-", i)}})
+		}
+		body, _ := json.Marshal(batch)
+		req := httptest.NewRequest("POST", "/federation/messages", bytes.NewReader(body))
+		if signed {
+			peer.Sign(req, "s3cret")
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := post(false, "jobs"); code != http.StatusUnauthorized || qb.Depth("jobs") != 0 {
+		t.Errorf("expected 401 without the peer secret, got %d (depth %d)", code, qb.Depth("jobs"))
+	}
+	if code := post(true, "jobs", "payments", "audit", "@ghost.jobs", broker.CanaryQueue); code != http.StatusOK {
+		t.Fatalf("signed batch: %d", code)
+	}
+	for queueName, want := range map[string]int{"jobs": 1, "payments": 0, "audit": 1, "@ghost.jobs": 0, broker.CanaryQueue: 0} {
+		if depth := qb.Depth(queueName); depth != want {
+			t.Errorf("%s: expected depth %d, got %d", queueName, want, depth)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"queue-broker/pkg/broker"
+)
+
+// HealthHandler обрабатывает GET /healthz: общее состояние и состояние
+// подсистем брокера. Если какая-либо подсистема не в порядке, состояние —
+// degraded, но брокер продолжает отвечать 200. Если канарейка включена и
+// последняя проверка не прошла, возвращается 503.
+func HealthHandler(qb *broker.QueueBroker, canary *Canary) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		subsystems := qb.Health()
+		status := map[string]any{"status": "ok", "subsystems": subsystems}
+		code := http.StatusOK
+		for _, h := range subsystems {
+			if h.Status != broker.HealthOK {
+				status["status"] = broker.HealthDegraded
+			}
+		}
+		if canary != nil {
+			status["canary"] = canary.Result()
+			if !canary.Healthy() {
+				status["status"] = "unhealthy"
+				code = http.StatusServiceUnavailable
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(status)
+	}
+}
+
+// MetricsHandler отдает метрики в текстовом формате Prometheus
+func MetricsHandler(qb *broker.QueueBroker, canary *Canary) http.HandlerFunc {
+	return metricsHandler(qb, canary, handlerOptions{})
+}
+
+func metricsHandler(qb *broker.QueueBroker, canary *Canary, o handlerOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+		fmt.Fprintln(w, "# TYPE queue_broker_queue_depth gauge")
+		for _, name := range qb.QueueNames() {
+			fmt.Fprintf(w, "queue_broker_queue_depth{queue=%q} %d\n", name, qb.Depth(name))
+		}
+		fmt.Fprintln(w, "# TYPE queue_broker_queue_bytes gauge")
+		for _, name := range qb.QueueNames() {
+			fmt.Fprintf(w, "queue_broker_queue_bytes{queue=%q} %d\n", name, qb.QueueBytes(name))
+		}
+		fmt.Fprintln(w, "# TYPE queue_broker_oldest_message_age_seconds gauge")
+		for _, name := range qb.QueueNames() {
+			fmt.Fprintf(w, "queue_broker_oldest_message_age_seconds{queue=%q} %g\n", name, qb.OldestAge(name).Seconds())
+		}
+		fmt.Fprintln(w, "# TYPE queue_broker_total_bytes gauge")
+		fmt.Fprintf(w, "queue_broker_total_bytes %d\n", qb.TotalBytes())
+		standby := 0
+		if qb.Standby() {
+			standby = 1
+		}
+		fmt.Fprintln(w, "# TYPE queue_broker_standby gauge")
+		fmt.Fprintf(w, "queue_broker_standby %d\n", standby)
+		fmt.Fprintln(w, "# TYPE queue_broker_replication_followers gauge")
+		fmt.Fprintf(w, "queue_broker_replication_followers %d\n", qb.Followers())
+		if tenants := qb.Tenants(); len(tenants) > 0 {
+			usage := make(map[string]broker.TenantUsage, len(tenants))
+			for _, id := range tenants {
+				usage[id] = qb.TenantUsage(id)
+			}
+			fmt.Fprintln(w, "# TYPE queue_broker_tenant_queues gauge")
+			for _, id := range tenants {
+				fmt.Fprintf(w, "queue_broker_tenant_queues{tenant=%q} %d\n", id, usage[id].Queues)
+			}
+			fmt.Fprintln(w, "# TYPE queue_broker_tenant_messages gauge")
+			for _, id := range tenants {
+				fmt.Fprintf(w, "queue_broker_tenant_messages{tenant=%q} %d\n", id, usage[id].Messages)
+			}
+			fmt.Fprintln(w, "# TYPE queue_broker_tenant_bytes gauge")
+			for _, id := range tenants {
+				fmt.Fprintf(w, "queue_broker_tenant_bytes{tenant=%q} %d\n", id, usage[id].Bytes)
+			}
+		}
+		if o.shedder != nil {
+			o.shedder.writeMetrics(w)
+		}
+		if o.limiter != nil {
+			o.limiter.writeMetrics(w)
+		}
+		if o.inflight != nil {
+			o.inflight.writeMetrics(w)
+		}
+
+		if canary == nil {
+			return
+		}
+		last, runs, failures := canary.Stats()
+
+		ok := 0
+		if last.OK {
+			ok = 1
+		}
+		fmt.Fprintln(w, "# TYPE queue_broker_canary_success gauge")
+		fmt.Fprintf(w, "queue_broker_canary_success %d\n", ok)
+		fmt.Fprintln(w, "# TYPE queue_broker_canary_latency_seconds gauge")
+		fmt.Fprintf(w, "queue_broker_canary_latency_seconds %g\n", last.Latency.Seconds())
+		fmt.Fprintln(w, "# TYPE queue_broker_canary_runs_total counter")
+		fmt.Fprintf(w, "queue_broker_canary_runs_total %d\n", runs)
+		fmt.Fprintln(w, "# TYPE queue_broker_canary_failures_total counter")
+		fmt.Fprintf(w, "queue_broker_canary_failures_total %d\n", failures)
+	}
+}
@@ -0,0 +1,42 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"queue-broker/pkg/broker"
+)
+
+// TestHealthSubsystems проверяет состояние подсистем в /healthz
+func TestHealthSubsystems(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 1)
+	handler := NewHandler(qb, nil)
+
+	var response struct {
+		Status     string                            `json:"status"`
+		Subsystems map[string]broker.SubsystemHealth `json:"subsystems"`
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/healthz", nil))
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("unexpected healthz response: %d %v", rr.Code, err)
+	}
+	if response.Status != "ok" || response.Subsystems["storage"].Status != broker.HealthOK {
+		t.Errorf("unexpected health: %+v", response)
+	}
+
+	// Деградировавшая подсистема не делает брокер недоступным
+	qb.RegisterHealthCheck("webhooks", func() broker.SubsystemHealth {
+		return broker.SubsystemHealth{Status: broker.HealthDegraded, LastError: "connection refused"}
+	})
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/healthz", nil))
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("unexpected healthz response: %d %v", rr.Code, err)
+	}
+	if response.Status != broker.HealthDegraded || response.Subsystems["webhooks"].LastError != "connection refused" {
+		t.Errorf("unexpected degraded health: %+v", response)
+	}
+}
@@ -0,0 +1,50 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"queue-broker/pkg/broker"
+)
+
+// KeySource загружает набор ключей шифрования при хранении (из файла, KMS и т.п.)
+type KeySource func() (*broker.Keyring, error)
+
+// keysHandler обрабатывает GET /admin/keys (состояние шифрования) и
+// POST /admin/keys/rotate: набор ключей перечитывается из source, новые
+// сообщения шифруются его текущим ключом, а хранимые перешифровываются в фоне;
+// source nil — ключи не настроены
+func keysHandler(qb *broker.QueueBroker, source KeySource) http.Handler {
+	rt := newRouter()
+	rt.handleFunc("/admin/keys", func(w http.ResponseWriter, r *http.Request) {
+		writeKeyStatus(w, qb.KeyStatus())
+	}, http.MethodGet)
+	rt.handleFunc("/admin/keys/rotate", func(w http.ResponseWriter, r *http.Request) {
+		if source == nil {
+			httpError(w, "Encryption keys are not configured", http.StatusNotImplemented)
+			return
+		}
+		kr, err := source()
+		if err != nil {
+			errorResponse(w, err, http.StatusInternalServerError)
+			return
+		}
+		if err := qb.SetKeyring(kr); errors.Is(err, broker.ErrKeyInUse) {
+			errorResponse(w, err, http.StatusConflict)
+			return
+		} else if err != nil {
+			errorResponse(w, err, http.StatusBadRequest)
+			return
+		}
+		go qb.Reencrypt()
+		writeKeyStatus(w, qb.KeyStatus())
+	}, http.MethodPost)
+	return rt
+}
+
+func writeKeyStatus(w http.ResponseWriter, status broker.KeyStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,63 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"queue-broker/pkg/broker"
+)
+
+// TestKeysHandler проверяет смену набора ключей и фоновое перешифрование
+func TestKeysHandler(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+	rr := httptest.NewRecorder()
+	NewHandler(qb, nil).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/admin/keys/rotate", nil))
+	if rr.Code != http.StatusNotImplemented {
+		t.Errorf("rotation without key source should get 501, got %d", rr.Code)
+	}
+
+	keyring := &broker.Keyring{Current: "k1", Keys: map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}}
+	handler := NewHandler(qb, nil, WithKeySource(func() (*broker.Keyring, error) { return keyring, nil }))
+	do := func(method, target string) (int, broker.KeyStatus) {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(method, target, nil))
+		var status broker.KeyStatus
+		json.NewDecoder(rr.Body).Decode(&status)
+		return rr.Code, status
+	}
+
+	if code, status := do(http.MethodPost, "/admin/keys/rotate"); code != http.StatusOK || status.Current != "k1" {
+		t.Fatalf("unexpected rotation: %d %+v", code, status)
+	}
+	qb.PutMessage("payments", "secret")
+
+	keyring = &broker.Keyring{Current: "k2", Keys: map[string][]byte{"k2": bytes.Repeat([]byte{2}, 32)}}
+	if code, _ := do(http.MethodPost, "/admin/keys/rotate"); code != http.StatusConflict {
+		t.Errorf("dropping a used key should get 409, got %d", code)
+	}
+	keyring.Keys["k1"] = bytes.Repeat([]byte{1}, 32)
+	if code, status := do(http.MethodPost, "/admin/keys/rotate"); code != http.StatusOK || status.Current != "k2" {
+		t.Fatalf("unexpected rotation: %d %+v", code, status)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		_, status := do(http.MethodGet, "/admin/keys")
+		if status.Messages["k2"] == 1 && !status.Reencrypting {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("message was not reencrypted: %+v", status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if code, _ := do(http.MethodDelete, "/admin/keys"); code != http.StatusMethodNotAllowed {
+		t.Errorf("DELETE should get 405, got %d", code)
+	}
+	if message, err := qb.GetMessage("payments", 0); err != nil || message != "secret" {
+		t.Errorf("got %q (%v)", message, err)
+	}
+}
@@ -0,0 +1,84 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// systemdFirstFD первый дескриптор сокетов, переданных systemd (SD_LISTEN_FDS_START)
+const systemdFirstFD = 3
+
+// Listen открывает слушающий сокет по адресу addr:
+//   - host:port или tcp://host:port — TCP;
+//   - unix:///path/to.sock — сокет Unix; файл-сокет, оставшийся от
+//     завершившегося процесса, удаляется, а занятый другим процессом — нет;
+//   - systemd или systemd:имя — сокет, переданный systemd при активации по
+//     сокету (первый или с именем FileDescriptorName= из unit-файла .socket).
+func Listen(addr string) (net.Listener, error) {
+	switch {
+	case strings.HasPrefix(addr, "unix://"):
+		return listenUnix(strings.TrimPrefix(addr, "unix://"))
+	case addr == "systemd" || strings.HasPrefix(addr, "systemd:"):
+		return systemdListener(strings.TrimPrefix(strings.TrimPrefix(addr, "systemd"), ":"))
+	}
+	return net.Listen("tcp", strings.TrimPrefix(addr, "tcp://"))
+}
+
+func listenUnix(path string) (net.Listener, error) {
+	if path == "" {
+		return nil, errors.New("empty unix socket path")
+	}
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		conn, err := net.DialTimeout("unix", path, time.Second)
+		if err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s: socket is in use", path)
+		}
+		os.Remove(path)
+	}
+	return net.Listen("unix", path)
+}
+
+// systemdListener возвращает сокет, переданный systemd через LISTEN_FDS;
+// name пусто — первый из переданных
+func systemdListener(name string) (net.Listener, error) {
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return nil, errors.New("no sockets passed by systemd")
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return nil, errors.New("no sockets passed by systemd")
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	for i := range count {
+		if name != "" && (i >= len(names) || names[i] != name) {
+			continue
+		}
+		f := os.NewFile(uintptr(systemdFirstFD+i), "systemd:"+name)
+		// FileListener дублирует дескриптор, исходный больше не нужен
+		defer f.Close()
+		return net.FileListener(f)
+	}
+	return nil, fmt.Errorf("no socket named %q passed by systemd", name)
+}
+
+// unixClient HTTP-клиент, соединяющийся с сокетом Unix path независимо от
+// адреса в URL запроса
+func unixClient(path string, timeout time.Duration) *http.Client {
+	var dialer net.Dialer
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, "unix", path)
+			},
+		},
+	}
+}
@@ -0,0 +1,112 @@
+package httpapi
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"queue-broker/pkg/broker"
+)
+
+// TestListenUnix проверяет HTTP API на сокете Unix и удаление брошенного сокета
+func TestListenUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "qb.sock")
+	// Файл-сокет, оставшийся от завершившегося процесса
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	ln, err := Listen("unix://" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qb := broker.NewQueueBroker(100, 10, 10)
+	server := &http.Server{Handler: NewHandler(qb, nil)}
+	go server.Serve(ln)
+	defer server.Close()
+
+	// Занятый сокет не удаляется
+	if _, err := Listen("unix://" + path); err == nil {
+		t.Error("expected socket in use error")
+	}
+
+	canary := NewCanary("unix://"+path, time.Minute)
+	if result := canary.Run(); !result.OK {
+		t.Fatalf("canary over unix socket failed: %s", result.Error)
+	}
+}
+
+// TestListenSystemd проверяет получение сокета, переданного systemd. Сокет
+// передается дочернему процессу теста третьим дескриптором, как это делает systemd.
+func TestListenSystemd(t *testing.T) {
+	if name := os.Getenv("QB_SYSTEMD_CHILD"); name != "" {
+		ln, err := Listen("systemd:" + name)
+		if err != nil {
+			os.Exit(2)
+		}
+		conn, err := ln.Accept()
+		if err != nil {
+			os.Exit(3)
+		}
+		conn.Write([]byte("ok"))
+		conn.Close()
+		os.Exit(0)
+	}
+
+	if _, err := Listen("systemd"); err == nil {
+		t.Error("expected error without LISTEN_FDS")
+	}
+
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcp.Close()
+	f, err := tcp.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestListenSystemd$")
+	cmd.ExtraFiles = []*os.File{f}
+	// Сокеты, переданные другому процессу (LISTEN_PID не совпадает), не берутся
+	cmd.Env = append(os.Environ(), "QB_SYSTEMD_CHILD=api", "LISTEN_FDS=1", "LISTEN_FDNAMES=api", "LISTEN_PID="+strconv.Itoa(os.Getpid()))
+	if err := cmd.Run(); err == nil {
+		t.Error("socket for another process should be rejected")
+	}
+
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not available")
+	}
+	// LISTEN_PID должен быть PID самого процесса: его задает оболочка перед exec
+	cmd = exec.Command(sh, "-c", `LISTEN_PID=$$ exec "$0" -test.run='^TestListenSystemd$'`, os.Args[0])
+	cmd.ExtraFiles = []*os.File{f}
+	cmd.Env = append(os.Environ(), "QB_SYSTEMD_CHILD=api", "LISTEN_FDS=1", "LISTEN_FDNAMES=api")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.DialTimeout("tcp", tcp.Addr().String(), 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	reply := make([]byte, 2)
+	_, readErr := conn.Read(reply)
+	conn.Close()
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("child failed: %v", err)
+	}
+	if readErr != nil || string(reply) != "ok" {
+		t.Errorf("unexpected reply %q: %v", reply, readErr)
+	}
+}
@@ -0,0 +1,178 @@
+package httpapi
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// shedReleaseRatio доля порога, ниже которой нагрузка должна опуститься,
+	// чтобы сброс прекратился (гистерезис)
+	shedReleaseRatio = 0.8
+	// shedRetryAfter значение Retry-After для отклоненных запросов в секундах
+	shedRetryAfter = 5
+)
+
+// ShedThresholds пороги давления на ресурсы процесса; нулевой порог не проверяется
+type ShedThresholds struct {
+	// HeapBytes объем занятой кучи
+	HeapBytes uint64
+	// GCPause максимальная пауза GC с прошлой проверки
+	GCPause time.Duration
+	// Goroutines число горутин
+	Goroutines int
+}
+
+// pressure замер ресурсов процесса
+type pressure struct {
+	heapBytes  uint64
+	gcPause    time.Duration
+	goroutines int
+}
+
+// LoadShedder следит за памятью, паузами GC и числом горутин и при превышении
+// порогов отклоняет постановку сообщений с низким приоритетом (X-Priority: low),
+// пока давление не опустится ниже 80% порогов
+type LoadShedder struct {
+	thresholds ShedThresholds
+	interval   time.Duration
+	sample     func() pressure
+
+	shedding atomic.Bool
+	rejected atomic.Int64
+
+	mu     sync.Mutex
+	last   pressure
+	numGC  uint32
+	stop   chan struct{}
+	closed bool
+}
+
+// NewLoadShedder создает монитор, выполняющий замер раз в interval
+func NewLoadShedder(thresholds ShedThresholds, interval time.Duration) *LoadShedder {
+	s := &LoadShedder{
+		thresholds: thresholds,
+		interval:   interval,
+		stop:       make(chan struct{}),
+	}
+	s.sample = s.readRuntime
+	return s
+}
+
+// Start запускает периодические замеры
+func (s *LoadShedder) Start() {
+	s.check()
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.check()
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop останавливает замеры
+func (s *LoadShedder) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.stop)
+	}
+}
+
+// Shedding сообщает, отклоняются ли сейчас запросы с низким приоритетом
+func (s *LoadShedder) Shedding() bool {
+	return s.shedding.Load()
+}
+
+// check выполняет замер и переключает режим сброса
+func (s *LoadShedder) check() {
+	p := s.sample()
+	s.mu.Lock()
+	s.last = p
+	s.mu.Unlock()
+
+	ratio := 0.0
+	if s.thresholds.HeapBytes > 0 {
+		ratio = max(ratio, float64(p.heapBytes)/float64(s.thresholds.HeapBytes))
+	}
+	if s.thresholds.GCPause > 0 {
+		ratio = max(ratio, float64(p.gcPause)/float64(s.thresholds.GCPause))
+	}
+	if s.thresholds.Goroutines > 0 {
+		ratio = max(ratio, float64(p.goroutines)/float64(s.thresholds.Goroutines))
+	}
+
+	switch {
+	case ratio >= 1:
+		s.shedding.Store(true)
+	case ratio < shedReleaseRatio:
+		s.shedding.Store(false)
+	}
+}
+
+// readRuntime снимает показатели среды выполнения
+func (s *LoadShedder) readRuntime() pressure {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Максимальная пауза среди сборок, прошедших с прошлого замера (буфер на 256 сборок)
+	var pause time.Duration
+	for n := max(s.numGC, stats.NumGC-min(stats.NumGC, 256)); n < stats.NumGC; n++ {
+		pause = max(pause, time.Duration(stats.PauseNs[n%256]))
+	}
+	s.numGC = stats.NumGC
+	return pressure{heapBytes: stats.HeapAlloc, gcPause: pause, goroutines: runtime.NumGoroutine()}
+}
+
+// middleware отклоняет PUT с X-Priority: low во время сброса нагрузки
+func (s *LoadShedder) middleware(next http.Handler) http.Handler {
+	if s == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut && r.Header.Get("X-Priority") == "low" && s.Shedding() {
+			s.rejected.Add(1)
+			w.Header().Set("Retry-After", strconv.Itoa(shedRetryAfter))
+			httpError(w, "Service overloaded", http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeMetrics дописывает метрики сброса нагрузки в формате Prometheus
+func (s *LoadShedder) writeMetrics(w io.Writer) {
+	s.mu.Lock()
+	last := s.last
+	s.mu.Unlock()
+	shedding := 0
+	if s.Shedding() {
+		shedding = 1
+	}
+
+	fmt.Fprintln(w, "# TYPE queue_broker_load_shedding gauge")
+	fmt.Fprintf(w, "queue_broker_load_shedding %d\n", shedding)
+	fmt.Fprintln(w, "# TYPE queue_broker_shed_requests_total counter")
+	fmt.Fprintf(w, "queue_broker_shed_requests_total %d\n", s.rejected.Load())
+	fmt.Fprintln(w, "# TYPE queue_broker_heap_bytes gauge")
+	fmt.Fprintf(w, "queue_broker_heap_bytes %d\n", last.heapBytes)
+	fmt.Fprintln(w, "# TYPE queue_broker_gc_pause_seconds gauge")
+	fmt.Fprintf(w, "queue_broker_gc_pause_seconds %g\n", last.gcPause.Seconds())
+	fmt.Fprintln(w, "# TYPE queue_broker_goroutines gauge")
+	fmt.Fprintf(w, "queue_broker_goroutines %d\n", last.goroutines)
+}
@@ -0,0 +1,75 @@
+package httpapi
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"queue-broker/pkg/broker"
+)
+
+// TestLoadShedding проверяет отклонение запросов с низким приоритетом
+// при превышении порога и гистерезис при выходе из режима сброса
+func TestLoadShedding(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+	shedder := NewLoadShedder(ShedThresholds{Goroutines: 100}, time.Hour)
+	goroutines := 0
+	shedder.sample = func() pressure { return pressure{goroutines: goroutines} }
+	handler := NewHandler(qb, nil, WithLoadShedder(shedder))
+
+	put := func(priority string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PUT", "/queue/jobs", bytes.NewBufferString(`{"message": "job"}`))
+		if priority != "" {
+			req.Header.Set("X-Priority", priority)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	goroutines = 50
+	shedder.check()
+	if rr := put("low"); rr.Code != http.StatusOK {
+		t.Fatalf("expected low priority enqueue to pass without pressure, got %d", rr.Code)
+	}
+
+	goroutines = 120
+	shedder.check()
+	rr := put("low")
+	if rr.Code != http.StatusServiceUnavailable || rr.Header().Get("Retry-After") == "" {
+		t.Errorf("expected 503 with Retry-After under pressure, got %d", rr.Code)
+	}
+	if rr := put(""); rr.Code != http.StatusOK {
+		t.Errorf("normal priority must not be shed, got %d", rr.Code)
+	}
+
+	// Между 80% и 100% порога режим сохраняется
+	goroutines = 90
+	shedder.check()
+	if !shedder.Shedding() {
+		t.Error("shedding stopped before pressure dropped below the release ratio")
+	}
+	goroutines = 70
+	shedder.check()
+	if shedder.Shedding() {
+		t.Error("shedding did not stop after pressure dropped")
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	for _, want := range []string{"queue_broker_shed_requests_total 1", "queue_broker_load_shedding 0", "queue_broker_goroutines 70"} {
+		if !strings.Contains(rr.Body.String(), want) {
+			t.Errorf("metrics do not contain %q:\n%s", want, rr.Body)
+		}
+	}
+}
+
+func TestLoadShedderReadsRuntime(t *testing.T) {
+	shedder := NewLoadShedder(ShedThresholds{HeapBytes: 1 << 40}, time.Hour)
+	if p := shedder.sample(); p.heapBytes == 0 || p.goroutines == 0 {
+		t.Errorf("unexpected runtime sample %+v", p)
+	}
+}
@@ -0,0 +1,94 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"queue-broker/pkg/broker"
+)
+
+// logMode режим GET, в котором сообщение читается из журнала очереди с
+// хранением (mode=log или параметры from_offset, from_time, since и group)
+const logMode = "log"
+
+// logPosition номер записи журнала, с которой читать: from_offset, from_time
+// (RFC 3339), зафиксированное смещение группы group или, без них, первая
+// запись не раньше since (если since не задан, самая старая из хранимых).
+// Для группы без зафиксированного смещения since задает, с какой записи она
+// начнет чтение.
+func logPosition(qb *broker.QueueBroker, queueName string, query url.Values) (uint64, error) {
+	if value := query.Get("from_offset"); value != "" {
+		return strconv.ParseUint(value, 10, 64)
+	}
+	if value := query.Get("from_time"); value != "" {
+		at, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return 0, err
+		}
+		return qb.LogOffsetAt(queueName, at)
+	}
+	var since time.Time
+	if value := query.Get("since"); value != "" {
+		var err error
+		if since, err = parseSince(value, time.Now()); err != nil {
+			return 0, err
+		}
+	}
+	group := query.Get("group")
+	switch {
+	case group != "" && since.IsZero():
+		return qb.CommittedOffset(queueName, group)
+	case group != "":
+		return qb.GroupOffset(queueName, group, since)
+	case since.IsZero():
+		return 0, nil
+	}
+	return qb.LogOffsetAt(queueName, since)
+}
+
+// parseSince разбирает параметр since: время в RFC 3339, now — только новые
+// сообщения, или длительность Go — сообщения не старше ее (since=1h)
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if value == "now" {
+		return now, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	return time.Parse(time.RFC3339Nano, value)
+}
+
+// handleLogRead обрабатывает GET /queue/{name}?from_offset=&from_time=&since=&group=:
+// чтение журнала очереди без извлечения сообщения. Номер выданной записи
+// передается в заголовке X-Offset, следующий запрос читает с X-Offset + 1.
+// Чтение с group не сдвигает смещение группы: после обработки записи
+// потребитель фиксирует X-Offset + 1 через POST /queue/{name}/offsets.
+func handleLogRead(qb *broker.QueueBroker, w http.ResponseWriter, r *http.Request, queueName string, query url.Values, timeout time.Duration, forceBase64 bool) {
+	if query.Get("correlation_id") != "" || query.Get("selector") != "" {
+		httpError(w, "Selective receive is not supported in log mode", http.StatusBadRequest)
+		return
+	}
+	offset, err := logPosition(qb, queueName, query)
+	if err != nil && broker.ErrorCode(err) == "" {
+		httpError(w, "Invalid offset", http.StatusBadRequest)
+		return
+	}
+	var record *broker.LogRecord
+	if err == nil {
+		record, err = qb.ReadLog(queueName, offset, timeout)
+	}
+	if errors.Is(err, broker.ErrNoRetention) || errors.Is(err, broker.ErrInvalidGroup) {
+		errorResponse(w, err, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		dequeueError(w, r, err)
+		return
+	}
+	w.Header().Set("X-Offset", strconv.FormatUint(record.Offset, 10))
+	w.Header().Set("X-Enqueued-At", record.EnqueuedAt.Format(time.RFC3339Nano))
+	writeMessage(w, r, record.Message, forceBase64)
+}
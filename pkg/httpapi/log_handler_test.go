@@ -0,0 +1,100 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"queue-broker/pkg/broker"
+)
+
+// TestLogRead проверяет чтение журнала очереди через GET ?from_offset= и /v1/queues/{name}/log
+func TestLogRead(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 1)
+	handler := NewHandler(qb, nil)
+	do := requester(handler)
+
+	qb.PutMessage("plain", "x")
+	if rr := do(http.MethodGet, "/queue/plain?from_offset=0", ""); rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "NO_RETENTION") {
+		t.Errorf("queue without retention: got %d %s", rr.Code, rr.Body)
+	}
+	if rr := do(http.MethodPut, "/queue/events/config", `{"retention": 3600}`); rr.Code != http.StatusOK {
+		t.Fatalf("config: got %d %s", rr.Code, rr.Body)
+	}
+	if rr := do(http.MethodPut, "/queue/events/config", `{"retention": -1}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("negative retention: got %d", rr.Code)
+	}
+	start := time.Now()
+	for _, body := range []string{"first", "second"} {
+		do(http.MethodPut, "/queue/events", `{"message": "`+body+`"}`)
+	}
+	// Выданное сообщение остается в журнале
+	if rr := do(http.MethodGet, "/queue/events?timeout=0", ""); !strings.Contains(rr.Body.String(), "first") {
+		t.Fatalf("get: got %d %s", rr.Code, rr.Body)
+	}
+
+	cases := []struct{ target, offset, body string }{
+		{"/queue/events?from_offset=0", "0", "first"},
+		{"/queue/events?mode=log", "0", "first"},
+		{"/v1/queues/events/log?from_offset=1", "1", "second"},
+		{"/queue/events?from_time=" + url.QueryEscape(start.Add(-time.Minute).Format(time.RFC3339Nano)), "0", "first"},
+	}
+	for _, tc := range cases {
+		rr := do(http.MethodGet, tc.target, "")
+		if rr.Code != http.StatusOK || rr.Header().Get("X-Offset") != tc.offset || !strings.Contains(rr.Body.String(), tc.body) || rr.Header().Get("X-Enqueued-At") == "" {
+			t.Errorf("%s: got %d %v %s", tc.target, rr.Code, rr.Header(), rr.Body)
+		}
+	}
+	if depth := qb.Depth("events"); depth != 1 {
+		t.Errorf("log read consumed messages: depth %d", depth)
+	}
+
+	if rr := do(http.MethodGet, "/queue/events?from_offset=2&timeout=0", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("no new record: got %d", rr.Code)
+	}
+	for _, target := range []string{"/queue/events?from_offset=-1", "/queue/events?from_time=yesterday", "/queue/events?from_offset=0&selector=a%3D1"} {
+		if rr := do(http.MethodGet, target, ""); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d", target, rr.Code)
+		}
+	}
+}
+
+// TestLogSince проверяет чтение журнала с since: пропуск накопленных
+// сообщений новым потребителем и повтор с момента времени
+func TestLogSince(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 1)
+	qb.SetQueueConfig("events", broker.QueueConfig{LockDuration: 30, Retention: 3600})
+	handler := NewHandler(qb, nil)
+	get := func(target string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		return rr
+	}
+	qb.PutMessage("events", "backlog")
+
+	// since=now: новая группа пропускает накопленное и ждет свежих сообщений
+	if rr := get("/queue/events?group=fresh&since=now&timeout=0"); rr.Code != http.StatusNotFound {
+		t.Errorf("fresh group: got %d %s", rr.Code, rr.Body)
+	}
+	qb.PutMessage("events", "fresh")
+	if rr := get("/queue/events?group=fresh&since=now"); rr.Header().Get("X-Offset") != "1" || !strings.Contains(rr.Body.String(), "fresh") {
+		t.Errorf("fresh group: got %d %v %s", rr.Code, rr.Header(), rr.Body)
+	}
+
+	cases := []struct{ target, offset string }{
+		{"/queue/events?since=1h", "0"},
+		{"/queue/events?since=" + url.QueryEscape(time.Now().Add(-time.Minute).Format(time.RFC3339Nano)), "0"},
+		{"/v1/queues/events/log?since=0s&timeout=0", ""},
+	}
+	for _, tc := range cases {
+		if rr := get(tc.target); rr.Header().Get("X-Offset") != tc.offset {
+			t.Errorf("%s: got %d %v", tc.target, rr.Code, rr.Header())
+		}
+	}
+	if rr := get("/queue/events?since=later"); rr.Code != http.StatusBadRequest {
+		t.Errorf("invalid since: got %d", rr.Code)
+	}
+}
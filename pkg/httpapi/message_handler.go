@@ -0,0 +1,57 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"queue-broker/pkg/broker"
+)
+
+// handleQueueMessage обрабатывает DELETE /queue/{name}/messages/{id} и
+// POST /queue/{name}/messages/{id}/requeue[?to=<очередь>]: удаление сообщения
+// и его возврат для немедленной выдачи в ту же или другую очередь
+func handleQueueMessage(qb *broker.QueueBroker, w http.ResponseWriter, r *http.Request, queueName, idParam, action string) {
+	id, err := strconv.ParseUint(idParam, 10, 64)
+	if err != nil {
+		httpError(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodDelete:
+		err = qb.DeleteMessage(queueName, id)
+	case action == "requeue" && r.Method == http.MethodPost:
+		target := r.URL.Query().Get("to")
+		if target != "" {
+			if tenantID, ok := r.Context().Value(tenantKey{}).(string); ok {
+				if target, err = broker.TenantQueueName(tenantID, target); err != nil {
+					httpError(w, "Invalid queue name", http.StatusBadRequest)
+					return
+				}
+			}
+			if !authorize(qb, r, target, broker.PermProduce) {
+				httpError(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+		}
+		err = qb.RequeueMessage(queueName, id, target)
+	default:
+		httpError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusOK)
+	case errors.Is(err, broker.ErrMessageNotFound):
+		errorResponse(w, err, http.StatusNotFound)
+	case errors.Is(err, broker.ErrStandby), errors.Is(err, broker.ErrNotPersisted):
+		errorResponse(w, err, http.StatusServiceUnavailable)
+	case errors.Is(err, broker.ErrQueueArchiving):
+		errorResponse(w, err, http.StatusConflict)
+	case schemaError(w, err):
+	default:
+		errorResponse(w, err, http.StatusBadRequest)
+	}
+}
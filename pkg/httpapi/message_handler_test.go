@@ -0,0 +1,49 @@
+package httpapi
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"queue-broker/pkg/broker"
+)
+
+// TestQueueMessageHandler проверяет удаление и возврат сообщения по идентификатору
+func TestQueueMessageHandler(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 1)
+	handler := NewHandler(qb, nil)
+	do := func(method, target string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(method, target, bytes.NewBuffer(nil)))
+		return rr
+	}
+	qb.Enqueue("jobs", &broker.Message{Body: "poison"})
+	qb.Enqueue("jobs.dlq", &broker.Message{Body: "dead"})
+	jobs, _, _ := qb.Browse("jobs", 0, 1)
+	dlq, _, _ := qb.Browse("jobs.dlq", 0, 1)
+
+	if rr := do("GET", fmt.Sprintf("/queue/jobs/messages/%d", jobs[0].ID)); rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 for GET, got %d", rr.Code)
+	}
+	if rr := do("DELETE", fmt.Sprintf("/queue/jobs/messages/%d", jobs[0].ID)); rr.Code != http.StatusOK || qb.Depth("jobs") != 0 {
+		t.Errorf("unexpected delete result: %d, depth %d", rr.Code, qb.Depth("jobs"))
+	}
+	if rr := do("DELETE", fmt.Sprintf("/queue/jobs/messages/%d", jobs[0].ID)); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for deleted message, got %d", rr.Code)
+	}
+
+	if rr := do("POST", fmt.Sprintf("/queue/jobs.dlq/messages/%d/requeue?to=jobs", dlq[0].ID)); rr.Code != http.StatusOK {
+		t.Fatalf("unexpected requeue status %d: %s", rr.Code, rr.Body)
+	}
+	if qb.Depth("jobs") != 1 || qb.Depth("jobs.dlq") != 0 {
+		t.Errorf("message not moved: jobs %d, dlq %d", qb.Depth("jobs"), qb.Depth("jobs.dlq"))
+	}
+	if rr := do("POST", "/queue/jobs/messages/123/requeue"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown message, got %d", rr.Code)
+	}
+	if rr := do("DELETE", "/queue/missing/messages/1"); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for missing queue, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,52 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"queue-broker/pkg/broker"
+)
+
+// handleQueueOffsets обрабатывает GET и POST /queue/{name}/offsets: границы
+// журнала очереди и смещения групп потребителей; POST с {"group", "offset"}
+// фиксирует смещение группы, с которого продолжит GET ?group=
+func handleQueueOffsets(qb *broker.QueueBroker, w http.ResponseWriter, r *http.Request, queueName string) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var requestBody struct {
+			Group  string  `json:"group"`
+			Offset *uint64 `json:"offset"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil || requestBody.Offset == nil {
+			httpError(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+		if err := qb.CommitOffset(queueName, requestBody.Group, *requestBody.Offset); err != nil {
+			offsetsError(w, err)
+			return
+		}
+	default:
+		httpError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	offsets, err := qb.LogOffsets(queueName)
+	if err != nil {
+		offsetsError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(offsets)
+}
+
+// offsetsError отвечает на ошибку операции со смещениями журнала
+func offsetsError(w http.ResponseWriter, err error) {
+	if errors.Is(err, broker.ErrQueueNotFound) {
+		writeError(w, http.StatusNotFound, broker.ErrorCode(err), "Queue does not exist", nil)
+		return
+	}
+	errorResponse(w, err, http.StatusBadRequest)
+}
@@ -0,0 +1,59 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"queue-broker/pkg/broker"
+)
+
+// TestQueueOffsets проверяет фиксацию смещений групп через /queue/{name}/offsets
+// и чтение журнала с зафиксированного смещения через GET ?group=
+func TestQueueOffsets(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 1)
+	qb.SetQueueConfig("events", broker.QueueConfig{LockDuration: 30, Retention: 3600})
+	handler := NewHandler(qb, nil)
+	do := requester(handler)
+	for _, body := range []string{"first", "second"} {
+		qb.PutMessage("events", body)
+	}
+
+	// Новая группа читает с начала журнала; чтение не сдвигает смещение
+	for range 2 {
+		if rr := do(http.MethodGet, "/queue/events?group=billing", ""); rr.Header().Get("X-Offset") != "0" || !strings.Contains(rr.Body.String(), "first") {
+			t.Fatalf("new group: got %d %v %s", rr.Code, rr.Header(), rr.Body)
+		}
+	}
+	if rr := do(http.MethodPost, "/queue/events/offsets", `{"group": "billing", "offset": 1}`); rr.Code != http.StatusOK {
+		t.Fatalf("commit: got %d %s", rr.Code, rr.Body)
+	}
+	if rr := do(http.MethodGet, "/v1/queues/events/log?group=billing", ""); rr.Header().Get("X-Offset") != "1" || !strings.Contains(rr.Body.String(), "second") {
+		t.Errorf("committed group: got %d %v %s", rr.Code, rr.Header(), rr.Body)
+	}
+
+	rr := do(http.MethodGet, "/v1/queues/events/offsets", "")
+	var offsets broker.LogOffsets
+	if err := json.NewDecoder(rr.Body).Decode(&offsets); err != nil || offsets.Next != 2 || offsets.Groups["billing"] != 1 {
+		t.Errorf("offsets: got %d %+v %v", rr.Code, offsets, err)
+	}
+
+	cases := []struct {
+		method, target, body string
+		status               int
+		code                 string
+	}{
+		{http.MethodPost, "/queue/events/offsets", `{"group": "billing", "offset": 3}`, http.StatusBadRequest, "INVALID_OFFSET"},
+		{http.MethodPost, "/queue/events/offsets", `{"group": "", "offset": 0}`, http.StatusBadRequest, "INVALID_GROUP"},
+		{http.MethodPost, "/queue/events/offsets", `{"group": "billing"}`, http.StatusBadRequest, ""},
+		{http.MethodGet, "/queue/missing/offsets", "", http.StatusNotFound, "QUEUE_NOT_FOUND"},
+		{http.MethodGet, "/queue/events?group=" + strings.Repeat("g", 300), "", http.StatusBadRequest, "INVALID_GROUP"},
+	}
+	for _, tc := range cases {
+		rr := do(tc.method, tc.target, tc.body)
+		if rr.Code != tc.status || !strings.Contains(rr.Body.String(), tc.code) {
+			t.Errorf("%s %.40s %s: got %d %s", tc.method, tc.target, tc.body, rr.Code, rr.Body)
+		}
+	}
+}
@@ -0,0 +1,489 @@
+package httpapi
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"queue-broker/pkg/broker"
+)
+
+// Значения OIDCConfig по умолчанию
+const (
+	DefaultJWKSCacheTTL = 3600
+	DefaultTokenLeeway  = 60
+	// jwksMinRefresh как часто можно перечитывать JWKS из-за токена
+	// с неизвестным ключом
+	jwksMinRefresh = 30 * time.Second
+)
+
+// OIDCConfig настройки проверки токенов OAuth2/OIDC (JWT) вместо статических
+// ключей API
+type OIDCConfig struct {
+	// Issuer ожидаемый издатель токенов (claim iss)
+	Issuer string `json:"issuer"`
+	// Audience ожидаемый получатель (claim aud)
+	Audience string `json:"audience"`
+	// JWKSURL адрес ключей издателя; пусто — jwks_uri из
+	// {issuer}/.well-known/openid-configuration
+	JWKSURL string `json:"jwks_url"`
+	// CacheTTL сколько секунд кешировать ключи (по умолчанию 3600)
+	CacheTTL int `json:"cache_ttl"`
+	// Leeway допустимое расхождение часов при проверке exp и nbf в секундах
+	// (по умолчанию 60)
+	Leeway int `json:"leeway"`
+	// PrincipalClaim claim с идентификатором субъекта для прав очередей
+	// (по умолчанию sub)
+	PrincipalClaim string `json:"principal_claim"`
+	// Grants права на очереди по claims токена; если заданы, токен получает
+	// доступ только к очередям, разрешенным хотя бы одним правилом
+	Grants []ClaimGrant `json:"grants"`
+}
+
+// ClaimGrant правило, выдающее права на очереди токенам, у которых claim
+// Claim равен Value или содержит его (в массиве или в строке через пробел,
+// как scope)
+type ClaimGrant struct {
+	Claim string `json:"claim"`
+	Value string `json:"value"`
+	// Queues имя или шаблон очередей; пусто — все очереди
+	Queues string `json:"queues"`
+	// Permissions выдаваемые права; admin включает produce и consume
+	Permissions []broker.Permission `json:"permissions"`
+}
+
+// matches сообщает, выдает ли правило право perm на очередь
+func (g *ClaimGrant) matches(queueName string, perm broker.Permission) bool {
+	if g.Queues != "" && !broker.MatchPattern(g.Queues, queueName) {
+		return false
+	}
+	return slices.Contains(g.Permissions, perm) || slices.Contains(g.Permissions, broker.PermAdmin)
+}
+
+type tokenGrantsKey struct{}
+
+// tokenGrants правила, под которые подошел токен запроса
+type tokenGrants struct {
+	grants []ClaimGrant
+}
+
+// TokenValidator проверяет токены Authorization: Bearer: подпись по ключам
+// JWKS издателя (RS256/384/512, PS256/384/512, ES256/384/512), издателя,
+// получателя и срок действия
+type TokenValidator struct {
+	cfg    OIDCConfig
+	ttl    time.Duration
+	leeway time.Duration
+	client *http.Client
+	now    func() time.Time
+
+	mu      sync.Mutex
+	jwksURL string
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+}
+
+// NewTokenValidator создает проверку токенов по настройкам
+func NewTokenValidator(cfg OIDCConfig) *TokenValidator {
+	v := &TokenValidator{
+		cfg:     cfg,
+		ttl:     time.Duration(cfg.CacheTTL) * time.Second,
+		leeway:  time.Duration(cfg.Leeway) * time.Second,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		now:     time.Now,
+		jwksURL: cfg.JWKSURL,
+	}
+	if v.ttl <= 0 {
+		v.ttl = DefaultJWKSCacheTTL * time.Second
+	}
+	if v.leeway <= 0 {
+		v.leeway = DefaultTokenLeeway * time.Second
+	}
+	if v.cfg.PrincipalClaim == "" {
+		v.cfg.PrincipalClaim = "sub"
+	}
+	return v
+}
+
+// middleware пропускает только запросы с действительным токеном; субъектом
+// запроса становится claim PrincipalClaim. Служебная очередь самопроверки
+// доступна без токена.
+func (v *TokenValidator) middleware(next http.Handler) http.Handler {
+	if v == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if queueName, _ := splitQueuePath(r.URL.Path); queueName == broker.CanaryQueue {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			httpError(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		claims, err := v.validate(token)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			httpError(w, "Invalid token: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+		subject, _ := claims[v.cfg.PrincipalClaim].(string)
+		if subject == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			httpError(w, "Invalid token: missing "+v.cfg.PrincipalClaim+" claim", http.StatusUnauthorized)
+			return
+		}
+		ctx := context.WithValue(r.Context(), principalKey{}, subject)
+		if len(v.cfg.Grants) > 0 {
+			ctx = context.WithValue(ctx, tokenGrantsKey{}, &tokenGrants{grants: v.grantsFor(claims)})
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// grantsFor правила, под которые подходят claims токена
+func (v *TokenValidator) grantsFor(claims map[string]any) []ClaimGrant {
+	var grants []ClaimGrant
+	for _, g := range v.cfg.Grants {
+		if claimContains(claims[g.Claim], g.Value) {
+			grants = append(grants, g)
+		}
+	}
+	return grants
+}
+
+// claimContains сообщает, равен ли claim значению или содержит его
+func claimContains(claim any, value string) bool {
+	switch c := claim.(type) {
+	case string:
+		return c == value || slices.Contains(strings.Fields(c), value)
+	case []any:
+		for _, item := range c {
+			if s, ok := item.(string); ok && s == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// tokenAllows сообщает, разрешают ли права токена запроса действие
+// с очередью; без правил в настройках токен ничего не ограничивает
+func tokenAllows(r *http.Request, queueName string, perm broker.Permission) bool {
+	t, ok := r.Context().Value(tokenGrantsKey{}).(*tokenGrants)
+	if !ok {
+		return true
+	}
+	for _, g := range t.grants {
+		if g.matches(queueName, perm) {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenAllowsAdmin сообщает, разрешают ли права токена запроса служебные
+// запросы к брокеру (/admin/...): нужно правило с правом admin на все очереди
+func tokenAllowsAdmin(r *http.Request) bool {
+	t, ok := r.Context().Value(tokenGrantsKey{}).(*tokenGrants)
+	if !ok {
+		return true
+	}
+	for _, g := range t.grants {
+		if (g.Queues == "" || g.Queues == ">") && slices.Contains(g.Permissions, broker.PermAdmin) {
+			return true
+		}
+	}
+	return false
+}
+
+// requireAdmin отклоняет служебные запросы токенов без права admin на все
+// очереди (см. tokenAllowsAdmin)
+func requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !tokenAllowsAdmin(r) {
+			httpError(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authorize проверяет право субъекта запроса на действие с очередью: и по
+// правам очереди, и по правам токена
+func authorize(qb *broker.QueueBroker, r *http.Request, queueName string, perm broker.Permission) bool {
+	return tokenAllows(r, queueName, perm) && qb.Authorize(principal(r), queueName, perm)
+}
+
+// validate проверяет токен и возвращает его claims
+func (v *TokenValidator) validate(token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, errors.New("malformed token")
+	}
+	if _, ok := jwtHashes[header.Alg]; !ok {
+		return nil, errors.New("unsupported algorithm")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed token")
+	}
+	key, err := v.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, errors.New("malformed token")
+	}
+	now := v.now()
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return nil, errors.New("missing exp claim")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(v.leeway)) {
+		return nil, errors.New("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(v.leeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, errors.New("token not yet valid")
+	}
+	if iss, _ := claims["iss"].(string); v.cfg.Issuer != "" && iss != v.cfg.Issuer {
+		return nil, errors.New("unexpected issuer")
+	}
+	if v.cfg.Audience != "" && !audienceContains(claims["aud"], v.cfg.Audience) {
+		return nil, errors.New("unexpected audience")
+	}
+	return claims, nil
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// audienceContains проверяет claim aud: строку или массив строк
+func audienceContains(aud any, audience string) bool {
+	switch a := aud.(type) {
+	case string:
+		return a == audience
+	case []any:
+		for _, item := range a {
+			if s, ok := item.(string); ok && s == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// jwtHashes хеш-функции поддерживаемых алгоритмов подписи JWT
+var jwtHashes = map[string]crypto.Hash{
+	"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512,
+	"PS256": crypto.SHA256, "PS384": crypto.SHA384, "PS512": crypto.SHA512,
+	"ES256": crypto.SHA256, "ES384": crypto.SHA384, "ES512": crypto.SHA512,
+}
+
+// jwtCurves кривые алгоритмов ES*
+var jwtCurves = map[string]elliptic.Curve{"ES256": elliptic.P256(), "ES384": elliptic.P384(), "ES512": elliptic.P521()}
+
+// verifySignature проверяет подпись signingInput алгоритмом alg
+func verifySignature(alg string, key crypto.PublicKey, signingInput string, signature []byte) error {
+	hash, ok := jwtHashes[alg]
+	if !ok {
+		return errors.New("unsupported algorithm")
+	}
+	h := hash.New()
+	h.Write([]byte(signingInput))
+	digest := h.Sum(nil)
+
+	valid := false
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		switch alg[:2] {
+		case "RS":
+			valid = rsa.VerifyPKCS1v15(pub, hash, digest, signature) == nil
+		case "PS":
+			valid = rsa.VerifyPSS(pub, hash, digest, signature, nil) == nil
+		}
+	case *ecdsa.PublicKey:
+		// Подпись ES* — r и s фиксированной длины подряд
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if jwtCurves[alg] == pub.Curve && len(signature) == 2*size {
+			r := new(big.Int).SetBytes(signature[:size])
+			s := new(big.Int).SetBytes(signature[size:])
+			valid = ecdsa.Verify(pub, digest, r, s)
+		}
+	}
+	if !valid {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// key возвращает ключ издателя с идентификатором kid, перечитывая JWKS по
+// истечении срока кеша или при неизвестном ключе (не чаще jwksMinRefresh),
+// например, после смены ключей издателем
+func (v *TokenValidator) key(kid string) (crypto.PublicKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	now := v.now()
+	lookup := func() (crypto.PublicKey, bool) {
+		if key, ok := v.keys[kid]; ok {
+			return key, true
+		}
+		// Токен без kid подходит к единственному ключу набора
+		if kid == "" && len(v.keys) == 1 {
+			for _, key := range v.keys {
+				return key, true
+			}
+		}
+		return nil, false
+	}
+	key, found := lookup()
+	age := now.Sub(v.fetched)
+	if found && age < v.ttl {
+		return key, nil
+	}
+	if !found && age < jwksMinRefresh {
+		return nil, errors.New("unknown signing key")
+	}
+	if err := v.refreshLocked(); err != nil {
+		// Недоступность издателя не отключает проверку по уже известным ключам
+		log.Printf("oidc: %v", err)
+		if found {
+			return key, nil
+		}
+		return nil, errors.New("signing keys unavailable")
+	}
+	if key, found = lookup(); !found {
+		return nil, errors.New("unknown signing key")
+	}
+	return key, nil
+}
+
+// refreshLocked загружает JWKS, при необходимости узнав его адрес через
+// discovery издателя
+func (v *TokenValidator) refreshLocked() error {
+	v.fetched = v.now()
+	if v.jwksURL == "" {
+		var discovery struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := v.getJSON(strings.TrimSuffix(v.cfg.Issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+			return fmt.Errorf("discovery: %w", err)
+		}
+		if discovery.JWKSURI == "" {
+			return errors.New("discovery: no jwks_uri")
+		}
+		v.jwksURL = discovery.JWKSURI
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := v.getJSON(v.jwksURL, &set); err != nil {
+		return fmt.Errorf("jwks: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if key, err := jwk.publicKey(); err == nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	v.keys = keys
+	return nil
+}
+
+func (v *TokenValidator) getJSON(url string, dst any) error {
+	resp, err := v.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: unexpected status %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(dst)
+}
+
+// jsonWebKey открытый ключ RSA или EC в формате JWK
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	field := func(s string) (*big.Int, error) {
+		data, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil || len(data) == 0 {
+			return nil, errors.New("invalid key")
+		}
+		return new(big.Int).SetBytes(data), nil
+	}
+	switch k.Kty {
+	case "RSA":
+		n, err := field(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := field(k.E)
+		if err != nil || !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid key")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+		curve, ok := curves[k.Crv]
+		if !ok {
+			return nil, errors.New("unsupported curve")
+		}
+		x, err := field(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := field(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, errors.New("unsupported key type")
+}
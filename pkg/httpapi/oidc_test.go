@@ -0,0 +1,260 @@
+package httpapi
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"queue-broker/pkg/broker"
+)
+
+// testIssuer издатель токенов с discovery и JWKS
+type testIssuer struct {
+	server   *httptest.Server
+	rsaKey   *rsa.PrivateKey
+	ecKey    *ecdsa.PrivateKey
+	jwksHits atomic.Int32
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss := &testIssuer{rsaKey: rsaKey, ecKey: ecKey}
+	enc := base64.RawURLEncoding.EncodeToString
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"issuer": iss.server.URL, "jwks_uri": iss.server.URL + "/jwks"})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		iss.jwksHits.Add(1)
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa-1", "use": "sig", "n": enc(rsaKey.N.Bytes()), "e": enc(big.NewInt(int64(rsaKey.E)).Bytes())},
+			{"kty": "EC", "kid": "ec-1", "crv": "P-256", "x": enc(ecKey.X.FillBytes(make([]byte, 32))), "y": enc(ecKey.Y.FillBytes(make([]byte, 32)))},
+		}})
+	})
+	iss.server = httptest.NewServer(mux)
+	t.Cleanup(iss.server.Close)
+	return iss
+}
+
+// token выпускает токен с claims, подписанный ключом kid
+func (iss *testIssuer) token(t *testing.T, kid string, claims map[string]any) string {
+	alg := "RS256"
+	if kid == "ec-1" {
+		alg = "ES256"
+	}
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(input))
+	var sig []byte
+	if alg == "RS256" {
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, iss.rsaKey, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	} else {
+		r, s, err := ecdsa.Sign(rand.Reader, iss.ecKey, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func (iss *testIssuer) claims(sub string, extra map[string]any) map[string]any {
+	claims := map[string]any{"iss": iss.server.URL, "aud": []string{"queue-broker"}, "sub": sub, "exp": time.Now().Add(time.Hour).Unix()}
+	for k, v := range extra {
+		claims[k] = v
+	}
+	return claims
+}
+
+// TestTokenValidation проверяет прием и отклонение токенов
+func TestTokenValidation(t *testing.T) {
+	iss := newTestIssuer(t)
+	qb := broker.NewQueueBroker(100, 10, 10)
+	handler := NewHandler(qb, nil, WithTokenValidator(NewTokenValidator(OIDCConfig{Issuer: iss.server.URL, Audience: "queue-broker"})))
+	do := func(method, target, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(`{"message": "x"}`))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := do(http.MethodPut, "/queue/jobs", ""); rr.Code != http.StatusUnauthorized || rr.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("missing token: unexpected response %d", rr.Code)
+	}
+	for _, kid := range []string{"rsa-1", "ec-1"} {
+		if rr := do(http.MethodPut, "/queue/jobs", iss.token(t, kid, iss.claims("svc-a", nil))); rr.Code != http.StatusOK {
+			t.Errorf("%s: unexpected response %d %s", kid, rr.Code, rr.Body)
+		}
+	}
+
+	// Подмена символа в середине подписи
+	tampered := []byte(iss.token(t, "rsa-1", iss.claims("svc-a", nil)))
+	i := len(tampered) - 100
+	if tampered[i] == 'A' {
+		tampered[i] = 'B'
+	} else {
+		tampered[i] = 'A'
+	}
+	rejected := map[string]string{
+		"expired":      iss.token(t, "rsa-1", iss.claims("svc-a", map[string]any{"exp": time.Now().Add(-time.Hour).Unix()})),
+		"issuer":       iss.token(t, "rsa-1", iss.claims("svc-a", map[string]any{"iss": "https://evil.example"})),
+		"audience":     iss.token(t, "rsa-1", iss.claims("svc-a", map[string]any{"aud": "other"})),
+		"no subject":   iss.token(t, "rsa-1", iss.claims("", nil)),
+		"unknown key":  iss.token(t, "rsa-2", iss.claims("svc-a", nil)),
+		"tampered":     string(tampered),
+		"malformed":    "not-a-jwt",
+		"alg none":     base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + ".e30.",
+		"wrong family": strings.Replace(iss.token(t, "ec-1", iss.claims("svc-a", nil)), "eyJhbGciOiJFUzI1NiIs", "eyJhbGciOiJSUzI1NiIs", 1),
+	}
+	for name, token := range rejected {
+		if rr := do(http.MethodPut, "/queue/jobs", token); rr.Code != http.StatusUnauthorized {
+			t.Errorf("%s: unexpected response %d %s", name, rr.Code, rr.Body)
+		}
+	}
+	// Ключи кешируются; неизвестный ключ перечитывает JWKS не чаще jwksMinRefresh
+	if hits := iss.jwksHits.Load(); hits != 1 {
+		t.Errorf("expected JWKS to be fetched once, got %d", hits)
+	}
+
+	// Субъект токена становится владельцем очереди и проверяется правами
+	owner := iss.token(t, "rsa-1", iss.claims("svc-a", nil))
+	other := iss.token(t, "rsa-1", iss.claims("svc-b", nil))
+	req := httptest.NewRequest(http.MethodPut, "/queue/jobs/acl", strings.NewReader(`{"consume": ["svc-a"]}`))
+	req.Header.Set("Authorization", "Bearer "+owner)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("set acl: unexpected response %d %s", rr.Code, rr.Body)
+	}
+	if rr := do(http.MethodGet, "/queue/jobs?timeout=0", other); rr.Code != http.StatusForbidden {
+		t.Errorf("non-owner: unexpected response %d", rr.Code)
+	}
+	if rr := do(http.MethodGet, "/queue/jobs?timeout=0", owner); rr.Code != http.StatusOK {
+		t.Errorf("owner: unexpected response %d %s", rr.Code, rr.Body)
+	}
+	if rr := do(http.MethodGet, "/queue/"+broker.CanaryQueue+"?timeout=0", ""); rr.Code == http.StatusUnauthorized {
+		t.Error("canary queue should not require a token")
+	}
+}
+
+// TestTokenGrants проверяет права на очереди по claims токена
+func TestTokenGrants(t *testing.T) {
+	iss := newTestIssuer(t)
+	qb := broker.NewQueueBroker(100, 10, 10)
+	cfg := OIDCConfig{
+		Issuer:  iss.server.URL,
+		JWKSURL: iss.server.URL + "/jwks",
+		Grants: []ClaimGrant{
+			{Claim: "groups", Value: "billing", Queues: "billing.>", Permissions: []broker.Permission{broker.PermProduce, broker.PermConsume}},
+			{Claim: "scope", Value: "queues:admin", Permissions: []broker.Permission{broker.PermAdmin}},
+		},
+	}
+	handler := NewHandler(qb, nil, WithTokenValidator(NewTokenValidator(cfg)))
+	do := func(method, target, token, body string) int {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	billing := iss.token(t, "rsa-1", iss.claims("svc-billing", map[string]any{"groups": []string{"billing", "staff"}}))
+	admin := iss.token(t, "ec-1", iss.claims("ops", map[string]any{"scope": "openid queues:admin"}))
+	nobody := iss.token(t, "rsa-1", iss.claims("svc-x", nil))
+
+	if code := do(http.MethodPut, "/queue/billing.invoices", billing, `{"message": "x"}`); code != http.StatusOK {
+		t.Errorf("billing produce: unexpected status %d", code)
+	}
+	if code := do(http.MethodPut, "/queue/orders", billing, `{"message": "x"}`); code != http.StatusForbidden {
+		t.Errorf("billing outside grant: unexpected status %d", code)
+	}
+	if code := do(http.MethodPost, "/queue/billing.invoices/purge", billing, ""); code != http.StatusForbidden {
+		t.Errorf("billing admin: unexpected status %d", code)
+	}
+	if code := do(http.MethodPut, "/publish", billing, `{"messages": [{"queue": "orders", "message": "x"}]}`); code != http.StatusForbidden {
+		t.Errorf("billing publish outside grant: unexpected status %d", code)
+	}
+	if code := do(http.MethodPost, "/queue/billing.invoices/purge", admin, ""); code != http.StatusOK {
+		t.Errorf("admin purge: unexpected status %d", code)
+	}
+	if code := do(http.MethodPut, "/queue/orders", nobody, `{"message": "x"}`); code != http.StatusForbidden {
+		t.Errorf("no grants: unexpected status %d", code)
+	}
+
+	// Служебные запросы требуют права admin на все очереди
+	for _, target := range []string{"/admin/snapshot", "/admin/usage", "/admin/keys"} {
+		if code := do(http.MethodGet, target, billing, ""); code != http.StatusForbidden {
+			t.Errorf("billing %s: unexpected status %d", target, code)
+		}
+	}
+	if code := do(http.MethodGet, "/admin/usage", admin, ""); code != http.StatusOK {
+		t.Errorf("admin usage: unexpected status %d", code)
+	}
+
+	// Расписания, транзакции и получение из нескольких очередей проверяют права на очереди
+	if code := do(http.MethodPost, "/schedules", billing, `{"id": "orders", "cron": "@daily", "queue": "orders", "message": "x"}`); code != http.StatusForbidden {
+		t.Errorf("billing schedule outside grant: unexpected status %d", code)
+	}
+	if code := do(http.MethodPost, "/schedules", admin, `{"id": "orders", "cron": "@daily", "queue": "orders", "message": "x"}`); code != http.StatusCreated {
+		t.Errorf("admin schedule: unexpected status %d", code)
+	}
+	for method, target := range map[string]string{http.MethodGet: "/schedules/orders", http.MethodDelete: "/schedules/orders", http.MethodPut: "/schedules/orders"} {
+		if code := do(method, target, billing, `{"cron": "@daily", "queue": "billing.invoices", "message": "x"}`); code != http.StatusForbidden {
+			t.Errorf("billing %s %s: unexpected status %d", method, target, code)
+		}
+	}
+	req := httptest.NewRequest(http.MethodGet, "/schedules", nil)
+	req.Header.Set("Authorization", "Bearer "+billing)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if strings.Contains(rr.Body.String(), `"orders"`) {
+		t.Errorf("billing sees a schedule outside its grant: %s", rr.Body)
+	}
+	if code := do(http.MethodGet, "/queues/receive?names=billing.invoices,orders&timeout=0", billing, ""); code != http.StatusForbidden {
+		t.Errorf("billing receive outside grant: unexpected status %d", code)
+	}
+	if code := do(http.MethodPut, "/queue/billing.invoices?tx=t1", billing, `{"message": "x"}`); code != http.StatusAccepted {
+		t.Fatalf("billing stage: unexpected status %d", code)
+	}
+	staff := iss.token(t, "rsa-1", iss.claims("svc-billing", map[string]any{"groups": "staff"}))
+	if code := do(http.MethodPost, "/transactions/t1/commit", staff, ""); code != http.StatusForbidden {
+		t.Errorf("commit with a token outside the grant: unexpected status %d", code)
+	}
+	if code := do(http.MethodPost, "/transactions/t1/commit", billing, ""); code != http.StatusOK {
+		t.Errorf("billing commit: unexpected status %d", code)
+	}
+	qb.PutMessage("orders", "x")
+	req = httptest.NewRequest(http.MethodGet, "/queues", nil)
+	req.Header.Set("Authorization", "Bearer "+billing)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if !strings.Contains(rr.Body.String(), "billing.invoices") || strings.Contains(rr.Body.String(), `"orders"`) {
+		t.Errorf("billing queue list: %s", rr.Body)
+	}
+}
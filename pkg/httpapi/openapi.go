@@ -0,0 +1,51 @@
+package httpapi
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// OpenAPISpec спецификация HTTP API в формате OpenAPI 3; по ней генерируются
+// типы и операции пакета client
+//
+//go:embed openapi.json
+var OpenAPISpec []byte
+
+// swaggerUIPage страница Swagger UI для /openapi.json; скрипты и стили
+// загружаются браузером с CDN
+const swaggerUIPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>queue-broker API</title>
+<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+<script>SwaggerUIBundle({url: "/openapi.json", dom_id: "#swagger-ui"});</script>
+</body>
+</html>
+`
+
+// openAPIHandler обрабатывает GET /openapi.json
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(OpenAPISpec)
+}
+
+// docsHandler обрабатывает GET /docs: Swagger UI для спецификации
+func docsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(swaggerUIPage))
+}
@@ -0,0 +1,66 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"queue-broker/pkg/broker"
+)
+
+// TestOpenAPISpecMatchesRoutes проверяет, что каждая операция спецификации
+// обслуживается маршрутом обработчика
+func TestOpenAPISpecMatchesRoutes(t *testing.T) {
+	var spec struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(OpenAPISpec, &spec); err != nil || spec.OpenAPI == "" {
+		t.Fatalf("invalid spec: %v", err)
+	}
+
+	qb := broker.NewQueueBroker(100, 10, 10)
+	handler := NewHandler(qb, nil)
+	replacer := strings.NewReplacer("{name}", "jobs", "{id}", "1", "{token}", "abc")
+	operations := 0
+	for path, item := range spec.Paths {
+		for method := range item {
+			if method == "parameters" {
+				continue
+			}
+			operations++
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			req := httptest.NewRequest(strings.ToUpper(method), replacer.Replace(path)+"?timeout=0", strings.NewReader(`{}`)).WithContext(ctx)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			cancel()
+			if rr.Code == http.StatusMethodNotAllowed || strings.Contains(rr.Body.String(), `"ROUTE_NOT_FOUND"`) {
+				t.Errorf("%s %s is not routed: %d %s", method, path, rr.Code, rr.Body)
+			}
+		}
+	}
+	if operations == 0 {
+		t.Fatal("spec has no operations")
+	}
+}
+
+// TestOpenAPIEndpoints проверяет выдачу спецификации и страницы Swagger UI
+func TestOpenAPIEndpoints(t *testing.T) {
+	handler := NewHandler(broker.NewQueueBroker(100, 10, 10), nil)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/json" || !json.Valid(rr.Body.Bytes()) {
+		t.Errorf("unexpected spec response: %d %s", rr.Code, rr.Header())
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `url: "/openapi.json"`) {
+		t.Errorf("unexpected docs response: %d", rr.Code)
+	}
+}
@@ -0,0 +1,56 @@
+package httpapi
+
+import (
+	"net/http"
+	"strings"
+
+	"queue-broker/pkg/broker"
+	"queue-broker/pkg/cluster"
+)
+
+// partitionMiddleware пересылает запрос к очереди узлу-владельцу. Запросы
+// по шаблону и к служебной очереди самопроверки обслуживаются локально.
+func partitionMiddleware(qb *broker.QueueBroker, p *cluster.Partitioner, next http.Handler) http.Handler {
+	if p == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if queueName := partitionKey(qb, r); queueName != "" && p.Forward(w, r, queueName) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// partitionKey возвращает внутреннее имя очереди запроса (с префиксом
+// арендатора) или пустую строку, если запрос обслуживается локально
+func partitionKey(qb *broker.QueueBroker, r *http.Request) string {
+	path := r.URL.Path
+	tenantID := ""
+	if rest, ok := strings.CutPrefix(path, "/ns/"); ok {
+		var found bool
+		if tenantID, path, found = strings.Cut(rest, "/"); !found {
+			return ""
+		}
+		path = "/" + path
+	} else if qb.MultiTenant() {
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		tenantID, _ = qb.TenantByToken(token)
+	}
+	if !strings.HasPrefix(path, "/queue/") {
+		return ""
+	}
+
+	queueName, _ := splitQueuePath(path)
+	if queueName == "" || queueName == broker.CanaryQueue || broker.IsPattern(queueName) {
+		return ""
+	}
+	if tenantID != "" {
+		internal, err := broker.TenantQueueName(tenantID, queueName)
+		if err != nil {
+			return ""
+		}
+		return internal
+	}
+	return queueName
+}
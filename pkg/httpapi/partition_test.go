@@ -0,0 +1,96 @@
+package httpapi
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"queue-broker/pkg/broker"
+	"queue-broker/pkg/cluster"
+)
+
+// TestPartitionForwarding проверяет, что любой узел кластера принимает
+// запросы, а сообщения хранятся на узле-владельце очереди
+func TestPartitionForwarding(t *testing.T) {
+	brokers := []*broker.QueueBroker{broker.NewQueueBroker(100, 10, 1), broker.NewQueueBroker(100, 10, 1)}
+	handlers := make([]http.Handler, 2)
+	servers := make([]*httptest.Server, 2)
+	for i := range servers {
+		servers[i] = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handlers[i].ServeHTTP(w, r)
+		}))
+		defer servers[i].Close()
+	}
+	nodes := []string{servers[0].URL, servers[1].URL}
+	ring := cluster.NewRing(nodes)
+	for i := range handlers {
+		p := cluster.NewPartitioner(brokers[i], servers[i].URL, nodes, time.Hour)
+		handlers[i] = NewHandler(brokers[i], nil, WithPartitioner(p))
+	}
+
+	// Очередь, принадлежащая второму узлу, и запросы через первый
+	queue := ""
+	for _, name := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		if ring.Owner(name) == servers[1].URL {
+			queue = name
+			break
+		}
+	}
+	if queue == "" {
+		t.Fatal("no queue owned by the second node")
+	}
+	req, _ := http.NewRequest("PUT", servers[0].URL+"/queue/"+queue, bytes.NewBufferString(`{"message": "routed"}`))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("put through non-owner failed: %v %v", err, resp)
+	}
+	resp.Body.Close()
+	if brokers[1].Depth(queue) != 1 || brokers[0].Depth(queue) != 0 {
+		t.Fatalf("message stored on the wrong node: %d/%d", brokers[0].Depth(queue), brokers[1].Depth(queue))
+	}
+
+	resp, err = http.Get(servers[0].URL + "/queue/" + queue + "?timeout=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body bytes.Buffer
+	body.ReadFrom(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !bytes.Contains(body.Bytes(), []byte("routed")) {
+		t.Errorf("get through non-owner failed: %d %s", resp.StatusCode, body.String())
+	}
+}
+
+// TestClusterRequiresPeerSecret проверяет, что состав кластера и прием
+// переносимых сообщений доступны только с общим секретом брокеров
+func TestClusterRequiresPeerSecret(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 1)
+	p := cluster.NewPartitioner(qb, "http://a", []string{"http://a"}, time.Hour)
+	handler := NewHandler(qb, nil, WithPartitioner(p), WithPeerSecret("s3cret"))
+
+	for _, tc := range []struct{ method, path, body string }{
+		{"GET", "/cluster/nodes", ""},
+		{"PUT", "/cluster/nodes", `{"nodes": ["http://evil"]}`},
+		{"POST", "/cluster/handoff", `[{"queue": "jobs", "body": "eA=="}]`},
+	} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(tc.method, tc.path, bytes.NewBufferString(tc.body)))
+		if rr.Code != http.StatusUnauthorized || !bytes.Contains(rr.Body.Bytes(), []byte(`"code":"UNAUTHORIZED"`)) {
+			t.Errorf("%s %s: expected 401 JSON error, got %d %s", tc.method, tc.path, rr.Code, rr.Body)
+		}
+	}
+	if nodes := p.Nodes(); len(nodes) != 1 || nodes[0] != "http://a" || qb.Depth("jobs") != 0 {
+		t.Errorf("unauthenticated requests changed the cluster: %v, depth %d", nodes, qb.Depth("jobs"))
+	}
+
+	req := peerRequest("POST", "/cluster/handoff")
+	req.Body = io.NopCloser(bytes.NewBufferString(`[{"queue": "jobs", "body": "eA=="}]`))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || qb.Depth("jobs") != 1 {
+		t.Errorf("handoff with the peer secret: %d %s", rr.Code, rr.Body)
+	}
+}
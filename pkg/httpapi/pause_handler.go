@@ -0,0 +1,29 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"queue-broker/pkg/broker"
+)
+
+// handleQueuePause обрабатывает POST /queue/{name}/pause и /resume:
+// приостанавливает или возобновляет выдачу сообщений, постановка продолжается
+func handleQueuePause(qb *broker.QueueBroker, w http.ResponseWriter, r *http.Request, queueName string, pause bool) {
+	if r.Method != http.MethodPost {
+		httpError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if pause {
+		if err := qb.Pause(queueName); err != nil {
+			httpError(w, "Invalid queue name", http.StatusBadRequest)
+			return
+		}
+	} else {
+		qb.Resume(queueName)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]bool{"paused": qb.Paused(queueName)})
+}
@@ -0,0 +1,83 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"queue-broker/pkg/broker"
+)
+
+// lockDurationParam читает lock_duration из запроса или настроек очереди
+func lockDurationParam(qb *broker.QueueBroker, queueName, param string) (time.Duration, error) {
+	seconds := qb.QueueConfig(queueName).LockDuration
+	if param != "" {
+		var err error
+		seconds, err = strconv.Atoi(param)
+		if err != nil || seconds <= 0 {
+			return 0, errors.New("invalid lock duration")
+		}
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// handleLockAction обрабатывает POST /queue/{name}/complete, /renew и /abandon
+func handleLockAction(qb *broker.QueueBroker, w http.ResponseWriter, r *http.Request, queueName, action string) {
+	if r.Method != http.MethodPost {
+		httpError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var requestBody struct {
+		LockToken    string `json:"lock_token"`
+		LockDuration int    `json:"lock_duration"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&requestBody)
+	if token, ok := r.Context().Value(leaseKey{}).(string); ok {
+		// В /v1 токен задается путем, тело может быть пустым
+		requestBody.LockToken = token
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+	}
+	if err != nil || requestBody.LockToken == "" || requestBody.LockDuration < 0 {
+		httpError(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	var response any
+	switch action {
+	case "complete":
+		if err := qb.Complete(queueName, requestBody.LockToken); err != nil {
+			writeError(w, http.StatusGone, errorCode(err, http.StatusGone), "Lock not found or expired", nil)
+			return
+		}
+	case "abandon":
+		if err := qb.Abandon(queueName, requestBody.LockToken); err != nil {
+			writeError(w, http.StatusGone, errorCode(err, http.StatusGone), "Lock not found or expired", nil)
+			return
+		}
+	case "renew":
+		lockDuration, _ := lockDurationParam(qb, queueName, "")
+		if requestBody.LockDuration > 0 {
+			lockDuration = time.Duration(requestBody.LockDuration) * time.Second
+		}
+		lockedUntil, err := qb.RenewLock(queueName, requestBody.LockToken, lockDuration)
+		if err != nil {
+			writeError(w, http.StatusGone, errorCode(err, http.StatusGone), "Lock not found or expired", nil)
+			return
+		}
+		response = map[string]any{"locked_until": lockedUntil, "lock_duration": int((lockDuration + time.Second - 1) / time.Second)}
+	}
+
+	if response == nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
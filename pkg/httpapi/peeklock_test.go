@@ -0,0 +1,128 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"queue-broker/pkg/broker"
+)
+
+// peekLock выполняет GET в режиме peek-lock и возвращает выданное сообщение
+func peekLock(t *testing.T, handler http.Handler, url string) (int, broker.Delivery) {
+	t.Helper()
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	var delivery broker.Delivery
+	if rr.Code == http.StatusOK {
+		if err := json.NewDecoder(rr.Body).Decode(&delivery); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rr.Code, delivery
+}
+
+// lockAction выполняет POST /complete или /renew
+func lockAction(t *testing.T, handler http.Handler, url, token string) int {
+	t.Helper()
+	body, _ := json.Marshal(map[string]string{"lock_token": token})
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr.Code
+}
+
+// TestPeekLockComplete проверяет, что заблокированное сообщение скрыто и удаляется после complete
+func TestPeekLockComplete(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+	handler := QueueHandler(qb)
+	qb.PutMessage("testQueue", "test message")
+
+	code, delivery := peekLock(t, handler, "/queue/testQueue?mode=peeklock&timeout=1")
+	if code != http.StatusOK || delivery.Message == nil || delivery.Body != "test message" || delivery.LockToken == "" {
+		t.Fatalf("unexpected peek-lock delivery: %v %+v", code, delivery)
+	}
+	if delivery.LockDuration != 30 || delivery.LockedUntil.IsZero() {
+		t.Errorf("expected lease deadline and duration in delivery, got %+v", delivery)
+	}
+
+	// Пока блокировка действует, сообщение недоступно
+	if code, _ := peekLock(t, handler, "/queue/testQueue?mode=peeklock&timeout=0"); code != http.StatusNotFound {
+		t.Errorf("locked message was delivered twice: got %v want %v", code, http.StatusNotFound)
+	}
+
+	if code := lockAction(t, handler, "/queue/testQueue/complete", delivery.LockToken); code != http.StatusOK {
+		t.Errorf("complete returned wrong status code: got %v want %v", code, http.StatusOK)
+	}
+	if code := lockAction(t, handler, "/queue/testQueue/complete", delivery.LockToken); code != http.StatusGone {
+		t.Errorf("second complete returned wrong status code: got %v want %v", code, http.StatusGone)
+	}
+}
+
+// TestPeekLockExpiry проверяет возврат сообщения в очередь после истечения блокировки
+func TestPeekLockExpiry(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+	handler := QueueHandler(qb)
+	qb.PutMessage("testQueue", "test message")
+
+	_, delivery := peekLock(t, handler, "/queue/testQueue?mode=peeklock&lock_duration=1&timeout=1")
+
+	// Продление сдвигает срок блокировки
+	lockedUntil, err := qb.RenewLock("testQueue", delivery.LockToken, 2*time.Second)
+	if err != nil || !lockedUntil.After(delivery.LockedUntil) {
+		t.Fatalf("renew did not extend the lock: %v %v", lockedUntil, err)
+	}
+
+	code, redelivery := peekLock(t, handler, "/queue/testQueue?mode=peeklock&timeout=3")
+	if code != http.StatusOK || redelivery.Body != "test message" || redelivery.LockToken == delivery.LockToken {
+		t.Fatalf("message was not redelivered after lock expiry: %v %+v", code, redelivery)
+	}
+	if time.Now().Before(lockedUntil) {
+		t.Errorf("message was redelivered before the renewed lock expired")
+	}
+	if code := lockAction(t, handler, "/queue/testQueue/complete", delivery.LockToken); code != http.StatusGone {
+		t.Errorf("complete with an expired lock returned %v want %v", code, http.StatusGone)
+	}
+}
+
+// TestPeekLockAbandon проверяет возврат сообщения через /abandon по политике повторов
+func TestPeekLockAbandon(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+	handler := QueueHandler(qb)
+	qb.PutMessage("testQueue", "test message")
+
+	req := httptest.NewRequest("PUT", "/queue/testQueue/config", bytes.NewBufferString(`{"retry": {"max_attempts": -1}}`))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid retry policy, got %d", rr.Code)
+	}
+	req = httptest.NewRequest("PUT", "/queue/testQueue/config", bytes.NewBufferString(`{"retry": {"max_attempts": 1}}`))
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("unexpected config status %d", rr.Code)
+	}
+
+	_, delivery := peekLock(t, handler, "/queue/testQueue?mode=peeklock&timeout=1")
+	if code := lockAction(t, handler, "/queue/testQueue/abandon", delivery.LockToken); code != http.StatusOK {
+		t.Errorf("abandon returned wrong status code: got %v want %v", code, http.StatusOK)
+	}
+	if code := lockAction(t, handler, "/queue/testQueue/abandon", delivery.LockToken); code != http.StatusGone {
+		t.Errorf("second abandon returned wrong status code: got %v want %v", code, http.StatusGone)
+	}
+	if qb.Depth("testQueue") != 0 || qb.Depth("testQueue.dlq") != 1 {
+		t.Errorf("message not dead-lettered after single attempt: %d %d", qb.Depth("testQueue"), qb.Depth("testQueue.dlq"))
+	}
+}
@@ -0,0 +1,192 @@
+package httpapi
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// proxyHeaderTimeout сколько ждать заголовок PROXY protocol после подключения
+	proxyHeaderTimeout = 5 * time.Second
+	// maxProxyV1Header максимальная длина заголовка v1 по спецификации
+	maxProxyV1Header = 107
+)
+
+// proxyV2Signature начало двоичного заголовка PROXY protocol v2
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// errNoProxyHeader соединение от доверенного прокси без заголовка PROXY protocol
+var errNoProxyHeader = errors.New("missing PROXY protocol header")
+
+// errAddressDenied адрес клиента из заголовка PROXY protocol запрещен
+var errAddressDenied = errors.New("client address denied")
+
+// Listener оборачивает ln для любого протокола брокера (HTTP, MQTT, NATS,
+// STOMP): соединения с запрещенных адресов закрываются сразу после приема;
+// соединения через сокет Unix не проверяются.
+// Соединения от доверенных прокси проверяются по адресу клиента: из заголовка
+// PROXY protocol, если он включен (соединение без заголовка или с
+// некорректным заголовком закрывается), иначе — в HTTP по X-Forwarded-For.
+func (a *AccessList) Listener(ln net.Listener) net.Listener {
+	if a == nil {
+		return ln
+	}
+	return &accessListener{Listener: ln, access: a}
+}
+
+type accessListener struct {
+	net.Listener
+	access *AccessList
+}
+
+func (l *accessListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		addr, ok := conn.RemoteAddr().(*net.TCPAddr)
+		if !ok {
+			// Сокеты Unix доступны только с этого же узла
+			return conn, nil
+		}
+		ip := addr.IP
+		switch {
+		case containsIP(l.access.trusted, ip) && l.access.proxyProtocol:
+			// Заголовок читается не в Accept, а при первом обращении из
+			// горутины соединения, чтобы медленный клиент не задерживал прием
+			return &proxyConn{Conn: conn, reader: bufio.NewReader(conn), access: l.access}, nil
+		case containsIP(l.access.trusted, ip) || l.access.Allowed(ip):
+			return conn, nil
+		}
+		conn.Close()
+	}
+}
+
+// proxyConn соединение, начинающееся с заголовка PROXY protocol
+type proxyConn struct {
+	net.Conn
+	reader *bufio.Reader
+	access *AccessList
+
+	once   sync.Once
+	remote net.Addr
+	err    error
+}
+
+func (c *proxyConn) init() {
+	c.once.Do(func() {
+		c.remote = c.Conn.RemoteAddr()
+		c.Conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+		addr, err := readProxyHeader(c.reader)
+		c.Conn.SetReadDeadline(time.Time{})
+		if err != nil {
+			c.err = err
+			c.Conn.Close()
+			return
+		}
+		if addr != nil {
+			c.remote = addr
+			if !c.access.Allowed(addr.IP) {
+				c.err = errAddressDenied
+				c.Conn.Close()
+			}
+		}
+	})
+}
+
+func (c *proxyConn) Read(p []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(p)
+}
+
+// RemoteAddr адрес клиента из заголовка
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.init()
+	return c.remote
+}
+
+// readProxyHeader читает заголовок PROXY protocol v1 или v2; nil-адрес —
+// заголовок без адреса клиента (LOCAL, UNKNOWN), например, проверка
+// работоспособности от самого балансировщика
+func readProxyHeader(r *bufio.Reader) (*net.TCPAddr, error) {
+	if sig, err := r.Peek(len(proxyV2Signature)); err == nil && bytes.Equal(sig, proxyV2Signature) {
+		return readProxyV2(r)
+	}
+	if prefix, err := r.Peek(6); err != nil || string(prefix) != "PROXY " {
+		return nil, errNoProxyHeader
+	}
+
+	var line []byte
+	for len(line) < maxProxyV1Header {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	header, ok := strings.CutSuffix(string(line), "\r\n")
+	if !ok {
+		return nil, errors.New("invalid PROXY protocol header")
+	}
+	fields := strings.Fields(header)
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, errors.New("invalid PROXY protocol header")
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil {
+		return nil, errors.New("invalid PROXY protocol header")
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// readProxyV2 читает двоичный заголовок v2
+func readProxyV2(r *bufio.Reader) (*net.TCPAddr, error) {
+	var fixed [16]byte
+	if _, err := io.ReadFull(r, fixed[:]); err != nil {
+		return nil, err
+	}
+	version, command, family := fixed[12]>>4, fixed[12]&0x0f, fixed[13]
+	body := make([]byte, binary.BigEndian.Uint16(fixed[14:16]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	if version != 2 || command > 1 {
+		return nil, errors.New("invalid PROXY protocol header")
+	}
+	if command == 0 {
+		// LOCAL: соединение самого прокси
+		return nil, nil
+	}
+	switch family {
+	case 0x11: // TCP поверх IPv4
+		if len(body) < 12 {
+			return nil, errors.New("invalid PROXY protocol header")
+		}
+		return &net.TCPAddr{IP: net.IP(body[0:4]), Port: int(binary.BigEndian.Uint16(body[8:10]))}, nil
+	case 0x21: // TCP поверх IPv6
+		if len(body) < 36 {
+			return nil, errors.New("invalid PROXY protocol header")
+		}
+		return &net.TCPAddr{IP: net.IP(body[0:16]), Port: int(binary.BigEndian.Uint16(body[32:34]))}, nil
+	}
+	return nil, nil
+}
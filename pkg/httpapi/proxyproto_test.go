@@ -0,0 +1,110 @@
+package httpapi
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestReadProxyHeader проверяет разбор заголовков PROXY protocol v1 и v2
+func TestReadProxyHeader(t *testing.T) {
+	v2 := func(command, family byte, body []byte) string {
+		header := append([]byte{}, proxyV2Signature...)
+		header = append(header, 0x20|command, family, 0, 0)
+		binary.BigEndian.PutUint16(header[14:], uint16(len(body)))
+		return string(append(header, body...))
+	}
+	ipv4 := []byte{198, 51, 100, 4, 10, 0, 0, 1, 0x1f, 0x90, 0x00, 0x50}
+
+	cases := []struct {
+		name, header, want string
+		fail               bool
+	}{
+		{name: "v1 tcp4", header: "PROXY TCP4 198.51.100.4 10.0.0.1 8080 80\r\n", want: "198.51.100.4:8080"},
+		{name: "v1 tcp6", header: "PROXY TCP6 2001:db8::1 2001:db8::2 8080 80\r\n", want: "[2001:db8::1]:8080"},
+		{name: "v1 unknown", header: "PROXY UNKNOWN\r\n"},
+		{name: "v2 proxy", header: v2(1, 0x11, ipv4), want: "198.51.100.4:8080"},
+		{name: "v2 local", header: v2(0, 0x00, nil)},
+		{name: "missing", header: "GET / HTTP/1.1\r\n", fail: true},
+		{name: "v1 truncated", header: "PROXY TCP4 198.51.100.4\r\n", fail: true},
+		{name: "v1 too long", header: "PROXY TCP4 " + strings.Repeat("1", 200) + "\r\n", fail: true},
+		{name: "v2 short body", header: v2(1, 0x11, ipv4[:4]), fail: true},
+	}
+	for _, tc := range cases {
+		r := bufio.NewReader(strings.NewReader(tc.header + "rest"))
+		addr, err := readProxyHeader(r)
+		if tc.fail {
+			if err == nil {
+				t.Errorf("%s: expected error", tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		got := ""
+		if addr != nil {
+			got = addr.String()
+		}
+		if got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+		// Данные после заголовка остаются соединению
+		if rest, _ := io.ReadAll(r); string(rest) != "rest" {
+			t.Errorf("%s: unexpected remainder %q", tc.name, rest)
+		}
+	}
+}
+
+// TestAccessListener проверяет адрес клиента из PROXY protocol в HTTP-сервере
+func TestAccessListener(t *testing.T) {
+	access, err := NewAccessList(AccessConfig{Deny: []string{"203.0.113.0/24"}, TrustedProxies: []string{"127.0.0.1"}, ProxyProtocol: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(chan string, 1)
+	server := &http.Server{Handler: access.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen <- remoteHost(r)
+	}))}
+	go server.Serve(access.Listener(ln))
+	defer server.Close()
+
+	request := func(header string) (string, error) {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			return "", err
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		io.WriteString(conn, header+"GET / HTTP/1.1\r\nHost: broker\r\nConnection: close\r\n\r\n")
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			return "", err
+		}
+		resp.Body.Close()
+		return resp.Status, nil
+	}
+
+	if _, err := request("PROXY TCP4 198.51.100.4 127.0.0.1 40000 80\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-seen; got != "198.51.100.4" {
+		t.Errorf("unexpected client address %s", got)
+	}
+	// Запрещенный клиент и соединение без заголовка закрываются без ответа
+	for _, header := range []string{"PROXY TCP4 203.0.113.5 127.0.0.1 40000 80\r\n", ""} {
+		if status, err := request(header); err == nil {
+			t.Errorf("%q: unexpected response %s", header, status)
+		}
+	}
+}
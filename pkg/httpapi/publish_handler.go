@@ -0,0 +1,110 @@
+package httpapi
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"queue-broker/pkg/broker"
+)
+
+// maxPublishMessages сколько сообщений можно поставить одним PUT /publish
+const maxPublishMessages = 100
+
+// publishEntry сообщение в теле PUT /publish: поля как у PUT /queue/{name}
+// и очередь назначения
+type publishEntry struct {
+	*broker.Message
+	Base64 string `json:"message_base64"`
+	Delay  int    `json:"delay"`
+}
+
+// publishHandler обрабатывает PUT /publish: атомарную постановку сообщений
+// в несколько очередей {"messages": [{"queue": "jobs", "message": "..."}, ...]}
+func publishHandler(qb *broker.QueueBroker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			httpError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		r, ok := withTenant(qb, w, r)
+		if !ok {
+			return
+		}
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			bodyError(w, err)
+			return
+		}
+		// Как и в PUT /queue/{name}, некорректный UTF-8 не заменяется молча
+		if !utf8.Valid(data) {
+			httpError(w, "Invalid UTF-8", http.StatusBadRequest)
+			return
+		}
+		var requestBody struct {
+			Messages []publishEntry `json:"messages"`
+		}
+		if err := json.Unmarshal(data, &requestBody); err != nil {
+			httpError(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+		if len(requestBody.Messages) == 0 || len(requestBody.Messages) > maxPublishMessages {
+			httpError(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+
+		tenantID, multiTenant := r.Context().Value(tenantKey{}).(string)
+		pubs := make([]broker.Publication, len(requestBody.Messages))
+		for i, entry := range requestBody.Messages {
+			msg := entry.Message
+			if msg == nil || (msg.Body == "") == (entry.Base64 == "") || entry.Delay < 0 {
+				httpError(w, "Bad request", http.StatusBadRequest)
+				return
+			}
+			if entry.Base64 != "" {
+				body, err := base64.StdEncoding.DecodeString(entry.Base64)
+				if err != nil || len(body) == 0 {
+					httpError(w, "Invalid base64", http.StatusBadRequest)
+					return
+				}
+				msg.Body = string(body)
+			}
+			if entry.Delay > 0 {
+				msg.DeliverAt = time.Now().Add(time.Duration(entry.Delay) * time.Second)
+			}
+			queueName := msg.Queue
+			msg.Queue = ""
+			if multiTenant {
+				if queueName, err = broker.TenantQueueName(tenantID, queueName); err != nil {
+					httpError(w, "Invalid queue name", http.StatusBadRequest)
+					return
+				}
+			}
+			if queueName == "" || queueName == broker.CanaryQueue {
+				httpError(w, "Invalid queue name", http.StatusBadRequest)
+				return
+			}
+			if !authorize(qb, r, queueName, broker.PermProduce) {
+				httpError(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			pubs[i] = broker.Publication{Queue: queueName, Message: msg}
+		}
+
+		size := 0
+		for _, pub := range pubs {
+			size += len(pub.Message.Body)
+		}
+		if err := qb.EnqueueAll(pubs); err != nil {
+			enqueueError(w, err)
+			return
+		}
+		countUsage(r, true, len(pubs), size)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]int{"published": len(pubs)})
+	}
+}
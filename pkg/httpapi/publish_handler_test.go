@@ -0,0 +1,48 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"queue-broker/pkg/broker"
+)
+
+// TestPublish проверяет атомарную постановку в несколько очередей
+func TestPublish(t *testing.T) {
+	qb := broker.NewQueueBroker(1, 10, 10)
+	handler := NewHandler(qb, nil)
+	publish := func(body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPut, "/publish", strings.NewReader(body)))
+		return rr
+	}
+
+	rr := publish(`{"messages": [
+		{"queue": "jobs", "message": "job", "headers": {"kind": "a"}},
+		{"queue": "audit", "message_base64": "am9i"}
+	]}`)
+	if rr.Code != http.StatusOK || strings.TrimSpace(rr.Body.String()) != `{"published":2}` {
+		t.Fatalf("unexpected response %d %s", rr.Code, rr.Body)
+	}
+	msg, err := qb.Dequeue("audit", 0)
+	if err != nil || msg.Body != "job" || msg.Queue != "audit" {
+		t.Fatalf("unexpected message %+v %v", msg, err)
+	}
+
+	// jobs заполнена: в audit сообщение тоже не ставится
+	rr = publish(`{"messages": [{"queue": "audit", "message": "x"}, {"queue": "jobs", "message": "y"}]}`)
+	if rr.Code != http.StatusTooManyRequests || !strings.Contains(rr.Body.String(), "message 1: queue is full") {
+		t.Errorf("unexpected response %d %s", rr.Code, rr.Body)
+	}
+	if qb.Depth("audit") != 0 {
+		t.Error("partial publish was not rolled back")
+	}
+
+	for _, body := range []string{`{"messages": []}`, `{"messages": [{"message": "x"}]}`, `{"messages": [{"queue": "jobs"}]}`} {
+		if rr := publish(body); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: unexpected status %d", body, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"queue-broker/pkg/broker"
+)
+
+// handleQueuePurge обрабатывает POST /queue/{name}/purge: удаляет все
+// ожидающие сообщения очереди
+func handleQueuePurge(qb *broker.QueueBroker, w http.ResponseWriter, r *http.Request, queueName string) {
+	if r.Method != http.MethodPost {
+		httpError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	count, err := qb.Purge(queueName)
+	switch {
+	case err == nil:
+	case errors.Is(err, broker.ErrQueueNotFound):
+		writeError(w, http.StatusBadRequest, broker.ErrorCode(err), "Queue does not exist", nil)
+		return
+	case errors.Is(err, broker.ErrStandby):
+		errorResponse(w, err, http.StatusServiceUnavailable)
+		return
+	case errors.Is(err, broker.ErrQueueArchiving):
+		errorResponse(w, err, http.StatusConflict)
+		return
+	default:
+		errorResponse(w, err, http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]int{"purged": count})
+}
+
+// queuesHandler обрабатывает GET /queues: список очередей с числом сообщений.
+// В многоарендном режиме возвращаются только очереди арендатора из токена.
+func queuesHandler(qb *broker.QueueBroker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			httpError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Токен видит только очереди, из которых ему разрешено получать
+		infos := slices.DeleteFunc(qb.Queues(), func(info broker.QueueInfo) bool {
+			return !tokenAllows(r, info.Name, broker.PermConsume)
+		})
+		if qb.MultiTenant() {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			tenantID, found := qb.TenantByToken(token)
+			if !ok || !found {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				httpError(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			own := infos[:0]
+			for _, info := range infos {
+				if broker.TenantOf(info.Name) == tenantID {
+					info.Name = broker.TrimTenant(info.Name)
+					own = append(own, info)
+				}
+			}
+			infos = own
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]any{"queues": infos})
+	}
+}
@@ -0,0 +1,75 @@
+package httpapi
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"queue-broker/pkg/broker"
+)
+
+// TestQueuesAndPurgeHandlers проверяет список очередей и очистку очереди через API
+func TestQueuesAndPurgeHandlers(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 1)
+	handler := NewHandler(qb, nil)
+	qb.Enqueue("jobs", &broker.Message{Body: "j1"})
+	qb.Enqueue("jobs", &broker.Message{Body: "j2"})
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/queues", nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != `{"queues":[{"name":"jobs","depth":2,"delayed":0,"in_flight":0,"bytes":4}]}`+"\n" {
+		t.Errorf("unexpected queue list: %d %s", rr.Code, rr.Body)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/queue/jobs/purge", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 for GET, got %d", rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/queue/jobs/purge", nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != `{"purged":2}`+"\n" || qb.Depth("jobs") != 0 {
+		t.Errorf("unexpected purge response: %d %s", rr.Code, rr.Body)
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/queue/missing/purge", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for missing queue, got %d", rr.Code)
+	}
+}
+
+// TestPauseHandlers проверяет ручную паузу и возобновление выдачи через API
+func TestPauseHandlers(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 1)
+	handler := NewHandler(qb, nil)
+	do := func(method, target string) *httptest.ResponseRecorder {
+		var body io.Reader
+		if method == "PUT" {
+			body = strings.NewReader(`{"message": "job"}`)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(method, target, body))
+		return rr
+	}
+
+	if rr := do("GET", "/queue/jobs/pause"); rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 for GET, got %d", rr.Code)
+	}
+	if rr := do("POST", "/queue/jobs/pause"); rr.Code != http.StatusOK || rr.Body.String() != `{"paused":true}`+"\n" || !qb.Paused("jobs") {
+		t.Errorf("unexpected pause response: %d %s", rr.Code, rr.Body)
+	}
+	if rr := do("PUT", "/queue/jobs"); rr.Code != http.StatusOK || qb.Depth("jobs") != 1 {
+		t.Errorf("enqueue must continue during pause: %d", rr.Code)
+	}
+	if rr := do("GET", "/queue/jobs"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected no delivery during pause, got %d", rr.Code)
+	}
+	if rr := do("POST", "/v1/queues/jobs/resume"); rr.Code != http.StatusOK || rr.Body.String() != `{"paused":false}`+"\n" {
+		t.Errorf("unexpected resume response: %d %s", rr.Code, rr.Body)
+	}
+	if rr := do("GET", "/queue/jobs"); rr.Code != http.StatusOK {
+		t.Errorf("expected delivery after resume, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,548 @@
+// Package httpapi реализует HTTP API брокера очередей поверх пакета broker.
+package httpapi
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"queue-broker/pkg/audit"
+	"queue-broker/pkg/broker"
+	"queue-broker/pkg/cluster"
+	"queue-broker/pkg/objstore"
+	"queue-broker/pkg/peer"
+)
+
+// Option дополнительная настройка обработчика NewHandler
+type Option func(*handlerOptions)
+
+type handlerOptions struct {
+	shedder  *LoadShedder
+	verifier *RequestVerifier
+	tokens   *TokenValidator
+	limiter  *RateLimiter
+	inflight *ConcurrencyLimiter
+	cluster  *cluster.Partitioner
+	cors     *CORS
+	access   *AccessList
+	// snapshots хранилище снимков для POST /admin/snapshot
+	snapshots objstore.Store
+	// keys источник набора ключей для POST /admin/keys/rotate
+	keys KeySource
+	// audit журнал аудита запросов (nil — не вести)
+	audit *audit.Logger
+	// compressMinSize минимальный размер сжимаемого ответа (0 — не сжимать)
+	compressMinSize int
+	// usage учет потребления по ключам для GET /admin/usage (nil — без
+	// суточных сводок на диск)
+	usage *UsageMeter
+	// restStatus коды ответов по смыслу REST (WithRESTStatusCodes)
+	restStatus bool
+	// maxMessageSize nil — ограничение по умолчанию
+	maxMessageSize *int64
+	// peerSecret общий секрет межброкерных запросов (пустой — они отклоняются)
+	peerSecret string
+	// consensus узел кластера Raft (nil — брокер не в кластерном режиме)
+	consensus *broker.Consensus
+	extra     map[string]http.Handler
+}
+
+// WithLoadShedder включает сброс нагрузки при постановке сообщений
+func WithLoadShedder(shedder *LoadShedder) Option {
+	return func(o *handlerOptions) { o.shedder = shedder }
+}
+
+// WithRequestVerifier требует подпись HMAC для запросов к очередям
+func WithRequestVerifier(verifier *RequestVerifier) Option {
+	return func(o *handlerOptions) { o.verifier = verifier }
+}
+
+// WithTokenValidator требует токен OAuth2/OIDC для запросов к очередям
+func WithTokenValidator(validator *TokenValidator) Option {
+	return func(o *handlerOptions) { o.tokens = validator }
+}
+
+// WithRateLimiter ограничивает скорость запросов к очередям
+func WithRateLimiter(limiter *RateLimiter) Option {
+	return func(o *handlerOptions) { o.limiter = limiter }
+}
+
+// WithConcurrencyLimiter ограничивает число одновременно обрабатываемых запросов
+func WithConcurrencyLimiter(limiter *ConcurrencyLimiter) Option {
+	return func(o *handlerOptions) { o.inflight = limiter }
+}
+
+// WithPartitioner распределяет очереди между узлами кластера: запросы
+// к чужим очередям пересылаются владельцу
+func WithPartitioner(p *cluster.Partitioner) Option {
+	return func(o *handlerOptions) { o.cluster = p }
+}
+
+// WithCORS разрешает запросы из браузера с других источников
+func WithCORS(cors *CORS) Option {
+	return func(o *handlerOptions) { o.cors = cors }
+}
+
+// WithAccessList отклоняет запросы с адресов, не разрешенных списками доступа
+func WithAccessList(access *AccessList) Option {
+	return func(o *handlerOptions) { o.access = access }
+}
+
+// WithSnapshots задает хранилище снимков брокера, записываемых по
+// POST /admin/snapshot
+func WithSnapshots(store objstore.Store) Option {
+	return func(o *handlerOptions) { o.snapshots = store }
+}
+
+// WithKeySource задает источник набора ключей шифрования при хранении,
+// перечитываемого по POST /admin/keys/rotate
+func WithKeySource(source KeySource) Option {
+	return func(o *handlerOptions) { o.keys = source }
+}
+
+// WithAuditLog записывает административные запросы (и, если журнал это
+// включает, постановку и получение сообщений) в журнал аудита
+func WithAuditLog(logger *audit.Logger) Option {
+	return func(o *handlerOptions) { o.audit = logger }
+}
+
+// WithCompression сжимает ответы не меньше minSize байт для клиентов,
+// принимающих gzip или deflate
+func WithCompression(minSize int) Option {
+	return func(o *handlerOptions) { o.compressMinSize = minSize }
+}
+
+// WithMaxMessageSize задает ограничение размера тела запроса к очереди в байтах
+// (по умолчанию DefaultMaxMessageSize); 0 снимает ограничение
+func WithMaxMessageSize(maxBytes int64) Option {
+	return func(o *handlerOptions) { o.maxMessageSize = &maxBytes }
+}
+
+// WithRESTStatusCodes включает коды ответов на получение сообщения по смыслу
+// REST: 404 для несуществующей очереди вместо 400 и 204 для очереди, в которой
+// сообщение не появилось за timeout, вместо 404 — и параметр create=true,
+// создающий очередь при получении. Без нее коды совместимы с прежними клиентами.
+func WithRESTStatusCodes() Option {
+	return func(o *handlerOptions) { o.restStatus = true }
+}
+
+// WithUsageMeter задает счетчик потребления по ключам API, например,
+// с записью суточных сводок на диск
+func WithUsageMeter(meter *UsageMeter) Option {
+	return func(o *handlerOptions) { o.usage = meter }
+}
+
+// WithPeerSecret задает общий секрет, без которого брокер не отдает поток
+// репликации, не выполняет переключение резерва, не принимает сообщения
+// других регионов и узлов кластера, не меняет состав кластера и не отвечает
+// на запросы узлов Raft (см. пакет peer)
+func WithPeerSecret(secret string) Option {
+	return func(o *handlerOptions) { o.peerSecret = secret }
+}
+
+// WithHandler добавляет маршрут, обслуживаемый сторонним обработчиком
+// (например, STOMP поверх WebSocket)
+func WithHandler(pattern string, handler http.Handler) Option {
+	return func(o *handlerOptions) {
+		if o.extra == nil {
+			o.extra = make(map[string]http.Handler)
+		}
+		o.extra[pattern] = handler
+	}
+}
+
+// NewHandler возвращает обработчик со всеми маршрутами HTTP API;
+// canary может быть nil, если самопроверка не используется
+func NewHandler(qb *broker.QueueBroker, canary *Canary, opts ...Option) http.Handler {
+	var o handlerOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.usage == nil {
+		o.usage = NewUsageMeter("")
+	}
+
+	maxMessageSize := int64(DefaultMaxMessageSize)
+	if o.maxMessageSize != nil {
+		maxMessageSize = *o.maxMessageSize
+	}
+
+	// authenticate проверяет подпись и токен запроса, если они включены
+	authenticate := func(next http.Handler) http.Handler {
+		return o.verifier.middleware(maxMessageSize, o.tokens.middleware(next))
+	}
+	// admin дополнительно требует права токена на служебные запросы и
+	// не пропускает арендаторов
+	admin := func(next http.Handler) http.Handler {
+		return limitBody(maxMessageSize, authenticate(rejectTenants(qb, requireAdmin(next))))
+	}
+	mux := http.NewServeMux()
+	queues := limitBody(maxMessageSize, o.shedder.middleware(authenticate(decompressBody(maxMessageSize, tenantHandler(qb, auditRequests(o.audit, o.limiter.middleware(QueueHandler(qb))))))))
+	mux.Handle("/queue/", deprecated(partitionMiddleware(qb, o.cluster, queues)))
+	mux.Handle("/ns/", deprecated(partitionMiddleware(qb, o.cluster, namespaceHandler(qb, queues))))
+	mux.Handle("/v1/", v1Handler(mux))
+	mux.Handle("/queues", authenticate(queuesHandler(qb)))
+	mux.Handle("/queues/receive", authenticate(receiveHandler(qb)))
+	mux.Handle("/queues/temporary", authenticate(auditRequests(o.audit, temporaryQueueHandler(qb))))
+	if o.cluster != nil {
+		mux.Handle("/cluster/nodes", peer.Require(o.peerSecret, o.cluster.NodesHandler()))
+		mux.Handle("/cluster/handoff", peer.Require(o.peerSecret, o.cluster.HandoffHandler()))
+	}
+	if o.consensus != nil {
+		mux.Handle("/raft/", peer.Require(o.peerSecret, o.consensus.Handler()))
+	}
+	mux.Handle("/federation/messages", peer.Require(o.peerSecret, FederationHandler(qb)))
+	mux.Handle(broker.ReplicationStreamMethod, peer.Require(o.peerSecret, ReplicationHandler(qb)))
+	mux.Handle("/replication/promote", peer.Require(o.peerSecret, PromoteHandler(qb)))
+	mux.Handle("/admin/snapshot", admin(auditRequests(o.audit, snapshotHandler(qb, o.snapshots))))
+	keys := admin(auditRequests(o.audit, keysHandler(qb, o.keys)))
+	mux.Handle("/admin/keys", keys)
+	mux.Handle("/admin/keys/", keys)
+	mux.Handle("/admin/usage", admin(usageHandler(o.usage)))
+	mux.Handle("/admin/debug/", debugOnAdminListener(admin(debugHandler(qb))))
+	mux.Handle("/publish", limitBody(maxMessageSize, o.shedder.middleware(authenticate(auditRequests(o.audit, publishHandler(qb))))))
+	mux.Handle("/transactions/", authenticate(auditRequests(o.audit, transactionHandler(qb))))
+	schedules := limitBody(maxMessageSize, authenticate(auditRequests(o.audit, scheduleHandler(qb))))
+	mux.Handle("/schedules", schedules)
+	mux.Handle("/schedules/", schedules)
+	mux.Handle("/healthz", HealthHandler(qb, canary))
+	mux.Handle("/metrics", metricsHandler(qb, canary, o))
+	mux.HandleFunc("/openapi.json", openAPIHandler)
+	mux.HandleFunc("/docs", docsHandler)
+	mux.HandleFunc("/ui", uiHandler)
+	for pattern, handler := range o.extra {
+		mux.Handle(pattern, handler)
+	}
+	if o.extra["/"] == nil {
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) { notFound(w) })
+	}
+	// Preflight-запросы не занимают места в лимите параллелизма; адрес
+	// клиента проверяется раньше всего остального, а запросы, пересылаемые
+	// лидеру кластера, обрабатывает он
+	return o.access.middleware(consensusMiddleware(o.consensus, o.cors.middleware(o.inflight.middleware(compressResponses(o.compressMinSize, withUsage(o.usage, withRESTStatus(o.restStatus, mux)))))))
+}
+
+// QueueHandler обрабатывает HTTP-запросы к очередям /queue/{name}[/подресурс]
+func QueueHandler(qb *broker.QueueBroker) http.HandlerFunc {
+	rt := newRouter()
+	// queue регистрирует подресурс sub очереди с проверкой прав на него
+	queue := func(sub string, handler func(w http.ResponseWriter, r *http.Request, queueName string), methods ...string) {
+		pattern := "/queue/{name}"
+		if sub != "" {
+			pattern += "/" + sub
+		}
+		rt.handleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+			queueName := r.PathValue("name")
+			if !surfaceAllowed(r, queueSurface(r, sub)) {
+				notFound(w)
+				return
+			}
+			if !tokenAllows(r, queueName, tokenPermission(r, sub)) {
+				httpError(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			if perm := requiredPermission(r, sub); perm != "" && !qb.Authorize(principal(r), queueName, perm) {
+				httpError(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			handler(w, r, queueName)
+		}, methods...)
+	}
+	with := func(handle func(*broker.QueueBroker, http.ResponseWriter, *http.Request, string)) func(http.ResponseWriter, *http.Request, string) {
+		return func(w http.ResponseWriter, r *http.Request, queueName string) { handle(qb, w, r, queueName) }
+	}
+
+	queue("", with(handlePut), http.MethodPut)
+	queue("", with(handleGet), http.MethodGet)
+	queue("config", with(handleQueueConfig), http.MethodGet, http.MethodPut)
+	for _, action := range []string{"complete", "renew", "abandon"} {
+		queue(action, func(w http.ResponseWriter, r *http.Request, queueName string) {
+			handleLockAction(qb, w, r, queueName, action)
+		}, http.MethodPost)
+	}
+	queue("stream", with(handleStream), http.MethodGet)
+	queue("aggregate", with(handleQueueAggregate), http.MethodGet)
+	queue("acl", with(handleQueueACL), http.MethodGet, http.MethodPut)
+	queue("owner", with(handleQueueOwner), http.MethodPut)
+	queue("audit", with(handleQueueAudit), http.MethodGet)
+	queue("archive", with(handleQueueArchive), http.MethodPost)
+	queue("schema", with(handleQueueSchema), http.MethodGet, http.MethodPut, http.MethodDelete)
+	queue("purge", with(handleQueuePurge), http.MethodPost)
+	for sub, pause := range map[string]bool{"pause": true, "resume": false} {
+		queue(sub, func(w http.ResponseWriter, r *http.Request, queueName string) {
+			handleQueuePause(qb, w, r, queueName, pause)
+		}, http.MethodPost)
+	}
+	queue("tail", with(handleTail), http.MethodGet)
+	queue("heartbeat", with(handleHeartbeat), http.MethodPost)
+	queue("consumers", with(handleQueueConsumers), http.MethodGet)
+	queue("scheduled", with(handleQueueScheduled), http.MethodGet)
+	queue("stats", with(handleQueueStats), http.MethodGet)
+	queue("export", with(handleQueueExport), http.MethodGet)
+	queue("import", with(handleQueueImport), http.MethodPost)
+	queue("offsets", with(handleQueueOffsets), http.MethodGet, http.MethodPost)
+	queue("messages", with(handleQueueBrowse), http.MethodGet)
+	queue("messages/{id}", func(w http.ResponseWriter, r *http.Request, queueName string) {
+		handleQueueMessage(qb, w, r, queueName, r.PathValue("id"), "")
+	}, http.MethodDelete)
+	queue("messages/{id}/requeue", func(w http.ResponseWriter, r *http.Request, queueName string) {
+		handleQueueMessage(qb, w, r, queueName, r.PathValue("id"), "requeue")
+	}, http.MethodPost)
+	return rt.ServeHTTP
+}
+
+// splitQueuePath делит путь /queue/{name}[/подресурс] на имя очереди и
+// подресурс (например, config или messages/{id}/requeue); завершающая косая
+// черта не учитывается
+func splitQueuePath(path string) (queueName, sub string) {
+	queueName, sub, _ = strings.Cut(strings.TrimSuffix(strings.TrimPrefix(path, "/queue/"), "/"), "/")
+	return queueName, sub
+}
+
+// handlePut обрабатывает PUT-запросы
+func handlePut(qb *broker.QueueBroker, w http.ResponseWriter, r *http.Request, queueName string) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	data, err := readBody(r.Body, *buf)
+	*buf = data
+	if err != nil {
+		bodyError(w, err)
+		return
+	}
+	requestBody := &broker.Message{}
+	if contentType, ok := rawContentType(r); ok {
+		if len(data) == 0 {
+			httpError(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+		requestBody = rawMessage(r, contentType, data)
+	} else if problem := parseEnvelope(qb, queueName, data, requestBody); problem != "" {
+		httpError(w, problem, http.StatusBadRequest)
+		return
+	}
+
+	if requestBody.DedupID == "" {
+		requestBody.DedupID = r.Header.Get("Idempotency-Key")
+	}
+	if requestBody.DeliverAt, err = delayParam(r); err != nil {
+		httpError(w, "Invalid delay", http.StatusBadRequest)
+		return
+	}
+	// Сколько ждать места в очереди с политикой overflow=block
+	timeout, err := timeoutParam(qb, r.URL.Query().Get("timeout"))
+	if err != nil {
+		httpError(w, "Invalid timeout", http.StatusBadRequest)
+		return
+	}
+
+	if txID := r.URL.Query().Get("tx"); txID != "" {
+		stageMessage(qb, w, r, txID, queueName, requestBody)
+		return
+	}
+	size := len(requestBody.Body)
+	if err := qb.EnqueueWait(queueName, requestBody, timeout); err != nil {
+		if errors.Is(err, broker.ErrDuplicate) {
+			// Повтор уже принятого сообщения считается успешным
+			w.Header().Set("X-Duplicate", "true")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		enqueueError(w, err)
+		return
+	}
+	countUsage(r, true, 1, size)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// parseEnvelope разбирает сообщение в формате PUT ({"message": ...} или
+// {"message_base64": ...}) в msg; непустой результат — текст ошибки для ответа 400
+func parseEnvelope(qb *broker.QueueBroker, queueName string, data []byte, msg *broker.Message) string {
+	// Декодер JSON молча заменяет некорректные последовательности на U+FFFD,
+	// поэтому UTF-8 проверяется до разбора
+	if !utf8.Valid(data) {
+		return "Invalid UTF-8"
+	}
+	var base64Body string
+	if !decodeEnvelope(data, msg, &base64Body) {
+		*msg = broker.Message{}
+		var err error
+		if base64Body, err = unmarshalEnvelope(data, msg); err != nil {
+			return "Bad request"
+		}
+	}
+	if (msg.Body == "") == (base64Body == "") {
+		return "Bad request"
+	}
+	if base64Body != "" {
+		body, err := base64.StdEncoding.DecodeString(base64Body)
+		if err != nil || len(body) == 0 {
+			return "Invalid base64"
+		}
+		msg.Body = string(body)
+		// Без явного типа двоичное тело получает тип очереди по умолчанию,
+		// а если его нет — application/octet-stream
+		if msg.ContentType == "" && qb.QueueConfig(queueName).DefaultContentType == "" {
+			msg.ContentType = binaryContentType
+		}
+	}
+	return ""
+}
+
+// enqueueError отвечает на ошибку постановки сообщения
+func enqueueError(w http.ResponseWriter, err error) {
+	// Незафиксированную в кластере или не записанную в журнал постановку
+	// клиент повторяет с тем же DedupID
+	if errors.Is(err, broker.ErrStandby) || errors.Is(err, broker.ErrNotCommitted) || errors.Is(err, broker.ErrNotPersisted) {
+		errorResponse(w, err, http.StatusServiceUnavailable)
+		return
+	}
+	if errors.Is(err, broker.ErrQueueArchiving) {
+		errorResponse(w, err, http.StatusConflict)
+		return
+	}
+	if schemaError(w, err) || capacityError(w, err) {
+		return
+	}
+	errorResponse(w, err, http.StatusBadRequest)
+}
+
+// handleGet обрабатывает GET-запросы
+func handleGet(qb *broker.QueueBroker, w http.ResponseWriter, r *http.Request, queueName string) {
+	// Параметры разбираются один раз: GET — самый частый запрос
+	query := r.URL.Query()
+	timeout, err := timeoutParam(qb, query.Get("timeout"))
+	if err != nil {
+		httpError(w, "Invalid timeout", http.StatusBadRequest)
+		return
+	}
+
+	forceBase64, err := base64Param(query)
+	if err != nil {
+		httpError(w, "Invalid encoding", http.StatusBadRequest)
+		return
+	}
+
+	if !createParam(qb, w, r, queueName) {
+		return
+	}
+
+	var msg any
+	correlationID, selector := query.Get("correlation_id"), query.Get("selector")
+	if correlationID != "" && selector != "" {
+		httpError(w, "Use either correlation_id or selector", http.StatusBadRequest)
+		return
+	}
+	mode := query.Get("mode")
+	if mode == "" && (query.Has("from_offset") || query.Has("from_time") || query.Has("since") || query.Has("group")) {
+		mode = logMode
+	}
+	switch mode {
+	case logMode:
+		handleLogRead(qb, w, r, queueName, query, timeout, forceBase64)
+		return
+	case "", "delete":
+		switch {
+		case correlationID != "":
+			msg, err = qb.DequeueCorrelated(queueName, correlationID, timeout)
+		case selector != "":
+			sel, selErr := broker.CompileSelector(selector)
+			if selErr != nil {
+				httpError(w, "Invalid selector: "+selErr.Error(), http.StatusBadRequest)
+				return
+			}
+			msg, err = qb.DequeueSelected(queueName, sel, timeout)
+		default:
+			msg, err = qb.Dequeue(queueName, timeout)
+		}
+	case "peeklock":
+		if correlationID != "" || selector != "" {
+			httpError(w, "Selective receive is not supported in peeklock mode", http.StatusBadRequest)
+			return
+		}
+		lockDuration, lockErr := lockDurationParam(qb, queueName, query.Get("lock_duration"))
+		if lockErr != nil {
+			httpError(w, "Invalid lock duration", http.StatusBadRequest)
+			return
+		}
+		msg, err = qb.PeekLockAs(queueName, query.Get("consumer"), timeout, lockDuration)
+	default:
+		httpError(w, "Invalid mode", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		dequeueError(w, r, err)
+		return
+	}
+
+	writeMessage(w, r, msg, forceBase64)
+}
+
+// timeoutParam читает timeout запроса на получение: число секунд или
+// длительность Go (250ms, 2m); без него — таймаут брокера по умолчанию
+func timeoutParam(qb *broker.QueueBroker, param string) (time.Duration, error) {
+	if param == "" {
+		return qb.DefaultTimeout(), nil
+	}
+	return broker.ParseTimeout(param)
+}
+
+// dequeueError отвечает на ошибку получения сообщения; с WithRESTStatusCodes
+// пустая после ожидания очередь получает 204, а несуществующая — 404
+func dequeueError(w http.ResponseWriter, r *http.Request, err error) {
+	rest := restStatusCodes(r)
+	if errors.Is(err, broker.ErrTimeout) && rest {
+		w.WriteHeader(http.StatusNoContent)
+	} else if errors.Is(err, broker.ErrTimeout) {
+		writeError(w, http.StatusNotFound, broker.ErrorCode(err), "Not found", nil)
+	} else if errors.Is(err, broker.ErrQueueNotFound) && rest {
+		writeError(w, http.StatusNotFound, broker.ErrorCode(err), "Queue does not exist", nil)
+	} else if errors.Is(err, broker.ErrQueueNotFound) {
+		writeError(w, http.StatusBadRequest, broker.ErrorCode(err), "Queue does not exist", nil)
+	} else if errors.Is(err, broker.ErrStandby) {
+		errorResponse(w, err, http.StatusServiceUnavailable)
+	} else if errors.Is(err, broker.ErrQueueArchiving) {
+		errorResponse(w, err, http.StatusConflict)
+	} else if errors.Is(err, broker.ErrTooManyConsumers) {
+		tooManyConsumers(w, err)
+	} else {
+		errorResponse(w, err, http.StatusBadRequest)
+	}
+}
+
+// writeMessage отвечает выданным сообщением (*broker.Message или
+// *broker.Delivery) в JSON или, если клиент просит, в сыром виде
+func writeMessage(w http.ResponseWriter, r *http.Request, msg any, forceBase64 bool) {
+	view := tenantView(r, msg)
+	switch v := view.(type) {
+	case *broker.Message:
+		countUsage(r, false, 1, len(v.Body))
+		if wantsRaw(r, v) {
+			writeRaw(w, v, nil)
+			return
+		}
+	case *broker.Delivery:
+		countUsage(r, false, 1, len(v.Body))
+		if wantsRaw(r, v.Message) {
+			writeRaw(w, v.Message, v)
+			return
+		}
+	}
+
+	var b []byte
+	buf := getBuffer()
+	defer putBuffer(buf)
+	switch v := view.(type) {
+	case *broker.Message:
+		b = appendMessageJSON(*buf, v, nil, forceBase64)
+	case *broker.Delivery:
+		b = appendMessageJSON(*buf, v.Message, v, forceBase64)
+	}
+	*buf = append(b, '\n')
+	w.Header()["Content-Type"] = jsonHeader
+	w.WriteHeader(http.StatusOK)
+	w.Write(*buf)
+}
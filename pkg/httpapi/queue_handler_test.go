@@ -0,0 +1,340 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"queue-broker/pkg/broker"
+)
+
+// requester возвращает функцию, выполняющую запрос к handler с методом,
+// адресом и телом
+func requester(handler http.Handler) func(method, target, body string) *httptest.ResponseRecorder {
+	return func(method, target, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return rr
+	}
+}
+
+// TestPutMessage проверяет корректность добавления сообщения в очередь
+func TestPutMessage(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+
+	// Создаем тестовый HTTP-запрос
+	body := map[string]string{"message": "test message"}
+	jsonBody, _ := json.Marshal(body)
+	req, err := http.NewRequest("PUT", "/queue/testQueue", bytes.NewBuffer(jsonBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Создаем ResponseRecorder для записи ответа
+	rr := httptest.NewRecorder()
+	handler := QueueHandler(qb)
+
+	// Выполняем запрос
+	handler.ServeHTTP(rr, req)
+
+	// Проверяем статус код
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	// Проверяем, что сообщение добавлено в очередь
+	message, err := qb.GetMessage("testQueue", time.Second)
+	if err != nil || message != "test message" {
+		t.Errorf("message was not added to the queue: %v", err)
+	}
+}
+
+// TestPutMessageInvalidBody проверяет обработку некорректного тела запроса
+func TestPutMessageInvalidBody(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+
+	// Создаем тестовый HTTP-запрос с некорректным телом
+	req, err := http.NewRequest("PUT", "/queue/testQueue", bytes.NewBuffer([]byte("invalid json")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handler := QueueHandler(qb)
+
+	handler.ServeHTTP(rr, req)
+
+	// Проверяем статус код
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	}
+}
+
+// TestGetMessage проверяет корректность извлечения сообщения из очереди
+func TestGetMessage(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+
+	// Добавляем сообщение в очередь
+	qb.PutMessage("testQueue", "test message")
+
+	// Создаем тестовый HTTP-запрос
+	req, err := http.NewRequest("GET", "/queue/testQueue", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handler := QueueHandler(qb)
+
+	handler.ServeHTTP(rr, req)
+
+	// Проверяем статус код
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	// Проверяем тело ответа
+	var response map[string]string
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if response["message"] != "test message" {
+		t.Errorf("handler returned unexpected body: got %v want %v", response["message"], "test message")
+	}
+}
+
+// TestGetMessageTimeout проверяет обработку таймаута при извлечении сообщения
+func TestGetMessageTimeout(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 1) // Таймаут 1 секунда
+
+	// Создаем пустую очередь
+	qb.PutMessage("testQueue", "test message")
+	qb.GetMessage("testQueue", time.Second)
+
+	// Создаем тестовый HTTP-запрос с таймаутом
+	req, err := http.NewRequest("GET", "/queue/testQueue?timeout=1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handler := QueueHandler(qb)
+
+	handler.ServeHTTP(rr, req)
+
+	// Проверяем статус код
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNotFound)
+	}
+}
+
+// TestGetMessageDurationTimeout проверяет timeout длительностью Go и его предел
+func TestGetMessageDurationTimeout(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 1)
+	qb.PutMessage("testQueue", "test message")
+	qb.GetMessage("testQueue", 0)
+	handler := QueueHandler(qb)
+	get := func(timeout string) (int, time.Duration) {
+		start := time.Now()
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/queue/testQueue?timeout="+timeout, nil))
+		return rr.Code, time.Since(start)
+	}
+
+	if status, elapsed := get("250ms"); status != http.StatusNotFound || elapsed < 250*time.Millisecond || elapsed > 900*time.Millisecond {
+		t.Errorf("250ms: got %d after %v", status, elapsed)
+	}
+	for _, timeout := range []string{"-1s", "later"} {
+		if status, _ := get(timeout); status != http.StatusBadRequest {
+			t.Errorf("%s: got %d", timeout, status)
+		}
+	}
+	qb.SetMaxTimeout(100 * time.Millisecond)
+	if status, elapsed := get("2m"); status != http.StatusNotFound || elapsed > 900*time.Millisecond {
+		t.Errorf("2m with max timeout: got %d after %v", status, elapsed)
+	}
+}
+
+// TestGetMessageCorrelationID проверяет получение ответа по correlation_id
+func TestGetMessageCorrelationID(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 1)
+	handler := QueueHandler(qb)
+	for _, id := range []string{"r1", "r2"} {
+		qb.Enqueue("replies", &broker.Message{Body: "reply " + id, Headers: map[string]string{broker.CorrelationIDHeader: id}})
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/queue/replies?correlation_id=r2&timeout=0", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "reply r2") {
+		t.Fatalf("unexpected response %d %s", rr.Code, rr.Body)
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/queue/replies?correlation_id=r2&timeout=0", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/queue/replies?correlation_id=r1&mode=peeklock", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 in peeklock mode, got %d", rr.Code)
+	}
+	if qb.Depth("replies") != 1 {
+		t.Errorf("unexpected depth %d", qb.Depth("replies"))
+	}
+}
+
+// TestGetMessageSelector проверяет получение по условию selector
+func TestGetMessageSelector(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 1)
+	handler := QueueHandler(qb)
+	qb.Enqueue("events", &broker.Message{Body: "created", Headers: map[string]string{"type": "order.created"}})
+	qb.Enqueue("events", &broker.Message{Body: "paid", Headers: map[string]string{"type": "order.paid"}})
+	get := func(query string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/queue/events?timeout=0&"+query, nil))
+		return rr
+	}
+
+	if rr := get(url.Values{"selector": {`headers.type == "order.paid"`}}.Encode()); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"paid"`) {
+		t.Fatalf("unexpected response %d %s", rr.Code, rr.Body)
+	}
+	if rr := get(url.Values{"selector": {"headers.type =="}}.Encode()); rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "Invalid selector") {
+		t.Errorf("unexpected response %d %s", rr.Code, rr.Body)
+	}
+	if rr := get("selector=true&correlation_id=x"); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for both filters, got %d", rr.Code)
+	}
+	if qb.Depth("events") != 1 {
+		t.Errorf("unexpected depth %d", qb.Depth("events"))
+	}
+}
+
+// TestGetMessageNonexistentQueue проверяет обработку запроса к несуществующей очереди
+func TestGetMessageNonexistentQueue(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+
+	// Создаем тестовый HTTP-запрос к несуществующей очереди; с ненулевым
+	// таймаутом запрос ждал бы ее создания
+	req, err := http.NewRequest("GET", "/queue/nonexistentQueue?timeout=0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handler := QueueHandler(qb)
+
+	handler.ServeHTTP(rr, req)
+
+	// Проверяем статус код
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	}
+}
+
+// TestPutMessageMaxQueues проверяет обработку превышения максимального количества очередей
+func TestPutMessageMaxQueues(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 1, 10) // Максимум 1 очередь
+
+	// Добавляем первую очередь
+	qb.PutMessage("queue1", "message1")
+
+	// Пытаемся добавить вторую очередь
+	body := map[string]string{"message": "message2"}
+	jsonBody, _ := json.Marshal(body)
+	req, err := http.NewRequest("PUT", "/queue/queue2", bytes.NewBuffer(jsonBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handler := QueueHandler(qb)
+
+	handler.ServeHTTP(rr, req)
+
+	// Брокер исчерпал место: 503 с Retry-After
+	if status := rr.Code; status != http.StatusServiceUnavailable {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusServiceUnavailable)
+	}
+	if rr.Header().Get("Retry-After") == "" {
+		t.Error("missing Retry-After")
+	}
+}
+
+// TestLatencySimulationConfig проверяет, что задержку выдачи можно задать,
+// только если имитация задержки включена
+func TestLatencySimulationConfig(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 1)
+	handler := NewHandler(qb, nil)
+	put := func() int {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("PUT", "/queue/slow/config", bytes.NewBufferString(`{"delivery_delay_ms": 200, "delivery_jitter_ms": 50}`)))
+		return rr.Code
+	}
+	if code := put(); code != http.StatusBadRequest {
+		t.Errorf("expected 400 with simulation disabled, got %d", code)
+	}
+	qb.SetLatencySimulation(true)
+	if code := put(); code != http.StatusOK {
+		t.Errorf("expected 200 with simulation enabled, got %d", code)
+	}
+	if cfg := qb.QueueConfig("slow"); cfg.DeliveryDelayMs != 200 || cfg.DeliveryJitterMs != 50 {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+}
+
+// TestTransformConfig проверяет проверку скрипта преобразования в настройках
+// очереди и отказ в постановке отклоненного им сообщения
+func TestTransformConfig(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 1)
+	handler := NewHandler(qb, nil)
+	do := requester(handler)
+
+	if rr := do("PUT", "/queue/orders/config", `{"transform": "payload.total >"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid transform, got %d", rr.Code)
+	}
+	transform := `{"transform": "payload.total < 0 ? {\"reject\": \"negative total\"} : {\"message\": merge(payload, {\"checked\": true})}"}`
+	if rr := do("PUT", "/queue/orders/config", transform); rr.Code != http.StatusOK {
+		t.Fatalf("unexpected config response: %d %s", rr.Code, rr.Body)
+	}
+	if rr := do("PUT", "/queue/orders", `{"message": "{\"total\": -1}"}`); rr.Code != http.StatusBadRequest || rr.Body.String() != `{"error":{"code":"MESSAGE_REJECTED","message":"message rejected by transform: negative total"}}`+"\n" {
+		t.Errorf("unexpected response for rejected message: %d %s", rr.Code, rr.Body)
+	}
+	if rr := do("PUT", "/queue/orders", `{"message": "{\"total\": 5}"}`); rr.Code != http.StatusOK {
+		t.Errorf("unexpected put response: %d %s", rr.Code, rr.Body)
+	}
+	if msg, err := qb.Dequeue("orders", 0); err != nil || msg.Body != `{"checked":true,"total":5}` {
+		t.Errorf("unexpected transformed message: %+v %v", msg, err)
+	}
+}
+
+// TestEnvelopeConfig проверяет формат сообщений envelope из настроек очереди
+func TestEnvelopeConfig(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 1)
+	handler := NewHandler(qb, nil)
+	do := requester(handler)
+
+	if rr := do("PUT", "/queue/work/config", `{"envelope": "rq"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for unknown envelope, got %d", rr.Code)
+	}
+	if rr := do("PUT", "/queue/work/config", `{"envelope": "celery"}`); rr.Code != http.StatusOK {
+		t.Fatalf("unexpected config response: %d %s", rr.Code, rr.Body)
+	}
+	if rr := do("PUT", "/queue/work", `{"message": "plain"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for non-task message, got %d %s", rr.Code, rr.Body)
+	}
+	if rr := do("PUT", "/queue/work", `{"message": "{\"task\": \"tasks.add\", \"args\": [1]}"}`); rr.Code != http.StatusOK {
+		t.Fatalf("unexpected put response: %d %s", rr.Code, rr.Body)
+	}
+	msg, err := qb.Dequeue("work", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task, err := broker.UnwrapCelery(msg.Body); err != nil || task.Task != "tasks.add" {
+		t.Errorf("unexpected delivered message %q: %v", msg.Body, err)
+	}
+}
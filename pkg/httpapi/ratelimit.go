@@ -0,0 +1,192 @@
+package httpapi
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"queue-broker/pkg/broker"
+	"queue-broker/pkg/signing"
+)
+
+// maxIdleBuckets число корзин ключей и очередей, после которого полные
+// (давно не использованные) корзины удаляются
+const maxIdleBuckets = 10000
+
+// RateLimit ограничение скорости: Rate запросов в секунду с запасом Burst
+// (по умолчанию равен Rate)
+type RateLimit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+// RateLimitConfig ограничения скорости запросов к очередям; незаданное
+// ограничение не проверяется
+type RateLimitConfig struct {
+	// Global общее ограничение на все запросы
+	Global *RateLimit `json:"global"`
+	// PerKey ограничение для каждого ключа клиента, Keys — для отдельных ключей
+	PerKey *RateLimit           `json:"per_key"`
+	Keys   map[string]RateLimit `json:"keys"`
+	// PerQueue ограничение для каждой очереди, Queues — для отдельных очередей
+	PerQueue *RateLimit           `json:"per_queue"`
+	Queues   map[string]RateLimit `json:"queues"`
+}
+
+// bucket корзина токенов
+type bucket struct {
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(limit RateLimit, now time.Time) *bucket {
+	if limit.Burst <= 0 {
+		limit.Burst = max(1, int(math.Ceil(limit.Rate)))
+	}
+	return &bucket{limit: limit, tokens: float64(limit.Burst), last: now}
+}
+
+// refill пополняет корзину и возвращает время до появления токена
+func (b *bucket) refill(now time.Time) time.Duration {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = min(float64(b.limit.Burst), b.tokens+elapsed.Seconds()*b.limit.Rate)
+		b.last = now
+	}
+	if b.tokens >= 1 {
+		return 0
+	}
+	if b.limit.Rate <= 0 {
+		return time.Hour
+	}
+	return time.Duration((1 - b.tokens) / b.limit.Rate * float64(time.Second))
+}
+
+// RateLimiter ограничивает скорость запросов к очередям корзинами токенов:
+// общей, по ключу клиента и по очереди. Запрос проходит, только если токен
+// есть во всех подходящих корзинах, иначе возвращается 429 с Retry-After.
+type RateLimiter struct {
+	cfg RateLimitConfig
+	now func() time.Time
+
+	mu      sync.Mutex
+	global  *bucket
+	clients map[string]*bucket
+	queues  map[string]*bucket
+
+	rejected atomic.Int64
+}
+
+// NewRateLimiter создает ограничитель по настройкам
+func NewRateLimiter(cfg RateLimitConfig) *RateLimiter {
+	return &RateLimiter{
+		cfg:     cfg,
+		now:     time.Now,
+		clients: make(map[string]*bucket),
+		queues:  make(map[string]*bucket),
+	}
+}
+
+// clientKey ключ клиента: токен арендатора или идентификатор ключа подписи
+func clientKey(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return token
+	}
+	return r.Header.Get(signing.KeyHeader)
+}
+
+// allow забирает по токену из всех подходящих корзин; при нехватке токены не
+// тратятся, а возвращается время ожидания
+func (l *RateLimiter) allow(client, queueName string) (bool, time.Duration) {
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var buckets []*bucket
+	if l.cfg.Global != nil {
+		if l.global == nil {
+			l.global = newBucket(*l.cfg.Global, now)
+		}
+		buckets = append(buckets, l.global)
+	}
+	if client != "" {
+		if b := l.bucketFor(l.clients, client, l.cfg.Keys, l.cfg.PerKey, now); b != nil {
+			buckets = append(buckets, b)
+		}
+	}
+	if b := l.bucketFor(l.queues, queueName, l.cfg.Queues, l.cfg.PerQueue, now); b != nil {
+		buckets = append(buckets, b)
+	}
+
+	var wait time.Duration
+	for _, b := range buckets {
+		wait = max(wait, b.refill(now))
+	}
+	if wait > 0 {
+		return false, wait
+	}
+	for _, b := range buckets {
+		b.tokens--
+	}
+	return true, 0
+}
+
+// bucketFor возвращает корзину для имени: из явных ограничений или из
+// ограничения по умолчанию; nil, если ограничения нет
+func (l *RateLimiter) bucketFor(buckets map[string]*bucket, name string, explicit map[string]RateLimit, fallback *RateLimit, now time.Time) *bucket {
+	if b, ok := buckets[name]; ok {
+		return b
+	}
+	limit, ok := explicit[name]
+	if !ok {
+		if fallback == nil {
+			return nil
+		}
+		limit = *fallback
+	}
+
+	if len(buckets) >= maxIdleBuckets {
+		for key, b := range buckets {
+			if b.refill(now); b.tokens >= float64(b.limit.Burst) {
+				delete(buckets, key)
+			}
+		}
+	}
+	b := newBucket(limit, now)
+	buckets[name] = b
+	return b
+}
+
+// middleware отклоняет запросы сверх ограничений с 429; служебная очередь
+// самопроверки не ограничивается
+func (l *RateLimiter) middleware(next http.Handler) http.Handler {
+	if l == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queueName, _ := splitQueuePath(r.URL.Path)
+		if queueName == broker.CanaryQueue {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if ok, wait := l.allow(clientKey(r), queueName); !ok {
+			l.rejected.Add(1)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			httpError(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeMetrics дописывает метрики ограничения скорости в формате Prometheus
+func (l *RateLimiter) writeMetrics(w io.Writer) {
+	fmt.Fprintln(w, "# TYPE queue_broker_rate_limited_requests_total counter")
+	fmt.Fprintf(w, "queue_broker_rate_limited_requests_total %d\n", l.rejected.Load())
+}
@@ -0,0 +1,87 @@
+package httpapi
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"queue-broker/pkg/broker"
+)
+
+// TestRateLimit проверяет ограничения по очереди и по ключу клиента,
+// ответ 429 с Retry-After и пополнение корзины со временем
+func TestRateLimit(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+	limiter := NewRateLimiter(RateLimitConfig{
+		PerKey: &RateLimit{Rate: 1, Burst: 2},
+		Queues: map[string]RateLimit{"jobs": {Rate: 1, Burst: 3}},
+	})
+	now := time.Unix(1_700_000_000, 0)
+	limiter.now = func() time.Time { return now }
+	handler := NewHandler(qb, nil, WithRateLimiter(limiter))
+
+	put := func(queueName, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PUT", "/queue/"+queueName, bytes.NewBufferString(`{"message": "job"}`))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for i := 0; i < 2; i++ {
+		if rr := put("jobs", "a"); rr.Code != http.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d", i, rr.Code)
+		}
+	}
+	rr := put("jobs", "a")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "1" {
+		t.Fatalf("expected 429 with Retry-After for exhausted key, got %d %q", rr.Code, rr.Header().Get("Retry-After"))
+	}
+
+	// Отказ по ключу не тратит токен очереди
+	if rr := put("jobs", "b"); rr.Code != http.StatusOK {
+		t.Errorf("expected other client to pass, got %d", rr.Code)
+	}
+	if rr := put("jobs", "c"); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("expected exhausted queue to be limited, got %d", rr.Code)
+	}
+	if rr := put("other", ""); rr.Code != http.StatusOK {
+		t.Errorf("expected unlimited queue to pass, got %d", rr.Code)
+	}
+
+	now = now.Add(time.Second)
+	if rr := put("jobs", "c"); rr.Code != http.StatusOK {
+		t.Errorf("expected request to pass after refill, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.Contains(rr.Body.String(), "queue_broker_rate_limited_requests_total 2") {
+		t.Errorf("missing rate limit metric:\n%s", rr.Body.String())
+	}
+}
+
+// TestRateLimitGlobal проверяет общее ограничение и исключение служебной очереди
+func TestRateLimitGlobal(t *testing.T) {
+	limiter := NewRateLimiter(RateLimitConfig{Global: &RateLimit{Rate: 1}})
+	limiter.now = func() time.Time { return time.Unix(0, 0) }
+
+	if ok, _ := limiter.allow("", "a"); !ok {
+		t.Fatal("expected first request to pass")
+	}
+	if ok, wait := limiter.allow("", "b"); ok || wait != time.Second {
+		t.Errorf("expected global limit with 1s wait, got %v %v", ok, wait)
+	}
+
+	handler := NewHandler(broker.NewQueueBroker(100, 10, 10), nil, WithRateLimiter(limiter))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("PUT", "/queue/"+broker.CanaryQueue, bytes.NewBufferString(`{"message": "ping"}`)))
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected canary queue to bypass rate limit, got %d", rr.Code)
+	}
+}
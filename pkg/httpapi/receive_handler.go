@@ -0,0 +1,62 @@
+package httpapi
+
+import (
+	"net/http"
+	"strings"
+
+	"queue-broker/pkg/broker"
+)
+
+// receiveHandler обрабатывает GET /queues/receive?names=a,b,c: получение
+// сообщения из любой из перечисленных очередей; поле queue ответа указывает,
+// из какой оно выдано
+func receiveHandler(qb *broker.QueueBroker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			httpError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		r, ok := withTenant(qb, w, r)
+		if !ok {
+			return
+		}
+		query := r.URL.Query()
+		timeout, err := timeoutParam(qb, query.Get("timeout"))
+		if err != nil {
+			httpError(w, "Invalid timeout", http.StatusBadRequest)
+			return
+		}
+		forceBase64, err := base64Param(query)
+		if err != nil {
+			httpError(w, "Invalid encoding", http.StatusBadRequest)
+			return
+		}
+
+		tenantID, multiTenant := r.Context().Value(tenantKey{}).(string)
+		names := strings.Split(query.Get("names"), ",")
+		for i, name := range names {
+			if multiTenant {
+				if name, err = broker.TenantQueueName(tenantID, name); err != nil {
+					httpError(w, "Invalid queue name", http.StatusBadRequest)
+					return
+				}
+			}
+			if name == "" || broker.IsPattern(name) {
+				httpError(w, "Invalid queue name", http.StatusBadRequest)
+				return
+			}
+			if !authorize(qb, r, name, broker.PermConsume) {
+				httpError(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			names[i] = name
+		}
+
+		msg, err := qb.DequeueAny(names, timeout)
+		if err != nil {
+			dequeueError(w, r, err)
+			return
+		}
+		writeMessage(w, r, msg, forceBase64)
+	}
+}
@@ -0,0 +1,38 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"queue-broker/pkg/broker"
+)
+
+// TestReceive проверяет получение из любой из перечисленных очередей
+func TestReceive(t *testing.T) {
+	qb := broker.NewQueueBroker(10, 10, 10)
+	handler := NewHandler(qb, nil)
+	receive := func(query string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/queues/receive?"+query, nil))
+		return rr
+	}
+
+	qb.PutMessage("b", "hello")
+	rr := receive("names=a,b,c&timeout=0")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"queue":"b"`) || !strings.Contains(rr.Body.String(), "hello") {
+		t.Fatalf("unexpected response %d %s", rr.Code, rr.Body)
+	}
+	if rr := receive("names=a,b&timeout=0"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for empty queues, got %d", rr.Code)
+	}
+	if rr := receive("names=x,y&timeout=0"); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for missing queues, got %d", rr.Code)
+	}
+	for _, query := range []string{"", "names=a,,b", "names=orders.*", "names=a&timeout=-1"} {
+		if rr := receive(query); rr.Code != http.StatusBadRequest {
+			t.Errorf("%q: unexpected status %d", query, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package httpapi
+
+import (
+	"net/http"
+	"strings"
+
+	"queue-broker/pkg/broker"
+	"queue-broker/pkg/rpc"
+)
+
+// ReplicationHandler обслуживает вызов gRPC
+// queuebroker.replication.v1.Replication/Stream (broker.ReplicationStreamMethod):
+// ведомому брокеру передается текущее состояние очередей, а затем изменения
+// по мере их появления. Вызов возможен только по HTTP/2.
+func ReplicationHandler(qb *broker.QueueBroker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			httpError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !strings.HasPrefix(r.Header.Get("Content-Type"), rpc.ContentType) {
+			httpError(w, "Unsupported media type", http.StatusUnsupportedMediaType)
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if r.ProtoMajor != 2 || !ok {
+			httpError(w, "HTTP/2 required", http.StatusHTTPVersionNotSupported)
+			return
+		}
+		// StreamRequest не содержит полей
+		if _, err := rpc.ReadMessage(r.Body, rpc.DefaultMaxMessageSize); err != nil {
+			rpc.Finish(w, rpc.InvalidArgument, "invalid request", false)
+			return
+		}
+
+		feed := qb.Replicate()
+		defer feed.Close()
+
+		rpc.StartResponse(w)
+		send := func(op broker.ReplicationOp) bool {
+			data, err := op.MarshalBinary()
+			return err == nil && rpc.WriteMessage(w, data) == nil
+		}
+		for _, op := range feed.Initial {
+			if !send(op) {
+				return
+			}
+		}
+		flusher.Flush()
+
+		for {
+			select {
+			case op, ok := <-feed.Ops:
+				if !ok {
+					// Ведомый не успевал: после переподключения он получит состояние заново
+					rpc.Finish(w, rpc.Unavailable, "follower is too slow", true)
+					return
+				}
+				if !send(op) {
+					return
+				}
+				// Накопившиеся операции отправляются одной записью
+				for drained := false; !drained; {
+					select {
+					case op, ok := <-feed.Ops:
+						if !ok {
+							rpc.Finish(w, rpc.Unavailable, "follower is too slow", true)
+							return
+						}
+						if !send(op) {
+							return
+						}
+					default:
+						drained = true
+					}
+				}
+				flusher.Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}
+}
+
+// PromoteHandler обрабатывает POST /replication/promote: ведомый брокер
+// прекращает получать журнал и начинает обслуживать клиентов
+func PromoteHandler(qb *broker.QueueBroker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			httpError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := qb.Promote(); err != nil {
+			errorResponse(w, err, http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
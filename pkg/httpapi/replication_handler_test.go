@@ -0,0 +1,116 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"queue-broker/pkg/broker"
+	"queue-broker/pkg/peer"
+)
+
+// waitFor ждет выполнения условия не дольше двух секунд
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); !cond(); {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// newH2CServer запускает тестовый сервер с HTTP/2 без TLS, как NewServer
+func newH2CServer(handler http.Handler) *httptest.Server {
+	server := httptest.NewUnstartedServer(handler)
+	server.Config = NewServer("", handler, ServerConfig{})
+	server.Start()
+	return server
+}
+
+// peerRequest запрос другого брокера с общим секретом "s3cret"
+func peerRequest(method, target string) *http.Request {
+	req := httptest.NewRequest(method, target, nil)
+	peer.Sign(req, "s3cret")
+	return req
+}
+
+// TestReplicationFailover проверяет передачу состояния ведомому по gRPC
+// и переключение ведомого в основной
+func TestReplicationFailover(t *testing.T) {
+	primary := broker.NewQueueBroker(100, 10, 1)
+	primary.Enqueue("jobs", &broker.Message{Body: "first"})
+	server := newH2CServer(NewHandler(primary, nil, WithPeerSecret("s3cret")))
+	defer server.Close()
+
+	standby := broker.NewQueueBroker(100, 10, 1)
+	follower := broker.NewFollower(server.URL)
+	follower.SetPeerSecret("s3cret")
+	standby.SetFollower(follower)
+	defer follower.Close()
+	handler := NewHandler(standby, nil, WithPeerSecret("s3cret"))
+
+	waitFor(t, "initial state", func() bool { return standby.Depth("jobs") == 1 })
+	primary.Enqueue("jobs", &broker.Message{Body: "second"})
+	primary.Dequeue("jobs", 0)
+	waitFor(t, "replicated operations", func() bool {
+		return standby.Depth("jobs") == 1 && standby.QueueBytes("jobs") == int64(len("second"))
+	})
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/queue/jobs?timeout=0", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 from standby, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/replication/promote", nil))
+	if rr.Code != http.StatusUnauthorized || !standby.Standby() {
+		t.Fatalf("expected unauthenticated promote to be rejected, got %d", rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, peerRequest("POST", "/replication/promote"))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("promote failed: %d %s", rr.Code, rr.Body)
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/queue/jobs?timeout=0", nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != "{\"message\":\"second\",\"queue\":\"jobs\"}\n" {
+		t.Errorf("unexpected response after promote: %d %s", rr.Code, rr.Body)
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, peerRequest("POST", "/replication/promote"))
+	if rr.Code != http.StatusConflict {
+		t.Errorf("expected 409 for repeated promote, got %d", rr.Code)
+	}
+}
+
+// TestReplicationRequiresPeerSecret проверяет, что поток репликации не
+// отдается без общего секрета брокеров
+func TestReplicationRequiresPeerSecret(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 1)
+	qb.Enqueue("jobs", &broker.Message{Body: "secret"})
+	for name, handler := range map[string]http.Handler{
+		"configured":     NewHandler(qb, nil, WithPeerSecret("s3cret")),
+		"not configured": NewHandler(qb, nil),
+	} {
+		for _, req := range []*http.Request{
+			httptest.NewRequest("POST", broker.ReplicationStreamMethod, nil),
+			func() *http.Request {
+				req := httptest.NewRequest("POST", broker.ReplicationStreamMethod, nil)
+				peer.Sign(req, "guess")
+				return req
+			}(),
+		} {
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != http.StatusUnauthorized {
+				t.Errorf("%s: expected 401 without the peer secret, got %d %s", name, rr.Code, rr.Body)
+			}
+		}
+	}
+	if qb.Followers() != 0 {
+		t.Errorf("rejected request must not open a replication feed")
+	}
+}
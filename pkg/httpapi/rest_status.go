@@ -0,0 +1,55 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"queue-broker/pkg/broker"
+)
+
+type restStatusKey struct{}
+
+// withRESTStatus передает обработчикам запросов, что включены коды ответов
+// WithRESTStatusCodes
+func withRESTStatus(enabled bool, next http.Handler) http.Handler {
+	if !enabled {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), restStatusKey{}, true)))
+	})
+}
+
+// restStatusCodes сообщает, отвечать ли на запрос кодами WithRESTStatusCodes
+func restStatusCodes(r *http.Request) bool {
+	enabled, _ := r.Context().Value(restStatusKey{}).(bool)
+	return enabled
+}
+
+// createParam обрабатывает параметр create=true запроса на получение:
+// создает очередь queueName, если ее нет. Возвращает false, если на запрос
+// уже отвечено ошибкой.
+func createParam(qb *broker.QueueBroker, w http.ResponseWriter, r *http.Request, queueName string) bool {
+	switch r.URL.Query().Get("create") {
+	case "", "false":
+		return true
+	case "true":
+	default:
+		httpError(w, "Parameter create must be true or false", http.StatusBadRequest)
+		return false
+	}
+	if !restStatusCodes(r) {
+		httpError(w, "Parameter create requires --rest-status-codes", http.StatusBadRequest)
+		return false
+	}
+	if err := qb.CreateQueue(queueName); errors.Is(err, broker.ErrQueueNotFound) {
+		// Временная очередь после удаления не создается заново
+		dequeueError(w, r, err)
+		return false
+	} else if err != nil {
+		enqueueError(w, err)
+		return false
+	}
+	return true
+}
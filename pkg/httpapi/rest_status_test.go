@@ -0,0 +1,61 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"queue-broker/pkg/broker"
+)
+
+// TestRESTStatusCodes проверяет коды ответов на получение с WithRESTStatusCodes
+// и создание очереди параметром create
+func TestRESTStatusCodes(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 2, 10)
+	rest := NewHandler(qb, nil, WithRESTStatusCodes())
+	legacy := NewHandler(qb, nil)
+	do := func(handler http.Handler, method, target string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(method, target, strings.NewReader(`{"message": "x"}`)))
+		return rr
+	}
+
+	if rr := do(rest, http.MethodGet, "/queue/missing?timeout=0"); rr.Code != http.StatusNotFound || !strings.Contains(rr.Body.String(), "QUEUE_NOT_FOUND") {
+		t.Errorf("missing queue: got %d %s", rr.Code, rr.Body)
+	}
+	if rr := do(legacy, http.MethodGet, "/queue/missing?timeout=0"); rr.Code != http.StatusBadRequest {
+		t.Errorf("legacy missing queue: got %d", rr.Code)
+	}
+	if rr := do(legacy, http.MethodGet, "/queue/missing?create=true"); rr.Code != http.StatusBadRequest {
+		t.Errorf("create without flag: got %d", rr.Code)
+	}
+	if rr := do(rest, http.MethodGet, "/queue/missing?create=maybe"); rr.Code != http.StatusBadRequest {
+		t.Errorf("invalid create: got %d", rr.Code)
+	}
+
+	// Созданная очередь пуста: по истечении timeout ответ 204 без тела
+	if rr := do(rest, http.MethodGet, "/queue/jobs?create=true&timeout=0"); rr.Code != http.StatusNoContent || rr.Body.Len() != 0 {
+		t.Errorf("created queue: got %d %q", rr.Code, rr.Body)
+	}
+	if !slices.Contains(qb.QueueNames(), "jobs") {
+		t.Error("queue jobs was not created")
+	}
+	if rr := do(legacy, http.MethodGet, "/queue/jobs?timeout=0"); rr.Code != http.StatusNotFound {
+		t.Errorf("legacy empty queue: got %d", rr.Code)
+	}
+	do(rest, http.MethodPut, "/queue/jobs")
+	if rr := do(rest, http.MethodGet, "/queue/jobs?create=true"); rr.Code != http.StatusOK {
+		t.Errorf("existing queue: got %d", rr.Code)
+	}
+
+	// Создание упирается в ограничение числа очередей, как и постановка
+	do(rest, http.MethodPut, "/queue/other")
+	if rr := do(rest, http.MethodGet, "/queue/third?create=true&timeout=0"); rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("too many queues: got %d", rr.Code)
+	}
+	if rr := do(rest, http.MethodGet, "/queue/jobs.*?create=true"); rr.Code != http.StatusBadRequest {
+		t.Errorf("pattern: got %d", rr.Code)
+	}
+}
@@ -0,0 +1,130 @@
+package httpapi
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// router сопоставляет запросы шаблонам путей вида /queue/{name}/config.
+// Сегмент {param} совпадает с одним непустым сегментом пути, его значение
+// доступно обработчику через r.PathValue; завершающая косая черта в пути
+// не учитывается. Шаблоны проверяются в порядке регистрации, поэтому
+// литеральные сегменты регистрируются раньше параметров на том же месте.
+// Если путь совпал, а метод нет, ответ — 405 с заголовком Allow, иначе 404.
+type router struct {
+	routes []*route
+}
+
+// maxPathParams наибольшее число параметров в шаблоне
+const maxPathParams = 4
+
+type route struct {
+	pattern  string
+	segments []string
+	// handlers обработчики по методам; пустой метод — любой другой метод
+	handlers map[string]http.Handler
+	methods  []string
+}
+
+type pathParam struct {
+	name, value string
+}
+
+func newRouter() *router {
+	return &router{}
+}
+
+// handle регистрирует обработчик метода method для шаблона pattern;
+// пустой method обрабатывает все методы, для которых нет своего обработчика
+func (rt *router) handle(method, pattern string, handler http.Handler) {
+	var rte *route
+	for _, candidate := range rt.routes {
+		if candidate.pattern == pattern {
+			rte = candidate
+			break
+		}
+	}
+	if rte == nil {
+		rte = &route{pattern: pattern, handlers: make(map[string]http.Handler)}
+		params := 0
+		for _, segment := range strings.Split(strings.Trim(pattern, "/"), "/") {
+			if strings.HasPrefix(segment, "{") {
+				if params++; params > maxPathParams {
+					panic("httpapi: too many path parameters in " + pattern)
+				}
+			}
+			rte.segments = append(rte.segments, segment)
+		}
+		rt.routes = append(rt.routes, rte)
+	}
+	if _, ok := rte.handlers[method]; ok {
+		panic("httpapi: duplicate route " + method + " " + pattern)
+	}
+	rte.handlers[method] = handler
+	if method != "" {
+		rte.methods = append(rte.methods, method)
+	}
+}
+
+// handleFunc регистрирует функцию-обработчик для нескольких методов
+func (rt *router) handleFunc(pattern string, handler http.HandlerFunc, methods ...string) {
+	for _, method := range methods {
+		rt.handle(method, pattern, handler)
+	}
+}
+
+// match сопоставляет путь шаблону, заполняя params; возвращает число параметров
+// или -1, если путь не совпал
+func (rte *route) match(path string, params *[maxPathParams]pathParam) int {
+	path = strings.TrimSuffix(strings.TrimPrefix(path, "/"), "/")
+	n := 0
+	for i, segment := range rte.segments {
+		value, rest, more := strings.Cut(path, "/")
+		if more && i == len(rte.segments)-1 {
+			return -1
+		}
+		if name, ok := strings.CutPrefix(segment, "{"); ok {
+			if value == "" {
+				return -1
+			}
+			params[n] = pathParam{name: strings.TrimSuffix(name, "}"), value: value}
+			n++
+		} else if value != segment {
+			return -1
+		}
+		path = rest
+	}
+	return n
+}
+
+func (rt *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var params [maxPathParams]pathParam
+	var allowed []string
+	for _, rte := range rt.routes {
+		n := rte.match(r.URL.Path, &params)
+		if n < 0 {
+			continue
+		}
+		handler, ok := rte.handlers[r.Method]
+		if !ok {
+			handler, ok = rte.handlers[""]
+		}
+		if !ok {
+			allowed = append(allowed, rte.methods...)
+			continue
+		}
+		for _, p := range params[:n] {
+			r.SetPathValue(p.name, p.value)
+		}
+		handler.ServeHTTP(w, r)
+		return
+	}
+	if len(allowed) == 0 {
+		notFound(w)
+		return
+	}
+	slices.Sort(allowed)
+	w.Header().Set("Allow", strings.Join(slices.Compact(allowed), ", "))
+	httpError(w, "Method not allowed", http.StatusMethodNotAllowed)
+}
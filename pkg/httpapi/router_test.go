@@ -0,0 +1,72 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"queue-broker/pkg/broker"
+)
+
+// TestRouter проверяет параметры пути, порядок шаблонов, завершающую косую
+// черту и различие ответов 404 и 405
+func TestRouter(t *testing.T) {
+	rt := newRouter()
+	echo := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Method + " " + r.PathValue("name") + " " + r.PathValue("id")))
+	}
+	rt.handleFunc("/queue/{name}/messages/head", echo, http.MethodDelete)
+	rt.handleFunc("/queue/{name}/messages/{id}", echo, http.MethodDelete, http.MethodPost)
+	rt.handleFunc("/queue/{name}", echo, http.MethodGet, http.MethodPut)
+	rt.handleFunc("/any/{name}", echo, "")
+
+	for _, tc := range []struct {
+		method, target string
+		code           int
+		body, allow    string
+	}{
+		{http.MethodGet, "/queue/jobs", http.StatusOK, "GET jobs ", ""},
+		{http.MethodPut, "/queue/jobs/", http.StatusOK, "PUT jobs ", ""},
+		{http.MethodDelete, "/queue/jobs/messages/head", http.StatusOK, "DELETE jobs ", ""},
+		{http.MethodPost, "/queue/jobs/messages/7", http.StatusOK, "POST jobs 7", ""},
+		{http.MethodPatch, "/any/jobs", http.StatusOK, "PATCH jobs ", ""},
+		{http.MethodDelete, "/queue/jobs", http.StatusMethodNotAllowed, "", "GET, PUT"},
+		{http.MethodGet, "/queue/jobs/messages/head", http.StatusMethodNotAllowed, "", "DELETE, POST"},
+		{http.MethodGet, "/queue/", http.StatusNotFound, "", ""},
+		{http.MethodGet, "/queue/jobs/unknown", http.StatusNotFound, "", ""},
+		{http.MethodGet, "/queue/jobs/messages/7/extra", http.StatusNotFound, "", ""},
+	} {
+		rr := httptest.NewRecorder()
+		rt.ServeHTTP(rr, httptest.NewRequest(tc.method, tc.target, nil))
+		if rr.Code != tc.code || rr.Header().Get("Allow") != tc.allow {
+			t.Errorf("%s %s: expected %d (Allow %q), got %d (Allow %q)", tc.method, tc.target, tc.code, tc.allow, rr.Code, rr.Header().Get("Allow"))
+		}
+		if tc.body != "" && rr.Body.String() != tc.body {
+			t.Errorf("%s %s: expected body %q, got %q", tc.method, tc.target, tc.body, rr.Body)
+		}
+	}
+}
+
+// TestQueueHandlerRouting проверяет подресурсы очереди с завершающей косой
+// чертой и ответ 405 с перечнем допустимых методов
+func TestQueueHandlerRouting(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+	handler := QueueHandler(qb)
+	do := requester(handler)
+
+	if rr := do(http.MethodPut, "/queue/jobs/", `{"message": "job"}`); rr.Code != http.StatusOK || qb.Depth("jobs") != 1 {
+		t.Fatalf("trailing slash is not ignored: %d, depth %d", rr.Code, qb.Depth("jobs"))
+	}
+	if rr := do(http.MethodGet, "/queue/jobs/config/", ""); rr.Code != http.StatusOK {
+		t.Errorf("subresource with trailing slash: %d", rr.Code)
+	}
+	if rr := do(http.MethodDelete, "/queue/jobs/config", ""); rr.Code != http.StatusMethodNotAllowed || rr.Header().Get("Allow") != "GET, PUT" {
+		t.Errorf("unexpected response: %d, Allow %q", rr.Code, rr.Header().Get("Allow"))
+	}
+	if rr := do(http.MethodGet, "/queue/jobs/unknown", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("unknown subresource should get 404, got %d", rr.Code)
+	}
+	if rr := do(http.MethodDelete, "/queue/jobs/messages/abc", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("invalid message id should get 404, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,98 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+
+	"queue-broker/pkg/broker"
+)
+
+// scheduleHandler обрабатывает расписания постановки сообщений:
+// GET /schedules — список, POST /schedules — создать или заменить расписание
+// с тем же id, GET, PUT и DELETE /schedules/{id} — одно расписание. Расписание
+// доступно субъекту, которому разрешено ставить сообщения в его очередь.
+func scheduleHandler(qb *broker.QueueBroker) http.Handler {
+	rt := newRouter()
+	rt.handleFunc("/schedules", func(w http.ResponseWriter, r *http.Request) {
+		schedules := slices.DeleteFunc(qb.Schedules(), func(s broker.Schedule) bool {
+			return !authorize(qb, r, s.Queue, broker.PermProduce)
+		})
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string][]broker.Schedule{"schedules": schedules})
+	}, http.MethodGet)
+	rt.handleFunc("/schedules", func(w http.ResponseWriter, r *http.Request) {
+		saveSchedule(qb, w, r, "")
+	}, http.MethodPost)
+	rt.handleFunc("/schedules/{id}", func(w http.ResponseWriter, r *http.Request) {
+		s, ok := allowedSchedule(qb, w, r, r.PathValue("id"))
+		if !ok {
+			return
+		}
+		writeSchedule(w, http.StatusOK, s)
+	}, http.MethodGet)
+	rt.handleFunc("/schedules/{id}", func(w http.ResponseWriter, r *http.Request) {
+		saveSchedule(qb, w, r, r.PathValue("id"))
+	}, http.MethodPut)
+	rt.handleFunc("/schedules/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := allowedSchedule(qb, w, r, r.PathValue("id")); !ok {
+			return
+		}
+		if !qb.DeleteSchedule(r.PathValue("id")) {
+			httpError(w, "Schedule not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}, http.MethodDelete)
+	return rt
+}
+
+// allowedSchedule возвращает расписание id, если субъекту запроса разрешено
+// ставить сообщения в его очередь; иначе отвечает 404 или 403
+func allowedSchedule(qb *broker.QueueBroker, w http.ResponseWriter, r *http.Request, id string) (broker.Schedule, bool) {
+	s, ok := qb.GetSchedule(id)
+	if !ok {
+		httpError(w, "Schedule not found", http.StatusNotFound)
+		return s, false
+	}
+	if !authorize(qb, r, s.Queue, broker.PermProduce) {
+		httpError(w, "Forbidden", http.StatusForbidden)
+		return s, false
+	}
+	return s, true
+}
+
+// saveSchedule разбирает расписание из тела запроса; id из пути заменяет
+// id из тела. Новое расписание получает 201, замененное — 200.
+func saveSchedule(qb *broker.QueueBroker, w http.ResponseWriter, r *http.Request, id string) {
+	var s broker.Schedule
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		bodyError(w, err)
+		return
+	}
+	if id != "" {
+		s.ID = id
+	}
+	// Заменить можно только доступное расписание и только на доступную очередь
+	if old, ok := qb.GetSchedule(s.ID); (ok && !authorize(qb, r, old.Queue, broker.PermProduce)) || (s.Queue != "" && !authorize(qb, r, s.Queue, broker.PermProduce)) {
+		httpError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	saved, created, err := qb.SetSchedule(s)
+	if err != nil {
+		httpError(w, "Invalid schedule: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	code := http.StatusOK
+	if created {
+		code = http.StatusCreated
+	}
+	writeSchedule(w, code, saved)
+}
+
+func writeSchedule(w http.ResponseWriter, code int, s broker.Schedule) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(s)
+}
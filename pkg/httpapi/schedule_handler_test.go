@@ -0,0 +1,53 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"queue-broker/pkg/broker"
+)
+
+// TestScheduleHandler проверяет создание, замену, просмотр и удаление
+// расписаний через API
+func TestScheduleHandler(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 1)
+	handler := NewHandler(qb, nil)
+	do := requester(handler)
+
+	rr := do("POST", "/schedules", `{"cron": "@hourly", "queue": "heartbeats", "message": "ping {{.Time.Unix}}"}`)
+	var created broker.Schedule
+	if rr.Code != http.StatusCreated || json.Unmarshal(rr.Body.Bytes(), &created) != nil || created.ID == "" || created.Next.Minute() != 0 {
+		t.Fatalf("unexpected create response: %d %s", rr.Code, rr.Body)
+	}
+	if rr := do("PUT", "/schedules/"+created.ID, `{"cron": "@daily", "queue": "heartbeats", "message": "ping"}`); rr.Code != http.StatusOK {
+		t.Errorf("unexpected replace response: %d %s", rr.Code, rr.Body)
+	}
+	if rr := do("PUT", "/schedules/nightly", `{"cron": "0 3 * * *", "queue": "reports", "message": "build"}`); rr.Code != http.StatusCreated {
+		t.Errorf("unexpected put response: %d %s", rr.Code, rr.Body)
+	}
+	if rr := do("GET", "/schedules/nightly", ""); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"queue":"reports"`) {
+		t.Errorf("unexpected get response: %d %s", rr.Code, rr.Body)
+	}
+	var list struct {
+		Schedules []broker.Schedule `json:"schedules"`
+	}
+	if rr := do("GET", "/schedules", ""); rr.Code != http.StatusOK || json.Unmarshal(rr.Body.Bytes(), &list) != nil || len(list.Schedules) != 2 {
+		t.Errorf("unexpected list response: %d %s", rr.Code, rr.Body)
+	}
+
+	if rr := do("POST", "/schedules", `{"cron": "61 * * * *", "queue": "q", "message": "m"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid cron, got %d", rr.Code)
+	}
+	if rr := do("POST", "/schedules", `{`); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid body, got %d", rr.Code)
+	}
+	if rr := do("DELETE", "/schedules/nightly", ""); rr.Code != http.StatusNoContent {
+		t.Errorf("unexpected delete response: %d", rr.Code)
+	}
+	if rr := do("GET", "/schedules/nightly", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 after delete, got %d", rr.Code)
+	}
+	qb.DeleteSchedule(created.ID)
+}
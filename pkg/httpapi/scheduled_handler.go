@@ -0,0 +1,60 @@
+package httpapi
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"queue-broker/pkg/broker"
+)
+
+// binaryScheduled представление отложенного сообщения с телом в base64
+type binaryScheduled struct {
+	broker.ScheduledMessage
+	Body   string `json:"message,omitempty"`
+	Base64 string `json:"message_base64"`
+}
+
+// delayParam разбирает параметр delay запроса PUT: задержку выдачи в секундах
+func delayParam(r *http.Request) (time.Time, error) {
+	seconds, err := intParam(r, "delay", 0)
+	if err != nil || seconds == 0 {
+		return time.Time{}, err
+	}
+	return time.Now().Add(time.Duration(seconds) * time.Second), nil
+}
+
+// handleQueueScheduled обрабатывает GET /queue/{name}/scheduled: отложенные
+// сообщения очереди, их порядок, срок выдачи и оставшаяся задержка
+func handleQueueScheduled(qb *broker.QueueBroker, w http.ResponseWriter, r *http.Request, queueName string) {
+	if r.Method != http.MethodGet {
+		httpError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	forceBase64, err := base64Param(r.URL.Query())
+	if err != nil {
+		httpError(w, "Invalid encoding", http.StatusBadRequest)
+		return
+	}
+
+	scheduled, err := qb.Scheduled(queueName)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errorCode(err, http.StatusBadRequest), "Queue does not exist", nil)
+		return
+	}
+	views := make([]any, len(scheduled))
+	for i, s := range scheduled {
+		if msg, ok := tenantView(r, s.Message).(*broker.Message); ok {
+			s.Message = msg
+		}
+		views[i] = s
+		if forceBase64 || isBinary(s.Message) {
+			views[i] = &binaryScheduled{ScheduledMessage: s, Base64: base64.StdEncoding.EncodeToString([]byte(s.Body))}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{"messages": views})
+}
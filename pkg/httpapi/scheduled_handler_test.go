@@ -0,0 +1,59 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"queue-broker/pkg/broker"
+)
+
+// TestScheduledHandler проверяет постановку с задержкой и список отложенных сообщений
+func TestScheduledHandler(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 1)
+	handler := NewHandler(qb, nil)
+	do := requester(handler)
+
+	if rr := do("PUT", "/queue/jobs?delay=soon", `{"message": "x"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid delay, got %d", rr.Code)
+	}
+	if rr := do("PUT", "/queue/jobs?delay=60", `{"message": "first"}`); rr.Code != http.StatusOK {
+		t.Fatalf("unexpected PUT status %d", rr.Code)
+	}
+	if rr := do("PUT", "/queue/jobs?delay=30", `{"message": "second"}`); rr.Code != http.StatusOK {
+		t.Fatalf("unexpected PUT status %d", rr.Code)
+	}
+	if rr := do("GET", "/queue/jobs", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("delayed message delivered early: %d %s", rr.Code, rr.Body)
+	}
+
+	rr := do("GET", "/queue/jobs/scheduled", "")
+	var response struct {
+		Messages []struct {
+			Message        string  `json:"message"`
+			Position       int     `json:"position"`
+			DeliverAt      string  `json:"deliver_at"`
+			RemainingDelay float64 `json:"remaining_delay"`
+		} `json:"messages"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("unexpected scheduled response: %d %v", rr.Code, err)
+	}
+	if len(response.Messages) != 2 {
+		t.Fatalf("expected 2 scheduled messages, got %+v", response.Messages)
+	}
+	first := response.Messages[0]
+	if first.Message != "second" || first.Position != 1 || first.DeliverAt == "" || first.RemainingDelay <= 0 || first.RemainingDelay > 30 {
+		t.Errorf("unexpected first scheduled message: %+v", first)
+	}
+	if response.Messages[1].Message != "first" || response.Messages[1].Position != 2 {
+		t.Errorf("unexpected second scheduled message: %+v", response.Messages[1])
+	}
+
+	if rr := do("POST", "/queue/jobs/scheduled", ""); rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 for POST, got %d", rr.Code)
+	}
+	if rr := do("GET", "/queue/missing/scheduled", ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for missing queue, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,57 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"queue-broker/pkg/broker"
+)
+
+// handleQueueSchema обрабатывает GET/PUT/DELETE /queue/{name}/schema:
+// JSON Schema, которой должны соответствовать тела сообщений очереди
+func handleQueueSchema(qb *broker.QueueBroker, w http.ResponseWriter, r *http.Request, queueName string) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			httpError(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+		schema, err := broker.ParseSchema(data)
+		if err != nil {
+			errorResponse(w, err, http.StatusBadRequest)
+			return
+		}
+		qb.SetQueueSchema(queueName, schema)
+	case http.MethodDelete:
+		qb.SetQueueSchema(queueName, nil)
+		w.WriteHeader(http.StatusOK)
+		return
+	default:
+		httpError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	schema := qb.QueueSchema(queueName)
+	if schema == nil {
+		httpError(w, "Schema not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(schema)
+}
+
+// schemaError отвечает 422 со списком нарушений схемы; возвращает false,
+// если err не связана со схемой
+func schemaError(w http.ResponseWriter, err error) bool {
+	var violation *broker.SchemaError
+	if !errors.As(err, &violation) {
+		return false
+	}
+	writeError(w, http.StatusUnprocessableEntity, broker.ErrorCode(err), broker.ErrSchemaViolation.Error(), map[string]any{"violations": violation.Violations})
+	return true
+}
@@ -0,0 +1,56 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"queue-broker/pkg/broker"
+)
+
+// TestQueueSchemaHandler проверяет регистрацию схемы и ответ 422 на
+// сообщения, которые ей не соответствуют
+func TestQueueSchemaHandler(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 1)
+	handler := NewHandler(qb, nil)
+	do := requester(handler)
+
+	if rr := do("GET", "/queue/events/schema", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 without schema, got %d", rr.Code)
+	}
+	if rr := do("PUT", "/queue/events/schema", `{"type": "nope"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid schema, got %d", rr.Code)
+	}
+	schema := `{"type": "object", "required": ["kind"], "properties": {"kind": {"type": "string"}}}`
+	if rr := do("PUT", "/queue/events/schema", schema); rr.Code != http.StatusOK {
+		t.Fatalf("expected schema to be saved, got %d %s", rr.Code, rr.Body)
+	}
+	if rr := do("GET", "/queue/events/schema", ""); rr.Body.String() != `{"type":"object","required":["kind"],"properties":{"kind":{"type":"string"}}}`+"\n" {
+		t.Errorf("unexpected schema: %s", rr.Body)
+	}
+
+	rr := do("PUT", "/queue/events", `{"message": "{\"kind\": 1}"}`)
+	var result struct {
+		Error struct {
+			Code    string `json:"code"`
+			Details struct {
+				Violations []string `json:"violations"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	violations := &result.Error.Details.Violations
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); rr.Code != http.StatusUnprocessableEntity || err != nil || result.Error.Code != "SCHEMA_VIOLATION" ||
+		len(*violations) != 1 || (*violations)[0] != "/kind: expected string, got integer" {
+		t.Errorf("unexpected response: %d %s", rr.Code, rr.Body)
+	}
+	if rr := do("PUT", "/queue/events", `{"message": "{\"kind\": \"click\"}"}`); rr.Code != http.StatusOK {
+		t.Errorf("expected valid message to be accepted, got %d", rr.Code)
+	}
+
+	if rr := do("DELETE", "/queue/events/schema", ""); rr.Code != http.StatusOK {
+		t.Errorf("expected schema removal, got %d", rr.Code)
+	}
+	if rr := do("PUT", "/queue/events", `{"message": "plain text"}`); rr.Code != http.StatusOK {
+		t.Errorf("expected message without schema to be accepted, got %d", rr.Code)
+	}
+}
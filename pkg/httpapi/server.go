@@ -0,0 +1,63 @@
+package httpapi
+
+import (
+	"net/http"
+	"time"
+)
+
+// ServerConfig параметры HTTP-сервера брокера. Нулевые значения заменяются
+// значениями по умолчанию; таймауты задаются в секундах.
+type ServerConfig struct {
+	// ReadHeaderTimeout сколько ждать заголовков запроса
+	ReadHeaderTimeout int `json:"read_header_timeout"`
+	// IdleTimeout сколько держать открытым простаивающее keep-alive соединение
+	IdleTimeout int `json:"idle_timeout"`
+	// MaxHeaderBytes максимальный размер заголовков запроса
+	MaxHeaderBytes int `json:"max_header_bytes"`
+	// DisableH2C отключает HTTP/2 без TLS (h2c с предварительным знанием)
+	DisableH2C bool `json:"disable_h2c"`
+	// MaxConcurrentStreams сколько одновременных запросов (например, long-poll)
+	// допускается в одном HTTP/2-соединении
+	MaxConcurrentStreams int `json:"max_concurrent_streams"`
+}
+
+// Значения ServerConfig по умолчанию
+const (
+	DefaultReadHeaderTimeout    = 10
+	DefaultIdleTimeout          = 120
+	DefaultMaxHeaderBytes       = 64 << 10
+	DefaultMaxConcurrentStreams = 1000
+)
+
+// NewServer создает http.Server для addr с таймаутами, лимитами и протоколами
+// из cfg. Таймаут записи и чтения тела не задается: ответы long-poll и
+// потоковые ответы длятся дольше любого разумного значения.
+func NewServer(addr string, handler http.Handler, cfg ServerConfig) *http.Server {
+	if cfg.ReadHeaderTimeout <= 0 {
+		cfg.ReadHeaderTimeout = DefaultReadHeaderTimeout
+	}
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = DefaultIdleTimeout
+	}
+	if cfg.MaxHeaderBytes <= 0 {
+		cfg.MaxHeaderBytes = DefaultMaxHeaderBytes
+	}
+	if cfg.MaxConcurrentStreams <= 0 {
+		cfg.MaxConcurrentStreams = DefaultMaxConcurrentStreams
+	}
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(!cfg.DisableH2C)
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: time.Duration(cfg.ReadHeaderTimeout) * time.Second,
+		IdleTimeout:       time.Duration(cfg.IdleTimeout) * time.Second,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+		Protocols:         protocols,
+		HTTP2: &http.HTTP2Config{
+			MaxConcurrentStreams: cfg.MaxConcurrentStreams,
+		},
+	}
+}
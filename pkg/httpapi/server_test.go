@@ -0,0 +1,108 @@
+package httpapi
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"queue-broker/pkg/broker"
+)
+
+// TestNewServerDefaults проверяет значения по умолчанию и явные настройки сервера
+func TestNewServerDefaults(t *testing.T) {
+	server := NewServer(":0", nil, ServerConfig{})
+	if server.ReadHeaderTimeout != DefaultReadHeaderTimeout*time.Second ||
+		server.IdleTimeout != DefaultIdleTimeout*time.Second ||
+		server.MaxHeaderBytes != DefaultMaxHeaderBytes ||
+		server.HTTP2.MaxConcurrentStreams != DefaultMaxConcurrentStreams {
+		t.Errorf("unexpected defaults: %+v", server)
+	}
+	if server.WriteTimeout != 0 || server.ReadTimeout != 0 {
+		t.Error("write and read timeouts would cut long-polls")
+	}
+	if !server.Protocols.UnencryptedHTTP2() || !server.Protocols.HTTP1() {
+		t.Errorf("unexpected protocols: %v", server.Protocols)
+	}
+
+	server = NewServer(":0", nil, ServerConfig{ReadHeaderTimeout: 3, IdleTimeout: 30, MaxHeaderBytes: 4096, DisableH2C: true})
+	if server.ReadHeaderTimeout != 3*time.Second || server.IdleTimeout != 30*time.Second || server.MaxHeaderBytes != 4096 {
+		t.Errorf("config ignored: %+v", server)
+	}
+	if server.Protocols.UnencryptedHTTP2() {
+		t.Error("h2c should be disabled")
+	}
+}
+
+// TestServerH2CMultiplexing проверяет, что параллельные long-poll запросы
+// по h2c обслуживаются одним TCP-соединением
+func TestServerH2CMultiplexing(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewServer("", NewHandler(qb, nil), ServerConfig{})
+	go server.Serve(listener)
+	defer server.Close()
+
+	var dials atomic.Int32
+	transport := &http.Transport{
+		Protocols: new(http.Protocols),
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dials.Add(1)
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+	transport.Protocols.SetUnencryptedHTTP2(true)
+	defer transport.CloseIdleConnections()
+	c := &http.Client{Transport: transport}
+	base := "http://" + listener.Addr().String()
+
+	// Соединение открывается до параллельных запросов, чтобы они не гонялись за dial
+	qb.Enqueue("polls", &broker.Message{Body: "warmup"})
+	resp, err := c.Get(base + "/queue/polls?timeout=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.ProtoMajor != 2 {
+		t.Fatalf("expected HTTP/2, got %s", resp.Proto)
+	}
+
+	const polls = 10
+	var wg sync.WaitGroup
+	codes := make(chan int, polls)
+	for i := 0; i < polls; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := c.Get(base + "/queue/polls?timeout=5")
+			if err != nil {
+				codes <- 0
+				return
+			}
+			resp.Body.Close()
+			codes <- resp.StatusCode
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	for i := 0; i < polls; i++ {
+		qb.Enqueue("polls", &broker.Message{Body: strings.Repeat("x", i+1)})
+	}
+	wg.Wait()
+	close(codes)
+	for code := range codes {
+		if code != http.StatusOK {
+			t.Fatalf("unexpected status %d", code)
+		}
+	}
+	if n := dials.Load(); n != 1 {
+		t.Errorf("expected one connection, got %d", n)
+	}
+}
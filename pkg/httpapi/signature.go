@@ -0,0 +1,165 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"queue-broker/pkg/broker"
+	"queue-broker/pkg/signing"
+)
+
+// signatureFutureSkew насколько время запроса может опережать время брокера.
+// Вытеснение nonce поднимает нижнюю границу времени запросов до его времени,
+// поэтому запрос из далекого будущего надолго закрыл бы все остальные.
+const signatureFutureSkew = 5 * time.Second
+
+// SigningConfig настройки проверки подписи запросов
+type SigningConfig struct {
+	// Keys секреты HMAC по идентификатору ключа
+	Keys map[string]string `json:"keys"`
+	// Window на сколько секунд время запроса может отставать от времени брокера
+	// (по умолчанию 300); опережать его запрос может не больше чем на signatureFutureSkew
+	Window int `json:"window"`
+	// NonceCacheSize максимальное число запоминаемых nonce (по умолчанию 100000)
+	NonceCacheSize int `json:"nonce_cache_size"`
+}
+
+// RequestVerifier проверяет подпись запросов (см. пакет signing) и отклоняет
+// повторы: время запроса должно быть в пределах окна, а nonce не должен
+// встречаться повторно
+type RequestVerifier struct {
+	keys   map[string][]byte
+	window time.Duration
+	now    func() time.Time
+
+	mu     sync.Mutex
+	nonces map[string]time.Time
+	// order nonce в порядке добавления для вытеснения
+	order    []string
+	capacity int
+	// floor время самого нового вытесненного до истечения окна nonce:
+	// запросы не новее него отклоняются, поэтому вытеснение не открывает повторы
+	floor time.Time
+}
+
+// NewRequestVerifier создает проверку подписи по настройкам
+func NewRequestVerifier(cfg SigningConfig) *RequestVerifier {
+	v := &RequestVerifier{
+		keys:     make(map[string][]byte),
+		window:   time.Duration(cfg.Window) * time.Second,
+		now:      time.Now,
+		nonces:   make(map[string]time.Time),
+		capacity: cfg.NonceCacheSize,
+	}
+	if v.window <= 0 {
+		v.window = 300 * time.Second
+	}
+	if v.capacity <= 0 {
+		v.capacity = 100000
+	}
+	for id, secret := range cfg.Keys {
+		v.keys[id] = []byte(secret)
+	}
+	return v
+}
+
+// middleware пропускает только запросы с верной подписью; служебная очередь
+// самопроверки доступна без подписи. Тело для проверки подписи читается
+// целиком, поэтому ограничивается maxBytes (0 — без ограничения).
+func (v *RequestVerifier) middleware(maxBytes int64, next http.Handler) http.Handler {
+	if v == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if queueName, _ := splitQueuePath(r.URL.Path); queueName == broker.CanaryQueue {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if maxBytes > 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			bodyError(w, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		if msg := v.verify(r, body); msg != "" {
+			httpError(w, msg, http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, r.Header.Get(signing.KeyHeader))))
+	})
+}
+
+// verify возвращает причину отказа или пустую строку
+func (v *RequestVerifier) verify(r *http.Request, body []byte) string {
+	secret, ok := v.keys[r.Header.Get(signing.KeyHeader)]
+	if !ok {
+		return "Unknown signature key"
+	}
+	timestamp := r.Header.Get(signing.TimestampHeader)
+	nonce := r.Header.Get(signing.NonceHeader)
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || nonce == "" {
+		return "Missing signature timestamp or nonce"
+	}
+	// Подписывается исходный URI: путь /ns/... к этому моменту уже переписан
+	uri := r.RequestURI
+	if uri == "" {
+		uri = r.URL.RequestURI()
+	}
+	expected := signing.Sign(secret, requestMethod(r), uri, timestamp, nonce, body)
+	if !hmac.Equal([]byte(expected), []byte(r.Header.Get(signing.SignatureHeader))) {
+		return "Invalid signature"
+	}
+
+	// Проверка повтора выполняется после подписи, чтобы неподписанные
+	// запросы не могли заполнить кэш nonce
+	at := time.Unix(seconds, 0)
+	if !v.remember(r.Header.Get(signing.KeyHeader)+":"+nonce, at) {
+		return "Replayed or expired request"
+	}
+	return ""
+}
+
+// remember запоминает nonce; возвращает false для повтора или запроса вне
+// окна. Время запросов не позже now+signatureFutureSkew, поэтому и нижняя
+// граница floor опережает текущее время не больше чем на signatureFutureSkew.
+func (v *RequestVerifier) remember(key string, at time.Time) bool {
+	now := v.now()
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if at.Before(now.Add(-v.window)) || at.After(now.Add(signatureFutureSkew)) || !at.After(v.floor) {
+		return false
+	}
+	if _, seen := v.nonces[key]; seen {
+		return false
+	}
+
+	// Удаление истекших nonce из начала очереди
+	for len(v.order) > 0 && v.nonces[v.order[0]].Before(now.Add(-v.window)) {
+		delete(v.nonces, v.order[0])
+		v.order = v.order[1:]
+	}
+	for len(v.order) >= v.capacity {
+		if evicted := v.nonces[v.order[0]]; evicted.After(v.floor) {
+			v.floor = evicted
+		}
+		delete(v.nonces, v.order[0])
+		v.order = v.order[1:]
+	}
+
+	v.nonces[key] = at
+	v.order = append(v.order, key)
+	return true
+}
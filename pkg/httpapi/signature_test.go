@@ -0,0 +1,92 @@
+package httpapi
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"queue-broker/pkg/broker"
+	"queue-broker/pkg/signing"
+)
+
+// TestRequestSignature проверяет проверку подписи, окно времени и отклонение повторов
+func TestRequestSignature(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+	verifier := NewRequestVerifier(SigningConfig{Keys: map[string]string{"app": "secret"}, Window: 60, NonceCacheSize: 2})
+	now := time.Unix(1_700_000_000, 0)
+	verifier.now = func() time.Time { return now }
+	handler := NewHandler(qb, nil, WithRequestVerifier(verifier))
+
+	put := func(secret string, at time.Time, nonce string) int {
+		body := []byte(`{"message": "job"}`)
+		req := httptest.NewRequest("PUT", "/queue/jobs", bytes.NewReader(body))
+		timestamp := strconv.FormatInt(at.Unix(), 10)
+		req.Header.Set(signing.KeyHeader, "app")
+		req.Header.Set(signing.TimestampHeader, timestamp)
+		req.Header.Set(signing.NonceHeader, nonce)
+		req.Header.Set(signing.SignatureHeader, signing.Sign([]byte(secret), "PUT", "/queue/jobs", timestamp, nonce, body))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := put("secret", now, "n1"); code != http.StatusOK {
+		t.Fatalf("expected signed request to pass, got %d", code)
+	}
+	if code := put("secret", now, "n1"); code != http.StatusUnauthorized {
+		t.Errorf("expected replay to be rejected, got %d", code)
+	}
+	if code := put("wrong", now, "n2"); code != http.StatusUnauthorized {
+		t.Errorf("expected invalid signature to be rejected, got %d", code)
+	}
+	if code := put("secret", now.Add(-2*time.Minute), "n3"); code != http.StatusUnauthorized {
+		t.Errorf("expected stale request to be rejected, got %d", code)
+	}
+	// Запрос из будущего внутри окна не принимается: его вытеснение закрыло
+	// бы все запросы до его времени
+	if code := put("secret", now.Add(50*time.Second), "n6"); code != http.StatusUnauthorized {
+		t.Errorf("expected future-dated request to be rejected, got %d", code)
+	}
+
+	// Вытеснение n1 из переполненного кэша поднимает нижнюю границу времени,
+	// поэтому его повтор по-прежнему отклоняется
+	if code := put("secret", now.Add(time.Second), "n4"); code != http.StatusOK {
+		t.Fatalf("expected request to pass, got %d", code)
+	}
+	if code := put("secret", now.Add(2*time.Second), "n5"); code != http.StatusOK {
+		t.Fatalf("expected request to pass, got %d", code)
+	}
+	if code := put("secret", now, "n1"); code != http.StatusUnauthorized {
+		t.Errorf("expected replay of evicted nonce to be rejected, got %d", code)
+	}
+	// Вытеснение не закрывает запросы позже текущего времени
+	now = now.Add(3 * time.Second)
+	if code := put("secret", now, "n7"); code != http.StatusOK {
+		t.Errorf("expected request after the eviction to pass, got %d", code)
+	}
+
+	// Тело для проверки подписи не читается сверх ограничения размера
+	limited := NewHandler(qb, nil, WithRequestVerifier(verifier), WithMaxMessageSize(8))
+	rr := httptest.NewRecorder()
+	limited.ServeHTTP(rr, httptest.NewRequest("POST", "/admin/keys/rotate", bytes.NewBufferString(`{"key": "0123456789"}`)))
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected oversized signed body to be rejected, got %d", rr.Code)
+	}
+
+	req := httptest.NewRequest("PUT", "/queue/jobs", bytes.NewBufferString(`{"message": "job"}`))
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected unsigned request to be rejected, got %d", rr.Code)
+	}
+
+	req = httptest.NewRequest("PUT", "/queue/"+broker.CanaryQueue, bytes.NewBufferString(`{"message": "ping"}`))
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected canary queue to be exempt from signing, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,51 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"queue-broker/pkg/broker"
+	"queue-broker/pkg/objstore"
+)
+
+// snapshotHandler обрабатывает POST /admin/snapshot: снимок всех очередей
+// с ожидающими и неподтвержденными сообщениями записывается в хранилище
+// снимков; store nil — хранилище не настроено
+func snapshotHandler(qb *broker.QueueBroker, store objstore.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			httpError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if store == nil {
+			httpError(w, "Snapshot storage is not configured", http.StatusNotImplemented)
+			return
+		}
+
+		snap := qb.Snapshot()
+		data, err := broker.EncodeSnapshot(snap)
+		if err != nil {
+			errorResponse(w, err, http.StatusInternalServerError)
+			return
+		}
+		key := "snapshot-" + snap.CreatedAt.UTC().Format("20060102T150405.000000000Z") + ".json"
+		if err := store.Put(r.Context(), key, data); err != nil {
+			errorResponse(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		messages := 0
+		for _, qs := range snap.Queues {
+			messages += len(qs.Messages)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]any{
+			"location":   store.Location(key),
+			"queues":     len(snap.Queues),
+			"messages":   messages,
+			"created_at": snap.CreatedAt.UTC().Format(time.RFC3339Nano),
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"queue-broker/pkg/broker"
+	"queue-broker/pkg/objstore"
+)
+
+// TestSnapshotHandler проверяет запись снимка в каталог и восстановление
+// из него другого брокера
+func TestSnapshotHandler(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+	qb.PutMessage("jobs", "job 1")
+	qb.PutMessage("jobs", "job 2")
+	qb.PutMessage("mail", "hello")
+	if _, err := qb.PeekLock("mail", 0, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	NewHandler(qb, nil).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/admin/snapshot", nil))
+	if rr.Code != http.StatusNotImplemented {
+		t.Errorf("snapshot without storage should get 501, got %d", rr.Code)
+	}
+
+	handler := NewHandler(qb, nil, WithSnapshots(objstore.Dir{Path: t.TempDir()}))
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/admin/snapshot", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET should get 405, got %d", rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/admin/snapshot", nil))
+	var result struct {
+		Location string `json:"location"`
+		Queues   int    `json:"queues"`
+		Messages int    `json:"messages"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("unexpected response: %d %s", rr.Code, rr.Body)
+	}
+	if result.Queues != 2 || result.Messages != 3 {
+		t.Errorf("unexpected result: %+v", result)
+	}
+
+	data, err := objstore.ReadObject(context.Background(), result.Location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap, err := broker.DecodeSnapshot(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := broker.NewQueueBroker(100, 10, 10)
+	if err := restored.Restore(snap); err != nil {
+		t.Fatal(err)
+	}
+	// Неподтвержденное сообщение после переноса доставляется повторно
+	if restored.Depth("jobs") != 2 || restored.Depth("mail") != 1 {
+		t.Errorf("unexpected depths after restore: jobs %d, mail %d", restored.Depth("jobs"), restored.Depth("mail"))
+	}
+}
@@ -0,0 +1,27 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"queue-broker/pkg/broker"
+)
+
+// handleQueueStats обрабатывает GET /queue/{name}/stats: глубина, скорости
+// постановки и выдачи, возраст самого старого сообщения и задержка выдачи
+func handleQueueStats(qb *broker.QueueBroker, w http.ResponseWriter, r *http.Request, queueName string) {
+	if r.Method != http.MethodGet {
+		httpError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	stats, err := qb.Stats(queueName)
+	if errors.Is(err, broker.ErrQueueNotFound) {
+		writeError(w, http.StatusNotFound, broker.ErrorCode(err), "Queue does not exist", nil)
+		return
+	}
+	stats.Name = broker.TrimTenant(stats.Name)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(stats)
+}
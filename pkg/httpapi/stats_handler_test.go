@@ -0,0 +1,49 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"queue-broker/pkg/broker"
+)
+
+// TestQueueStatsHandler проверяет GET /queue/{name}/stats, его версию в /v1
+// и возраст самого старого сообщения в /metrics
+func TestQueueStatsHandler(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+	handler := NewHandler(qb, nil)
+	do := func(method, target string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(method, target, nil))
+		return rr
+	}
+
+	if rr := do(http.MethodGet, "/queue/jobs/stats"); rr.Code != http.StatusNotFound || !strings.Contains(rr.Body.String(), "QUEUE_NOT_FOUND") {
+		t.Errorf("missing queue: got %d %s", rr.Code, rr.Body)
+	}
+	if err := qb.Enqueue("jobs", &broker.Message{Body: "x"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, target := range []string{"/queue/jobs/stats", "/v1/queues/jobs/stats"} {
+		rr := do(http.MethodGet, target)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: got %d %s", target, rr.Code, rr.Body)
+		}
+		var stats broker.QueueStats
+		if err := json.Unmarshal(rr.Body.Bytes(), &stats); err != nil {
+			t.Fatal(err)
+		}
+		if stats.Name != "jobs" || stats.Depth != 1 || stats.EnqueueRate.M1 != 0 {
+			t.Errorf("%s: unexpected stats %+v", target, stats)
+		}
+	}
+	if rr := do(http.MethodPost, "/queue/jobs/stats"); rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: got %d", rr.Code)
+	}
+	if rr := do(http.MethodGet, "/metrics"); !strings.Contains(rr.Body.String(), `queue_broker_oldest_message_age_seconds{queue="jobs"} `) {
+		t.Errorf("metrics without oldest message age:\n%s", rr.Body)
+	}
+}
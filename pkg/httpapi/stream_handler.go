@@ -0,0 +1,123 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"queue-broker/pkg/broker"
+)
+
+// handleStream обрабатывает GET /queue/{name}/stream: сообщения выдаются
+// непрерывно в формате NDJSON (по одному JSON-объекту на строку), пока клиент
+// не закроет соединение. Сообщение считается доставленным после записи в поток.
+func handleStream(qb *broker.QueueBroker, w http.ResponseWriter, r *http.Request, queueName string) {
+	if r.Method != http.MethodGet {
+		httpError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		httpError(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	forceBase64, err := base64Param(r.URL.Query())
+	if err != nil {
+		httpError(w, "Invalid encoding", http.StatusBadRequest)
+		return
+	}
+
+	sub, err := qb.Subscribe(queueName)
+	if err != nil {
+		if errors.Is(err, broker.ErrStandby) {
+			errorResponse(w, err, http.StatusServiceUnavailable)
+			return
+		}
+		if errors.Is(err, broker.ErrTooManyConsumers) {
+			tooManyConsumers(w, err)
+			return
+		}
+		httpError(w, "Queue does not exist", http.StatusBadRequest)
+		return
+	}
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	encoder := json.NewEncoder(w)
+	for {
+		msg, err := sub.Next(r.Context())
+		if err != nil {
+			return
+		}
+		if err := encoder.Encode(jsonView(tenantView(r, msg), forceBase64)); err != nil {
+			return
+		}
+		countUsage(r, false, 1, len(msg.Body))
+		flusher.Flush()
+	}
+}
+
+// handleTail обрабатывает GET /queue/{name}/tail: как /stream, но с peek=true
+// сообщения не извлекаются — выдаются копии сообщений, поставленных после
+// подключения (имя может быть шаблоном). Предназначено для отладки продюсеров.
+func handleTail(qb *broker.QueueBroker, w http.ResponseWriter, r *http.Request, queueName string) {
+	peek := false
+	if value := r.URL.Query().Get("peek"); value != "" {
+		var err error
+		if peek, err = strconv.ParseBool(value); err != nil {
+			httpError(w, "Invalid peek", http.StatusBadRequest)
+			return
+		}
+	}
+	if !peek {
+		handleStream(qb, w, r, queueName)
+		return
+	}
+	if r.Method != http.MethodGet {
+		httpError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		httpError(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	forceBase64, err := base64Param(r.URL.Query())
+	if err != nil {
+		httpError(w, "Invalid encoding", http.StatusBadRequest)
+		return
+	}
+
+	tap, err := qb.Tap(queueName)
+	if err != nil {
+		if errors.Is(err, broker.ErrStandby) {
+			errorResponse(w, err, http.StatusServiceUnavailable)
+			return
+		}
+		httpError(w, "Queue does not exist", http.StatusBadRequest)
+		return
+	}
+	defer tap.Close()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	encoder := json.NewEncoder(w)
+	for {
+		select {
+		case msg := <-tap.C:
+			if err := encoder.Encode(jsonView(tenantView(r, msg), forceBase64)); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package httpapi
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"queue-broker/pkg/broker"
+)
+
+// TestStreamMessages проверяет непрерывную выдачу сообщений в формате NDJSON
+func TestStreamMessages(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+	server := httptest.NewServer(NewHandler(qb, nil))
+	defer server.Close()
+	qb.PutMessage("events", "first")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/queue/events/stream", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("stream returned wrong status code: got %v want %v", resp.StatusCode, http.StatusOK)
+	}
+
+	qb.PutMessage("events", "second")
+	scanner := bufio.NewScanner(resp.Body)
+	for _, want := range []string{"first", "second"} {
+		if !scanner.Scan() {
+			t.Fatalf("stream ended early: %v", scanner.Err())
+		}
+		var msg broker.Message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil || msg.Body != want {
+			t.Errorf("got %q (%v) want %q", msg.Body, err, want)
+		}
+	}
+}
+
+// TestStreamMaxConsumers проверяет отказ лишним потребителям очереди
+func TestStreamMaxConsumers(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+	server := httptest.NewServer(NewHandler(qb, nil))
+	defer server.Close()
+	qb.PutMessage("events", "first")
+	qb.SetQueueConfig("events", broker.QueueConfig{LockDuration: 30, MaxConsumers: 1})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/queue/events/stream", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	resp2, err := http.Get(server.URL + "/queue/events/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp2.Body.Close()
+	if resp2.StatusCode != http.StatusTooManyRequests || resp2.Header.Get("Retry-After") == "" {
+		t.Errorf("expected 429 for extra stream consumer, got %d", resp2.StatusCode)
+	}
+	resp3, err := http.Get(server.URL + "/queue/events?timeout=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp3.Body.Close()
+	if resp3.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("expected 429 for extra long-poll consumer, got %d", resp3.StatusCode)
+	}
+}
+
+// TestTailPeek проверяет выдачу копий новых сообщений без их извлечения
+func TestTailPeek(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+	server := httptest.NewServer(NewHandler(qb, nil))
+	defer server.Close()
+	qb.PutMessage("events", "old")
+
+	if resp, err := http.Get(server.URL + "/queue/events/tail?peek=maybe"); err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for invalid peek, got %v %v", resp, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/queue/events/tail?peek=true", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	qb.PutMessage("events", "new")
+
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil || line != "{\"message\":\"new\",\"queue\":\"events\"}\n" {
+		t.Fatalf("unexpected tail line: %q %v", line, err)
+	}
+	if qb.Depth("events") != 2 {
+		t.Errorf("tail consumed messages, depth %d", qb.Depth("events"))
+	}
+}
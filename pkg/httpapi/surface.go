@@ -0,0 +1,90 @@
+package httpapi
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+
+	"queue-broker/pkg/broker"
+)
+
+// Surface часть HTTP API, которую можно вынести на отдельный слушающий
+// сокет, например, оставить административную только на localhost
+type Surface string
+
+const (
+	// SurfaceData постановка и получение сообщений и остальные запросы клиентов
+	SurfaceData Surface = "data"
+	// SurfaceAdmin /admin/..., панель управления, повышение реплики и
+	// запросы к очередям, требующие права admin (настройки, права, очистка,
+	// архивирование и т. п.)
+	SurfaceAdmin Surface = "admin"
+	// SurfaceMetrics /metrics
+	SurfaceMetrics Surface = "metrics"
+	// SurfacePeer запросы других брокеров: поток репликации (gRPC), сообщения
+	// регионов, обмен узлов кластера и запросы узлов Raft
+	SurfacePeer Surface = "peer"
+)
+
+type surfacesKey struct{}
+
+// Restrict отвечает 404 на запросы к частям API, не перечисленным в surfaces;
+// /healthz доступен всегда. Используется, чтобы обслуживать один обработчик
+// NewHandler несколькими серверами с разным набором возможностей.
+func Restrict(handler http.Handler, surfaces ...Surface) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Запросы к очередям проверяет QueueHandler по подресурсу
+		if r.URL.Path != "/healthz" && !queuePath(r.URL.Path) && !slices.Contains(surfaces, pathSurface(r.URL.Path)) {
+			notFound(w)
+			return
+		}
+		handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), surfacesKey{}, surfaces)))
+	})
+}
+
+// pathSurface часть API, к которой относится путь; запросы к очередям
+// уточняются queueSurface после разбора подресурса
+func pathSurface(path string) Surface {
+	switch {
+	case path == "/metrics":
+		return SurfaceMetrics
+	case path == "/ui", path == "/replication/promote", strings.HasPrefix(path+"/", "/admin/"):
+		return SurfaceAdmin
+	case path == broker.ReplicationStreamMethod, strings.HasPrefix(path, "/federation/"), strings.HasPrefix(path, "/cluster/"), strings.HasPrefix(path, "/raft/"):
+		return SurfacePeer
+	}
+	return SurfaceData
+}
+
+// queuePath сообщает, относится ли путь к отдельной очереди
+func queuePath(path string) bool {
+	for _, prefix := range []string{"/queue/", "/ns/", "/v1/queues/", "/v1/ns/"} {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// queueSurface часть API, к которой относится запрос к подресурсу sub очереди
+func queueSurface(r *http.Request, sub string) Surface {
+	if tokenPermission(r, sub) == broker.PermAdmin {
+		return SurfaceAdmin
+	}
+	return SurfaceData
+}
+
+// adminListener сообщает, обслуживает ли сервер запроса только
+// административную часть API (--admin-listen), но не запросы клиентов
+func adminListener(r *http.Request) bool {
+	surfaces, ok := r.Context().Value(surfacesKey{}).([]Surface)
+	return ok && slices.Contains(surfaces, SurfaceAdmin) && !slices.Contains(surfaces, SurfaceData)
+}
+
+// surfaceAllowed сообщает, обслуживает ли сервер запроса часть API s; без
+// Restrict доступны все части
+func surfaceAllowed(r *http.Request, s Surface) bool {
+	surfaces, ok := r.Context().Value(surfacesKey{}).([]Surface)
+	return !ok || slices.Contains(surfaces, s)
+}
@@ -0,0 +1,72 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"queue-broker/pkg/broker"
+	"queue-broker/pkg/cluster"
+)
+
+// TestRestrict проверяет разделение API между слушающими сокетами
+func TestRestrict(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+	handler := NewHandler(qb, nil, WithPartitioner(cluster.NewPartitioner(qb, "http://a", []string{"http://a"}, time.Hour)))
+	servers := map[Surface]http.Handler{}
+	for _, s := range []Surface{SurfaceData, SurfaceAdmin, SurfaceMetrics, SurfacePeer} {
+		servers[s] = Restrict(handler, s)
+	}
+	data, admin := servers[SurfaceData], servers[SurfaceAdmin]
+	do := func(h http.Handler, method, path, body string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := do(data, http.MethodPut, "/queue/jobs", `{"message": "x"}`); code != http.StatusOK {
+		t.Fatalf("put on data listener: %d", code)
+	}
+	if code := do(data, http.MethodGet, "/queue/jobs", ""); code != http.StatusOK {
+		t.Errorf("get on data listener: %d", code)
+	}
+	if code := do(admin, http.MethodPut, "/queue/jobs", `{"message": "x"}`); code != http.StatusNotFound {
+		t.Errorf("put on admin listener: %d", code)
+	}
+
+	cases := []struct {
+		name, method, path string
+		allowed            Surface
+	}{
+		{"usage", http.MethodGet, "/admin/usage", SurfaceAdmin},
+		{"purge", http.MethodPost, "/queue/jobs/purge", SurfaceAdmin},
+		{"v1 purge", http.MethodPost, "/v1/queues/jobs/purge", SurfaceAdmin},
+		{"replication stream", http.MethodPost, broker.ReplicationStreamMethod, SurfacePeer},
+		{"federation", http.MethodPost, "/federation/messages", SurfacePeer},
+		{"cluster nodes", http.MethodGet, "/cluster/nodes", SurfacePeer},
+		{"cluster nodes update", http.MethodPut, "/cluster/nodes", SurfacePeer},
+		{"handoff", http.MethodPost, "/cluster/handoff", SurfacePeer},
+		{"promote", http.MethodPost, "/replication/promote", SurfaceAdmin},
+		{"metrics", http.MethodGet, "/metrics", SurfaceMetrics},
+	}
+	for _, tc := range cases {
+		for s, h := range servers {
+			code := do(h, tc.method, tc.path, "")
+			if s == tc.allowed && code == http.StatusNotFound {
+				t.Errorf("%s: not served by %s listener", tc.name, s)
+			}
+			if s != tc.allowed && code != http.StatusNotFound {
+				t.Errorf("%s: served by %s listener with %d", tc.name, s, code)
+			}
+		}
+	}
+
+	for _, h := range servers {
+		if code := do(h, http.MethodGet, "/healthz", ""); code != http.StatusOK {
+			t.Errorf("healthz: %d", code)
+		}
+	}
+}
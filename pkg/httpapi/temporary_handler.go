@@ -0,0 +1,57 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"queue-broker/pkg/broker"
+)
+
+// temporaryQueueHandler обрабатывает POST /queues/temporary: создает
+// временную очередь для ответов, закрепленную за субъектом запроса.
+// Тело {"auto_delete_after_idle": минуты} необязательно.
+func temporaryQueueHandler(qb *broker.QueueBroker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			httpError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		r, ok := withTenant(qb, w, r)
+		if !ok {
+			return
+		}
+		var requestBody struct {
+			AutoDeleteAfterIdle int `json:"auto_delete_after_idle"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); (err != nil && !errors.Is(err, io.EOF)) || requestBody.AutoDeleteAfterIdle < 0 {
+			httpError(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+
+		queueName := broker.NewTemporaryQueueName()
+		if tenantID, multiTenant := r.Context().Value(tenantKey{}).(string); multiTenant {
+			var err error
+			if queueName, err = broker.TenantQueueName(tenantID, queueName); err != nil {
+				httpError(w, "Invalid queue name", http.StatusBadRequest)
+				return
+			}
+		}
+		// Из очереди ответов создатель получает сообщения
+		if !tokenAllows(r, queueName, broker.PermConsume) {
+			httpError(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if err := qb.CreateTemporaryQueue(queueName, principal(r), requestBody.AutoDeleteAfterIdle); err != nil {
+			enqueueError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]any{
+			"queue":                  broker.TrimTenant(queueName),
+			"auto_delete_after_idle": qb.QueueConfig(queueName).AutoDeleteAfterIdle,
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"queue-broker/pkg/broker"
+)
+
+// TestTemporaryQueueRPC проверяет запрос-ответ через временную очередь
+func TestTemporaryQueueRPC(t *testing.T) {
+	qb := broker.NewQueueBroker(10, 10, 10)
+	handler := NewHandler(qb, nil)
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return rr
+	}
+
+	rr := serve(http.MethodPost, "/queues/temporary", `{"auto_delete_after_idle": 2}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("unexpected response %d %s", rr.Code, rr.Body)
+	}
+	var created struct {
+		Queue               string `json:"queue"`
+		AutoDeleteAfterIdle int    `json:"auto_delete_after_idle"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil || created.AutoDeleteAfterIdle != 2 || !strings.HasPrefix(created.Queue, broker.TemporaryQueuePrefix) {
+		t.Fatalf("unexpected response %s", rr.Body)
+	}
+
+	// Клиент отправляет запрос, обработчик отвечает в reply_to
+	if rr := serve(http.MethodPut, "/queue/rpc", `{"message": "ping", "headers": {"reply_to": "`+created.Queue+`"}}`); rr.Code != http.StatusOK {
+		t.Fatalf("unexpected put status %d %s", rr.Code, rr.Body)
+	}
+	request, err := qb.Dequeue("rpc", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := qb.PutMessage(request.Headers[broker.ReplyToHeader], "pong"); err != nil {
+		t.Fatal(err)
+	}
+	if rr := serve(http.MethodGet, "/queue/"+created.Queue+"?timeout=0", ""); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "pong") {
+		t.Errorf("unexpected reply %d %s", rr.Code, rr.Body)
+	}
+
+	if rr := serve(http.MethodPost, "/queues/temporary", ""); rr.Code != http.StatusCreated {
+		t.Errorf("empty body: unexpected status %d", rr.Code)
+	}
+	if rr := serve(http.MethodPost, "/queues/temporary", `{"auto_delete_after_idle": -1}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("negative idle: unexpected status %d", rr.Code)
+	}
+	if rr := serve(http.MethodPut, "/queue/tmp.missing", `{"message": "late"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("missing temporary queue: unexpected status %d", rr.Code)
+	}
+}
@@ -0,0 +1,135 @@
+package httpapi
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"queue-broker/pkg/broker"
+)
+
+type tenantKey struct{}
+
+// namespaceKey арендатор, указанный в пути /ns/{tenant}/queue/{name}
+type namespaceKey struct{}
+
+// namespaceHandler принимает запросы вида /ns/{tenant}/queue/{name} и передает
+// их обработчику очередей как /queue/{name}; токен запроса должен принадлежать
+// арендатору из пути (проверяется в tenantHandler)
+func namespaceHandler(qb *broker.QueueBroker, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenantID, rest, ok := strings.Cut(r.URL.Path[len("/ns/"):], "/")
+		if !ok || !strings.HasPrefix("/"+rest, "/queue/") || !qb.HasTenant(tenantID) {
+			httpError(w, "Unknown namespace", http.StatusNotFound)
+			return
+		}
+		// Служебная очередь самопроверки не принадлежит арендаторам
+		if queueName, _ := splitQueuePath("/" + rest); queueName == broker.CanaryQueue {
+			httpError(w, "Invalid queue name", http.StatusBadRequest)
+			return
+		}
+
+		u := *r.URL
+		u.Path = "/" + rest
+		u.RawPath = ""
+		r = r.WithContext(context.WithValue(r.Context(), namespaceKey{}, tenantID))
+		r.URL = &u
+		next.ServeHTTP(w, r)
+	})
+}
+
+// tenantHandler в многоарендном режиме относит запрос к арендатору по токену
+// из заголовка Authorization: Bearer и переводит имя очереди во внутреннее
+// (orders -> @acme.orders). Служебная очередь самопроверки доступна без токена.
+func tenantHandler(qb *broker.QueueBroker, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !qb.MultiTenant() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		queueName, sub := splitQueuePath(r.URL.Path)
+		if queueName == broker.CanaryQueue {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		tenantID, found := qb.TenantByToken(token)
+		if !ok || !found {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			httpError(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if namespace, ok := r.Context().Value(namespaceKey{}).(string); ok && namespace != tenantID {
+			httpError(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		internal, err := broker.TenantQueueName(tenantID, queueName)
+		if err != nil {
+			httpError(w, "Invalid queue name", http.StatusBadRequest)
+			return
+		}
+
+		u := *r.URL
+		u.Path = "/queue/" + internal
+		if sub != "" {
+			u.Path += "/" + sub
+		}
+		u.RawPath = ""
+		r = r.WithContext(context.WithValue(r.Context(), tenantKey{}, tenantID))
+		r.URL = &u
+		next.ServeHTTP(w, r)
+	})
+}
+
+// tenantView убирает префикс арендатора из имени очереди в ответе
+func tenantView(r *http.Request, v any) any {
+	if r.Context().Value(tenantKey{}) == nil {
+		return v
+	}
+
+	switch v := v.(type) {
+	case *broker.Message:
+		msg := *v
+		msg.Queue = broker.TrimTenant(msg.Queue)
+		return &msg
+	case *broker.Delivery:
+		msg := *v.Message
+		msg.Queue = broker.TrimTenant(msg.Queue)
+		delivery := *v
+		delivery.Message = &msg
+		return &delivery
+	}
+	return v
+}
+
+// rejectTenants в многоарендном режиме отклоняет запросы с токеном арендатора:
+// служебные запросы к брокеру охватывают очереди всех арендаторов
+func rejectTenants(qb *broker.QueueBroker, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if qb.MultiTenant() {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if _, found := qb.TenantByToken(token); ok && found {
+				httpError(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// withTenant в многоарендном режиме относит запрос вне /queue/... к
+// арендатору по токену, как tenantHandler; без токена арендатора отвечает 401
+func withTenant(qb *broker.QueueBroker, w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	if !qb.MultiTenant() {
+		return r, true
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	tenantID, found := qb.TenantByToken(token)
+	if !ok || !found {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		httpError(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+	return r.WithContext(context.WithValue(r.Context(), tenantKey{}, tenantID)), true
+}
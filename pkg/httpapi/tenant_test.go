@@ -0,0 +1,110 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"queue-broker/pkg/broker"
+)
+
+func TestTenantIsolationHTTP(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+	qb.AddTenant(broker.Tenant{ID: "acme", Key: bytes.Repeat([]byte{1}, 32), Token: "acme-token"})
+	qb.AddTenant(broker.Tenant{ID: "globex", Key: bytes.Repeat([]byte{2}, 32), Token: "globex-token"})
+	handler := NewHandler(qb, nil)
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := do("PUT", "/queue/orders", "", `{"message": "x"}`); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without token, got %d", rr.Code)
+	}
+	if rr := do("PUT", "/queue/orders", "wrong", `{"message": "x"}`); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for unknown token, got %d", rr.Code)
+	}
+	if rr := do("GET", "/queue/@globex.orders?timeout=0", "acme-token", ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected reserved prefix to be rejected, got %d", rr.Code)
+	}
+
+	if rr := do("PUT", "/queue/orders", "acme-token", `{"message": "acme order"}`); rr.Code != http.StatusOK {
+		t.Fatalf("put failed: %d %s", rr.Code, rr.Body)
+	}
+	// Очередь с тем же именем у другого арендатора не существует
+	if rr := do("GET", "/queue/orders?timeout=0", "globex-token", ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected globex to see no orders queue, got %d %s", rr.Code, rr.Body)
+	}
+
+	rr := do("GET", "/queue/orders?mode=peeklock", "acme-token", "")
+	var delivery struct {
+		Message   string `json:"message"`
+		Queue     string `json:"queue"`
+		LockToken string `json:"lock_token"`
+	}
+	json.NewDecoder(rr.Body).Decode(&delivery)
+	if rr.Code != http.StatusOK || delivery.Message != "acme order" || delivery.Queue != "orders" {
+		t.Fatalf("unexpected delivery %d %+v", rr.Code, delivery)
+	}
+	body, _ := json.Marshal(map[string]string{"lock_token": delivery.LockToken})
+	if rr := do("POST", "/queue/"+delivery.Queue+"/complete", "acme-token", string(body)); rr.Code != http.StatusOK {
+		t.Errorf("complete with the returned queue name failed: %d %s", rr.Code, rr.Body)
+	}
+
+	// Служебные запросы охватывают всех арендаторов и им недоступны
+	for _, path := range []string{"/admin/snapshot", "/admin/usage", "/admin/keys"} {
+		if rr := do("GET", path, "acme-token", ""); rr.Code != http.StatusForbidden {
+			t.Errorf("tenant %s: expected 403, got %d", path, rr.Code)
+		}
+	}
+}
+
+// TestNamespacePaths проверяет доступ к очередям арендатора по пути /ns/{tenant}/queue/{name}
+func TestNamespacePaths(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+	qb.AddTenant(broker.Tenant{ID: "acme", Key: bytes.Repeat([]byte{1}, 32), Token: "acme-token", Tokens: []string{"acme-team"}})
+	qb.AddTenant(broker.Tenant{ID: "globex", Key: bytes.Repeat([]byte{2}, 32), Token: "globex-token"})
+	handler := NewHandler(qb, nil)
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := do("PUT", "/ns/acme/queue/orders", "acme-team", `{"message": "order"}`); rr.Code != http.StatusOK {
+		t.Fatalf("put failed: %d %s", rr.Code, rr.Body)
+	}
+	if rr := do("GET", "/ns/acme/queue/orders?timeout=0", "globex-token", ""); rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for another tenant's namespace, got %d", rr.Code)
+	}
+	if rr := do("GET", "/ns/acme/queue/orders?timeout=0", "", ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without token, got %d", rr.Code)
+	}
+	for _, path := range []string{"/ns/initech/queue/orders", "/ns/acme/orders", "/ns/acme"} {
+		if rr := do("GET", path, "acme-token", ""); rr.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", path, rr.Code)
+		}
+	}
+	if rr := do("GET", "/ns/acme/queue/"+broker.CanaryQueue, "acme-token", ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected canary queue to be rejected in a namespace, got %d", rr.Code)
+	}
+
+	// Путь с пространством имен и путь /queue/ обращаются к одной очереди
+	rr := do("GET", "/queue/orders?timeout=0", "acme-token", "")
+	if rr.Code != http.StatusOK || !bytes.Contains(rr.Body.Bytes(), []byte(`"queue":"orders"`)) {
+		t.Errorf("unexpected response %d %s", rr.Code, rr.Body)
+	}
+}
@@ -0,0 +1,82 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"queue-broker/pkg/broker"
+)
+
+// stageMessage обрабатывает PUT /queue/{name}?tx={id}: ставит сообщение
+// в транзакцию, где оно ждет фиксации и не видно потребителям
+func stageMessage(qb *broker.QueueBroker, w http.ResponseWriter, r *http.Request, txID, queueName string, msg *broker.Message) {
+	size := len(msg.Body)
+	if err := qb.EnqueueTx(principal(r), txID, queueName, msg); err != nil {
+		transactionError(w, err)
+		return
+	}
+	countUsage(r, true, 1, size)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// transactionHandler обрабатывает POST /transactions/{id}/commit и
+// /transactions/{id}/abort: фиксацию и отмену транзакции субъекта запроса
+func transactionHandler(qb *broker.QueueBroker) http.Handler {
+	rt := newRouter()
+	rt.handleFunc("/transactions/{id}/commit", func(w http.ResponseWriter, r *http.Request) {
+		r, ok := withTenant(qb, w, r)
+		if !ok || !transactionAllowed(qb, w, r) {
+			return
+		}
+		committed, err := qb.CommitTx(principal(r), r.PathValue("id"))
+		if err != nil {
+			transactionError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]int{"committed": committed})
+	}, http.MethodPost)
+	rt.handleFunc("/transactions/{id}/abort", func(w http.ResponseWriter, r *http.Request) {
+		r, ok := withTenant(qb, w, r)
+		if !ok || !transactionAllowed(qb, w, r) {
+			return
+		}
+		if err := qb.AbortTx(principal(r), r.PathValue("id")); err != nil {
+			transactionError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}, http.MethodPost)
+	return rt
+}
+
+// transactionAllowed проверяет, что субъекту запроса разрешено ставить
+// сообщения во все очереди транзакции; иначе отвечает 403. Права проверялись
+// и при постановке, но токен фиксации может выдавать меньше прав.
+func transactionAllowed(qb *broker.QueueBroker, w http.ResponseWriter, r *http.Request) bool {
+	queues, err := qb.TxQueues(principal(r), r.PathValue("id"))
+	if err != nil {
+		// Ответ на неизвестную транзакцию дает сама фиксация или отмена
+		return true
+	}
+	for _, queueName := range queues {
+		if !authorize(qb, r, queueName, broker.PermProduce) {
+			httpError(w, "Forbidden", http.StatusForbidden)
+			return false
+		}
+	}
+	return true
+}
+
+func transactionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, broker.ErrTransactionNotFound):
+		writeError(w, http.StatusNotFound, broker.ErrorCode(err), "Transaction not found", nil)
+	case errors.Is(err, broker.ErrTransactionCommitted), errors.Is(err, broker.ErrTransactionBusy):
+		errorResponse(w, err, http.StatusConflict)
+	default:
+		enqueueError(w, err)
+	}
+}
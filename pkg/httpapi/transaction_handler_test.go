@@ -0,0 +1,58 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"queue-broker/pkg/broker"
+)
+
+// TestTransactionEndpoints проверяет постановку в транзакцию, фиксацию и отмену
+func TestTransactionEndpoints(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+	handler := NewHandler(qb, nil)
+	do := func(method, url, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(method, url, strings.NewReader(body)))
+		return rr
+	}
+
+	for _, body := range []string{`{"message": "a"}`, `{"message": "b"}`} {
+		if rr := do(http.MethodPut, "/queue/jobs?tx=order-42", body); rr.Code != http.StatusAccepted {
+			t.Fatalf("unexpected stage status %d %s", rr.Code, rr.Body)
+		}
+	}
+	if qb.Depth("jobs") != 0 {
+		t.Fatal("uncommitted messages must be invisible")
+	}
+
+	rr := do(http.MethodPost, "/transactions/order-42/commit", "")
+	var result map[string]int
+	if err := json.NewDecoder(rr.Body).Decode(&result); err != nil || rr.Code != http.StatusOK || result["committed"] != 2 {
+		t.Fatalf("unexpected commit response %d %v", rr.Code, result)
+	}
+	if qb.Depth("jobs") != 2 {
+		t.Errorf("expected 2 committed messages, got %d", qb.Depth("jobs"))
+	}
+	// Повтор фиксации не ставит сообщения повторно
+	if rr := do(http.MethodPost, "/transactions/order-42/commit", ""); rr.Code != http.StatusOK || qb.Depth("jobs") != 2 {
+		t.Errorf("unexpected repeated commit %d, depth %d", rr.Code, qb.Depth("jobs"))
+	}
+	if rr := do(http.MethodPut, "/queue/jobs?tx=order-42", `{"message": "c"}`); rr.Code != http.StatusConflict {
+		t.Errorf("staging into committed transaction returned %d", rr.Code)
+	}
+
+	do(http.MethodPut, "/queue/jobs?tx=order-43", `{"message": "d"}`)
+	if rr := do(http.MethodPost, "/transactions/order-43/abort", ""); rr.Code != http.StatusNoContent {
+		t.Errorf("unexpected abort status %d", rr.Code)
+	}
+	if rr := do(http.MethodPost, "/transactions/order-43/commit", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("commit of aborted transaction returned %d", rr.Code)
+	}
+	if qb.Depth("jobs") != 2 {
+		t.Errorf("aborted message was enqueued")
+	}
+}
@@ -0,0 +1,23 @@
+package httpapi
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// dashboardPage одностраничная панель управления /ui: очереди, глубины,
+// графики и кнопки просмотра, очистки и паузы; ресурсы встроены в страницу
+//
+//go:embed ui/index.html
+var dashboardPage []byte
+
+// uiHandler обрабатывает GET /ui: панель управления очередями
+func uiHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(dashboardPage)
+}
@@ -0,0 +1,37 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"queue-broker/pkg/broker"
+)
+
+// TestDashboard проверяет выдачу панели управления /ui
+func TestDashboard(t *testing.T) {
+	handler := NewHandler(broker.NewQueueBroker(100, 10, 10), nil)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/ui", nil))
+	if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("unexpected response: %d %s", rr.Code, rr.Header())
+	}
+	// Страница работает через API брокера без внешних ресурсов
+	body := rr.Body.String()
+	for _, want := range []string{`"/queues"`, `"messages"`, `"purge"`, `"pause"`, `"resume"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page does not use %s", want)
+		}
+	}
+	if strings.Contains(body, "https://") {
+		t.Error("page must not load external resources")
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/ui", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("unexpected status for POST: %d", rr.Code)
+	}
+}
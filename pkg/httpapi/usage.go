@@ -0,0 +1,232 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// anonymousPrincipal ключ учета для запросов без ключа подписи и арендатора
+const anonymousPrincipal = "anonymous"
+
+// UsageCounters потребление одного ключа: число сообщений и байт их тел,
+// принятых (in) и выданных (out) брокером
+type UsageCounters struct {
+	MessagesIn  int64 `json:"messages_in"`
+	MessagesOut int64 `json:"messages_out"`
+	BytesIn     int64 `json:"bytes_in"`
+	BytesOut    int64 `json:"bytes_out"`
+}
+
+func (c *UsageCounters) add(other UsageCounters) {
+	c.MessagesIn += other.MessagesIn
+	c.MessagesOut += other.MessagesOut
+	c.BytesIn += other.BytesIn
+	c.BytesOut += other.BytesOut
+}
+
+// UsageReport отчет GET /admin/usage: потребление по ключам с запуска брокера
+type UsageReport struct {
+	Since time.Time                `json:"since"`
+	Keys  map[string]UsageCounters `json:"keys"`
+}
+
+// usageRollup суточная сводка, записываемая в каталог UsageMeter
+type usageRollup struct {
+	Date string                   `json:"date"`
+	Keys map[string]UsageCounters `json:"keys"`
+}
+
+type usageKey struct{}
+
+// UsageMeter ведет учет сообщений и байт по ключам API (идентификатору ключа
+// подписи или арендатору) для распределения затрат на общий брокер. Если
+// задан каталог, по окончании суток UTC потребление за них записывается
+// в файл usage-ГГГГ-ММ-ДД.json.
+type UsageMeter struct {
+	dir   string
+	since time.Time
+	now   func() time.Time
+
+	mu    sync.Mutex
+	total map[string]*UsageCounters
+	day   map[string]*UsageCounters
+	// date сутки (UTC), за которые копится day
+	date   string
+	stop   chan struct{}
+	closed bool
+}
+
+// NewUsageMeter создает счетчик потребления; dir пусто — без суточных сводок
+func NewUsageMeter(dir string) *UsageMeter {
+	m := &UsageMeter{
+		dir:   dir,
+		now:   time.Now,
+		total: make(map[string]*UsageCounters),
+		day:   make(map[string]*UsageCounters),
+		stop:  make(chan struct{}),
+	}
+	m.since = m.now().UTC()
+	m.date = m.since.Format(time.DateOnly)
+	return m
+}
+
+// Start запускает запись суточных сводок в начале каждых суток UTC
+func (m *UsageMeter) Start() {
+	if m.dir == "" {
+		return
+	}
+	go func() {
+		for {
+			now := m.now().UTC()
+			next := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+			timer := time.NewTimer(next.Sub(now))
+			select {
+			case <-timer.C:
+				if err := m.Rollup(); err != nil {
+					log.Printf("usage: rollup: %v", err)
+				}
+			case <-m.stop:
+				timer.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// Stop останавливает запись сводок, дописывая потребление за текущие сутки
+func (m *UsageMeter) Stop() error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil
+	}
+	m.closed = true
+	close(m.stop)
+	m.mu.Unlock()
+	if m.dir == "" {
+		return nil
+	}
+	return m.Rollup()
+}
+
+// Record учитывает messages сообщений общим размером bytes, принятых (in)
+// или выданных ключу key
+func (m *UsageMeter) Record(key string, in bool, messages int, bytes int64) {
+	if key == "" {
+		key = anonymousPrincipal
+	}
+	var delta UsageCounters
+	if in {
+		delta.MessagesIn, delta.BytesIn = int64(messages), bytes
+	} else {
+		delta.MessagesOut, delta.BytesOut = int64(messages), bytes
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, counters := range []map[string]*UsageCounters{m.total, m.day} {
+		c := counters[key]
+		if c == nil {
+			c = &UsageCounters{}
+			counters[key] = c
+		}
+		c.add(delta)
+	}
+}
+
+// Report возвращает потребление по ключам с запуска брокера
+func (m *UsageMeter) Report() UsageReport {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	report := UsageReport{Since: m.since, Keys: make(map[string]UsageCounters, len(m.total))}
+	for key, c := range m.total {
+		report.Keys[key] = *c
+	}
+	return report
+}
+
+// Rollup записывает накопленное за сутки потребление в их файл сводки
+// и начинает учет заново. Файл, уже записанный за эти сутки (например, до
+// перезапуска брокера), дополняется, а не перезаписывается.
+func (m *UsageMeter) Rollup() error {
+	m.mu.Lock()
+	date, day := m.date, m.day
+	m.day = make(map[string]*UsageCounters)
+	m.date = m.now().UTC().Format(time.DateOnly)
+	m.mu.Unlock()
+	if len(day) == 0 {
+		return nil
+	}
+
+	path := filepath.Join(m.dir, "usage-"+date+".json")
+	rollup := usageRollup{Date: date, Keys: make(map[string]UsageCounters)}
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &rollup); err != nil {
+			return err
+		}
+	case !errors.Is(err, fs.ErrNotExist):
+		return err
+	}
+	for key, c := range day {
+		counters := rollup.Keys[key]
+		counters.add(*c)
+		rollup.Keys[key] = counters
+	}
+	data, err = json.MarshalIndent(rollup, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(m.dir, ".usage-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// withUsage делает счетчик потребления доступным обработчикам запроса
+func withUsage(m *UsageMeter, next http.Handler) http.Handler {
+	if m == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), usageKey{}, m)))
+	})
+}
+
+// countUsage учитывает принятые (in) или выданные сообщения за субъектом
+// запроса; bytes — суммарный размер их тел
+func countUsage(r *http.Request, in bool, messages int, bytes int) {
+	if m, ok := r.Context().Value(usageKey{}).(*UsageMeter); ok {
+		m.Record(principal(r), in, messages, int64(bytes))
+	}
+}
+
+// usageHandler обрабатывает GET /admin/usage
+func usageHandler(m *UsageMeter) http.Handler {
+	rt := newRouter()
+	rt.handleFunc("/admin/usage", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(m.Report())
+	}, http.MethodGet)
+	return rt
+}
@@ -0,0 +1,107 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"queue-broker/pkg/broker"
+)
+
+// TestUsageReport проверяет учет сообщений и байт по арендаторам
+func TestUsageReport(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+	qb.AddTenant(broker.Tenant{ID: "acme", Key: bytes.Repeat([]byte{1}, 32), Token: "acme-token"})
+	qb.AddTenant(broker.Tenant{ID: "globex", Key: bytes.Repeat([]byte{2}, 32), Token: "globex-token"})
+	handler := NewHandler(qb, nil)
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for _, body := range []string{`{"message": "hello"}`, `{"message": "hi"}`} {
+		if rr := do(http.MethodPut, "/queue/orders", "acme-token", body); rr.Code != http.StatusOK {
+			t.Fatalf("put failed: %d %s", rr.Code, rr.Body)
+		}
+	}
+	if rr := do(http.MethodGet, "/queue/orders?timeout=0", "acme-token", ""); rr.Code != http.StatusOK {
+		t.Fatalf("get failed: %d %s", rr.Code, rr.Body)
+	}
+	if rr := do(http.MethodPut, "/publish", "globex-token", `{"messages": [{"queue": "a", "message": "abc"}, {"queue": "b", "message": "de"}]}`); rr.Code != http.StatusOK {
+		t.Fatalf("publish failed: %d %s", rr.Code, rr.Body)
+	}
+	// Неудачные запросы не учитываются
+	if rr := do(http.MethodGet, "/queue/missing?timeout=0", "globex-token", ""); rr.Code == http.StatusOK {
+		t.Fatalf("unexpected get status %d", rr.Code)
+	}
+
+	rr := do(http.MethodGet, "/admin/usage", "", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d %s", rr.Code, rr.Body)
+	}
+	var report UsageReport
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]UsageCounters{
+		"acme":   {MessagesIn: 2, MessagesOut: 1, BytesIn: 7, BytesOut: 5},
+		"globex": {MessagesIn: 2, BytesIn: 5},
+	}
+	if len(report.Keys) != len(want) {
+		t.Fatalf("unexpected report %+v", report.Keys)
+	}
+	for key, counters := range want {
+		if report.Keys[key] != counters {
+			t.Errorf("%s: got %+v, want %+v", key, report.Keys[key], counters)
+		}
+	}
+}
+
+// TestUsageRollup проверяет запись суточной сводки и ее дополнение
+func TestUsageRollup(t *testing.T) {
+	dir := t.TempDir()
+	day := time.Date(2024, 3, 1, 23, 0, 0, 0, time.UTC)
+	m := NewUsageMeter(dir)
+	m.now = func() time.Time { return day }
+	m.date = day.Format(time.DateOnly)
+
+	m.Record("key-1", true, 3, 30)
+	m.Record("", false, 1, 10)
+	if err := m.Rollup(); err != nil {
+		t.Fatal(err)
+	}
+	// Повторная сводка за те же сутки (например, после перезапуска) дополняет файл
+	m.Record("key-1", false, 2, 20)
+	if err := m.Rollup(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "usage-2024-03-01.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rollup usageRollup
+	if err := json.Unmarshal(data, &rollup); err != nil {
+		t.Fatal(err)
+	}
+	if got := rollup.Keys["key-1"]; got != (UsageCounters{MessagesIn: 3, MessagesOut: 2, BytesIn: 30, BytesOut: 20}) {
+		t.Errorf("unexpected key-1 usage %+v", got)
+	}
+	if got := rollup.Keys[anonymousPrincipal]; got.MessagesOut != 1 {
+		t.Errorf("unexpected anonymous usage %+v", got)
+	}
+	// Итоги с запуска сводками не сбрасываются
+	if got := m.Report().Keys["key-1"]; got.MessagesIn != 3 || got.MessagesOut != 2 {
+		t.Errorf("unexpected total %+v", got)
+	}
+}
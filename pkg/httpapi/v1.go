@@ -0,0 +1,172 @@
+package httpapi
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// API версии 1 (/v1/queues/{name}/...) с REST-семантикой:
+//
+//	POST   /v1/queues/{name}/messages               поставить сообщение (201)
+//	GET    /v1/queues/{name}/messages               просмотреть ожидающие сообщения
+//	DELETE /v1/queues/{name}/messages/head          получить и удалить первое сообщение (long-poll)
+//	DELETE /v1/queues/{name}/messages/{id}          удалить сообщение по идентификатору
+//	POST   /v1/queues/{name}/messages/{id}/requeue  вернуть сообщение для выдачи
+//	POST   /v1/queues/{name}/leases                 получить сообщение с блокировкой (peek-lock)
+//	DELETE /v1/queues/{name}/leases/{token}         подтвердить обработку
+//	POST   /v1/queues/{name}/leases/{token}/renew   продлить блокировку
+//	POST   /v1/queues/{name}/leases/{token}/abandon вернуть сообщение в очередь
+//	GET    /v1/queues/{name}/log                    прочитать журнал очереди с хранением
+//	GET    /v1/queues                               список очередей
+//
+// Остальные подресурсы (/config, /acl, /stream и др.) доступны под
+// /v1/queues/{name}/ теми же методами, пространства имен арендаторов — под
+// /v1/ns/{tenant}/queues/. Запрос /v1 переводится в запрос прежнего API и
+// проходит те же проверки; прежние пути /queue/{name} остаются устаревшими
+// синонимами и отвечают заголовком Deprecation.
+
+// v1Key исходный метод запроса /v1, переведенного в запрос прежнего API
+type v1Key struct{}
+
+// leaseKey токен блокировки из пути /v1/queues/{name}/leases/{token}
+type leaseKey struct{}
+
+// requestMethod возвращает метод, с которым запрос пришел от клиента
+func requestMethod(r *http.Request) string {
+	if method, ok := r.Context().Value(v1Key{}).(string); ok {
+		return method
+	}
+	return r.Method
+}
+
+// v1Route запрос прежнего API, в который переводится запрос /v1
+type v1Route struct {
+	method string
+	// sub подресурс очереди прежнего API (пустой — сама очередь)
+	sub   string
+	query url.Values
+	// lease токен блокировки берется из параметра пути {token}
+	lease bool
+	// created ответ 200 на постановку заменяется на 201
+	created bool
+}
+
+// v1Subresources подресурсы очереди, которые передаются прежнему API
+// без изменений с тем же методом
+var v1Subresources = []string{"config", "acl", "owner", "audit", "archive", "schema", "purge", "pause", "resume", "tail", "scheduled", "stats", "export", "import", "stream", "aggregate", "offsets"}
+
+// v1Handler переводит запросы /v1 в запросы прежнего API и передает их mux
+func v1Handler(mux http.Handler) http.Handler {
+	rt := newRouter()
+	rt.handleFunc("/v1/queues", func(w http.ResponseWriter, r *http.Request) {
+		serveV1(w, r, mux, v1Route{method: r.Method}, "/queues")
+	}, "")
+
+	for _, prefix := range []string{"/v1/queues/{name}", "/v1/ns/{tenant}/queues/{name}"} {
+		// v1 регистрирует перевод method pattern в запрос route прежнего API;
+		// пустой route.method сохраняет метод запроса
+		v1 := func(method, pattern string, route v1Route) {
+			rt.handleFunc(prefix+pattern, func(w http.ResponseWriter, r *http.Request) {
+				path := "/queue/" + r.PathValue("name")
+				if tenant := r.PathValue("tenant"); tenant != "" {
+					path = "/ns/" + tenant + path
+				}
+				id := r.PathValue("id")
+				if id != "" && !isMessageID(id) {
+					notFound(w)
+					return
+				}
+				sub := strings.ReplaceAll(route.sub, "{id}", id)
+				if sub != "" {
+					path += "/" + sub
+				}
+				legacy := route
+				if legacy.method == "" {
+					legacy.method = r.Method
+				}
+				serveV1(w, r, mux, legacy, path)
+			}, method)
+		}
+		v1(http.MethodPost, "/messages", v1Route{method: http.MethodPut, created: true})
+		v1(http.MethodGet, "/messages", v1Route{sub: "messages"})
+		v1(http.MethodDelete, "/messages/head", v1Route{method: http.MethodGet})
+		v1(http.MethodDelete, "/messages/{id}", v1Route{sub: "messages/{id}"})
+		v1(http.MethodPost, "/messages/{id}/requeue", v1Route{sub: "messages/{id}/requeue"})
+		v1(http.MethodPost, "/leases", v1Route{method: http.MethodGet, query: url.Values{"mode": {"peeklock"}}})
+		v1(http.MethodGet, "/log", v1Route{method: http.MethodGet, query: url.Values{"mode": {logMode}}})
+		v1(http.MethodDelete, "/leases/{token}", v1Route{method: http.MethodPost, sub: "complete", lease: true})
+		v1(http.MethodPost, "/leases/{token}/renew", v1Route{method: http.MethodPost, sub: "renew", lease: true})
+		v1(http.MethodPost, "/leases/{token}/abandon", v1Route{method: http.MethodPost, sub: "abandon", lease: true})
+		for _, sub := range v1Subresources {
+			v1("", "/"+sub, v1Route{sub: sub})
+		}
+	}
+	return rt
+}
+
+func isMessageID(s string) bool {
+	_, err := strconv.ParseUint(s, 10, 64)
+	return err == nil
+}
+
+func serveV1(w http.ResponseWriter, r *http.Request, mux http.Handler, route v1Route, path string) {
+	ctx := context.WithValue(r.Context(), v1Key{}, r.Method)
+	if route.lease {
+		ctx = context.WithValue(ctx, leaseKey{}, r.PathValue("token"))
+	}
+	legacy := r.WithContext(ctx)
+	legacy.Method = route.method
+	u := *r.URL
+	u.Path = path
+	u.RawPath = ""
+	if len(route.query) > 0 {
+		query := u.Query()
+		for name, values := range route.query {
+			query[name] = values
+		}
+		u.RawQuery = query.Encode()
+	}
+	legacy.URL = &u
+	if route.created {
+		w = &createdWriter{ResponseWriter: w}
+	}
+	mux.ServeHTTP(w, legacy)
+}
+
+// createdWriter отвечает 201 вместо 200 на постановку нового сообщения;
+// повтор с тем же dedup_id (X-Duplicate) по-прежнему получает 200
+type createdWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *createdWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if code == http.StatusOK && w.Header().Get("X-Duplicate") == "" {
+		code = http.StatusCreated
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *createdWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.ResponseWriter.Write(b)
+}
+
+// deprecated помечает ответы на запросы к прежнему API заголовками
+// Deprecation и Link на версию /v1, если запрос не пришел через /v1
+func deprecated(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value(v1Key{}).(string); !ok {
+			w.Header().Set("Deprecation", "true")
+			w.Header().Set("Link", `</v1/queues>; rel="successor-version"`)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,98 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"queue-broker/pkg/broker"
+)
+
+// TestV1MessageLifecycle проверяет постановку, просмотр, получение и
+// подтверждение сообщений через /v1
+func TestV1MessageLifecycle(t *testing.T) {
+	qb := broker.NewQueueBroker(100, 10, 10)
+	qb.SetDefaultDedupWindow(60)
+	handler := NewHandler(qb, nil)
+	do := requester(handler)
+
+	rr := do(http.MethodPost, "/v1/queues/jobs/messages", `{"message": "job 1", "dedup_id": "j1"}`)
+	if rr.Code != http.StatusCreated || rr.Header().Get("Deprecation") != "" {
+		t.Fatalf("unexpected enqueue response: %d %v", rr.Code, rr.Header())
+	}
+	if rr := do(http.MethodPost, "/v1/queues/jobs/messages", `{"message": "job 1", "dedup_id": "j1"}`); rr.Code != http.StatusOK {
+		t.Errorf("duplicate should get 200, got %d", rr.Code)
+	}
+	do(http.MethodPost, "/v1/queues/jobs/messages", `{"message": "job 2"}`)
+
+	rr = do(http.MethodGet, "/v1/queues/jobs/messages", "")
+	var page struct {
+		Total int `json:"total"`
+	}
+	if json.Unmarshal(rr.Body.Bytes(), &page); rr.Code != http.StatusOK || page.Total != 2 {
+		t.Fatalf("unexpected browse response: %d %s", rr.Code, rr.Body)
+	}
+
+	rr = do(http.MethodDelete, "/v1/queues/jobs/messages/head?timeout=0", "")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"job 1"`) {
+		t.Fatalf("unexpected consume response: %d %s", rr.Code, rr.Body)
+	}
+
+	rr = do(http.MethodPost, "/v1/queues/jobs/leases?timeout=0&lock_duration=30", "")
+	var lease struct {
+		Body      string `json:"message"`
+		LockToken string `json:"lock_token"`
+	}
+	if json.Unmarshal(rr.Body.Bytes(), &lease); rr.Code != http.StatusOK || lease.Body != "job 2" || lease.LockToken == "" {
+		t.Fatalf("unexpected lease response: %d %s", rr.Code, rr.Body)
+	}
+	if rr := do(http.MethodPost, "/v1/queues/jobs/leases/"+lease.LockToken+"/renew", `{"lock_duration": 60}`); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"lock_duration":60`) {
+		t.Errorf("unexpected renew response: %d %s", rr.Code, rr.Body)
+	}
+	if rr := do(http.MethodDelete, "/v1/queues/jobs/leases/"+lease.LockToken, ""); rr.Code != http.StatusOK {
+		t.Errorf("unexpected ack response: %d %s", rr.Code, rr.Body)
+	}
+	if rr := do(http.MethodDelete, "/v1/queues/jobs/leases/"+lease.LockToken, ""); rr.Code != http.StatusGone {
+		t.Errorf("repeated ack should get 410, got %d", rr.Code)
+	}
+
+	rr = do(http.MethodGet, "/v1/queues", "")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"name":"jobs"`) {
+		t.Errorf("unexpected list response: %d %s", rr.Code, rr.Body)
+	}
+	if rr := do(http.MethodGet, "/v1/queues/jobs/config", ""); rr.Code != http.StatusOK {
+		t.Errorf("subresource not routed: %d", rr.Code)
+	}
+}
+
+// TestV1Routing проверяет ответы на неизвестные ресурсы и методы
+// и пометку прежнего API как устаревшего
+func TestV1Routing(t *testing.T) {
+	handler := NewHandler(broker.NewQueueBroker(100, 10, 10), nil)
+	for _, tc := range []struct {
+		method, target string
+		code           int
+	}{
+		{http.MethodPut, "/v1/queues/jobs/messages", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/v1/queues/jobs/messages/head", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/v1/queues/jobs/leases", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/v1/queues/jobs/unknown", http.StatusNotFound},
+		{http.MethodDelete, "/v1/queues/jobs/messages/abc", http.StatusNotFound},
+		{http.MethodGet, "/v1/topics", http.StatusNotFound},
+		{http.MethodGet, "/v1/queues/jobs", http.StatusNotFound},
+	} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(tc.method, tc.target, nil))
+		if rr.Code != tc.code {
+			t.Errorf("%s %s: expected %d, got %d", tc.method, tc.target, tc.code, rr.Code)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPut, "/queue/jobs", strings.NewReader(`{"message": "legacy"}`)))
+	if rr.Code != http.StatusOK || rr.Header().Get("Deprecation") != "true" || !strings.Contains(rr.Header().Get("Link"), "/v1/queues") {
+		t.Errorf("legacy path is not marked deprecated: %d %v", rr.Code, rr.Header())
+	}
+}
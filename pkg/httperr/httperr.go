@@ -0,0 +1,58 @@
+// Package httperr формирует ответы с ошибкой в едином формате HTTP API брокера:
+//
+//	{"error": {"code": "QUEUE_FULL", "message": "queue is full", "details": {...}}}
+//
+// code — код ошибки брокера (broker.Error) или, для остальных ошибок, код
+// по статусу ответа (BAD_REQUEST, NOT_FOUND и т. п.); клиенты сравнивают его,
+// а не текст message. Пакет используют httpapi и пакеты, которые сами
+// обслуживают HTTP-запросы (cluster, raft, stomp).
+package httperr
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"unicode"
+)
+
+// Body тело ответа с ошибкой
+type Body struct {
+	Error Info `json:"error"`
+}
+
+// Info описание ошибки
+type Info struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Details any    `json:"details,omitempty"`
+}
+
+// Write отвечает ошибкой в формате Body; заголовки, заданные до вызова
+// (например, Retry-After), сохраняются
+func Write(w http.ResponseWriter, status int, code, message string, details any) {
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Type", "application/json")
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Body{Error: Info{Code: code, Message: message, Details: details}})
+}
+
+// Error замена http.Error: код ошибки определяется по статусу ответа
+func Error(w http.ResponseWriter, message string, status int) {
+	Write(w, status, StatusCode(status), message, nil)
+}
+
+// StatusCode код ошибки по статусу ответа: "Not Found" — NOT_FOUND
+func StatusCode(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return "ERROR"
+	}
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}, text)
+}
@@ -0,0 +1,26 @@
+package httperr
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestError проверяет формат ответа с ошибкой и код по статусу
+func TestError(t *testing.T) {
+	rr := httptest.NewRecorder()
+	rr.Header().Set("Retry-After", "1")
+	Error(rr, "Queue owner unavailable", http.StatusBadGateway)
+
+	var body Body
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil || rr.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("not a JSON error: %q", rr.Body)
+	}
+	if rr.Code != http.StatusBadGateway || body.Error.Code != "BAD_GATEWAY" || body.Error.Message != "Queue owner unavailable" || rr.Header().Get("Retry-After") != "1" {
+		t.Errorf("unexpected response %d %+v %v", rr.Code, body.Error, rr.Header())
+	}
+	if code := StatusCode(599); code != "ERROR" {
+		t.Errorf("unknown status: got %s", code)
+	}
+}
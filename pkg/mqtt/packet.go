@@ -0,0 +1,251 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Типы пакетов MQTT 3.1.1
+const (
+	packetConnect     = 1
+	packetConnack     = 2
+	packetPublish     = 3
+	packetPuback      = 4
+	packetPubrec      = 5
+	packetPubrel      = 6
+	packetPubcomp     = 7
+	packetSubscribe   = 8
+	packetSuback      = 9
+	packetUnsubscribe = 10
+	packetUnsuback    = 11
+	packetPingreq     = 12
+	packetPingresp    = 13
+	packetDisconnect  = 14
+)
+
+// maxPacketSize ограничение размера пакета, принимаемого от клиента
+const maxPacketSize = 1 << 20
+
+var errMalformed = errors.New("malformed packet")
+
+// packet фиксированный заголовок и тело пакета
+type packet struct {
+	kind  byte
+	flags byte
+	body  []byte
+}
+
+// readPacket читает один пакет
+func readPacket(r *bufio.Reader) (*packet, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	// Оставшаяся длина кодируется переменным числом байт, по 7 бит в каждом
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return nil, errMalformed
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		length += int(b&0x7f) * multiplier
+		if b&0x80 == 0 {
+			break
+		}
+		multiplier *= 128
+	}
+	if length > maxPacketSize {
+		return nil, fmt.Errorf("packet too large: %d bytes", length)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return &packet{kind: header >> 4, flags: header & 0x0f, body: body}, nil
+}
+
+// encodePacket собирает пакет с фиксированным заголовком
+func encodePacket(kind, flags byte, body []byte) []byte {
+	buf := []byte{kind<<4 | flags}
+	length := len(body)
+	for {
+		b := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			b |= 0x80
+		}
+		buf = append(buf, b)
+		if length == 0 {
+			break
+		}
+	}
+	return append(buf, body...)
+}
+
+// decoder последовательно разбирает поля тела пакета
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil || len(d.data) < 1 {
+		d.err = errMalformed
+		return 0
+	}
+	b := d.data[0]
+	d.data = d.data[1:]
+	return b
+}
+
+func (d *decoder) uint16() uint16 {
+	if d.err != nil || len(d.data) < 2 {
+		d.err = errMalformed
+		return 0
+	}
+	v := binary.BigEndian.Uint16(d.data)
+	d.data = d.data[2:]
+	return v
+}
+
+func (d *decoder) bytes() []byte {
+	n := int(d.uint16())
+	if d.err != nil || len(d.data) < n {
+		d.err = errMalformed
+		return nil
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *decoder) string() string {
+	return string(d.bytes())
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(s)))
+	return append(buf, s...)
+}
+
+// connectPacket поля пакета CONNECT, используемые брокером
+type connectPacket struct {
+	protocol     string
+	level        byte
+	cleanSession bool
+	keepAlive    uint16
+	clientID     string
+}
+
+func parseConnect(p *packet) (*connectPacket, error) {
+	d := &decoder{data: p.body}
+	c := &connectPacket{protocol: d.string(), level: d.byte()}
+	flags := d.byte()
+	c.cleanSession = flags&0x02 != 0
+	c.keepAlive = d.uint16()
+	c.clientID = d.string()
+	// Will, имя пользователя и пароль разбираются, но не используются
+	if flags&0x04 != 0 {
+		d.string()
+		d.bytes()
+	}
+	if flags&0x80 != 0 {
+		d.string()
+	}
+	if flags&0x40 != 0 {
+		d.bytes()
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return c, nil
+}
+
+// publishPacket пакет PUBLISH
+type publishPacket struct {
+	topic    string
+	qos      byte
+	dup      bool
+	packetID uint16
+	payload  []byte
+}
+
+func parsePublish(p *packet) (*publishPacket, error) {
+	d := &decoder{data: p.body}
+	pub := &publishPacket{
+		qos:   (p.flags >> 1) & 0x03,
+		dup:   p.flags&0x08 != 0,
+		topic: d.string(),
+	}
+	if pub.qos > 0 {
+		pub.packetID = d.uint16()
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	pub.payload = d.data
+	return pub, nil
+}
+
+func encodePublish(pub *publishPacket) []byte {
+	body := appendString(nil, pub.topic)
+	if pub.qos > 0 {
+		body = binary.BigEndian.AppendUint16(body, pub.packetID)
+	}
+	body = append(body, pub.payload...)
+	flags := pub.qos << 1
+	if pub.dup {
+		flags |= 0x08
+	}
+	return encodePacket(packetPublish, flags, body)
+}
+
+// subscription фильтр темы с запрошенным уровнем QoS
+type subscription struct {
+	filter string
+	qos    byte
+}
+
+func parseSubscribe(p *packet) (uint16, []subscription, error) {
+	d := &decoder{data: p.body}
+	packetID := d.uint16()
+	var subs []subscription
+	for d.err == nil && len(d.data) > 0 {
+		subs = append(subs, subscription{filter: d.string(), qos: d.byte()})
+	}
+	if d.err != nil || len(subs) == 0 {
+		return 0, nil, errMalformed
+	}
+	return packetID, subs, nil
+}
+
+func parseUnsubscribe(p *packet) (uint16, []string, error) {
+	d := &decoder{data: p.body}
+	packetID := d.uint16()
+	var filters []string
+	for d.err == nil && len(d.data) > 0 {
+		filters = append(filters, d.string())
+	}
+	if d.err != nil || len(filters) == 0 {
+		return 0, nil, errMalformed
+	}
+	return packetID, filters, nil
+}
+
+func parsePacketID(p *packet) (uint16, error) {
+	d := &decoder{data: p.body}
+	id := d.uint16()
+	return id, d.err
+}
+
+func encodePacketID(kind byte, flags byte, packetID uint16) []byte {
+	return encodePacket(kind, flags, binary.BigEndian.AppendUint16(nil, packetID))
+}
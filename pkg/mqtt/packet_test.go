@@ -0,0 +1,51 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+)
+
+// TestPacketRemainingLength проверяет кодирование длины пакета переменным числом байт
+func TestPacketRemainingLength(t *testing.T) {
+	for _, size := range []int{0, 127, 128, 16383, 16384, 300000} {
+		body := bytes.Repeat([]byte{'x'}, size)
+		data := encodePacket(packetPublish, 2, body)
+		p, err := readPacket(bufio.NewReader(bytes.NewReader(data)))
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		if p.kind != packetPublish || p.flags != 2 || len(p.body) != size {
+			t.Errorf("size %d: unexpected packet kind=%d flags=%d len=%d", size, p.kind, p.flags, len(p.body))
+		}
+	}
+}
+
+// TestTopicToQueue проверяет преобразование тем и фильтров MQTT в имена и шаблоны очередей
+func TestTopicToQueue(t *testing.T) {
+	tests := []struct {
+		topic  string
+		filter bool
+		want   string
+		ok     bool
+	}{
+		{"sensors/room1/temp", false, "sensors.room1.temp", true},
+		{"sensors/+/temp", true, "sensors.*.temp", true},
+		{"sensors/#", true, "sensors.>", true},
+		{"sensors/+", false, "", false},
+		{"sensors/#/temp", true, "", false},
+		{"sensors//temp", false, "", false},
+		{"sensors.room1", false, "", false},
+		{"", false, "", false},
+		{"@acme/orders", false, "", false},
+	}
+	for _, tt := range tests {
+		got, err := topicToQueue(tt.topic, tt.filter)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("topicToQueue(%q, %v) = %q, %v", tt.topic, tt.filter, got, err)
+		}
+	}
+	if got := queueToTopic("sensors.room1.temp"); got != "sensors/room1/temp" {
+		t.Errorf("unexpected topic %q", got)
+	}
+}
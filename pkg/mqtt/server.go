@@ -0,0 +1,460 @@
+// Package mqtt реализует MQTT-адаптер брокера очередей (MQTT 3.1.1, QoS 0 и 1):
+// публикация в тему ставит сообщение в очередь, подписка на тему получает
+// сообщения очереди.
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"queue-broker/pkg/broker"
+)
+
+// TopicHeader заголовок, в котором сохраняется исходная тема MQTT
+const TopicHeader = "mqtt-topic"
+
+const (
+	// maxInflight число выданных с QoS 1 и еще не подтвержденных сообщений на соединение
+	maxInflight = 16
+	// connectTimeout время ожидания пакета CONNECT после установки соединения
+	connectTimeout = 10 * time.Second
+)
+
+// Server MQTT-сервер поверх брокера
+type Server struct {
+	qb *broker.QueueBroker
+	// retryInterval пауза перед повторной попыткой получить сообщение
+	// из еще не созданной очереди
+	retryInterval time.Duration
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[*conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// NewServer создает MQTT-сервер для брокера
+func NewServer(qb *broker.QueueBroker) *Server {
+	return &Server{
+		qb:            qb,
+		retryInterval: time.Second,
+		listeners:     make(map[net.Listener]struct{}),
+		conns:         make(map[*conn]struct{}),
+	}
+}
+
+// ListenAndServe принимает соединения на адресе addr
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve принимает соединения, пока не будет вызван Close
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return errors.New("server closed")
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+
+		c := newConn(s, nc)
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			nc.Close()
+			return nil
+		}
+		s.conns[c] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go func() {
+			defer s.wg.Done()
+			c.serve()
+			s.mu.Lock()
+			delete(s.conns, c)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// Close закрывает слушатели и все соединения
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for c := range s.conns {
+		c.nc.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return nil
+}
+
+// conn соединение с клиентом MQTT
+type conn struct {
+	s  *Server
+	nc net.Conn
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	subWg  sync.WaitGroup
+
+	writeMu sync.Mutex
+
+	mu       sync.Mutex
+	clientID string
+	subs     map[string]context.CancelFunc
+	pending  map[uint16]pendingAck
+	nextID   uint16
+	inflight chan struct{}
+}
+
+// pendingAck выданное с QoS 1 сообщение, ожидающее PUBACK
+type pendingAck struct {
+	queue     string
+	lockToken string
+}
+
+func newConn(s *Server, nc net.Conn) *conn {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &conn{
+		s:        s,
+		nc:       nc,
+		ctx:      ctx,
+		cancel:   cancel,
+		subs:     make(map[string]context.CancelFunc),
+		pending:  make(map[uint16]pendingAck),
+		inflight: make(chan struct{}, maxInflight),
+	}
+}
+
+func (c *conn) serve() {
+	defer func() {
+		c.cancel()
+		c.nc.Close()
+		// Неподтвержденные сообщения вернутся в очереди по истечении блокировки
+		c.subWg.Wait()
+	}()
+
+	r := bufio.NewReader(c.nc)
+	keepAlive, err := c.handshake(r)
+	if err != nil {
+		if !errors.Is(err, net.ErrClosed) {
+			log.Printf("mqtt: connect from %s failed: %v", c.nc.RemoteAddr(), err)
+		}
+		return
+	}
+
+	for {
+		if keepAlive > 0 {
+			// Клиент обязан присылать пакет не реже чем раз в keep alive
+			c.nc.SetReadDeadline(time.Now().Add(keepAlive * 3 / 2))
+		}
+		p, err := readPacket(r)
+		if err != nil {
+			return
+		}
+		if err := c.handle(p); err != nil {
+			if err != errDisconnect {
+				log.Printf("mqtt: client %s: %v", c.clientID, err)
+			}
+			return
+		}
+	}
+}
+
+var errDisconnect = errors.New("disconnect")
+
+// handshake принимает CONNECT и отвечает CONNACK; возвращает интервал keep alive
+func (c *conn) handshake(r *bufio.Reader) (time.Duration, error) {
+	c.nc.SetReadDeadline(time.Now().Add(connectTimeout))
+	p, err := readPacket(r)
+	if err != nil {
+		return 0, err
+	}
+	if p.kind != packetConnect {
+		return 0, fmt.Errorf("expected CONNECT, got packet type %d", p.kind)
+	}
+	connect, err := parseConnect(p)
+	if err != nil {
+		return 0, err
+	}
+
+	// Поддерживаются MQTT 3.1.1 и 3.1
+	if !(connect.protocol == "MQTT" && connect.level == 4) && !(connect.protocol == "MQIsdp" && connect.level == 3) {
+		c.write(encodePacket(packetConnack, 0, []byte{0, 1}))
+		return 0, fmt.Errorf("unsupported protocol %s level %d", connect.protocol, connect.level)
+	}
+	if connect.clientID == "" && !connect.cleanSession {
+		c.write(encodePacket(packetConnack, 0, []byte{0, 2}))
+		return 0, errors.New("empty client id requires clean session")
+	}
+
+	c.mu.Lock()
+	c.clientID = connect.clientID
+	c.mu.Unlock()
+	c.nc.SetReadDeadline(time.Time{})
+	// Сессии не сохраняются между соединениями: флаг session present всегда 0
+	if err := c.write(encodePacket(packetConnack, 0, []byte{0, 0})); err != nil {
+		return 0, err
+	}
+	return time.Duration(connect.keepAlive) * time.Second, nil
+}
+
+func (c *conn) handle(p *packet) error {
+	switch p.kind {
+	case packetPublish:
+		return c.handlePublish(p)
+	case packetPuback:
+		packetID, err := parsePacketID(p)
+		if err != nil {
+			return err
+		}
+		c.handlePuback(packetID)
+		return nil
+	case packetSubscribe:
+		return c.handleSubscribe(p)
+	case packetUnsubscribe:
+		return c.handleUnsubscribe(p)
+	case packetPingreq:
+		return c.write(encodePacket(packetPingresp, 0, nil))
+	case packetDisconnect:
+		return errDisconnect
+	default:
+		return fmt.Errorf("unexpected packet type %d", p.kind)
+	}
+}
+
+func (c *conn) handlePublish(p *packet) error {
+	pub, err := parsePublish(p)
+	if err != nil {
+		return err
+	}
+	if pub.qos > 1 {
+		return errors.New("QoS 2 is not supported")
+	}
+	queueName, err := topicToQueue(pub.topic, false)
+	if err != nil {
+		return err
+	}
+
+	msg := &broker.Message{Body: string(pub.payload), Headers: map[string]string{TopicHeader: pub.topic}}
+	err = c.s.qb.Enqueue(queueName, msg)
+	if err != nil && !errors.Is(err, broker.ErrDuplicate) {
+		if pub.qos == 0 {
+			log.Printf("mqtt: client %s: publish to %s dropped: %v", c.clientID, pub.topic, err)
+			return nil
+		}
+		// В MQTT 3.1.1 нет отрицательного PUBACK: соединение разрывается,
+		// и клиент повторит публикацию после переподключения
+		return fmt.Errorf("publish to %s: %w", pub.topic, err)
+	}
+	if pub.qos == 1 {
+		return c.write(encodePacketID(packetPuback, 0, pub.packetID))
+	}
+	return nil
+}
+
+func (c *conn) handleSubscribe(p *packet) error {
+	packetID, subs, err := parseSubscribe(p)
+	if err != nil {
+		return err
+	}
+
+	codes := make([]byte, len(subs))
+	queues := make([]string, len(subs))
+	for i, sub := range subs {
+		queueName, err := topicToQueue(sub.filter, true)
+		if err != nil || sub.qos > 2 {
+			codes[i] = 0x80
+			continue
+		}
+		// QoS 2 понижается до 1
+		codes[i] = min(sub.qos, 1)
+		queues[i] = queueName
+	}
+	body := binary.BigEndian.AppendUint16(nil, packetID)
+	if err := c.write(encodePacket(packetSuback, 0, append(body, codes...))); err != nil {
+		return err
+	}
+
+	for i, sub := range subs {
+		if codes[i] == 0x80 {
+			continue
+		}
+		ctx, cancel := context.WithCancel(c.ctx)
+		c.mu.Lock()
+		if prev := c.subs[sub.filter]; prev != nil {
+			prev()
+		}
+		c.subs[sub.filter] = cancel
+		c.mu.Unlock()
+
+		c.subWg.Add(1)
+		go c.deliver(ctx, queues[i], codes[i])
+	}
+	return nil
+}
+
+func (c *conn) handleUnsubscribe(p *packet) error {
+	packetID, filters, err := parseUnsubscribe(p)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	for _, filter := range filters {
+		if cancel := c.subs[filter]; cancel != nil {
+			cancel()
+			delete(c.subs, filter)
+		}
+	}
+	c.mu.Unlock()
+	return c.write(encodePacketID(packetUnsuback, 0, packetID))
+}
+
+func (c *conn) handlePuback(packetID uint16) {
+	c.mu.Lock()
+	ack, ok := c.pending[packetID]
+	delete(c.pending, packetID)
+	c.mu.Unlock()
+	if !ok {
+		return
+	}
+	<-c.inflight
+	// Ошибка означает, что блокировка истекла и сообщение уже возвращено в очередь
+	c.s.qb.Complete(ack.queue, ack.lockToken)
+}
+
+// deliver выдает сообщения очереди подписчику. Сообщение берется в режиме
+// peek-lock и подтверждается после отправки (QoS 0) или после PUBACK (QoS 1),
+// поэтому при обрыве соединения оно возвращается в очередь.
+func (c *conn) deliver(ctx context.Context, queueName string, qos byte) {
+	defer c.subWg.Done()
+	qb := c.s.qb
+	for {
+		if qos == 1 {
+			select {
+			case c.inflight <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		lockDuration := time.Duration(qb.QueueConfig(queueName).LockDuration) * time.Second
+		delivery, err := qb.PeekLock(queueName, time.Second, lockDuration)
+		if err != nil {
+			if qos == 1 {
+				<-c.inflight
+			}
+			if !errors.Is(err, broker.ErrTimeout) {
+				select {
+				case <-time.After(c.s.retryInterval):
+				case <-ctx.Done():
+					return
+				}
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+		if ctx.Err() != nil {
+			// Блокировка истечет, и сообщение вернется в очередь
+			return
+		}
+
+		pub := &publishPacket{topic: queueToTopic(delivery.Queue), qos: qos, payload: []byte(delivery.Body)}
+		if qos == 1 {
+			c.mu.Lock()
+			pub.packetID = c.nextPacketIDLocked()
+			c.pending[pub.packetID] = pendingAck{queue: delivery.Queue, lockToken: delivery.LockToken}
+			c.mu.Unlock()
+		}
+		if err := c.write(encodePublish(pub)); err != nil {
+			return
+		}
+		if qos == 0 {
+			qb.Complete(delivery.Queue, delivery.LockToken)
+		}
+	}
+}
+
+// nextPacketIDLocked выбирает свободный идентификатор пакета (не 0)
+func (c *conn) nextPacketIDLocked() uint16 {
+	for {
+		c.nextID++
+		if _, used := c.pending[c.nextID]; c.nextID != 0 && !used {
+			return c.nextID
+		}
+	}
+}
+
+func (c *conn) write(data []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err := c.nc.Write(data)
+	return err
+}
+
+// topicToQueue переводит тему MQTT в имя очереди: уровни темы становятся
+// токенами имени (sensors/room1 -> sensors.room1), в фильтрах подписки
+// "+" соответствует "*", а "#" — ">"
+func topicToQueue(topic string, filter bool) (string, error) {
+	if topic == "" {
+		return "", errors.New("empty topic")
+	}
+	levels := strings.Split(topic, "/")
+	for i, level := range levels {
+		switch {
+		case level == "":
+			return "", fmt.Errorf("invalid topic %q: empty level", topic)
+		case strings.ContainsAny(level, ".*>"):
+			return "", fmt.Errorf("invalid topic %q: level contains '.', '*' or '>'", topic)
+		case i == 0 && strings.HasPrefix(level, "@"):
+			// Очереди арендаторов недоступны через MQTT
+			return "", fmt.Errorf("invalid topic %q: reserved prefix '@'", topic)
+		case level == "+" && filter:
+			levels[i] = "*"
+		case level == "#" && filter && i == len(levels)-1:
+			levels[i] = ">"
+		case strings.ContainsAny(level, "+#"):
+			return "", fmt.Errorf("invalid topic %q: misplaced wildcard", topic)
+		}
+	}
+	return strings.Join(levels, "."), nil
+}
+
+// queueToTopic обратное преобразование имени очереди в тему
+func queueToTopic(queueName string) string {
+	return strings.ReplaceAll(queueName, ".", "/")
+}
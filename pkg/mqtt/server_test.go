@@ -0,0 +1,165 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"queue-broker/pkg/broker"
+)
+
+// testClient минимальный MQTT-клиент для тестов
+type testClient struct {
+	t  *testing.T
+	nc net.Conn
+	r  *bufio.Reader
+}
+
+func startServer(t *testing.T, qb *broker.QueueBroker) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(qb)
+	s.retryInterval = 10 * time.Millisecond
+	go s.Serve(l)
+	t.Cleanup(func() { s.Close() })
+	return l.Addr().String()
+}
+
+func dial(t *testing.T, addr, clientID string) *testClient {
+	t.Helper()
+	nc, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { nc.Close() })
+	c := &testClient{t: t, nc: nc, r: bufio.NewReader(nc)}
+
+	body := appendString(nil, "MQTT")
+	body = append(body, 4, 0x02, 0, 60)
+	body = appendString(body, clientID)
+	c.send(encodePacket(packetConnect, 0, body))
+	if p := c.expect(packetConnack); p.body[1] != 0 {
+		t.Fatalf("connection refused with code %d", p.body[1])
+	}
+	return c
+}
+
+func (c *testClient) send(data []byte) {
+	if _, err := c.nc.Write(data); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *testClient) expect(kind byte) *packet {
+	c.t.Helper()
+	c.nc.SetReadDeadline(time.Now().Add(3 * time.Second))
+	p, err := readPacket(c.r)
+	if err != nil {
+		c.t.Fatalf("waiting for packet type %d: %v", kind, err)
+	}
+	if p.kind != kind {
+		c.t.Fatalf("expected packet type %d, got %d", kind, p.kind)
+	}
+	return p
+}
+
+func (c *testClient) subscribe(filter string, qos byte) byte {
+	body := binary.BigEndian.AppendUint16(nil, 1)
+	body = appendString(body, filter)
+	body = append(body, qos)
+	c.send(encodePacket(packetSubscribe, 2, body))
+	p := c.expect(packetSuback)
+	return p.body[2]
+}
+
+// TestPublishEnqueuesMessage проверяет постановку публикаций с QoS 0 и 1 в очередь
+func TestPublishEnqueuesMessage(t *testing.T) {
+	qb := broker.NewQueueBroker(10, 10, 1)
+	c := dial(t, startServer(t, qb), "device-1")
+
+	c.send(encodePublish(&publishPacket{topic: "sensors/room1", qos: 1, packetID: 7, payload: []byte("21.5")}))
+	p := c.expect(packetPuback)
+	if id, _ := parsePacketID(p); id != 7 {
+		t.Errorf("expected PUBACK for packet 7, got %d", id)
+	}
+	c.send(encodePublish(&publishPacket{topic: "sensors/room1", payload: []byte("22.0")}))
+	// PINGREQ гарантирует, что публикация с QoS 0 уже обработана
+	c.send(encodePacket(packetPingreq, 0, nil))
+	c.expect(packetPingresp)
+
+	for _, want := range []string{"21.5", "22.0"} {
+		msg, err := qb.Dequeue("sensors.room1", 0)
+		if err != nil || msg.Body != want || msg.Headers[TopicHeader] != "sensors/room1" {
+			t.Fatalf("unexpected message %+v %v", msg, err)
+		}
+	}
+}
+
+// TestSubscribeDeliversWithQoS1 проверяет доставку подписчику с QoS не выше 1
+func TestSubscribeDeliversWithQoS1(t *testing.T) {
+	qb := broker.NewQueueBroker(10, 10, 1)
+	addr := startServer(t, qb)
+	c := dial(t, addr, "consumer-1")
+
+	if granted := c.subscribe("sensors/+", 2); granted != 1 {
+		t.Fatalf("expected QoS 1 to be granted, got %d", granted)
+	}
+	qb.PutMessage("sensors.room1", "21.5")
+
+	p := c.expect(packetPublish)
+	pub, err := parsePublish(p)
+	if err != nil || pub.topic != "sensors/room1" || string(pub.payload) != "21.5" || pub.qos != 1 {
+		t.Fatalf("unexpected publish %+v %v", pub, err)
+	}
+	c.send(encodePacketID(packetPuback, 0, pub.packetID))
+	c.send(encodePacket(packetPingreq, 0, nil))
+	c.expect(packetPingresp)
+
+	// После PUBACK сообщение удалено и не выдается повторно
+	if _, err := qb.Dequeue("sensors.room1", 0); err == nil {
+		t.Error("expected acknowledged message to be completed")
+	}
+}
+
+// TestUnacknowledgedMessageIsRedelivered проверяет повторную выдачу сообщения без PUBACK
+func TestUnacknowledgedMessageIsRedelivered(t *testing.T) {
+	qb := broker.NewQueueBroker(10, 10, 1)
+	qb.SetQueueConfig("alerts", broker.QueueConfig{LockDuration: 1})
+	addr := startServer(t, qb)
+	qb.PutMessage("alerts", "fire")
+
+	c := dial(t, addr, "consumer-1")
+	c.subscribe("alerts", 1)
+	c.expect(packetPublish)
+	// Соединение разрывается без PUBACK
+	c.nc.Close()
+
+	msg, err := qb.Dequeue("alerts", 3*time.Second)
+	if err != nil || msg.Body != "fire" {
+		t.Fatalf("expected redelivery, got %+v %v", msg, err)
+	}
+}
+
+// TestUnsupportedProtocolLevel проверяет отказ в подключении по MQTT 5
+func TestUnsupportedProtocolLevel(t *testing.T) {
+	qb := broker.NewQueueBroker(10, 10, 1)
+	nc, err := net.Dial("tcp", startServer(t, qb))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	c := &testClient{t: t, nc: nc, r: bufio.NewReader(nc)}
+
+	body := appendString(nil, "MQTT")
+	body = append(body, 5, 0x02, 0, 60)
+	body = appendString(body, "v5")
+	c.send(encodePacket(packetConnect, 0, body))
+	if p := c.expect(packetConnack); p.body[1] != 1 {
+		t.Errorf("expected return code 1, got %d", p.body[1])
+	}
+}
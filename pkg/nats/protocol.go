@@ -0,0 +1,227 @@
+package nats
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxControlLine ограничение длины управляющей строки протокола
+	maxControlLine = 4096
+	// maxPayload ограничение размера сообщения, объявляемое клиентам в INFO
+	maxPayload = 1 << 20
+	// headerVersion первая строка блока заголовков HPUB и HMSG
+	headerVersion = "NATS/1.0"
+)
+
+// protocolError ошибка, о которой клиенту сообщается строкой -ERR;
+// после фатальной ошибки соединение закрывается
+type protocolError struct {
+	msg   string
+	fatal bool
+}
+
+func (e *protocolError) Error() string { return e.msg }
+
+var (
+	errUnknownOp      = &protocolError{"Unknown Protocol Operation", true}
+	errMaxControlLine = &protocolError{"Maximum Control Line Exceeded", true}
+	errMaxPayload     = &protocolError{"Maximum Payload Violation", true}
+	errInvalidArgs    = &protocolError{"Invalid Protocol Arguments", true}
+	errPubSubject     = &protocolError{"Invalid Publish Subject", false}
+	errSubject        = &protocolError{"Invalid Subject", false}
+)
+
+// op операция протокола: имя в верхнем регистре, аргументы управляющей
+// строки и, для CONNECT, PUB и HPUB, данные
+type op struct {
+	name string
+	args []string
+	// header блок заголовков HPUB, payload тело PUB и HPUB
+	header  []byte
+	payload []byte
+	// options JSON из CONNECT
+	options []byte
+}
+
+// readOp читает одну операцию клиента
+func readOp(r *bufio.Reader) (*op, error) {
+	line, err := r.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return nil, errMaxControlLine
+	}
+	if err != nil {
+		return nil, err
+	}
+	text := strings.TrimRight(string(line), "\r\n")
+	name, rest, _ := strings.Cut(text, " ")
+	o := &op{name: strings.ToUpper(name)}
+	switch o.name {
+	case "CONNECT":
+		o.options = []byte(strings.TrimSpace(rest))
+		return o, nil
+	case "PING", "PONG", "+OK", "-ERR":
+		return o, nil
+	case "PUB", "HPUB", "SUB", "UNSUB":
+		o.args = strings.Fields(rest)
+	default:
+		return nil, errUnknownOp
+	}
+
+	switch o.name {
+	case "PUB":
+		// PUB <subject> [reply-to] <#bytes>
+		if len(o.args) != 2 && len(o.args) != 3 {
+			return nil, errInvalidArgs
+		}
+		size, err := payloadSize(o.args[len(o.args)-1])
+		if err != nil {
+			return nil, err
+		}
+		if o.payload, err = readPayload(r, size); err != nil {
+			return nil, err
+		}
+	case "HPUB":
+		// HPUB <subject> [reply-to] <#header bytes> <#total bytes>
+		if len(o.args) != 3 && len(o.args) != 4 {
+			return nil, errInvalidArgs
+		}
+		headerSize, err := payloadSize(o.args[len(o.args)-2])
+		if err != nil {
+			return nil, err
+		}
+		total, err := payloadSize(o.args[len(o.args)-1])
+		if err != nil {
+			return nil, err
+		}
+		if headerSize > total {
+			return nil, errInvalidArgs
+		}
+		data, err := readPayload(r, total)
+		if err != nil {
+			return nil, err
+		}
+		o.header, o.payload = data[:headerSize], data[headerSize:]
+	case "SUB":
+		// SUB <subject> [queue group] <sid>
+		if len(o.args) != 2 && len(o.args) != 3 {
+			return nil, errInvalidArgs
+		}
+	case "UNSUB":
+		// UNSUB <sid> [max_msgs]
+		if len(o.args) != 1 && len(o.args) != 2 {
+			return nil, errInvalidArgs
+		}
+	}
+	return o, nil
+}
+
+func payloadSize(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, errInvalidArgs
+	}
+	if n > maxPayload {
+		return 0, errMaxPayload
+	}
+	return n, nil
+}
+
+// readPayload читает size байт данных и завершающий их CRLF
+func readPayload(r *bufio.Reader, size int) ([]byte, error) {
+	data := make([]byte, size+2)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	if !bytes.HasSuffix(data, []byte("\r\n")) {
+		return nil, errInvalidArgs
+	}
+	return data[:size], nil
+}
+
+// parseHeaders разбирает блок заголовков "NATS/1.0\r\nName: value\r\n\r\n";
+// имена сохраняются как есть, из повторяющихся заголовков остается первый
+func parseHeaders(block []byte) (map[string]string, error) {
+	if len(block) == 0 {
+		return nil, nil
+	}
+	lines := strings.Split(strings.TrimSuffix(string(block), "\r\n\r\n"), "\r\n")
+	if !strings.HasPrefix(lines[0], headerVersion) {
+		return nil, errors.New("invalid header block")
+	}
+	headers := make(map[string]string, len(lines)-1)
+	for _, line := range lines[1:] {
+		name, value, ok := strings.Cut(line, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid header line %q", line)
+		}
+		if _, dup := headers[name]; !dup {
+			headers[name] = strings.TrimSpace(value)
+		}
+	}
+	return headers, nil
+}
+
+// encodeHeaders собирает блок заголовков с именами по алфавиту; заголовки
+// с переводом строки или двоеточием в имени пропускаются
+func encodeHeaders(headers map[string]string) []byte {
+	names := make([]string, 0, len(headers))
+	for name, value := range headers {
+		if !strings.ContainsAny(name, ":\r\n") && !strings.ContainsAny(value, "\r\n") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var b bytes.Buffer
+	b.WriteString(headerVersion + "\r\n")
+	for _, name := range names {
+		b.WriteString(name + ": " + headers[name] + "\r\n")
+	}
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
+
+// encodeMsg собирает MSG или, если есть заголовки, HMSG
+func encodeMsg(subject, sid, reply string, headers map[string]string, payload []byte) []byte {
+	var b bytes.Buffer
+	if reply != "" {
+		reply += " "
+	}
+	if len(headers) == 0 {
+		fmt.Fprintf(&b, "MSG %s %s %s%d\r\n", subject, sid, reply, len(payload))
+	} else {
+		block := encodeHeaders(headers)
+		fmt.Fprintf(&b, "HMSG %s %s %s%d %d\r\n", subject, sid, reply, len(block), len(block)+len(payload))
+		b.Write(block)
+	}
+	b.Write(payload)
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
+
+// serverInfo приветствие сервера INFO
+type serverInfo struct {
+	ServerID   string `json:"server_id"`
+	ServerName string `json:"server_name"`
+	Version    string `json:"version"`
+	Proto      int    `json:"proto"`
+	Headers    bool   `json:"headers"`
+	MaxPayload int    `json:"max_payload"`
+}
+
+func encodeInfo(info serverInfo) []byte {
+	data, _ := json.Marshal(info)
+	return append(append([]byte("INFO "), data...), '\r', '\n')
+}
+
+func encodeErr(e *protocolError) []byte {
+	return []byte("-ERR '" + e.msg + "'\r\n")
+}
@@ -0,0 +1,79 @@
+package nats
+
+import (
+	"bufio"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadOp(t *testing.T) {
+	r := bufio.NewReaderSize(strings.NewReader("pub orders.new _INBOX.1 5\r\nhello\r\n"+
+		"HPUB orders.new 22 27\r\nNATS/1.0\r\nTrace: a\r\n\r\nhello\r\n"+
+		"SUB orders.* workers 7\r\nUNSUB 7 3\r\nPING\r\n"), maxControlLine)
+
+	o, err := readOp(r)
+	if err != nil || o.name != "PUB" || !reflect.DeepEqual(o.args, []string{"orders.new", "_INBOX.1", "5"}) || string(o.payload) != "hello" {
+		t.Fatalf("unexpected PUB %+v, %v", o, err)
+	}
+	o, err = readOp(r)
+	if err != nil || o.name != "HPUB" || string(o.payload) != "hello" {
+		t.Fatalf("unexpected HPUB %+v, %v", o, err)
+	}
+	headers, err := parseHeaders(o.header)
+	if err != nil || !reflect.DeepEqual(headers, map[string]string{"Trace": "a"}) {
+		t.Errorf("unexpected headers %v, %v", headers, err)
+	}
+	for _, want := range []string{"SUB", "UNSUB", "PING"} {
+		if o, err = readOp(r); err != nil || o.name != want {
+			t.Fatalf("expected %s, got %+v, %v", want, o, err)
+		}
+	}
+}
+
+func TestReadOpErrors(t *testing.T) {
+	for input, want := range map[string]error{
+		"FOO bar\r\n":          errUnknownOp,
+		"PUB a\r\n":            errInvalidArgs,
+		"PUB a 2\r\nabc\r\n":   errInvalidArgs,
+		"PUB a 2000000\r\n":    errMaxPayload,
+		"HPUB a 5 2\r\nab\r\n": errInvalidArgs,
+		"PUB " + strings.Repeat("a", maxControlLine) + " 1\r\n": errMaxControlLine,
+	} {
+		_, err := readOp(bufio.NewReaderSize(strings.NewReader(input), maxControlLine))
+		if !errors.Is(err, want) {
+			t.Errorf("%.20q: expected %v, got %v", input, want, err)
+		}
+	}
+}
+
+func TestEncodeMsg(t *testing.T) {
+	if got := string(encodeMsg("a.b", "1", "", nil, []byte("hi"))); got != "MSG a.b 1 2\r\nhi\r\n" {
+		t.Errorf("unexpected MSG %q", got)
+	}
+	if got := string(encodeMsg("a.b", "1", "reply", nil, []byte("hi"))); got != "MSG a.b 1 reply 2\r\nhi\r\n" {
+		t.Errorf("unexpected MSG with reply %q", got)
+	}
+	got := string(encodeMsg("a.b", "1", "", map[string]string{"k": "v", "bad": "x\r\ny"}, []byte("hi")))
+	if got != "HMSG a.b 1 18 20\r\nNATS/1.0\r\nk: v\r\n\r\nhi\r\n" {
+		t.Errorf("unexpected HMSG %q", got)
+	}
+}
+
+func TestValidSubject(t *testing.T) {
+	for subject, want := range map[string][2]bool{
+		"orders.new": {true, true},
+		"orders.*":   {false, true},
+		"orders.>":   {false, true},
+		"orders.>.x": {false, false},
+		"orders..x":  {false, false},
+		"ord*":       {false, false},
+		"@acme.jobs": {false, false},
+		"":           {false, false},
+	} {
+		if got := [2]bool{validSubject(subject, false), validSubject(subject, true)}; got != want {
+			t.Errorf("%q: expected %v, got %v", subject, want, got)
+		}
+	}
+}
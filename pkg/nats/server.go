@@ -0,0 +1,408 @@
+// Package nats реализует адаптер брокера очередей для клиентов NATS (core
+// protocol: CONNECT, PUB, HPUB, SUB, UNSUB, MSG, HMSG, PING/PONG): публикация
+// в тему ставит сообщение в одноименную очередь, подписка получает сообщения
+// очереди или очередей по шаблону.
+package nats
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"queue-broker/pkg/broker"
+)
+
+// ReplyHeader заголовок, в котором сохраняется адрес ответа из PUB
+const ReplyHeader = "nats-reply-to"
+
+// connectTimeout время ожидания первой операции после установки соединения
+const connectTimeout = 10 * time.Second
+
+// Server NATS-сервер поверх брокера
+type Server struct {
+	qb *broker.QueueBroker
+	id string
+	// retryInterval пауза перед повторной попыткой получить сообщение
+	// из еще не созданной очереди
+	retryInterval time.Duration
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[*conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// NewServer создает NATS-сервер для брокера
+func NewServer(qb *broker.QueueBroker) *Server {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return &Server{
+		qb:            qb,
+		id:            strings.ToUpper(hex.EncodeToString(id)),
+		retryInterval: time.Second,
+		listeners:     make(map[net.Listener]struct{}),
+		conns:         make(map[*conn]struct{}),
+	}
+}
+
+// ListenAndServe принимает соединения на адресе addr
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve принимает соединения, пока не будет вызван Close
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return errors.New("server closed")
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+
+		c := newConn(s, nc)
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			nc.Close()
+			return nil
+		}
+		s.conns[c] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go func() {
+			defer s.wg.Done()
+			c.serve()
+			s.mu.Lock()
+			delete(s.conns, c)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// Close закрывает слушатели и все соединения
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for c := range s.conns {
+		c.nc.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return nil
+}
+
+// conn соединение с клиентом NATS
+type conn struct {
+	s  *Server
+	nc net.Conn
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	subWg  sync.WaitGroup
+
+	writeMu sync.Mutex
+
+	mu   sync.Mutex
+	name string
+	// verbose клиент ждет +OK на каждую операцию
+	verbose bool
+	// headers клиент принимает HMSG
+	headers bool
+	subs    map[string]*subscription
+}
+
+// subscription подписка клиента
+type subscription struct {
+	sid       string
+	queueName string
+	cancel    context.CancelFunc
+	// max число сообщений, после которого подписка снимается (0 — без ограничения)
+	max       int
+	delivered int
+}
+
+// connectOptions поля CONNECT, которые учитывает сервер
+type connectOptions struct {
+	Verbose bool   `json:"verbose"`
+	Headers bool   `json:"headers"`
+	Name    string `json:"name"`
+}
+
+func newConn(s *Server, nc net.Conn) *conn {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &conn{
+		s:      s,
+		nc:     nc,
+		ctx:    ctx,
+		cancel: cancel,
+		subs:   make(map[string]*subscription),
+	}
+}
+
+func (c *conn) serve() {
+	defer func() {
+		c.cancel()
+		c.nc.Close()
+		// Невыданные сообщения остаются в очередях, выдаваемое вернется
+		// по истечении блокировки
+		c.subWg.Wait()
+	}()
+
+	info := serverInfo{ServerID: c.s.id, ServerName: "queue-broker", Version: "2.10.0", Proto: 1, Headers: true, MaxPayload: maxPayload}
+	if err := c.write(encodeInfo(info)); err != nil {
+		return
+	}
+	r := bufio.NewReaderSize(c.nc, maxControlLine)
+	c.nc.SetReadDeadline(time.Now().Add(connectTimeout))
+	for {
+		o, err := readOp(r)
+		if err == nil {
+			// Клиенты NATS сами проверяют связь PING, поэтому после первой
+			// операции срок чтения не ограничивается
+			c.nc.SetReadDeadline(time.Time{})
+			err = c.handle(o)
+		}
+		var perr *protocolError
+		if errors.As(err, &perr) {
+			c.write(encodeErr(perr))
+			if !perr.fatal {
+				continue
+			}
+			log.Printf("nats: client %s: %v", c.clientName(), err)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (c *conn) clientName() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.name != "" {
+		return c.name
+	}
+	return c.nc.RemoteAddr().String()
+}
+
+func (c *conn) handle(o *op) error {
+	switch o.name {
+	case "CONNECT":
+		var opts connectOptions
+		if err := json.Unmarshal(o.options, &opts); err != nil {
+			return errInvalidArgs
+		}
+		c.mu.Lock()
+		c.verbose, c.headers, c.name = opts.Verbose, opts.Headers, opts.Name
+		c.mu.Unlock()
+	case "PING":
+		return c.write([]byte("PONG\r\n"))
+	case "PONG", "+OK", "-ERR":
+		return nil
+	case "PUB", "HPUB":
+		if err := c.handlePublish(o); err != nil {
+			return err
+		}
+	case "SUB":
+		if err := c.handleSubscribe(o); err != nil {
+			return err
+		}
+	case "UNSUB":
+		if err := c.handleUnsubscribe(o); err != nil {
+			return err
+		}
+	}
+	c.mu.Lock()
+	verbose := c.verbose
+	c.mu.Unlock()
+	if verbose {
+		return c.write([]byte("+OK\r\n"))
+	}
+	return nil
+}
+
+func (c *conn) handlePublish(o *op) error {
+	subject := o.args[0]
+	if !validSubject(subject, false) {
+		return errPubSubject
+	}
+	headers, err := parseHeaders(o.header)
+	if err != nil {
+		return errInvalidArgs
+	}
+	if headers == nil {
+		headers = make(map[string]string)
+	}
+	if minArgs := map[string]int{"PUB": 2, "HPUB": 3}[o.name]; len(o.args) > minArgs {
+		headers[ReplyHeader] = o.args[1]
+	}
+
+	err = c.s.qb.Enqueue(subject, &broker.Message{Body: string(o.payload), Headers: headers})
+	if err != nil && !errors.Is(err, broker.ErrDuplicate) {
+		// Публикация в NATS не подтверждается, поэтому сообщение только
+		// записывается в журнал, как при QoS 0 в MQTT
+		log.Printf("nats: client %s: publish to %s dropped: %v", c.clientName(), subject, err)
+	}
+	return nil
+}
+
+func (c *conn) handleSubscribe(o *op) error {
+	subject, sid := o.args[0], o.args[len(o.args)-1]
+	if !validSubject(subject, true) {
+		return errSubject
+	}
+	ctx, cancel := context.WithCancel(c.ctx)
+	sub := &subscription{sid: sid, queueName: subject, cancel: cancel}
+	c.mu.Lock()
+	if prev := c.subs[sid]; prev != nil {
+		prev.cancel()
+	}
+	c.subs[sid] = sub
+	c.mu.Unlock()
+
+	c.subWg.Add(1)
+	go c.deliver(ctx, sub)
+	return nil
+}
+
+func (c *conn) handleUnsubscribe(o *op) error {
+	sid := o.args[0]
+	limit := 0
+	if len(o.args) == 2 {
+		var err error
+		if limit, err = strconv.Atoi(o.args[1]); err != nil || limit < 0 {
+			return errInvalidArgs
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	sub := c.subs[sid]
+	if sub == nil {
+		return nil
+	}
+	if limit > 0 && sub.delivered < limit {
+		sub.max = limit
+		return nil
+	}
+	sub.cancel()
+	delete(c.subs, sid)
+	return nil
+}
+
+// deliver выдает сообщения очереди подписчику. Сообщение берется в режиме
+// peek-lock и подтверждается после отправки, поэтому при обрыве соединения
+// во время записи оно возвращается в очередь.
+func (c *conn) deliver(ctx context.Context, sub *subscription) {
+	defer c.subWg.Done()
+	qb := c.s.qb
+	for {
+		lockDuration := time.Duration(qb.QueueConfig(sub.queueName).LockDuration) * time.Second
+		delivery, err := qb.PeekLock(sub.queueName, time.Second, lockDuration)
+		if err != nil {
+			if !errors.Is(err, broker.ErrTimeout) {
+				select {
+				case <-time.After(c.s.retryInterval):
+				case <-ctx.Done():
+					return
+				}
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+		if ctx.Err() != nil {
+			// Блокировка истечет, и сообщение вернется в очередь
+			return
+		}
+
+		c.mu.Lock()
+		withHeaders := c.headers
+		c.mu.Unlock()
+		headers := make(map[string]string, len(delivery.Headers))
+		for name, value := range delivery.Headers {
+			if name != ReplyHeader && withHeaders {
+				headers[name] = value
+			}
+		}
+		data := encodeMsg(delivery.Queue, sub.sid, delivery.Headers[ReplyHeader], headers, []byte(delivery.Body))
+		if err := c.write(data); err != nil {
+			return
+		}
+		qb.Complete(delivery.Queue, delivery.LockToken)
+
+		c.mu.Lock()
+		sub.delivered++
+		done := sub.max > 0 && sub.delivered >= sub.max
+		if done && c.subs[sub.sid] == sub {
+			delete(c.subs, sub.sid)
+		}
+		c.mu.Unlock()
+		if done {
+			sub.cancel()
+			return
+		}
+	}
+}
+
+func (c *conn) write(data []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err := c.nc.Write(data)
+	return err
+}
+
+// validSubject проверяет тему: непустые токены через точку без пробелов;
+// в подписке допускаются "*" вместо токена и ">" последним токеном.
+// Очереди арендаторов (префикс "@") через NATS недоступны.
+func validSubject(subject string, wildcards bool) bool {
+	if subject == "" || strings.HasPrefix(subject, "@") || strings.ContainsAny(subject, " \t\r\n") {
+		return false
+	}
+	tokens := strings.Split(subject, ".")
+	for i, token := range tokens {
+		switch {
+		case token == "":
+			return false
+		case token == "*" || token == ">" && i == len(tokens)-1:
+			if !wildcards {
+				return false
+			}
+		case strings.ContainsAny(token, "*>"):
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,168 @@
+package nats
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"queue-broker/pkg/broker"
+)
+
+// testClient минимальный клиент NATS для тестов
+type testClient struct {
+	t  *testing.T
+	nc net.Conn
+	r  *bufio.Reader
+}
+
+func startServer(t *testing.T, qb *broker.QueueBroker) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(qb)
+	s.retryInterval = 10 * time.Millisecond
+	go s.Serve(l)
+	t.Cleanup(func() { s.Close() })
+	return l.Addr().String()
+}
+
+func dial(t *testing.T, addr, connect string) *testClient {
+	t.Helper()
+	nc, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { nc.Close() })
+	c := &testClient{t: t, nc: nc, r: bufio.NewReader(nc)}
+	if line := c.line(); !strings.HasPrefix(line, "INFO {") || !strings.Contains(line, `"headers":true`) {
+		t.Fatalf("unexpected greeting %q", line)
+	}
+	c.send("CONNECT " + connect + "\r\nPING\r\n")
+	if strings.Contains(connect, `"verbose":true`) {
+		if line := c.line(); line != "+OK" {
+			t.Fatalf("expected +OK, got %q", line)
+		}
+	}
+	if line := c.line(); line != "PONG" {
+		t.Fatalf("expected PONG, got %q", line)
+	}
+	return c
+}
+
+func (c *testClient) send(data string) {
+	if _, err := c.nc.Write([]byte(data)); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *testClient) line() string {
+	c.t.Helper()
+	c.nc.SetReadDeadline(time.Now().Add(3 * time.Second))
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		c.t.Fatalf("reading line: %v", err)
+	}
+	return strings.TrimRight(line, "\r\n")
+}
+
+// message читает MSG или HMSG и возвращает управляющую строку и данные
+func (c *testClient) message() (string, string) {
+	c.t.Helper()
+	control := c.line()
+	fields := strings.Fields(control)
+	if len(fields) < 4 || fields[0] != "MSG" && fields[0] != "HMSG" {
+		c.t.Fatalf("expected MSG, got %q", control)
+	}
+	size, _ := strconv.Atoi(fields[len(fields)-1])
+	buf := make([]byte, size+2)
+	if _, err := io.ReadFull(c.r, buf); err != nil {
+		c.t.Fatal(err)
+	}
+	return control, string(buf[:size])
+}
+
+func TestPublishAndSubscribe(t *testing.T) {
+	qb := broker.NewQueueBroker(10, 10, 1)
+	addr := startServer(t, qb)
+
+	pub := dial(t, addr, `{"verbose":true}`)
+	pub.send("PUB orders.new _INBOX.42 5\r\nhello\r\n")
+	if line := pub.line(); line != "+OK" {
+		t.Fatalf("expected +OK, got %q", line)
+	}
+	deadline := time.Now().Add(time.Second)
+	for qb.Depth("orders.new") == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	sub := dial(t, addr, `{}`)
+	sub.send("SUB orders.* 1\r\n")
+	control, payload := sub.message()
+	if control != "MSG orders.new 1 _INBOX.42 5" || payload != "hello" {
+		t.Errorf("unexpected message %q %q", control, payload)
+	}
+
+	// Заголовки передаются только клиентам, объявившим headers
+	hsub := dial(t, addr, `{"headers":true}`)
+	hsub.send("SUB events 9\r\n")
+	pub.send("HPUB events 24 26\r\nNATS/1.0\r\nTrace: abc\r\n\r\nhi\r\n")
+	control, payload = hsub.message()
+	if !strings.HasPrefix(control, "HMSG events 9 ") || !strings.Contains(payload, "Trace: abc\r\n") || !strings.HasSuffix(payload, "hi") {
+		t.Errorf("unexpected message %q %q", control, payload)
+	}
+	if depth := qb.Depth("events"); depth != 0 {
+		t.Errorf("delivered message must be completed, depth %d", depth)
+	}
+}
+
+func TestUnsubscribeAfterMessages(t *testing.T) {
+	qb := broker.NewQueueBroker(10, 10, 1)
+	addr := startServer(t, qb)
+	for _, body := range []string{"1", "2", "3"} {
+		qb.Enqueue("jobs", &broker.Message{Body: body})
+	}
+
+	c := dial(t, addr, `{}`)
+	c.send("SUB jobs 5\r\nUNSUB 5 2\r\n")
+	for range 2 {
+		c.message()
+	}
+	c.send("PING\r\n")
+	if line := c.line(); line != "PONG" {
+		t.Fatalf("expected only 2 messages, got %q", line)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if depth := qb.Depth("jobs"); depth != 1 {
+		t.Errorf("expected 1 message left, got %d", depth)
+	}
+}
+
+func TestProtocolErrors(t *testing.T) {
+	qb := broker.NewQueueBroker(10, 10, 1)
+	addr := startServer(t, qb)
+	c := dial(t, addr, `{}`)
+
+	// Недопустимая тема не разрывает соединение
+	c.send("PUB orders.* 1\r\nx\r\nPING\r\n")
+	if line := c.line(); line != "-ERR 'Invalid Publish Subject'" {
+		t.Fatalf("unexpected reply %q", line)
+	}
+	if line := c.line(); line != "PONG" {
+		t.Fatalf("expected PONG, got %q", line)
+	}
+
+	c.send("BOGUS\r\n")
+	if line := c.line(); line != "-ERR 'Unknown Protocol Operation'" {
+		t.Fatalf("unexpected reply %q", line)
+	}
+	c.nc.SetReadDeadline(time.Now().Add(3 * time.Second))
+	if _, err := c.r.ReadByte(); err == nil {
+		t.Error("connection must be closed after fatal error")
+	}
+}
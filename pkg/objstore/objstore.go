@@ -0,0 +1,135 @@
+// Package objstore сохраняет объекты (снимки брокера, большие тела сообщений)
+// в каталоге локальной файловой системы или в бакете S3-совместимого хранилища.
+package objstore
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotFound объекта с таким ключом нет
+var ErrNotFound = errors.New("object not found")
+
+// Store хранилище объектов по ключам вида a/b/c.json
+type Store interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+	// Location возвращает расположение объекта в том же виде, в каком
+	// его принимает ReadObject: путь к файлу или s3://bucket/key
+	Location(key string) string
+}
+
+// Open возвращает хранилище по расположению: s3://bucket[/prefix] — бакет S3
+// (параметры доступа берутся из переменных окружения, см. S3FromEnv),
+// иначе — каталог файловой системы
+func Open(location string) (Store, error) {
+	if rest, ok := strings.CutPrefix(location, "s3://"); ok {
+		bucket, prefix, _ := strings.Cut(rest, "/")
+		if bucket == "" {
+			return nil, errors.New("s3 location without bucket")
+		}
+		return S3FromEnv(bucket, prefix), nil
+	}
+	if location == "" {
+		return nil, errors.New("empty location")
+	}
+	return Dir{Path: location}, nil
+}
+
+// ReadObject читает объект по полному расположению (путь к файлу
+// или s3://bucket/key)
+func ReadObject(ctx context.Context, location string) ([]byte, error) {
+	var dir, key string
+	if rest, ok := strings.CutPrefix(location, "s3://"); ok {
+		bucket, name, _ := strings.Cut(rest, "/")
+		if bucket == "" || name == "" {
+			return nil, errors.New("s3 location without key")
+		}
+		dir, key = "s3://"+bucket, name
+	} else {
+		dir, key = filepath.Split(location)
+		if dir == "" {
+			dir = "."
+		}
+	}
+	store, err := Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	return store.Get(ctx, key)
+}
+
+// Dir хранит объекты файлами в каталоге; ключ — путь файла относительно каталога
+type Dir struct {
+	Path string
+}
+
+func (d Dir) file(key string) (string, error) {
+	if !filepath.IsLocal(filepath.FromSlash(key)) {
+		return "", errors.New("invalid object key")
+	}
+	return filepath.Join(d.Path, filepath.FromSlash(key)), nil
+}
+
+// Put записывает объект. Файл сначала пишется во временный и сбрасывается
+// на диск, поэтому частично записанный объект не принимается за полный.
+func (d Dir) Put(_ context.Context, key string, data []byte) error {
+	name, err := d.file(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".object-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// Get читает объект
+func (d Dir) Get(_ context.Context, key string) ([]byte, error) {
+	name, err := d.file(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+// Delete удаляет объект; отсутствие объекта не считается ошибкой
+func (d Dir) Delete(_ context.Context, key string) error {
+	name, err := d.file(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Location возвращает путь к файлу объекта
+func (d Dir) Location(key string) string {
+	return filepath.Join(d.Path, filepath.FromSlash(key))
+}
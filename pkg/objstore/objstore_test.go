@@ -0,0 +1,59 @@
+package objstore
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// TestDir проверяет хранение объектов в каталоге и чтение по расположению
+func TestDir(t *testing.T) {
+	dir := t.TempDir()
+	store, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := store.Put(ctx, "snapshots/a.json", []byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	location := store.Location("snapshots/a.json")
+	if location != filepath.Join(dir, "snapshots", "a.json") {
+		t.Errorf("unexpected location %s", location)
+	}
+	if data, err := ReadObject(ctx, location); err != nil || string(data) != "data" {
+		t.Fatalf("unexpected read: %q, %v", data, err)
+	}
+	if err := store.Put(ctx, "../escape", nil); err == nil {
+		t.Error("key outside directory should be rejected")
+	}
+	if err := store.Delete(ctx, "snapshots/a.json"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(ctx, "snapshots/a.json"); err != nil {
+		t.Errorf("repeated delete: %v", err)
+	}
+	if _, err := store.Get(ctx, "snapshots/a.json"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+// TestOpen проверяет разбор расположений
+func TestOpen(t *testing.T) {
+	store, err := Open("s3://backups/broker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s3, ok := store.(*S3); !ok || s3.Bucket != "backups" || s3.Prefix != "broker" {
+		t.Errorf("unexpected store %#v", store)
+	}
+	for _, location := range []string{"", "s3://"} {
+		if _, err := Open(location); err == nil {
+			t.Errorf("%q: expected error", location)
+		}
+	}
+	if _, err := ReadObject(context.Background(), "s3://backups"); err == nil {
+		t.Error("location without key should be rejected")
+	}
+}
@@ -0,0 +1,276 @@
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3 хранит объекты в бакете S3-совместимого хранилища (AWS S3, MinIO,
+// GCS в режиме совместимости с HMAC-ключами). Запросы подписываются
+// по схеме AWS Signature Version 4, адрес объекта — в стиле пути
+// (endpoint/bucket/key).
+type S3 struct {
+	// Endpoint адрес хранилища, по умолчанию https://s3.<region>.amazonaws.com
+	Endpoint string
+	Region   string
+	Bucket   string
+	// Prefix добавляется к ключам объектов
+	Prefix       string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	Client       *http.Client
+}
+
+// S3FromEnv возвращает хранилище с параметрами из переменных окружения
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN, AWS_REGION
+// (по умолчанию us-east-1) и AWS_ENDPOINT_URL
+func S3FromEnv(bucket, prefix string) *S3 {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = "us-east-1"
+	}
+	return &S3{
+		Endpoint:     os.Getenv("AWS_ENDPOINT_URL"),
+		Region:       region,
+		Bucket:       bucket,
+		Prefix:       prefix,
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+func (s *S3) endpoint() string {
+	if s.Endpoint != "" {
+		return strings.TrimRight(s.Endpoint, "/")
+	}
+	return "https://s3." + s.Region + ".amazonaws.com"
+}
+
+func (s *S3) objectKey(key string) string {
+	if s.Prefix == "" {
+		return key
+	}
+	return strings.TrimRight(s.Prefix, "/") + "/" + key
+}
+
+// Put записывает объект
+func (s *S3) Put(ctx context.Context, key string, data []byte) error {
+	resp, err := s.do(ctx, http.MethodPut, key, data)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Get читает объект
+func (s *S3) Get(ctx context.Context, key string) ([]byte, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// Delete удаляет объект; отсутствие объекта не считается ошибкой
+func (s *S3) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Location возвращает расположение объекта в виде s3://bucket/key
+func (s *S3) Location(key string) string {
+	return "s3://" + s.Bucket + "/" + s.objectKey(key)
+}
+
+// do выполняет подписанный запрос к объекту; ответ не из 2xx превращается в ошибку
+func (s *S3) do(ctx context.Context, method, key string, body []byte) (*http.Response, error) {
+	escaped := "/" + awsEscape(s.Bucket, false) + "/" + awsEscape(s.objectKey(key), true)
+	req, err := http.NewRequestWithContext(ctx, method, s.endpoint()+escaped, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.URL.RawPath = escaped
+	sum := sha256.Sum256(body)
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+	signV4(req, hex.EncodeToString(sum[:]), s.Region, s.AccessKey, s.SecretKey, time.Now())
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("s3 %s %s: %s", method, s.Location(key), resp.Status)
+	}
+	return resp, nil
+}
+
+// signV4 подписывает запрос к S3 по схеме AWS Signature Version 4: подписываются
+// Host, Content-Type, Range и все заголовки X-Amz-*
+func signV4(req *http.Request, payloadHash, region, accessKey, secretKey string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "content-type" || lower == "range" {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + region + "/s3/aws4_request"
+	signature := signature(secretKey, region, amzDate, canonicalRequest)
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", accessKey, scope, signedHeaders, signature))
+}
+
+// Presign возвращает ссылку с подписью для загрузки объекта без ключей
+// доступа, действующую expires (не больше 7 дней)
+func (s *S3) Presign(key string, expires time.Duration) (string, error) {
+	if expires <= 0 || expires > 7*24*time.Hour {
+		return "", errors.New("presign expiry must be between 1s and 7 days")
+	}
+	escaped := "/" + awsEscape(s.Bucket, false) + "/" + awsEscape(s.objectKey(key), true)
+	u, err := url.Parse(s.endpoint() + escaped)
+	if err != nil {
+		return "", err
+	}
+	u.RawPath = escaped
+	return presignURL(u, s.Region, s.AccessKey, s.SecretKey, s.SessionToken, expires, time.Now()), nil
+}
+
+// presignURL добавляет к адресу объекта параметры подписи для GET
+func presignURL(u *url.URL, region, accessKey, secretKey, sessionToken string, expires time.Duration, now time.Time) string {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	query := url.Values{
+		"X-Amz-Algorithm":     {"AWS4-HMAC-SHA256"},
+		"X-Amz-Credential":    {accessKey + "/" + now.Format("20060102") + "/" + region + "/s3/aws4_request"},
+		"X-Amz-Date":          {amzDate},
+		"X-Amz-Expires":       {strconv.Itoa(int(expires.Seconds()))},
+		"X-Amz-SignedHeaders": {"host"},
+	}
+	if sessionToken != "" {
+		query.Set("X-Amz-Security-Token", sessionToken)
+	}
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet,
+		u.EscapedPath(),
+		canonicalQuery(query),
+		"host:" + u.Host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	signed := *u
+	signed.RawQuery = canonicalQuery(query) + "&X-Amz-Signature=" + signature(secretKey, region, amzDate, canonicalRequest)
+	return signed.String()
+}
+
+// signature подписывает канонический запрос ключом, производным от секрета,
+// даты и региона
+func signature(secretKey, region, amzDate, canonicalRequest string) string {
+	date := amzDate[:8]
+	scope := date + "/" + region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func canonicalQuery(query map[string][]string) string {
+	var pairs []string
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, awsEscape(name, false)+"="+awsEscape(value, false))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// awsEscape кодирует строку для канонического запроса: без изменений остаются
+// только A-Z, a-z, 0-9, '-', '.', '_', '~' и, если keepSlash, косая черта
+func awsEscape(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '.', c == '_', c == '~':
+			b.WriteByte(c)
+		case c == '/' && keepSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
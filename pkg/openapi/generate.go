@@ -0,0 +1,285 @@
+// Package openapi генерирует Go-код клиента по спецификации OpenAPI 3 HTTP API
+// брокера: структуры для схем из components.schemas и описания операций
+// (метод и шаблон пути) для каждого operationId.
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Header первая строка сгенерированного файла
+const Header = "// Code generated by openapi-gen from pkg/httpapi/openapi.json. DO NOT EDIT."
+
+// schema подмножество схемы OpenAPI, которое понимает генератор
+type schema struct {
+	Ref                  string         `json:"$ref"`
+	Type                 string         `json:"type"`
+	Format               string         `json:"format"`
+	Description          string         `json:"description"`
+	Required             []string       `json:"required"`
+	Properties           orderedSchemas `json:"properties"`
+	Items                *schema        `json:"items"`
+	AdditionalProperties *schema        `json:"additionalProperties"`
+}
+
+// orderedSchemas схемы свойств в порядке объявления: порядок полей
+// сгенерированной структуры совпадает с порядком в спецификации
+type orderedSchemas struct {
+	names   []string
+	schemas map[string]*schema
+}
+
+func (o *orderedSchemas) UnmarshalJSON(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return errors.New("properties must be an object")
+	}
+	o.schemas = make(map[string]*schema)
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		name := token.(string)
+		var s schema
+		if err := decoder.Decode(&s); err != nil {
+			return fmt.Errorf("property %s: %w", name, err)
+		}
+		o.names = append(o.names, name)
+		o.schemas[name] = &s
+	}
+	_, err := decoder.Token()
+	return err
+}
+
+type operation struct {
+	OperationID string `json:"operationId"`
+	Summary     string `json:"summary"`
+}
+
+type document struct {
+	OpenAPI    string                                `json:"openapi"`
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]*schema `json:"schemas"`
+	} `json:"components"`
+}
+
+// methods методы HTTP в элементе пути; остальные ключи (parameters и др.) пропускаются
+var methods = map[string]string{
+	"get": "GET", "put": "PUT", "post": "POST", "delete": "DELETE", "patch": "PATCH", "head": "HEAD",
+}
+
+// Generate возвращает отформатированный исходный код пакета pkg по спецификации spec
+func Generate(spec []byte, pkg string) ([]byte, error) {
+	var doc document
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		return nil, fmt.Errorf("parse spec: %w", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		return nil, fmt.Errorf("unsupported openapi version %q", doc.OpenAPI)
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s\n\npackage %s\n\n", Header, pkg)
+	switch imports := importsOf(doc.Components.Schemas); len(imports) {
+	case 0:
+	case 1:
+		fmt.Fprintf(&b, "import %q\n\n", imports[0])
+	default:
+		b.WriteString("import (\n")
+		for _, path := range imports {
+			fmt.Fprintf(&b, "\t%q\n", path)
+		}
+		b.WriteString(")\n\n")
+	}
+
+	names := sortedKeys(doc.Components.Schemas)
+	for _, name := range names {
+		if err := writeSchema(&b, name, doc.Components.Schemas[name]); err != nil {
+			return nil, err
+		}
+	}
+
+	b.WriteString("// operation операция HTTP API: метод и шаблон пути с параметрами в фигурных скобках\n")
+	b.WriteString("type operation struct {\n\tmethod string\n\tpath   string\n}\n\n")
+	b.WriteString("// Операции HTTP API\nvar (\n")
+	seen := make(map[string]bool)
+	for _, path := range sortedKeys(doc.Paths) {
+		item := doc.Paths[path]
+		for _, key := range sortedKeys(item) {
+			method, ok := methods[key]
+			if !ok {
+				continue
+			}
+			var op operation
+			if err := json.Unmarshal(item[key], &op); err != nil {
+				return nil, fmt.Errorf("%s %s: %w", method, path, err)
+			}
+			if op.OperationID == "" {
+				return nil, fmt.Errorf("%s %s: missing operationId", method, path)
+			}
+			if seen[op.OperationID] {
+				return nil, fmt.Errorf("duplicate operationId %s", op.OperationID)
+			}
+			seen[op.OperationID] = true
+			if op.Summary != "" {
+				fmt.Fprintf(&b, "\t// op%s %s\n", exportName(op.OperationID), comment(op.Summary))
+			}
+			fmt.Fprintf(&b, "\top%s = operation{%q, %q}\n", exportName(op.OperationID), method, path)
+		}
+	}
+	b.WriteString(")\n")
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated code: %w", err)
+	}
+	return src, nil
+}
+
+func writeSchema(b *bytes.Buffer, name string, s *schema) error {
+	if s.Type != "object" {
+		return fmt.Errorf("schema %s: only object schemas are supported", name)
+	}
+	if s.Description != "" {
+		fmt.Fprintf(b, "// %s %s\n", name, comment(s.Description))
+	}
+	fmt.Fprintf(b, "type %s struct {\n", name)
+	required := make(map[string]bool)
+	for _, field := range s.Required {
+		required[field] = true
+	}
+	for _, field := range s.Properties.names {
+		prop := s.Properties.schemas[field]
+		goType, err := typeOf(prop)
+		if err != nil {
+			return fmt.Errorf("schema %s, property %s: %w", name, field, err)
+		}
+		if prop.Description != "" {
+			fmt.Fprintf(b, "\t// %s %s\n", fieldName(field), comment(prop.Description))
+		}
+		tag := field
+		if !required[field] {
+			tag += ",omitempty"
+		}
+		fmt.Fprintf(b, "\t%s %s `json:%q`\n", fieldName(field), goType, tag)
+	}
+	b.WriteString("}\n\n")
+	return nil
+}
+
+// typeOf возвращает тип Go для схемы свойства
+func typeOf(s *schema) (string, error) {
+	if s.Ref != "" {
+		name, ok := strings.CutPrefix(s.Ref, "#/components/schemas/")
+		if !ok {
+			return "", fmt.Errorf("unsupported $ref %s", s.Ref)
+		}
+		return name, nil
+	}
+	switch s.Type {
+	case "string":
+		if s.Format == "date-time" {
+			return "time.Time", nil
+		}
+		return "string", nil
+	case "integer":
+		switch s.Format {
+		case "int64":
+			return "int64", nil
+		case "uint64":
+			return "uint64", nil
+		}
+		return "int", nil
+	case "number":
+		return "float64", nil
+	case "boolean":
+		return "bool", nil
+	case "":
+		// Схема без типа допускает любое значение JSON
+		return "json.RawMessage", nil
+	case "array":
+		if s.Items == nil {
+			return "", errors.New("array without items")
+		}
+		item, err := typeOf(s.Items)
+		return "[]" + item, err
+	case "object":
+		if s.AdditionalProperties == nil {
+			return "", errors.New("inline objects are not supported, use $ref")
+		}
+		value, err := typeOf(s.AdditionalProperties)
+		return "map[string]" + value, err
+	}
+	return "", fmt.Errorf("unsupported type %q", s.Type)
+}
+
+// importsOf возвращает пакеты, нужные типам свойств схем, по алфавиту
+func importsOf(schemas map[string]*schema) []string {
+	used := make(map[string]bool)
+	for _, s := range schemas {
+		for _, prop := range s.Properties.schemas {
+			switch goType, _ := typeOf(prop); {
+			case strings.Contains(goType, "time.Time"):
+				used["time"] = true
+			case strings.Contains(goType, "json.RawMessage"):
+				used["encoding/json"] = true
+			}
+		}
+	}
+	return sortedKeys(used)
+}
+
+// initialisms части имен, которые по соглашениям Go пишутся заглавными
+var initialisms = map[string]string{"id": "ID", "url": "URL", "ttl": "TTL", "api": "API", "http": "HTTP"}
+
+// fieldName превращает имя свойства в snake_case в имя поля Go: dedup_id — DedupID
+func fieldName(name string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(name, "_") {
+		if upper, ok := initialisms[part]; ok {
+			b.WriteString(upper)
+			continue
+		}
+		b.WriteString(exportName(part))
+	}
+	return b.String()
+}
+
+// comment превращает описание из спецификации в продолжение комментария
+// после имени: первая буква становится строчной, если это не аббревиатура
+func comment(description string) string {
+	r := []rune(description)
+	if len(r) > 1 && unicode.IsUpper(r[1]) {
+		return description
+	}
+	r[0] = unicode.ToLower(r[0])
+	return string(r)
+}
+
+// exportName делает первую букву заглавной: putMessage — PutMessage
+func exportName(name string) string {
+	if name == "" {
+		return name
+	}
+	r := []rune(name)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,80 @@
+package openapi
+
+import (
+	"strings"
+	"testing"
+)
+
+const testSpec = `{
+  "openapi": "3.0.3",
+  "paths": {
+    "/queue/{name}": {
+      "parameters": [{"name": "name", "in": "path"}],
+      "get": {"operationId": "getMessage", "summary": "Получить сообщение"}
+    }
+  },
+  "components": {
+    "schemas": {
+      "Item": {
+        "type": "object",
+        "description": "Элемент",
+        "required": ["id"],
+        "properties": {
+          "id": {"type": "integer", "format": "uint64"},
+          "dedup_id": {"type": "string", "description": "Ключ дедупликации"},
+          "at": {"type": "string", "format": "date-time"},
+          "tags": {"type": "array", "items": {"type": "string"}},
+          "headers": {"type": "object", "additionalProperties": {"type": "string"}},
+          "next": {"$ref": "#/components/schemas/Item"},
+          "extra": {"description": "Произвольные данные"}
+        }
+      }
+    }
+  }
+}`
+
+// TestGenerate проверяет структуры схем и описания операций
+func TestGenerate(t *testing.T) {
+	src, err := Generate([]byte(testSpec), "client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := string(src)
+	for _, want := range []string{
+		Header,
+		"package client",
+		"import (\n\t\"encoding/json\"\n\t\"time\"\n)",
+		"// Item элемент\ntype Item struct {",
+		"ID uint64 `json:\"id\"`",
+		"// DedupID ключ дедупликации\n\tDedupID string `json:\"dedup_id,omitempty\"`",
+		"At time.Time `json:\"at,omitempty\"`",
+		"Tags []string `json:\"tags,omitempty\"`",
+		"Headers map[string]string `json:\"headers,omitempty\"`",
+		"Next Item `json:\"next,omitempty\"`",
+		"// Extra произвольные данные\n\tExtra json.RawMessage `json:\"extra,omitempty\"`",
+		"// opGetMessage получить сообщение\n\topGetMessage = operation{\"GET\", \"/queue/{name}\"}",
+	} {
+		if !strings.Contains(strings.Join(strings.Fields(code), " "), strings.Join(strings.Fields(want), " ")) {
+			t.Errorf("generated code lacks %q:\n%s", want, code)
+		}
+	}
+	// Поля идут в порядке спецификации, а не по алфавиту
+	if strings.Index(code, "DedupID") > strings.Index(code, "At ") {
+		t.Error("fields are not in spec order")
+	}
+}
+
+// TestGenerateErrors проверяет отказ на неподдерживаемых спецификациях
+func TestGenerateErrors(t *testing.T) {
+	for name, spec := range map[string]string{
+		"version":      `{"openapi": "2.0"}`,
+		"operation id": `{"openapi": "3.0.0", "paths": {"/a": {"get": {}}}}`,
+		"duplicate":    `{"openapi": "3.0.0", "paths": {"/a": {"get": {"operationId": "x"}, "put": {"operationId": "x"}}}}`,
+		"inline":       `{"openapi": "3.0.0", "components": {"schemas": {"A": {"type": "object", "properties": {"b": {"type": "object"}}}}}}`,
+		"not object":   `{"openapi": "3.0.0", "components": {"schemas": {"A": {"type": "string"}}}}`,
+	} {
+		if _, err := Generate([]byte(spec), "client"); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+// Package peer проверяет запросы между брокерами: поток репликации,
+// переключение резерва, федерацию регионов и обмен узлов кластера. Брокеры
+// передают общий секрет в заголовке Header; без настроенного секрета
+// межброкерные маршруты закрыты.
+package peer
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"queue-broker/pkg/httperr"
+)
+
+// Header заголовок с общим секретом брокеров
+const Header = "X-Broker-Peer-Secret"
+
+// Sign добавляет секрет к запросу другому брокеру
+func Sign(req *http.Request, secret string) {
+	if secret != "" {
+		req.Header.Set(Header, secret)
+	}
+}
+
+// Valid сообщает, передан ли в запросе секрет secret
+func Valid(r *http.Request, secret string) bool {
+	got := r.Header.Get(Header)
+	return secret != "" && subtle.ConstantTimeCompare([]byte(got), []byte(secret)) == 1
+}
+
+// Require пропускает к next только запросы с секретом secret
+func Require(secret string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !Valid(r, secret) {
+			httperr.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,30 @@
+package peer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestRequire проверяет допуск запросов только с общим секретом
+func TestRequire(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	cases := []struct {
+		name, configured, sent string
+		want                   int
+	}{
+		{"matching secret", "s3cret", "s3cret", http.StatusOK},
+		{"wrong secret", "s3cret", "guess", http.StatusUnauthorized},
+		{"no secret sent", "s3cret", "", http.StatusUnauthorized},
+		{"not configured", "", "", http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest("GET", "/cluster/nodes", nil)
+		Sign(req, tc.sent)
+		rr := httptest.NewRecorder()
+		Require(tc.configured, ok).ServeHTTP(rr, req)
+		if rr.Code != tc.want {
+			t.Errorf("%s: expected %d, got %d", tc.name, tc.want, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,830 @@
+// Package raft реализует алгоритм консенсуса Raft (Ongaro, Ousterhout, «In
+// Search of an Understandable Consensus Algorithm»): узлы выбирают лидера,
+// лидер передает журнал записей остальным и считает запись зафиксированной,
+// когда она сохранена на большинстве узлов, а зафиксированные записи
+// применяются к автомату состояний каждого узла в одном и том же порядке.
+// Состав кластера задается при запуске и не меняется; журнал сжимается
+// снимками автомата состояний.
+package raft
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultElectionTimeout   = time.Second
+	defaultSnapshotThreshold = 8192
+	defaultMaxAppendEntries  = 256
+	// snapshotTimeout сколько ждать передачи снимка отставшему узлу
+	snapshotTimeout = 30 * time.Second
+	// applyBatch сколько записей применяется за один проход
+	applyBatch = 256
+)
+
+var (
+	// ErrNotLeader узел не является лидером указанного срока
+	ErrNotLeader = errors.New("raft: not the leader")
+	// ErrLeadershipLost узел перестал быть лидером до применения записи;
+	// запись могла быть как зафиксирована, так и отброшена
+	ErrLeadershipLost = errors.New("raft: leadership lost")
+	// ErrStopped узел остановлен
+	ErrStopped = errors.New("raft: node stopped")
+)
+
+// State роль узла
+type State int
+
+const (
+	Follower State = iota
+	Candidate
+	Leader
+)
+
+func (s State) String() string {
+	switch s {
+	case Candidate:
+		return "candidate"
+	case Leader:
+		return "leader"
+	}
+	return "follower"
+}
+
+// Entry запись журнала. Запись без данных добавляет лидер в начале своего
+// срока: ее применение означает, что все записи прежних сроков применены.
+type Entry struct {
+	Index uint64 `json:"index"`
+	Term  uint64 `json:"term"`
+	Data  []byte `json:"data"`
+}
+
+// StateMachine автомат состояний, к которому применяются зафиксированные
+// записи. Все методы вызываются из одной горутины узла по порядку.
+type StateMachine interface {
+	// Apply применяет зафиксированную запись с данными
+	Apply(entry Entry)
+	// Snapshot возвращает состояние после последней примененной записи
+	Snapshot() ([]byte, error)
+	// Restore заменяет состояние снимком
+	Restore(data []byte) error
+	// LeadershipChanged сообщает, что узел стал лидером срока term и все
+	// записи прежних сроков применены (leader — true), или перестал им быть
+	LeadershipChanged(leader bool, term uint64)
+}
+
+// Config настройки узла
+type Config struct {
+	// ID адрес узла, по которому к нему обращаются остальные
+	ID string
+	// Peers адреса остальных узлов кластера
+	Peers []string
+	// Dir каталог, в котором хранятся срок, голос, журнал и снимок
+	Dir string
+	// Transport передача запросов другим узлам (по умолчанию HTTPTransport без секрета)
+	Transport Transport
+	// ElectionTimeout через сколько без вестей от лидера начинаются выборы;
+	// фактическое время выбирается случайно от ElectionTimeout до
+	// 2*ElectionTimeout (по умолчанию 1 с)
+	ElectionTimeout time.Duration
+	// HeartbeatInterval период пустых AppendEntries лидера (по умолчанию
+	// ElectionTimeout/10)
+	HeartbeatInterval time.Duration
+	// SnapshotThreshold после скольких примененных записей журнал сжимается
+	// снимком (по умолчанию 8192)
+	SnapshotThreshold uint64
+	// MaxAppendEntries сколько записей передается одним AppendEntries (по умолчанию 256)
+	MaxAppendEntries int
+}
+
+// Status состояние узла
+type Status struct {
+	ID            string `json:"id"`
+	State         string `json:"state"`
+	Term          uint64 `json:"term"`
+	Leader        string `json:"leader,omitempty"`
+	LastIndex     uint64 `json:"last_index"`
+	CommitIndex   uint64 `json:"commit_index"`
+	LastApplied   uint64 `json:"last_applied"`
+	SnapshotIndex uint64 `json:"snapshot_index"`
+}
+
+// Node узел кластера Raft
+type Node struct {
+	cfg       Config
+	peers     []string
+	fsm       StateMachine
+	transport Transport
+	store     *storage
+
+	mu sync.Mutex
+	// applyCond будит применение записей
+	applyCond *sync.Cond
+	// changed закрывается и заменяется при каждом изменении состояния узла
+	changed chan struct{}
+
+	state    State
+	term     uint64
+	votedFor string
+	leader   string
+
+	// log записи после снимка: log[i] имеет индекс snapIndex+1+i
+	log       []Entry
+	snapIndex uint64
+	snapTerm  uint64
+	snapshot  []byte
+
+	commitIndex uint64
+	lastApplied uint64
+	// restore снимок принят от лидера и еще не передан автомату состояний
+	restore bool
+	// fsmTerm срок, лидерство в котором сообщено автомату состояний (0 — не лидер)
+	fsmTerm uint64
+
+	// contact когда узел последний раз слышал лидера или отдал голос
+	contact time.Time
+	timeout time.Duration
+
+	nextIndex  map[string]uint64
+	matchIndex map[string]uint64
+	wake       map[string]chan struct{}
+	// leaderStop закрывается, когда узел перестает быть лидером
+	leaderStop chan struct{}
+
+	stopped bool
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// New открывает узел: восстанавливает из каталога срок, голос, снимок (он
+// сразу передается автомату состояний) и журнал. Узел начинает участвовать
+// в выборах после Start.
+func New(cfg Config, fsm StateMachine) (*Node, error) {
+	if cfg.ID == "" {
+		return nil, errors.New("raft: node id is required")
+	}
+	if cfg.Dir == "" {
+		return nil, errors.New("raft: data directory is required")
+	}
+	if cfg.ElectionTimeout <= 0 {
+		cfg.ElectionTimeout = defaultElectionTimeout
+	}
+	if cfg.HeartbeatInterval <= 0 {
+		cfg.HeartbeatInterval = cfg.ElectionTimeout / 10
+	}
+	if cfg.SnapshotThreshold == 0 {
+		cfg.SnapshotThreshold = defaultSnapshotThreshold
+	}
+	if cfg.MaxAppendEntries <= 0 {
+		cfg.MaxAppendEntries = defaultMaxAppendEntries
+	}
+	if cfg.Transport == nil {
+		cfg.Transport = NewHTTPTransport("")
+	}
+	cfg.ID = strings.TrimRight(cfg.ID, "/")
+	var peers []string
+	for _, p := range cfg.Peers {
+		if p = strings.TrimRight(strings.TrimSpace(p), "/"); p != "" && p != cfg.ID && !slices.Contains(peers, p) {
+			peers = append(peers, p)
+		}
+	}
+
+	store, saved, err := openStorage(cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+	if saved.snapIndex > 0 {
+		if err := fsm.Restore(saved.snapshot); err != nil {
+			store.close()
+			return nil, err
+		}
+	}
+	n := &Node{
+		cfg:         cfg,
+		peers:       peers,
+		fsm:         fsm,
+		transport:   cfg.Transport,
+		store:       store,
+		changed:     make(chan struct{}),
+		term:        saved.term,
+		votedFor:    saved.vote,
+		log:         saved.entries,
+		snapIndex:   saved.snapIndex,
+		snapTerm:    saved.snapTerm,
+		snapshot:    saved.snapshot,
+		commitIndex: saved.snapIndex,
+		lastApplied: saved.snapIndex,
+		done:        make(chan struct{}),
+	}
+	n.applyCond = sync.NewCond(&n.mu)
+	n.resetTimerLocked()
+	return n, nil
+}
+
+// Start запускает выборы по таймеру и применение зафиксированных записей
+func (n *Node) Start() {
+	n.wg.Add(2)
+	go n.run()
+	go n.applyLoop()
+}
+
+// Close останавливает узел и закрывает файлы журнала
+func (n *Node) Close() {
+	n.mu.Lock()
+	if n.stopped {
+		n.mu.Unlock()
+		return
+	}
+	n.stopped = true
+	if n.state == Leader {
+		close(n.leaderStop)
+		n.wake = nil
+	}
+	n.state = Follower
+	close(n.done)
+	n.signalLocked()
+	n.mu.Unlock()
+	n.wg.Wait()
+	n.store.close()
+}
+
+// ID возвращает адрес узла
+func (n *Node) ID() string {
+	return n.cfg.ID
+}
+
+// Leader возвращает адрес известного узлу лидера ("" — лидер неизвестен)
+func (n *Node) Leader() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.leader
+}
+
+// Status возвращает роль, срок и индексы журнала узла
+func (n *Node) Status() Status {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return Status{
+		ID:            n.cfg.ID,
+		State:         n.state.String(),
+		Term:          n.term,
+		Leader:        n.leader,
+		LastIndex:     n.lastIndexLocked(),
+		CommitIndex:   n.commitIndex,
+		LastApplied:   n.lastApplied,
+		SnapshotIndex: n.snapIndex,
+	}
+}
+
+// Propose добавляет запись с данными data в журнал лидера срока term и
+// возвращает ее индекс; о фиксации записи сообщает Wait
+func (n *Node) Propose(data []byte, term uint64) (uint64, error) {
+	if data == nil {
+		data = []byte{}
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.stopped {
+		return 0, ErrStopped
+	}
+	if n.state != Leader || n.term != term {
+		return 0, ErrNotLeader
+	}
+	entry := Entry{Index: n.lastIndexLocked() + 1, Term: n.term, Data: data}
+	if err := n.appendLocked([]Entry{entry}); err != nil {
+		return 0, err
+	}
+	for _, wake := range n.wake {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+	n.advanceCommitLocked()
+	return entry.Index, nil
+}
+
+// Wait ждет, пока запись index, предложенная узлом в сроке term, будет
+// применена. ErrLeadershipLost означает, что узел перестал быть лидером
+// раньше: запись могла быть как зафиксирована, так и отброшена.
+func (n *Node) Wait(ctx context.Context, index, term uint64) error {
+	for {
+		n.mu.Lock()
+		if n.stopped {
+			n.mu.Unlock()
+			return ErrStopped
+		}
+		if n.state != Leader || n.term != term {
+			n.mu.Unlock()
+			return ErrLeadershipLost
+		}
+		if n.lastApplied >= index {
+			n.mu.Unlock()
+			return nil
+		}
+		changed := n.changed
+		n.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// signalLocked будит применение записей и ожидающих изменения состояния
+func (n *Node) signalLocked() {
+	n.applyCond.Broadcast()
+	close(n.changed)
+	n.changed = make(chan struct{})
+}
+
+func (n *Node) resetTimerLocked() {
+	n.contact = time.Now()
+	n.timeout = n.cfg.ElectionTimeout + rand.N(n.cfg.ElectionTimeout)
+}
+
+func (n *Node) lastIndexLocked() uint64 {
+	return n.snapIndex + uint64(len(n.log))
+}
+
+func (n *Node) lastTermLocked() uint64 {
+	if len(n.log) == 0 {
+		return n.snapTerm
+	}
+	return n.log[len(n.log)-1].Term
+}
+
+// termAtLocked срок записи index; 0 — записи нет в журнале
+func (n *Node) termAtLocked(index uint64) uint64 {
+	switch {
+	case index == n.snapIndex:
+		return n.snapTerm
+	case index < n.snapIndex || index > n.lastIndexLocked():
+		return 0
+	}
+	return n.log[index-n.snapIndex-1].Term
+}
+
+// appendLocked сохраняет записи на диске и добавляет их в журнал
+func (n *Node) appendLocked(entries []Entry) error {
+	if err := n.store.append(entries); err != nil {
+		log.Printf("raft: append to log: %v", err)
+		return err
+	}
+	n.log = append(n.log, entries...)
+	return nil
+}
+
+// truncateLocked отбрасывает записи, начиная с index
+func (n *Node) truncateLocked(index uint64) error {
+	kept := n.log[:index-n.snapIndex-1]
+	if err := n.store.rewrite(kept); err != nil {
+		log.Printf("raft: truncate log: %v", err)
+		return err
+	}
+	n.log = slices.Clip(kept)
+	return nil
+}
+
+func (n *Node) persistStateLocked() error {
+	err := n.store.saveState(n.term, n.votedFor)
+	if err != nil {
+		log.Printf("raft: save state: %v", err)
+	}
+	return err
+}
+
+// stepDownLocked делает узел ведомым срока term (не меньше текущего)
+func (n *Node) stepDownLocked(term uint64) {
+	if term > n.term {
+		n.term, n.votedFor = term, ""
+		n.persistStateLocked()
+		n.leader = ""
+	}
+	if n.state == Leader {
+		close(n.leaderStop)
+		n.wake = nil
+		n.leader = ""
+	}
+	n.state = Follower
+	n.signalLocked()
+}
+
+// run начинает выборы, если лидер долго молчит
+func (n *Node) run() {
+	defer n.wg.Done()
+	ticker := time.NewTicker(max(n.cfg.ElectionTimeout/20, time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-n.done:
+			return
+		case <-ticker.C:
+		}
+		n.mu.Lock()
+		if n.state != Leader && time.Since(n.contact) >= n.timeout {
+			n.startElectionLocked()
+		}
+		n.mu.Unlock()
+	}
+}
+
+func (n *Node) startElectionLocked() {
+	n.resetTimerLocked()
+	n.state, n.leader = Candidate, ""
+	n.term++
+	n.votedFor = n.cfg.ID
+	if n.persistStateLocked() != nil {
+		n.state = Follower
+		return
+	}
+	n.signalLocked()
+
+	term := n.term
+	req := &VoteRequest{Term: term, Candidate: n.cfg.ID, LastLogIndex: n.lastIndexLocked(), LastLogTerm: n.lastTermLocked()}
+	votes := 1
+	if votes*2 > len(n.peers)+1 {
+		n.becomeLeaderLocked()
+		return
+	}
+	for _, p := range n.peers {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), n.cfg.ElectionTimeout)
+			defer cancel()
+			resp, err := n.transport.RequestVote(ctx, p, req)
+			if err != nil {
+				return
+			}
+			n.mu.Lock()
+			defer n.mu.Unlock()
+			if resp.Term > n.term {
+				n.stepDownLocked(resp.Term)
+				return
+			}
+			if n.state != Candidate || n.term != term || !resp.Granted {
+				return
+			}
+			if votes++; votes*2 > len(n.peers)+1 {
+				n.becomeLeaderLocked()
+			}
+		}()
+	}
+}
+
+// becomeLeaderLocked делает узел лидером текущего срока: в журнал
+// добавляется пустая запись срока, с фиксацией которой фиксируются и все
+// записи прежних сроков
+func (n *Node) becomeLeaderLocked() {
+	if n.stopped {
+		return
+	}
+	n.state, n.leader = Leader, n.cfg.ID
+	n.leaderStop = make(chan struct{})
+	n.nextIndex = make(map[string]uint64, len(n.peers))
+	n.matchIndex = make(map[string]uint64, len(n.peers))
+	n.wake = make(map[string]chan struct{}, len(n.peers))
+	if err := n.appendLocked([]Entry{{Index: n.lastIndexLocked() + 1, Term: n.term}}); err != nil {
+		n.stepDownLocked(n.term)
+		return
+	}
+	log.Printf("raft: %s is the leader of term %d", n.cfg.ID, n.term)
+	for _, p := range n.peers {
+		n.nextIndex[p] = n.lastIndexLocked()
+		wake := make(chan struct{}, 1)
+		n.wake[p] = wake
+		n.wg.Add(1)
+		go n.replicate(p, n.term, n.leaderStop, wake)
+	}
+	n.advanceCommitLocked()
+	n.signalLocked()
+}
+
+// replicate передает журнал лидера узлу p, пока узел остается лидером срока term
+func (n *Node) replicate(p string, term uint64, stop <-chan struct{}, wake <-chan struct{}) {
+	defer n.wg.Done()
+	ticker := time.NewTicker(n.cfg.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		if n.sendAppend(p, term) {
+			select {
+			case <-stop:
+				return
+			default:
+				continue
+			}
+		}
+		select {
+		case <-stop:
+			return
+		case <-wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// sendAppend передает узлу p очередные записи или снимок; true — узлу
+// передано не все, и следующий запрос нужно отправить сразу
+func (n *Node) sendAppend(p string, term uint64) bool {
+	n.mu.Lock()
+	if n.state != Leader || n.term != term {
+		n.mu.Unlock()
+		return false
+	}
+	next := n.nextIndex[p]
+	if next <= n.snapIndex {
+		req := &SnapshotRequest{Term: term, Leader: n.cfg.ID, Index: n.snapIndex, LastTerm: n.snapTerm, Data: n.snapshot}
+		n.mu.Unlock()
+		ctx, cancel := context.WithTimeout(context.Background(), snapshotTimeout)
+		defer cancel()
+		resp, err := n.transport.InstallSnapshot(ctx, p, req)
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		if err != nil {
+			return false
+		}
+		if resp.Term > n.term {
+			n.stepDownLocked(resp.Term)
+			return false
+		}
+		if n.state != Leader || n.term != term {
+			return false
+		}
+		n.matchIndex[p] = max(n.matchIndex[p], req.Index)
+		n.nextIndex[p] = n.matchIndex[p] + 1
+		n.advanceCommitLocked()
+		return true
+	}
+
+	prev := next - 1
+	end := min(n.lastIndexLocked(), prev+uint64(n.cfg.MaxAppendEntries))
+	req := &AppendRequest{
+		Term:         term,
+		Leader:       n.cfg.ID,
+		PrevLogIndex: prev,
+		PrevLogTerm:  n.termAtLocked(prev),
+		Entries:      slices.Clone(n.log[prev-n.snapIndex : end-n.snapIndex]),
+		LeaderCommit: n.commitIndex,
+	}
+	n.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), n.cfg.ElectionTimeout)
+	defer cancel()
+	resp, err := n.transport.AppendEntries(ctx, p, req)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err != nil {
+		return false
+	}
+	if resp.Term > n.term {
+		n.stepDownLocked(resp.Term)
+		return false
+	}
+	if n.state != Leader || n.term != term {
+		return false
+	}
+	if !resp.Success {
+		// Ведомый подсказывает, с какой записи журналы расходятся
+		next := prev
+		if resp.ConflictIndex > 0 && resp.ConflictIndex < next {
+			next = resp.ConflictIndex
+		}
+		n.nextIndex[p] = max(next, 1)
+		return true
+	}
+	n.matchIndex[p] = max(n.matchIndex[p], prev+uint64(len(req.Entries)))
+	n.nextIndex[p] = n.matchIndex[p] + 1
+	n.advanceCommitLocked()
+	return n.nextIndex[p] <= n.lastIndexLocked()
+}
+
+// advanceCommitLocked фиксирует записи текущего срока, сохраненные на
+// большинстве узлов (вместе с ними фиксируются и все предыдущие)
+func (n *Node) advanceCommitLocked() {
+	if n.state != Leader {
+		return
+	}
+	matches := []uint64{n.lastIndexLocked()}
+	for _, p := range n.peers {
+		matches = append(matches, n.matchIndex[p])
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i] > matches[j] })
+	index := matches[len(matches)/2]
+	if index > n.commitIndex && n.termAtLocked(index) == n.term {
+		n.commitIndex = index
+		n.signalLocked()
+	}
+}
+
+// leadershipLostLocked автомат состояний считает узел лидером, а он им уже не является
+func (n *Node) leadershipLostLocked() bool {
+	return n.fsmTerm != 0 && (n.state != Leader || n.term != n.fsmTerm)
+}
+
+// applyLoop передает автомату состояний зафиксированные записи, принятые
+// снимки и смену лидерства, а также сжимает журнал снимками
+func (n *Node) applyLoop() {
+	defer n.wg.Done()
+	for {
+		n.mu.Lock()
+		for !n.stopped && !n.restore && !n.leadershipLostLocked() && n.lastApplied >= n.commitIndex {
+			n.applyCond.Wait()
+		}
+		if n.stopped {
+			n.mu.Unlock()
+			return
+		}
+		if n.leadershipLostLocked() {
+			n.fsmTerm = 0
+			n.mu.Unlock()
+			n.fsm.LeadershipChanged(false, 0)
+			continue
+		}
+		if n.restore {
+			n.restore = false
+			data, index := n.snapshot, n.snapIndex
+			n.mu.Unlock()
+			if err := n.fsm.Restore(data); err != nil {
+				log.Printf("raft: restore snapshot %d: %v", index, err)
+			}
+			n.mu.Lock()
+			n.lastApplied = max(n.lastApplied, index)
+			n.signalLocked()
+			n.mu.Unlock()
+			continue
+		}
+
+		start := n.lastApplied + 1
+		end := min(n.commitIndex, n.lastApplied+applyBatch)
+		entries := slices.Clone(n.log[start-n.snapIndex-1 : end-n.snapIndex])
+		n.mu.Unlock()
+		for _, entry := range entries {
+			if entry.Data != nil {
+				n.fsm.Apply(entry)
+				continue
+			}
+			n.mu.Lock()
+			lead := n.state == Leader && n.term == entry.Term
+			if lead {
+				n.fsmTerm = entry.Term
+			}
+			n.mu.Unlock()
+			if lead {
+				n.fsm.LeadershipChanged(true, entry.Term)
+			}
+		}
+
+		n.mu.Lock()
+		n.lastApplied = max(n.lastApplied, end)
+		n.signalLocked()
+		compact := !n.restore && n.lastApplied-n.snapIndex >= n.cfg.SnapshotThreshold
+		index, term := n.lastApplied, n.termAtLocked(n.lastApplied)
+		n.mu.Unlock()
+		if compact {
+			n.takeSnapshot(index, term)
+		}
+	}
+}
+
+// takeSnapshot сохраняет снимок автомата состояний после записи index и
+// отбрасывает записи журнала до нее
+func (n *Node) takeSnapshot(index, term uint64) {
+	data, err := n.fsm.Snapshot()
+	if err != nil {
+		log.Printf("raft: snapshot: %v", err)
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	// Пока снимок готовился, лидер мог передать более новый
+	if index <= n.snapIndex {
+		return
+	}
+	rest := slices.Clone(n.log[index-n.snapIndex:])
+	if err := n.store.saveSnapshot(index, term, data, rest); err != nil {
+		log.Printf("raft: save snapshot: %v", err)
+		return
+	}
+	n.snapIndex, n.snapTerm, n.snapshot, n.log = index, term, data, rest
+}
+
+// RequestVote обрабатывает запрос голоса кандидата
+func (n *Node) RequestVote(req *VoteRequest) *VoteResponse {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if req.Term > n.term {
+		n.stepDownLocked(req.Term)
+	}
+	resp := &VoteResponse{Term: n.term}
+	if req.Term < n.term {
+		return resp
+	}
+	lastTerm := n.lastTermLocked()
+	upToDate := req.LastLogTerm > lastTerm || req.LastLogTerm == lastTerm && req.LastLogIndex >= n.lastIndexLocked()
+	if (n.votedFor == "" || n.votedFor == req.Candidate) && upToDate {
+		n.votedFor = req.Candidate
+		if n.persistStateLocked() != nil {
+			n.votedFor = ""
+			return resp
+		}
+		resp.Granted = true
+		n.resetTimerLocked()
+	}
+	return resp
+}
+
+// AppendEntries обрабатывает записи (или пустой запрос-пульс) лидера
+func (n *Node) AppendEntries(req *AppendRequest) *AppendResponse {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	resp := &AppendResponse{Term: n.term}
+	if req.Term < n.term {
+		return resp
+	}
+	if req.Term > n.term || n.state != Follower {
+		n.stepDownLocked(req.Term)
+	}
+	if n.leader != req.Leader {
+		n.leader = req.Leader
+		n.signalLocked()
+	}
+	n.resetTimerLocked()
+	resp.Term = n.term
+
+	if req.PrevLogIndex > n.lastIndexLocked() {
+		resp.ConflictIndex = n.lastIndexLocked() + 1
+		return resp
+	}
+	prev, prevTerm, entries := req.PrevLogIndex, req.PrevLogTerm, req.Entries
+	// Записи до снимка зафиксированы и совпадают с записями лидера
+	if prev < n.snapIndex {
+		skip := min(n.snapIndex-prev, uint64(len(entries)))
+		entries = entries[skip:]
+		prev, prevTerm = n.snapIndex, n.snapTerm
+	}
+	if term := n.termAtLocked(prev); term != prevTerm {
+		index := prev
+		for index > n.snapIndex+1 && n.termAtLocked(index-1) == term {
+			index--
+		}
+		resp.ConflictIndex = index
+		return resp
+	}
+	for len(entries) > 0 && entries[0].Index <= n.lastIndexLocked() && n.termAtLocked(entries[0].Index) == entries[0].Term {
+		entries = entries[1:]
+	}
+	if len(entries) > 0 {
+		if entries[0].Index <= n.lastIndexLocked() && n.truncateLocked(entries[0].Index) != nil {
+			return resp
+		}
+		if n.appendLocked(entries) != nil {
+			return resp
+		}
+	}
+	if commit := min(req.LeaderCommit, req.PrevLogIndex+uint64(len(req.Entries))); commit > n.commitIndex {
+		n.commitIndex = commit
+		n.signalLocked()
+	}
+	resp.Success = true
+	return resp
+}
+
+// InstallSnapshot принимает снимок лидера для узла, отставшего больше, чем
+// на хранимую лидером часть журнала
+func (n *Node) InstallSnapshot(req *SnapshotRequest) *SnapshotResponse {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	resp := &SnapshotResponse{Term: n.term}
+	if req.Term < n.term {
+		return resp
+	}
+	if req.Term > n.term || n.state != Follower {
+		n.stepDownLocked(req.Term)
+	}
+	n.leader = req.Leader
+	n.resetTimerLocked()
+	resp.Term = n.term
+	if req.Index <= n.commitIndex {
+		return resp
+	}
+	// Записи после снимка сохраняются, если журнал совпадает с ним
+	var rest []Entry
+	if req.Index < n.lastIndexLocked() && n.termAtLocked(req.Index) == req.LastTerm {
+		rest = slices.Clone(n.log[req.Index-n.snapIndex:])
+	}
+	if err := n.store.saveSnapshot(req.Index, req.LastTerm, req.Data, rest); err != nil {
+		log.Printf("raft: save snapshot: %v", err)
+		return resp
+	}
+	n.snapIndex, n.snapTerm, n.snapshot, n.log = req.Index, req.LastTerm, req.Data, rest
+	n.commitIndex = req.Index
+	n.restore = true
+	n.signalLocked()
+	return resp
+}
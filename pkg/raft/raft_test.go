@@ -0,0 +1,358 @@
+package raft
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testFSM автомат состояний теста: список данных примененных записей
+type testFSM struct {
+	mu       sync.Mutex
+	data     []string
+	leader   bool
+	restores int
+}
+
+func (f *testFSM) Apply(entry Entry) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.data = append(f.data, string(entry.Data))
+}
+
+func (f *testFSM) Snapshot() ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return json.Marshal(f.data)
+}
+
+func (f *testFSM) Restore(data []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.restores++
+	f.data = nil
+	return json.Unmarshal(data, &f.data)
+}
+
+func (f *testFSM) LeadershipChanged(leader bool, _ uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.leader = leader
+}
+
+func (f *testFSM) applied() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.data)
+}
+
+// network соединяет узлы теста без HTTP; отключенный узел не получает и не
+// отправляет запросы
+type network struct {
+	mu    sync.Mutex
+	nodes map[string]*Node
+	down  map[string]bool
+}
+
+type localTransport struct {
+	net  *network
+	from string
+}
+
+func (t *localTransport) node(to string) (*Node, error) {
+	t.net.mu.Lock()
+	defer t.net.mu.Unlock()
+	node := t.net.nodes[to]
+	if node == nil || t.net.down[to] || t.net.down[t.from] {
+		return nil, errors.New("unreachable")
+	}
+	return node, nil
+}
+
+func (t *localTransport) RequestVote(_ context.Context, to string, req *VoteRequest) (*VoteResponse, error) {
+	node, err := t.node(to)
+	if err != nil {
+		return nil, err
+	}
+	return node.RequestVote(req), nil
+}
+
+func (t *localTransport) AppendEntries(_ context.Context, to string, req *AppendRequest) (*AppendResponse, error) {
+	node, err := t.node(to)
+	if err != nil {
+		return nil, err
+	}
+	return node.AppendEntries(req), nil
+}
+
+func (t *localTransport) InstallSnapshot(_ context.Context, to string, req *SnapshotRequest) (*SnapshotResponse, error) {
+	node, err := t.node(to)
+	if err != nil {
+		return nil, err
+	}
+	return node.InstallSnapshot(req), nil
+}
+
+func (net *network) setDown(id string, down bool) {
+	net.mu.Lock()
+	defer net.mu.Unlock()
+	net.down[id] = down
+}
+
+type cluster struct {
+	t     *testing.T
+	net   *network
+	ids   []string
+	dirs  map[string]string
+	nodes map[string]*Node
+	fsms  map[string]*testFSM
+	cfg   Config
+}
+
+func newCluster(t *testing.T, size int, cfg Config) *cluster {
+	c := &cluster{
+		t:     t,
+		net:   &network{nodes: make(map[string]*Node), down: make(map[string]bool)},
+		dirs:  make(map[string]string),
+		nodes: make(map[string]*Node),
+		fsms:  make(map[string]*testFSM),
+		cfg:   cfg,
+	}
+	for i := range size {
+		id := fmt.Sprintf("node-%d", i+1)
+		c.ids = append(c.ids, id)
+		c.dirs[id] = t.TempDir()
+	}
+	for _, id := range c.ids {
+		c.start(id)
+	}
+	t.Cleanup(func() {
+		for _, node := range c.nodes {
+			node.Close()
+		}
+	})
+	return c
+}
+
+func (c *cluster) start(id string) {
+	cfg := c.cfg
+	cfg.ID, cfg.Peers, cfg.Dir = id, c.ids, c.dirs[id]
+	cfg.Transport = &localTransport{net: c.net, from: id}
+	if cfg.ElectionTimeout == 0 {
+		cfg.ElectionTimeout = 100 * time.Millisecond
+	}
+	fsm := &testFSM{}
+	node, err := New(cfg, fsm)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.net.mu.Lock()
+	c.net.nodes[id] = node
+	c.net.mu.Unlock()
+	c.nodes[id], c.fsms[id] = node, fsm
+	node.Start()
+}
+
+func (c *cluster) stop(id string) {
+	c.net.mu.Lock()
+	delete(c.net.nodes, id)
+	c.net.mu.Unlock()
+	c.nodes[id].Close()
+	delete(c.nodes, id)
+}
+
+// leader ждет единственного лидера среди доступных узлов, о котором автомат
+// состояний уже знает
+func (c *cluster) leader(except ...string) (*Node, uint64) {
+	c.t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		var leaders []*Node
+		var term uint64
+		for id, node := range c.nodes {
+			if slices.Contains(except, id) {
+				continue
+			}
+			c.fsms[id].mu.Lock()
+			ready := c.fsms[id].leader
+			c.fsms[id].mu.Unlock()
+			if s := node.Status(); s.State == "leader" && ready {
+				leaders, term = append(leaders, node), s.Term
+			}
+		}
+		if len(leaders) == 1 {
+			return leaders[0], term
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.t.Fatal("no single leader elected")
+	return nil, 0
+}
+
+func (c *cluster) propose(node *Node, term uint64, data string) error {
+	index, err := node.Propose([]byte(data), term)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return node.Wait(ctx, index, term)
+}
+
+// waitApplied ждет, пока автомат узла id применит записи want
+func (c *cluster) waitApplied(id string, want []string) {
+	c.t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if slices.Equal(c.fsms[id].applied(), want) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.t.Fatalf("node %s applied %v, want %v", id, c.fsms[id].applied(), want)
+}
+
+// TestElection проверяет выбор единственного лидера, которого признают все узлы
+func TestElection(t *testing.T) {
+	c := newCluster(t, 3, Config{})
+	leader, _ := c.leader()
+	deadline := time.Now().Add(2 * time.Second)
+	for _, node := range c.nodes {
+		for node.Leader() != leader.ID() && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if node.Leader() != leader.ID() {
+			t.Fatalf("%s sees leader %q, want %q", node.ID(), node.Leader(), leader.ID())
+		}
+	}
+}
+
+// TestReplication проверяет, что записи лидера применяются на всех узлах
+// в одном порядке, а не лидер записи не принимает
+func TestReplication(t *testing.T) {
+	c := newCluster(t, 3, Config{})
+	leader, term := c.leader()
+	for _, data := range []string{"a", "b", "c"} {
+		if err := c.propose(leader, term, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, id := range c.ids {
+		c.waitApplied(id, []string{"a", "b", "c"})
+	}
+	for _, node := range c.nodes {
+		if node != leader {
+			if _, err := node.Propose([]byte("x"), term); !errors.Is(err, ErrNotLeader) {
+				t.Fatalf("follower propose: %v, want ErrNotLeader", err)
+			}
+		}
+	}
+}
+
+// TestFailover проверяет выбор нового лидера после отключения прежнего:
+// записи, которые прежний лидер не смог зафиксировать, отбрасываются, а
+// после возвращения он получает журнал нового лидера
+func TestFailover(t *testing.T) {
+	c := newCluster(t, 3, Config{})
+	old, term := c.leader()
+	if err := c.propose(old, term, "committed"); err != nil {
+		t.Fatal(err)
+	}
+
+	c.net.setDown(old.ID(), true)
+	index, err := old.Propose([]byte("lost"), term)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leader, newTerm := c.leader(old.ID())
+	if newTerm <= term {
+		t.Fatalf("new leader term %d, want > %d", newTerm, term)
+	}
+	if err := c.propose(leader, newTerm, "after"); err != nil {
+		t.Fatal(err)
+	}
+
+	c.net.setDown(old.ID(), false)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := old.Wait(ctx, index, term); !errors.Is(err, ErrLeadershipLost) {
+		t.Fatalf("wait for lost entry: %v, want ErrLeadershipLost", err)
+	}
+	for _, id := range c.ids {
+		c.waitApplied(id, []string{"committed", "after"})
+	}
+	if c.fsms[old.ID()].leader {
+		t.Fatal("old leader still considers itself the leader")
+	}
+}
+
+// TestRestart проверяет, что перезапущенный узел восстанавливает журнал с
+// диска и применяет зафиксированные записи заново
+func TestRestart(t *testing.T) {
+	c := newCluster(t, 3, Config{})
+	leader, term := c.leader()
+	for _, data := range []string{"a", "b"} {
+		if err := c.propose(leader, term, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var follower string
+	for _, id := range c.ids {
+		if id != leader.ID() {
+			follower = id
+		}
+	}
+	c.waitApplied(follower, []string{"a", "b"})
+	savedTerm := c.nodes[follower].Status().Term
+	c.stop(follower)
+	c.start(follower)
+
+	if s := c.nodes[follower].Status(); s.Term < savedTerm || s.LastIndex < 3 {
+		t.Fatalf("restarted node status %+v: log or term not restored", s)
+	}
+	c.waitApplied(follower, []string{"a", "b"})
+}
+
+// TestSnapshot проверяет сжатие журнала и передачу снимка узлу, отставшему
+// больше, чем на хранимую часть журнала
+func TestSnapshot(t *testing.T) {
+	c := newCluster(t, 3, Config{SnapshotThreshold: 5})
+	leader, term := c.leader()
+	var lagging string
+	for _, id := range c.ids {
+		if id != leader.ID() {
+			lagging = id
+		}
+	}
+	c.net.setDown(lagging, true)
+	var want []string
+	for i := range 20 {
+		data := fmt.Sprintf("m%d", i)
+		want = append(want, data)
+		if err := c.propose(leader, term, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s := leader.Status(); s.SnapshotIndex == 0 {
+		t.Fatalf("leader did not compact its log: %+v", s)
+	}
+
+	c.net.setDown(lagging, false)
+	c.waitApplied(lagging, want)
+	if c.fsms[lagging].restores == 0 {
+		t.Fatal("lagging node caught up without a snapshot")
+	}
+
+	// Снимок восстанавливается и при перезапуске
+	c.stop(lagging)
+	c.start(lagging)
+	if c.fsms[lagging].restores != 1 || !slices.Equal(c.fsms[lagging].applied()[:5], want[:5]) {
+		t.Fatalf("restart did not restore the snapshot: %v", c.fsms[lagging].applied())
+	}
+	c.waitApplied(lagging, want)
+}
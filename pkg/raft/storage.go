@@ -0,0 +1,263 @@
+package raft
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Каталог узла содержит три файла: state — срок и голос, snapshot — последний
+// снимок автомата состояний с индексом и сроком последней вошедшей в него
+// записи, log — записи журнала после снимка. Запись журнала — строка
+// "<crc32c в hex> <запись в JSON>\n", как в журнале предзаписи брокера;
+// поврежденная или оборванная запись при открытии считается концом журнала.
+// state и snapshot заменяются атомарно (запись во временный файл и
+// переименование), log дописывается и сбрасывается на диск перед ответом
+// лидеру.
+
+const (
+	stateFile    = "state"
+	snapshotFile = "snapshot"
+	logFile      = "log"
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// storage файлы узла в каталоге
+type storage struct {
+	dir  string
+	file *os.File
+}
+
+// saved состояние узла, прочитанное из каталога
+type saved struct {
+	term      uint64
+	vote      string
+	snapIndex uint64
+	snapTerm  uint64
+	snapshot  []byte
+	entries   []Entry
+}
+
+type stateRecord struct {
+	Term uint64 `json:"term"`
+	Vote string `json:"vote,omitempty"`
+}
+
+type snapshotRecord struct {
+	Index uint64 `json:"index"`
+	Term  uint64 `json:"term"`
+	Data  []byte `json:"data"`
+}
+
+// openStorage читает состояние узла из каталога dir (создавая его) и
+// открывает журнал для дописывания
+func openStorage(dir string) (*storage, saved, error) {
+	var s saved
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, s, err
+	}
+	var state stateRecord
+	if err := readJSON(filepath.Join(dir, stateFile), &state); err != nil {
+		return nil, s, err
+	}
+	var snap snapshotRecord
+	if err := readJSON(filepath.Join(dir, snapshotFile), &snap); err != nil {
+		return nil, s, err
+	}
+	s.term, s.vote = state.Term, state.Vote
+	s.snapIndex, s.snapTerm, s.snapshot = snap.Index, snap.Term, snap.Data
+
+	path := filepath.Join(dir, logFile)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, s, err
+	}
+	entries, size, err := readLog(f, snap.Index)
+	if err == nil {
+		err = f.Truncate(size)
+	}
+	if err == nil {
+		_, err = f.Seek(size, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return nil, s, fmt.Errorf("raft log %s: %w", path, err)
+	}
+	s.entries = entries
+	return &storage{dir: dir, file: f}, s, nil
+}
+
+// readJSON читает файл path в v; отсутствующий файл оставляет v пустым
+func readJSON(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// readLog читает записи журнала после снимка snapIndex и возвращает размер
+// целой части файла. Записи до снимка остаются в файле, если узел упал
+// между сохранением снимка и перезаписью журнала, и пропускаются.
+func readLog(f *os.File, snapIndex uint64) ([]Entry, int64, error) {
+	r := bufio.NewReader(f)
+	var entries []Entry
+	var size int64
+	for {
+		record, err := r.ReadBytes('\n')
+		if err == io.EOF && len(record) == 0 {
+			return entries, size, nil
+		}
+		if err != nil && err != io.EOF {
+			return nil, 0, err
+		}
+		entry, ok := decodeRecord(record)
+		if !ok {
+			log.Printf("raft: %s: corrupted record at offset %d, truncating", f.Name(), size)
+			return entries, size, nil
+		}
+		want := snapIndex + uint64(len(entries)) + 1
+		if entry.Index > want {
+			return entries, size, nil
+		}
+		if entry.Index == want {
+			entries = append(entries, entry)
+		}
+		size += int64(len(record))
+	}
+}
+
+func decodeRecord(record []byte) (Entry, bool) {
+	var entry Entry
+	if len(record) < 10 || record[8] != ' ' || record[len(record)-1] != '\n' {
+		return entry, false
+	}
+	sum, err := strconv.ParseUint(string(record[:8]), 16, 32)
+	if err != nil {
+		return entry, false
+	}
+	data := record[9 : len(record)-1]
+	if crc32.Checksum(data, crcTable) != uint32(sum) || json.Unmarshal(data, &entry) != nil {
+		return entry, false
+	}
+	return entry, true
+}
+
+func appendRecords(w io.Writer, entries []Entry) error {
+	bw := bufio.NewWriter(w)
+	for _, entry := range entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(bw, "%08x ", crc32.Checksum(data, crcTable))
+		bw.Write(data)
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// append дописывает записи в журнал и сбрасывает его на диск
+func (s *storage) append(entries []Entry) error {
+	if err := appendRecords(s.file, entries); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+// rewrite заменяет журнал записями entries
+func (s *storage) rewrite(entries []Entry) error {
+	path := filepath.Join(s.dir, logFile)
+	tmp, err := os.CreateTemp(s.dir, ".log-*")
+	if err != nil {
+		return err
+	}
+	err = appendRecords(tmp, entries)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err == nil {
+		err = syncDir(s.dir)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	s.file.Close()
+	s.file = tmp
+	return nil
+}
+
+// saveState сохраняет срок и голос
+func (s *storage) saveState(term uint64, vote string) error {
+	return s.writeFile(stateFile, stateRecord{Term: term, Vote: vote})
+}
+
+// saveSnapshot сохраняет снимок и оставляет в журнале записи rest после него
+func (s *storage) saveSnapshot(index, term uint64, data []byte, rest []Entry) error {
+	if err := s.writeFile(snapshotFile, snapshotRecord{Index: index, Term: term, Data: data}); err != nil {
+		return err
+	}
+	return s.rewrite(rest)
+}
+
+// writeFile атомарно заменяет файл name значением v в JSON
+func (s *storage) writeFile(name string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.dir, "."+name+"-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(s.dir, name))
+	}
+	if err == nil {
+		err = syncDir(s.dir)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+func (s *storage) close() error {
+	return s.file.Close()
+}
+
+// syncDir сбрасывает на диск каталог, чтобы переименование файла пережило сбой
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
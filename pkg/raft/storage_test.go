@@ -0,0 +1,87 @@
+package raft
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestStorageReopen проверяет восстановление срока, голоса, снимка и журнала
+// после повторного открытия каталога
+func TestStorageReopen(t *testing.T) {
+	dir := t.TempDir()
+	s, _, err := openStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.saveState(3, "node-2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.append([]Entry{{Index: 1, Term: 1, Data: []byte("a")}, {Index: 2, Term: 2, Data: []byte("b")}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.saveSnapshot(1, 1, []byte("snap"), []Entry{{Index: 2, Term: 2, Data: []byte("b")}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.append([]Entry{{Index: 3, Term: 3, Data: []byte{}}, {Index: 4, Term: 3}}); err != nil {
+		t.Fatal(err)
+	}
+	s.close()
+
+	s, got, err := openStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+	if got.term != 3 || got.vote != "node-2" || got.snapIndex != 1 || got.snapTerm != 1 || string(got.snapshot) != "snap" {
+		t.Fatalf("state not restored: %+v", got)
+	}
+	if len(got.entries) != 3 || got.entries[0].Index != 2 || string(got.entries[0].Data) != "b" {
+		t.Fatalf("entries not restored: %+v", got.entries)
+	}
+	// Пустые данные отличаются от пустой записи нового лидера
+	if got.entries[1].Data == nil || got.entries[2].Data != nil {
+		t.Fatalf("empty data and no-op entries mixed up: %+v", got.entries[1:])
+	}
+}
+
+// TestStorageTruncatesCorruptedTail проверяет, что оборванная запись в конце
+// журнала отбрасывается, а следующая запись дописывается после целых
+func TestStorageTruncatesCorruptedTail(t *testing.T) {
+	dir := t.TempDir()
+	s, _, err := openStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.append([]Entry{{Index: 1, Term: 1, Data: []byte("a")}}); err != nil {
+		t.Fatal(err)
+	}
+	s.close()
+	f, err := os.OpenFile(filepath.Join(dir, logFile), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("deadbeef {\"index\":2")
+	f.Close()
+
+	s, got, err := openStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(got.entries))
+	}
+	if err := s.append([]Entry{{Index: 2, Term: 1, Data: []byte("b")}}); err != nil {
+		t.Fatal(err)
+	}
+	s.close()
+
+	s, got, err = openStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+	if len(got.entries) != 2 || string(got.entries[1].Data) != "b" {
+		t.Fatalf("entries after truncation: %+v", got.entries)
+	}
+}
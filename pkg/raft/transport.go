@@ -0,0 +1,166 @@
+package raft
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"queue-broker/pkg/httperr"
+	"queue-broker/pkg/peer"
+)
+
+// Пути запросов между узлами; адрес узла (Config.ID) — базовый URL его HTTP API
+const (
+	VotePath     = "/raft/vote"
+	AppendPath   = "/raft/append"
+	SnapshotPath = "/raft/snapshot"
+)
+
+// VoteRequest запрос голоса кандидата
+type VoteRequest struct {
+	Term         uint64 `json:"term"`
+	Candidate    string `json:"candidate"`
+	LastLogIndex uint64 `json:"last_log_index"`
+	LastLogTerm  uint64 `json:"last_log_term"`
+}
+
+// VoteResponse ответ на запрос голоса
+type VoteResponse struct {
+	Term    uint64 `json:"term"`
+	Granted bool   `json:"granted"`
+}
+
+// AppendRequest записи журнала лидера после PrevLogIndex; без записей —
+// пульс, подтверждающий лидерство
+type AppendRequest struct {
+	Term         uint64  `json:"term"`
+	Leader       string  `json:"leader"`
+	PrevLogIndex uint64  `json:"prev_log_index"`
+	PrevLogTerm  uint64  `json:"prev_log_term"`
+	Entries      []Entry `json:"entries,omitempty"`
+	LeaderCommit uint64  `json:"leader_commit"`
+}
+
+// AppendResponse ответ на AppendRequest
+type AppendResponse struct {
+	Term    uint64 `json:"term"`
+	Success bool   `json:"success"`
+	// ConflictIndex с какой записи лидеру продолжить, если журналы разошлись
+	ConflictIndex uint64 `json:"conflict_index,omitempty"`
+}
+
+// SnapshotRequest снимок лидера после записи Index срока LastTerm
+type SnapshotRequest struct {
+	Term     uint64 `json:"term"`
+	Leader   string `json:"leader"`
+	Index    uint64 `json:"index"`
+	LastTerm uint64 `json:"last_term"`
+	Data     []byte `json:"data"`
+}
+
+// SnapshotResponse ответ на SnapshotRequest
+type SnapshotResponse struct {
+	Term uint64 `json:"term"`
+}
+
+// Transport передает запросы узла другим узлам
+type Transport interface {
+	RequestVote(ctx context.Context, peer string, req *VoteRequest) (*VoteResponse, error)
+	AppendEntries(ctx context.Context, peer string, req *AppendRequest) (*AppendResponse, error)
+	InstallSnapshot(ctx context.Context, peer string, req *SnapshotRequest) (*SnapshotResponse, error)
+}
+
+// HTTPTransport передает запросы в JSON по HTTP, подписывая их общим
+// секретом брокеров (см. пакет peer)
+type HTTPTransport struct {
+	client *http.Client
+	secret string
+}
+
+// NewHTTPTransport создает транспорт с общим секретом secret
+func NewHTTPTransport(secret string) *HTTPTransport {
+	return &HTTPTransport{client: &http.Client{}, secret: secret}
+}
+
+// RequestVote передает запрос голоса узлу peer
+func (t *HTTPTransport) RequestVote(ctx context.Context, peer string, req *VoteRequest) (*VoteResponse, error) {
+	var resp VoteResponse
+	return &resp, t.call(ctx, peer+VotePath, req, &resp)
+}
+
+// AppendEntries передает записи журнала узлу peer
+func (t *HTTPTransport) AppendEntries(ctx context.Context, peer string, req *AppendRequest) (*AppendResponse, error) {
+	var resp AppendResponse
+	return &resp, t.call(ctx, peer+AppendPath, req, &resp)
+}
+
+// InstallSnapshot передает снимок узлу peer
+func (t *HTTPTransport) InstallSnapshot(ctx context.Context, peer string, req *SnapshotRequest) (*SnapshotResponse, error) {
+	var resp SnapshotResponse
+	return &resp, t.call(ctx, peer+SnapshotPath, req, &resp)
+}
+
+func (t *HTTPTransport) call(ctx context.Context, url string, req, resp any) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	peer.Sign(httpReq, t.secret)
+	httpResp, err := t.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: unexpected status %s", url, httpResp.Status)
+	}
+	return json.NewDecoder(httpResp.Body).Decode(resp)
+}
+
+// Handler обслуживает запросы других узлов по путям VotePath, AppendPath и
+// SnapshotPath; проверку секрета выполняет вызывающий (peer.Require)
+func (n *Node) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+VotePath, func(w http.ResponseWriter, r *http.Request) {
+		var req VoteRequest
+		if decode(w, r, &req) {
+			writeJSON(w, n.RequestVote(&req))
+		}
+	})
+	mux.HandleFunc("POST "+AppendPath, func(w http.ResponseWriter, r *http.Request) {
+		var req AppendRequest
+		if decode(w, r, &req) {
+			writeJSON(w, n.AppendEntries(&req))
+		}
+	})
+	mux.HandleFunc("POST "+SnapshotPath, func(w http.ResponseWriter, r *http.Request) {
+		var req SnapshotRequest
+		if decode(w, r, &req) {
+			writeJSON(w, n.InstallSnapshot(&req))
+		}
+	})
+	mux.HandleFunc("/raft/", func(w http.ResponseWriter, r *http.Request) {
+		httperr.Error(w, "Not found", http.StatusNotFound)
+	})
+	return mux
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		httperr.Error(w, "Bad request", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,46 @@
+package raft
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"queue-broker/pkg/peer"
+)
+
+// TestHTTPTransport проверяет запросы узлов по HTTP с общим секретом
+func TestHTTPTransport(t *testing.T) {
+	node, err := New(Config{ID: "http://node", Dir: t.TempDir()}, &testFSM{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Close()
+	server := httptest.NewServer(peer.Require("s3cret", node.Handler()))
+	defer server.Close()
+
+	ctx := context.Background()
+	resp, err := NewHTTPTransport("s3cret").RequestVote(ctx, server.URL, &VoteRequest{Term: 5, Candidate: "http://other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Granted || resp.Term != 5 {
+		t.Fatalf("vote response %+v, want granted in term 5", resp)
+	}
+	appendResp, err := NewHTTPTransport("s3cret").AppendEntries(ctx, server.URL, &AppendRequest{
+		Term:    5,
+		Leader:  "http://other",
+		Entries: []Entry{{Index: 1, Term: 5, Data: []byte("a")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !appendResp.Success || node.Leader() != "http://other" || node.Status().LastIndex != 1 {
+		t.Fatalf("append response %+v, status %+v", appendResp, node.Status())
+	}
+
+	_, err = NewHTTPTransport("wrong").RequestVote(ctx, server.URL, &VoteRequest{Term: 6, Candidate: "http://other"})
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("request with a wrong secret: %v, want 401", err)
+	}
+}
@@ -0,0 +1,121 @@
+package rpc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Кодирование сообщений protobuf (proto3) для сервисов брокера: поля со
+// значением по умолчанию не записываются, неизвестные поля при разборе
+// пропускаются.
+
+// WireType способ кодирования поля protobuf
+type WireType int
+
+// Способы кодирования полей
+const (
+	WireVarint  WireType = 0
+	WireFixed64 WireType = 1
+	WireBytes   WireType = 2
+	WireFixed32 WireType = 5
+)
+
+// Field поле разобранного сообщения
+type Field struct {
+	Num  int
+	Type WireType
+	// Varint значение поля WireVarint, WireFixed64 или WireFixed32
+	Varint uint64
+	// Bytes значение поля WireBytes: строка, байты или вложенное сообщение
+	Bytes []byte
+}
+
+// AppendVarint добавляет поле uint64 (uint32, int64, enum)
+func AppendVarint(b []byte, num int, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = binary.AppendUvarint(b, uint64(num)<<3|uint64(WireVarint))
+	return binary.AppendUvarint(b, v)
+}
+
+// AppendBool добавляет поле bool
+func AppendBool(b []byte, num int, v bool) []byte {
+	if !v {
+		return b
+	}
+	return AppendVarint(b, num, 1)
+}
+
+// AppendBytes добавляет поле bytes; пустое значение не записывается
+func AppendBytes(b []byte, num int, v []byte) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	return AppendMessage(b, num, v)
+}
+
+// AppendString добавляет поле string
+func AppendString(b []byte, num int, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = binary.AppendUvarint(b, uint64(num)<<3|uint64(WireBytes))
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// AppendMessage добавляет вложенное сообщение (или элемент repeated-поля
+// и map) даже пустым: его наличие значимо
+func AppendMessage(b []byte, num int, msg []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(num)<<3|uint64(WireBytes))
+	b = binary.AppendUvarint(b, uint64(len(msg)))
+	return append(b, msg...)
+}
+
+var errTruncated = errors.New("proto: truncated message")
+
+// ParseFields вызывает fn для каждого поля сообщения data по порядку
+func ParseFields(data []byte, fn func(Field) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errTruncated
+		}
+		data = data[n:]
+		f := Field{Num: int(key >> 3), Type: WireType(key & 7)}
+		if f.Num <= 0 {
+			return fmt.Errorf("proto: invalid field number %d", f.Num)
+		}
+		switch f.Type {
+		case WireVarint:
+			if f.Varint, n = binary.Uvarint(data); n <= 0 {
+				return errTruncated
+			}
+			data = data[n:]
+		case WireFixed64:
+			if len(data) < 8 {
+				return errTruncated
+			}
+			f.Varint, data = binary.LittleEndian.Uint64(data), data[8:]
+		case WireFixed32:
+			if len(data) < 4 {
+				return errTruncated
+			}
+			f.Varint, data = uint64(binary.LittleEndian.Uint32(data)), data[4:]
+		case WireBytes:
+			size, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < size {
+				return errTruncated
+			}
+			f.Bytes, data = data[n:n+int(size)], data[n+int(size):]
+		default:
+			return fmt.Errorf("proto: unsupported wire type %d", f.Type)
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
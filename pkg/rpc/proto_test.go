@@ -0,0 +1,30 @@
+package rpc
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// TestParseFields проверяет разбор полей, в том числе неизвестных типов
+// fixed32/fixed64, и обнаружение обрезанного сообщения
+func TestParseFields(t *testing.T) {
+	b := AppendVarint(nil, 1, 300)
+	b = AppendString(b, 2, "queue")
+	b = AppendBool(b, 3, false)
+	b = AppendMessage(b, 4, nil)
+	b = binary.AppendUvarint(b, 5<<3|uint64(WireFixed32))
+	b = binary.LittleEndian.AppendUint32(b, 7)
+	b = binary.AppendUvarint(b, 6<<3|uint64(WireFixed64))
+	b = binary.LittleEndian.AppendUint64(b, 9)
+
+	var got []Field
+	if err := ParseFields(b, func(f Field) error { got = append(got, f); return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 5 || got[0].Varint != 300 || string(got[1].Bytes) != "queue" || got[2].Num != 4 || len(got[2].Bytes) != 0 || got[3].Varint != 7 || got[4].Varint != 9 {
+		t.Errorf("unexpected fields %+v", got)
+	}
+	if err := ParseFields(b[:len(b)-1], func(Field) error { return nil }); err == nil {
+		t.Error("truncated message accepted")
+	}
+}
@@ -0,0 +1,210 @@
+// Package rpc минимальная реализация gRPC поверх net/http без внешних
+// зависимостей: кадры сообщений, статус вызова в трейлерах и потоковые
+// ответы сервера (server streaming) по HTTP/2, в том числе без TLS (h2c).
+// Сообщения кодируются в формате protobuf функциями из proto.go.
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ContentType тип содержимого запросов и ответов gRPC
+const ContentType = "application/grpc"
+
+// DefaultMaxMessageSize предельный размер принимаемого сообщения
+const DefaultMaxMessageSize = 64 << 20
+
+// Code код статуса вызова gRPC
+type Code int
+
+// Коды статуса, которые использует брокер
+const (
+	OK              Code = 0
+	Canceled        Code = 1
+	InvalidArgument Code = 3
+	Internal        Code = 13
+	Unavailable     Code = 14
+	Unauthenticated Code = 16
+)
+
+// Status ошибка вызова с кодом статуса gRPC
+type Status struct {
+	Code    Code
+	Message string
+}
+
+func (s *Status) Error() string {
+	return fmt.Sprintf("rpc error: code = %d desc = %s", s.Code, s.Message)
+}
+
+// WriteMessage записывает сообщение в кадре gRPC: флаг сжатия (всегда 0),
+// длина (4 байта, big-endian) и само сообщение
+func WriteMessage(w io.Writer, msg []byte) error {
+	var prefix [5]byte
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(msg)))
+	if _, err := w.Write(prefix[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(msg)
+	return err
+}
+
+// ReadMessage читает сообщение из кадра gRPC; io.EOF — кадров больше нет
+func ReadMessage(r io.Reader, maxSize int) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, fmt.Errorf("truncated message prefix: %w", err)
+		}
+		return nil, err
+	}
+	if prefix[0] != 0 {
+		return nil, errors.New("compressed messages are not supported")
+	}
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if int64(size) > int64(maxSize) {
+		return nil, fmt.Errorf("message of %d bytes exceeds limit of %d", size, maxSize)
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, fmt.Errorf("truncated message: %w", err)
+	}
+	return msg, nil
+}
+
+// StartResponse отправляет заголовки ответа на вызов
+func StartResponse(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(http.StatusOK)
+}
+
+// Finish завершает ответ трейлерами со статусом вызова; если ответ еще не
+// начат, статус передается в заголовках (Trailers-Only)
+func Finish(w http.ResponseWriter, code Code, message string, started bool) {
+	prefix := http.TrailerPrefix
+	if !started {
+		prefix = ""
+		w.Header().Set("Content-Type", ContentType)
+	}
+	w.Header().Set(prefix+"Grpc-Status", strconv.Itoa(int(code)))
+	if message != "" {
+		w.Header().Set(prefix+"Grpc-Message", url.PathEscape(message))
+	}
+	if !started {
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// NewClient возвращает HTTP-клиент для вызовов gRPC: по HTTP/2 с TLS для
+// https:// и без TLS (h2c с предварительным знанием) для http://
+func NewClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Protocols = new(http.Protocols)
+	transport.Protocols.SetHTTP2(true)
+	transport.Protocols.SetUnencryptedHTTP2(true)
+	return &http.Client{Transport: transport}
+}
+
+// Stream поток ответов сервера на вызов
+type Stream struct {
+	resp    *http.Response
+	maxSize int
+}
+
+// Call вызывает метод method (например, "/pkg.Service/Method") сервера с
+// базовым URL baseURL и отправляет запрос req. prepare может дополнить
+// HTTP-запрос, например, заголовками аутентификации.
+func Call(ctx context.Context, client *http.Client, baseURL, method string, req []byte, prepare func(*http.Request)) (*Stream, error) {
+	var body bytes.Buffer
+	WriteMessage(&body, req)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(baseURL, "/")+method, &body)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", ContentType)
+	httpReq.Header.Set("Te", "trailers")
+	if prepare != nil {
+		prepare(httpReq)
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, httpStatus(resp)
+	}
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), ContentType) {
+		resp.Body.Close()
+		return nil, &Status{Code: Internal, Message: "unexpected content type " + resp.Header.Get("Content-Type")}
+	}
+	// Trailers-Only: вызов завершился, не начав ответа
+	if err := status(resp.Header); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return &Stream{resp: resp, maxSize: DefaultMaxMessageSize}, nil
+}
+
+// Recv возвращает следующее сообщение потока; io.EOF — вызов успешно
+// завершен, *Status — сервер завершил вызов с ошибкой
+func (s *Stream) Recv() ([]byte, error) {
+	msg, err := ReadMessage(s.resp.Body, s.maxSize)
+	if err == io.EOF {
+		if err := status(s.resp.Trailer); err != nil {
+			return nil, err
+		}
+		if s.resp.Trailer.Get("Grpc-Status") == "" {
+			return nil, &Status{Code: Internal, Message: "stream closed without status"}
+		}
+	}
+	return msg, err
+}
+
+// Close прерывает поток
+func (s *Stream) Close() error {
+	return s.resp.Body.Close()
+}
+
+// status ошибка по статусу вызова из заголовков или трейлеров; nil, если
+// статуса нет или он OK
+func status(h http.Header) error {
+	value := h.Get("Grpc-Status")
+	if value == "" {
+		return nil
+	}
+	code, err := strconv.Atoi(value)
+	if err != nil {
+		return &Status{Code: Internal, Message: "invalid grpc-status " + value}
+	}
+	if Code(code) == OK {
+		return nil
+	}
+	message, err := url.PathUnescape(h.Get("Grpc-Message"))
+	if err != nil {
+		message = h.Get("Grpc-Message")
+	}
+	return &Status{Code: Code(code), Message: message}
+}
+
+// httpStatus ошибка по коду ответа HTTP, не дошедшего до сервиса gRPC
+// (например, отклоненного аутентификацией)
+func httpStatus(resp *http.Response) error {
+	code := Internal
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		code = Unauthenticated
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout, http.StatusTooManyRequests:
+		code = Unavailable
+	}
+	return &Status{Code: code, Message: "server responded " + resp.Status}
+}
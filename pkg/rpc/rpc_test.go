@@ -0,0 +1,83 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newH2CServer запускает тестовый сервер с HTTP/2 без TLS
+func newH2CServer(handler http.Handler) *httptest.Server {
+	server := httptest.NewUnstartedServer(handler)
+	server.Config.Protocols = new(http.Protocols)
+	server.Config.Protocols.SetUnencryptedHTTP2(true)
+	server.Start()
+	return server
+}
+
+// TestCall проверяет потоковый вызов: сообщения по порядку и статус в трейлерах
+func TestCall(t *testing.T) {
+	server := newH2CServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, err := ReadMessage(r.Body, DefaultMaxMessageSize)
+		if r.URL.Path != "/test.Echo/Repeat" || r.ProtoMajor != 2 || err != nil {
+			Finish(w, InvalidArgument, "bad call", false)
+			return
+		}
+		StartResponse(w)
+		WriteMessage(w, req)
+		WriteMessage(w, nil)
+		Finish(w, Unavailable, "going away: 100%", true)
+	}))
+	defer server.Close()
+
+	stream, err := Call(context.Background(), NewClient(), server.URL, "/test.Echo/Repeat", []byte("ping"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	for _, want := range []string{"ping", ""} {
+		if msg, err := stream.Recv(); err != nil || string(msg) != want {
+			t.Fatalf("got %q %v, want %q", msg, err, want)
+		}
+	}
+	var status *Status
+	if _, err := stream.Recv(); !errors.As(err, &status) || status.Code != Unavailable || status.Message != "going away: 100%" {
+		t.Errorf("expected status in trailers, got %v", err)
+	}
+
+	// Trailers-Only: ошибка до начала ответа
+	if _, err := Call(context.Background(), NewClient(), server.URL, "/test.Echo/Other", nil, nil); !errors.As(err, &status) || status.Code != InvalidArgument {
+		t.Errorf("expected InvalidArgument, got %v", err)
+	}
+}
+
+// TestCallHTTPError проверяет код статуса для ответа, отклоненного до сервиса
+func TestCallHTTPError(t *testing.T) {
+	server := newH2CServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		StartResponse(w)
+		Finish(w, OK, "", true)
+	}))
+	defer server.Close()
+
+	var status *Status
+	if _, err := Call(context.Background(), NewClient(), server.URL, "/test.Echo/Repeat", nil, nil); !errors.As(err, &status) || status.Code != Unauthenticated {
+		t.Errorf("expected Unauthenticated, got %v", err)
+	}
+	stream, err := Call(context.Background(), NewClient(), server.URL, "/test.Echo/Repeat", nil, func(r *http.Request) {
+		r.Header.Set("Authorization", "Bearer x")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	if _, err := stream.Recv(); err != io.EOF {
+		t.Errorf("expected clean end of stream, got %v", err)
+	}
+}
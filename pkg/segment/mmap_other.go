@@ -0,0 +1,14 @@
+//go:build !unix
+
+package segment
+
+import "os"
+
+// mapFile без mmap: тела читаются из файла (ReadAt)
+func mapFile(*os.File, int) ([]byte, error) {
+	return nil, nil
+}
+
+func unmapFile([]byte) error {
+	return nil
+}
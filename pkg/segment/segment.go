@@ -0,0 +1,361 @@
+// Package segment хранит тела сообщений в файлах-сегментах ограниченного
+// размера: индекс тел держится в памяти, а сами тела читаются из отображенных
+// в память (mmap) файлов, поэтому объем очередей может превышать память
+// процесса. Store подключается к брокеру как хранилище вынесенных тел
+// (broker.QueueBroker.SetOffload) и освобождает сегмент, когда все сообщения
+// с телами в нем окончательно удалены.
+package segment
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultSize размер сегмента по умолчанию
+const DefaultSize = 64 << 20
+
+// headerSize заголовок записи: длина ключа, длина тела и CRC-32C ключа и тела
+const headerSize = 12
+
+// ErrNotFound тела с таким ключом нет
+var ErrNotFound = errors.New("segment: object not found")
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Options настройки хранилища сегментов
+type Options struct {
+	// Size предельный размер файла-сегмента (по умолчанию DefaultSize);
+	// тело больше него записывается в отдельный сегмент
+	Size int64
+	// SyncWrites сбрасывать сегмент на диск после записи каждого тела
+	SyncWrites bool
+}
+
+// Store хранилище тел в файлах-сегментах каталога
+type Store struct {
+	dir  string
+	opts Options
+
+	mu       sync.Mutex
+	index    map[string]*location
+	segments map[uint64]*segmentFile
+	active   *segmentFile
+	nextID   uint64
+	// released тела, ссылки на которые сняты; удаляются при следующей записи
+	// или Sweep, если к тому времени на них снова не сослались
+	released []string
+}
+
+// location расположение тела в сегменте и число сообщений, ссылающихся на него
+type location struct {
+	segment *segmentFile
+	offset  int64
+	length  int
+	refs    int
+}
+
+// segmentFile файл-сегмент; data — его отображение в память (nil, если
+// mmap недоступен, тогда тела читаются из файла)
+type segmentFile struct {
+	id   uint64
+	file *os.File
+	data []byte
+	size int64
+	// capacity размер файла, предвыделенный под запись тел
+	capacity int64
+	sealed   bool
+	// live число тел сегмента в индексе
+	live int
+}
+
+// Open открывает хранилище в каталоге dir и строит индекс по имеющимся
+// сегментам. Оборванная или поврежденная запись в конце сегмента (после
+// сбоя посреди записи) отбрасывается вместе с последующими. Все тела
+// открытого хранилища считаются неиспользуемыми, пока брокер не учтет
+// ссылки на них (см. Sweep).
+func Open(dir string, opts Options) (*Store, error) {
+	if opts.Size <= 0 {
+		opts.Size = DefaultSize
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &Store{dir: dir, opts: opts, index: make(map[string]*location), segments: make(map[uint64]*segmentFile), nextID: 1}
+
+	names, err := filepath.Glob(filepath.Join(dir, "*.seg"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		id, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(name), ".seg"), 16, 64)
+		if err != nil {
+			continue
+		}
+		seg, err := s.load(id, name)
+		if err != nil {
+			s.Close()
+			return nil, fmt.Errorf("segment %s: %w", name, err)
+		}
+		s.segments[id] = seg
+		s.nextID = max(s.nextID, id+1)
+	}
+	return s, nil
+}
+
+// load открывает сегмент, добавляет его тела в индекс и обрезает файл по
+// последней целой записи
+func (s *Store) load(id uint64, name string) (*segmentFile, error) {
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	seg := &segmentFile{id: id, file: f, sealed: true}
+	if seg.data, err = mapFile(f, int(info.Size())); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	header := make([]byte, headerSize)
+	var offset int64
+	for offset+headerSize <= info.Size() {
+		if _, err := seg.readAt(header, offset); err != nil {
+			break
+		}
+		keyLen := int64(binary.BigEndian.Uint32(header[0:4]))
+		bodyLen := int64(binary.BigEndian.Uint32(header[4:8]))
+		end := offset + headerSize + keyLen + bodyLen
+		// Нулевая длина ключа — незаполненный конец сегмента
+		if keyLen == 0 || end > info.Size() {
+			break
+		}
+		record := make([]byte, keyLen+bodyLen)
+		if _, err := seg.readAt(record, offset+headerSize); err != nil || crc32.Checksum(record, crcTable) != binary.BigEndian.Uint32(header[8:12]) {
+			break
+		}
+		s.index[string(record[:keyLen])] = &location{segment: seg, offset: offset + headerSize + keyLen, length: int(bodyLen)}
+		seg.live++
+		offset = end
+	}
+	seg.size = offset
+	if offset < info.Size() {
+		if err := f.Truncate(offset); err != nil {
+			seg.close()
+			return nil, err
+		}
+	}
+	return seg, nil
+}
+
+// Put записывает тело с ключом key в текущий сегмент
+func (s *Store) Put(_ context.Context, key string, data []byte) error {
+	if key == "" {
+		return errors.New("segment: empty key")
+	}
+	record := make([]byte, headerSize+len(key)+len(data))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(key)))
+	binary.BigEndian.PutUint32(record[4:8], uint32(len(data)))
+	copy(record[headerSize:], key)
+	copy(record[headerSize+len(key):], data)
+	binary.BigEndian.PutUint32(record[8:12], crc32.Checksum(record[headerSize:], crcTable))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.collectLocked()
+	size := int64(len(record))
+	if s.active == nil || s.active.size+size > s.active.capacity {
+		if s.active != nil {
+			s.sealLocked(s.active)
+		}
+		seg, err := s.createLocked(max(size, s.opts.Size))
+		if err != nil {
+			return err
+		}
+		s.active = seg
+	}
+	seg := s.active
+	if _, err := seg.file.WriteAt(record, seg.size); err != nil {
+		return err
+	}
+	if s.opts.SyncWrites {
+		if err := seg.file.Sync(); err != nil {
+			return err
+		}
+	}
+	if old, ok := s.index[key]; ok {
+		s.dropLocked(key, old)
+	}
+	s.index[key] = &location{segment: seg, offset: seg.size + headerSize + int64(len(key)), length: len(data)}
+	seg.live++
+	seg.size += size
+	return nil
+}
+
+// createLocked создает сегмент: файл сразу получает предельный размер и
+// отображается в память целиком, так что запись тел видна чтению без
+// повторного отображения
+func (s *Store) createLocked(size int64) (*segmentFile, error) {
+	id := s.nextID
+	s.nextID++
+	f, err := os.OpenFile(filepath.Join(s.dir, fmt.Sprintf("%016x.seg", id)), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	seg := &segmentFile{id: id, file: f, capacity: size}
+	if err := f.Truncate(size); err == nil {
+		seg.data, err = mapFile(f, int(size))
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	s.segments[id] = seg
+	return seg, nil
+}
+
+// sealLocked завершает запись в сегмент: файл обрезается до записанных тел
+func (s *Store) sealLocked(seg *segmentFile) {
+	seg.sealed = true
+	seg.file.Truncate(seg.size)
+	if s.active == seg {
+		s.active = nil
+	}
+	if seg.live == 0 {
+		s.removeLocked(seg)
+	}
+}
+
+// Get возвращает копию тела с ключом key
+func (s *Store) Get(_ context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	loc, ok := s.index[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	data := make([]byte, loc.length)
+	if _, err := loc.segment.readAt(data, loc.offset); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Retain учитывает сообщение очереди, ссылающееся на тело key
+func (s *Store) Retain(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if loc, ok := s.index[key]; ok {
+		loc.refs++
+	}
+}
+
+// Release снимает ссылку на тело key. Тело без ссылок удаляется из индекса,
+// а заполненный сегмент без тел — с диска, при следующей записи: до нее
+// ссылку можно восстановить, например, когда брокер при восстановлении из
+// журнала предзаписи сбрасывает очереди и заново ставит те же сообщения.
+func (s *Store) Release(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	loc, ok := s.index[key]
+	if !ok {
+		return
+	}
+	if loc.refs--; loc.refs <= 0 {
+		s.released = append(s.released, key)
+	}
+}
+
+// collectLocked удаляет освобожденные тела, на которые так и не сослались снова
+func (s *Store) collectLocked() {
+	for _, key := range s.released {
+		if loc, ok := s.index[key]; ok && loc.refs <= 0 {
+			s.dropLocked(key, loc)
+		}
+	}
+	s.released = s.released[:0]
+}
+
+// Sweep удаляет тела, на которые не ссылается ни одно сообщение, например,
+// оставшиеся после перезапуска без журнала предзаписи или после неудачной
+// постановки. Вызывается после восстановления очередей брокера.
+func (s *Store) Sweep() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.released = s.released[:0]
+	for key, loc := range s.index {
+		if loc.refs <= 0 {
+			s.dropLocked(key, loc)
+		}
+	}
+}
+
+func (s *Store) dropLocked(key string, loc *location) {
+	delete(s.index, key)
+	seg := loc.segment
+	if seg.live--; seg.live == 0 && seg.sealed {
+		s.removeLocked(seg)
+	}
+}
+
+func (s *Store) removeLocked(seg *segmentFile) {
+	delete(s.segments, seg.id)
+	name := seg.file.Name()
+	seg.close()
+	os.Remove(name)
+}
+
+// Stats возвращает число сегментов и их общий размер в байтах
+func (s *Store) Stats() (segments int, bytes int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, seg := range s.segments {
+		bytes += seg.size
+	}
+	return len(s.segments), bytes
+}
+
+// Close закрывает сегменты; тела остаются на диске
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active != nil {
+		s.active.sealed = true
+		s.active.file.Truncate(s.active.size)
+		s.active = nil
+	}
+	for id, seg := range s.segments {
+		seg.close()
+		delete(s.segments, id)
+	}
+	return nil
+}
+
+func (seg *segmentFile) readAt(p []byte, offset int64) (int, error) {
+	if seg.data == nil {
+		return seg.file.ReadAt(p, offset)
+	}
+	return copy(p, seg.data[offset:]), nil
+}
+
+func (seg *segmentFile) close() {
+	if seg.data != nil {
+		unmapFile(seg.data)
+		seg.data = nil
+	}
+	seg.file.Close()
+}
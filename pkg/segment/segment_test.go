@@ -0,0 +1,152 @@
+package segment
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestStore проверяет запись и чтение тел, переход к новому сегменту и
+// восстановление индекса после повторного открытия
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, Options{Size: 256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for i := range 20 {
+		if err := s.Put(ctx, "k"+strconv.Itoa(i), []byte(strings.Repeat(strconv.Itoa(i), 30))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Тело больше сегмента записывается в отдельный сегмент
+	large := strings.Repeat("x", 1000)
+	if err := s.Put(ctx, "large", []byte(large)); err != nil {
+		t.Fatal(err)
+	}
+	if segments, _ := s.Stats(); segments < 4 {
+		t.Errorf("bodies are not split into segments: %d", segments)
+	}
+	if data, err := s.Get(ctx, "k7"); err != nil || string(data) != strings.Repeat("7", 30) {
+		t.Errorf("got %q %v", data, err)
+	}
+	if _, err := s.Get(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing key: got %v", err)
+	}
+	s.Close()
+
+	s, err = Open(dir, Options{Size: 256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	for i := range 20 {
+		if data, err := s.Get(ctx, "k"+strconv.Itoa(i)); err != nil || string(data) != strings.Repeat(strconv.Itoa(i), 30) {
+			t.Fatalf("reopened k%d: got %q %v", i, data, err)
+		}
+	}
+	if data, err := s.Get(ctx, "large"); err != nil || string(data) != large {
+		t.Errorf("reopened large: got %d bytes, %v", len(data), err)
+	}
+	// Новые тела пишутся в новый сегмент
+	if err := s.Put(ctx, "after", []byte("reopen")); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := s.Get(ctx, "after"); string(data) != "reopen" {
+		t.Errorf("after reopen: got %q", data)
+	}
+}
+
+// TestStoreRelease проверяет удаление сегментов, на тела которых не осталось ссылок
+func TestStoreRelease(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, Options{Size: 128})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	ctx := context.Background()
+	for i := range 10 {
+		key := "k" + strconv.Itoa(i)
+		s.Put(ctx, key, []byte(strings.Repeat("b", 40)))
+		s.Retain(key)
+	}
+	before, _ := s.Stats()
+
+	// Снятая ссылка восстанавливается до следующей записи
+	s.Release("k0")
+	s.Retain("k0")
+	for i := range 9 {
+		s.Release("k" + strconv.Itoa(i))
+	}
+	s.Put(ctx, "new", []byte("n"))
+	s.Retain("new")
+	if _, err := s.Get(ctx, "k0"); err == nil {
+		t.Error("unreferenced k0 is still stored")
+	}
+	if _, err := s.Get(ctx, "k9"); err != nil {
+		t.Errorf("retained body removed: %v", err)
+	}
+	after, _ := s.Stats()
+	files, _ := filepath.Glob(filepath.Join(dir, "*.seg"))
+	if after >= before || len(files) != after {
+		t.Errorf("segments are not removed: %d before, %d after, %d files", before, after, len(files))
+	}
+
+	// Sweep удаляет тела без ссылок
+	s.Put(ctx, "leaked", []byte("l"))
+	s.Sweep()
+	if _, err := s.Get(ctx, "leaked"); err == nil {
+		t.Error("unreferenced body is not swept")
+	}
+	if _, err := s.Get(ctx, "new"); err != nil {
+		t.Errorf("referenced body swept: %v", err)
+	}
+}
+
+// TestStoreTornWrite проверяет восстановление сегмента, запись в который
+// оборвалась или была повреждена
+func TestStoreTornWrite(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for _, key := range []string{"a", "b", "c"} {
+		s.Put(ctx, key, []byte("body "+key))
+	}
+	s.Close()
+	name := filepath.Join(dir, "0000000000000001.seg")
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := len(data) / 3
+
+	for _, damage := range []func([]byte) []byte{
+		func(d []byte) []byte { return d[:len(d)-2] },
+		func(d []byte) []byte { d[len(d)-1] ^= 0x40; return d },
+	} {
+		os.WriteFile(name, damage(append([]byte(nil), data...)), 0o644)
+		s, err := Open(dir, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := s.Get(ctx, "b"); err != nil || string(got) != "body b" {
+			t.Errorf("intact record: got %q %v", got, err)
+		}
+		if _, err := s.Get(ctx, "c"); err == nil {
+			t.Error("damaged record is readable")
+		}
+		s.Close()
+		if info, _ := os.Stat(name); info.Size() != int64(2*record) {
+			t.Errorf("segment is not truncated: %d bytes", info.Size())
+		}
+	}
+}
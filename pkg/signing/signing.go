@@ -0,0 +1,27 @@
+// Package signing описывает подпись HTTP-запросов к брокеру, общую для
+// сервера и клиента.
+package signing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// Заголовки подписанного запроса
+const (
+	KeyHeader       = "X-Signature-Key"
+	TimestampHeader = "X-Signature-Timestamp"
+	NonceHeader     = "X-Signature-Nonce"
+	SignatureHeader = "X-Signature"
+)
+
+// Sign вычисляет подпись запроса: HMAC-SHA256 от метода, пути с параметрами,
+// времени (Unix, секунды), nonce и SHA-256 тела, разделенных переводом строки
+func Sign(secret []byte, method, requestURI, timestamp, nonce string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strings.Join([]string{method, requestURI, timestamp, nonce, hex.EncodeToString(bodyHash[:])}, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
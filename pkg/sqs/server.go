@@ -0,0 +1,524 @@
+// Package sqs реализует совместимый с Amazon SQS фронтенд брокера очередей
+// (протоколы Query и JSON): CreateQueue, GetQueueUrl, SendMessage,
+// ReceiveMessage и DeleteMessage, чтобы приложения с AWS SDK можно было
+// направить на брокер локально и в тестах.
+package sqs
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"queue-broker/pkg/broker"
+)
+
+const (
+	// AccountID номер учетной записи в адресах очередей
+	AccountID = "000000000000"
+	// MessageIDHeader заголовок, в котором хранится идентификатор сообщения SQS
+	MessageIDHeader = "sqs-message-id"
+
+	// defaultVisibility время, на которое скрывается полученное сообщение,
+	// если VisibilityTimeout не задан
+	defaultVisibility = 30 * time.Second
+	maxVisibility     = 12 * time.Hour
+	maxWaitSeconds    = 20
+	maxDelaySeconds   = 900
+	maxReceive        = 10
+	// maxRequestBytes ограничение размера запроса (сообщение SQS — до 256 КиБ)
+	maxRequestBytes = 1 << 20
+
+	xmlns      = "http://queue.amazonaws.com/doc/2012-11-05/"
+	jsonPrefix = "AmazonSQS."
+)
+
+// apiError ошибка в терминах SQS: Code — код протокола Query, Type — JSON
+type apiError struct {
+	Status  int
+	Code    string
+	Type    string
+	Message string
+	// Sender ошибка клиента (иначе сервера)
+	Sender bool
+}
+
+func (e *apiError) Error() string { return e.Code + ": " + e.Message }
+
+func clientError(code, format string, args ...any) *apiError {
+	return &apiError{Status: http.StatusBadRequest, Code: code, Type: code, Message: fmt.Sprintf(format, args...), Sender: true}
+}
+
+// brokerError переводит ошибку брокера в ошибку SQS
+func brokerError(err error) *apiError {
+	switch {
+	case errors.Is(err, broker.ErrQueueNotFound):
+		return &apiError{http.StatusBadRequest, "AWS.SimpleQueueService.NonExistentQueue", "QueueDoesNotExist", "The specified queue does not exist.", true}
+	case errors.Is(err, broker.ErrLockNotFound):
+		return clientError("ReceiptHandleIsInvalid", "The receipt handle is not valid or has expired.")
+	case errors.Is(err, broker.ErrPermissionDenied):
+		return &apiError{http.StatusForbidden, "AccessDenied", "AccessDenied", "Access to the resource is denied.", true}
+	case errors.Is(err, broker.ErrQueueFull), errors.Is(err, broker.ErrTooManyQueues),
+		errors.Is(err, broker.ErrQueueByteLimit), errors.Is(err, broker.ErrTotalByteLimit),
+		errors.Is(err, broker.ErrTenantQueueLimit), errors.Is(err, broker.ErrTenantMessageLimit),
+		errors.Is(err, broker.ErrTenantByteLimit):
+		return &apiError{http.StatusForbidden, "OverLimit", "OverLimit", err.Error(), true}
+	case errors.Is(err, broker.ErrStandby), errors.Is(err, broker.ErrNotPersisted):
+		return &apiError{http.StatusServiceUnavailable, "ServiceUnavailable", "ServiceUnavailable", err.Error(), false}
+	case errors.Is(err, broker.ErrInvalidQueueName), errors.Is(err, broker.ErrRejected),
+		errors.Is(err, broker.ErrSchemaViolation), errors.Is(err, broker.ErrCrossTenant):
+		return clientError("InvalidParameterValue", "%s", err.Error())
+	}
+	return &apiError{http.StatusInternalServerError, "InternalError", "InternalError", err.Error(), false}
+}
+
+// attributeValue значение атрибута сообщения; поддерживаются строковые
+// и числовые атрибуты
+type attributeValue struct {
+	DataType    string `xml:"DataType"`
+	StringValue string `xml:"StringValue"`
+	BinaryValue []byte `json:",omitempty" xml:"-"`
+}
+
+type xmlAttribute struct {
+	Name  string
+	Value attributeValue
+}
+
+// input параметры запроса любого из поддерживаемых действий
+type input struct {
+	QueueName              string
+	QueueUrl               string
+	MessageBody            string
+	DelaySeconds           *int
+	MessageAttributes      map[string]attributeValue
+	MessageGroupId         string
+	MessageDeduplicationId string
+	MaxNumberOfMessages    *int
+	WaitTimeSeconds        *int
+	VisibilityTimeout      *int
+	MessageAttributeNames  []string
+	ReceiptHandle          string
+}
+
+type queueURLResult struct {
+	XMLName  xml.Name `json:"-"`
+	QueueUrl string
+}
+
+type sendResult struct {
+	XMLName                xml.Name `xml:"SendMessageResult" json:"-"`
+	MessageId              string
+	MD5OfMessageBody       string
+	MD5OfMessageAttributes string `json:",omitempty" xml:",omitempty"`
+}
+
+type message struct {
+	MessageId              string
+	ReceiptHandle          string
+	MD5OfBody              string
+	Body                   string
+	MD5OfMessageAttributes string                    `json:",omitempty" xml:",omitempty"`
+	MessageAttributes      map[string]attributeValue `json:",omitempty" xml:"-"`
+	XMLAttributes          []xmlAttribute            `json:"-" xml:"MessageAttribute"`
+}
+
+type receiveResult struct {
+	XMLName  xml.Name  `xml:"ReceiveMessageResult" json:"-"`
+	Messages []message `json:",omitempty" xml:"Message"`
+}
+
+// xmlResponse ответ протокола Query
+type xmlResponse struct {
+	XMLName   xml.Name
+	Xmlns     string `xml:"xmlns,attr"`
+	Result    any
+	RequestID string `xml:"ResponseMetadata>RequestId"`
+}
+
+type xmlErrorResponse struct {
+	XMLName xml.Name `xml:"ErrorResponse"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Error   struct {
+		Type    string
+		Code    string
+		Message string
+	}
+	RequestID string `xml:"RequestId"`
+}
+
+// Server обрабатывает запросы SQS поверх брокера. Подписи запросов не
+// проверяются: действия выполняются от имени анонимного субъекта, поэтому
+// очереди с владельцем (см. broker.QueueACL) через фронтенд недоступны.
+type Server struct {
+	qb *broker.QueueBroker
+}
+
+// NewServer создает фронтенд SQS для брокера
+func NewServer(qb *broker.QueueBroker) *Server {
+	return &Server{qb: qb}
+}
+
+// ServeHTTP разбирает запрос протокола JSON (X-Amz-Target: AmazonSQS.<Action>)
+// или Query (параметр Action) и отвечает в том же протоколе
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	requestID := newID()
+	w.Header().Set("X-Amzn-RequestId", requestID)
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBytes)
+
+	var action string
+	var in input
+	var err *apiError
+	jsonProtocol := strings.HasPrefix(r.Header.Get("X-Amz-Target"), jsonPrefix)
+	if jsonProtocol {
+		action = strings.TrimPrefix(r.Header.Get("X-Amz-Target"), jsonPrefix)
+		if decodeErr := json.NewDecoder(r.Body).Decode(&in); decodeErr != nil {
+			err = clientError("InvalidParameterValue", "invalid request body: %v", decodeErr)
+		}
+	} else if parseErr := r.ParseForm(); parseErr != nil {
+		err = clientError("InvalidParameterValue", "invalid request: %v", parseErr)
+	} else {
+		action = r.Form.Get("Action")
+		in, err = queryInput(r.Form)
+	}
+	if in.QueueUrl == "" && in.QueueName == "" {
+		in.QueueUrl = r.URL.Path
+	}
+
+	var result any
+	if err == nil {
+		result, err = s.do(r, action, &in)
+	}
+	if err != nil {
+		writeError(w, jsonProtocol, requestID, err)
+		return
+	}
+	if jsonProtocol {
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		w.WriteHeader(http.StatusOK)
+		if result == nil {
+			result = struct{}{}
+		}
+		json.NewEncoder(w).Encode(result)
+		return
+	}
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(xmlResponse{
+		XMLName:   xml.Name{Local: action + "Response"},
+		Xmlns:     xmlns,
+		Result:    result,
+		RequestID: requestID,
+	})
+}
+
+func (s *Server) do(r *http.Request, action string, in *input) (any, *apiError) {
+	switch action {
+	case "CreateQueue", "GetQueueUrl":
+		if in.QueueName == "" {
+			return nil, clientError("MissingParameter", "The request must contain the parameter QueueName.")
+		}
+		if broker.IsPattern(in.QueueName) {
+			return nil, clientError("InvalidParameterValue", "invalid queue name %q", in.QueueName)
+		}
+		// Очереди брокера создаются первым сообщением, поэтому адрес
+		// возвращается для любого допустимого имени
+		return queueURLResult{XMLName: xml.Name{Local: action + "Result"}, QueueUrl: queueURL(r, in.QueueName)}, nil
+	case "SendMessage":
+		return s.send(in)
+	case "ReceiveMessage":
+		return s.receive(in)
+	case "DeleteMessage":
+		queueName, err := s.queue(in, broker.PermConsume)
+		if err != nil {
+			return nil, err
+		}
+		if in.ReceiptHandle == "" {
+			return nil, clientError("MissingParameter", "The request must contain the parameter ReceiptHandle.")
+		}
+		if err := s.qb.Complete(queueName, in.ReceiptHandle); err != nil {
+			return nil, brokerError(err)
+		}
+		return nil, nil
+	case "":
+		return nil, clientError("MissingAction", "The request must contain the parameter Action.")
+	}
+	return nil, clientError("InvalidAction", "The action %s is not valid for this endpoint.", action)
+}
+
+// queue извлекает имя очереди из QueueUrl и проверяет право perm на нее
+func (s *Server) queue(in *input, perm broker.Permission) (string, *apiError) {
+	if in.QueueUrl == "" {
+		return "", clientError("MissingParameter", "The request must contain the parameter QueueUrl.")
+	}
+	path := in.QueueUrl
+	if u, err := url.Parse(in.QueueUrl); err == nil {
+		path = u.Path
+	}
+	path = strings.Trim(path, "/")
+	queueName := path[strings.LastIndex(path, "/")+1:]
+	if queueName == "" || broker.IsPattern(queueName) {
+		return "", brokerError(broker.ErrQueueNotFound)
+	}
+	if !s.qb.Authorize("", queueName, perm) {
+		return "", brokerError(broker.ErrPermissionDenied)
+	}
+	return queueName, nil
+}
+
+func (s *Server) send(in *input) (any, *apiError) {
+	queueName, apiErr := s.queue(in, broker.PermProduce)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	if in.MessageBody == "" {
+		return nil, clientError("MissingParameter", "The request must contain the parameter MessageBody.")
+	}
+	id := newID()
+	msg := &broker.Message{
+		Body:    in.MessageBody,
+		Headers: map[string]string{MessageIDHeader: id},
+		GroupID: in.MessageGroupId,
+		DedupID: in.MessageDeduplicationId,
+	}
+	for name, value := range in.MessageAttributes {
+		if value.DataType == "" || strings.HasPrefix(value.DataType, "Binary") || value.BinaryValue != nil {
+			return nil, clientError("InvalidParameterValue", "message attribute %s: only String and Number attributes are supported", name)
+		}
+		msg.Headers[name] = value.StringValue
+	}
+	if in.DelaySeconds != nil {
+		if *in.DelaySeconds < 0 || *in.DelaySeconds > maxDelaySeconds {
+			return nil, clientError("InvalidParameterValue", "DelaySeconds must be between 0 and %d", maxDelaySeconds)
+		}
+		if *in.DelaySeconds > 0 {
+			msg.DeliverAt = time.Now().Add(time.Duration(*in.DelaySeconds) * time.Second)
+		}
+	}
+	// Повтор с тем же MessageDeduplicationId, как и в SQS, не считается ошибкой
+	if err := s.qb.Enqueue(queueName, msg); err != nil && !errors.Is(err, broker.ErrDuplicate) {
+		return nil, brokerError(err)
+	}
+	return sendResult{
+		MessageId:              id,
+		MD5OfMessageBody:       md5Hex(in.MessageBody),
+		MD5OfMessageAttributes: md5OfAttributes(in.MessageAttributes),
+	}, nil
+}
+
+// receive выдает до MaxNumberOfMessages сообщений в режиме peek-lock:
+// первого сообщения ждет до WaitTimeSeconds, остальные берет без ожидания
+func (s *Server) receive(in *input) (any, *apiError) {
+	queueName, apiErr := s.queue(in, broker.PermConsume)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	limit, wait, visibility := 1, 0, defaultVisibility
+	if in.MaxNumberOfMessages != nil {
+		if limit = *in.MaxNumberOfMessages; limit < 1 || limit > maxReceive {
+			return nil, clientError("InvalidParameterValue", "MaxNumberOfMessages must be between 1 and %d", maxReceive)
+		}
+	}
+	if in.WaitTimeSeconds != nil {
+		if wait = *in.WaitTimeSeconds; wait < 0 || wait > maxWaitSeconds {
+			return nil, clientError("InvalidParameterValue", "WaitTimeSeconds must be between 0 and %d", maxWaitSeconds)
+		}
+	}
+	if in.VisibilityTimeout != nil {
+		if visibility = time.Duration(*in.VisibilityTimeout) * time.Second; visibility < 0 || visibility > maxVisibility {
+			return nil, clientError("InvalidParameterValue", "VisibilityTimeout must be between 0 and %d", int(maxVisibility.Seconds()))
+		}
+	}
+
+	result := receiveResult{}
+	for len(result.Messages) < limit {
+		delivery, err := s.qb.PeekLock(queueName, time.Duration(wait)*time.Second, visibility)
+		if errors.Is(err, broker.ErrTimeout) || errors.Is(err, broker.ErrQueueNotFound) || err != nil && len(result.Messages) > 0 {
+			break
+		}
+		if err != nil {
+			return nil, brokerError(err)
+		}
+		wait = 0
+		result.Messages = append(result.Messages, outgoing(delivery, in.MessageAttributeNames))
+	}
+	return result, nil
+}
+
+// outgoing переводит выданное сообщение в сообщение SQS; заголовки
+// возвращаются строковыми атрибутами, если они запрошены
+func outgoing(d *broker.Delivery, names []string) message {
+	m := message{
+		MessageId:     d.Headers[MessageIDHeader],
+		ReceiptHandle: d.LockToken,
+		MD5OfBody:     md5Hex(d.Body),
+		Body:          d.Body,
+	}
+	// Сообщения, поставленные не через SQS, получают идентификатор блокировки
+	if m.MessageId == "" {
+		m.MessageId = d.LockToken
+	}
+	for name, value := range d.Headers {
+		if name == MessageIDHeader || !attributeRequested(names, name) {
+			continue
+		}
+		if m.MessageAttributes == nil {
+			m.MessageAttributes = make(map[string]attributeValue)
+		}
+		m.MessageAttributes[name] = attributeValue{DataType: "String", StringValue: value}
+	}
+	for _, name := range sortedNames(m.MessageAttributes) {
+		m.XMLAttributes = append(m.XMLAttributes, xmlAttribute{Name: name, Value: m.MessageAttributes[name]})
+	}
+	m.MD5OfMessageAttributes = md5OfAttributes(m.MessageAttributes)
+	return m
+}
+
+// attributeRequested проверяет имя атрибута по списку MessageAttributeNames:
+// All или .* — все атрибуты, prefix.* — атрибуты с префиксом
+func attributeRequested(names []string, name string) bool {
+	for _, requested := range names {
+		if requested == "All" || requested == ".*" || requested == name {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(requested, ".*"); ok && strings.HasPrefix(name, prefix+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// queryInput разбирает параметры протокола Query, в том числе
+// MessageAttribute.N.Name/Value.* и MessageAttributeName.N
+func queryInput(form url.Values) (input, *apiError) {
+	in := input{
+		QueueName:              form.Get("QueueName"),
+		QueueUrl:               form.Get("QueueUrl"),
+		MessageBody:            form.Get("MessageBody"),
+		MessageGroupId:         form.Get("MessageGroupId"),
+		MessageDeduplicationId: form.Get("MessageDeduplicationId"),
+		ReceiptHandle:          form.Get("ReceiptHandle"),
+	}
+	for name, field := range map[string]**int{
+		"DelaySeconds":        &in.DelaySeconds,
+		"MaxNumberOfMessages": &in.MaxNumberOfMessages,
+		"WaitTimeSeconds":     &in.WaitTimeSeconds,
+		"VisibilityTimeout":   &in.VisibilityTimeout,
+	} {
+		if value := form.Get(name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return in, clientError("InvalidParameterValue", "%s must be an integer", name)
+			}
+			*field = &n
+		}
+	}
+	for i := 1; ; i++ {
+		prefix := "MessageAttribute." + strconv.Itoa(i) + "."
+		name := form.Get(prefix + "Name")
+		if name == "" {
+			break
+		}
+		if in.MessageAttributes == nil {
+			in.MessageAttributes = make(map[string]attributeValue)
+		}
+		value := attributeValue{DataType: form.Get(prefix + "Value.DataType"), StringValue: form.Get(prefix + "Value.StringValue")}
+		if form.Has(prefix + "Value.BinaryValue") {
+			value.BinaryValue = []byte{}
+		}
+		in.MessageAttributes[name] = value
+	}
+	for i := 1; ; i++ {
+		name := form.Get("MessageAttributeName." + strconv.Itoa(i))
+		if name == "" {
+			break
+		}
+		in.MessageAttributeNames = append(in.MessageAttributeNames, name)
+	}
+	return in, nil
+}
+
+func writeError(w http.ResponseWriter, jsonProtocol bool, requestID string, e *apiError) {
+	kind := "Receiver"
+	if e.Sender {
+		kind = "Sender"
+	}
+	if jsonProtocol {
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		// По этому заголовку SDK восстанавливают коды ошибок протокола Query
+		w.Header().Set("X-Amzn-Query-Error", e.Code+";"+kind)
+		w.WriteHeader(e.Status)
+		json.NewEncoder(w).Encode(map[string]string{"__type": "com.amazonaws.sqs#" + e.Type, "message": e.Message})
+		return
+	}
+	resp := xmlErrorResponse{Xmlns: xmlns, RequestID: requestID}
+	resp.Error.Type, resp.Error.Code, resp.Error.Message = kind, e.Code, e.Message
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(e.Status)
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(resp)
+}
+
+// queueURL адрес очереди на том же хосте, через который пришел запрос
+func queueURL(r *http.Request, queueName string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + "/" + AccountID + "/" + queueName
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// md5OfAttributes контрольная сумма атрибутов по алгоритму SQS: атрибуты
+// по алфавиту, для каждого — имя, тип, признак строкового значения и значение,
+// строки с длиной в 4 байта big-endian
+func md5OfAttributes(attrs map[string]attributeValue) string {
+	if len(attrs) == 0 {
+		return ""
+	}
+	h := md5.New()
+	writeString := func(s string) {
+		binary.Write(h, binary.BigEndian, uint32(len(s)))
+		h.Write([]byte(s))
+	}
+	for _, name := range sortedNames(attrs) {
+		writeString(name)
+		writeString(attrs[name].DataType)
+		h.Write([]byte{1})
+		writeString(attrs[name].StringValue)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func sortedNames(attrs map[string]attributeValue) []string {
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newID случайный идентификатор в формате UUID версии 4
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,206 @@
+package sqs
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"queue-broker/pkg/broker"
+)
+
+func newTestServer(t *testing.T) (*broker.QueueBroker, *httptest.Server) {
+	t.Helper()
+	qb := broker.NewQueueBroker(10, 10, 1)
+	ts := httptest.NewServer(NewServer(qb))
+	t.Cleanup(ts.Close)
+	return qb, ts
+}
+
+// callJSON выполняет действие протокола JSON и разбирает ответ в out
+func callJSON(t *testing.T, ts *httptest.Server, action string, body map[string]any, out any) int {
+	t.Helper()
+	data, _ := json.Marshal(body)
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/", strings.NewReader(string(data)))
+	req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	req.Header.Set("X-Amz-Target", "AmazonSQS."+action)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// TestJSONProtocol проверяет отправку, получение и удаление сообщений по протоколу JSON
+func TestJSONProtocol(t *testing.T) {
+	_, ts := newTestServer(t)
+
+	var queue struct{ QueueUrl string }
+	if code := callJSON(t, ts, "GetQueueUrl", map[string]any{"QueueName": "jobs"}, &queue); code != http.StatusOK {
+		t.Fatalf("unexpected status %d", code)
+	}
+	if !strings.HasSuffix(queue.QueueUrl, "/"+AccountID+"/jobs") {
+		t.Fatalf("unexpected queue url %q", queue.QueueUrl)
+	}
+
+	var sent sendResult
+	callJSON(t, ts, "SendMessage", map[string]any{
+		"QueueUrl":    queue.QueueUrl,
+		"MessageBody": "hello",
+		"MessageAttributes": map[string]any{
+			"source": map[string]string{"DataType": "String", "StringValue": "test"},
+		},
+	}, &sent)
+	if sent.MessageId == "" || sent.MD5OfMessageBody != "5d41402abc4b2a76b9719d911017c592" {
+		t.Fatalf("unexpected send result %+v", sent)
+	}
+
+	var received receiveResult
+	callJSON(t, ts, "ReceiveMessage", map[string]any{
+		"QueueUrl":              queue.QueueUrl,
+		"MaxNumberOfMessages":   10,
+		"MessageAttributeNames": []string{"All"},
+	}, &received)
+	if len(received.Messages) != 1 {
+		t.Fatalf("expected 1 message, got %+v", received)
+	}
+	m := received.Messages[0]
+	if m.MessageId != sent.MessageId || m.Body != "hello" || m.MD5OfBody != sent.MD5OfMessageBody {
+		t.Errorf("unexpected message %+v", m)
+	}
+	if m.MessageAttributes["source"].StringValue != "test" || m.MD5OfMessageAttributes != sent.MD5OfMessageAttributes {
+		t.Errorf("unexpected attributes %+v", m)
+	}
+	if _, ok := m.MessageAttributes[MessageIDHeader]; ok {
+		t.Error("message id header must not be returned as attribute")
+	}
+
+	if code := callJSON(t, ts, "DeleteMessage", map[string]any{"QueueUrl": queue.QueueUrl, "ReceiptHandle": m.ReceiptHandle}, nil); code != http.StatusOK {
+		t.Fatalf("unexpected delete status %d", code)
+	}
+	var failure map[string]string
+	if code := callJSON(t, ts, "DeleteMessage", map[string]any{"QueueUrl": queue.QueueUrl, "ReceiptHandle": m.ReceiptHandle}, &failure); code != http.StatusBadRequest {
+		t.Fatalf("unexpected second delete status %d", code)
+	}
+	if failure["__type"] != "com.amazonaws.sqs#ReceiptHandleIsInvalid" {
+		t.Errorf("unexpected error %v", failure)
+	}
+
+	var empty receiveResult
+	callJSON(t, ts, "ReceiveMessage", map[string]any{"QueueUrl": queue.QueueUrl}, &empty)
+	if len(empty.Messages) != 0 {
+		t.Errorf("expected no messages, got %+v", empty)
+	}
+}
+
+// TestQueryProtocol проверяет те же действия по протоколу Query с ответами XML
+func TestQueryProtocol(t *testing.T) {
+	qb, ts := newTestServer(t)
+	queueURL := ts.URL + "/" + AccountID + "/jobs"
+
+	post := func(form url.Values) (int, string) {
+		resp, err := http.PostForm(queueURL, form)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	code, body := post(url.Values{
+		"Action":                               {"SendMessage"},
+		"MessageBody":                          {"hello"},
+		"MessageAttribute.1.Name":              {"n"},
+		"MessageAttribute.1.Value.DataType":    {"Number"},
+		"MessageAttribute.1.Value.StringValue": {"42"},
+	})
+	if code != http.StatusOK || !strings.Contains(body, "<SendMessageResponse") || !strings.Contains(body, "<MD5OfMessageBody>5d41402abc4b2a76b9719d911017c592</MD5OfMessageBody>") {
+		t.Fatalf("unexpected send response %d %s", code, body)
+	}
+	if qb.Depth("jobs") != 1 {
+		t.Fatal("message must be enqueued")
+	}
+
+	code, body = post(url.Values{"Action": {"ReceiveMessage"}, "MessageAttributeName.1": {"n"}})
+	var resp struct {
+		Messages []struct {
+			ReceiptHandle string
+			Body          string
+			Attributes    []xmlAttribute `xml:"MessageAttribute"`
+		} `xml:"ReceiveMessageResult>Message"`
+	}
+	if err := xml.Unmarshal([]byte(body), &resp); err != nil || code != http.StatusOK {
+		t.Fatalf("unexpected receive response %d %s: %v", code, body, err)
+	}
+	if len(resp.Messages) != 1 || resp.Messages[0].Body != "hello" || len(resp.Messages[0].Attributes) != 1 || resp.Messages[0].Attributes[0].Value.StringValue != "42" {
+		t.Fatalf("unexpected messages %+v", resp.Messages)
+	}
+
+	code, body = post(url.Values{"Action": {"DeleteMessage"}, "ReceiptHandle": {resp.Messages[0].ReceiptHandle}})
+	if code != http.StatusOK || !strings.Contains(body, "<DeleteMessageResponse") {
+		t.Fatalf("unexpected delete response %d %s", code, body)
+	}
+
+	code, body = post(url.Values{"Action": {"PurgeQueue"}})
+	if code != http.StatusBadRequest || !strings.Contains(body, "<Code>InvalidAction</Code>") {
+		t.Errorf("unexpected response for unknown action %d %s", code, body)
+	}
+}
+
+// TestSendValidationAndDelay проверяет ошибки SendMessage и задержку DelaySeconds
+func TestSendValidationAndDelay(t *testing.T) {
+	qb, ts := newTestServer(t)
+	queueURL := ts.URL + "/" + AccountID + "/jobs"
+
+	var failure map[string]string
+	if code := callJSON(t, ts, "SendMessage", map[string]any{"QueueUrl": queueURL, "MessageBody": "x", "DelaySeconds": 901}, &failure); code != http.StatusBadRequest {
+		t.Fatalf("unexpected status %d", code)
+	}
+	if code := callJSON(t, ts, "SendMessage", map[string]any{"QueueUrl": queueURL}, &failure); code != http.StatusBadRequest || failure["__type"] != "com.amazonaws.sqs#MissingParameter" {
+		t.Fatalf("unexpected response %d %v", code, failure)
+	}
+
+	callJSON(t, ts, "SendMessage", map[string]any{"QueueUrl": queueURL, "MessageBody": "later", "DelaySeconds": 60}, nil)
+	var received receiveResult
+	callJSON(t, ts, "ReceiveMessage", map[string]any{"QueueUrl": queueURL}, &received)
+	if len(received.Messages) != 0 {
+		t.Errorf("delayed message must not be delivered yet: %+v", received)
+	}
+
+	// Повтор с тем же MessageDeduplicationId принимается, но не ставится повторно
+	for range 2 {
+		if code := callJSON(t, ts, "SendMessage", map[string]any{"QueueUrl": queueURL, "MessageBody": "once", "MessageDeduplicationId": "d1"}, nil); code != http.StatusOK {
+			t.Fatalf("unexpected status %d", code)
+		}
+	}
+	// В очереди отложенное сообщение и одна копия повтора
+	if depth := qb.Depth("jobs"); depth != 2 {
+		t.Errorf("expected 2 messages, got %d", depth)
+	}
+}
+
+// TestMD5OfAttributes проверяет дайджест атрибутов сообщения и выбор атрибутов по префиксу
+func TestMD5OfAttributes(t *testing.T) {
+	// 00000001 "a" 00000006 "String" 01 00000001 "b"
+	got := md5OfAttributes(map[string]attributeValue{"a": {DataType: "String", StringValue: "b"}})
+	if got != "bef8bf215374a0a228d67533b1a488be" {
+		t.Errorf("unexpected digest %q", got)
+	}
+	if md5OfAttributes(nil) != "" {
+		t.Error("empty attributes must have no digest")
+	}
+	if attributeRequested([]string{"app.*"}, "other") || !attributeRequested([]string{"app.*"}, "app.id") {
+		t.Error("unexpected prefix matching")
+	}
+}
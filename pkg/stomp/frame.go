@@ -0,0 +1,191 @@
+package stomp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maxFrameSize ограничение размера тела кадра, принимаемого от клиента
+const maxFrameSize = 1 << 20
+
+// frame кадр STOMP
+type frame struct {
+	command string
+	headers [][2]string
+	body    []byte
+}
+
+func newFrame(command string, headers ...string) *frame {
+	f := &frame{command: command}
+	for i := 0; i+1 < len(headers); i += 2 {
+		f.headers = append(f.headers, [2]string{headers[i], headers[i+1]})
+	}
+	return f
+}
+
+// header возвращает значение заголовка; при повторах действует первое (STOMP 1.2)
+func (f *frame) header(name string) string {
+	for _, h := range f.headers {
+		if h[0] == name {
+			return h[1]
+		}
+	}
+	return ""
+}
+
+func (f *frame) add(name, value string) {
+	f.headers = append(f.headers, [2]string{name, value})
+}
+
+// readFrame читает кадр, пропуская пустые строки между кадрами (heart-beat)
+func readFrame(r *bufio.Reader, escaped bool) (*frame, error) {
+	var command string
+	for command == "" {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		command = line
+	}
+
+	f := &frame{command: command}
+	contentLength := -1
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if line == "" {
+			break
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("malformed header %q", line)
+		}
+		// В CONNECT заголовки не экранируются
+		if escaped && command != "CONNECT" && command != "STOMP" {
+			if name, err = unescape(name); err != nil {
+				return nil, err
+			}
+			if value, err = unescape(value); err != nil {
+				return nil, err
+			}
+		}
+		if name == "content-length" && contentLength < 0 {
+			if contentLength, err = strconv.Atoi(value); err != nil || contentLength < 0 || contentLength > maxFrameSize {
+				return nil, fmt.Errorf("invalid content-length %q", value)
+			}
+		}
+		f.headers = append(f.headers, [2]string{name, value})
+	}
+
+	if contentLength >= 0 {
+		f.body = make([]byte, contentLength)
+		if _, err := io.ReadFull(r, f.body); err != nil {
+			return nil, err
+		}
+		if b, err := r.ReadByte(); err != nil {
+			return nil, err
+		} else if b != 0 {
+			return nil, errors.New("frame is not terminated by NUL")
+		}
+		return f, nil
+	}
+
+	body, err := r.ReadSlice(0)
+	for err == bufio.ErrBufferFull {
+		f.body = append(f.body, body...)
+		if len(f.body) > maxFrameSize {
+			return nil, errors.New("frame too large")
+		}
+		body, err = r.ReadSlice(0)
+	}
+	if err != nil {
+		return nil, err
+	}
+	f.body = append(f.body, body[:len(body)-1]...)
+	return f, nil
+}
+
+// readLine читает строку, завершенную LF или CRLF
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) > maxFrameSize {
+		return "", errors.New("header line too long")
+	}
+	line = strings.TrimSuffix(line, "\n")
+	return strings.TrimSuffix(line, "\r"), nil
+}
+
+// encode сериализует кадр; content-length добавляется всегда, поэтому тело
+// может содержать NUL
+func (f *frame) encode(escaped bool) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(f.command)
+	buf.WriteByte('\n')
+	for _, h := range f.headers {
+		if h[0] == "content-length" {
+			continue
+		}
+		name, value := h[0], h[1]
+		if escaped && f.command != "CONNECTED" {
+			name, value = escape(name), escape(value)
+		}
+		buf.WriteString(name)
+		buf.WriteByte(':')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+	}
+	if f.command != "CONNECTED" || len(f.body) > 0 {
+		buf.WriteString("content-length:")
+		buf.WriteString(strconv.Itoa(len(f.body)))
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+	buf.Write(f.body)
+	buf.WriteByte(0)
+	return buf.Bytes()
+}
+
+var escaper = strings.NewReplacer("\\", "\\\\", "\r", "\\r", "\n", "\\n", ":", "\\c")
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+func unescape(s string) (string, error) {
+	if !strings.Contains(s, "\\") {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i++; i == len(s) {
+			return "", errors.New("invalid escape sequence")
+		}
+		switch s[i] {
+		case '\\':
+			b.WriteByte('\\')
+		case 'r':
+			b.WriteByte('\r')
+		case 'n':
+			b.WriteByte('\n')
+		case 'c':
+			b.WriteByte(':')
+		default:
+			return "", fmt.Errorf("invalid escape sequence \\%c", s[i])
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,56 @@
+package stomp
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	f := newFrame("SEND", "destination", "/queue/orders", "note", "a:b\nc\\d")
+	f.body = []byte("with\x00nul")
+
+	got, err := readFrame(bufio.NewReader(bytes.NewReader(f.encode(true))), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.command != "SEND" || got.header("note") != "a:b\nc\\d" || string(got.body) != "with\x00nul" {
+		t.Errorf("unexpected frame %+v", got)
+	}
+}
+
+func TestReadFrameWithoutContentLength(t *testing.T) {
+	data := "\n\r\nSEND\r\ndestination:/queue/a\r\n\r\nhello\x00"
+	f, err := readFrame(bufio.NewReader(bytes.NewBufferString(data)), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.command != "SEND" || f.header("destination") != "/queue/a" || string(f.body) != "hello" {
+		t.Errorf("unexpected frame %+v", f)
+	}
+}
+
+func TestReadFrameInvalidEscape(t *testing.T) {
+	data := "SEND\ndestination:\\t\n\n\x00"
+	if _, err := readFrame(bufio.NewReader(bytes.NewBufferString(data)), true); err == nil {
+		t.Error("expected invalid escape sequence to be rejected")
+	}
+}
+
+func TestDestinationToQueue(t *testing.T) {
+	for destination, want := range map[string]string{
+		"/queue/orders":    "orders",
+		"orders.eu":        "orders.eu",
+		"/queue/orders.*":  "orders.*",
+		"/topic/orders":    "",
+		"/queue/":          "",
+		"/queue/@acme.a":   "",
+		"":                 "",
+		"/queue/orders/eu": "",
+	} {
+		got, err := destinationToQueue(destination)
+		if got != want || (err == nil) != (want != "") {
+			t.Errorf("destinationToQueue(%q) = %q, %v", destination, got, err)
+		}
+	}
+}
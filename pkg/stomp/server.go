@@ -0,0 +1,535 @@
+// Package stomp реализует STOMP-фронтенд брокера очередей (STOMP 1.0–1.2)
+// поверх TCP и WebSocket: SEND ставит сообщение в очередь, SUBSCRIBE получает
+// сообщения очереди с подтверждением auto, client или client-individual.
+package stomp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"queue-broker/pkg/broker"
+)
+
+const (
+	// maxUnacked число выданных и еще не подтвержденных сообщений на подписку
+	// в режимах client и client-individual
+	maxUnacked = 16
+	// connectTimeout время ожидания кадра CONNECT после установки соединения
+	connectTimeout = 10 * time.Second
+)
+
+// supportedVersions поддерживаемые версии протокола в порядке предпочтения
+var supportedVersions = []string{"1.2", "1.1", "1.0"}
+
+// Заголовки кадров, которые не сохраняются в сообщении
+var frameHeaders = map[string]bool{
+	"destination": true, "content-length": true, "receipt": true, "transaction": true,
+}
+
+// deliveryHeaders заголовки, которые сервер сам задает в кадре MESSAGE
+var deliveryHeaders = map[string]bool{
+	"subscription": true, "message-id": true, "ack": true, "lease-deadline": true, "lease-duration": true,
+}
+
+// Server STOMP-сервер поверх брокера
+type Server struct {
+	qb *broker.QueueBroker
+	// retryInterval пауза перед повторной попыткой получить сообщение
+	// из еще не созданной очереди
+	retryInterval time.Duration
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[*conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// NewServer создает STOMP-сервер для брокера
+func NewServer(qb *broker.QueueBroker) *Server {
+	return &Server{
+		qb:            qb,
+		retryInterval: time.Second,
+		listeners:     make(map[net.Listener]struct{}),
+		conns:         make(map[*conn]struct{}),
+	}
+}
+
+// ListenAndServe принимает TCP-соединения на адресе addr
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve принимает соединения, пока не будет вызван Close
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return errors.New("server closed")
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		go s.serveConn(nc)
+	}
+}
+
+// Close закрывает слушатели и все соединения
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for c := range s.conns {
+		c.nc.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return nil
+}
+
+// serveConn обслуживает соединение до его закрытия
+func (s *Server) serveConn(nc net.Conn) {
+	c := newConn(s, nc)
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		nc.Close()
+		return
+	}
+	s.conns[c] = struct{}{}
+	s.wg.Add(1)
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		s.wg.Done()
+	}()
+	c.serve()
+}
+
+// conn соединение с клиентом STOMP
+type conn struct {
+	s  *Server
+	nc net.Conn
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	subWg  sync.WaitGroup
+
+	writeMu sync.Mutex
+	// escaped экранирование заголовков (STOMP 1.1 и новее)
+	escaped bool
+
+	mu     sync.Mutex
+	subs   map[string]*subscription
+	acks   map[string]*pendingAck
+	nextID int
+}
+
+// subscription подписка клиента на очередь
+type subscription struct {
+	id          string
+	destination string
+	queueName   string
+	ackMode     string
+	cancel      context.CancelFunc
+	// window ограничивает число неподтвержденных сообщений
+	window chan struct{}
+	// unacked идентификаторы неподтвержденных сообщений в порядке выдачи
+	unacked []string
+}
+
+// pendingAck выданное сообщение, ожидающее ACK или NACK
+type pendingAck struct {
+	sub       *subscription
+	queueName string
+	lockToken string
+}
+
+func newConn(s *Server, nc net.Conn) *conn {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &conn{
+		s:      s,
+		nc:     nc,
+		ctx:    ctx,
+		cancel: cancel,
+		subs:   make(map[string]*subscription),
+		acks:   make(map[string]*pendingAck),
+	}
+}
+
+var errDisconnect = errors.New("disconnect")
+
+func (c *conn) serve() {
+	defer func() {
+		c.cancel()
+		c.nc.Close()
+		c.subWg.Wait()
+		// Неподтвержденные сообщения сразу возвращаются в очереди
+		c.mu.Lock()
+		for _, ack := range c.acks {
+			c.s.qb.Abandon(ack.queueName, ack.lockToken)
+		}
+		c.mu.Unlock()
+	}()
+
+	r := bufio.NewReader(c.nc)
+	c.nc.SetReadDeadline(time.Now().Add(connectTimeout))
+	f, err := readFrame(r, false)
+	if err != nil {
+		return
+	}
+	if err := c.handleConnect(f); err != nil {
+		c.sendError(f, err)
+		return
+	}
+	c.nc.SetReadDeadline(time.Time{})
+
+	for {
+		f, err := readFrame(r, c.escaped)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) && !errors.Is(err, io.EOF) {
+				c.sendError(nil, err)
+			}
+			return
+		}
+		if err := c.handle(f); err != nil {
+			if err != errDisconnect {
+				c.sendError(f, err)
+			}
+			return
+		}
+		if receipt := f.header("receipt"); receipt != "" {
+			if err := c.write(newFrame("RECEIPT", "receipt-id", receipt)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// handleConnect согласует версию протокола и отвечает CONNECTED
+func (c *conn) handleConnect(f *frame) error {
+	if f.command != "CONNECT" && f.command != "STOMP" {
+		return fmt.Errorf("expected CONNECT, got %s", f.command)
+	}
+	accepted := strings.Split(f.header("accept-version"), ",")
+	if accepted[0] == "" {
+		accepted = []string{"1.0"}
+	}
+	version := ""
+	for _, v := range supportedVersions {
+		for _, a := range accepted {
+			if strings.TrimSpace(a) == v && version == "" {
+				version = v
+			}
+		}
+	}
+	if version == "" {
+		return errors.New("supported protocol versions are " + strings.Join(supportedVersions, ","))
+	}
+
+	c.escaped = version != "1.0"
+	connected := newFrame("CONNECTED", "version", version, "server", "queue-broker")
+	if version != "1.0" {
+		// Сервер не отправляет и не требует heart-beat
+		connected.add("heart-beat", "0,0")
+	}
+	return c.write(connected)
+}
+
+func (c *conn) handle(f *frame) error {
+	switch f.command {
+	case "SEND":
+		return c.handleSend(f)
+	case "SUBSCRIBE":
+		return c.handleSubscribe(f)
+	case "UNSUBSCRIBE":
+		return c.handleUnsubscribe(f)
+	case "ACK", "NACK":
+		return c.handleAck(f)
+	case "BEGIN", "COMMIT", "ABORT":
+		return errors.New("transactions are not supported")
+	case "DISCONNECT":
+		if receipt := f.header("receipt"); receipt != "" {
+			c.write(newFrame("RECEIPT", "receipt-id", receipt))
+		}
+		return errDisconnect
+	default:
+		return fmt.Errorf("unknown command %s", f.command)
+	}
+}
+
+func (c *conn) handleSend(f *frame) error {
+	if f.header("transaction") != "" {
+		return errors.New("transactions are not supported")
+	}
+	queueName, err := destinationToQueue(f.header("destination"))
+	if err != nil {
+		return err
+	}
+
+	msg := &broker.Message{Body: string(f.body), Headers: make(map[string]string)}
+	for _, h := range f.headers {
+		if _, seen := msg.Headers[h[0]]; !seen && !frameHeaders[h[0]] {
+			msg.Headers[h[0]] = h[1]
+		}
+	}
+	if err := c.s.qb.Enqueue(queueName, msg); err != nil && !errors.Is(err, broker.ErrDuplicate) {
+		return fmt.Errorf("send to %s: %w", f.header("destination"), err)
+	}
+	return nil
+}
+
+func (c *conn) handleSubscribe(f *frame) error {
+	destination := f.header("destination")
+	queueName, err := destinationToQueue(destination)
+	if err != nil {
+		return err
+	}
+	id := f.header("id")
+	if id == "" {
+		// В STOMP 1.0 идентификатор подписки необязателен
+		id = destination
+	}
+	ackMode := f.header("ack")
+	switch ackMode {
+	case "":
+		ackMode = "auto"
+	case "auto", "client", "client-individual":
+	default:
+		return fmt.Errorf("invalid ack mode %q", ackMode)
+	}
+
+	ctx, cancel := context.WithCancel(c.ctx)
+	sub := &subscription{
+		id:          id,
+		destination: destination,
+		queueName:   queueName,
+		ackMode:     ackMode,
+		cancel:      cancel,
+		window:      make(chan struct{}, maxUnacked),
+	}
+	c.mu.Lock()
+	if c.subs[id] != nil {
+		c.mu.Unlock()
+		cancel()
+		return fmt.Errorf("subscription %s already exists", id)
+	}
+	c.subs[id] = sub
+	c.mu.Unlock()
+
+	c.subWg.Add(1)
+	go c.deliver(ctx, sub)
+	return nil
+}
+
+func (c *conn) handleUnsubscribe(f *frame) error {
+	id := f.header("id")
+	if id == "" {
+		id = f.header("destination")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	sub := c.subs[id]
+	if sub == nil {
+		return fmt.Errorf("subscription %s not found", id)
+	}
+	sub.cancel()
+	delete(c.subs, id)
+	// Неподтвержденные сообщения отмененной подписки возвращаются в очередь
+	for _, msgID := range sub.unacked {
+		if ack := c.acks[msgID]; ack != nil {
+			c.s.qb.Abandon(ack.queueName, ack.lockToken)
+			delete(c.acks, msgID)
+		}
+	}
+	return nil
+}
+
+// handleAck подтверждает (ACK) или возвращает в очередь (NACK) сообщение.
+// В режиме client действие распространяется на все предыдущие сообщения подписки.
+func (c *conn) handleAck(f *frame) error {
+	// STOMP 1.2 передает заголовок id, 1.0 и 1.1 — message-id
+	msgID := f.header("id")
+	if msgID == "" {
+		msgID = f.header("message-id")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ack := c.acks[msgID]
+	if ack == nil {
+		return fmt.Errorf("message %s is not awaiting acknowledgement", msgID)
+	}
+	sub := ack.sub
+
+	var ids []string
+	for i, id := range sub.unacked {
+		if id == msgID {
+			if sub.ackMode == "client" {
+				ids = sub.unacked[:i+1]
+				sub.unacked = sub.unacked[i+1:]
+			} else {
+				ids = []string{id}
+				sub.unacked = append(sub.unacked[:i:i], sub.unacked[i+1:]...)
+			}
+			break
+		}
+	}
+
+	for _, id := range ids {
+		pending := c.acks[id]
+		delete(c.acks, id)
+		if f.command == "ACK" {
+			// Ошибка означает, что блокировка истекла и сообщение уже возвращено в очередь
+			c.s.qb.Complete(pending.queueName, pending.lockToken)
+		} else {
+			c.s.qb.Abandon(pending.queueName, pending.lockToken)
+		}
+		<-sub.window
+	}
+	return nil
+}
+
+// deliver выдает сообщения очереди подписчику. Сообщение берется в режиме
+// peek-lock и в режиме auto подтверждается сразу после отправки.
+func (c *conn) deliver(ctx context.Context, sub *subscription) {
+	defer c.subWg.Done()
+	qb := c.s.qb
+	auto := sub.ackMode == "auto"
+	for {
+		if !auto {
+			select {
+			case sub.window <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		lockDuration := time.Duration(qb.QueueConfig(sub.queueName).LockDuration) * time.Second
+		delivery, err := qb.PeekLock(sub.queueName, time.Second, lockDuration)
+		if err != nil {
+			if !auto {
+				<-sub.window
+			}
+			if !errors.Is(err, broker.ErrTimeout) {
+				select {
+				case <-time.After(c.s.retryInterval):
+				case <-ctx.Done():
+					return
+				}
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+
+		c.mu.Lock()
+		if ctx.Err() != nil {
+			c.mu.Unlock()
+			qb.Abandon(delivery.Queue, delivery.LockToken)
+			return
+		}
+		c.nextID++
+		msgID := strconv.Itoa(c.nextID)
+		if !auto {
+			c.acks[msgID] = &pendingAck{sub: sub, queueName: delivery.Queue, lockToken: delivery.LockToken}
+			sub.unacked = append(sub.unacked, msgID)
+		}
+		c.mu.Unlock()
+
+		msg := newFrame("MESSAGE", "subscription", sub.id, "message-id", msgID, "destination", queueToDestination(delivery.Queue))
+		if !auto {
+			// Срок подтверждения: по его истечении сообщение будет доставлено повторно
+			msg.add("ack", msgID)
+			msg.add("lease-deadline", delivery.LockedUntil.UTC().Format(time.RFC3339Nano))
+			msg.add("lease-duration", strconv.Itoa(delivery.LockDuration))
+		}
+		for name, value := range delivery.Headers {
+			if !frameHeaders[name] && !deliveryHeaders[name] {
+				msg.add(name, value)
+			}
+		}
+		msg.body = []byte(delivery.Body)
+		if err := c.write(msg); err != nil {
+			if auto {
+				qb.Abandon(delivery.Queue, delivery.LockToken)
+			}
+			return
+		}
+		if auto {
+			qb.Complete(delivery.Queue, delivery.LockToken)
+		}
+	}
+}
+
+// sendError отправляет кадр ERROR; после него соединение закрывается
+func (c *conn) sendError(f *frame, err error) {
+	errFrame := newFrame("ERROR", "message", err.Error())
+	if f != nil && f.header("receipt") != "" {
+		errFrame.add("receipt-id", f.header("receipt"))
+	}
+	if err := c.write(errFrame); err != nil {
+		return
+	}
+	log.Printf("stomp: %s: %v", c.nc.RemoteAddr(), errFrame.header("message"))
+}
+
+func (c *conn) write(f *frame) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err := c.nc.Write(f.encode(c.escaped))
+	return err
+}
+
+// destinationToQueue переводит назначение STOMP (/queue/orders или orders)
+// в имя очереди
+func destinationToQueue(destination string) (string, error) {
+	name := strings.TrimPrefix(destination, "/queue/")
+	switch {
+	case destination == "":
+		return "", errors.New("missing destination header")
+	case strings.HasPrefix(destination, "/") && name == destination:
+		return "", fmt.Errorf("unsupported destination %q: only /queue/ is supported", destination)
+	case name == "" || strings.Contains(name, "/"):
+		return "", fmt.Errorf("invalid destination %q", destination)
+	case strings.HasPrefix(name, "@"):
+		// Очереди арендаторов недоступны через STOMP
+		return "", fmt.Errorf("invalid destination %q: reserved prefix '@'", destination)
+	}
+	return name, nil
+}
+
+func queueToDestination(queueName string) string {
+	return "/queue/" + queueName
+}
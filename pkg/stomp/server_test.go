@@ -0,0 +1,254 @@
+package stomp
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"queue-broker/pkg/broker"
+)
+
+// testClient минимальный STOMP-клиент для тестов
+type testClient struct {
+	t  *testing.T
+	nc net.Conn
+	r  *bufio.Reader
+}
+
+func startServer(t *testing.T, qb *broker.QueueBroker) (*Server, string) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(qb)
+	s.retryInterval = 10 * time.Millisecond
+	go s.Serve(l)
+	t.Cleanup(func() { s.Close() })
+	return s, l.Addr().String()
+}
+
+func newTestClient(t *testing.T, nc net.Conn, r io.Reader) *testClient {
+	t.Cleanup(func() { nc.Close() })
+	c := &testClient{t: t, nc: nc, r: bufio.NewReader(r)}
+	c.send(newFrame("CONNECT", "accept-version", "1.1,1.2", "host", "/"))
+	if f := c.expect("CONNECTED"); f.header("version") != "1.2" {
+		t.Fatalf("unexpected version %q", f.header("version"))
+	}
+	return c
+}
+
+func dial(t *testing.T, addr string) *testClient {
+	t.Helper()
+	nc, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newTestClient(t, nc, nc)
+}
+
+func (c *testClient) send(f *frame) {
+	if _, err := c.nc.Write(f.encode(true)); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *testClient) expect(command string) *frame {
+	c.t.Helper()
+	c.nc.SetReadDeadline(time.Now().Add(3 * time.Second))
+	f, err := readFrame(c.r, true)
+	if err != nil {
+		c.t.Fatalf("waiting for %s: %v", command, err)
+	}
+	if f.command != command {
+		c.t.Fatalf("expected %s, got %s %v %q", command, f.command, f.headers, f.body)
+	}
+	return f
+}
+
+func TestSendWithReceipt(t *testing.T) {
+	qb := broker.NewQueueBroker(10, 10, 1)
+	_, addr := startServer(t, qb)
+	c := dial(t, addr)
+
+	send := newFrame("SEND", "destination", "/queue/orders", "receipt", "r1", "content-type", "text/plain", "x-id", "42")
+	send.body = []byte("order 1")
+	c.send(send)
+	if f := c.expect("RECEIPT"); f.header("receipt-id") != "r1" {
+		t.Errorf("unexpected receipt %v", f.headers)
+	}
+
+	msg, err := qb.Dequeue("orders", 0)
+	if err != nil || msg.Body != "order 1" || msg.Headers["x-id"] != "42" || msg.Headers["content-type"] != "text/plain" {
+		t.Fatalf("unexpected message %+v %v", msg, err)
+	}
+	if _, ok := msg.Headers["receipt"]; ok {
+		t.Error("frame headers must not be stored in the message")
+	}
+}
+
+func TestSendErrorClosesConnection(t *testing.T) {
+	qb := broker.NewQueueBroker(10, 10, 1)
+	_, addr := startServer(t, qb)
+	c := dial(t, addr)
+
+	c.send(newFrame("SEND", "destination", "/topic/news", "receipt", "r1"))
+	if f := c.expect("ERROR"); f.header("receipt-id") != "r1" || !strings.Contains(f.header("message"), "/queue/") {
+		t.Errorf("unexpected error frame %v", f.headers)
+	}
+	if _, err := readFrame(c.r, true); err == nil {
+		t.Error("expected connection to be closed after ERROR")
+	}
+}
+
+func TestSubscribeClientIndividualAck(t *testing.T) {
+	qb := broker.NewQueueBroker(10, 10, 1)
+	_, addr := startServer(t, qb)
+	qb.PutMessage("jobs", "job 1")
+	qb.PutMessage("jobs", "job 2")
+	c := dial(t, addr)
+
+	c.send(newFrame("SUBSCRIBE", "id", "s1", "destination", "/queue/jobs", "ack", "client-individual"))
+	first := c.expect("MESSAGE")
+	second := c.expect("MESSAGE")
+	if string(first.body) != "job 1" || first.header("subscription") != "s1" || first.header("destination") != "/queue/jobs" {
+		t.Fatalf("unexpected message %v %q", first.headers, first.body)
+	}
+	if deadline, err := time.Parse(time.RFC3339Nano, first.header("lease-deadline")); err != nil || !deadline.After(time.Now()) || first.header("lease-duration") != "30" {
+		t.Errorf("expected lease deadline in delivery, got %v", first.headers)
+	}
+
+	// Второе сообщение возвращается в очередь и выдается повторно
+	c.send(newFrame("NACK", "id", second.header("ack")))
+	redelivered := c.expect("MESSAGE")
+	if string(redelivered.body) != "job 2" {
+		t.Fatalf("expected job 2 to be redelivered, got %q", redelivered.body)
+	}
+	c.send(newFrame("ACK", "id", first.header("ack")))
+	c.send(newFrame("ACK", "id", redelivered.header("ack"), "receipt", "done"))
+	c.expect("RECEIPT")
+
+	c.send(newFrame("DISCONNECT", "receipt", "bye"))
+	c.expect("RECEIPT")
+	if _, err := qb.Dequeue("jobs", 0); err == nil {
+		t.Error("acknowledged messages must be removed")
+	}
+}
+
+func TestDisconnectReturnsUnackedMessages(t *testing.T) {
+	qb := broker.NewQueueBroker(10, 10, 1)
+	s, addr := startServer(t, qb)
+	qb.PutMessage("jobs", "job 1")
+	c := dial(t, addr)
+
+	c.send(newFrame("SUBSCRIBE", "id", "s1", "destination", "jobs", "ack", "client"))
+	c.expect("MESSAGE")
+	c.nc.Close()
+
+	// Сообщение возвращается сразу, не дожидаясь истечения блокировки
+	deadline := time.Now().Add(2 * time.Second)
+	for qb.Depth("jobs") == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.Close()
+	if msg, err := qb.Dequeue("jobs", 0); err != nil || msg.Body != "job 1" {
+		t.Errorf("expected unacked message back in queue, got %+v %v", msg, err)
+	}
+}
+
+// TestWebSocket проверяет STOMP поверх WebSocket с маскированными кадрами клиента
+func TestWebSocket(t *testing.T) {
+	qb := broker.NewQueueBroker(10, 10, 1)
+	s := NewServer(qb)
+	server := httptest.NewServer(s.WebSocketHandler())
+	defer server.Close()
+	defer s.Close()
+
+	nc, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := make([]byte, 16)
+	rand.Read(key)
+	req, _ := http.NewRequest("GET", server.URL+"/stomp", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", base64.StdEncoding.EncodeToString(key))
+	req.Header.Set("Sec-WebSocket-Protocol", "v10.stomp, v12.stomp")
+	req.Write(nc)
+
+	br := bufio.NewReader(nc)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil || resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Protocol") != "v12.stomp" {
+		t.Fatalf("unexpected handshake response %+v %v", resp, err)
+	}
+
+	ws := &clientWS{Conn: nc, r: br}
+	c := newTestClient(t, ws, ws)
+	send := newFrame("SEND", "destination", "/queue/ws", "receipt", "r1")
+	send.body = []byte("over websocket")
+	c.send(send)
+	c.expect("RECEIPT")
+	c.send(newFrame("SUBSCRIBE", "id", "s1", "destination", "/queue/ws"))
+	if f := c.expect("MESSAGE"); string(f.body) != "over websocket" {
+		t.Errorf("unexpected message body %q", f.body)
+	}
+}
+
+// clientWS клиентская сторона WebSocket: записи маскируются, чтение
+// разбирает кадры сервера
+type clientWS struct {
+	net.Conn
+	r       *bufio.Reader
+	pending []byte
+}
+
+func (c *clientWS) Write(p []byte) (int, error) {
+	mask := [4]byte{1, 2, 3, 4}
+	buf := []byte{0x80 | wsText}
+	if len(p) < 126 {
+		buf = append(buf, 0x80|byte(len(p)))
+	} else {
+		buf = append(buf, 0x80|126)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(len(p)))
+	}
+	buf = append(buf, mask[:]...)
+	for i, b := range p {
+		buf = append(buf, b^mask[i%4])
+	}
+	if _, err := c.Conn.Write(buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *clientWS) Read(p []byte) (int, error) {
+	for len(c.pending) == 0 {
+		var header [2]byte
+		if _, err := io.ReadFull(c.r, header[:]); err != nil {
+			return 0, err
+		}
+		length := int(header[1] & 0x7f)
+		if length == 126 {
+			var ext [2]byte
+			io.ReadFull(c.r, ext[:])
+			length = int(binary.BigEndian.Uint16(ext[:]))
+		}
+		c.pending = make([]byte, length)
+		if _, err := io.ReadFull(c.r, c.pending); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
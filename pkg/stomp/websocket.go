@@ -0,0 +1,219 @@
+package stomp
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"queue-broker/pkg/httperr"
+)
+
+// websocketGUID константа из RFC 6455 для вычисления Sec-WebSocket-Accept
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Коды операций WebSocket
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xa
+)
+
+// stompSubprotocols подпротоколы STOMP в порядке предпочтения
+var stompSubprotocols = []string{"v12.stomp", "v11.stomp", "v10.stomp"}
+
+// WebSocketHandler принимает STOMP-соединения поверх WebSocket (например, от stomp.js)
+func (s *Server) WebSocketHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet ||
+			!headerContains(r.Header, "Connection", "upgrade") ||
+			!headerContains(r.Header, "Upgrade", "websocket") ||
+			r.Header.Get("Sec-WebSocket-Version") != "13" {
+			httperr.Error(w, "WebSocket upgrade required", http.StatusUpgradeRequired)
+			return
+		}
+		key := r.Header.Get("Sec-WebSocket-Key")
+		if key == "" {
+			httperr.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+
+		protocol := ""
+		for _, p := range stompSubprotocols {
+			if headerContains(r.Header, "Sec-WebSocket-Protocol", p) {
+				protocol = p
+				break
+			}
+		}
+
+		hijacker, ok := w.(http.Hijacker)
+		if !ok {
+			httperr.Error(w, "WebSocket unsupported", http.StatusInternalServerError)
+			return
+		}
+		nc, rw, err := hijacker.Hijack()
+		if err != nil {
+			return
+		}
+
+		sum := sha1.Sum([]byte(key + websocketGUID))
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+		rw.WriteString("Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n")
+		if protocol != "" {
+			rw.WriteString("Sec-WebSocket-Protocol: " + protocol + "\r\n")
+		}
+		rw.WriteString("\r\n")
+		if err := rw.Flush(); err != nil {
+			nc.Close()
+			return
+		}
+
+		s.serveConn(&wsConn{Conn: nc, r: rw.Reader})
+	})
+}
+
+func headerContains(h http.Header, name, value string) bool {
+	for _, v := range h.Values(name) {
+		for _, token := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// wsConn представляет соединение WebSocket как поток байт: данные
+// входящих сообщений читаются подряд, каждая запись отправляется одним
+// текстовым сообщением
+type wsConn struct {
+	net.Conn
+	r *bufio.Reader
+
+	// payload непрочитанный остаток текущего кадра
+	payload io.Reader
+	mask    [4]byte
+	offset  int
+
+	writeMu sync.Mutex
+}
+
+func (c *wsConn) Read(p []byte) (int, error) {
+	for {
+		if c.payload != nil {
+			n, err := c.payload.Read(p)
+			// Без маски ключ нулевой, и XOR не меняет данные
+			for i := 0; i < n; i++ {
+				p[i] ^= c.mask[(c.offset+i)%4]
+			}
+			c.offset += n
+			if err == io.EOF {
+				c.payload = nil
+				err = nil
+			}
+			if n > 0 || err != nil {
+				return n, err
+			}
+			continue
+		}
+		if err := c.nextFrame(); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// nextFrame читает заголовок следующего кадра данных, отвечая на служебные кадры
+func (c *wsConn) nextFrame() error {
+	for {
+		var header [2]byte
+		if _, err := io.ReadFull(c.r, header[:]); err != nil {
+			return err
+		}
+		opcode := header[0] & 0x0f
+		masked := header[1]&0x80 != 0
+		length := uint64(header[1] & 0x7f)
+		switch length {
+		case 126:
+			var ext [2]byte
+			if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+				return err
+			}
+			length = uint64(binary.BigEndian.Uint16(ext[:]))
+		case 127:
+			var ext [8]byte
+			if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+				return err
+			}
+			length = binary.BigEndian.Uint64(ext[:])
+		}
+		if length > maxFrameSize {
+			return errors.New("websocket frame too large")
+		}
+		var mask [4]byte
+		if masked {
+			if _, err := io.ReadFull(c.r, mask[:]); err != nil {
+				return err
+			}
+		}
+
+		switch opcode {
+		case wsText, wsBinary, wsContinuation:
+			c.payload = io.LimitReader(c.r, int64(length))
+			c.mask, c.offset = mask, 0
+			return nil
+		case wsPing, wsClose:
+			data := make([]byte, length)
+			if _, err := io.ReadFull(c.r, data); err != nil {
+				return err
+			}
+			for i := range data {
+				data[i] ^= mask[i%4]
+			}
+			if opcode == wsClose {
+				c.writeFrame(wsClose, data)
+				return io.EOF
+			}
+			c.writeFrame(wsPong, data)
+		default:
+			if _, err := io.CopyN(io.Discard, c.r, int64(length)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (c *wsConn) Write(p []byte) (int, error) {
+	if err := c.writeFrame(wsText, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// writeFrame отправляет кадр сервера (без маски)
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	buf := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		buf = append(buf, byte(n))
+	case n <= 0xffff:
+		buf = append(buf, 126)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(n))
+	default:
+		buf = append(buf, 127)
+		buf = binary.BigEndian.AppendUint64(buf, uint64(n))
+	}
+	_, err := c.Conn.Write(append(buf, payload...))
+	return err
+}